@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/veandco/go-sdl2/mix"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+const (
+	analysisSize  = 1024 // Samples per FFT, a power of two
+	analysisBands = 32
+	analysisFloor = -60.0 // dB shown as an empty bar
+	meterFall     = 1.5   // Fraction of full scale per second
+	peakHold      = 1.0   // Seconds
+)
+
+// The mixed output as seen by the analyser, any effect can read these
+type audioAnalysis struct {
+	peak, rms [2]float64 // Left and right, 0 to 1
+	bands     []float64  // Spectrum from low to high, 0 to 1
+	waveform  []float64  // The latest mono samples, -1 to 1
+}
+
+var (
+	analysisMutex    sync.Mutex
+	analysisRing     [2][analysisSize]float64
+	analysisPosition int
+
+	analysis        = audioAnalysis{bands: make([]float64, analysisBands), waveform: make([]float64, analysisSize)}
+	analysisRate    = 44100
+	analyserEnabled bool
+	peakHolds       [2]float64
+	peakHoldTimes   [2]float64
+)
+
+// Taps the final mix, so it works for anything SDL_mixer plays
+func setupAnalyser() {
+	if frequency, _, _, _, err := mix.QuerySpec(); err == nil && frequency > 0 {
+		analysisRate = frequency
+	}
+	mix.SetPostMix(analyseStream)
+}
+
+// Keeps the last of what was played, 16-bit stereo as it goes out
+func analyseStream(stream []uint8) {
+	analysisMutex.Lock()
+	defer analysisMutex.Unlock()
+	for i := 0; i+3 < len(stream); i += 4 {
+		analysisRing[0][analysisPosition] = float64(int16(binary.LittleEndian.Uint16(stream[i:]))) / 32768
+		analysisRing[1][analysisPosition] = float64(int16(binary.LittleEndian.Uint16(stream[i+2:]))) / 32768
+		analysisPosition = (analysisPosition + 1) % analysisSize
+	}
+}
+
+func updateAnalyser() {
+	var samples [2][analysisSize]float64
+	analysisMutex.Lock()
+	for channel := range samples {
+		for i := range samples[channel] {
+			samples[channel][i] = analysisRing[channel][(analysisPosition+i)%analysisSize]
+		}
+	}
+	analysisMutex.Unlock()
+
+	fall := meterFall * deltaTime
+	for channel := range samples {
+		var peak, sum float64
+		for _, s := range samples[channel] {
+			peak = math.Max(peak, math.Abs(s))
+			sum += s * s
+		}
+		// Meters jump up and fall back slowly
+		analysis.peak[channel] = math.Max(peak, analysis.peak[channel]-fall)
+		analysis.rms[channel] = math.Max(math.Sqrt(sum/analysisSize), analysis.rms[channel]-fall)
+
+		peakHoldTimes[channel] += deltaTime
+		if peak >= peakHolds[channel] || peakHoldTimes[channel] > peakHold {
+			peakHolds[channel], peakHoldTimes[channel] = peak, 0
+		}
+	}
+
+	// Hann windowed mono mix
+	spectrum := make([]complex128, analysisSize)
+	for i := range spectrum {
+		mono := (samples[0][i] + samples[1][i]) / 2
+		analysis.waveform[i] = mono
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/(analysisSize-1))
+		spectrum[i] = complex(mono*window, 0)
+	}
+	fft(spectrum)
+
+	// Bands are spaced evenly in octaves from about 40 Hz up to the top
+	binWidth := float64(analysisRate) / analysisSize
+	low, high := 40.0, math.Min(16000, float64(analysisRate)/2)
+	for band := range analysis.bands {
+		from := int(low * math.Pow(high/low, float64(band)/analysisBands) / binWidth)
+		to := int(low * math.Pow(high/low, float64(band+1)/analysisBands) / binWidth)
+		to = int(math.Max(float64(to), float64(from+1)))
+		var energy float64
+		for bin := from; bin < to && bin < analysisSize/2; bin++ {
+			energy = math.Max(energy, cmplx.Abs(spectrum[bin]))
+		}
+		// The window halves the amplitude, so a full scale sine is about analysisSize / 4
+		db := 20 * math.Log10(math.Max(energy/(analysisSize/4), 1e-9))
+		level := math.Max(0, math.Min(1, 1-db/analysisFloor))
+		analysis.bands[band] = math.Max(level, analysis.bands[band]-fall)
+	}
+}
+
+// In-place radix-2 FFT
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// Green at the bottom of a meter, through yellow to red at the top
+func meterColor(level float64) sdl.Color {
+	if level < 0.6 {
+		return lerpColor(sdl.Color{G: 200, A: 255}, sdl.Color{R: 255, G: 230, A: 255}, level/0.6)
+	}
+	return lerpColor(sdl.Color{R: 255, G: 230, A: 255}, sdl.Color{R: 255, G: 30, A: 255}, (level-0.6)/0.4)
+}
+
+func drawAnalyser() {
+	if !analyserEnabled {
+		return
+	}
+	drawEqualiser()
+	drawVUMeters()
+	drawOscilloscope()
+	flushBatch()
+}
+
+func drawEqualiser() {
+	const maxHeight = 120
+	bottom := float32(windowHeight) - 60
+	width := float32(windowWidth) / 2 / analysisBands
+	left := float32(windowWidth) / 4
+	for band, level := range analysis.bands {
+		height := float32(level) * maxHeight
+		x := left + float32(band)*width
+		top := meterColor(level)
+		batchQuad(x, bottom-height, x+width-2, bottom-height, x+width-2, bottom, x, bottom, top, top, meterColor(0), meterColor(0))
+	}
+}
+
+func drawVUMeters() {
+	const width, height = 200, 10
+	for channel := 0; channel < 2; channel++ {
+		x, y := float32(20), float32(20+channel*(height+4))
+		rms := float32(analysis.rms[channel])
+		batchRect(x, y, width*rms, height, meterColor(0), meterColor(float64(rms)))
+		hold := x + width*float32(math.Min(peakHolds[channel], 1))
+		c := meterColor(peakHolds[channel])
+		batchRect(hold-1, y, 2, height, c, c)
+	}
+}
+
+func drawOscilloscope() {
+	const amplitude = 60
+	centre := float32(windowHeight) - 250
+	step := float32(windowWidth) / float32(len(analysis.waveform)-1)
+	c := sdl.Color{R: 120, G: 255, B: 160, A: 255}
+	for i := 1; i < len(analysis.waveform); i++ {
+		batchLine(float32(i-1)*step, centre-float32(analysis.waveform[i-1])*amplitude, float32(i)*step, centre-float32(analysis.waveform[i])*amplitude, c, c)
+	}
+}
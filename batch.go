@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+)
+
+var (
+	// Lines, rects and spans become coloured triangles drawn in one geometry call
+	batchVertices []sdl.Vertex
+	batchIndices  []int32
+
+	// Sprites share a single texture and are drawn in a second geometry call
+	batchSpriteTexture  *sdl.Texture
+	batchSpriteVertices []sdl.Vertex
+	batchSpriteIndices  []int32
+
+	// Points are grouped by colour, one DrawPoints call per colour
+	batchPointColors []sdl.Color
+	batchPoints      = map[sdl.Color][]sdl.FPoint{}
+)
+
+func batchQuad(x0, y0, x1, y1, x2, y2, x3, y3 float32, c0, c1, c2, c3 sdl.Color) {
+	base := int32(len(batchVertices))
+	batchVertices = append(batchVertices,
+		sdl.Vertex{Position: sdl.FPoint{X: x0, Y: y0}, Color: c0},
+		sdl.Vertex{Position: sdl.FPoint{X: x1, Y: y1}, Color: c1},
+		sdl.Vertex{Position: sdl.FPoint{X: x2, Y: y2}, Color: c2},
+		sdl.Vertex{Position: sdl.FPoint{X: x3, Y: y3}, Color: c3},
+	)
+	batchIndices = append(batchIndices, base, base+1, base+2, base, base+2, base+3)
+}
+
+// Left and right colours give a horizontal gradient
+func batchRect(x, y, w, h float32, left, right sdl.Color) {
+	batchQuad(x, y, x+w, y, x+w, y+h, x, y+h, left, right, right, left)
+}
+
+// A one pixel wide line, shaded from c0 at the start to c1 at the end
+func batchLine(x0, y0, x1, y1 float32, c0, c1 sdl.Color) {
+	dx, dy := x1-x0, y1-y0
+	length := float32(math.Hypot(float64(dx), float64(dy)))
+	if length == 0 {
+		dx, length = 1, 1
+	}
+	// Half a pixel along and across the line so the end pixels are covered
+	ux, uy := dx/length*0.5, dy/length*0.5
+	nx, ny := -uy, ux
+	batchQuad(
+		x0-ux+nx, y0-uy+ny,
+		x1+ux+nx, y1+uy+ny,
+		x1+ux-nx, y1+uy-ny,
+		x0-ux-nx, y0-uy-ny,
+		c0, c1, c1, c0,
+	)
+}
+
+// A square sprite centred on x, y and tinted with c
+func batchSprite(texture *sdl.Texture, x, y, size float32, c sdl.Color) {
+	half := size / 2
+	batchTextureRect(texture, x-half, y-half, size, size, 0, 0, 1, 1, c, c)
+}
+
+// Part of a texture from u0, v0 to u1, v1, tinted with a horizontal gradient like batchRect
+func batchTextureRect(texture *sdl.Texture, x, y, w, h, u0, v0, u1, v1 float32, left, right sdl.Color) {
+	if texture != batchSpriteTexture {
+		// Everything queued so far goes underneath the new texture's sprites
+		flushBatch()
+		batchSpriteTexture = texture
+	}
+	base := int32(len(batchSpriteVertices))
+	batchSpriteVertices = append(batchSpriteVertices,
+		sdl.Vertex{Position: sdl.FPoint{X: x, Y: y}, Color: left, TexCoord: sdl.FPoint{X: u0, Y: v0}},
+		sdl.Vertex{Position: sdl.FPoint{X: x + w, Y: y}, Color: right, TexCoord: sdl.FPoint{X: u1, Y: v0}},
+		sdl.Vertex{Position: sdl.FPoint{X: x + w, Y: y + h}, Color: right, TexCoord: sdl.FPoint{X: u1, Y: v1}},
+		sdl.Vertex{Position: sdl.FPoint{X: x, Y: y + h}, Color: left, TexCoord: sdl.FPoint{X: u0, Y: v1}},
+	)
+	batchSpriteIndices = append(batchSpriteIndices, base, base+1, base+2, base, base+2, base+3)
+}
+
+func batchPoint(x, y float32, c sdl.Color) {
+	points, ok := batchPoints[c]
+	if !ok || len(points) == 0 {
+		batchPointColors = append(batchPointColors, c)
+	}
+	batchPoints[c] = append(points, sdl.FPoint{X: x, Y: y})
+}
+
+// Draws what has been queued in fixed layers, whatever order it came in: geometry, then sprites,
+// then points. Flush in between when something has to go on top of a lower layer
+func flushBatch() {
+	// The queues are emptied even if drawing fails, so they can't grow from frame to frame
+	defer clearBatch()
+	if len(batchIndices) > 0 {
+		err := renderer.RenderGeometry(nil, batchVertices, batchIndices)
+		if err != nil {
+			return
+		}
+	}
+	if len(batchSpriteIndices) > 0 {
+		err := renderer.RenderGeometry(batchSpriteTexture, batchSpriteVertices, batchSpriteIndices)
+		if err != nil {
+			return
+		}
+	}
+	for _, c := range batchPointColors {
+		err := renderer.SetDrawColor(c.R, c.G, c.B, c.A)
+		if err != nil {
+			return
+		}
+		err = renderer.DrawPointsF(batchPoints[c])
+		if err != nil {
+			return
+		}
+	}
+}
+
+func clearBatch() {
+	batchVertices = batchVertices[:0]
+	batchIndices = batchIndices[:0]
+	batchSpriteVertices = batchSpriteVertices[:0]
+	batchSpriteIndices = batchSpriteIndices[:0]
+	for _, c := range batchPointColors {
+		batchPoints[c] = batchPoints[c][:0]
+	}
+	batchPointColors = batchPointColors[:0]
+}
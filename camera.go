@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	cameraDistance = 3.0  // Default distance from the camera to the object
+	cameraNear     = 0.05 // Nothing closer than this to the camera is drawn
+)
+
+// The camera looks along its forward axis with y pointing down the screen.
+// The rows of orientation are its right, down and forward axes in world space.
+type Camera struct {
+	position    Point3D
+	orientation Matrix3
+	fov         float64 // Vertical field of view in radians
+}
+
+type cameraPath struct {
+	name   string
+	update func(t float64)
+}
+
+var (
+	camera = Camera{
+		position:    Point3D{0, 0, -cameraDistance},
+		orientation: identityMatrix(),
+		fov:         2 * math.Atan(1/cameraDistance),
+	}
+
+	// Camera paths, cycled with the V key or picked with "-camera name"
+	cameraPaths = []cameraPath{
+		{"static", staticCamera},
+		{"orbit", orbitCamera},
+		{"swoop", swoopCamera},
+		{"bank", bankCamera},
+	}
+	currentCameraPath int
+)
+
+func updateCamera() {
+	cameraPaths[currentCameraPath].update(time.Since(startTime).Seconds())
+}
+
+func cycleCameraPath() {
+	currentCameraPath = (currentCameraPath + 1) % len(cameraPaths)
+}
+
+func setCameraPath(name string) bool {
+	for i, path := range cameraPaths {
+		if path.name == name {
+			currentCameraPath = i
+			return true
+		}
+	}
+	return false
+}
+
+func staticCamera(t float64) {
+	lookAt(Point3D{0, 0, -cameraDistance}, Point3D{}, 0)
+}
+
+func orbitCamera(t float64) {
+	// Circle the object while bobbing up and down
+	eye := Point3D{cameraDistance * math.Sin(t*0.3), 0.8 * math.Sin(t*0.2), -cameraDistance * math.Cos(t*0.3)}
+	lookAt(eye, Point3D{}, 0)
+}
+
+func swoopCamera(t float64) {
+	// Dolly in and out past the object, banking into the turns
+	eye := Point3D{1.5 * math.Sin(t*0.4), math.Cos(t * 0.3), -cameraDistance - 1.2*math.Sin(t*0.25)}
+	lookAt(eye, Point3D{}, -0.3*math.Cos(t*0.4))
+}
+
+func bankCamera(t float64) {
+	lookAt(Point3D{0, 0, -cameraDistance}, Point3D{}, 0.35*math.Sin(t*0.5))
+}
+
+func lookAt(eye, target Point3D, roll float64) {
+	forward := normalizePoint(Point3D{target.x - eye.x, target.y - eye.y, target.z - eye.z})
+	right := normalizePoint(crossPoint(Point3D{0, 1, 0}, forward))
+	down := crossPoint(forward, right)
+
+	// Roll around the forward axis to bank the view
+	cosR, sinR := math.Cos(roll), math.Sin(roll)
+	right, down = Point3D{
+		right.x*cosR + down.x*sinR, right.y*cosR + down.y*sinR, right.z*cosR + down.z*sinR,
+	}, Point3D{
+		down.x*cosR - right.x*sinR, down.y*cosR - right.y*sinR, down.z*cosR - right.z*sinR,
+	}
+
+	camera.position = eye
+	camera.orientation = Matrix3{
+		{right.x, right.y, right.z},
+		{down.x, down.y, down.z},
+		{forward.x, forward.y, forward.z},
+	}
+}
+
+func crossPoint(a, b Point3D) Point3D {
+	return Point3D{a.y*b.z - a.z*b.y, a.z*b.x - a.x*b.z, a.x*b.y - a.y*b.x}
+}
+
+func normalizePoint(p Point3D) Point3D {
+	length := math.Sqrt(p.x*p.x + p.y*p.y + p.z*p.z)
+	if length == 0 {
+		return Point3D{0, 0, 1}
+	}
+	return Point3D{p.x / length, p.y / length, p.z / length}
+}
+
+func focalLength() float64 {
+	return float64(windowHeight) / 2 / math.Tan(camera.fov/2)
+}
+
+func toCameraSpace(p Point3D) Point3D {
+	return transformPoint(camera.orientation, Point3D{p.x - camera.position.x, p.y - camera.position.y, p.z - camera.position.z})
+}
+
+// Returns screen x and y, with z holding the depth in front of the camera
+func projectCameraSpace(p Point3D) Point3D {
+	depth := math.Max(p.z, cameraNear)
+	f := focalLength()
+	return Point3D{
+		float64(windowWidth)/2 + p.x/depth*f,
+		float64(windowHeight)/2 + p.y/depth*f,
+		depth,
+	}
+}
+
+func projectWorld(p Point3D) Point3D {
+	return projectCameraSpace(toCameraSpace(p))
+}
+
+// Depth of the object centre, stars nearer than this are drawn in front of it
+func objectDepth() float64 {
+	return toCameraSpace(Point3D{}).z
+}
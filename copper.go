@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PAL beam timings, positions are in colour clocks like the real copper
+const (
+	copperFrameLines   = 313
+	copperLastHPos     = 0xe2
+	copperFirstLine    = 0x2c // First line of the standard 256 line display window
+	copperDisplayLines = 256
+	copperFirstHPos    = 0x40 // Left and right edges of the display window
+	copperDisplayHPos  = 0xa0
+	copperMoveClocks   = 4 // Each MOVE keeps the copper busy for this long
+	copperWaitClocks   = 6 // And a WAIT or SKIP for this long once it wakes up
+	copperColorBase    = 0x180
+	copperNumColors    = 32
+)
+
+type copperInstruction struct {
+	wait, skip   bool
+	vpos, hpos   int // Beam position to wait for
+	vmask, hmask int
+	register     int // Custom chip register offset for a MOVE, e.g. $180 for COLOR00
+	value        uint16
+}
+
+// A colour register write, seen from the beam position where it happened
+type copperChange struct {
+	hpos     int
+	register int
+	value    uint16
+}
+
+var (
+	copperEnabled   bool
+	copperFile      string
+	copperList      []copperInstruction // Loaded from copperFile, otherwise generated every frame
+	copperRegisters [copperNumColors]uint16
+	copperWritten   [copperNumColors]bool // Registers the list wrote this frame
+	copperLineStart [copperFrameLines][copperNumColors]uint16
+	copperChanges   [copperFrameLines][]copperChange
+)
+
+func setupCopper() error {
+	if copperFile == "" {
+		return nil
+	}
+	list, err := loadCopperList(copperFile)
+	if err != nil {
+		return err
+	}
+	copperList = list
+	copperEnabled = true
+	return nil
+}
+
+func copperWait(vpos, hpos int) copperInstruction {
+	return copperInstruction{wait: true, vpos: vpos, hpos: hpos, vmask: 0xff, hmask: 0xfe}
+}
+
+func copperMove(register int, value uint16) copperInstruction {
+	return copperInstruction{register: register, value: value}
+}
+
+func copperEnd() copperInstruction {
+	return copperWait(0xff, 0xfe)
+}
+
+// Decodes a copper instruction from its two 16-bit words, as found in dc.w lists
+func decodeCopperWords(first, second uint16) copperInstruction {
+	if first&1 == 0 {
+		return copperMove(int(first&0x1fe), second)
+	}
+	return copperInstruction{
+		wait:  second&1 == 0,
+		skip:  second&1 == 1,
+		vpos:  int(first >> 8),
+		hpos:  int(first & 0xfe),
+		vmask: int(second>>8) | 0x80, // The top bit of the vertical position can't be masked
+		hmask: int(second & 0xfe),
+	}
+}
+
+func loadCopperList(path string) ([]copperInstruction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var list []copperInstruction
+	var words []uint16
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, ";*"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' })
+		if len(fields) == 0 {
+			continue
+		}
+
+		bad := func(err error) error {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "WAIT", "SKIP":
+			if len(fields) != 3 {
+				return nil, bad(fmt.Errorf("%s needs a line and a horizontal position", fields[0]))
+			}
+			vpos, err := parseCopperNumber(fields[1])
+			if err != nil {
+				return nil, bad(err)
+			}
+			hpos, err := parseCopperNumber(fields[2])
+			if err != nil {
+				return nil, bad(err)
+			}
+			instruction := copperWait(vpos, hpos&0xfe)
+			if strings.ToUpper(fields[0]) == "SKIP" {
+				instruction.wait, instruction.skip = false, true
+			}
+			list = append(list, instruction)
+		case "MOVE":
+			if len(fields) != 3 {
+				return nil, bad(fmt.Errorf("MOVE needs a register and a value"))
+			}
+			register, err := parseCopperRegister(fields[1])
+			if err != nil {
+				return nil, bad(err)
+			}
+			value, err := parseCopperNumber(fields[2])
+			if err != nil {
+				return nil, bad(err)
+			}
+			list = append(list, copperMove(register, uint16(value)))
+		case "END":
+			list = append(list, copperEnd())
+		default:
+			// Raw instruction words, with or without a dc.w in front
+			if strings.EqualFold(fields[0], "dc.w") {
+				fields = fields[1:]
+			}
+			for _, field := range fields {
+				word, err := parseCopperNumber(field)
+				if err != nil {
+					return nil, bad(err)
+				}
+				words = append(words, uint16(word))
+				if len(words) == 2 {
+					list = append(list, decodeCopperWords(words[0], words[1]))
+					words = words[:0]
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) != 0 {
+		return nil, fmt.Errorf("%s: odd number of copper words", path)
+	}
+	return list, nil
+}
+
+// Accepts $hex, 0xhex, %binary or decimal
+func parseCopperNumber(s string) (int, error) {
+	var n int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "$"):
+		n, err = strconv.ParseInt(s[1:], 16, 32)
+	case strings.HasPrefix(s, "%"):
+		n, err = strconv.ParseInt(s[1:], 2, 32)
+	default:
+		n, err = strconv.ParseInt(s, 0, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", s)
+	}
+	return int(n), nil
+}
+
+// Accepts COLOR00 to COLOR31 or a register offset
+func parseCopperRegister(s string) (int, error) {
+	upper := strings.ToUpper(s)
+	if strings.HasPrefix(upper, "COLOR") {
+		n, err := strconv.Atoi(upper[5:])
+		if err != nil || n < 0 || n >= copperNumColors {
+			return 0, fmt.Errorf("bad colour register %q", s)
+		}
+		return copperColorBase + 2*n, nil
+	}
+	return parseCopperNumber(s)
+}
+
+// Where the beam is when a WAIT or SKIP is satisfied, or false if not this frame
+func copperBeamReached(instruction copperInstruction, vpos, hpos int) (int, int, bool) {
+	targetV := instruction.vpos & instruction.vmask
+	targetH := instruction.hpos & instruction.hmask
+	for ; vpos < copperFrameLines; vpos, hpos = vpos+1, 0 {
+		// Only the low eight bits of the line are compared, hence the $ffdf trick
+		beamV := vpos & 0xff & instruction.vmask
+		if beamV > targetV {
+			return vpos, hpos, true
+		}
+		if beamV == targetV {
+			// The horizontal compare is only against the masked bits, so step to the first match
+			for h := hpos; h <= copperLastHPos; h += 2 {
+				if h&instruction.hmask >= targetH {
+					return vpos, h, true
+				}
+			}
+		}
+	}
+	return vpos, hpos, false
+}
+
+func runCopper(list []copperInstruction) {
+	vpos, hpos := 0, 0
+	copperLineStart[0] = copperRegisters
+	copperWritten = [copperNumColors]bool{}
+	for i := range copperChanges {
+		copperChanges[i] = copperChanges[i][:0]
+	}
+
+	// Snapshot the registers at the start of every line the beam passes
+	advance := func(v, h int) {
+		for h > copperLastHPos {
+			v, h = v+1, h-copperLastHPos-1
+		}
+		for line := vpos + 1; line <= v && line < copperFrameLines; line++ {
+			copperLineStart[line] = copperRegisters
+		}
+		vpos, hpos = v, h
+	}
+
+	for pc := 0; pc < len(list) && vpos < copperFrameLines; pc++ {
+		instruction := list[pc]
+		switch {
+		case instruction.wait:
+			v, h, ok := copperBeamReached(instruction, vpos, hpos)
+			if !ok {
+				advance(copperFrameLines, 0)
+				return
+			}
+			advance(v, h+copperWaitClocks)
+		case instruction.skip:
+			// Skips the next instruction if the beam is already there
+			if v, h, ok := copperBeamReached(instruction, vpos, hpos); ok && v == vpos && h == hpos {
+				pc++
+			}
+			advance(vpos, hpos+copperWaitClocks)
+		default:
+			// Only the colour registers mean anything here, the rest are ignored
+			if instruction.register >= copperColorBase && instruction.register < copperColorBase+2*copperNumColors {
+				register := (instruction.register - copperColorBase) / 2
+				copperRegisters[register] = instruction.value & 0xfff
+				copperWritten[register] = true
+				if vpos < copperFrameLines {
+					copperChanges[vpos] = append(copperChanges[vpos], copperChange{hpos, register, instruction.value & 0xfff})
+				}
+			}
+			advance(vpos, hpos+copperMoveClocks)
+		}
+	}
+	advance(copperFrameLines, 0)
+}
+
+func amigaColor(rgb uint16) sdl.Color {
+	return sdl.Color{R: uint8(rgb>>8&0xf) * 17, G: uint8(rgb>>4&0xf) * 17, B: uint8(rgb&0xf) * 17, A: 255}
+}
+
+// A palette register as the display window starts on the line under screen row y, COLOR00 being
+// the background. False when the copper is off or its list doesn't set the register
+func copperPalette(register int, y float32) (sdl.Color, bool) {
+	if !copperEnabled || !copperWritten[register] {
+		return sdl.Color{}, false
+	}
+	line := copperFirstLine + int(y)*copperDisplayLines/int(windowHeight)
+	line = int(math.Max(0, math.Min(float64(line), copperFrameLines-1)))
+	value := copperLineStart[line][register]
+	for _, change := range copperChanges[line] {
+		if change.register == register && change.hpos <= copperFirstHPos {
+			value = change.value
+		}
+	}
+	return amigaColor(value), true
+}
+
+// COLOR02 to COLOR13 on the line under screen row y, for the rainbow lines to cycle through
+func copperRainbow(y float32) ([][3]uint8, bool) {
+	var colors [][3]uint8
+	found := false
+	for register := 2; register <= 13; register++ {
+		c, ok := copperPalette(register, y)
+		found = found || ok
+		if !ok {
+			c = amigaColor(copperRegisters[register])
+		}
+		colors = append(colors, [3]uint8{c.R, c.G, c.B})
+	}
+	return colors, found
+}
+
+// Draws a scroller character in strips a display line high, each tinted by COLOR01 on its line
+func drawCopperChar(src sdl.Rect, x, y int32, flip bool) {
+	lineHeight := float32(windowHeight) / copperDisplayLines
+	u0, u1 := float32(src.X)/sheetWidth, float32(src.X+src.W)/sheetWidth
+	top, bottom := float32(y), float32(y+displayHeight)
+	for strip := top; strip < bottom; {
+		// Strips end on the display line boundaries so each takes one colour
+		next := (float32(math.Floor(float64(strip/lineHeight))) + 1) * lineHeight
+		if next <= strip {
+			next = strip + lineHeight
+		}
+		next = float32(math.Min(float64(next), float64(bottom)))
+		f0, f1 := (strip-top)/displayHeight, (next-top)/displayHeight
+		if flip {
+			f0, f1 = 1-f0, 1-f1
+		}
+		v0 := (float32(src.Y) + f0*float32(src.H)) / sheetHeight
+		v1 := (float32(src.Y) + f1*float32(src.H)) / sheetHeight
+		c, _ := copperPalette(1, strip)
+		batchTextureRect(fontTexture, float32(x), strip, displayWidth, next-strip, u0, v0, u1, v1, c, c)
+		strip = next
+	}
+}
+
+// A classic raster bar list, one WAIT and MOVE per line where the colour changes
+func generateCopperList(t float64) []copperInstruction {
+	bars := []struct {
+		color uint16
+		phase float64
+	}{
+		{0xf00, 0}, {0xf80, 0.5}, {0xff0, 1.0}, {0x0f0, 1.5}, {0x0ff, 2.0}, {0x00f, 2.5}, {0xf0f, 3.0},
+	}
+	const barLines = 24
+
+	list := []copperInstruction{copperMove(copperColorBase, 0x000)}
+	previous := uint16(0)
+	pastLine255 := false
+	for line := 0; line < copperDisplayLines; line++ {
+		var color uint16
+		for _, bar := range bars {
+			// Later bars have priority and cover the earlier ones
+			centre := copperDisplayLines/2 + int(90*math.Sin(t*1.5+bar.phase))
+			distance := math.Abs(float64(line - centre))
+			if distance < barLines/2 {
+				brightness := 1 - distance/(barLines/2)
+				color = scaleAmigaColor(bar.color, brightness)
+			}
+		}
+		if color != previous {
+			if copperFirstLine+line > 0xff && !pastLine255 {
+				// Only eight bits of the line are compared, so wait for the end of line 255 first
+				list = append(list, copperWait(0xff, 0xde))
+				pastLine255 = true
+			}
+			list = append(list, copperWait((copperFirstLine+line)&0xff, 0x07), copperMove(copperColorBase, color))
+			previous = color
+		}
+	}
+	return append(list, copperEnd())
+}
+
+func scaleAmigaColor(rgb uint16, brightness float64) uint16 {
+	r := uint16(math.Round(float64(rgb>>8&0xf) * brightness))
+	g := uint16(math.Round(float64(rgb>>4&0xf) * brightness))
+	b := uint16(math.Round(float64(rgb&0xf) * brightness))
+	return r<<8 | g<<4 | b
+}
+
+func drawCopper() {
+	if !copperEnabled {
+		return
+	}
+	list := copperList
+	if list == nil {
+		list = generateCopperList(time.Since(startTime).Seconds())
+	}
+	runCopper(list)
+
+	// COLOR00 is the background, split wherever the copper changed it mid-line
+	for line := 0; line < copperDisplayLines; line++ {
+		v := copperFirstLine + line
+		y0 := float32(line * int(windowHeight) / copperDisplayLines)
+		y1 := float32((line + 1) * int(windowHeight) / copperDisplayLines)
+		x0 := float32(0)
+		color := copperLineStart[v][0]
+		for _, change := range copperChanges[v] {
+			if change.register != 0 {
+				continue
+			}
+			x1 := float32(math.Max(0, math.Min(1, float64(change.hpos-copperFirstHPos)/copperDisplayHPos))) * float32(windowWidth)
+			if x1 > x0 {
+				c := amigaColor(color)
+				batchRect(x0, y0, x1-x0, y1-y0, c, c)
+				x0 = x1
+			}
+			color = change.value
+		}
+		c := amigaColor(color)
+		batchRect(x0, y0, float32(windowWidth)-x0, y1-y0, c, c)
+	}
+	flushBatch()
+}
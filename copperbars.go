@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	barSine = iota
+	barBounce
+	barLissajous
+)
+
+// How overlapping bars are combined
+const (
+	barPriorityOrder = iota // Later bars cover earlier ones
+	barPriorityDepth        // Bars swing through depth, the nearest one covers the others
+	barInterleave           // Overlapping bars take alternate lines
+)
+
+type copperBar struct {
+	stops     []uint16 // Gradient from top to bottom in 12-bit Amiga colour
+	height    int
+	motion    int
+	offset    float64 // Centre of the motion, in pixels below the middle of the screen
+	amplitude float64
+	frequency float64
+	phase     float64
+	front     bool // Drawn in front of the logo and scroller
+}
+
+var (
+	copperBars = []copperBar{
+		{[]uint16{0x000, 0xf00, 0x000}, 60, barSine, 30, 60, 2, 0.0, false},
+		{[]uint16{0x000, 0x0f0, 0x000}, 60, barSine, 60, 60, 2, 0.4, false},
+		{[]uint16{0x000, 0x00f, 0x000}, 60, barSine, 90, 60, 2, 0.8, false},
+		{[]uint16{0x000, 0xf00, 0x000}, 60, barSine, 120, 60, 2, 1.2, false},
+		{[]uint16{0x000, 0x0f0, 0x000}, 60, barSine, 150, 60, 2, 1.6, false},
+	}
+	barMotions    = map[string]int{"sine": barSine, "bounce": barBounce, "lissajous": barLissajous}
+	barPriority   = barPriorityOrder
+	barsFile      string
+	barLineColors []sdl.Color
+	barLineOwners []int
+	barBrightness = 1.0 // Pulsed by the music
+)
+
+func setupCopperBars() error {
+	if barsFile == "" {
+		return nil
+	}
+	bars, err := loadCopperBars(barsFile)
+	if err != nil {
+		return err
+	}
+	copperBars = bars
+	return nil
+}
+
+// One bar per line: stops height motion offset amplitude frequency phase [front]
+// e.g. "$000,$f00,$ff0,$f00,$000 48 bounce 100 80 1.5 0 front"
+func loadCopperBars(path string) ([]copperBar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var bars []copperBar
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		bar, err := parseCopperBar(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		bars = append(bars, bar)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("%s: no bars", path)
+	}
+	return bars, nil
+}
+
+func parseCopperBar(fields []string) (copperBar, error) {
+	var bar copperBar
+	if len(fields) != 7 && !(len(fields) == 8 && fields[7] == "front") {
+		return bar, fmt.Errorf("want stops height motion offset amplitude frequency phase [front]")
+	}
+
+	for _, stop := range strings.Split(fields[0], ",") {
+		color, err := parseCopperNumber(stop)
+		if err != nil {
+			return bar, err
+		}
+		bar.stops = append(bar.stops, uint16(color)&0xfff)
+	}
+	height, err := strconv.Atoi(fields[1])
+	if err != nil || height <= 0 {
+		return bar, fmt.Errorf("bad height %q", fields[1])
+	}
+	bar.height = height
+	motion, ok := barMotions[fields[2]]
+	if !ok {
+		return bar, fmt.Errorf("unknown motion %q", fields[2])
+	}
+	bar.motion = motion
+
+	var values [4]float64
+	for i := range values {
+		values[i], err = strconv.ParseFloat(fields[3+i], 64)
+		if err != nil {
+			return bar, fmt.Errorf("bad number %q", fields[3+i])
+		}
+	}
+	bar.offset, bar.amplitude, bar.frequency, bar.phase = values[0], values[1], values[2], values[3]
+	bar.front = len(fields) == 8
+	return bar, nil
+}
+
+func cycleBarPriority() {
+	barPriority = (barPriority + 1) % 3
+}
+
+// Returns the centre of the bar and how near it is, from -1 at the back to 1 at the front
+func barPosition(bar copperBar, t float64) (float64, float64) {
+	angle := bar.frequency*t + bar.phase
+	centre := float64(windowHeight)/2 + bar.offset
+	switch bar.motion {
+	case barBounce:
+		// Falls onto the bottom of its range and bounces back up
+		return centre + bar.amplitude - 2*bar.amplitude*math.Abs(math.Sin(angle/2)), math.Cos(angle)
+	case barLissajous:
+		// Height and depth trace a 3:2 Lissajous figure
+		return centre + bar.amplitude*math.Sin(angle*1.5), math.Sin(angle)
+	default:
+		return centre + bar.amplitude*math.Sin(angle), math.Cos(angle)
+	}
+}
+
+func barColor(bar copperBar, y int) sdl.Color {
+	if len(bar.stops) == 1 || bar.height == 1 {
+		return amigaColor(bar.stops[0])
+	}
+	position := float64(y) / float64(bar.height-1) * float64(len(bar.stops)-1)
+	i := int(math.Min(position, float64(len(bar.stops)-2)))
+	return lerpColor(amigaColor(bar.stops[i]), amigaColor(bar.stops[i+1]), position-float64(i))
+}
+
+func drawCopperBars(elapsedTime float64, front bool) {
+	if len(barLineColors) != int(windowHeight) {
+		barLineColors = make([]sdl.Color, windowHeight)
+		barLineOwners = make([]int, windowHeight)
+	}
+	for i := range barLineOwners {
+		barLineOwners[i] = -1
+	}
+
+	type placedBar struct {
+		index    int
+		top      int
+		nearness float64
+	}
+	var placed []placedBar
+	for i, bar := range copperBars {
+		if bar.front != front {
+			continue
+		}
+		centre, nearness := barPosition(bar, elapsedTime)
+		placed = append(placed, placedBar{i, int(centre) - bar.height/2, nearness})
+	}
+	if barPriority == barPriorityDepth {
+		sort.SliceStable(placed, func(i, j int) bool { return placed[i].nearness < placed[j].nearness })
+	}
+
+	// Work out the colour of every line, like a copper list would
+	for _, p := range placed {
+		bar := copperBars[p.index]
+		for y := 0; y < bar.height; y++ {
+			line := p.top + y
+			if line < 0 || line >= int(windowHeight) {
+				continue
+			}
+			if barPriority == barInterleave && barLineOwners[line] >= 0 && line%2 == 0 {
+				continue
+			}
+			barLineColors[line] = fadeColor(barColor(bar, y), barBrightness)
+			barLineOwners[line] = p.index
+		}
+	}
+
+	// Runs of the same colour become one rect
+	for line := 0; line < int(windowHeight); {
+		if barLineOwners[line] < 0 {
+			line++
+			continue
+		}
+		start, c := line, barLineColors[line]
+		for line < int(windowHeight) && barLineOwners[line] >= 0 && barLineColors[line] == c {
+			line++
+		}
+		batchRect(0, float32(start), float32(windowWidth), float32(line-start), c, c)
+	}
+	flushBatch()
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 6502 status flags
+const (
+	flagCarry     = 0x01
+	flagZero      = 0x02
+	flagInterrupt = 0x04
+	flagDecimal   = 0x08
+	flagBreak     = 0x10
+	flagUnused    = 0x20
+	flagOverflow  = 0x40
+	flagNegative  = 0x80
+)
+
+// Addressing modes
+const (
+	modeImplied = iota
+	modeAccumulator
+	modeImmediate
+	modeZeroPage
+	modeZeroPageX
+	modeZeroPageY
+	modeAbsolute
+	modeAbsoluteX
+	modeAbsoluteY
+	modeIndirect
+	modeIndirectX
+	modeIndirectY
+	modeRelative
+)
+
+type opcode6502 struct {
+	name string
+	mode int
+}
+
+type cpu6502 struct {
+	a, x, y, sp, p byte
+	pc             uint16
+	cycles         int
+	read           func(address uint16) byte
+	write          func(address uint16, value byte)
+}
+
+var (
+	modes6502 = map[string]int{
+		"imp": modeImplied, "acc": modeAccumulator, "imm": modeImmediate, "zp": modeZeroPage, "zpx": modeZeroPageX,
+		"zpy": modeZeroPageY, "abs": modeAbsolute, "abx": modeAbsoluteX, "aby": modeAbsoluteY, "ind": modeIndirect,
+		"izx": modeIndirectX, "izy": modeIndirectY, "rel": modeRelative,
+	}
+
+	// Every instruction with its opcode for each addressing mode, including the undocumented ones tunes use
+	opcodeSpecs = []string{
+		"ADC imm:69 zp:65 zpx:75 abs:6d abx:7d aby:79 izx:61 izy:71",
+		"AND imm:29 zp:25 zpx:35 abs:2d abx:3d aby:39 izx:21 izy:31",
+		"ASL acc:0a zp:06 zpx:16 abs:0e abx:1e",
+		"BCC rel:90", "BCS rel:b0", "BEQ rel:f0", "BMI rel:30", "BNE rel:d0", "BPL rel:10", "BVC rel:50", "BVS rel:70",
+		"BIT zp:24 abs:2c",
+		"BRK imp:00",
+		"CLC imp:18", "CLD imp:d8", "CLI imp:58", "CLV imp:b8",
+		"CMP imm:c9 zp:c5 zpx:d5 abs:cd abx:dd aby:d9 izx:c1 izy:d1",
+		"CPX imm:e0 zp:e4 abs:ec",
+		"CPY imm:c0 zp:c4 abs:cc",
+		"DEC zp:c6 zpx:d6 abs:ce abx:de",
+		"DEX imp:ca", "DEY imp:88",
+		"EOR imm:49 zp:45 zpx:55 abs:4d abx:5d aby:59 izx:41 izy:51",
+		"INC zp:e6 zpx:f6 abs:ee abx:fe",
+		"INX imp:e8", "INY imp:c8",
+		"JMP abs:4c ind:6c",
+		"JSR abs:20",
+		"LDA imm:a9 zp:a5 zpx:b5 abs:ad abx:bd aby:b9 izx:a1 izy:b1",
+		"LDX imm:a2 zp:a6 zpy:b6 abs:ae aby:be",
+		"LDY imm:a0 zp:a4 zpx:b4 abs:ac abx:bc",
+		"LSR acc:4a zp:46 zpx:56 abs:4e abx:5e",
+		"NOP imp:ea imp:1a imp:3a imp:5a imp:7a imp:da imp:fa imm:80 imm:82 imm:89 imm:c2 imm:e2 zp:04 zp:44 zp:64 " +
+			"zpx:14 zpx:34 zpx:54 zpx:74 zpx:d4 zpx:f4 abs:0c abx:1c abx:3c abx:5c abx:7c abx:dc abx:fc",
+		"ORA imm:09 zp:05 zpx:15 abs:0d abx:1d aby:19 izx:01 izy:11",
+		"PHA imp:48", "PHP imp:08", "PLA imp:68", "PLP imp:28",
+		"ROL acc:2a zp:26 zpx:36 abs:2e abx:3e",
+		"ROR acc:6a zp:66 zpx:76 abs:6e abx:7e",
+		"RTI imp:40", "RTS imp:60",
+		"SBC imm:e9 imm:eb zp:e5 zpx:f5 abs:ed abx:fd aby:f9 izx:e1 izy:f1",
+		"SEC imp:38", "SED imp:f8", "SEI imp:78",
+		"STA zp:85 zpx:95 abs:8d abx:9d aby:99 izx:81 izy:91",
+		"STX zp:86 zpy:96 abs:8e",
+		"STY zp:84 zpx:94 abs:8c",
+		"TAX imp:aa", "TAY imp:a8", "TSX imp:ba", "TXA imp:8a", "TXS imp:9a", "TYA imp:98",
+		"LAX zp:a7 zpy:b7 abs:af aby:bf izx:a3 izy:b3",
+		"SAX zp:87 zpy:97 abs:8f izx:83",
+		"DCP zp:c7 zpx:d7 abs:cf abx:df aby:db izx:c3 izy:d3",
+		"ISC zp:e7 zpx:f7 abs:ef abx:ff aby:fb izx:e3 izy:f3",
+		"SLO zp:07 zpx:17 abs:0f abx:1f aby:1b izx:03 izy:13",
+		"RLA zp:27 zpx:37 abs:2f abx:3f aby:3b izx:23 izy:33",
+		"SRE zp:47 zpx:57 abs:4f abx:5f aby:5b izx:43 izy:53",
+		"RRA zp:67 zpx:77 abs:6f abx:7f aby:7b izx:63 izy:73",
+		"ANC imm:0b imm:2b", "ALR imm:4b",
+	}
+	opcodes6502 = buildOpcodeTable()
+
+	// Cycles taken by every opcode, ignoring page crossings
+	cycles6502 = [256]byte{
+		7, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+		6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+		6, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+		6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+		2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, 2, 6, 2, 6, 4, 4, 4, 4, 2, 5, 2, 5, 5, 5, 5, 5,
+		2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4, 2, 5, 2, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4,
+		2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+		2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6, 2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	}
+)
+
+func buildOpcodeTable() [256]opcode6502 {
+	var table [256]opcode6502
+	for _, spec := range opcodeSpecs {
+		fields := strings.Fields(spec)
+		for _, field := range fields[1:] {
+			mode, code, _ := strings.Cut(field, ":")
+			n, err := strconv.ParseUint(code, 16, 8)
+			if err != nil {
+				panic("bad opcode " + field)
+			}
+			table[n] = opcode6502{fields[0], modes6502[mode]}
+		}
+	}
+	return table
+}
+
+func (cpu *cpu6502) reset() {
+	cpu.a, cpu.x, cpu.y = 0, 0, 0
+	cpu.sp, cpu.p = 0xff, flagUnused|flagInterrupt
+}
+
+func (cpu *cpu6502) read16(address uint16) uint16 {
+	return uint16(cpu.read(address)) | uint16(cpu.read(address+1))<<8
+}
+
+// JMP ($xxff) fetches the high byte from the start of the same page
+func (cpu *cpu6502) read16Bug(address uint16) uint16 {
+	high := address&0xff00 | uint16(byte(address)+1)
+	return uint16(cpu.read(address)) | uint16(cpu.read(high))<<8
+}
+
+func (cpu *cpu6502) push(value byte) {
+	cpu.write(0x100|uint16(cpu.sp), value)
+	cpu.sp--
+}
+
+func (cpu *cpu6502) pull() byte {
+	cpu.sp++
+	return cpu.read(0x100 | uint16(cpu.sp))
+}
+
+func (cpu *cpu6502) push16(value uint16) {
+	cpu.push(byte(value >> 8))
+	cpu.push(byte(value))
+}
+
+func (cpu *cpu6502) pull16() uint16 {
+	low := uint16(cpu.pull())
+	return low | uint16(cpu.pull())<<8
+}
+
+func (cpu *cpu6502) setZN(value byte) {
+	cpu.p &^= flagZero | flagNegative
+	if value == 0 {
+		cpu.p |= flagZero
+	}
+	cpu.p |= value & flagNegative
+}
+
+func (cpu *cpu6502) setFlag(flag byte, on bool) {
+	if on {
+		cpu.p |= flag
+	} else {
+		cpu.p &^= flag
+	}
+}
+
+// The address an instruction works on, moving the program counter past its operand
+func (cpu *cpu6502) operand(mode int) uint16 {
+	pc := cpu.pc
+	switch mode {
+	case modeImmediate:
+		cpu.pc++
+		return pc
+	case modeZeroPage:
+		cpu.pc++
+		return uint16(cpu.read(pc))
+	case modeZeroPageX:
+		cpu.pc++
+		return uint16(cpu.read(pc) + cpu.x)
+	case modeZeroPageY:
+		cpu.pc++
+		return uint16(cpu.read(pc) + cpu.y)
+	case modeAbsolute:
+		cpu.pc += 2
+		return cpu.read16(pc)
+	case modeAbsoluteX:
+		cpu.pc += 2
+		return cpu.read16(pc) + uint16(cpu.x)
+	case modeAbsoluteY:
+		cpu.pc += 2
+		return cpu.read16(pc) + uint16(cpu.y)
+	case modeIndirect:
+		cpu.pc += 2
+		return cpu.read16Bug(cpu.read16(pc))
+	case modeIndirectX:
+		cpu.pc++
+		return cpu.read16Bug(uint16(cpu.read(pc) + cpu.x))
+	case modeIndirectY:
+		cpu.pc++
+		return cpu.read16Bug(uint16(cpu.read(pc))) + uint16(cpu.y)
+	case modeRelative:
+		cpu.pc++
+		return cpu.pc + uint16(int8(cpu.read(pc)))
+	}
+	return 0
+}
+
+func (cpu *cpu6502) adc(value byte) {
+	carry := uint16(cpu.p & flagCarry)
+	if cpu.p&flagDecimal != 0 {
+		// Binary coded decimal, with the flags worked out the way the NMOS 6502 does
+		low := uint16(cpu.a&0xf) + uint16(value&0xf) + carry
+		if low > 9 {
+			low += 6
+		}
+		high := uint16(cpu.a>>4) + uint16(value>>4)
+		if low > 0xf {
+			high++
+		}
+		cpu.setFlag(flagZero, byte(uint16(cpu.a)+uint16(value)+carry) == 0)
+		cpu.setFlag(flagNegative, high&8 != 0)
+		cpu.setFlag(flagOverflow, (^(cpu.a^value)&(cpu.a^byte(high<<4)))&0x80 != 0)
+		if high > 9 {
+			high += 6
+		}
+		cpu.setFlag(flagCarry, high > 0xf)
+		cpu.a = byte(high<<4 | low&0xf)
+		return
+	}
+	sum := uint16(cpu.a) + uint16(value) + carry
+	cpu.setFlag(flagCarry, sum > 0xff)
+	cpu.setFlag(flagOverflow, (^(cpu.a^value)&(cpu.a^byte(sum)))&0x80 != 0)
+	cpu.a = byte(sum)
+	cpu.setZN(cpu.a)
+}
+
+func (cpu *cpu6502) sbc(value byte) {
+	if cpu.p&flagDecimal == 0 {
+		cpu.adc(^value)
+		return
+	}
+	borrow := 1 - int(cpu.p&flagCarry)
+	difference := int(cpu.a) - int(value) - borrow
+	low := int(cpu.a&0xf) - int(value&0xf) - borrow
+	high := int(cpu.a>>4) - int(value>>4)
+	if low < 0 {
+		low -= 6
+		high--
+	}
+	if high < 0 {
+		high -= 6
+	}
+	cpu.setFlag(flagCarry, difference >= 0)
+	cpu.setFlag(flagOverflow, ((cpu.a^value)&(cpu.a^byte(difference)))&0x80 != 0)
+	cpu.setZN(byte(difference))
+	cpu.a = byte(high<<4 | low&0xf)
+}
+
+func (cpu *cpu6502) compare(register, value byte) {
+	cpu.setFlag(flagCarry, register >= value)
+	cpu.setZN(register - value)
+}
+
+func (cpu *cpu6502) asl(value byte) byte {
+	cpu.setFlag(flagCarry, value&0x80 != 0)
+	value <<= 1
+	cpu.setZN(value)
+	return value
+}
+
+func (cpu *cpu6502) lsr(value byte) byte {
+	cpu.setFlag(flagCarry, value&1 != 0)
+	value >>= 1
+	cpu.setZN(value)
+	return value
+}
+
+func (cpu *cpu6502) rol(value byte) byte {
+	carry := cpu.p & flagCarry
+	cpu.setFlag(flagCarry, value&0x80 != 0)
+	value = value<<1 | carry
+	cpu.setZN(value)
+	return value
+}
+
+func (cpu *cpu6502) ror(value byte) byte {
+	carry := cpu.p & flagCarry
+	cpu.setFlag(flagCarry, value&1 != 0)
+	value = value>>1 | carry<<7
+	cpu.setZN(value)
+	return value
+}
+
+func (cpu *cpu6502) branch(taken bool, address uint16) {
+	if taken {
+		cpu.pc = address
+		cpu.cycles++
+	}
+}
+
+// Runs one instruction, false if it was one that locks up the CPU
+func (cpu *cpu6502) step() bool {
+	code := cpu.read(cpu.pc)
+	op := opcodes6502[code]
+	if op.name == "" {
+		return false
+	}
+	cpu.pc++
+	cpu.cycles += int(cycles6502[code])
+	address := cpu.operand(op.mode)
+
+	// Read-modify-write instructions work on the accumulator or memory
+	modify := func(f func(byte) byte) byte {
+		if op.mode == modeAccumulator {
+			cpu.a = f(cpu.a)
+			return cpu.a
+		}
+		value := f(cpu.read(address))
+		cpu.write(address, value)
+		return value
+	}
+
+	switch op.name {
+	case "ADC":
+		cpu.adc(cpu.read(address))
+	case "AND":
+		cpu.a &= cpu.read(address)
+		cpu.setZN(cpu.a)
+	case "ASL":
+		modify(cpu.asl)
+	case "BCC":
+		cpu.branch(cpu.p&flagCarry == 0, address)
+	case "BCS":
+		cpu.branch(cpu.p&flagCarry != 0, address)
+	case "BEQ":
+		cpu.branch(cpu.p&flagZero != 0, address)
+	case "BMI":
+		cpu.branch(cpu.p&flagNegative != 0, address)
+	case "BNE":
+		cpu.branch(cpu.p&flagZero == 0, address)
+	case "BPL":
+		cpu.branch(cpu.p&flagNegative == 0, address)
+	case "BVC":
+		cpu.branch(cpu.p&flagOverflow == 0, address)
+	case "BVS":
+		cpu.branch(cpu.p&flagOverflow != 0, address)
+	case "BIT":
+		value := cpu.read(address)
+		cpu.setFlag(flagZero, cpu.a&value == 0)
+		cpu.p = cpu.p&^(flagNegative|flagOverflow) | value&(flagNegative|flagOverflow)
+	case "BRK":
+		cpu.push16(cpu.pc + 1)
+		cpu.push(cpu.p | flagBreak | flagUnused)
+		cpu.p |= flagInterrupt
+		cpu.pc = cpu.read16(0xfffe)
+	case "CLC":
+		cpu.p &^= flagCarry
+	case "CLD":
+		cpu.p &^= flagDecimal
+	case "CLI":
+		cpu.p &^= flagInterrupt
+	case "CLV":
+		cpu.p &^= flagOverflow
+	case "CMP":
+		cpu.compare(cpu.a, cpu.read(address))
+	case "CPX":
+		cpu.compare(cpu.x, cpu.read(address))
+	case "CPY":
+		cpu.compare(cpu.y, cpu.read(address))
+	case "DEC":
+		modify(func(v byte) byte { cpu.setZN(v - 1); return v - 1 })
+	case "DEX":
+		cpu.x--
+		cpu.setZN(cpu.x)
+	case "DEY":
+		cpu.y--
+		cpu.setZN(cpu.y)
+	case "EOR":
+		cpu.a ^= cpu.read(address)
+		cpu.setZN(cpu.a)
+	case "INC":
+		modify(func(v byte) byte { cpu.setZN(v + 1); return v + 1 })
+	case "INX":
+		cpu.x++
+		cpu.setZN(cpu.x)
+	case "INY":
+		cpu.y++
+		cpu.setZN(cpu.y)
+	case "JMP":
+		cpu.pc = address
+	case "JSR":
+		cpu.push16(cpu.pc - 1)
+		cpu.pc = address
+	case "LDA":
+		cpu.a = cpu.read(address)
+		cpu.setZN(cpu.a)
+	case "LDX":
+		cpu.x = cpu.read(address)
+		cpu.setZN(cpu.x)
+	case "LDY":
+		cpu.y = cpu.read(address)
+		cpu.setZN(cpu.y)
+	case "LSR":
+		modify(cpu.lsr)
+	case "NOP":
+	case "ORA":
+		cpu.a |= cpu.read(address)
+		cpu.setZN(cpu.a)
+	case "PHA":
+		cpu.push(cpu.a)
+	case "PHP":
+		cpu.push(cpu.p | flagBreak | flagUnused)
+	case "PLA":
+		cpu.a = cpu.pull()
+		cpu.setZN(cpu.a)
+	case "PLP":
+		cpu.p = cpu.pull()&^flagBreak | flagUnused
+	case "ROL":
+		modify(cpu.rol)
+	case "ROR":
+		modify(cpu.ror)
+	case "RTI":
+		cpu.p = cpu.pull()&^flagBreak | flagUnused
+		cpu.pc = cpu.pull16()
+	case "RTS":
+		cpu.pc = cpu.pull16() + 1
+	case "SBC":
+		cpu.sbc(cpu.read(address))
+	case "SEC":
+		cpu.p |= flagCarry
+	case "SED":
+		cpu.p |= flagDecimal
+	case "SEI":
+		cpu.p |= flagInterrupt
+	case "STA":
+		cpu.write(address, cpu.a)
+	case "STX":
+		cpu.write(address, cpu.x)
+	case "STY":
+		cpu.write(address, cpu.y)
+	case "TAX":
+		cpu.x = cpu.a
+		cpu.setZN(cpu.x)
+	case "TAY":
+		cpu.y = cpu.a
+		cpu.setZN(cpu.y)
+	case "TSX":
+		cpu.x = cpu.sp
+		cpu.setZN(cpu.x)
+	case "TXA":
+		cpu.a = cpu.x
+		cpu.setZN(cpu.a)
+	case "TXS":
+		cpu.sp = cpu.x
+	case "TYA":
+		cpu.a = cpu.y
+		cpu.setZN(cpu.a)
+
+	// Undocumented instructions, mostly a read-modify-write followed by an ALU operation
+	case "LAX":
+		cpu.a = cpu.read(address)
+		cpu.x = cpu.a
+		cpu.setZN(cpu.a)
+	case "SAX":
+		cpu.write(address, cpu.a&cpu.x)
+	case "DCP":
+		cpu.compare(cpu.a, modify(func(v byte) byte { return v - 1 }))
+	case "ISC":
+		cpu.sbc(modify(func(v byte) byte { return v + 1 }))
+	case "SLO":
+		cpu.a |= modify(cpu.asl)
+		cpu.setZN(cpu.a)
+	case "RLA":
+		cpu.a &= modify(cpu.rol)
+		cpu.setZN(cpu.a)
+	case "SRE":
+		cpu.a ^= modify(cpu.lsr)
+		cpu.setZN(cpu.a)
+	case "RRA":
+		cpu.adc(modify(cpu.ror))
+	case "ANC":
+		cpu.a &= cpu.read(address)
+		cpu.setZN(cpu.a)
+		cpu.setFlag(flagCarry, cpu.a&0x80 != 0)
+	case "ALR":
+		cpu.a = cpu.lsr(cpu.a & cpu.read(address))
+	}
+	return true
+}
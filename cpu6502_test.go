@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+// Runs single instructions from $0400 and checks the registers, flags and memory they leave
+func TestCPU6502(t *testing.T) {
+	const nvzc = flagNegative | flagOverflow | flagZero | flagCarry
+	cases := []struct {
+		name    string
+		program []byte
+		a, x, p byte
+		memory  map[uint16]byte
+		wantA   byte
+		wantP   byte   // Only the negative, overflow, zero and carry flags are compared
+		wantPC  uint16 // 0 for the instruction after
+		wantMem map[uint16]byte
+	}{
+		// Binary ADC and SBC
+		{name: "ADC overflow", program: []byte{0x69, 0x50}, a: 0x50, wantA: 0xa0, wantP: flagNegative | flagOverflow},
+		{name: "ADC carry out", program: []byte{0x69, 0x01}, a: 0xff, wantA: 0x00, wantP: flagZero | flagCarry},
+		{name: "ADC carry in", program: []byte{0x69, 0x10}, a: 0x01, p: flagCarry, wantA: 0x12},
+		{name: "SBC borrow", program: []byte{0xe9, 0xf0}, a: 0x50, p: flagCarry, wantA: 0x60},
+		{name: "SBC overflow", program: []byte{0xe9, 0x01}, a: 0x80, p: flagCarry, wantA: 0x7f, wantP: flagOverflow | flagCarry},
+		{name: "SBC borrow in", program: []byte{0xe9, 0x01}, a: 0x05, wantA: 0x03, wantP: flagCarry},
+
+		// Decimal mode, where the NMOS 6502 sets N and V from the sum before the high digit is corrected
+		{name: "ADC BCD carry", program: []byte{0x69, 0x46}, a: 0x58, p: flagDecimal | flagCarry, wantA: 0x05, wantP: flagNegative | flagOverflow | flagCarry},
+		{name: "ADC BCD", program: []byte{0x69, 0x34}, a: 0x12, p: flagDecimal, wantA: 0x46},
+		{name: "ADC BCD digit carry", program: []byte{0x69, 0x26}, a: 0x15, p: flagDecimal, wantA: 0x41},
+		{name: "ADC BCD wrap", program: []byte{0x69, 0x01}, a: 0x99, p: flagDecimal, wantA: 0x00, wantP: flagCarry | flagNegative},
+		{name: "SBC BCD", program: []byte{0xe9, 0x12}, a: 0x46, p: flagDecimal | flagCarry, wantA: 0x34, wantP: flagCarry},
+		{name: "SBC BCD digit borrow", program: []byte{0xe9, 0x13}, a: 0x40, p: flagDecimal | flagCarry, wantA: 0x27, wantP: flagCarry},
+		{name: "SBC BCD borrow in", program: []byte{0xe9, 0x02}, a: 0x32, p: flagDecimal, wantA: 0x29, wantP: flagCarry},
+		{name: "SBC BCD borrow out", program: []byte{0xe9, 0x21}, a: 0x12, p: flagDecimal | flagCarry, wantA: 0x91, wantP: flagNegative},
+
+		// JMP ($xxFF) takes the high byte from the start of the same page
+		{name: "JMP indirect", program: []byte{0x6c, 0x00, 0x10}, memory: map[uint16]byte{0x1000: 0x34, 0x1001: 0x12}, wantPC: 0x1234},
+		{name: "JMP indirect page wrap", program: []byte{0x6c, 0xff, 0x10}, memory: map[uint16]byte{0x10ff: 0x34, 0x1000: 0x12, 0x1100: 0x56}, wantPC: 0x1234},
+
+		// Branches are relative to the next instruction
+		{name: "BNE forward", program: []byte{0xd0, 0x05}, wantPC: 0x0407},
+		{name: "BEQ backward", program: []byte{0xf0, 0xfc}, p: flagZero, wantP: flagZero, wantPC: 0x03fe},
+		{name: "BEQ not taken", program: []byte{0xf0, 0xfc}, wantPC: 0x0402},
+		{name: "BCS back a page", program: []byte{0xb0, 0x80}, p: flagCarry, wantP: flagCarry, wantPC: 0x0382},
+
+		// Undocumented read-modify-write instructions
+		{name: "SLO", program: []byte{0x07, 0x10}, a: 0x01, memory: map[uint16]byte{0x10: 0x81}, wantA: 0x03, wantP: flagCarry, wantMem: map[uint16]byte{0x10: 0x02}},
+		{name: "RLA", program: []byte{0x27, 0x10}, a: 0xff, p: flagCarry, memory: map[uint16]byte{0x10: 0x81}, wantA: 0x03, wantP: flagCarry, wantMem: map[uint16]byte{0x10: 0x03}},
+		{name: "SRE", program: []byte{0x47, 0x10}, a: 0xff, memory: map[uint16]byte{0x10: 0x03}, wantA: 0xfe, wantP: flagNegative | flagCarry, wantMem: map[uint16]byte{0x10: 0x01}},
+		{name: "RRA", program: []byte{0x67, 0x10}, a: 0x01, p: flagCarry, memory: map[uint16]byte{0x10: 0x02}, wantA: 0x82, wantP: flagNegative, wantMem: map[uint16]byte{0x10: 0x81}},
+		{name: "DCP", program: []byte{0xc7, 0x10}, a: 0x0f, memory: map[uint16]byte{0x10: 0x10}, wantA: 0x0f, wantP: flagZero | flagCarry, wantMem: map[uint16]byte{0x10: 0x0f}},
+		{name: "ISC", program: []byte{0xe7, 0x10}, a: 0x20, p: flagCarry, memory: map[uint16]byte{0x10: 0x0f}, wantA: 0x10, wantP: flagCarry, wantMem: map[uint16]byte{0x10: 0x10}},
+		{name: "DCP zero page wrap", program: []byte{0xd7, 0xff}, a: 0x00, x: 0x11, memory: map[uint16]byte{0x10: 0x01}, wantA: 0x00, wantP: flagZero | flagCarry, wantMem: map[uint16]byte{0x10: 0x00, 0x110: 0x00}},
+	}
+
+	for _, c := range cases {
+		var memory [0x10000]byte
+		for address, value := range c.memory {
+			memory[address] = value
+		}
+		copy(memory[0x400:], c.program)
+		cpu := cpu6502{
+			read:  func(address uint16) byte { return memory[address] },
+			write: func(address uint16, value byte) { memory[address] = value },
+		}
+		cpu.reset()
+		cpu.pc, cpu.a, cpu.x, cpu.p = 0x400, c.a, c.x, c.p|flagUnused
+		if !cpu.step() {
+			t.Errorf("%s: locked up", c.name)
+			continue
+		}
+
+		wantPC := c.wantPC
+		if wantPC == 0 {
+			wantPC = 0x400 + uint16(len(c.program))
+		}
+		if cpu.a != c.wantA || cpu.p&nvzc != c.wantP || cpu.pc != wantPC {
+			t.Errorf("%s: got A=%02x P=%02x PC=%04x, want A=%02x P=%02x PC=%04x",
+				c.name, cpu.a, cpu.p&nvzc, cpu.pc, c.wantA, c.wantP, wantPC)
+		}
+		for address, want := range c.wantMem {
+			if memory[address] != want {
+				t.Errorf("%s: $%04x is %02x, want %02x", c.name, address, memory[address], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"os"
+)
+
+const exportMaxLength = 30 * 60 // Seconds, in case a tune never says it has ended
+
+// An effect playing into the export
+type exportVoice struct {
+	samples  []float64
+	volume   float64
+	position int
+}
+
+var (
+	exportAudioFile string // From "export-audio out.wav"
+	exporting       bool   // Effects go into the export instead of the mixer
+	exportFrames    int    // Written so far
+	exportVoices    []exportVoice
+)
+
+// Renders the intro's whole soundtrack to a 16-bit stereo WAV file without opening the audio device:
+// the drive loading the intro, the playlist played through once with the logo thuds and sync rule
+// effects a frame at a time as they happen live, then the whoosh and the fade out when quitting
+func exportAudio(path string) error {
+	exporting = true
+	musicRate = soundRate
+	if err := setupPlaylist(); err != nil {
+		return err
+	}
+	buildSoundEffects()
+	buildFloppySound()
+	if err := setupSync(); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	out := bufio.NewWriter(file)
+	// The sizes are filled in once the length is known
+	if _, err := out.Write(wavHeader(2, 0)); err != nil {
+		return err
+	}
+	frame := soundRate / FPS
+
+	// The insert disk screen and the decrunch
+	playFloppySound()
+	for exportFrames < int(floppyLength*soundRate) {
+		if err := exportBlock(out, frame); err != nil {
+			return err
+		}
+	}
+
+	// The logo drops in as the music starts, the size of a font generated logo isn't known without a renderer
+	playTune(0)
+	config, err := png.DecodeConfig(bytes.NewReader(intuitiontextlogoPng))
+	if err != nil {
+		return err
+	}
+	imageWidth, imageHeight = int32(config.Width), int32(config.Height)
+	logoHomeY = float64(windowHeight-imageHeight) / 7
+	logoEnter()
+
+	for exportFrames < exportMaxLength*soundRate {
+		musicMutex.Lock()
+		ended := musicPlayer.ended()
+		musicMutex.Unlock()
+		if ended && playlistPos == len(playlist)-1 {
+			break
+		}
+		if err := exportBlock(out, frame); err != nil {
+			return err
+		}
+		updatePlaylist()
+		updateAnalyser()
+		updateSync()
+		updateBouncingLogoPosition()
+	}
+
+	// The same fade as introQuit, then the whoosh rings out
+	playSound("whoosh", 1)
+	for i := 0; i <= 255; i++ {
+		setMusicVolume(float64(255-i) / 255)
+		if err := exportBlock(out, soundRate*(400/FPS)/1000); err != nil {
+			return err
+		}
+	}
+	for len(exportVoices) > 0 {
+		if err := exportBlock(out, frame); err != nil {
+			return err
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(wavHeader(2, exportFrames*4), 0); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, %.1f seconds\n", path, float64(exportFrames)/soundRate)
+	return file.Close()
+}
+
+// Mixes the next frames of music and effects and writes them out
+func exportBlock(out io.Writer, frames int) error {
+	block := make([][2]float64, frames)
+	musicMutex.Lock()
+	mixMusic(block)
+	musicMutex.Unlock()
+
+	// Mono effects go to both sides, as the mixer plays them
+	playing := exportVoices[:0]
+	for _, voice := range exportVoices {
+		for i := range block {
+			if voice.position >= len(voice.samples) {
+				break
+			}
+			value := voice.samples[voice.position] * voice.volume * 32767
+			block[i][0] += value
+			block[i][1] += value
+			voice.position++
+		}
+		if voice.position < len(voice.samples) {
+			playing = append(playing, voice)
+		}
+	}
+	exportVoices = playing
+
+	data := make([]byte, frames*4)
+	for i, frame := range block {
+		binary.LittleEndian.PutUint16(data[i*4:], uint16(clampSample(frame[0])))
+		binary.LittleEndian.PutUint16(data[i*4+2:], uint16(clampSample(frame[1])))
+	}
+	// The sync rules that follow the level hear the export
+	analyseStream(data)
+	exportFrames += frames
+	_, err := out.Write(data)
+	return err
+}
+
+// Starts an effect at the current point in the export, taking over the oldest when every channel is busy
+func exportSound(name string, volume float64) {
+	samples := soundSamples[name]
+	if samples == nil {
+		return
+	}
+	if len(exportVoices) >= soundChannels {
+		exportVoices = exportVoices[1:]
+	}
+	exportVoices = append(exportVoices, exportVoice{samples: samples, volume: math.Max(0, math.Min(volume, 1))})
+}
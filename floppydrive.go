@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	floppyIdleTime    = 2.0   // Seconds of clicking at the insert disk screen before the disk goes in
+	floppySpinUp      = 0.5   // Seconds for the motor to come up to speed
+	floppyRevolution  = 0.2   // 300 rpm, a track is read in one turn
+	floppyStepTime    = 0.003 // Between head steps when seeking
+	floppySettle      = 0.015 // After the last step before reading
+	floppyTrackBytes  = 11 * 512
+	floppyCylinders   = 80
+	floppySpinDown    = 0.6
+	floppyRecalibrate = 40 // Steps out to find track 0, from wherever the head was left
+)
+
+// One side of a track being read, in seconds from the start of the drive sound
+type trackRead struct {
+	start, end  float64
+	track, side int
+}
+
+var (
+	trackReads    []trackRead
+	floppyLength  float64 // Seconds of the whole drive sound
+	floppyStarted time.Time
+)
+
+// Plans the reads for the intro's data, the pictures and every tune in the playlist,
+// then synthesises the drive sound to match them
+func buildFloppySound() {
+	size := len(intuitiontextlogoPng) + len(fontPng)
+	for _, entry := range playlist {
+		size += entry.size
+	}
+	soundSamples["floppy"] = buildTrackloader(size)
+}
+
+// Reads track after track from the boot block on, both sides of a cylinder before stepping to the next
+func buildTrackloader(size int) []float64 {
+	sides := 1 + (size+floppyTrackBytes-1)/floppyTrackBytes
+	// A full disk is the most it will load
+	sides = int(math.Min(float64(sides), floppyCylinders*2))
+
+	t := floppyIdleTime + floppySpinUp + floppyRecalibrate*floppyStepTime + floppySettle
+	trackReads = nil
+	for n := 0; n < sides; n++ {
+		track, side := n/2, n%2
+		if side == 0 && track > 0 {
+			t += floppyStepTime + floppySettle
+		}
+		trackReads = append(trackReads, trackRead{t, t + floppyRevolution, track, side})
+		t += floppyRevolution
+	}
+	motorOff := t
+	floppyLength = motorOff + floppySpinDown
+
+	samples := make([]float64, int(floppyLength*soundRate))
+
+	// The click of death, the drive checking for a disk every second or so
+	for _, at := range []float64{0.4, 1.4} {
+		floppyClick(samples, at, 0.7)
+		floppyClick(samples, at+0.02, 0.6)
+	}
+	floppyHum(samples, floppyIdleTime, motorOff)
+
+	// Grinding back to track 0, then a step for every cylinder
+	for i := 0; i < floppyRecalibrate; i++ {
+		floppyClick(samples, floppyIdleTime+floppySpinUp+float64(i)*floppyStepTime, 0.35)
+	}
+	for _, read := range trackReads {
+		if read.side == 0 && read.track > 0 {
+			floppyClick(samples, read.start-floppySettle-floppyStepTime, 0.6)
+		}
+	}
+	return samples
+}
+
+// A head step: a sharp tick, the ring of the mechanism and a low knock
+func floppyClick(samples []float64, at, volume float64) {
+	start := int(at * soundRate)
+	for i := 0; i < soundRate*3/100 && start+i < len(samples); i++ {
+		t := float64(i) / soundRate
+		tick := (rand.Float64()*2 - 1) * math.Exp(-t/0.0015)
+		ring := math.Sin(2*math.Pi*1800*t) * math.Exp(-t/0.005)
+		knock := math.Sin(2*math.Pi*140*t) * math.Exp(-t/0.012)
+		samples[start+i] += volume * (0.5*tick + 0.3*ring + 0.4*knock)
+	}
+}
+
+// The motor whine wobbling at the disk's rotation, rising as it spins up and falling as it stops
+func floppyHum(samples []float64, on, off float64) {
+	var phase, rumble, turn, noise float64
+	for i := int(on * soundRate); i < len(samples); i++ {
+		t := float64(i) / soundRate
+		speed := math.Min((t-on)/floppySpinUp, 1)
+		if t > off {
+			speed = math.Max(0, 1-(t-off)/floppySpinDown)
+		}
+		if speed <= 0 {
+			continue
+		}
+		phase += 2 * math.Pi * 320 * speed / soundRate
+		rumble += 2 * math.Pi * 100 * speed / soundRate
+		turn += 2 * math.Pi * 5 * speed / soundRate
+		noise += 0.05 * (rand.Float64()*2 - 1 - noise)
+		wobble := 0.8 + 0.2*math.Sin(turn)
+		samples[i] += speed * wobble * (0.05*math.Sin(phase) + 0.07*math.Sin(rumble) + 0.3*noise)
+	}
+}
+
+// Starts the drive sound, the loading display times itself from here
+func playFloppySound() {
+	floppyStarted = time.Now()
+	playSound("floppy", 1)
+}
+
+// The read under way at the current point in the drive sound, false before the first one
+func currentTrackRead() (trackRead, bool) {
+	elapsed := time.Since(floppyStarted).Seconds()
+	var current trackRead
+	found := false
+	for _, read := range trackReads {
+		if read.start > elapsed {
+			break
+		}
+		current, found = read, true
+	}
+	return current, found
+}
+
+func drawLoadingTrack() {
+	read, ok := currentTrackRead()
+	if !ok {
+		return
+	}
+	text := fmt.Sprintf("LOADING TRACK %02d SIDE %d", read.track, read.side)
+	size := float32(windowHeight) / 30
+	width := float32(len(text)) * size
+	x, y := (float32(windowWidth)-width)/2, (float32(windowHeight)-size)/2
+	black := sdl.Color{R: 0, G: 0, B: 0, A: 255}
+	batchRect(x-size/2, y-size/2, width+size, size*2, black, black)
+	drawText(text, x, y, size)
+}
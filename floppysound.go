@@ -1,4881 +0,0 @@
-package main
-
-var floppySound = []byte{
-	0xff, 0xfb, 0x20, 0xc4, 0x00, 0x00, 0x05, 0xc0, 0x27, 0x1e, 0x14, 0x91,
-	0x00, 0x00, 0xe2, 0x98, 0xa7, 0xd7, 0x18, 0x50, 0x00, 0x04, 0xc9, 0xf5,
-	0x41, 0x40, 0xa0, 0x91, 0x02, 0x04, 0x68, 0xd1, 0xa3, 0x46, 0x8d, 0x1a,
-	0x36, 0xc4, 0x02, 0x00, 0x80, 0x20, 0x08, 0x03, 0xe0, 0xf8, 0x3e, 0x0f,
-	0x83, 0x80, 0x80, 0x62, 0x50, 0x1f, 0x07, 0xc1, 0xf0, 0x7d, 0x7f, 0xff,
-	0xf0, 0x70, 0x10, 0xff, 0xff, 0x28, 0x18, 0xaf, 0x3c, 0xf6, 0x40, 0x01,
-	0x2b, 0xc4, 0x3b, 0x80, 0x6a, 0xe7, 0x6e, 0xf9, 0x6e, 0xbf, 0x5c, 0x8e,
-	0xcf, 0x14, 0x39, 0xd0, 0xe7, 0xd9, 0x08, 0x01, 0x81, 0xff, 0xad, 0x00,
-	0x00, 0x4a, 0xa2, 0x2a, 0x3d, 0x60, 0x45, 0x40, 0xfb, 0xd7, 0xb6, 0xd2,
-	0xd9, 0xd5, 0xc8, 0x4f, 0xf2, 0x7c, 0x81, 0xf0, 0xf9, 0xca, 0x26, 0xff,
-	0xff, 0xff, 0xf0, 0xc2, 0xca, 0xd0, 0x0e, 0xc0, 0x18, 0x41, 0xff, 0xfb,
-	0x22, 0xc4, 0x03, 0x00, 0x06, 0xa4, 0x71, 0x52, 0x18, 0x91, 0x80, 0x00,
-	0xdf, 0x0d, 0x29, 0x1f, 0x98, 0x30, 0x00, 0x43, 0xeb, 0x09, 0x45, 0x3f,
-	0xd2, 0xeb, 0xc3, 0xf8, 0x14, 0xcc, 0xa1, 0x06, 0x6a, 0x15, 0x11, 0x0d,
-	0x49, 0xd5, 0x14, 0xa3, 0x83, 0x91, 0x31, 0x46, 0x24, 0x65, 0x12, 0x08,
-	0xb6, 0xd7, 0xe2, 0xbb, 0x5e, 0xa1, 0x21, 0xb1, 0x40, 0xbb, 0x5a, 0x87,
-	0xef, 0xea, 0x4b, 0xed, 0xef, 0xf5, 0x65, 0x80, 0x54, 0x29, 0xb0, 0x0e,
-	0x84, 0x44, 0x63, 0xd0, 0x6a, 0x89, 0xa1, 0xd8, 0xb5, 0x53, 0xa2, 0x71,
-	0xf1, 0xe5, 0x8e, 0x5c, 0xa9, 0x01, 0x40, 0xcf, 0x28, 0x99, 0x1b, 0xe6,
-	0xc2, 0x99, 0x48, 0xb6, 0x3c, 0xa9, 0xa4, 0xaa, 0xa1, 0xa5, 0x81, 0xa0,
-	0xd5, 0xbd, 0x14, 0x39, 0xa0, 0xb3, 0xee, 0x9d, 0xbb, 0x4a, 0x62, 0x9d,
-	0xdf, 0x23, 0x10, 0x02, 0x50, 0x09, 0xa0, 0x20, 0x11, 0xff, 0xfb, 0x22,
-	0xc4, 0x03, 0x80, 0x07, 0x0c, 0x2f, 0x3d, 0x2c, 0x30, 0xc4, 0xc0, 0xd3,
-	0x09, 0xe6, 0xd5, 0x86, 0x18, 0x38, 0x23, 0xbc, 0x8e, 0x3a, 0xad, 0x7d,
-	0x8c, 0x83, 0x91, 0x26, 0x1e, 0x0f, 0x87, 0x7b, 0x68, 0x1a, 0x16, 0x08,
-	0x89, 0xa8, 0xa6, 0x70, 0xd0, 0x18, 0x26, 0x16, 0x0e, 0x0b, 0x99, 0xb8,
-	0xf0, 0x26, 0x15, 0x31, 0x12, 0xb4, 0xe7, 0xf2, 0x32, 0xaa, 0x16, 0x73,
-	0x05, 0xca, 0x36, 0xdb, 0x5e, 0x66, 0xbd, 0x00, 0x20, 0x04, 0x86, 0x03,
-	0xb1, 0x19, 0x04, 0x78, 0x23, 0x8f, 0xa4, 0xa2, 0xb6, 0x10, 0xa1, 0x2b,
-	0x2a, 0x7d, 0x2e, 0x3e, 0x40, 0x1a, 0x97, 0x50, 0x21, 0xae, 0x9c, 0xbd,
-	0x6b, 0xc7, 0xbc, 0xfd, 0x94, 0x22, 0x02, 0x91, 0x3a, 0x4a, 0x36, 0x4b,
-	0x5b, 0x74, 0xb4, 0x3e, 0x29, 0xa2, 0xd2, 0x96, 0x7f, 0xce, 0xd1, 0xf7,
-	0xaa, 0x01, 0x8a, 0x95, 0x40, 0x83, 0xc8, 0x83, 0xff, 0xfb, 0x20, 0xc4,
-	0x03, 0x80, 0x06, 0x58, 0x5f, 0x41, 0x84, 0x8c, 0x4e, 0x60, 0xe3, 0x0c,
-	0xa6, 0x55, 0x83, 0x08, 0xb8, 0x60, 0x88, 0x26, 0x32, 0xb0, 0xe7, 0x14,
-	0x8e, 0x22, 0x44, 0x9a, 0x84, 0x9c, 0xe3, 0xdb, 0xb4, 0x84, 0x92, 0xf4,
-	0x90, 0xed, 0x4c, 0xfd, 0xf7, 0xce, 0xa3, 0x97, 0x73, 0xe0, 0xe1, 0xba,
-	0x17, 0xbc, 0x34, 0x4b, 0x43, 0xf8, 0x95, 0xda, 0xbe, 0x77, 0x47, 0xd3,
-	0xb0, 0x84, 0x01, 0x8e, 0x89, 0x43, 0x9a, 0x13, 0xa3, 0x59, 0xfd, 0x00,
-	0x05, 0x0b, 0x20, 0x28, 0xa0, 0xb4, 0x8d, 0x86, 0x12, 0x78, 0x8d, 0xd9,
-	0x78, 0x87, 0xb3, 0x82, 0xf5, 0xad, 0xbc, 0x6b, 0x91, 0xa3, 0xce, 0xa5,
-	0x1d, 0xec, 0x5a, 0x0f, 0xfa, 0xd2, 0xd4, 0x01, 0x65, 0x15, 0x8b, 0x95,
-	0x14, 0xd4, 0x48, 0xb3, 0xaa, 0x25, 0xb9, 0xb5, 0x5a, 0xba, 0x22, 0x96,
-	0x00, 0x09, 0x18, 0x0f, 0x90, 0x4e, 0xff, 0xfb, 0x22, 0xc4, 0x04, 0x00,
-	0x07, 0x0c, 0x63, 0x35, 0x27, 0x98, 0x67, 0x00, 0xde, 0x08, 0xe7, 0x30,
-	0x90, 0x8e, 0x08, 0x25, 0x4e, 0xd3, 0x8e, 0xeb, 0xe7, 0xf9, 0x20, 0x01,
-	0x24, 0xc8, 0x49, 0x32, 0x45, 0x0f, 0x23, 0x7b, 0x8c, 0x4d, 0x92, 0xb9,
-	0x6c, 0x8e, 0xbf, 0xbd, 0xfe, 0x95, 0x25, 0x0a, 0x5c, 0x9a, 0xc6, 0x36,
-	0x87, 0x24, 0xdc, 0x54, 0x99, 0x17, 0x1b, 0xfb, 0xdf, 0xd5, 0xbe, 0x4b,
-	0x45, 0xe4, 0x7d, 0xe1, 0x24, 0x9c, 0x64, 0x09, 0x29, 0xb0, 0x1b, 0x06,
-	0x4b, 0x44, 0x10, 0x6c, 0xe0, 0x2a, 0x4a, 0xf6, 0x45, 0x6b, 0x5a, 0xda,
-	0x75, 0x44, 0xf2, 0x0f, 0x1b, 0x72, 0x0a, 0xd7, 0x40, 0x62, 0x49, 0x64,
-	0x09, 0x02, 0x4f, 0x02, 0xe2, 0xe5, 0xae, 0x95, 0x15, 0x34, 0xb5, 0x2d,
-	0xc9, 0x09, 0x33, 0x6a, 0xdd, 0xb7, 0xdb, 0x78, 0xb2, 0x26, 0x97, 0x51,
-	0xdb, 0x65, 0x92, 0x7f, 0xb2, 0xff, 0xfb, 0x22, 0xc4, 0x03, 0x00, 0x06,
-	0xa0, 0x3b, 0x51, 0x86, 0x24, 0x68, 0xf0, 0xd5, 0x08, 0x26, 0x16, 0x9e,
-	0x30, 0x00, 0x01, 0x50, 0xb6, 0x15, 0x0e, 0x03, 0x7e, 0x5e, 0x23, 0x8c,
-	0x52, 0xb0, 0x09, 0x22, 0xa4, 0x30, 0x46, 0x89, 0x5b, 0x72, 0x6d, 0x2a,
-	0x43, 0x1c, 0x63, 0x8b, 0x41, 0x85, 0xb9, 0xc0, 0x20, 0xb3, 0x02, 0xe2,
-	0x19, 0x95, 0x30, 0xdf, 0x90, 0xe2, 0xc3, 0x72, 0x4e, 0xd6, 0x9b, 0x36,
-	0x6b, 0x5f, 0x02, 0x80, 0x02, 0x71, 0x00, 0x56, 0x1d, 0x09, 0xa7, 0xec,
-	0xc8, 0x98, 0x96, 0x95, 0x9a, 0x2d, 0x55, 0xef, 0xe1, 0xc5, 0x06, 0x02,
-	0xcf, 0x1c, 0x82, 0x6e, 0x14, 0x98, 0x5b, 0xda, 0x5c, 0x26, 0xec, 0x48,
-	0x70, 0xa2, 0x46, 0x09, 0xec, 0x04, 0xae, 0x82, 0x0b, 0xd0, 0xe2, 0x8f,
-	0x60, 0xa2, 0x7a, 0xba, 0xb1, 0x4a, 0xd5, 0x1f, 0x72, 0x63, 0x41, 0x95,
-	0xfe, 0x2d, 0xeb, 0x7e, 0xff, 0xfb, 0x20, 0xc4, 0x04, 0x80, 0x07, 0x31,
-	0x2f, 0x42, 0x18, 0xb6, 0x80, 0x00, 0xd7, 0x90, 0x6a, 0x03, 0x8c, 0x30,
-	0x00, 0xe2, 0x59, 0x7a, 0x4d, 0xa6, 0x61, 0x6e, 0xb3, 0x46, 0x33, 0x56,
-	0xaf, 0x74, 0xcc, 0xc7, 0x3f, 0xdb, 0xc2, 0xc0, 0x93, 0x73, 0x22, 0x53,
-	0xff, 0xd6, 0x79, 0x3a, 0xcc, 0xff, 0xaf, 0xf7, 0x64, 0x26, 0x8e, 0xdf,
-	0xff, 0xfa, 0x90, 0xa0, 0x48, 0x1a, 0x19, 0x9b, 0xff, 0xff, 0xff, 0x2e,
-	0x1e, 0x73, 0x82, 0xca, 0x4b, 0xb9, 0x37, 0xce, 0x62, 0x0f, 0x4e, 0xdf,
-	0xfe, 0x9e, 0x77, 0x71, 0x6e, 0x73, 0x3e, 0xe2, 0x3c, 0xdf, 0x50, 0x65,
-	0x81, 0x80, 0x21, 0x85, 0xad, 0x40, 0x80, 0x02, 0x94, 0x3d, 0x54, 0x19,
-	0xa2, 0x6c, 0x32, 0x70, 0xb2, 0xc3, 0x84, 0x1a, 0xb4, 0x12, 0xad, 0x0d,
-	0xec, 0x6c, 0xf3, 0x43, 0x16, 0x51, 0xb9, 0x6a, 0x07, 0x6c, 0xd5, 0x0c,
-	0x4c, 0x08, 0xff, 0xfb, 0x22, 0xc4, 0x03, 0x00, 0x05, 0xf8, 0x71, 0x4d,
-	0x04, 0x98, 0x63, 0x00, 0xbe, 0x05, 0xad, 0xf4, 0x74, 0x98, 0x16, 0x0a,
-	0x95, 0x08, 0x26, 0x42, 0xcd, 0x01, 0x05, 0x08, 0x3a, 0x16, 0x1b, 0x2a,
-	0xcc, 0x09, 0xb6, 0x3b, 0x4a, 0xaa, 0x97, 0x91, 0xdf, 0x93, 0x4f, 0x9a,
-	0xc6, 0x3a, 0x26, 0x89, 0x2c, 0x2e, 0x8b, 0xc3, 0xb5, 0x79, 0xe3, 0xd2,
-	0xbf, 0xb7, 0xff, 0x25, 0xb9, 0xeb, 0xf6, 0xdb, 0xdb, 0x23, 0x8d, 0xa0,
-	0x04, 0x27, 0x30, 0x40, 0x8d, 0x31, 0x09, 0x33, 0x0c, 0x20, 0x81, 0x33,
-	0x48, 0x9e, 0x33, 0x11, 0x93, 0x65, 0xa1, 0x21, 0xa2, 0xe6, 0x1c, 0x21,
-	0x43, 0xc6, 0x25, 0x38, 0xc4, 0xa8, 0x5c, 0xfa, 0x31, 0xad, 0x95, 0x5c,
-	0x57, 0x6f, 0xd3, 0xfa, 0xaa, 0xb0, 0x50, 0x2c, 0x79, 0x0d, 0x21, 0x88,
-	0x2b, 0xa9, 0x16, 0x18, 0x92, 0x29, 0xfa, 0x35, 0xfc, 0xea, 0x7a, 0x3a,
-	0x1d, 0xff, 0xfb, 0x20, 0xc4, 0x0a, 0x00, 0x06, 0x2c, 0x6b, 0x48, 0x04,
-	0x98, 0x60, 0xc0, 0xb6, 0x85, 0xec, 0xb0, 0xc3, 0x24, 0xde, 0x7e, 0x54,
-	0x80, 0xac, 0x5c, 0x25, 0x48, 0x62, 0xea, 0xcf, 0x28, 0x90, 0x3a, 0x14,
-	0x32, 0x3e, 0x06, 0x2e, 0x2a, 0x39, 0xa8, 0xf5, 0xea, 0x6b, 0x29, 0x0a,
-	0xcb, 0xda, 0x39, 0x32, 0x4d, 0x24, 0xba, 0x4b, 0xb4, 0x10, 0x6c, 0x49,
-	0x68, 0x52, 0x49, 0xa1, 0xae, 0x12, 0x93, 0x48, 0xe1, 0x6c, 0x03, 0xf0,
-	0x33, 0x1a, 0x5b, 0x40, 0xa1, 0x33, 0x62, 0x57, 0x4a, 0xc9, 0x24, 0x1a,
-	0x12, 0xae, 0x44, 0x19, 0xa0, 0xce, 0x8e, 0xda, 0xbf, 0xfe, 0x8b, 0xfd,
-	0xab, 0x37, 0x5a, 0x86, 0x88, 0x86, 0x56, 0xdd, 0x40, 0x00, 0x20, 0x90,
-	0x19, 0x00, 0xab, 0x60, 0x73, 0xf3, 0x08, 0x55, 0x1e, 0x9a, 0x48, 0xef,
-	0x49, 0x7e, 0xa0, 0xb1, 0x8c, 0x96, 0x80, 0xa3, 0x7b, 0xa2, 0x2f, 0xff,
-	0xfb, 0x22, 0xc4, 0x11, 0x00, 0x05, 0xf8, 0x7d, 0x5d, 0xe3, 0x04, 0x72,
-	0xa0, 0xbd, 0x86, 0x69, 0xf0, 0xc3, 0x0c, 0x30, 0x74, 0x4e, 0x77, 0x00,
-	0x27, 0x20, 0xa1, 0xd8, 0x13, 0x07, 0x1c, 0x2b, 0x66, 0x4d, 0xc7, 0x3a,
-	0xb1, 0xb4, 0xe2, 0xae, 0x0a, 0x83, 0x93, 0x74, 0x80, 0xeb, 0x0b, 0x29,
-	0x2a, 0x24, 0xb6, 0x05, 0x4d, 0x36, 0x6a, 0xa1, 0x28, 0xa8, 0x27, 0x28,
-	0x7d, 0x91, 0x34, 0x24, 0x3c, 0x40, 0x59, 0xf3, 0xb9, 0x27, 0x27, 0xaf,
-	0xf2, 0x2f, 0x25, 0xff, 0xcf, 0x37, 0x0a, 0x1b, 0xf4, 0x55, 0x19, 0xda,
-	0xe3, 0x04, 0x65, 0x1d, 0x43, 0xc6, 0x40, 0x56, 0x16, 0x50, 0xfd, 0xf7,
-	0x4e, 0xd5, 0x60, 0xfe, 0x77, 0x4b, 0x0f, 0x7e, 0xfb, 0x91, 0xc4, 0xa5,
-	0xf9, 0xac, 0xa3, 0x22, 0x40, 0x35, 0xa3, 0x8b, 0x10, 0x34, 0xd1, 0x80,
-	0x8e, 0xb6, 0xfb, 0x73, 0x7e, 0xee, 0x8e, 0xcd, 0x4b, 0x4d, 0xff, 0xfb,
-	0x22, 0xc4, 0x18, 0x00, 0x05, 0xf4, 0x71, 0x43, 0x07, 0xa4, 0x61, 0x80,
-	0xbb, 0x05, 0xeb, 0xf0, 0xc3, 0x04, 0xe6, 0xb7, 0x5d, 0xee, 0x8f, 0x9a,
-	0xc8, 0x0c, 0xc4, 0x51, 0x34, 0xec, 0x50, 0x32, 0x26, 0x64, 0x42, 0x52,
-	0x50, 0x82, 0x27, 0x89, 0x41, 0x14, 0xa1, 0x06, 0x75, 0xcb, 0x85, 0x96,
-	0x50, 0x3b, 0x3a, 0xb5, 0x82, 0xae, 0x3b, 0x77, 0xfb, 0x76, 0x24, 0xb1,
-	0x04, 0x85, 0x3f, 0xff, 0xb5, 0x0a, 0x1e, 0xd8, 0xe7, 0x8c, 0xea, 0x0c,
-	0x8c, 0x40, 0xb0, 0x9a, 0xa8, 0xa4, 0x7e, 0x8c, 0x7c, 0x8f, 0x75, 0xa2,
-	0x51, 0x10, 0x55, 0x1a, 0x2e, 0x91, 0x61, 0x73, 0x2e, 0x40, 0x79, 0xa0,
-	0x30, 0x19, 0xdc, 0x58, 0x48, 0xe6, 0x05, 0xe5, 0x64, 0xfd, 0x4e, 0xa8,
-	0x5e, 0xce, 0xce, 0x9d, 0x28, 0x09, 0xc9, 0x6c, 0x70, 0x88, 0x68, 0x1b,
-	0x18, 0x30, 0x51, 0x13, 0xc0, 0x43, 0xd1, 0x46, 0x55, 0xff, 0xfb, 0x20,
-	0xc4, 0x1f, 0x80, 0x45, 0xe0, 0x29, 0x47, 0x66, 0x08, 0xc6, 0x20, 0xb0,
-	0x86, 0xe8, 0x6c, 0x93, 0x00, 0x7c, 0x24, 0x5d, 0x1e, 0xc7, 0x6d, 0x76,
-	0x29, 0x22, 0xee, 0x18, 0xc2, 0x6d, 0xcb, 0x12, 0xae, 0x79, 0x25, 0x51,
-	0x1f, 0x75, 0x4e, 0xc8, 0xa9, 0x1e, 0xef, 0xee, 0xd1, 0xf5, 0x55, 0x05,
-	0x26, 0xe3, 0x88, 0x01, 0x14, 0x01, 0x0c, 0x58, 0xfa, 0xe3, 0x15, 0xf0,
-	0x44, 0xf2, 0x38, 0x1d, 0x0a, 0x31, 0x69, 0xa3, 0x41, 0x48, 0xd9, 0x0e,
-	0x07, 0x16, 0x2b, 0x2e, 0xf0, 0x9e, 0x5e, 0x78, 0x46, 0xe6, 0x28, 0x18,
-	0x1e, 0x38, 0x2d, 0x7f, 0xaa, 0xaa, 0x21, 0x2a, 0x0f, 0xf2, 0x3d, 0xcf,
-	0xd6, 0xef, 0x77, 0xdb, 0x5b, 0x28, 0x6c, 0x00, 0x4c, 0x0e, 0x4c, 0xd6,
-	0x8a, 0x9e, 0xf2, 0x40, 0xaf, 0x55, 0xe4, 0x6f, 0x54, 0x7a, 0x0a, 0xc0,
-	0x82, 0x71, 0x08, 0x76, 0xec, 0x6e, 0x47, 0xff, 0xfb, 0x22, 0xc4, 0x28,
-	0x00, 0x06, 0x20, 0x2b, 0x3d, 0x86, 0x19, 0x24, 0x80, 0xc4, 0x8a, 0x6c,
-	0x34, 0xc4, 0x8c, 0x6e, 0x4b, 0x8b, 0xa8, 0x23, 0x80, 0xad, 0xb2, 0xd1,
-	0xa2, 0x92, 0x0e, 0xff, 0xa3, 0xdf, 0xec, 0x74, 0x51, 0xb5, 0x2a, 0x2a,
-	0x68, 0xc7, 0x04, 0x28, 0x83, 0xc5, 0x01, 0x04, 0xd3, 0x48, 0x0e, 0xd9,
-	0x3a, 0x43, 0x53, 0xb9, 0x36, 0xa1, 0x8c, 0xe6, 0x47, 0x8a, 0x24, 0xf1,
-	0x54, 0x89, 0x9c, 0x45, 0x44, 0x5a, 0x34, 0xee, 0x96, 0x8f, 0xb4, 0x63,
-	0x29, 0x4b, 0x53, 0x55, 0x4b, 0xff, 0x77, 0x2d, 0xf6, 0x2c, 0x17, 0x0d,
-	0xca, 0x0f, 0x35, 0x4a, 0x9b, 0xc2, 0xf0, 0x79, 0x17, 0x45, 0x89, 0xb5,
-	0x65, 0x41, 0x35, 0x17, 0x04, 0x4e, 0xba, 0xac, 0xd1, 0x8f, 0xeb, 0x4f,
-	0x0c, 0xd1, 0x9e, 0xdc, 0x28, 0x95, 0x96, 0x1c, 0x39, 0xe6, 0x45, 0xf1,
-	0x65, 0x64, 0x52, 0xca, 0xae, 0xe9, 0xff, 0xfb, 0x20, 0xc4, 0x2d, 0x80,
-	0x05, 0xd8, 0x3b, 0x35, 0x07, 0xa4, 0xc0, 0x00, 0xbc, 0x0d, 0x66, 0x40,
-	0xc3, 0x0c, 0xf0, 0xb7, 0xec, 0xba, 0x2a, 0x95, 0x82, 0x28, 0x3a, 0x00,
-	0xa0, 0xb8, 0x89, 0x86, 0x4b, 0xd9, 0x95, 0xfc, 0x16, 0x1b, 0xbd, 0x8b,
-	0x1e, 0x16, 0x84, 0x40, 0xc9, 0x59, 0xd3, 0x82, 0xed, 0x08, 0x99, 0xa4,
-	0x98, 0x91, 0xe5, 0x0d, 0x10, 0x00, 0x5c, 0xb7, 0xf6, 0x34, 0x5c, 0x9d,
-	0x7b, 0xfa, 0x75, 0x6e, 0xf5, 0x56, 0xed, 0x92, 0xdb, 0x65, 0xb6, 0x56,
-	0x9a, 0xad, 0xd8, 0xc4, 0x60, 0x30, 0x00, 0x07, 0xea, 0x15, 0x33, 0xe3,
-	0x4e, 0x78, 0x92, 0xc2, 0x7b, 0x32, 0x7b, 0x1d, 0x99, 0xe2, 0x72, 0x88,
-	0x58, 0x6b, 0x20, 0x28, 0xbd, 0x99, 0x2c, 0x0e, 0xaf, 0x01, 0x4b, 0x6c,
-	0x79, 0xa8, 0x36, 0x29, 0x0a, 0xfb, 0x49, 0x34, 0x08, 0x18, 0x47, 0x32,
-	0x25, 0x58, 0xd4, 0x3a, 0xff, 0xfb, 0x22, 0xc4, 0x35, 0x00, 0x05, 0xe4,
-	0x2b, 0x37, 0x14, 0xf1, 0x80, 0x01, 0x66, 0x96, 0x6b, 0xf7, 0x1e, 0x90,
-	0x02, 0xd2, 0xd9, 0x3d, 0x9d, 0x39, 0x64, 0x11, 0xaf, 0x0f, 0xe6, 0xfa,
-	0xdc, 0x99, 0x86, 0xe7, 0x34, 0x13, 0x9f, 0x9a, 0x78, 0x39, 0x28, 0x0e,
-	0x1c, 0xf5, 0xd1, 0x83, 0xd9, 0xff, 0xfe, 0x52, 0x96, 0x5b, 0x2d, 0xb2,
-	0xf1, 0x54, 0x01, 0xa7, 0x14, 0x86, 0x6b, 0xc6, 0xcd, 0x30, 0x66, 0x53,
-	0x57, 0x40, 0xc4, 0x06, 0x11, 0x17, 0x66, 0x41, 0x24, 0x12, 0x30, 0x33,
-	0xa9, 0xbe, 0x85, 0xa5, 0x52, 0xc8, 0x04, 0x87, 0xb2, 0x4a, 0x6a, 0x95,
-	0xcb, 0x4c, 0x4f, 0x69, 0x7a, 0x6c, 0xaf, 0x7d, 0x10, 0x00, 0x91, 0x29,
-	0x00, 0x1c, 0x34, 0x14, 0xb0, 0xb2, 0x09, 0x5a, 0x70, 0xae, 0x4e, 0xa1,
-	0xee, 0x7f, 0x4f, 0x73, 0x7a, 0xe1, 0x94, 0xf7, 0x73, 0xeb, 0x0f, 0x85,
-	0xaa, 0xd9, 0x56, 0xff, 0xfb, 0x22, 0xc4, 0x27, 0x80, 0x05, 0xc0, 0x3d,
-	0x71, 0x9c, 0x61, 0x80, 0x30, 0xc0, 0x8d, 0xa9, 0xe0, 0x93, 0x0c, 0x68,
-	0x17, 0x0e, 0x90, 0x18, 0xe7, 0xd4, 0x5c, 0x3f, 0xb4, 0xdb, 0x22, 0x0f,
-	0x57, 0xd3, 0xc6, 0x55, 0x82, 0xca, 0x8c, 0x17, 0x74, 0x13, 0xac, 0xbb,
-	0x64, 0x3a, 0xff, 0xbc, 0x74, 0xd8, 0xf4, 0xef, 0x22, 0xc9, 0xfd, 0x07,
-	0x0b, 0x5c, 0x44, 0x72, 0xd3, 0xde, 0x9c, 0x34, 0x44, 0x7b, 0xf6, 0x40,
-	0x81, 0x02, 0x10, 0x00, 0x00, 0x7b, 0x8b, 0xe8, 0x0d, 0x77, 0xc0, 0xc0,
-	0xbf, 0x10, 0x00, 0x7c, 0x08, 0xef, 0xc0, 0xb8, 0xfe, 0x87, 0xe6, 0x1e,
-	0x3f, 0xe3, 0xff, 0x8f, 0xff, 0xff, 0x11, 0x29, 0x61, 0x92, 0x80, 0x61,
-	0x10, 0x61, 0x17, 0x0a, 0x9f, 0x33, 0xba, 0x59, 0xe5, 0x66, 0xdc, 0x52,
-	0x0b, 0xd9, 0x7d, 0x49, 0xa0, 0x56, 0x11, 0xc6, 0x9f, 0x54, 0x99, 0xb1,
-	0x48, 0x2a, 0xff, 0xfb, 0x20, 0xc4, 0x2f, 0x00, 0xc7, 0xdc, 0x77, 0x56,
-	0x00, 0xa4, 0xc0, 0x48, 0xbc, 0x8d, 0xec, 0x10, 0x63, 0x0c, 0x38, 0x0e,
-	0x41, 0x41, 0x54, 0x19, 0xb7, 0x2b, 0x8d, 0x11, 0x24, 0x2a, 0xef, 0x91,
-	0xbe, 0xb3, 0xae, 0x59, 0x35, 0x32, 0x64, 0x43, 0x21, 0xb9, 0x80, 0xb1,
-	0x28, 0xca, 0xc2, 0xb1, 0x10, 0x68, 0xd8, 0x56, 0xb9, 0x01, 0xc7, 0x96,
-	0x08, 0x7d, 0xa6, 0x8c, 0xa3, 0xb6, 0x8a, 0x4b, 0x08, 0x5c, 0x88, 0x6a,
-	0xf2, 0x48, 0x0e, 0x82, 0x4f, 0x51, 0x50, 0x74, 0x83, 0x78, 0xcf, 0x36,
-	0xde, 0xbf, 0xa2, 0xd2, 0x45, 0x83, 0x35, 0x44, 0x32, 0x02, 0x00, 0x04,
-	0xc7, 0xdb, 0x0a, 0x8d, 0x09, 0xcb, 0x00, 0xf0, 0x42, 0x12, 0xb2, 0x07,
-	0xda, 0x93, 0x2e, 0x98, 0x98, 0xc4, 0x9d, 0x47, 0x7c, 0x8c, 0x8e, 0xc5,
-	0x6c, 0xac, 0xf9, 0x09, 0xaa, 0x7f, 0x3e, 0x9e, 0xd4, 0x49, 0xe0, 0x17,
-	0xff, 0xfb, 0x22, 0xc4, 0x2e, 0x80, 0x06, 0x10, 0x33, 0x5f, 0xc5, 0xa4,
-	0xc0, 0x80, 0xc4, 0x0f, 0xab, 0xf8, 0x93, 0x0c, 0xec, 0x5d, 0x24, 0x88,
-	0x7e, 0x95, 0x48, 0x76, 0x68, 0x65, 0x65, 0x3e, 0xbf, 0x00, 0x84, 0x0c,
-	0x30, 0x0b, 0x03, 0x2c, 0x28, 0xa2, 0x04, 0x41, 0x02, 0xc6, 0xd9, 0x19,
-	0x45, 0x53, 0x3a, 0x4d, 0xc1, 0x74, 0x3c, 0x24, 0x65, 0xe3, 0x51, 0x51,
-	0x84, 0x9d, 0x7c, 0xb0, 0x11, 0xef, 0xc6, 0x6d, 0xce, 0xd7, 0xd0, 0xd3,
-	0x46, 0x4d, 0x75, 0x96, 0x36, 0xa6, 0x40, 0xa1, 0x38, 0x2e, 0x48, 0x44,
-	0xa9, 0x70, 0xf9, 0xd1, 0x92, 0x97, 0x6c, 0x0c, 0x84, 0x9f, 0xd1, 0x46,
-	0x97, 0x14, 0x07, 0x38, 0x54, 0xe9, 0x67, 0x95, 0x2a, 0xf4, 0x40, 0xaf,
-	0x1a, 0xc4, 0x37, 0x77, 0xed, 0x72, 0x16, 0xca, 0xf5, 0x5c, 0x56, 0xd5,
-	0x2a, 0x06, 0x38, 0x92, 0x60, 0x20, 0x8d, 0x02, 0x40, 0xb0, 0x8c, 0xff,
-	0xfb, 0x22, 0xc4, 0x34, 0x80, 0x05, 0xcc, 0x2d, 0x61, 0xc6, 0x24, 0xc0,
-	0x20, 0xbf, 0x06, 0x2c, 0xb0, 0x93, 0x09, 0x8e, 0x58, 0x29, 0x30, 0x78,
-	0x0a, 0x20, 0x2a, 0x56, 0x5b, 0xfd, 0x44, 0x92, 0x34, 0xa0, 0xc8, 0xb4,
-	0x1e, 0x22, 0x05, 0x17, 0x3d, 0x41, 0x51, 0xc2, 0xb2, 0xc9, 0x18, 0x87,
-	0x7f, 0x46, 0xaf, 0xe3, 0x07, 0x16, 0xa6, 0xc9, 0x0e, 0xdd, 0x20, 0xb7,
-	0x32, 0x2c, 0x00, 0x29, 0x70, 0xd0, 0x0e, 0x80, 0x54, 0x21, 0x89, 0xa1,
-	0x26, 0x05, 0x1f, 0x2a, 0x76, 0x55, 0xaa, 0x8d, 0x73, 0xbd, 0x2d, 0x95,
-	0x04, 0x94, 0x14, 0x24, 0x78, 0x83, 0x9c, 0xa9, 0x7a, 0x86, 0x3a, 0x8c,
-	0x49, 0x1f, 0x54, 0x8a, 0x6d, 0xdf, 0xbb, 0xaf, 0xe5, 0x27, 0x6a, 0x9f,
-	0xff, 0xed, 0xb2, 0x46, 0xdb, 0x09, 0x80, 0x91, 0x51, 0x15, 0x8a, 0x90,
-	0x54, 0xe8, 0x85, 0xb1, 0x5a, 0x34, 0x9a, 0xec, 0x37, 0x43, 0xff, 0xfb,
-	0x20, 0xc4, 0x3c, 0x00, 0x06, 0x0c, 0x2d, 0x4b, 0x84, 0xa4, 0xc0, 0x00,
-	0xbf, 0x88, 0x29, 0x30, 0x93, 0x0c, 0xa0, 0x14, 0x0b, 0xbc, 0x83, 0x17,
-	0x1c, 0x13, 0x5d, 0x4d, 0x34, 0xd7, 0xd9, 0x63, 0xfc, 0x82, 0x4a, 0x25,
-	0xc8, 0xff, 0xa3, 0xfd, 0x93, 0x6a, 0x57, 0x5b, 0x2c, 0x8d, 0xcd, 0x30,
-	0x05, 0x19, 0x28, 0x38, 0x2c, 0x47, 0x23, 0x71, 0xd6, 0x70, 0x1d, 0x84,
-	0x48, 0x50, 0x92, 0x5a, 0x6a, 0xc5, 0x4e, 0x81, 0xd8, 0x63, 0x43, 0xf5,
-	0xa0, 0x48, 0x88, 0xb2, 0x11, 0xfd, 0x2a, 0xb5, 0x61, 0x80, 0x05, 0x81,
-	0xe4, 0xd5, 0x15, 0xb2, 0x95, 0x4d, 0xa9, 0x56, 0x01, 0x40, 0x99, 0x90,
-	0x7e, 0x24, 0x08, 0x48, 0x10, 0x18, 0x90, 0xab, 0xb2, 0x02, 0x49, 0x9d,
-	0x55, 0x67, 0xc2, 0x93, 0x40, 0xc8, 0x9d, 0x21, 0x91, 0x50, 0xca, 0x75,
-	0x38, 0x90, 0x70, 0x45, 0x0e, 0x84, 0x87, 0x88, 0xff, 0xfb, 0x22, 0xc4,
-	0x42, 0x00, 0x05, 0xc0, 0x2b, 0x6b, 0xa7, 0xa4, 0x63, 0x30, 0xac, 0x84,
-	0xab, 0xf0, 0x97, 0x98, 0x4e, 0xf4, 0xf7, 0xa7, 0x57, 0xff, 0xb4, 0x3c,
-	0x00, 0x81, 0x71, 0x2a, 0xe5, 0x54, 0x6c, 0x28, 0xb6, 0x04, 0x23, 0xc9,
-	0x9e, 0x52, 0x75, 0x08, 0x25, 0x28, 0x1c, 0xbc, 0xba, 0x54, 0x6b, 0xc1,
-	0x74, 0xfb, 0x44, 0xa4, 0x30, 0x16, 0x26, 0x18, 0x63, 0x54, 0x23, 0xb8,
-	0xef, 0xb0, 0x6a, 0x50, 0x6f, 0xeb, 0xff, 0xfe, 0x6d, 0xea, 0x66, 0x77,
-	0x40, 0x05, 0x4c, 0x23, 0x8d, 0x51, 0x16, 0x0c, 0x28, 0x84, 0x4a, 0xe4,
-	0x24, 0x88, 0xd1, 0x33, 0xd2, 0x30, 0x6f, 0x26, 0x7d, 0x5a, 0xac, 0x3b,
-	0x03, 0x9a, 0x06, 0xb5, 0xa0, 0xab, 0xc4, 0x35, 0x4e, 0x85, 0x46, 0xd0,
-	0x40, 0x7d, 0xde, 0x87, 0xb5, 0x7f, 0xff, 0xce, 0xc0, 0xfa, 0xcd, 0xda,
-	0x15, 0xd9, 0x95, 0x51, 0xa7, 0x55, 0x80, 0xff, 0xfb, 0x20, 0xc4, 0x4c,
-	0x00, 0x05, 0xf8, 0x33, 0x4b, 0x84, 0xb0, 0xc0, 0x00, 0xba, 0x8a, 0x27,
-	0x94, 0xc3, 0x0c, 0x78, 0x40, 0x24, 0xc0, 0x34, 0x89, 0x3e, 0x40, 0x08,
-	0x93, 0xe9, 0xa9, 0x1f, 0xb3, 0xa3, 0x31, 0xc2, 0x02, 0x86, 0xda, 0xc1,
-	0x9a, 0x0b, 0x03, 0xa2, 0xcb, 0x28, 0x54, 0x70, 0x2c, 0xb1, 0x7f, 0xa3,
-	0xff, 0xff, 0xf2, 0x55, 0x3b, 0x02, 0x21, 0x20, 0x9c, 0x58, 0xc0, 0x2c,
-	0xcd, 0xcc, 0x3c, 0xaa, 0x05, 0x22, 0x38, 0x7a, 0x8e, 0x7b, 0x65, 0xe2,
-	0x65, 0xe7, 0x27, 0x31, 0xba, 0xee, 0x4d, 0xa1, 0x58, 0x5f, 0x2d, 0x6e,
-	0xed, 0xd4, 0x6c, 0x13, 0x8a, 0x0c, 0x4b, 0x79, 0xdb, 0x90, 0xf6, 0x35,
-	0x97, 0xdb, 0xff, 0xda, 0x35, 0x6e, 0x00, 0x88, 0x44, 0xb1, 0x30, 0x3a,
-	0x04, 0x0b, 0x90, 0xb2, 0x00, 0xe4, 0x32, 0x18, 0x9f, 0xdd, 0x64, 0x56,
-	0x9d, 0x98, 0x95, 0x0e, 0x14, 0xff, 0xfb, 0x22, 0xc4, 0x53, 0x00, 0x46,
-	0x08, 0x47, 0x3f, 0x27, 0xa4, 0x61, 0x40, 0xb0, 0x85, 0xe9, 0xfc, 0x61,
-	0x85, 0xc4, 0x4b, 0xe6, 0x90, 0xb7, 0xcd, 0x11, 0x10, 0x92, 0x55, 0xf1,
-	0x09, 0x62, 0x58, 0xed, 0x09, 0xa3, 0x63, 0x9a, 0xf2, 0x97, 0xbb, 0x85,
-	0xd5, 0x58, 0x2d, 0x8d, 0x96, 0x42, 0xa3, 0xd7, 0x47, 0x20, 0x2c, 0x2b,
-	0x12, 0x09, 0x98, 0x88, 0x50, 0x9a, 0x76, 0xa5, 0x5c, 0xeb, 0x86, 0xc8,
-	0xde, 0xad, 0x96, 0x4c, 0xe4, 0x54, 0xb8, 0x25, 0x99, 0xec, 0x32, 0x14,
-	0xa0, 0x96, 0xe2, 0x2e, 0xd8, 0xf8, 0xca, 0xd1, 0xc6, 0x71, 0xfe, 0xa7,
-	0xa8, 0x26, 0x02, 0xda, 0x90, 0x6c, 0x32, 0x4c, 0xc8, 0x05, 0x5c, 0x4d,
-	0xe0, 0x99, 0xc4, 0x8d, 0x5a, 0xfd, 0x2c, 0xb6, 0x71, 0x44, 0x99, 0x81,
-	0x82, 0x50, 0x0b, 0x89, 0xc3, 0x7d, 0xdd, 0x8c, 0x31, 0x55, 0xd6, 0x85,
-	0xcc, 0x0b, 0x44, 0xcf, 0xff, 0xfb, 0x22, 0xc4, 0x5b, 0x80, 0x46, 0x18,
-	0x73, 0x3a, 0xa4, 0x98, 0x69, 0x40, 0xba, 0x0e, 0xa7, 0xd4, 0x93, 0x0c,
-	0x78, 0xef, 0xb1, 0xb8, 0xaf, 0xb1, 0xee, 0x60, 0x00, 0x00, 0x2a, 0x3b,
-	0x35, 0x89, 0x7d, 0x00, 0xf8, 0x55, 0x9e, 0x9d, 0xe1, 0x82, 0x3a, 0x8d,
-	0x82, 0x96, 0x4e, 0xc5, 0xd2, 0x52, 0xf6, 0x7b, 0x24, 0xc2, 0x6f, 0xba,
-	0x7e, 0x50, 0xb4, 0xf8, 0x88, 0x62, 0xca, 0x39, 0x7d, 0x1f, 0x73, 0x53,
-	0x7d, 0x30, 0x53, 0xd7, 0x76, 0x81, 0xac, 0x0f, 0x09, 0x83, 0x89, 0x1f,
-	0x3e, 0x31, 0x07, 0x49, 0x43, 0xeb, 0x1e, 0xab, 0xde, 0x8c, 0xf6, 0xb8,
-	0xdf, 0x5e, 0xe5, 0xd4, 0x4c, 0x8b, 0xab, 0x98, 0x68, 0x7f, 0xed, 0x4b,
-	0xda, 0x70, 0x08, 0xe0, 0x26, 0x00, 0xa4, 0xf7, 0xb7, 0xf9, 0xee, 0x89,
-	0xd6, 0x52, 0x1f, 0x68, 0xb1, 0x79, 0xf8, 0xa4, 0xf4, 0x8b, 0x60, 0xa0,
-	0x29, 0x08, 0x24, 0xff, 0xfb, 0x20, 0xc4, 0x62, 0x81, 0xc5, 0xe4, 0x71,
-	0x42, 0x06, 0x18, 0x6b, 0x00, 0xb7, 0x8d, 0xa7, 0xd4, 0x90, 0x8a, 0x50,
-	0x2b, 0x57, 0x03, 0x76, 0x71, 0x7b, 0x0a, 0x74, 0x2e, 0xe8, 0xe7, 0x92,
-	0x0d, 0x1e, 0x01, 0x30, 0x71, 0xe5, 0x80, 0xc2, 0xc3, 0x57, 0x19, 0xdd,
-	0x95, 0x53, 0xd5, 0x7b, 0x92, 0xc6, 0x7e, 0x78, 0xce, 0xd5, 0x8c, 0x96,
-	0xa1, 0x3c, 0x2a, 0x47, 0x13, 0x32, 0xf1, 0xc3, 0xc2, 0x85, 0x81, 0x84,
-	0x1d, 0x47, 0x90, 0x05, 0x4d, 0x92, 0x2d, 0x66, 0xc1, 0x31, 0xe5, 0x01,
-	0xd0, 0x2a, 0xe7, 0xde, 0x4d, 0x3b, 0x0b, 0x36, 0x3c, 0x32, 0xfd, 0x54,
-	0xcd, 0xba, 0x07, 0x7a, 0x6d, 0x4f, 0xe2, 0x1a, 0x29, 0xb0, 0x9c, 0x20,
-	0xa2, 0xb1, 0x00, 0xb8, 0x70, 0x30, 0xb9, 0xe7, 0x92, 0x9a, 0xb2, 0x40,
-	0xc0, 0xda, 0x3c, 0x19, 0xab, 0x0b, 0x7b, 0x86, 0x60, 0xa1, 0x92, 0x88,
-	0x44, 0xff, 0xfb, 0x22, 0xc4, 0x6a, 0x81, 0xc5, 0xd0, 0x71, 0x3e, 0xa6,
-	0x18, 0x67, 0x80, 0xb1, 0x8d, 0xa7, 0x01, 0x06, 0x0c, 0x78, 0xa9, 0x71,
-	0x74, 0x9f, 0xcc, 0x8d, 0x1e, 0x6c, 0xd7, 0xb9, 0xe8, 0x63, 0x94, 0xcb,
-	0x95, 0x7d, 0x64, 0xff, 0xfc, 0xd5, 0x50, 0xb3, 0x54, 0x4b, 0x00, 0x88,
-	0x3f, 0x3c, 0x61, 0x01, 0x14, 0x08, 0xa0, 0x50, 0xb6, 0x0d, 0x90, 0x38,
-	0x86, 0xbc, 0x35, 0x16, 0x51, 0x84, 0x56, 0x91, 0xf7, 0x75, 0x93, 0x5d,
-	0xf2, 0xee, 0x49, 0x38, 0x3c, 0xd4, 0x50, 0x2c, 0x2a, 0xc4, 0x8f, 0x59,
-	0x24, 0x5e, 0x40, 0xab, 0xc6, 0x81, 0xdf, 0x67, 0xfb, 0x86, 0x58, 0x2b,
-	0x0d, 0xc2, 0xa2, 0x20, 0x28, 0x95, 0x87, 0x8d, 0xec, 0x84, 0x8e, 0x18,
-	0x8b, 0x6a, 0x8f, 0x57, 0x26, 0x65, 0x4b, 0x41, 0xbd, 0xfa, 0x3b, 0x9c,
-	0x44, 0x83, 0xcd, 0x69, 0xe7, 0xd2, 0xcd, 0xa3, 0x6d, 0xb2, 0x77, 0xa7,
-	0xff, 0xfb, 0x20, 0xc4, 0x74, 0x00, 0x05, 0xe4, 0x3d, 0x32, 0x07, 0xb0,
-	0xc0, 0xc0, 0xb5, 0x85, 0x26, 0xe0, 0xf3, 0x18, 0x40, 0xff, 0xfe, 0x86,
-	0x24, 0x75, 0x50, 0x58, 0xb1, 0x96, 0x82, 0x10, 0xc6, 0x48, 0xa2, 0x28,
-	0x8b, 0x13, 0x0f, 0x65, 0xde, 0x87, 0xf1, 0x90, 0x00, 0x05, 0xc7, 0x10,
-	0x58, 0x06, 0x11, 0x5a, 0x1a, 0x09, 0x14, 0x41, 0x14, 0xae, 0xf7, 0xe4,
-	0x1c, 0x7a, 0x49, 0x89, 0x88, 0x45, 0xe8, 0x6c, 0xe7, 0x4c, 0xcf, 0xdf,
-	0x76, 0xa7, 0x1c, 0x28, 0x43, 0x0a, 0xa3, 0x41, 0x1c, 0x8a, 0xe7, 0x54,
-	0x75, 0xa3, 0x3e, 0xbf, 0x77, 0xee, 0x42, 0x2e, 0x20, 0x8b, 0x40, 0x44,
-	0x82, 0x40, 0x1d, 0xd8, 0xa0, 0xaf, 0x9b, 0x1a, 0xc0, 0x60, 0x8c, 0xf3,
-	0x4e, 0x24, 0x3a, 0x4e, 0x48, 0x8d, 0x9d, 0xb1, 0x5e, 0x10, 0x68, 0x7b,
-	0xb1, 0x92, 0xa6, 0x57, 0xef, 0x37, 0x11, 0xb8, 0x54, 0x83, 0xff, 0xfb,
-	0x22, 0xc4, 0x7c, 0x00, 0x06, 0x14, 0x2f, 0x3b, 0x84, 0x98, 0x4c, 0x00,
-	0xd9, 0x0a, 0xa7, 0xe4, 0xc2, 0x98, 0xc0, 0x47, 0xa1, 0x94, 0x8b, 0x33,
-	0x88, 0x47, 0xb0, 0x5e, 0xc8, 0x17, 0x7f, 0x88, 0xbf, 0x47, 0x24, 0x19,
-	0x44, 0x18, 0x00, 0x41, 0x5a, 0x01, 0xc8, 0x76, 0xbe, 0x80, 0x22, 0xd1,
-	0xf2, 0x4b, 0x22, 0x27, 0x30, 0xd0, 0x8d, 0x61, 0x88, 0xd7, 0x79, 0x39,
-	0xc3, 0xbf, 0x5a, 0x83, 0xa2, 0x12, 0x60, 0x73, 0x15, 0x03, 0x86, 0xe5,
-	0x51, 0x03, 0x32, 0x3e, 0xa4, 0x1c, 0x37, 0xad, 0xcd, 0x9b, 0x15, 0xfb,
-	0xcb, 0x65, 0xed, 0xaf, 0x0f, 0x99, 0x75, 0x5c, 0x95, 0x6a, 0x5d, 0x2a,
-	0x81, 0xea, 0x2a, 0x4e, 0x54, 0xe9, 0x54, 0x40, 0xc3, 0xd1, 0x85, 0xa8,
-	0xed, 0x88, 0x49, 0x41, 0x41, 0x28, 0x24, 0x0c, 0x8d, 0x06, 0xc3, 0x01,
-	0xd6, 0x0a, 0x8a, 0x93, 0x11, 0xaa, 0x80, 0xf2, 0x88, 0xff, 0xfb, 0x22,
-	0xc4, 0x7f, 0x80, 0x07, 0x10, 0xb3, 0x43, 0x86, 0x0c, 0x4c, 0xc0, 0xc4,
-	0x8d, 0xe8, 0x60, 0x93, 0x0c, 0x78, 0x1d, 0x30, 0x87, 0x33, 0xa5, 0xba,
-	0x35, 0xab, 0xf9, 0xb6, 0x63, 0xd3, 0xed, 0xdc, 0x40, 0x34, 0x84, 0x69,
-	0x00, 0x81, 0x43, 0xf4, 0x1c, 0x4d, 0x49, 0xe9, 0xa2, 0x22, 0x80, 0x65,
-	0x93, 0x81, 0xb0, 0x37, 0x74, 0xfe, 0x49, 0x0f, 0x85, 0x09, 0xa5, 0x0c,
-	0xfa, 0xd2, 0x7a, 0x1b, 0x53, 0x0c, 0x64, 0x72, 0x91, 0x85, 0x16, 0x04,
-	0xc7, 0xd5, 0xa1, 0xc1, 0x0d, 0xfb, 0xde, 0xfb, 0x22, 0xb6, 0x65, 0x0f,
-	0xbf, 0xd4, 0x70, 0xe5, 0x49, 0x51, 0x34, 0xdb, 0x44, 0x09, 0x41, 0x00,
-	0xa8, 0x3a, 0x2a, 0x71, 0x40, 0xc1, 0x91, 0xf3, 0xa3, 0xc8, 0x85, 0x12,
-	0x23, 0x83, 0x0d, 0x3c, 0xda, 0x06, 0xe9, 0x4c, 0xee, 0x63, 0x1b, 0xe9,
-	0x55, 0x70, 0x89, 0x41, 0x2c, 0xc2, 0xcc, 0x2a, 0xff, 0xfb, 0x20, 0xc4,
-	0x81, 0x80, 0x06, 0xdc, 0x73, 0x41, 0x64, 0x98, 0x6a, 0xc0, 0xdc, 0x87,
-	0x28, 0x30, 0xc4, 0x98, 0x98, 0x0b, 0x45, 0x95, 0xcf, 0x2a, 0xd5, 0xb7,
-	0x5f, 0xf4, 0xfa, 0x21, 0xd3, 0x5b, 0x1e, 0xb0, 0xac, 0x8a, 0xaa, 0xa6,
-	0x8d, 0xc6, 0xd9, 0x40, 0x4c, 0x7e, 0x1c, 0xc4, 0xe9, 0xb8, 0xcb, 0x17,
-	0xa3, 0xf8, 0xd5, 0x1a, 0x62, 0xd7, 0x13, 0x3c, 0xe3, 0x74, 0x48, 0x8b,
-	0xd8, 0xd0, 0x18, 0x35, 0x0e, 0xbd, 0x49, 0x11, 0x22, 0xc2, 0x45, 0x4e,
-	0xb1, 0x32, 0xad, 0xef, 0xfa, 0x06, 0x1b, 0x17, 0xa1, 0x4d, 0xfb, 0xff,
-	0x25, 0x10, 0x98, 0x5b, 0x20, 0x29, 0x4c, 0x02, 0xf1, 0x69, 0x89, 0x81,
-	0x5c, 0x9a, 0x42, 0x5e, 0x48, 0x15, 0x72, 0x96, 0xd3, 0x58, 0xa2, 0x8a,
-	0x1e, 0x28, 0x46, 0xa2, 0xc5, 0x1c, 0xa1, 0x64, 0x1e, 0x34, 0x69, 0xe8,
-	0xa4, 0x82, 0x89, 0x44, 0x6c, 0x5d, 0xff, 0xfb, 0x22, 0xc4, 0x81, 0x00,
-	0x46, 0xb8, 0x25, 0x4b, 0x87, 0xa4, 0xc3, 0x20, 0xe1, 0x0d, 0x68, 0x2c,
-	0xc3, 0x0c, 0xb0, 0x6c, 0x8e, 0x5b, 0x47, 0xbe, 0x97, 0x77, 0x57, 0x92,
-	0x1d, 0xd0, 0x4a, 0xa8, 0x00, 0x00, 0xf4, 0xa7, 0x01, 0x12, 0x09, 0x40,
-	0xb1, 0x87, 0x85, 0x31, 0x64, 0x1d, 0x02, 0xd9, 0xe2, 0x8e, 0x2b, 0x6b,
-	0x92, 0x63, 0x30, 0xe0, 0x48, 0x79, 0x94, 0x9f, 0x9c, 0x52, 0x02, 0x43,
-	0x41, 0xd5, 0x88, 0xaf, 0x49, 0xce, 0xc7, 0x0a, 0x4f, 0xbd, 0x83, 0x28,
-	0x51, 0x8f, 0x8a, 0xec, 0xf5, 0x2a, 0x60, 0x76, 0x86, 0x33, 0x83, 0x0a,
-	0x30, 0x0d, 0x09, 0x40, 0x10, 0x9a, 0xf1, 0xa1, 0xd8, 0x58, 0x18, 0x5a,
-	0x08, 0x3a, 0x3b, 0x34, 0x2d, 0x67, 0x9c, 0x87, 0xe6, 0xee, 0x21, 0x08,
-	0x39, 0x12, 0xb2, 0x6f, 0xc2, 0x70, 0x42, 0xc0, 0xfb, 0x34, 0x21, 0xad,
-	0x52, 0x75, 0x0b, 0x62, 0xf7, 0xff, 0xfb, 0x20, 0xc4, 0x81, 0x00, 0x06,
-	0x9c, 0x51, 0x47, 0x84, 0x84, 0x72, 0x40, 0xd8, 0x06, 0xed, 0x3c, 0xf4,
-	0x8c, 0xe6, 0x08, 0x36, 0xfe, 0xaf, 0xde, 0x90, 0xa6, 0x0b, 0x23, 0x38,
-	0xdb, 0x60, 0x98, 0x28, 0x2b, 0x32, 0x4a, 0x0c, 0xa1, 0x40, 0x91, 0xd0,
-	0xfb, 0x99, 0x60, 0xc7, 0x5a, 0xac, 0x8a, 0x9b, 0x82, 0xb6, 0x86, 0x84,
-	0x6c, 0x38, 0x97, 0x0e, 0xad, 0x05, 0xe8, 0x72, 0x8b, 0xcf, 0x37, 0xd5,
-	0x74, 0x68, 0x5f, 0xf3, 0x95, 0xbf, 0x5b, 0x36, 0xb1, 0xc6, 0xe3, 0x68,
-	0x01, 0x44, 0x01, 0xb2, 0x35, 0x45, 0x6e, 0x5d, 0x61, 0x3b, 0x4b, 0x11,
-	0x26, 0xc0, 0xe9, 0x10, 0x2c, 0x1f, 0x68, 0x1e, 0x8a, 0x52, 0x16, 0xc5,
-	0xe9, 0x40, 0xd3, 0xee, 0x14, 0x34, 0x23, 0x7d, 0x09, 0xe8, 0xfa, 0xa4,
-	0x7e, 0x95, 0x74, 0xbf, 0x84, 0xa0, 0x03, 0x0c, 0x02, 0x80, 0x25, 0x48,
-	0x4e, 0x89, 0x40, 0xff, 0xfb, 0x22, 0xc4, 0x82, 0x00, 0x06, 0x7c, 0x37,
-	0x45, 0x86, 0x24, 0x46, 0xc0, 0xcd, 0x07, 0x67, 0xe0, 0xf3, 0x18, 0x00,
-	0x01, 0x76, 0xa0, 0x11, 0xc8, 0xa7, 0x9c, 0xbc, 0xb4, 0x50, 0x07, 0x42,
-	0x0d, 0x15, 0xac, 0xed, 0xe1, 0xd4, 0x1a, 0x5a, 0x81, 0xa2, 0xb2, 0x50,
-	0xef, 0x2b, 0x4f, 0x57, 0xff, 0xa3, 0xfa, 0x9e, 0x2d, 0xd4, 0x5c, 0x24,
-	0x4c, 0x50, 0x80, 0x3e, 0xd2, 0x44, 0x2c, 0x0f, 0x86, 0x58, 0xf3, 0x03,
-	0x1f, 0x29, 0x18, 0x3d, 0x24, 0x74, 0xd7, 0xa6, 0x5b, 0xec, 0x28, 0x6c,
-	0xb2, 0xd2, 0x98, 0x54, 0xf0, 0x94, 0x42, 0x57, 0xf8, 0x20, 0x8a, 0xd9,
-	0x77, 0xac, 0x4c, 0xa4, 0x7b, 0x7f, 0xb5, 0x62, 0x31, 0x20, 0x00, 0x80,
-	0x60, 0x2e, 0x03, 0x8a, 0x0a, 0x61, 0x87, 0x04, 0x81, 0x1d, 0x56, 0xa2,
-	0x65, 0xc8, 0xc7, 0x49, 0x4b, 0x7b, 0x2c, 0xd6, 0xa7, 0x92, 0xc2, 0x50,
-	0x30, 0xa3, 0xff, 0xfb, 0x22, 0xc4, 0x85, 0x03, 0xc6, 0x7c, 0x6b, 0x42,
-	0x06, 0x18, 0x6c, 0xc0, 0xb6, 0x0a, 0xe8, 0x80, 0x93, 0x0d, 0xd0, 0x47,
-	0x18, 0x25, 0x3a, 0xe1, 0x82, 0xef, 0xac, 0x85, 0x7f, 0xa6, 0xca, 0x13,
-	0xff, 0xf6, 0x31, 0xaf, 0xad, 0x75, 0x31, 0xc3, 0xd8, 0x00, 0x89, 0x27,
-	0x02, 0x34, 0x68, 0x01, 0x20, 0xb2, 0x6b, 0x1d, 0x06, 0x81, 0x96, 0x49,
-	0x1d, 0x34, 0xc3, 0x87, 0x82, 0x40, 0x1a, 0xce, 0xbc, 0x2e, 0x3d, 0x40,
-	0x20, 0x12, 0x5c, 0x23, 0x70, 0x50, 0x77, 0x42, 0x6d, 0xbd, 0x4c, 0xf4,
-	0x7f, 0xfa, 0xdc, 0x23, 0x08, 0x48, 0x98, 0x0e, 0x45, 0x66, 0x88, 0x12,
-	0x90, 0x50, 0x80, 0x4b, 0x81, 0x46, 0xb1, 0x12, 0xfd, 0xa9, 0x2a, 0x57,
-	0xf2, 0x72, 0x61, 0x10, 0xc1, 0x09, 0x01, 0x70, 0x81, 0x90, 0xe0, 0x6e,
-	0x39, 0x4e, 0x77, 0x45, 0xea, 0xb4, 0x9a, 0x5f, 0xbc, 0xd3, 0x7f, 0x5f,
-	0xa5, 0xff, 0xfb, 0x20, 0xc4, 0x8b, 0x00, 0x05, 0xc4, 0x27, 0x71, 0xa4,
-	0xa4, 0xc4, 0xb0, 0xaf, 0x05, 0x69, 0x24, 0x64, 0x98, 0x08, 0x16, 0x69,
-	0x55, 0x61, 0x62, 0xa8, 0x7c, 0x7d, 0xc5, 0x28, 0xeb, 0x03, 0x28, 0x28,
-	0xd8, 0x34, 0xf9, 0x92, 0x28, 0x6d, 0x2e, 0x8e, 0x62, 0x12, 0xb2, 0xc5,
-	0x62, 0x8e, 0x91, 0x2c, 0xa3, 0x4f, 0x1b, 0x26, 0x7a, 0x8b, 0xeb, 0xb9,
-	0x57, 0x13, 0x4b, 0x08, 0x8f, 0xbb, 0xfa, 0x43, 0xbf, 0x4d, 0x2b, 0x51,
-	0xb8, 0x12, 0x40, 0x11, 0x89, 0xcd, 0x28, 0x46, 0x75, 0x08, 0x88, 0x68,
-	0x50, 0x83, 0x30, 0xb1, 0xf1, 0xf9, 0x75, 0x68, 0xb6, 0xf5, 0x4b, 0xcd,
-	0xcc, 0x06, 0xae, 0x41, 0x61, 0x64, 0x2d, 0x29, 0x5c, 0xd6, 0x8f, 0xe9,
-	0x2b, 0x69, 0x83, 0xbf, 0x77, 0xba, 0x94, 0x2a, 0x1a, 0x6e, 0x42, 0x18,
-	0x18, 0x09, 0x68, 0x31, 0x9b, 0x0a, 0x12, 0x11, 0xc5, 0xd2, 0x2c, 0xff,
-	0xfb, 0x22, 0xc4, 0x94, 0x80, 0x05, 0xec, 0x31, 0x47, 0x84, 0xa0, 0xc4,
-	0x20, 0xc4, 0x07, 0x26, 0xe0, 0x93, 0x24, 0x28, 0x1f, 0x8a, 0x68, 0x61,
-	0xaa, 0xa3, 0xc5, 0x2d, 0xd6, 0x33, 0x45, 0xf9, 0x29, 0x8d, 0xa1, 0x6e,
-	0x01, 0x21, 0x8d, 0x51, 0x51, 0x56, 0x8f, 0x61, 0xdf, 0xdd, 0xdc, 0x87,
-	0xab, 0xf8, 0xeb, 0x50, 0x85, 0xe4, 0x03, 0xda, 0xeb, 0x6b, 0x8d, 0xb8,
-	0x98, 0x00, 0x1d, 0x0c, 0x44, 0xab, 0x09, 0x51, 0xc5, 0xe8, 0x85, 0xa3,
-	0xc9, 0x9a, 0x4c, 0x9d, 0xea, 0x26, 0x3c, 0x6a, 0x2b, 0x04, 0x0c, 0xb5,
-	0xe7, 0x77, 0x25, 0x82, 0x70, 0x01, 0x05, 0x38, 0x2e, 0x0c, 0xe1, 0x5b,
-	0xd7, 0x56, 0x16, 0x47, 0x6d, 0x9e, 0x8a, 0x79, 0x30, 0x41, 0x66, 0x10,
-	0x74, 0xf2, 0xf0, 0xe9, 0x1b, 0x4f, 0x12, 0xe2, 0x6a, 0x21, 0x65, 0x13,
-	0x50, 0x59, 0x25, 0xb3, 0x02, 0xd9, 0x00, 0x83, 0x4e, 0x46, 0xff, 0xfb,
-	0x22, 0xc4, 0x9b, 0x01, 0x05, 0x88, 0x35, 0x36, 0x07, 0x98, 0xc0, 0x00,
-	0xc3, 0x07, 0x66, 0xd4, 0xf4, 0x98, 0x20, 0x23, 0x02, 0x0a, 0xc4, 0x64,
-	0x67, 0x1c, 0x75, 0xd8, 0xa8, 0xca, 0x66, 0x25, 0x86, 0x15, 0x76, 0xfe,
-	0xd7, 0xec, 0x7d, 0x4a, 0xa8, 0x19, 0xa0, 0x3e, 0x62, 0x32, 0x89, 0xcd,
-	0x6d, 0x51, 0xb8, 0x61, 0xa3, 0x5a, 0x1e, 0x8a, 0x76, 0x2f, 0x00, 0x04,
-	0x8d, 0x43, 0xa1, 0x0b, 0x44, 0x65, 0x49, 0x8b, 0x85, 0x87, 0xa8, 0x79,
-	0xcd, 0x08, 0x0b, 0x45, 0x83, 0x47, 0xc0, 0xe2, 0x35, 0x0d, 0xb4, 0xa3,
-	0x75, 0x27, 0x45, 0x1b, 0x53, 0xf4, 0x55, 0x76, 0xdb, 0x76, 0xba, 0xd9,
-	0x28, 0x41, 0x00, 0x57, 0x03, 0x02, 0x01, 0xf8, 0x2c, 0xb2, 0x49, 0xbd,
-	0x4a, 0x36, 0x30, 0x71, 0x02, 0xd0, 0xf9, 0x04, 0xd0, 0x0d, 0x07, 0x88,
-	0x20, 0x2c, 0xb2, 0x53, 0x29, 0x1c, 0x83, 0xad, 0x24, 0xff, 0xfb, 0x20,
-	0xc4, 0xa3, 0x80, 0x05, 0x68, 0x3b, 0x34, 0x0c, 0x24, 0xc0, 0x40, 0xbf,
-	0x86, 0xa8, 0xb4, 0x94, 0x98, 0x9c, 0xd2, 0x21, 0xb0, 0xf0, 0x59, 0xcc,
-	0xff, 0xd9, 0xff, 0xfd, 0xf5, 0x07, 0x2c, 0xb3, 0x57, 0x7a, 0x84, 0x00,
-	0x80, 0x15, 0x60, 0x57, 0x28, 0x12, 0x89, 0x9c, 0x58, 0x8d, 0x7b, 0xb7,
-	0x93, 0x54, 0x96, 0x57, 0x2d, 0xe6, 0xd0, 0x5b, 0x17, 0x35, 0x3d, 0x88,
-	0x96, 0xa1, 0x1b, 0x97, 0x2a, 0x1a, 0xd2, 0xce, 0xbc, 0x36, 0x2d, 0xb5,
-	0x28, 0xd6, 0xdf, 0xa5, 0x61, 0xe4, 0xca, 0x5d, 0xf1, 0xa2, 0x44, 0x0a,
-	0xc0, 0x28, 0xa3, 0x6c, 0x42, 0x26, 0xe7, 0x8a, 0x43, 0x6b, 0x75, 0x10,
-	0x77, 0x7a, 0x99, 0x98, 0xfa, 0x13, 0x3a, 0xf3, 0x08, 0x4d, 0x74, 0xb2,
-	0xce, 0xd6, 0x74, 0x23, 0xb3, 0xed, 0xd5, 0x9d, 0x72, 0x7a, 0xa2, 0x08,
-	0x11, 0x3e, 0xf7, 0x10, 0x10, 0x47, 0xe7, 0xff, 0xfb, 0x22, 0xc4, 0xac,
-	0x00, 0x06, 0x28, 0x49, 0x37, 0x27, 0xa4, 0x61, 0x80, 0xc1, 0x06, 0x68,
-	0x74, 0xc4, 0x98, 0x04, 0x6f, 0x9f, 0xee, 0x59, 0x9b, 0x61, 0x7f, 0x90,
-	0xad, 0x5b, 0x18, 0x89, 0x20, 0x31, 0x11, 0x57, 0x5b, 0x42, 0x32, 0xa1,
-	0x5c, 0x99, 0xe1, 0xa7, 0x85, 0xa1, 0x41, 0x9d, 0xe3, 0x68, 0xee, 0x62,
-	0x0d, 0xb0, 0x73, 0x17, 0xb6, 0x20, 0x61, 0x10, 0x3c, 0xa6, 0x69, 0x4a,
-	0xae, 0x6c, 0xd3, 0x54, 0x6e, 0xab, 0x2e, 0x8d, 0xa9, 0x4b, 0x15, 0xf1,
-	0x65, 0x32, 0xf5, 0xbf, 0xfd, 0xbf, 0xfa, 0x5b, 0x23, 0x61, 0x00, 0x39,
-	0x05, 0x26, 0xa7, 0x22, 0x5a, 0x82, 0x52, 0xd3, 0x33, 0xc2, 0x5a, 0xf3,
-	0xc5, 0xe5, 0xa3, 0xe1, 0x2e, 0x3f, 0x61, 0x23, 0x87, 0x09, 0xe0, 0xd3,
-	0xd0, 0xa9, 0xa3, 0x12, 0x20, 0x75, 0x39, 0x2f, 0x2e, 0x2d, 0xb7, 0x47,
-	0xb7, 0xdb, 0xad, 0xad, 0xff, 0xf9, 0xff, 0xfb, 0x20, 0xc4, 0xb2, 0x00,
-	0x05, 0xec, 0x3b, 0x30, 0xa7, 0xa4, 0x43, 0x80, 0xcb, 0x06, 0xa5, 0xc1,
-	0x86, 0x18, 0x00, 0x60, 0x9c, 0x05, 0xa2, 0x85, 0x00, 0x86, 0x19, 0x3c,
-	0x5c, 0xb0, 0x80, 0xa3, 0x45, 0x8d, 0x91, 0xc6, 0x04, 0x30, 0x0c, 0x2a,
-	0x9d, 0xb2, 0x84, 0x26, 0x62, 0x29, 0x1a, 0xfa, 0x8c, 0x70, 0x8f, 0x5d,
-	0x69, 0xd2, 0xf8, 0x5d, 0xe0, 0xa7, 0xae, 0xdd, 0xdd, 0x8e, 0x64, 0xcd,
-	0xb2, 0x3b, 0x7e, 0xfe, 0xbb, 0x8e, 0x22, 0xf5, 0x69, 0x56, 0xe3, 0x64,
-	0x7b, 0xf0, 0x80, 0x2b, 0x61, 0xb2, 0x0d, 0x0c, 0x1c, 0x28, 0x88, 0xd9,
-	0x39, 0x87, 0x38, 0x6c, 0x55, 0xca, 0x88, 0x95, 0x41, 0x67, 0xb8, 0x14,
-	0x15, 0x0e, 0xbc, 0x40, 0x17, 0x61, 0x18, 0x75, 0xe8, 0x30, 0x06, 0xd7,
-	0xb6, 0xb6, 0x1f, 0x42, 0x3c, 0x4a, 0x67, 0xfd, 0x5c, 0x45, 0xb4, 0x8d,
-	0xb8, 0x51, 0x01, 0x20, 0xff, 0xfb, 0x22, 0xc4, 0xb7, 0x00, 0x06, 0x24,
-	0x31, 0x57, 0xa6, 0x18, 0xc2, 0x30, 0xba, 0x87, 0xa7, 0xf0, 0x90, 0x8e,
-	0x04, 0x43, 0x52, 0x6b, 0xca, 0x7b, 0x91, 0x09, 0x4e, 0x03, 0x27, 0x78,
-	0x61, 0x26, 0x9c, 0x6d, 0x79, 0x3e, 0x6a, 0x70, 0x19, 0xb1, 0xb4, 0xb3,
-	0x07, 0xb2, 0x8e, 0x45, 0xa1, 0x51, 0x1c, 0xe8, 0xd4, 0x18, 0x8f, 0x2c,
-	0xb5, 0xbd, 0xc2, 0xd6, 0x4d, 0xa5, 0x2d, 0xfa, 0x3a, 0x52, 0x07, 0x5e,
-	0xcd, 0x04, 0x60, 0x17, 0x07, 0xe2, 0x01, 0x68, 0xb1, 0xc3, 0xf2, 0xd1,
-	0xdf, 0x50, 0x90, 0xd2, 0x09, 0xc3, 0x1c, 0x30, 0xc9, 0x42, 0x04, 0x42,
-	0xb1, 0x54, 0x22, 0x56, 0x94, 0xb1, 0x19, 0xe1, 0xca, 0x70, 0x71, 0x48,
-	0x6a, 0xe6, 0x5d, 0x7a, 0x46, 0xcc, 0xd5, 0x94, 0x2c, 0x66, 0x51, 0x2f,
-	0xcf, 0xbc, 0x39, 0xc5, 0x48, 0x84, 0x5a, 0xba, 0xda, 0xe4, 0x70, 0xa0,
-	0x80, 0x64, 0x23, 0xff, 0xfb, 0x22, 0xc4, 0xbe, 0x00, 0x47, 0x58, 0xbb,
-	0x32, 0x0c, 0x24, 0x41, 0xc8, 0xcb, 0x07, 0x67, 0x60, 0xc3, 0x0d, 0x18,
-	0x42, 0x2c, 0xa9, 0x38, 0x4e, 0xb5, 0x16, 0xb0, 0x71, 0x43, 0xe7, 0x71,
-	0x6e, 0x6b, 0x5d, 0xad, 0x32, 0xff, 0x37, 0x9a, 0x39, 0xb0, 0xa2, 0x50,
-	0x50, 0x50, 0x08, 0xe8, 0x19, 0x8d, 0xbb, 0x76, 0xdd, 0xdf, 0x46, 0xaf,
-	0xff, 0xd5, 0x29, 0xc6, 0xe5, 0x92, 0x7f, 0xb2, 0x81, 0x5c, 0x06, 0x05,
-	0x50, 0x8d, 0x48, 0x4a, 0x40, 0x1c, 0x96, 0x8d, 0x59, 0x16, 0x92, 0x6c,
-	0x61, 0x60, 0x20, 0x5c, 0x93, 0xcf, 0x15, 0x10, 0x56, 0x88, 0x59, 0x0f,
-	0x1f, 0x4d, 0x20, 0x06, 0xd7, 0xde, 0xdc, 0xc0, 0x59, 0xe9, 0x81, 0x5e,
-	0xfb, 0xbb, 0x3a, 0xad, 0x48, 0x34, 0x80, 0x0b, 0xb0, 0x17, 0x4b, 0x12,
-	0x7f, 0xdf, 0xd8, 0x8f, 0x28, 0xe2, 0x99, 0xca, 0x25, 0xb4, 0x99, 0x52,
-	0x57, 0xb7, 0xff, 0xfb, 0x20, 0xc4, 0xbe, 0x00, 0x06, 0x70, 0x5b, 0x67,
-	0xa6, 0x04, 0x70, 0xb0, 0xd0, 0x0d, 0xe7, 0xec, 0xc3, 0x0c, 0x78, 0xd8,
-	0x86, 0x48, 0x77, 0x88, 0xd0, 0x30, 0x45, 0x75, 0x81, 0x6b, 0xe3, 0x10,
-	0x14, 0x18, 0xba, 0x53, 0x30, 0x52, 0x7d, 0x08, 0x38, 0xd5, 0x2d, 0x26,
-	0xd3, 0xfd, 0xda, 0xe9, 0x5a, 0x9b, 0x89, 0xb0, 0x10, 0x01, 0xd1, 0x43,
-	0x70, 0xb6, 0x28, 0xc5, 0xa4, 0x71, 0x88, 0x77, 0x75, 0x19, 0xc5, 0xbb,
-	0x99, 0xfd, 0xfb, 0xb9, 0xad, 0xc8, 0x84, 0x21, 0x02, 0xd1, 0x3e, 0x78,
-	0x0c, 0x23, 0x28, 0x09, 0xb2, 0x0b, 0x9e, 0xa3, 0xd0, 0x69, 0x88, 0x23,
-	0x16, 0x8a, 0x7d, 0x36, 0x58, 0x72, 0xae, 0x36, 0x45, 0x10, 0xc1, 0xc9,
-	0x68, 0x8e, 0xfd, 0x8e, 0x7a, 0x6a, 0x92, 0xcf, 0xae, 0x3e, 0x8f, 0xbd,
-	0x62, 0x2e, 0x3a, 0xa6, 0xe8, 0xcc, 0x52, 0x12, 0x53, 0xf4, 0xf6, 0x9b,
-	0xff, 0xfb, 0x22, 0xc4, 0xc0, 0x80, 0x06, 0x58, 0x2b, 0x43, 0x84, 0xa4,
-	0xc0, 0x00, 0xc8, 0x8a, 0xe7, 0x20, 0xf3, 0x08, 0xb8, 0x7e, 0x6e, 0x04,
-	0x4b, 0xb7, 0xcf, 0x60, 0x5b, 0xe3, 0x5d, 0xd2, 0x63, 0x4b, 0x5c, 0xd9,
-	0xea, 0xa4, 0x36, 0x1c, 0x8d, 0x66, 0xb3, 0x51, 0xac, 0x00, 0x0e, 0x4e,
-	0xa8, 0xa0, 0x6a, 0x02, 0x17, 0x5f, 0x45, 0x8b, 0x2e, 0xff, 0x9e, 0x8e,
-	0xf1, 0xac, 0x40, 0xec, 0x15, 0x87, 0x68, 0x56, 0x28, 0x87, 0x9e, 0x5a,
-	0x1e, 0xc8, 0x50, 0x88, 0xee, 0x2c, 0x38, 0x51, 0xc5, 0x2a, 0x40, 0x80,
-	0x03, 0x87, 0xe1, 0x04, 0xa7, 0x23, 0x9e, 0xd4, 0x6c, 0xa7, 0x75, 0x8f,
-	0x4d, 0xff, 0xed, 0x12, 0x74, 0xea, 0x07, 0x17, 0x02, 0xf1, 0xa2, 0xcf,
-	0xfb, 0xe9, 0x32, 0x4b, 0xe3, 0xca, 0x3b, 0xd6, 0x16, 0xb5, 0xff, 0x4f,
-	0xa2, 0xf3, 0xb2, 0x64, 0x40, 0x04, 0x0f, 0x5c, 0xf4, 0x49, 0xb9, 0xff,
-	0xfb, 0x20, 0xc4, 0xc5, 0x00, 0x06, 0xe4, 0x3d, 0x3f, 0x26, 0x0d, 0x2c,
-	0x80, 0xbf, 0x09, 0x69, 0x34, 0xc0, 0x8a, 0x44, 0x0e, 0xcd, 0x82, 0xb8,
-	0x50, 0xdd, 0x88, 0x77, 0x08, 0xb4, 0xdc, 0x37, 0x07, 0x40, 0xd0, 0xec,
-	0xa5, 0x60, 0xd8, 0x20, 0x46, 0x80, 0xb0, 0x4c, 0x96, 0x38, 0x69, 0x57,
-	0x1c, 0x45, 0x19, 0x41, 0x9c, 0x72, 0x18, 0x7d, 0x89, 0x68, 0x56, 0xd9,
-	0x0d, 0x6d, 0x4d, 0x74, 0x31, 0xb8, 0xc6, 0xe1, 0xb2, 0xf1, 0xf5, 0x71,
-	0x82, 0xe9, 0xb3, 0x05, 0xe1, 0x2f, 0x71, 0x56, 0xf1, 0xf5, 0x17, 0x6a,
-	0x7b, 0x32, 0x2f, 0xa8, 0xd5, 0xfe, 0xf0, 0x42, 0xa9, 0x01, 0x09, 0xe7,
-	0xed, 0xde, 0x15, 0x31, 0x89, 0xa4, 0x49, 0x00, 0x68, 0x86, 0x6d, 0x33,
-	0x21, 0x91, 0x10, 0x92, 0x6a, 0x7f, 0x03, 0x32, 0x40, 0xd4, 0x26, 0x56,
-	0x73, 0xb9, 0x27, 0xa4, 0x8b, 0x0b, 0xc9, 0xe6, 0x06, 0xff, 0xfb, 0x22,
-	0xc4, 0xc8, 0x00, 0x06, 0x54, 0x29, 0x51, 0x86, 0x24, 0xc0, 0xb0, 0xcc,
-	0x06, 0x26, 0x56, 0xb0, 0x20, 0x00, 0x86, 0x80, 0xc0, 0xa9, 0x50, 0x10,
-	0xa8, 0x9d, 0x37, 0x81, 0x41, 0xa1, 0xfa, 0xf7, 0xa4, 0xe9, 0x62, 0xdd,
-	0x1c, 0xef, 0xc5, 0x7d, 0x75, 0x53, 0xb8, 0xe4, 0x6a, 0x55, 0xc0, 0x82,
-	0x81, 0xb6, 0x44, 0x78, 0x8c, 0x97, 0xe0, 0xa4, 0xc2, 0xb5, 0x4c, 0xa1,
-	0x49, 0xb1, 0xac, 0xc7, 0x88, 0x05, 0x41, 0xe5, 0x86, 0x56, 0x1f, 0x38,
-	0x6a, 0x05, 0x6c, 0x54, 0x95, 0xa5, 0x42, 0x61, 0x2e, 0xb6, 0x1e, 0x8a,
-	0x1b, 0x2c, 0xef, 0xf4, 0xff, 0xed, 0x41, 0x70, 0x13, 0x17, 0x01, 0x62,
-	0x40, 0xfe, 0x12, 0x00, 0x90, 0x22, 0x69, 0xcb, 0x19, 0x54, 0x46, 0x4a,
-	0x2a, 0x2d, 0x14, 0x8e, 0x48, 0xdf, 0x51, 0x93, 0x32, 0xa8, 0xdd, 0x8d,
-	0x58, 0x00, 0x28, 0xd0, 0x48, 0xe0, 0xa1, 0x45, 0xff, 0xfb, 0x22, 0xc4,
-	0xcc, 0x00, 0x0b, 0x58, 0xf7, 0x38, 0xb9, 0x84, 0x00, 0x01, 0x60, 0x19,
-	0x2f, 0x77, 0x18, 0x80, 0x02, 0x12, 0x3a, 0x9d, 0x87, 0x96, 0xd5, 0x35,
-	0x83, 0x14, 0x9c, 0x28, 0x53, 0xee, 0xd3, 0xd1, 0xd4, 0x9a, 0xdb, 0x6e,
-	0x8e, 0x34, 0xe2, 0x45, 0x00, 0xa0, 0x8c, 0x2e, 0x81, 0xe4, 0x21, 0x65,
-	0x5b, 0x95, 0x9f, 0x27, 0x25, 0x40, 0x7f, 0x6c, 0x19, 0x36, 0x16, 0xd3,
-	0x76, 0xc8, 0xd2, 0x99, 0x73, 0x3e, 0x32, 0xfd, 0x1b, 0xd8, 0x14, 0x0e,
-	0x1c, 0x72, 0xd5, 0xdb, 0xda, 0xdf, 0xf7, 0xd1, 0xf8, 0xad, 0x33, 0x6b,
-	0xed, 0xd6, 0x44, 0x9c, 0x4d, 0x03, 0x43, 0xc2, 0x31, 0x1b, 0x22, 0x54,
-	0x62, 0x53, 0x70, 0xbd, 0x01, 0x60, 0x08, 0x31, 0x84, 0x88, 0xdc, 0x48,
-	0x10, 0xe8, 0x90, 0x92, 0x85, 0x14, 0xa7, 0x91, 0x59, 0xa0, 0x6a, 0x5d,
-	0xa5, 0xc4, 0x48, 0x1a, 0xa6, 0x0f, 0xed, 0xff, 0xfb, 0x20, 0xc4, 0xa9,
-	0x80, 0x0b, 0x34, 0xb7, 0x6f, 0x7d, 0x84, 0x80, 0x08, 0xcf, 0x06, 0xad,
-	0x6c, 0xf3, 0x24, 0xe0, 0x7a, 0xfb, 0xf7, 0xcd, 0x51, 0x0d, 0x24, 0xdc,
-	0x00, 0x0a, 0x05, 0x45, 0xa8, 0x54, 0x24, 0x24, 0x13, 0x28, 0x45, 0x13,
-	0x74, 0x6a, 0xcb, 0x29, 0x2a, 0xd3, 0x95, 0x00, 0xe0, 0x28, 0xad, 0x2b,
-	0x03, 0x06, 0x52, 0x6a, 0x14, 0x62, 0x0d, 0x1e, 0x63, 0xf3, 0xab, 0x6a,
-	0x2a, 0x5d, 0x10, 0x95, 0x00, 0x15, 0x15, 0x8a, 0xe4, 0x5a, 0xd4, 0x70,
-	0xf0, 0xce, 0x84, 0x49, 0x26, 0xa2, 0x60, 0x30, 0x1f, 0x98, 0xb6, 0xf8,
-	0xaa, 0x26, 0x27, 0x50, 0x0c, 0x93, 0x18, 0x3d, 0x22, 0xdd, 0x47, 0xc6,
-	0x98, 0x8e, 0x48, 0x91, 0xe9, 0x40, 0x8a, 0xa4, 0xc3, 0x2f, 0xdb, 0xfc,
-	0xce, 0x06, 0x59, 0xab, 0x9a, 0xfa, 0x7a, 0x76, 0xfd, 0xca, 0x9e, 0xd5,
-	0x40, 0x04, 0x08, 0x16, 0x50, 0xff, 0xfb, 0x22, 0xc4, 0x99, 0x00, 0x06,
-	0x34, 0x29, 0x7d, 0x84, 0xbc, 0xc0, 0x70, 0xd5, 0x0a, 0x2b, 0x94, 0xc4,
-	0x98, 0x00, 0x18, 0x10, 0x41, 0x21, 0x40, 0x41, 0x58, 0x4d, 0xc9, 0xeb,
-	0x13, 0x74, 0x60, 0xe5, 0xd4, 0x4b, 0x13, 0x17, 0xf3, 0xa5, 0x59, 0x2a,
-	0x75, 0xdc, 0x81, 0x1e, 0x00, 0x9e, 0x4a, 0xdc, 0x8b, 0xef, 0xa8, 0xf2,
-	0xac, 0xf6, 0x7f, 0xff, 0x75, 0x12, 0xcd, 0x25, 0x91, 0xba, 0xfa, 0x20,
-	0x4a, 0x86, 0x7a, 0x6c, 0x71, 0x81, 0x38, 0xf0, 0x55, 0x43, 0x60, 0xe4,
-	0x63, 0x51, 0x66, 0x2f, 0x24, 0xe5, 0x85, 0x80, 0xf5, 0xa9, 0xa3, 0xe0,
-	0x50, 0x38, 0x26, 0xe3, 0xe3, 0xc2, 0xbd, 0x75, 0xeb, 0x42, 0xcf, 0x12,
-	0xea, 0xd5, 0xff, 0xf3, 0xba, 0xaa, 0x49, 0x52, 0x51, 0x24, 0x05, 0xb3,
-	0x82, 0x62, 0x06, 0x83, 0x22, 0x38, 0xd9, 0x0a, 0x85, 0x0a, 0xc0, 0xb1,
-	0xc9, 0x85, 0xd8, 0x54, 0xff, 0xfb, 0x20, 0xc4, 0x9c, 0x80, 0x46, 0x2c,
-	0x63, 0x7f, 0xa4, 0x88, 0x6e, 0x70, 0xc6, 0x07, 0x2f, 0x74, 0x93, 0x0c,
-	0xe6, 0x52, 0x35, 0x2b, 0x32, 0x8a, 0xe8, 0x27, 0x9d, 0x0d, 0x4e, 0xe0,
-	0xc7, 0xa0, 0xb2, 0x84, 0xd8, 0xe6, 0xf6, 0x2f, 0xba, 0x5a, 0xbf, 0xee,
-	0xbb, 0x5f, 0xd0, 0x69, 0x61, 0xa6, 0x80, 0x42, 0x0c, 0x05, 0x42, 0x27,
-	0x50, 0x89, 0x64, 0x44, 0x38, 0x73, 0xd0, 0x43, 0x4f, 0x35, 0x54, 0x71,
-	0xc7, 0x35, 0x76, 0x22, 0x1f, 0x24, 0x0a, 0xd8, 0x8b, 0x2d, 0x22, 0x02,
-	0x3d, 0x41, 0xf4, 0xa1, 0xe6, 0x3f, 0x52, 0xfd, 0x7c, 0xac, 0xf2, 0xc0,
-	0x8e, 0x37, 0xcb, 0xd5, 0xb1, 0x5f, 0x41, 0x05, 0x0c, 0x10, 0x0c, 0x89,
-	0x10, 0x88, 0x9a, 0x1a, 0x25, 0x22, 0x60, 0x3f, 0x24, 0x65, 0x3c, 0x19,
-	0x23, 0x71, 0x27, 0x38, 0x38, 0xba, 0x5c, 0x14, 0xc2, 0xac, 0xa4, 0x14,
-	0x76, 0xc6, 0xff, 0xfb, 0x22, 0xc4, 0xa1, 0x80, 0x06, 0x1c, 0x4f, 0x59,
-	0x64, 0x98, 0x67, 0x00, 0xbe, 0x05, 0x2d, 0x3c, 0xc4, 0x98, 0x4c, 0x6d,
-	0x52, 0x71, 0x54, 0x75, 0x7f, 0x7f, 0xfa, 0x05, 0x3b, 0xd0, 0xca, 0xae,
-	0xec, 0xd0, 0x88, 0x4a, 0x37, 0x02, 0x80, 0x02, 0xc1, 0xa8, 0x10, 0x81,
-	0xe8, 0x0a, 0x51, 0xc3, 0x92, 0x36, 0x12, 0x61, 0x4e, 0x48, 0x26, 0x03,
-	0x0a, 0x08, 0x4b, 0x1b, 0x59, 0xa8, 0x90, 0x7b, 0x48, 0x19, 0x2a, 0x18,
-	0xe0, 0xfa, 0x7f, 0xa8, 0xe3, 0x7f, 0xfe, 0xb3, 0x80, 0xff, 0xf4, 0xaa,
-	0x26, 0xaa, 0x84, 0x48, 0x48, 0x03, 0xba, 0x20, 0x27, 0x5b, 0xd2, 0xef,
-	0x57, 0xdd, 0xb5, 0x6a, 0x0b, 0x1b, 0xfa, 0xd9, 0xd9, 0x33, 0xf9, 0x32,
-	0x20, 0xb3, 0xa9, 0x98, 0xd3, 0xd3, 0xff, 0x4e, 0xb7, 0xdf, 0xd9, 0x18,
-	0x20, 0x80, 0x84, 0x64, 0x3b, 0x16, 0xfd, 0x0a, 0xac, 0x8c, 0x84, 0x5d,
-	0x6b, 0xff, 0xfb, 0x22, 0xc4, 0xa8, 0x00, 0x05, 0xcc, 0x5d, 0x55, 0x23,
-	0x18, 0x67, 0x00, 0xbf, 0x86, 0xad, 0xf0, 0xc3, 0x09, 0x1e, 0xd7, 0xa8,
-	0x25, 0x86, 0xed, 0xda, 0xeb, 0xaa, 0x69, 0x90, 0xc8, 0x80, 0x00, 0x08,
-	0x24, 0x06, 0x00, 0x00, 0xe0, 0xf9, 0x2a, 0x13, 0x42, 0x6c, 0x52, 0x64,
-	0x94, 0xd2, 0x90, 0x5c, 0xd1, 0x14, 0xbb, 0x72, 0x28, 0x5e, 0x8c, 0xc3,
-	0xb2, 0xc5, 0x8f, 0x36, 0x92, 0xa5, 0xc6, 0x89, 0x4f, 0x9b, 0x65, 0xcb,
-	0x0d, 0x8f, 0x4a, 0xa1, 0x61, 0x1a, 0x84, 0xd2, 0x0d, 0x6a, 0x67, 0xfc,
-	0xf7, 0x9b, 0x17, 0x18, 0x85, 0x1b, 0x1a, 0xf0, 0xe8, 0x91, 0xc6, 0x9d,
-	0x7f, 0xbc, 0x7e, 0xe8, 0xfd, 0xc7, 0xa5, 0x67, 0x4d, 0x6d, 0x2c, 0xb5,
-	0xef, 0xde, 0xbe, 0xff, 0xff, 0xfe, 0x51, 0x1f, 0x3b, 0x78, 0x68, 0x74,
-	0x66, 0x54, 0x3a, 0x94, 0x20, 0x6a, 0x26, 0xb0, 0x56, 0x98, 0x5c, 0x93,
-	0xff, 0xfb, 0x20, 0xc4, 0xaf, 0x80, 0x05, 0xfc, 0x63, 0x53, 0x84, 0x8c,
-	0x4c, 0xc0, 0xc1, 0x06, 0x6a, 0x30, 0xb4, 0x98, 0x08, 0xcc, 0x08, 0xa8,
-	0x7a, 0xab, 0x93, 0x9c, 0xf1, 0x6b, 0x0b, 0x20, 0xd9, 0x71, 0x28, 0x3c,
-	0xb2, 0xf5, 0x9d, 0xea, 0xeb, 0xfa, 0xa2, 0x27, 0xc2, 0x83, 0xbf, 0xff,
-	0xfa, 0x83, 0xa8, 0xd2, 0xf0, 0xb9, 0x0f, 0x12, 0xc4, 0x4d, 0x53, 0x60,
-	0xda, 0xc0, 0xb0, 0x10, 0x83, 0x18, 0x25, 0xd2, 0xc1, 0x44, 0x4d, 0x39,
-	0x6d, 0xdd, 0x09, 0x2a, 0x1a, 0x92, 0x2b, 0x9f, 0x78, 0x14, 0x71, 0x61,
-	0x6d, 0xa7, 0x58, 0xae, 0x29, 0x0e, 0x8b, 0x35, 0xc8, 0x6f, 0xff, 0x7f,
-	0xfc, 0x8a, 0x95, 0x63, 0x59, 0x86, 0x47, 0x52, 0x0e, 0x81, 0x70, 0x10,
-	0x86, 0x21, 0xe3, 0x3b, 0x30, 0x10, 0x02, 0x54, 0x94, 0x8e, 0x78, 0x50,
-	0x70, 0x60, 0x64, 0x4a, 0xf7, 0x0f, 0x60, 0x08, 0xd0, 0xb3, 0xff, 0xfb,
-	0x22, 0xc4, 0xb5, 0x80, 0x05, 0x9c, 0x2f, 0x4d, 0x24, 0xa4, 0xc0, 0x80,
-	0xc5, 0x04, 0xab, 0x7c, 0x94, 0x18, 0x40, 0xcc, 0xa5, 0xc2, 0x43, 0x63,
-	0x55, 0xf5, 0x2d, 0x8f, 0x32, 0xae, 0xbf, 0xfd, 0xf6, 0x78, 0x53, 0x44,
-	0xeb, 0xc7, 0x2c, 0x61, 0x00, 0x4c, 0x1b, 0x08, 0x47, 0x52, 0xc2, 0xd7,
-	0xde, 0x5b, 0x6c, 0x96, 0x1b, 0x6e, 0xd3, 0x0f, 0x88, 0x0b, 0x05, 0xd6,
-	0x92, 0x02, 0x8c, 0x6a, 0x0e, 0xe3, 0xcf, 0xa1, 0xeb, 0xbf, 0xa8, 0x89,
-	0x85, 0x29, 0x26, 0x45, 0xbb, 0x3a, 0xbf, 0x47, 0xce, 0xde, 0xc4, 0x2a,
-	0x17, 0xf9, 0x20, 0x00, 0x0a, 0x11, 0x08, 0x02, 0xe4, 0x20, 0x24, 0xd5,
-	0x6e, 0x6c, 0xdb, 0x4a, 0xcf, 0x18, 0xe9, 0x2a, 0xbd, 0x44, 0x30, 0x0a,
-	0x1f, 0x55, 0x0d, 0xa2, 0x66, 0x52, 0x5d, 0x22, 0x75, 0xad, 0x89, 0x19,
-	0x46, 0xda, 0x72, 0x74, 0x1e, 0x9f, 0x81, 0x9d, 0xba, 0xff, 0xfb, 0x22,
-	0xc4, 0xbd, 0x00, 0x06, 0xa9, 0x03, 0x59, 0x34, 0x21, 0x00, 0x01, 0x6a,
-	0xa2, 0xac, 0xf7, 0x12, 0x80, 0x00, 0x3f, 0x5e, 0xea, 0x5b, 0x7b, 0x21,
-	0x5d, 0xc6, 0xf5, 0x94, 0xa7, 0x55, 0x34, 0x4b, 0x35, 0xd3, 0x97, 0x4b,
-	0x27, 0x53, 0xdb, 0x8f, 0x96, 0x5c, 0xaa, 0x15, 0x28, 0xb5, 0xe1, 0xfd,
-	0xd6, 0xaf, 0x71, 0xf9, 0x5f, 0xdb, 0x4e, 0x4e, 0xaf, 0x2d, 0x5f, 0xa1,
-	0x9e, 0x0c, 0xb6, 0x7d, 0xf7, 0xfb, 0x47, 0x1b, 0x45, 0x02, 0x04, 0x93,
-	0xa3, 0xd8, 0x49, 0x1b, 0xd9, 0xa3, 0x6d, 0x86, 0x06, 0xbb, 0x04, 0xb5,
-	0xb4, 0x84, 0x74, 0x2a, 0x06, 0x5d, 0x42, 0x68, 0x80, 0x50, 0xb3, 0x58,
-	0xc3, 0xb1, 0xe4, 0xfe, 0x94, 0x3d, 0x72, 0xda, 0xaa, 0xf4, 0x7f, 0xfe,
-	0xaa, 0x49, 0xd9, 0x65, 0x80, 0x00, 0x10, 0x02, 0x31, 0xc7, 0x48, 0x08,
-	0x7c, 0xa6, 0xea, 0x24, 0x92, 0xc6, 0x59, 0xee, 0xff, 0xfb, 0x20, 0xc4,
-	0xac, 0x00, 0x45, 0xbc, 0x33, 0x79, 0xdc, 0xf3, 0x00, 0x30, 0xb9, 0x85,
-	0xac, 0x38, 0x93, 0x98, 0x44, 0x96, 0x2a, 0x92, 0x52, 0x9f, 0x44, 0xa1,
-	0xb7, 0xa3, 0xa2, 0x67, 0xb2, 0x66, 0x54, 0x4f, 0x76, 0xfd, 0xa2, 0x85,
-	0x4b, 0x4b, 0x26, 0x6d, 0x4f, 0x54, 0xd2, 0x22, 0xbd, 0x3e, 0xe5, 0x4b,
-	0xdb, 0x6c, 0x0a, 0xa9, 0x38, 0x20, 0x16, 0x44, 0x6c, 0x45, 0x9b, 0x4c,
-	0x20, 0xd6, 0xd1, 0x02, 0x14, 0x0a, 0x13, 0x71, 0x32, 0xc4, 0x08, 0xc3,
-	0x4c, 0x36, 0x34, 0x8a, 0x07, 0x15, 0x4b, 0xdc, 0x34, 0x53, 0x93, 0x51,
-	0xd7, 0x58, 0x8f, 0x72, 0x53, 0xf6, 0xa3, 0xf2, 0x3f, 0x7d, 0x4c, 0x49,
-	0xb6, 0x69, 0x10, 0x49, 0x02, 0x00, 0x88, 0x3a, 0x5c, 0x32, 0x21, 0xf5,
-	0xed, 0xa0, 0x4c, 0x50, 0x37, 0x2b, 0x9d, 0x81, 0x33, 0xc2, 0x77, 0x82,
-	0x8b, 0x7b, 0xda, 0x50, 0xea, 0x26, 0xff, 0xfb, 0x22, 0xc4, 0xb4, 0x00,
-	0x05, 0xf4, 0x23, 0x59, 0xc4, 0xb0, 0xc0, 0x80, 0xbe, 0x04, 0xea, 0x72,
-	0x98, 0x20, 0x00, 0x69, 0x19, 0xb0, 0xce, 0x6a, 0xe7, 0x43, 0x2f, 0x77,
-	0xff, 0xff, 0x7e, 0xc3, 0xab, 0x96, 0x5b, 0x6e, 0xb1, 0xfd, 0xa3, 0x01,
-	0xe8, 0x18, 0x76, 0xe2, 0x07, 0xa0, 0xf0, 0xf6, 0x96, 0x8b, 0x6c, 0x64,
-	0xa6, 0x76, 0x60, 0x07, 0x7c, 0xb9, 0x01, 0x92, 0x8f, 0x8b, 0x7b, 0xaa,
-	0x26, 0x44, 0x39, 0x15, 0x62, 0x1d, 0xff, 0xfe, 0x8e, 0xf1, 0x5b, 0x0f,
-	0xb6, 0xda, 0x55, 0x30, 0xdb, 0xad, 0x88, 0xb2, 0x51, 0x8a, 0x00, 0x34,
-	0x0c, 0x80, 0x81, 0x87, 0xc3, 0x94, 0x78, 0x1f, 0x58, 0x45, 0xa0, 0xe8,
-	0x59, 0xc1, 0xe3, 0x2a, 0x44, 0xe1, 0xc8, 0xbe, 0x27, 0xa2, 0xc2, 0x8a,
-	0xec, 0x63, 0x59, 0xfd, 0x93, 0xe9, 0xfb, 0xb4, 0x6f, 0xec, 0x70, 0x41,
-	0xb5, 0x6b, 0x25, 0x15, 0x9c, 0xff, 0xfb, 0x20, 0xc4, 0xbb, 0x00, 0x0b,
-	0x38, 0xfd, 0x46, 0xb8, 0x94, 0x80, 0x00, 0xb7, 0x04, 0xed, 0x77, 0x9e,
-	0x10, 0x06, 0x0a, 0xe8, 0x2b, 0xb0, 0x53, 0x74, 0x32, 0x48, 0xf8, 0x18,
-	0xe4, 0xb5, 0x6b, 0x14, 0x0e, 0xbc, 0x00, 0x24, 0x45, 0x6b, 0x62, 0x66,
-	0x47, 0xb1, 0x8f, 0x2b, 0x2a, 0xdc, 0xc2, 0x83, 0xe2, 0x87, 0xc8, 0xe2,
-	0x8a, 0x65, 0x9b, 0x7f, 0xdf, 0x48, 0xb1, 0xee, 0x85, 0x22, 0xba, 0xd1,
-	0x00, 0x88, 0x1a, 0x10, 0xe8, 0xca, 0x92, 0xa2, 0x35, 0x40, 0x68, 0x1c,
-	0x28, 0x9a, 0x19, 0xf1, 0x81, 0x22, 0x61, 0x71, 0xe5, 0x82, 0xa7, 0x81,
-	0xa3, 0xe8, 0x49, 0x14, 0xc1, 0x94, 0xba, 0x1e, 0x53, 0x76, 0x8c, 0x06,
-	0xce, 0xbd, 0x8b, 0x87, 0x86, 0xa1, 0x71, 0x6f, 0xff, 0xbd, 0x41, 0x18,
-	0xe3, 0x6d, 0xae, 0x66, 0xa0, 0x15, 0x0f, 0xa5, 0xff, 0x03, 0xee, 0xb7,
-	0x13, 0xdc, 0xc0, 0xff, 0xfb, 0x22, 0xc4, 0xad, 0x80, 0x06, 0x10, 0x87,
-	0x49, 0x84, 0x98, 0x45, 0x40, 0xbc, 0x83, 0xe9, 0x70, 0x64, 0x8c, 0x20,
-	0x0f, 0xa6, 0x75, 0xd1, 0xea, 0x8b, 0x59, 0x60, 0x42, 0x7b, 0xc4, 0x67,
-	0x9b, 0x51, 0xe0, 0xc3, 0xcd, 0x81, 0xf1, 0xb7, 0x81, 0xf1, 0xcd, 0xbd,
-	0x6c, 0x31, 0x56, 0x8f, 0xab, 0xed, 0x7e, 0x95, 0x01, 0xa6, 0xe3, 0x91,
-	0x6c, 0x34, 0x02, 0x2c, 0xaf, 0x5c, 0x50, 0x86, 0xc3, 0xa9, 0x33, 0xe5,
-	0x10, 0x14, 0x14, 0xdb, 0x69, 0x51, 0x38, 0xc9, 0xc6, 0x4d, 0xa7, 0x81,
-	0x13, 0xab, 0x63, 0x4e, 0x83, 0xd0, 0x70, 0xd1, 0x55, 0xee, 0xc6, 0x3a,
-	0x68, 0x30, 0x22, 0xa7, 0x6a, 0xce, 0xff, 0x47, 0xd2, 0x00, 0x8d, 0x04,
-	0x10, 0x3a, 0x07, 0xc9, 0x95, 0xc1, 0x45, 0x11, 0xc8, 0x84, 0xb5, 0x56,
-	0x04, 0xc1, 0x0c, 0x02, 0xe5, 0x4b, 0x24, 0x28, 0x1f, 0x02, 0x92, 0x3a,
-	0x98, 0xc4, 0xff, 0xfb, 0x22, 0xc4, 0xb4, 0x80, 0x05, 0xc0, 0x27, 0x49,
-	0xa4, 0x9c, 0xc2, 0x00, 0xb5, 0x08, 0xeb, 0xf0, 0xc3, 0x0c, 0x9e, 0x87,
-	0x47, 0x47, 0xbc, 0xd5, 0x49, 0x3e, 0x25, 0x00, 0xd8, 0x4d, 0xb3, 0x07,
-	0x35, 0xaa, 0xdd, 0xb5, 0x3f, 0xec, 0x04, 0x36, 0x9b, 0x8d, 0x35, 0x34,
-	0x03, 0xb2, 0x1a, 0x31, 0x3e, 0x07, 0xf8, 0x33, 0xe2, 0x22, 0xec, 0x34,
-	0x38, 0x22, 0x0b, 0x17, 0x01, 0x00, 0x87, 0x59, 0xa7, 0x91, 0x15, 0x2e,
-	0x19, 0x1c, 0x61, 0x80, 0x02, 0x85, 0x0b, 0x08, 0xe4, 0x37, 0xb0, 0x56,
-	0x83, 0x96, 0xac, 0xfe, 0x8f, 0x57, 0xfa, 0x8b, 0x00, 0x71, 0x95, 0x48,
-	0x60, 0x68, 0x2d, 0x28, 0x82, 0x02, 0x08, 0xd7, 0x1c, 0x7e, 0x9a, 0x90,
-	0xa3, 0x87, 0xb1, 0x90, 0xf6, 0xb6, 0xe4, 0xbe, 0xc1, 0x19, 0x8d, 0x7d,
-	0x93, 0x14, 0x14, 0x20, 0x6c, 0x3e, 0xe9, 0x51, 0x10, 0xd7, 0x3a, 0x06,
-	0x73, 0xff, 0xfb, 0x20, 0xc4, 0xbd, 0x80, 0x05, 0x74, 0x11, 0x49, 0xa4,
-	0x88, 0xc0, 0x00, 0xc3, 0x84, 0xe8, 0x30, 0xc0, 0x98, 0x90, 0xdd, 0x40,
-	0x1b, 0x7a, 0x3d, 0x34, 0x2a, 0x10, 0x5a, 0x46, 0x10, 0x1f, 0x41, 0xcc,
-	0x6f, 0xc4, 0x37, 0xb5, 0xd8, 0x74, 0x31, 0x1d, 0x04, 0x4f, 0x27, 0x4c,
-	0x15, 0x78, 0x8d, 0x01, 0xf1, 0x8e, 0x78, 0x85, 0xc2, 0x36, 0x3d, 0x6c,
-	0x71, 0xc7, 0x1a, 0x07, 0xf1, 0x46, 0x3d, 0xc2, 0x37, 0xe0, 0x71, 0xae,
-	0x0f, 0x1f, 0x43, 0xff, 0xa4, 0x66, 0xa3, 0xd4, 0x67, 0x11, 0x34, 0x95,
-	0xa1, 0x2b, 0x01, 0x85, 0x7c, 0x18, 0xcc, 0x50, 0xb9, 0x3e, 0x94, 0x71,
-	0xd2, 0x19, 0xfb, 0xb5, 0x48, 0x7a, 0x74, 0xb0, 0xc0, 0x47, 0x17, 0x40,
-	0x55, 0xe2, 0xc6, 0x0d, 0x07, 0x9a, 0x68, 0x6e, 0x60, 0x51, 0x6f, 0x38,
-	0xe5, 0xa0, 0xfd, 0xdf, 0xb6, 0x8a, 0x11, 0xae, 0xe6, 0xc2, 0x50, 0xff,
-	0xfb, 0x22, 0xc4, 0xc5, 0x80, 0x06, 0x2c, 0x27, 0x3d, 0x27, 0x8c, 0x44,
-	0xc0, 0xc0, 0x87, 0x67, 0xf0, 0xc1, 0x89, 0x20, 0x10, 0x81, 0x73, 0x6e,
-	0x98, 0xdc, 0xbc, 0x31, 0x9a, 0x16, 0x9d, 0xc8, 0xed, 0xaf, 0xcc, 0x48,
-	0x8a, 0x14, 0xa4, 0x1c, 0xcf, 0xa0, 0xc9, 0x60, 0x79, 0x6b, 0x2a, 0x30,
-	0x2e, 0x99, 0x0d, 0x65, 0xe1, 0xe2, 0xc1, 0x44, 0x81, 0xd2, 0xfd, 0x9f,
-	0x47, 0xf4, 0x8a, 0xa8, 0x70, 0xb3, 0xaa, 0xb0, 0x16, 0x2c, 0x3f, 0xb7,
-	0x5c, 0xec, 0x15, 0x10, 0x19, 0x17, 0x5e, 0x16, 0x54, 0x89, 0x82, 0x19,
-	0x6e, 0x74, 0x89, 0xa7, 0x08, 0xf4, 0xc9, 0xf7, 0x6b, 0xe7, 0xda, 0xf0,
-	0xb3, 0xb4, 0xca, 0x91, 0x79, 0xc0, 0x66, 0x82, 0x29, 0xd7, 0xd7, 0xd5,
-	0xbd, 0x15, 0x01, 0x6a, 0xb2, 0x80, 0x60, 0x18, 0x07, 0xe1, 0x40, 0x48,
-	0x4c, 0x11, 0x25, 0xb8, 0xc3, 0xa9, 0x5e, 0x2a, 0x36, 0xf0, 0xff, 0xfb,
-	0x20, 0xc4, 0xcb, 0x80, 0x06, 0x1c, 0x37, 0x3d, 0x87, 0xbc, 0xc0, 0x40,
-	0xc0, 0x84, 0x66, 0xe0, 0xc7, 0x8c, 0x08, 0xd2, 0x80, 0x03, 0x81, 0xb1,
-	0x8d, 0x10, 0x9b, 0x1a, 0xb4, 0x85, 0x23, 0xc4, 0xee, 0x7b, 0x6b, 0xb2,
-	0xca, 0x51, 0x26, 0xb7, 0x93, 0xd7, 0xe8, 0xdc, 0x6c, 0xa6, 0xb6, 0x90,
-	0x97, 0x72, 0xca, 0xd0, 0x09, 0x70, 0xe5, 0x1e, 0xb8, 0x22, 0x46, 0xe1,
-	0x6d, 0x5f, 0x65, 0x94, 0x26, 0x44, 0xdd, 0x9b, 0x00, 0xc3, 0x48, 0x18,
-	0xa8, 0x28, 0x66, 0x4c, 0x6b, 0xa5, 0x23, 0xd0, 0x74, 0xb9, 0x38, 0x92,
-	0x0d, 0x99, 0x83, 0x5f, 0xb8, 0x58, 0x9c, 0xa4, 0x23, 0xb4, 0xa1, 0xbb,
-	0xf7, 0x5f, 0xea, 0xe7, 0xd5, 0xfe, 0xda, 0xfb, 0xf7, 0xf5, 0x00, 0x58,
-	0x90, 0x18, 0x56, 0x71, 0xa9, 0xca, 0x19, 0x42, 0x3c, 0xc2, 0x91, 0xe6,
-	0x22, 0x99, 0xa3, 0x82, 0x05, 0x5e, 0x0c, 0x44, 0xff, 0xfb, 0x22, 0xc4,
-	0xd1, 0x80, 0x06, 0x28, 0x35, 0x3b, 0x87, 0xb0, 0x60, 0x40, 0xbf, 0x8c,
-	0xe6, 0x00, 0xf7, 0x8c, 0x08, 0x0c, 0xd4, 0xce, 0xa0, 0x30, 0xa8, 0x14,
-	0x15, 0x24, 0x74, 0x3e, 0x11, 0x56, 0x00, 0x00, 0x10, 0x50, 0x5c, 0x1e,
-	0xda, 0xb6, 0x95, 0x06, 0x1a, 0xd4, 0x14, 0x25, 0x7e, 0xd7, 0xe8, 0x92,
-	0x11, 0xaa, 0xf1, 0x45, 0x70, 0x0c, 0x41, 0x0c, 0x3e, 0xcb, 0x70, 0x42,
-	0x9c, 0x9a, 0xf5, 0x23, 0xca, 0x28, 0x1f, 0x6a, 0xd7, 0xd5, 0xfe, 0xe1,
-	0x42, 0xc4, 0xbe, 0xd6, 0x32, 0x00, 0x4c, 0xd0, 0x24, 0x69, 0x13, 0xf3,
-	0x89, 0x88, 0xe4, 0x1d, 0x6e, 0xed, 0xdf, 0x3d, 0x29, 0x28, 0xc9, 0xf2,
-	0xac, 0xbe, 0xe2, 0x9d, 0xe0, 0x32, 0xa1, 0xf5, 0xf1, 0xea, 0x0a, 0x88,
-	0x3b, 0x22, 0xd3, 0x50, 0x72, 0x64, 0x86, 0xa5, 0xe8, 0x5a, 0x29, 0x39,
-	0xf3, 0x0d, 0x46, 0x8e, 0x6c, 0x27, 0x16, 0xff, 0xfb, 0x22, 0xc4, 0xd7,
-	0x80, 0x05, 0xf8, 0x29, 0x35, 0x07, 0x8c, 0xc4, 0x80, 0xc3, 0x0c, 0xe6,
-	0x01, 0x81, 0x88, 0xb8, 0xe8, 0x81, 0xec, 0x23, 0x91, 0xea, 0xb7, 0xf7,
-	0x66, 0x61, 0x20, 0x00, 0xc0, 0xb1, 0xd7, 0xad, 0x73, 0x23, 0xc6, 0x11,
-	0x78, 0x98, 0x44, 0xb5, 0xa1, 0xec, 0xb6, 0x8a, 0x7f, 0x5b, 0xf5, 0x96,
-	0x58, 0x5a, 0x11, 0x21, 0x05, 0xb9, 0xec, 0xad, 0x17, 0x38, 0x6f, 0xed,
-	0x0e, 0x1b, 0xc7, 0xb1, 0x00, 0x10, 0x51, 0xce, 0x04, 0x1a, 0x9d, 0x1e,
-	0xbc, 0xa8, 0xcd, 0xa4, 0xaf, 0xe4, 0x6f, 0x0b, 0x85, 0x4e, 0x56, 0xc1,
-	0x28, 0x14, 0x0c, 0xe2, 0x86, 0x2c, 0x32, 0x10, 0x17, 0x54, 0x4e, 0x72,
-	0x16, 0xf7, 0x68, 0x53, 0xff, 0xb6, 0x8a, 0x16, 0xbf, 0xd0, 0xda, 0xe0,
-	0x15, 0x87, 0x42, 0x79, 0xe8, 0x91, 0x75, 0x9b, 0x07, 0xae, 0x3b, 0xd6,
-	0xba, 0x5c, 0xfa, 0x59, 0xbd, 0x21, 0xff, 0xfb, 0x20, 0xc4, 0xde, 0x00,
-	0x06, 0x04, 0x45, 0x39, 0x27, 0x98, 0x65, 0x40, 0xb9, 0x13, 0x66, 0x01,
-	0x86, 0x0c, 0x20, 0x4c, 0x67, 0xba, 0x0f, 0x69, 0xc4, 0x07, 0xe4, 0xc2,
-	0x14, 0x13, 0xb4, 0x49, 0x7f, 0x91, 0xda, 0x46, 0x65, 0xd6, 0xcd, 0x0a,
-	0xe1, 0xd3, 0x13, 0xa3, 0x7f, 0xcb, 0x53, 0xed, 0x0d, 0x08, 0xa7, 0x24,
-	0x8d, 0x73, 0xb6, 0x02, 0x84, 0xac, 0x39, 0x18, 0xce, 0x27, 0x4d, 0xd2,
-	0xac, 0x93, 0xa2, 0x2c, 0x36, 0x2a, 0x7e, 0x5c, 0xb9, 0x78, 0x1b, 0x8a,
-	0x2b, 0x37, 0x36, 0x2c, 0xd5, 0x9f, 0x2c, 0x89, 0x96, 0x4b, 0xf0, 0xd7,
-	0x6f, 0x9b, 0x84, 0x16, 0x3d, 0xdb, 0x56, 0xb4, 0x2a, 0x49, 0xe2, 0x1a,
-	0x87, 0xea, 0xa6, 0xec, 0x03, 0x22, 0xbe, 0xb7, 0x98, 0x90, 0x04, 0xe8,
-	0xbf, 0x90, 0x65, 0x38, 0xba, 0xbf, 0x14, 0x44, 0xc1, 0x96, 0x94, 0x06,
-	0x08, 0x71, 0xf9, 0xb8, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x00, 0x06, 0x04,
-	0x2b, 0x37, 0x27, 0xa4, 0xc0, 0x40, 0xea, 0x8b, 0x66, 0xa4, 0xf4, 0x8c,
-	0x99, 0x18, 0xba, 0x25, 0xd2, 0xab, 0x1a, 0x07, 0x05, 0xfc, 0xce, 0xbb,
-	0x91, 0x4c, 0xc1, 0x17, 0x1c, 0x59, 0x65, 0x41, 0xf7, 0x38, 0x87, 0x70,
-	0x9e, 0x5c, 0xe0, 0xb3, 0x8a, 0x44, 0x06, 0x6f, 0xa1, 0x6d, 0xbf, 0xaf,
-	0xd2, 0x12, 0x70, 0x91, 0x0e, 0xd3, 0x5c, 0x36, 0x14, 0x58, 0x8a, 0x2d,
-	0x22, 0x70, 0xe4, 0x9b, 0x23, 0x33, 0x32, 0x1b, 0xf9, 0x61, 0xa9, 0x14,
-	0xa0, 0xc7, 0xba, 0x19, 0xf5, 0x46, 0x32, 0x61, 0x46, 0x50, 0x72, 0x01,
-	0x1b, 0x0b, 0xb0, 0x18, 0x52, 0x12, 0xb7, 0x09, 0x84, 0x4b, 0x68, 0xb1,
-	0x3b, 0xbd, 0xac, 0xb3, 0xa2, 0x97, 0xaa, 0x4d, 0x3b, 0x35, 0xf9, 0xb8,
-	0xdb, 0x4c, 0x00, 0x89, 0x17, 0x8a, 0x08, 0xc7, 0xdb, 0xc5, 0xc5, 0xdc,
-	0x28, 0x1c, 0x04, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xa0, 0x3b,
-	0x33, 0x0c, 0x18, 0x64, 0xc0, 0xe5, 0x99, 0x66, 0xa4, 0xf0, 0x8a, 0x70,
-	0xd0, 0x9e, 0x04, 0x18, 0x4c, 0x35, 0x35, 0xa8, 0x10, 0xe5, 0x4d, 0x91,
-	0x24, 0x78, 0x66, 0x76, 0x53, 0x5b, 0x63, 0x8d, 0x1f, 0x6b, 0xfd, 0x0d,
-	0x7a, 0x85, 0xef, 0x82, 0xbe, 0xda, 0x55, 0xa4, 0xff, 0xde, 0x7f, 0xfc,
-	0xff, 0x7b, 0x64, 0xb4, 0x45, 0x5f, 0xa3, 0x95, 0x48, 0x27, 0x09, 0xfa,
-	0x8d, 0x64, 0x60, 0xd4, 0x3a, 0x72, 0x7c, 0x80, 0x0e, 0x70, 0x07, 0x4d,
-	0x57, 0x67, 0x02, 0x10, 0x8e, 0x11, 0x09, 0x29, 0x03, 0xac, 0xd0, 0x54,
-	0x34, 0x0f, 0x39, 0x90, 0x40, 0x4e, 0x80, 0xd8, 0x65, 0xa4, 0x19, 0x00,
-	0x35, 0x47, 0x32, 0x03, 0xea, 0xb8, 0xc4, 0x91, 0x5a, 0x7d, 0xba, 0x23,
-	0x97, 0xa6, 0x74, 0xed, 0x3e, 0xd9, 0xff, 0xfd, 0x02, 0x28, 0x6b, 0x02,
-	0x23, 0x62, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x46, 0xb4, 0x6b, 0x2e,
-	0x0c, 0x2c, 0x61, 0x40, 0xd7, 0x8e, 0x66, 0x14, 0xf1, 0x0d, 0x40, 0x17,
-	0x84, 0x29, 0x17, 0x5c, 0xf3, 0x60, 0x32, 0x27, 0xe2, 0xd3, 0xb9, 0x2d,
-	0x6d, 0x31, 0xa0, 0x9b, 0x92, 0x35, 0x86, 0x10, 0xb0, 0xd1, 0x73, 0x97,
-	0x3c, 0x92, 0x4a, 0xe9, 0x28, 0xb6, 0x42, 0xdd, 0xc7, 0xa2, 0x8b, 0xd8,
-	0xaf, 0xaf, 0x39, 0x50, 0xc7, 0x3e, 0xe5, 0x27, 0xc8, 0x00, 0xe8, 0x05,
-	0x21, 0xfc, 0x72, 0x93, 0x78, 0x73, 0x7d, 0x91, 0x13, 0x1a, 0x28, 0xbf,
-	0xd4, 0xb5, 0xa2, 0x3a, 0x9c, 0x38, 0x01, 0x30, 0x40, 0xb4, 0x2e, 0x00,
-	0x42, 0xca, 0xa8, 0x58, 0x0a, 0x0d, 0x08, 0x14, 0xbc, 0xfd, 0x0c, 0x43,
-	0xb0, 0x30, 0xdb, 0xc9, 0xad, 0x16, 0x5d, 0xc6, 0x28, 0xc2, 0x12, 0xd5,
-	0xee, 0xaa, 0x52, 0x49, 0x2d, 0xb6, 0x7d, 0xd2, 0x03, 0xb4, 0x6a, 0xa4,
-	0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xa0, 0xa9, 0x37, 0x26, 0x04,
-	0x51, 0x08, 0xdf, 0x8e, 0xe7, 0x30, 0xf4, 0x8c, 0xb0, 0x98, 0x9c, 0xae,
-	0x64, 0xd7, 0xee, 0xe4, 0x0c, 0xb1, 0xa8, 0x27, 0x19, 0x46, 0xa7, 0x9d,
-	0x06, 0xb3, 0x2d, 0x48, 0x4d, 0x38, 0x73, 0xa4, 0x82, 0x0c, 0xa9, 0x61,
-	0x65, 0x5c, 0x64, 0x76, 0x03, 0xd4, 0x3d, 0xae, 0x36, 0x61, 0x72, 0x0e,
-	0x4b, 0x6f, 0x6a, 0xbf, 0x60, 0x13, 0x52, 0x1a, 0x40, 0x24, 0x82, 0x98,
-	0x80, 0x4b, 0x00, 0x67, 0x49, 0x64, 0x8d, 0x22, 0x29, 0x85, 0x25, 0xf6,
-	0x76, 0x8d, 0x47, 0x1b, 0x19, 0x35, 0x01, 0xd4, 0x1b, 0x37, 0x02, 0x3d,
-	0x0f, 0x1a, 0x80, 0xd2, 0x5c, 0x44, 0x05, 0x74, 0xf2, 0x47, 0x0e, 0x95,
-	0x58, 0x75, 0x69, 0x57, 0xdb, 0xc9, 0xf6, 0xdc, 0xc5, 0xd5, 0x0f, 0xcc,
-	0x20, 0x80, 0x60, 0x05, 0xa1, 0xcd, 0xd8, 0xaf, 0xb8, 0x2b, 0x25, 0xff,
-	0xfb, 0x20, 0xc4, 0xe7, 0x00, 0x07, 0x5c, 0x63, 0x35, 0x27, 0x98, 0x64,
-	0xc0, 0xd5, 0x0a, 0xe5, 0xc0, 0xf3, 0x0c, 0xb8, 0x14, 0xf0, 0x6e, 0x88,
-	0x9f, 0x9d, 0x22, 0xc7, 0x2a, 0xf3, 0x16, 0x29, 0x69, 0x43, 0x83, 0x1d,
-	0x0b, 0x22, 0x68, 0x1c, 0x35, 0xc8, 0xbd, 0x94, 0x34, 0x4c, 0x25, 0x11,
-	0xd8, 0x74, 0xee, 0x91, 0x5b, 0x44, 0xaf, 0x65, 0xb7, 0xa9, 0x1e, 0x8c,
-	0xf9, 0x96, 0x36, 0x6d, 0x00, 0x14, 0x92, 0x40, 0xb2, 0x02, 0xa9, 0x8b,
-	0x24, 0x3d, 0x15, 0x17, 0x8f, 0xbb, 0xfd, 0x7b, 0x0b, 0x61, 0x85, 0x13,
-	0x70, 0x24, 0x0d, 0xe1, 0x29, 0x1c, 0x1d, 0x18, 0x84, 0x1a, 0x0d, 0x61,
-	0xe0, 0xde, 0x3c, 0x5c, 0x18, 0x2a, 0x1d, 0x48, 0xb1, 0xe9, 0x04, 0xb9,
-	0xec, 0x9b, 0x15, 0x1c, 0xb5, 0xdf, 0x63, 0xd9, 0xbb, 0x4c, 0xa2, 0x2d,
-	0x59, 0x2d, 0xae, 0xfd, 0xb8, 0x01, 0x40, 0x36, 0x22, 0xff, 0xfb, 0x22,
-	0xc4, 0xe5, 0x00, 0x07, 0x7c, 0x37, 0x41, 0xa7, 0x88, 0xc4, 0xa8, 0xe7,
-	0x88, 0x66, 0xa4, 0xf3, 0x0c, 0xa8, 0x07, 0x84, 0xda, 0xdb, 0x1d, 0xa5,
-	0x8d, 0xa8, 0xa0, 0xf3, 0xdb, 0x8a, 0xd6, 0xa2, 0x27, 0x84, 0xd8, 0x5a,
-	0x6c, 0x46, 0x78, 0xb1, 0x3e, 0xa4, 0xc5, 0x64, 0x52, 0x53, 0x84, 0xa7,
-	0xfe, 0x4c, 0x91, 0x64, 0x24, 0x4d, 0x6f, 0x2a, 0x68, 0xdb, 0xca, 0x07,
-	0x01, 0x81, 0x09, 0x54, 0x19, 0xd3, 0x6e, 0x8b, 0xe6, 0x78, 0x83, 0xe6,
-	0xc0, 0x52, 0x25, 0x01, 0x44, 0xa7, 0x41, 0x05, 0x7d, 0x9e, 0x53, 0x39,
-	0xd2, 0x99, 0x12, 0xf9, 0xcc, 0x88, 0xf0, 0x42, 0xc0, 0xf1, 0x20, 0x15,
-	0xea, 0x53, 0xa8, 0x79, 0x40, 0x76, 0x90, 0x44, 0x47, 0x32, 0x89, 0xb1,
-	0xcf, 0x6d, 0x9c, 0xb1, 0x94, 0x55, 0x0b, 0x00, 0x5e, 0x9a, 0xa6, 0x40,
-	0x43, 0x25, 0x00, 0xde, 0xba, 0x4c, 0x4c, 0xd4, 0xff, 0xfb, 0x22, 0xc4,
-	0xe1, 0x00, 0x07, 0x04, 0x35, 0x43, 0x87, 0xb1, 0x20, 0x60, 0xda, 0x88,
-	0x26, 0x14, 0xf3, 0x0c, 0xa8, 0x21, 0x33, 0x21, 0x78, 0x7e, 0xcc, 0x55,
-	0x56, 0xb6, 0xf9, 0x3f, 0x9d, 0x9f, 0x48, 0x10, 0x44, 0x04, 0x02, 0x33,
-	0x66, 0x6b, 0xbe, 0xb3, 0x6f, 0x30, 0xa2, 0x6b, 0x42, 0x29, 0xff, 0xb8,
-	0x36, 0xb6, 0xdc, 0x38, 0x11, 0xa1, 0x63, 0x39, 0x93, 0xa6, 0x3a, 0xca,
-	0x4d, 0x10, 0x74, 0x91, 0xc1, 0xdd, 0x2c, 0x9c, 0x2a, 0xc3, 0xab, 0x45,
-	0x34, 0x2a, 0xe3, 0x48, 0x58, 0x09, 0xa0, 0x01, 0x15, 0xad, 0x73, 0x41,
-	0x5e, 0x7a, 0x23, 0x2c, 0x2a, 0xd9, 0x15, 0x55, 0x4b, 0x7b, 0x3e, 0x72,
-	0xc8, 0xa2, 0xd5, 0x01, 0x2a, 0xa0, 0x44, 0x60, 0x14, 0x61, 0xd4, 0xaf,
-	0x39, 0xc9, 0x4b, 0x9a, 0x6d, 0xe1, 0x12, 0x04, 0xc0, 0x81, 0x1d, 0xe8,
-	0xb2, 0x8f, 0x31, 0x1a, 0x63, 0xa5, 0xcf, 0xff, 0xfb, 0x20, 0xc4, 0xe0,
-	0x80, 0x06, 0xb4, 0x57, 0x51, 0x87, 0x98, 0x65, 0xf0, 0xd2, 0x06, 0xe6,
-	0x61, 0x06, 0x18, 0x08, 0x3b, 0x31, 0x96, 0x86, 0xbe, 0xce, 0xcd, 0x63,
-	0x33, 0xa2, 0xf6, 0x76, 0x39, 0xd5, 0x3d, 0xdf, 0x9d, 0x19, 0xd7, 0xc3,
-	0xa8, 0x78, 0xd7, 0x6a, 0x05, 0x98, 0x48, 0xca, 0xc3, 0xb5, 0xda, 0x9f,
-	0xac, 0x5a, 0xae, 0x89, 0x50, 0x80, 0x3c, 0x43, 0x20, 0xdc, 0x41, 0x09,
-	0xd6, 0x70, 0xe2, 0x48, 0x01, 0x98, 0xc5, 0xa8, 0xf6, 0xdb, 0xb3, 0x75,
-	0xc1, 0x50, 0x27, 0x18, 0x44, 0x2c, 0x4a, 0x90, 0x1a, 0x0f, 0x06, 0x09,
-	0xb6, 0x08, 0x40, 0x4a, 0x43, 0x97, 0xe8, 0x90, 0x47, 0x73, 0xe6, 0x90,
-	0x96, 0x8a, 0x27, 0x3c, 0xb6, 0xc6, 0xaa, 0x02, 0x19, 0x42, 0x48, 0x1e,
-	0x43, 0xe5, 0x0f, 0x9c, 0x30, 0xdc, 0x0e, 0x5a, 0xab, 0xc6, 0x49, 0x50,
-	0x99, 0x06, 0xb6, 0xe2, 0xf6, 0xff, 0xfb, 0x22, 0xc4, 0xe1, 0x80, 0x07,
-	0x2c, 0x69, 0x30, 0xc7, 0x98, 0x65, 0xc0, 0xd9, 0x08, 0x66, 0x65, 0x86,
-	0x0c, 0x28, 0x0e, 0x4f, 0x76, 0xb0, 0xdc, 0x1c, 0x6f, 0x16, 0xc7, 0x1a,
-	0x87, 0x0c, 0x2f, 0x00, 0x80, 0x58, 0x12, 0x12, 0xf3, 0xc0, 0x4a, 0x81,
-	0xd7, 0xe4, 0xdd, 0x40, 0x8c, 0xb2, 0x25, 0x9e, 0x25, 0x15, 0x75, 0xd7,
-	0x31, 0xcd, 0x17, 0x7b, 0x6d, 0xb6, 0xfa, 0xdb, 0x6b, 0x80, 0x00, 0xc0,
-	0xf1, 0x18, 0x18, 0x10, 0xb1, 0xee, 0x5d, 0x91, 0x59, 0x84, 0x1f, 0x5b,
-	0xe9, 0x42, 0xdc, 0xb2, 0x7b, 0x82, 0x8e, 0x40, 0x2a, 0xc5, 0xfe, 0x57,
-	0xc9, 0x14, 0xc9, 0xc7, 0x04, 0x1c, 0x15, 0x53, 0x0e, 0xc0, 0xbd, 0xc8,
-	0xc3, 0x28, 0xbe, 0x29, 0x01, 0x56, 0x91, 0x00, 0x02, 0xb0, 0x4a, 0x21,
-	0x9f, 0x83, 0xeb, 0x08, 0xb2, 0x69, 0x32, 0x20, 0x31, 0x91, 0x6d, 0x85,
-	0xd3, 0x0d, 0x06, 0x0b, 0xff, 0xfb, 0x20, 0xc4, 0xe0, 0x80, 0x06, 0x5c,
-	0xa9, 0x41, 0x84, 0x84, 0x51, 0xa8, 0xd9, 0x0c, 0x66, 0x15, 0x83, 0x0c,
-	0x98, 0x8f, 0x50, 0x2a, 0xb4, 0x45, 0x5f, 0x3e, 0x73, 0xe4, 0x2c, 0x39,
-	0xf3, 0x06, 0x16, 0x64, 0x36, 0x26, 0xa9, 0x0d, 0x60, 0x65, 0x69, 0x51,
-	0x3b, 0x06, 0xb4, 0x57, 0x57, 0x5d, 0x88, 0xa9, 0x4b, 0x25, 0xc7, 0x24,
-	0x8c, 0xdd, 0x31, 0x81, 0x54, 0x75, 0x2a, 0x9c, 0x07, 0x66, 0xe3, 0xe7,
-	0x49, 0x52, 0x50, 0x18, 0x90, 0xa4, 0x99, 0xae, 0xa8, 0xd1, 0x13, 0x87,
-	0x10, 0xcc, 0xc1, 0xb9, 0xfd, 0xd5, 0xa8, 0xc6, 0xd9, 0xd4, 0xc1, 0x84,
-	0x97, 0x05, 0x24, 0x9b, 0x80, 0x55, 0x95, 0xa9, 0x69, 0xb1, 0xdf, 0xff,
-	0x52, 0x0a, 0xa5, 0x05, 0xa8, 0xe4, 0x75, 0xd9, 0x08, 0x03, 0xc3, 0x70,
-	0x59, 0x02, 0x86, 0x9b, 0xc2, 0xa7, 0x4b, 0xa6, 0xa2, 0x02, 0x47, 0x02,
-	0x5e, 0xe0, 0xff, 0xfb, 0x22, 0xc4, 0xe2, 0x03, 0xc6, 0x18, 0x67, 0x2e,
-	0x07, 0x98, 0x64, 0xc0, 0xba, 0x07, 0x66, 0x00, 0xf3, 0x0c, 0x98, 0x02,
-	0x14, 0xc5, 0xe7, 0x20, 0xda, 0x88, 0x24, 0xc1, 0x94, 0x67, 0x07, 0x86,
-	0x25, 0xc8, 0x34, 0x7b, 0xec, 0xaf, 0x34, 0x85, 0x2a, 0x2b, 0x6d, 0x12,
-	0x4c, 0x74, 0xb3, 0xfd, 0x24, 0x09, 0x80, 0x53, 0x51, 0x38, 0x69, 0x05,
-	0x00, 0xd0, 0x61, 0xcd, 0x81, 0x71, 0xef, 0xaf, 0x3a, 0x61, 0xcb, 0x91,
-	0x17, 0x33, 0x12, 0x04, 0x60, 0x78, 0x16, 0x0d, 0x1c, 0x40, 0x02, 0x94,
-	0x0e, 0x28, 0x2e, 0x09, 0x86, 0x1a, 0x65, 0x8c, 0x0f, 0x1b, 0x3c, 0x27,
-	0x7b, 0x9f, 0xb9, 0x0a, 0xbd, 0x54, 0x68, 0x95, 0x72, 0x34, 0xdb, 0xa4,
-	0x51, 0x76, 0xcb, 0x35, 0xd6, 0x7f, 0xd2, 0x02, 0xc2, 0x28, 0xc4, 0x09,
-	0x01, 0xf2, 0x4c, 0xb9, 0x96, 0x0e, 0x22, 0x6c, 0x42, 0x2a, 0x6b, 0x3c,
-	0x26, 0xff, 0xfb, 0x22, 0xc4, 0xe9, 0x00, 0x07, 0x98, 0xa7, 0x33, 0x27,
-	0x98, 0x45, 0xc0, 0xd5, 0x86, 0x66, 0xa4, 0xf3, 0x08, 0xa8, 0x32, 0xa0,
-	0x53, 0xbc, 0xe1, 0xe4, 0x52, 0xed, 0x0a, 0x96, 0x07, 0x63, 0xf3, 0x22,
-	0x27, 0x0f, 0xb0, 0xfb, 0x18, 0xa3, 0x08, 0x4d, 0xef, 0x7b, 0xda, 0x37,
-	0xfe, 0xd4, 0xd4, 0x14, 0xdf, 0xc6, 0xaa, 0xd0, 0x09, 0x40, 0x6c, 0x9c,
-	0x39, 0x0a, 0x1f, 0x45, 0x4f, 0xb6, 0x99, 0x00, 0xc1, 0x0c, 0x93, 0x92,
-	0x32, 0xc9, 0xec, 0x1b, 0x6c, 0xca, 0x6c, 0xad, 0xc5, 0x53, 0xaf, 0x74,
-	0xdb, 0x23, 0x87, 0x41, 0xab, 0x14, 0xec, 0x38, 0x2e, 0xa6, 0x33, 0x27,
-	0xd0, 0xbd, 0x85, 0xcf, 0xa2, 0xd6, 0xbd, 0xef, 0x73, 0x52, 0xa5, 0x26,
-	0x77, 0x77, 0x87, 0x96, 0x5d, 0x65, 0x92, 0x00, 0x0b, 0x86, 0x83, 0xb1,
-	0xe1, 0x3a, 0xe3, 0xfd, 0x2e, 0xb7, 0x34, 0x30, 0x21, 0x69, 0x4e, 0xac,
-	0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x07, 0x60, 0x45, 0x31, 0x07, 0xa4,
-	0xc6, 0x80, 0xc3, 0x8d, 0x6b, 0xf4, 0x93, 0x0c, 0xae, 0x59, 0xbc, 0x52,
-	0x67, 0xb2, 0x19, 0x67, 0x5b, 0x4a, 0xfe, 0x0d, 0xe8, 0xfc, 0x72, 0x04,
-	0x7b, 0xed, 0x5d, 0x4d, 0x04, 0xf2, 0xd4, 0xbf, 0x9e, 0xee, 0x34, 0xed,
-	0x7d, 0xba, 0xdd, 0xaf, 0xf7, 0xd8, 0x08, 0x2c, 0x00, 0xc1, 0x61, 0x08,
-	0x85, 0x85, 0xc1, 0x8b, 0x42, 0x0f, 0x1a, 0x58, 0x00, 0x18, 0xf2, 0x1a,
-	0xed, 0xc8, 0x94, 0x39, 0x79, 0xc4, 0x01, 0x61, 0x38, 0x34, 0x72, 0x20,
-	0x59, 0xa9, 0x06, 0x19, 0x07, 0x63, 0x0b, 0x84, 0xae, 0x58, 0x49, 0x22,
-	0x37, 0x65, 0x40, 0xcc, 0x7c, 0x49, 0xad, 0xd5, 0x01, 0x69, 0xb4, 0xb9,
-	0xa5, 0x05, 0x35, 0x1c, 0x6c, 0x44, 0x92, 0x49, 0x00, 0x4c, 0x8e, 0xd6,
-	0x76, 0xe4, 0x83, 0xa4, 0x27, 0x28, 0x71, 0x01, 0x8a, 0x41, 0xff, 0xfb,
-	0x22, 0xc4, 0xe7, 0x00, 0x07, 0x00, 0x63, 0x31, 0x07, 0xa4, 0x65, 0x00,
-	0xd7, 0x0b, 0x27, 0x70, 0xc3, 0x0c, 0xe0, 0xf6, 0x91, 0xd3, 0x08, 0x2e,
-	0x53, 0x91, 0x3a, 0x24, 0x61, 0xe6, 0x54, 0xf3, 0xc8, 0x50, 0x80, 0x26,
-	0x7d, 0xe7, 0x14, 0x73, 0xa2, 0x44, 0x35, 0x42, 0x9d, 0x73, 0xc8, 0x50,
-	0x9f, 0xa5, 0xbb, 0x2b, 0x12, 0x57, 0x2c, 0xb1, 0xdb, 0x2a, 0x01, 0x0d,
-	0x70, 0xad, 0x48, 0x4a, 0x3c, 0x9e, 0x6a, 0xa4, 0xb7, 0x5c, 0x44, 0x6e,
-	0x3f, 0x6d, 0x31, 0xce, 0x82, 0x41, 0xd3, 0x82, 0x07, 0x93, 0x32, 0xd0,
-	0x0b, 0x98, 0xd7, 0x0f, 0xa8, 0x44, 0x2f, 0x75, 0x31, 0xc0, 0x50, 0xe4,
-	0x72, 0x08, 0xed, 0x3e, 0xaf, 0x5d, 0x77, 0x31, 0x5b, 0x55, 0x01, 0x8e,
-	0x93, 0x10, 0x1f, 0x00, 0x82, 0x82, 0x48, 0xc0, 0x8f, 0x1d, 0x1b, 0x6a,
-	0x1d, 0x4c, 0x9c, 0xca, 0xee, 0xf3, 0x76, 0x6d, 0xd7, 0xff, 0xfb, 0x20,
-	0xc4, 0xe7, 0x00, 0x06, 0xc4, 0x59, 0x3b, 0x86, 0x24, 0x61, 0x60, 0xda,
-	0x88, 0x66, 0xb0, 0x66, 0x0c, 0x28, 0xbb, 0xa0, 0x28, 0x1e, 0x20, 0xe2,
-	0x4e, 0xce, 0x6b, 0x49, 0xa5, 0xbf, 0x4a, 0x55, 0x36, 0x32, 0xee, 0xce,
-	0xd7, 0xff, 0x3a, 0x3a, 0xf4, 0x04, 0x3b, 0xed, 0xd9, 0xf3, 0x73, 0x4b,
-	0x7a, 0xfd, 0x0e, 0x9e, 0x71, 0x89, 0x54, 0x04, 0x70, 0xa4, 0x71, 0x2a,
-	0x88, 0xc3, 0xfe, 0xb4, 0xf4, 0xfe, 0x7a, 0x58, 0xa9, 0x39, 0x78, 0x61,
-	0xb8, 0x49, 0x82, 0x49, 0x26, 0xb5, 0xa7, 0xca, 0x8e, 0x79, 0xd7, 0xb2,
-	0x16, 0x58, 0x31, 0x66, 0x41, 0x11, 0xc4, 0x1e, 0xba, 0x55, 0x97, 0x78,
-	0x4d, 0x1e, 0x61, 0x45, 0xaa, 0xfe, 0x8a, 0xd4, 0x4f, 0x80, 0x82, 0x6e,
-	0x93, 0x38, 0xc0, 0xa4, 0x2a, 0x83, 0x66, 0xbe, 0x2a, 0x88, 0x98, 0x44,
-	0xf3, 0xb9, 0x04, 0xa2, 0x46, 0x13, 0xc8, 0xff, 0xfb, 0x22, 0xc4, 0xe7,
-	0x00, 0x06, 0x9c, 0x47, 0x53, 0x86, 0x24, 0xc5, 0x70, 0xde, 0x8c, 0xe6,
-	0xe4, 0xc3, 0x08, 0xf8, 0x1a, 0x19, 0x11, 0x7d, 0x94, 0xb6, 0x93, 0x22,
-	0xc9, 0x4a, 0x7e, 0x5b, 0x66, 0x0c, 0x4b, 0x36, 0x2e, 0xa3, 0xe4, 0x4b,
-	0xe8, 0x9a, 0x4c, 0x42, 0x2c, 0x96, 0x3f, 0x6d, 0xea, 0x75, 0xfe, 0x36,
-	0x91, 0xb1, 0x04, 0x03, 0x2c, 0x4d, 0x1f, 0x74, 0xc2, 0x80, 0xd4, 0xd3,
-	0x48, 0x51, 0x61, 0x01, 0x62, 0x35, 0xb0, 0x75, 0x14, 0x5e, 0x43, 0xa3,
-	0xb5, 0x42, 0xd5, 0xbf, 0xfb, 0x3e, 0xec, 0x24, 0xee, 0xf5, 0x48, 0xd5,
-	0xc7, 0x56, 0xfb, 0xc5, 0xfc, 0xa9, 0xe5, 0xf9, 0x98, 0x72, 0xb7, 0x7f,
-	0x16, 0x89, 0xaf, 0x49, 0x74, 0x82, 0x2d, 0x72, 0xea, 0x05, 0x16, 0xa2,
-	0x80, 0x14, 0x0e, 0x90, 0x30, 0x9d, 0x30, 0x54, 0xce, 0x21, 0x5d, 0xf5,
-	0x0b, 0x0b, 0x16, 0x1a, 0x8b, 0x2a, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80,
-	0x07, 0x34, 0x2f, 0x49, 0xe4, 0xb1, 0x00, 0xa8, 0xdb, 0x87, 0xa6, 0x60,
-	0xf3, 0x0c, 0xa8, 0xb0, 0xa3, 0xa5, 0x74, 0x99, 0xbc, 0x4c, 0x75, 0xf6,
-	0x5b, 0x72, 0x0e, 0x66, 0x90, 0x7c, 0x7a, 0x56, 0x1f, 0x24, 0x72, 0x52,
-	0x17, 0x61, 0x3b, 0x25, 0x03, 0x1f, 0x7e, 0x66, 0xcf, 0x3c, 0xa5, 0x84,
-	0xd5, 0xae, 0x6d, 0xae, 0xd7, 0x5b, 0x6c, 0x8d, 0xa0, 0x02, 0x60, 0x9b,
-	0x97, 0x06, 0xb2, 0x84, 0xca, 0x55, 0x36, 0x92, 0x38, 0x91, 0x43, 0xb7,
-	0xe8, 0x11, 0x26, 0x0a, 0x77, 0xf0, 0x27, 0x1a, 0x1a, 0x0d, 0x09, 0x26,
-	0xde, 0xd8, 0x1e, 0xe1, 0xe0, 0x11, 0x56, 0xd0, 0x97, 0xc9, 0xce, 0x0d,
-	0x4f, 0xfc, 0xfc, 0x7d, 0x33, 0x10, 0x82, 0x1e, 0x1b, 0x06, 0xcb, 0xb3,
-	0x01, 0x80, 0xc6, 0xf9, 0xe1, 0x30, 0x95, 0x11, 0x02, 0xd6, 0x08, 0x02,
-	0x19, 0x45, 0x0c, 0xaf, 0x08, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06,
-	0xc0, 0x45, 0x3b, 0xa7, 0x98, 0x65, 0x40, 0xd5, 0x05, 0xe7, 0xf0, 0xc4,
-	0x8c, 0x9c, 0x70, 0x96, 0x9e, 0x31, 0x65, 0xf9, 0x91, 0x9d, 0xdc, 0x43,
-	0x8c, 0x62, 0x0c, 0xec, 0x77, 0x64, 0x3e, 0x47, 0xd8, 0x89, 0xf0, 0x7a,
-	0xb4, 0xe4, 0x22, 0x16, 0x34, 0xd8, 0xd3, 0xc6, 0xd8, 0xe0, 0x11, 0xab,
-	0x50, 0x26, 0x91, 0x56, 0x8a, 0xc2, 0x8d, 0xc9, 0x25, 0x91, 0x22, 0x01,
-	0x00, 0x09, 0xa2, 0xd1, 0xf0, 0xc8, 0x77, 0x1d, 0x4d, 0xba, 0x64, 0xc9,
-	0x93, 0x3d, 0x0c, 0x7d, 0x80, 0x29, 0xf7, 0x07, 0xa3, 0x87, 0x44, 0xd2,
-	0xb8, 0x37, 0xd6, 0xf0, 0xa1, 0xa1, 0x40, 0x00, 0x20, 0xb3, 0x08, 0x67,
-	0xbd, 0xbe, 0xfd, 0xfe, 0x7a, 0xe9, 0x02, 0xdf, 0xf1, 0x55, 0x22, 0x30,
-	0x01, 0x30, 0x27, 0x6a, 0x27, 0x8a, 0x14, 0xe9, 0x52, 0x74, 0x61, 0x01,
-	0xdb, 0x7f, 0x96, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xe0, 0xa5,
-	0x33, 0x06, 0x0c, 0x52, 0xc8, 0xd7, 0x8f, 0xa6, 0xa4, 0xc0, 0x8e, 0x10,
-	0x69, 0xa8, 0xf7, 0xff, 0x8a, 0x24, 0x74, 0xe3, 0x31, 0x72, 0xd1, 0x40,
-	0xe8, 0x34, 0x7e, 0x0a, 0x8a, 0x84, 0xd4, 0xd2, 0xa3, 0x5c, 0x74, 0x02,
-	0xfa, 0x1d, 0x44, 0xa8, 0xad, 0xda, 0x2b, 0xad, 0x51, 0x0e, 0x61, 0xf0,
-	0x4e, 0x78, 0x35, 0x20, 0x9f, 0xb6, 0xff, 0x36, 0x90, 0xed, 0xa5, 0x99,
-	0x20, 0x01, 0xc1, 0x31, 0xee, 0x55, 0x14, 0x46, 0xea, 0x94, 0xf5, 0xb1,
-	0xee, 0x0b, 0x35, 0x7d, 0x61, 0x3d, 0xc4, 0x1f, 0x5b, 0x80, 0x4f, 0x22,
-	0x03, 0x63, 0xa0, 0xc0, 0x38, 0x84, 0xd6, 0x16, 0x79, 0xf1, 0xac, 0xaa,
-	0xf5, 0xcb, 0x2d, 0x08, 0x76, 0x5b, 0x6d, 0xb6, 0xc8, 0xdb, 0x44, 0x00,
-	0x6e, 0x15, 0x84, 0x00, 0xaf, 0x2c, 0x90, 0xa5, 0x44, 0xa8, 0xad, 0x3c,
-	0x8b, 0x15, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x06, 0xf0, 0x79, 0x2e,
-	0xac, 0x24, 0x61, 0x40, 0xdf, 0x14, 0xe6, 0x14, 0xf3, 0x0c, 0x98, 0x6a,
-	0x3d, 0xed, 0x38, 0x6c, 0xa8, 0x58, 0x00, 0x02, 0x54, 0xc2, 0x48, 0x06,
-	0xc4, 0xac, 0x18, 0x60, 0x5d, 0x10, 0xd3, 0x9f, 0x69, 0x75, 0x89, 0xc0,
-	0x41, 0xd1, 0xa8, 0xf7, 0x37, 0xb2, 0xb0, 0x90, 0x08, 0x92, 0x27, 0x00,
-	0x20, 0x0f, 0xf0, 0xe3, 0x20, 0xf1, 0x4d, 0x15, 0xc5, 0xe5, 0xf4, 0x6c,
-	0x92, 0x99, 0x26, 0xaf, 0x3b, 0x74, 0x11, 0x35, 0xfd, 0x28, 0x54, 0x3c,
-	0x3c, 0xca, 0xc0, 0xd0, 0x02, 0xb3, 0x4a, 0x4a, 0x70, 0xf3, 0xc9, 0x44,
-	0xbb, 0x11, 0x92, 0xa4, 0x04, 0xf7, 0xa0, 0x6a, 0xde, 0x58, 0x79, 0x2e,
-	0x6a, 0xe6, 0x15, 0x65, 0xe5, 0xd7, 0x2e, 0x11, 0xd9, 0x2d, 0x96, 0xc8,
-	0xe1, 0x48, 0x00, 0x78, 0x0a, 0x42, 0x4a, 0x14, 0x40, 0x71, 0xb8, 0xd5,
-	0x21, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06, 0xf8, 0x55, 0x31, 0x27,
-	0x98, 0x65, 0x80, 0xc7, 0x87, 0xab, 0x74, 0xf3, 0x08, 0xae, 0x62, 0x01,
-	0x13, 0x67, 0xb4, 0xa0, 0xf4, 0xf3, 0x72, 0xe0, 0x40, 0x05, 0x9e, 0x50,
-	0xf9, 0x64, 0xe5, 0x32, 0xa6, 0x95, 0x84, 0x2c, 0x55, 0x65, 0x1a, 0x5f,
-	0xdd, 0x73, 0x89, 0xf5, 0xf7, 0x35, 0xcd, 0xde, 0xa4, 0xa8, 0x66, 0x6b,
-	0x5a, 0x09, 0x90, 0x37, 0x82, 0x21, 0x54, 0xc2, 0x4a, 0xd9, 0x1c, 0x3b,
-	0x8a, 0xc1, 0x45, 0x5c, 0x9a, 0x00, 0x84, 0x10, 0xb6, 0x9a, 0xd0, 0x65,
-	0xab, 0xe3, 0xb5, 0xa2, 0xa9, 0x60, 0xa9, 0x34, 0x2f, 0x3a, 0xfe, 0x7d,
-	0xa6, 0x16, 0xf0, 0xaa, 0xd3, 0x02, 0x45, 0x1f, 0xb5, 0x1b, 0x49, 0xb8,
-	0x32, 0x8e, 0xaa, 0x01, 0x50, 0x02, 0x1e, 0x1c, 0x28, 0x7a, 0x31, 0x1a,
-	0xd3, 0x99, 0x56, 0x04, 0x52, 0x24, 0x49, 0x25, 0xd0, 0xc2, 0x54, 0xff,
-	0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x08, 0x08, 0xa7, 0x2c, 0xa7, 0xa4, 0x64,
-	0xc0, 0xd1, 0x09, 0x27, 0xb4, 0xc3, 0x0c, 0xac, 0x58, 0x9e, 0xcd, 0x48,
-	0x51, 0x64, 0x3d, 0x6b, 0xd4, 0x2e, 0x31, 0x20, 0xe8, 0x48, 0x3a, 0x65,
-	0x61, 0x40, 0x75, 0x89, 0x32, 0x35, 0xad, 0x30, 0x2e, 0xe6, 0x92, 0x37,
-	0x03, 0x56, 0x41, 0x3f, 0xd6, 0x67, 0x98, 0x11, 0xb9, 0x1c, 0x71, 0xc4,
-	0x51, 0x20, 0x01, 0x2b, 0x49, 0x64, 0xce, 0x1a, 0xad, 0xb4, 0x9c, 0xd0,
-	0x72, 0x44, 0x08, 0x3d, 0x1b, 0x67, 0xd9, 0x88, 0x7c, 0xad, 0x76, 0x43,
-	0x1d, 0xc4, 0x25, 0x2e, 0x84, 0x51, 0xb4, 0x6b, 0xd6, 0x04, 0x0f, 0x9c,
-	0xe2, 0xad, 0x20, 0xa6, 0xd4, 0x11, 0xa3, 0x42, 0x12, 0xaf, 0xcf, 0xff,
-	0xaa, 0x0b, 0x18, 0x03, 0x8a, 0x06, 0x34, 0x7e, 0x4e, 0xc2, 0x62, 0xae,
-	0x88, 0x55, 0x69, 0xe1, 0x8c, 0xb6, 0x31, 0x0a, 0x02, 0x36, 0xff, 0xfb,
-	0x20, 0xc4, 0xe4, 0x00, 0xc6, 0x18, 0x3d, 0x30, 0xa7, 0x84, 0xc4, 0x40,
-	0xe1, 0x0f, 0x65, 0xd4, 0xc1, 0x0d, 0xa8, 0xc5, 0x44, 0x86, 0x40, 0xf4,
-	0x2d, 0x58, 0xa7, 0xe4, 0xe4, 0x9b, 0x14, 0x16, 0x62, 0x31, 0xc2, 0xa0,
-	0x70, 0x2e, 0x6c, 0x78, 0xc7, 0xa0, 0x3a, 0xd4, 0x8d, 0x51, 0x8b, 0xaf,
-	0x16, 0x02, 0xd3, 0xeb, 0x1a, 0x88, 0x55, 0x70, 0x65, 0x65, 0x15, 0x75,
-	0x68, 0x1e, 0xab, 0xcb, 0xb3, 0xcc, 0x93, 0x83, 0x89, 0x29, 0xb2, 0x8a,
-	0x26, 0x46, 0x07, 0x16, 0x59, 0xbd, 0x01, 0x1f, 0xb9, 0x94, 0xa5, 0xf4,
-	0xc1, 0x96, 0xb8, 0x3c, 0xcd, 0x46, 0xd7, 0xb2, 0x0b, 0x0d, 0xd4, 0x91,
-	0x40, 0x8b, 0xdc, 0xa2, 0xc9, 0x7d, 0x2c, 0x35, 0xb9, 0x76, 0xea, 0x99,
-	0x46, 0x41, 0x55, 0x28, 0xa6, 0x63, 0x44, 0x18, 0x1c, 0x02, 0xbc, 0x54,
-	0xe0, 0x36, 0xde, 0xfe, 0xcc, 0xde, 0x81, 0x03, 0xff, 0xfb, 0x22, 0xc4,
-	0xe6, 0x00, 0x06, 0xb0, 0x3b, 0x53, 0xa7, 0x98, 0xa3, 0xf0, 0xf1, 0x8d,
-	0x26, 0x30, 0xf4, 0x8c, 0xb8, 0x19, 0x34, 0xf1, 0x8b, 0x46, 0xfa, 0x17,
-	0x60, 0x20, 0x98, 0x3c, 0x7e, 0x92, 0x12, 0x86, 0x40, 0x87, 0x0c, 0x95,
-	0x02, 0x06, 0x28, 0xec, 0x6a, 0x7b, 0x2f, 0xda, 0x8f, 0xec, 0xe9, 0x7b,
-	0x86, 0x08, 0x46, 0x0d, 0x03, 0x3b, 0x9a, 0x67, 0x2f, 0xd1, 0xa6, 0xe9,
-	0x77, 0x23, 0x72, 0x2b, 0x84, 0xa3, 0x21, 0x79, 0x71, 0x38, 0x1d, 0x85,
-	0xf1, 0x9d, 0x4b, 0x54, 0x29, 0xe2, 0x42, 0x5c, 0xac, 0xc0, 0x54, 0xac,
-	0xac, 0xee, 0x03, 0x5e, 0xb9, 0xc1, 0x63, 0x75, 0x93, 0x41, 0xc4, 0x86,
-	0x09, 0x1b, 0x02, 0xc0, 0x0c, 0x23, 0x88, 0xf9, 0x8e, 0xb0, 0x02, 0x05,
-	0x98, 0x02, 0x30, 0x2d, 0x8e, 0x88, 0x48, 0xa5, 0xc4, 0xf8, 0x72, 0xd4,
-	0x14, 0x2c, 0xa6, 0xc9, 0xd0, 0x52, 0x96, 0xff, 0xfb, 0x22, 0xc4, 0xe4,
-	0x00, 0x06, 0xb8, 0x6b, 0x41, 0xa4, 0x98, 0x65, 0xa0, 0xd3, 0x09, 0x66,
-	0xa4, 0xf1, 0x88, 0xb8, 0x26, 0xb2, 0x98, 0x29, 0xa8, 0xec, 0xfb, 0xd0,
-	0xa9, 0x67, 0xd8, 0x34, 0xa0, 0x9e, 0x6a, 0xb1, 0x85, 0x86, 0xe9, 0xd2,
-	0x91, 0x72, 0xd1, 0x73, 0x22, 0xc8, 0x15, 0x41, 0xca, 0x45, 0x1d, 0xf2,
-	0x4f, 0xb3, 0x18, 0x62, 0x20, 0x41, 0xc2, 0x56, 0xd5, 0x14, 0xf9, 0x4a,
-	0x22, 0x82, 0x99, 0x84, 0x04, 0x20, 0x8c, 0xbc, 0x41, 0xd0, 0x82, 0x2c,
-	0x2c, 0x20, 0x44, 0x2c, 0xfb, 0x5f, 0xf7, 0xd0, 0x8a, 0xf1, 0x0a, 0x87,
-	0x79, 0xf0, 0x19, 0x42, 0x1b, 0x8a, 0x67, 0xc5, 0x63, 0x0e, 0x3f, 0xa5,
-	0x65, 0xd7, 0xf5, 0xc5, 0x36, 0xbe, 0x19, 0x1b, 0x96, 0x24, 0x29, 0x42,
-	0xa9, 0x28, 0x56, 0x36, 0x4a, 0x7b, 0x59, 0xb3, 0xac, 0x3e, 0x4a, 0x7e,
-	0x16, 0x6a, 0xe9, 0xcf, 0x59, 0x81, 0xff, 0xfb, 0x20, 0xc4, 0xe5, 0x80,
-	0x06, 0xe0, 0x47, 0x2e, 0xa7, 0x98, 0x65, 0x40, 0xd7, 0x09, 0x29, 0x34,
-	0xf4, 0x98, 0x46, 0x21, 0xc1, 0xd8, 0xd9, 0x93, 0x97, 0x6f, 0x22, 0x99,
-	0x4b, 0x50, 0x85, 0x1e, 0x70, 0x03, 0xe2, 0xc7, 0x69, 0x4d, 0xe9, 0xda,
-	0x39, 0x16, 0x8a, 0xd1, 0xee, 0xdc, 0x9b, 0xb4, 0x82, 0xd1, 0x8e, 0x34,
-	0xa4, 0x00, 0x00, 0xf2, 0x04, 0x49, 0xc8, 0xf2, 0x43, 0xad, 0xaa, 0xcb,
-	0x22, 0x14, 0x9c, 0x01, 0xca, 0x2c, 0x85, 0x55, 0xc6, 0x26, 0xe3, 0x57,
-	0x90, 0xa0, 0x50, 0xca, 0x37, 0x52, 0x93, 0x56, 0x32, 0xad, 0x48, 0x76,
-	0x45, 0x1b, 0x44, 0x2a, 0x0f, 0x7f, 0x57, 0xad, 0xd9, 0xda, 0xfa, 0xba,
-	0x1d, 0xa9, 0x5d, 0x76, 0xa4, 0x62, 0x87, 0xd0, 0x86, 0x52, 0x35, 0x52,
-	0x2f, 0x71, 0x44, 0x3d, 0x35, 0x04, 0xa9, 0x62, 0x00, 0x14, 0x04, 0x04,
-	0x4f, 0xcf, 0x38, 0x30, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x82, 0x47, 0x18,
-	0x65, 0x2c, 0xac, 0x18, 0x65, 0x40, 0xde, 0x8f, 0x25, 0xd5, 0x83, 0x0c,
-	0xb0, 0xe3, 0xfa, 0xce, 0xc3, 0x12, 0x03, 0x2c, 0xb5, 0xbe, 0xf5, 0x62,
-	0xf5, 0x38, 0x04, 0x08, 0x70, 0xa3, 0x00, 0x0c, 0x2c, 0x1c, 0x44, 0xb8,
-	0x78, 0x10, 0x18, 0x71, 0x24, 0x04, 0x1b, 0x30, 0xbb, 0x71, 0x51, 0x74,
-	0x52, 0x87, 0x29, 0x57, 0x7d, 0x55, 0x4c, 0x35, 0x7b, 0x6d, 0xfe, 0xdf,
-	0xfd, 0xfc, 0xfa, 0xfa, 0xfd, 0xa3, 0x51, 0xa8, 0x14, 0x00, 0x49, 0xb2,
-	0x84, 0xb9, 0x20, 0xd5, 0x7b, 0xc3, 0xe5, 0x42, 0xbd, 0x3b, 0x6c, 0x6b,
-	0xb6, 0x9e, 0x03, 0x98, 0x40, 0x00, 0x0d, 0x00, 0xe6, 0x30, 0xa0, 0x1c,
-	0x20, 0x38, 0x38, 0x1e, 0xa5, 0x05, 0x27, 0x17, 0x0c, 0x14, 0x08, 0xa8,
-	0xdd, 0x94, 0x82, 0x02, 0x8a, 0xe9, 0x0f, 0xaa, 0x35, 0x9c, 0x96, 0x3e,
-	0xca, 0x1f, 0xa2, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x00, 0x06, 0x24, 0x31,
-	0x35, 0x27, 0xb1, 0x20, 0x00, 0xe6, 0x0f, 0x65, 0x01, 0x84, 0x8c, 0xa8,
-	0xb8, 0x8f, 0xf3, 0xa1, 0x09, 0x9c, 0x59, 0x5c, 0x70, 0x90, 0xd2, 0x7f,
-	0xd0, 0x8c, 0x7d, 0x09, 0x34, 0x5d, 0xc7, 0xb1, 0xdf, 0xfa, 0x94, 0x76,
-	0x86, 0x88, 0x76, 0x75, 0x49, 0x1c, 0x80, 0x00, 0x23, 0xb2, 0xca, 0xf3,
-	0x54, 0x8b, 0xdf, 0x18, 0x21, 0x9d, 0xbc, 0xa3, 0x06, 0x50, 0x5a, 0x76,
-	0x9d, 0xc9, 0x37, 0xdc, 0x0f, 0x17, 0x96, 0xd2, 0xf0, 0x2b, 0x9a, 0xa8,
-	0x2c, 0x57, 0x91, 0x09, 0xbf, 0x3f, 0x9f, 0x8f, 0x65, 0xf6, 0xe8, 0xff,
-	0xfb, 0x63, 0x25, 0x20, 0x83, 0x9c, 0x99, 0xc9, 0x5b, 0x55, 0x4a, 0x21,
-	0x04, 0x34, 0xd0, 0x02, 0x20, 0x28, 0x34, 0x0d, 0x00, 0x20, 0xa2, 0x76,
-	0x18, 0xc4, 0xcc, 0x80, 0x28, 0x74, 0x11, 0x0e, 0x87, 0x4c, 0xb9, 0x83,
-	0x03, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x00, 0x46, 0xdc, 0x79, 0x2e, 0xa7,
-	0x98, 0x45, 0x40, 0xcb, 0x8d, 0x25, 0xd4, 0xf3, 0x0c, 0xa8, 0x6e, 0x3a,
-	0xa7, 0x5c, 0xfd, 0x81, 0xa7, 0xdb, 0x35, 0x71, 0x52, 0x34, 0xfb, 0xb9,
-	0x1b, 0xb8, 0x54, 0x02, 0x5a, 0xfe, 0xf9, 0x5a, 0x3e, 0x07, 0xac, 0xc9,
-	0x42, 0x0c, 0x33, 0x14, 0xfd, 0x84, 0x93, 0x7a, 0x54, 0x11, 0x67, 0x48,
-	0x4a, 0x4c, 0x38, 0x3d, 0x03, 0x2e, 0xcb, 0x48, 0x49, 0x1b, 0x68, 0x4f,
-	0x8f, 0x05, 0x9a, 0xcb, 0x8c, 0xb8, 0xa9, 0x52, 0xbd, 0x07, 0x8f, 0x73,
-	0x66, 0xcb, 0xfb, 0x5c, 0xc8, 0xa3, 0x1f, 0x86, 0xaa, 0xc5, 0xfa, 0x13,
-	0xb3, 0xe8, 0xa3, 0xbc, 0x19, 0x14, 0x48, 0x70, 0x91, 0x9c, 0x42, 0x71,
-	0x80, 0x37, 0x03, 0x04, 0xa5, 0x8a, 0x22, 0x34, 0x89, 0x1a, 0x5f, 0x0e,
-	0x85, 0x59, 0xcf, 0x05, 0x9a, 0x59, 0xe7, 0x2d, 0x6a, 0x34, 0xa7, 0xec,
-	0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x06, 0xa4, 0x69, 0x31, 0x07, 0xb0,
-	0x61, 0xc1, 0x11, 0x18, 0xa6, 0xb0, 0xf4, 0x88, 0xb4, 0xda, 0xe6, 0x9d,
-	0x6e, 0x20, 0x44, 0x9b, 0x4e, 0x83, 0x4c, 0x50, 0x43, 0xd4, 0xaf, 0x1e,
-	0x27, 0xd2, 0x86, 0x7f, 0x34, 0xa9, 0x01, 0x7a, 0x05, 0x52, 0x53, 0x20,
-	0x23, 0xd0, 0x00, 0xe0, 0x44, 0x2c, 0xd8, 0x19, 0x32, 0x44, 0x20, 0xfa,
-	0xd4, 0xc9, 0x96, 0xb1, 0xc8, 0x9a, 0xb2, 0xbf, 0x20, 0x53, 0xd7, 0x02,
-	0xef, 0x9c, 0xdd, 0x77, 0x55, 0x02, 0xca, 0x38, 0xb0, 0x21, 0xc6, 0xfa,
-	0x6d, 0xf1, 0x2d, 0xfe, 0x17, 0xc7, 0xfb, 0xf0, 0xc9, 0x4a, 0x00, 0x06,
-	0x20, 0x42, 0x83, 0x0c, 0xb6, 0x50, 0xbb, 0x41, 0x20, 0x1d, 0x64, 0x88,
-	0x8a, 0x0c, 0xa4, 0x93, 0x27, 0x7c, 0x1e, 0x4d, 0x99, 0xf3, 0xf5, 0x4b,
-	0x9d, 0x52, 0x35, 0x10, 0x08, 0xb0, 0x88, 0x29, 0x74, 0xe1, 0x2f, 0xff,
-	0xfb, 0x20, 0xc4, 0xe1, 0x00, 0x06, 0xcc, 0x2d, 0x31, 0x34, 0xf3, 0x00,
-	0x01, 0x66, 0x1e, 0x6d, 0xf7, 0x1e, 0x50, 0x02, 0x06, 0xcd, 0x57, 0xb5,
-	0x49, 0x6b, 0x83, 0x7f, 0xff, 0xba, 0xea, 0x2a, 0x05, 0x59, 0x50, 0x00,
-	0x44, 0x90, 0x01, 0xca, 0x32, 0x53, 0xec, 0xb7, 0x7a, 0x9b, 0x8e, 0x7c,
-	0x03, 0x81, 0x1d, 0x24, 0x32, 0x02, 0x1c, 0xc2, 0x35, 0xb7, 0x52, 0x7e,
-	0x65, 0x21, 0x37, 0x92, 0xfc, 0xa4, 0x99, 0x99, 0x3f, 0x8a, 0x23, 0x49,
-	0x2e, 0x64, 0x56, 0xfa, 0x48, 0x84, 0x94, 0xa5, 0xab, 0xb7, 0xd1, 0xf5,
-	0xa6, 0xed, 0x96, 0xca, 0xaa, 0xd9, 0x80, 0xc4, 0x19, 0x5c, 0x57, 0x03,
-	0xe6, 0xed, 0x0f, 0xa2, 0x42, 0x82, 0x40, 0xb2, 0xf6, 0x85, 0xcb, 0x45,
-	0xef, 0xa4, 0x99, 0x14, 0x9f, 0x2e, 0x03, 0x7a, 0x8f, 0xae, 0x4d, 0x08,
-	0x1b, 0x42, 0x81, 0x04, 0xed, 0x42, 0xfe, 0x10, 0x74, 0xff, 0xfb, 0x22,
-	0xc4, 0xcf, 0x80, 0x06, 0xc8, 0x2f, 0x77, 0xfd, 0x86, 0x00, 0x38, 0xd5,
-	0x04, 0xec, 0x70, 0x54, 0x98, 0x16, 0xca, 0x78, 0xeb, 0xfb, 0x7a, 0x6e,
-	0x41, 0xfa, 0x01, 0x42, 0x01, 0xc8, 0x07, 0xf2, 0x4d, 0x20, 0xf4, 0x94,
-	0xcf, 0xa5, 0x05, 0xb0, 0x05, 0x43, 0xb3, 0x5f, 0xa2, 0xe7, 0x69, 0x54,
-	0x6d, 0x23, 0xd2, 0x18, 0x71, 0x09, 0x61, 0x77, 0xac, 0x4a, 0x65, 0xc2,
-	0xca, 0x12, 0xd2, 0xbd, 0x07, 0x59, 0x17, 0x67, 0xe2, 0xf4, 0x7a, 0x95,
-	0xd6, 0x36, 0x21, 0x08, 0x79, 0x5d, 0x3e, 0x2b, 0x00, 0x28, 0xca, 0x0c,
-	0x64, 0xe0, 0x83, 0x26, 0x08, 0x10, 0x59, 0x51, 0x44, 0xe3, 0x99, 0x9d,
-	0xac, 0x8a, 0x49, 0x92, 0x9c, 0xe9, 0x15, 0x5a, 0x5a, 0xba, 0x07, 0x89,
-	0x0a, 0xc3, 0x8d, 0xad, 0xa9, 0x37, 0xa6, 0x4d, 0x55, 0x8e, 0xda, 0xef,
-	0xd1, 0x71, 0xd9, 0x6d, 0x92, 0x36, 0xe2, 0x44, 0xff, 0xfb, 0x20, 0xc4,
-	0xd0, 0x80, 0x06, 0xf8, 0x95, 0x38, 0x07, 0x98, 0x4b, 0x80, 0xdb, 0x0a,
-	0xa7, 0x60, 0xf4, 0x98, 0x30, 0x00, 0xb9, 0x29, 0x19, 0x0b, 0xf1, 0xc4,
-	0xd0, 0x9b, 0xf5, 0x1e, 0xa2, 0x04, 0x41, 0x4a, 0xb1, 0x00, 0x94, 0xa4,
-	0xd4, 0xb1, 0x7a, 0x0c, 0x61, 0x62, 0x99, 0x66, 0xa1, 0xe8, 0xa2, 0x30,
-	0xf2, 0x01, 0xc6, 0x39, 0x09, 0xbf, 0xe3, 0x9f, 0xd3, 0x7e, 0xa0, 0x25,
-	0x61, 0x02, 0x0a, 0x94, 0x2c, 0xb2, 0x99, 0x87, 0x1b, 0x19, 0x85, 0x4f,
-	0x30, 0xd0, 0x92, 0x54, 0x54, 0x49, 0xda, 0xe8, 0x98, 0xfa, 0xd7, 0x89,
-	0x5b, 0x82, 0x2d, 0x60, 0x88, 0x7a, 0xdc, 0x55, 0x47, 0x89, 0xaa, 0x4b,
-	0xb1, 0xd3, 0x08, 0x70, 0x6d, 0xac, 0xd7, 0xec, 0xf7, 0x7e, 0xa5, 0x1f,
-	0x00, 0xe3, 0x3c, 0x1e, 0x36, 0x0d, 0x95, 0x10, 0xa4, 0x6e, 0x9d, 0x69,
-	0x15, 0x85, 0x10, 0x8d, 0x8c, 0x72, 0xff, 0xfb, 0x22, 0xc4, 0xcf, 0x80,
-	0x05, 0xf8, 0x2b, 0x3f, 0x84, 0x98, 0xc4, 0x88, 0xca, 0x09, 0x67, 0x24,
-	0xf3, 0x08, 0xb8, 0xf4, 0xa4, 0x3e, 0x9f, 0x00, 0x10, 0x1c, 0x3d, 0x37,
-	0x2f, 0x14, 0x60, 0x11, 0xcc, 0x72, 0xc3, 0xde, 0x92, 0x86, 0x48, 0x6a,
-	0x77, 0x75, 0xca, 0xfd, 0x35, 0x10, 0xb9, 0xe3, 0x00, 0x7b, 0x6c, 0x51,
-	0x16, 0x04, 0x2c, 0x9c, 0x20, 0x8a, 0x11, 0xc2, 0xb3, 0x54, 0x6c, 0x4d,
-	0x37, 0x92, 0x3a, 0xae, 0xb2, 0x45, 0x97, 0x9a, 0x98, 0xd7, 0xee, 0xb1,
-	0x45, 0xd1, 0x72, 0xc9, 0x9d, 0x74, 0x7b, 0x1f, 0x68, 0x6a, 0xf1, 0xed,
-	0xde, 0x97, 0xec, 0x4a, 0xd2, 0x9a, 0x25, 0x52, 0x9a, 0xf7, 0x6a, 0x22,
-	0x87, 0x83, 0x2a, 0x01, 0x56, 0x00, 0x04, 0x16, 0x03, 0x25, 0x12, 0x71,
-	0x85, 0x0f, 0x34, 0x9c, 0xd2, 0x0a, 0xa4, 0x16, 0x0a, 0x48, 0xdd, 0x20,
-	0x61, 0x35, 0x14, 0x93, 0xb4, 0xff, 0xfb, 0x22, 0xc4, 0xd5, 0x00, 0x06,
-	0x84, 0x69, 0x35, 0x07, 0x98, 0x69, 0x80, 0xd1, 0x86, 0x2a, 0x70, 0xb6,
-	0x24, 0x0e, 0xdb, 0x90, 0xd7, 0x04, 0x38, 0xf9, 0xd2, 0x93, 0xcd, 0x50,
-	0xb0, 0x54, 0x68, 0x01, 0xe1, 0x41, 0x2a, 0x7d, 0x42, 0x55, 0x14, 0x87,
-	0x42, 0x5a, 0xd9, 0x5c, 0xef, 0xdf, 0xad, 0x7a, 0xaa, 0x58, 0x2b, 0x18,
-	0x88, 0x61, 0x62, 0x1b, 0x64, 0xa1, 0x68, 0xd8, 0x29, 0x8f, 0x3c, 0x94,
-	0x98, 0x21, 0x0b, 0x3e, 0x21, 0x0e, 0x7a, 0x79, 0x3a, 0xf5, 0xd0, 0x9b,
-	0x63, 0xe9, 0x71, 0xb7, 0xb4, 0x51, 0xc3, 0x9c, 0xe1, 0x00, 0x7c, 0x40,
-	0x9a, 0x9d, 0x71, 0x65, 0x5a, 0x7f, 0x5a, 0x1c, 0xd4, 0x14, 0xd4, 0x4c,
-	0xd5, 0xff, 0x97, 0x5a, 0x6e, 0x49, 0x24, 0x8d, 0xdd, 0x52, 0x81, 0x01,
-	0x10, 0x84, 0x67, 0x41, 0x6d, 0x41, 0x02, 0x42, 0x70, 0x68, 0x49, 0x2b,
-	0xb6, 0x9a, 0x5a, 0xc6, 0xff, 0xfb, 0x20, 0xc4, 0xd7, 0x80, 0x05, 0xdc,
-	0x33, 0x34, 0xa7, 0x84, 0xc4, 0x00, 0xc0, 0x0c, 0xe6, 0x95, 0x83, 0x0c,
-	0x98, 0xb4, 0x94, 0xe9, 0x11, 0x47, 0x99, 0x48, 0x05, 0x79, 0x54, 0x14,
-	0xb5, 0xd6, 0xa8, 0x56, 0x28, 0x1d, 0x24, 0x9a, 0xd0, 0x74, 0xc1, 0x67,
-	0xd5, 0x38, 0x4b, 0xc9, 0x68, 0x24, 0x48, 0xc5, 0x22, 0x7f, 0xca, 0x53,
-	0x54, 0x01, 0xf8, 0x1a, 0x2c, 0x87, 0xca, 0xfb, 0xc6, 0x71, 0x36, 0x57,
-	0x70, 0x68, 0x1f, 0x44, 0x6f, 0x8e, 0x24, 0xdc, 0x49, 0xee, 0xb0, 0x8f,
-	0x57, 0x87, 0x1e, 0xce, 0xc1, 0xf3, 0x10, 0xa8, 0x2c, 0xb8, 0x28, 0x23,
-	0x18, 0x13, 0x53, 0xc6, 0x3c, 0x88, 0xc4, 0x0d, 0x2e, 0x93, 0x95, 0xa7,
-	0x2e, 0x07, 0x67, 0xa6, 0x9a, 0x48, 0xb0, 0xc9, 0xa4, 0x33, 0x71, 0x73,
-	0x65, 0xa0, 0xb2, 0xd4, 0x00, 0x10, 0x84, 0x96, 0xd8, 0x53, 0x44, 0x7a,
-	0x84, 0x58, 0xff, 0xfb, 0x22, 0xc4, 0xde, 0x80, 0x06, 0x10, 0x47, 0x55,
-	0xa7, 0x98, 0x64, 0xf0, 0xc0, 0x07, 0xe6, 0xa0, 0xfc, 0x18, 0x40, 0x80,
-	0x20, 0x60, 0x30, 0x86, 0xb4, 0x89, 0x19, 0x40, 0x02, 0x4b, 0xa8, 0x5c,
-	0x1c, 0x74, 0xb0, 0x0c, 0xbc, 0xf4, 0x02, 0x40, 0x51, 0xd5, 0xb7, 0x4d,
-	0xf5, 0x7f, 0x44, 0x7a, 0x1d, 0x48, 0xc1, 0xc4, 0x8c, 0xd8, 0x61, 0x4b,
-	0x1a, 0x52, 0xcc, 0x57, 0x6c, 0x3e, 0x63, 0x09, 0xaf, 0xdf, 0x65, 0x0b,
-	0x2d, 0xf3, 0x64, 0x71, 0xbf, 0xc7, 0x32, 0x5f, 0xd6, 0xd9, 0x75, 0x20,
-	0x12, 0xc4, 0x54, 0x58, 0x2a, 0x0a, 0xa2, 0x15, 0x50, 0x0c, 0x50, 0x2a,
-	0x81, 0xe9, 0x51, 0x3b, 0x66, 0x34, 0x0e, 0xa5, 0x9a, 0x96, 0x05, 0x7d,
-	0x5d, 0x84, 0x64, 0x7c, 0x9c, 0xa6, 0x03, 0x0f, 0xba, 0x2e, 0xb2, 0xe4,
-	0xa9, 0x0d, 0xc2, 0xae, 0x68, 0xca, 0x5b, 0xb5, 0x55, 0x54, 0x5c, 0x18,
-	0x6b, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x00, 0x06, 0x08, 0x3f, 0x34, 0xac,
-	0x18, 0x65, 0x40, 0xdb, 0x08, 0xa6, 0xa4, 0xf4, 0x8c, 0xb0, 0xf2, 0xdc,
-	0xb4, 0xff, 0xd2, 0xa0, 0x7a, 0x19, 0x7f, 0xdc, 0xa3, 0xa1, 0x96, 0x7f,
-	0xc8, 0x72, 0x0b, 0xb8, 0xa4, 0xb0, 0x96, 0xf5, 0xbf, 0x14, 0xbf, 0x5c,
-	0x75, 0x6b, 0x6a, 0x00, 0xdf, 0x00, 0x18, 0x63, 0x09, 0xe9, 0xca, 0x6c,
-	0x13, 0x87, 0x67, 0x1a, 0xa2, 0x68, 0x48, 0xc9, 0x84, 0xa3, 0x42, 0x8f,
-	0x7a, 0x8d, 0x77, 0xbd, 0xe1, 0xc6, 0x82, 0x21, 0x20, 0x8b, 0xc4, 0x11,
-	0x43, 0x12, 0xef, 0x28, 0xe8, 0x9c, 0x0e, 0xe1, 0x8b, 0x88, 0xc6, 0x1a,
-	0x5b, 0x49, 0x81, 0xc5, 0xfd, 0xad, 0x30, 0xcd, 0x8c, 0xd0, 0x8f, 0x4a,
-	0x55, 0x56, 0x68, 0x76, 0x67, 0x78, 0x6b, 0xac, 0x91, 0xc0, 0x05, 0x01,
-	0x50, 0x22, 0xa0, 0x84, 0xf0, 0x25, 0x56, 0x40, 0x59, 0xc9, 0x0a, 0x5a,
-	0xff, 0xfb, 0x20, 0xc4, 0xe8, 0x80, 0x07, 0x34, 0x43, 0x31, 0x07, 0xa4,
-	0xc2, 0xc0, 0xd8, 0x08, 0xa6, 0x60, 0xf6, 0x18, 0x00, 0x72, 0x72, 0x26,
-	0x3a, 0x27, 0x94, 0x0d, 0x1b, 0x60, 0x98, 0x02, 0x74, 0xc1, 0xd1, 0xab,
-	0x95, 0x00, 0x92, 0x14, 0xc5, 0xfd, 0x55, 0x3b, 0xab, 0x70, 0x6a, 0xb5,
-	0xaf, 0xff, 0x2b, 0x2f, 0xc7, 0x2f, 0xf1, 0x30, 0x5a, 0x6e, 0x2c, 0x57,
-	0x8f, 0x7a, 0x52, 0x04, 0xd0, 0x01, 0xb3, 0xcd, 0x91, 0x1e, 0xad, 0x26,
-	0xc8, 0xe0, 0x58, 0x4a, 0x38, 0x5d, 0x3a, 0x7e, 0x69, 0xc2, 0x26, 0x50,
-	0xc0, 0xce, 0x02, 0xa5, 0x82, 0x4d, 0xf8, 0xa8, 0x55, 0x6e, 0x78, 0x38,
-	0xd5, 0x06, 0x6e, 0xde, 0x67, 0x71, 0x4c, 0x32, 0xe5, 0x4f, 0x8a, 0xed,
-	0x02, 0x56, 0x41, 0x00, 0x08, 0x06, 0xe8, 0x63, 0x9d, 0x07, 0x21, 0xc5,
-	0x9e, 0xe4, 0x56, 0x20, 0xe4, 0x20, 0xc3, 0x99, 0xa0, 0xc3, 0xff, 0xfb,
-	0x22, 0xc4, 0xe7, 0x00, 0x06, 0xec, 0x2b, 0x4d, 0x87, 0xa4, 0xc0, 0x70,
-	0xe0, 0x8b, 0x26, 0xe4, 0xf4, 0x8c, 0x98, 0x42, 0x1e, 0x0b, 0x58, 0x30,
-	0x0a, 0x21, 0x2e, 0x53, 0x96, 0x64, 0xb8, 0x3e, 0x3a, 0x03, 0x48, 0xaf,
-	0x69, 0x74, 0xac, 0x98, 0xc4, 0xaa, 0x58, 0x9d, 0x98, 0x1f, 0x7f, 0xfb,
-	0x04, 0x0e, 0x0c, 0x8f, 0x05, 0xcb, 0x1d, 0x8c, 0xa8, 0x93, 0x51, 0x00,
-	0xb8, 0x3e, 0x20, 0x19, 0x15, 0xbd, 0x1c, 0xcb, 0xa3, 0x07, 0xad, 0x12,
-	0x52, 0xd9, 0x3d, 0x67, 0xc9, 0xa3, 0x6d, 0x26, 0x44, 0xa8, 0x3a, 0xf4,
-	0x8e, 0x52, 0x8f, 0xd8, 0x58, 0x0a, 0xf7, 0x09, 0x44, 0xbf, 0x73, 0x00,
-	0x24, 0xab, 0xe2, 0xdd, 0xae, 0x6f, 0x73, 0x15, 0xf2, 0xca, 0x17, 0xb7,
-	0x52, 0x95, 0x18, 0x05, 0x3c, 0x1a, 0x8f, 0x0b, 0xba, 0x4e, 0xe9, 0xc6,
-	0xb8, 0xc1, 0xc7, 0x00, 0x49, 0x99, 0xac, 0xc6, 0x1a, 0xff, 0xfb, 0x20,
-	0xc4, 0xe6, 0x03, 0xc6, 0x74, 0x3b, 0x2e, 0x0c, 0x04, 0xc4, 0x40, 0xd8,
-	0x0c, 0x65, 0xc1, 0x84, 0x8c, 0xa8, 0x94, 0xad, 0xae, 0xfa, 0x05, 0xed,
-	0xe2, 0xe7, 0x71, 0xef, 0x24, 0x97, 0xd4, 0x42, 0x86, 0x52, 0xf1, 0x52,
-	0xe4, 0x70, 0x13, 0xa2, 0x60, 0xb0, 0xd2, 0xef, 0x16, 0x9e, 0xb1, 0xb9,
-	0x7f, 0xdf, 0xbf, 0x19, 0x51, 0x77, 0xdf, 0x96, 0xca, 0x20, 0x80, 0x08,
-	0x98, 0x8f, 0xe5, 0x23, 0xd1, 0xb4, 0x25, 0x26, 0x4c, 0x1c, 0x5e, 0x6b,
-	0x49, 0x87, 0x62, 0x49, 0xd3, 0x61, 0x3b, 0x38, 0x41, 0x5c, 0x10, 0xf0,
-	0x54, 0x6d, 0xc0, 0xa3, 0x0c, 0x5b, 0x98, 0x54, 0xe3, 0xa5, 0xac, 0x4b,
-	0x73, 0x7d, 0x1f, 0xfd, 0x36, 0xae, 0x3b, 0xeb, 0x77, 0xde, 0x39, 0x59,
-	0x66, 0x00, 0xc4, 0x83, 0x43, 0x8f, 0x22, 0x4c, 0x74, 0xd4, 0x9e, 0xb1,
-	0xe3, 0xc3, 0xa0, 0x20, 0x9a, 0x69, 0x63, 0xff, 0xfb, 0x22, 0xc4, 0xe7,
-	0x80, 0x46, 0xc8, 0x9d, 0x2e, 0x0c, 0x24, 0x65, 0x80, 0xe4, 0x07, 0xa6,
-	0x20, 0xf4, 0x8c, 0xe0, 0xd5, 0xb2, 0x53, 0x3b, 0x53, 0xa6, 0xc2, 0xa0,
-	0x5e, 0xaa, 0xf3, 0xdb, 0xf2, 0xbc, 0x14, 0x61, 0x40, 0xc9, 0xf7, 0x15,
-	0x3b, 0xb9, 0xd3, 0x8e, 0x6b, 0x86, 0x07, 0x45, 0x8e, 0xc2, 0x41, 0xe8,
-	0xaa, 0xb6, 0x73, 0x1a, 0xcd, 0x14, 0xbc, 0x58, 0x98, 0x6c, 0xc7, 0x6c,
-	0x96, 0x57, 0x1b, 0x61, 0x20, 0x00, 0xad, 0x08, 0x7b, 0x1e, 0x48, 0x67,
-	0xea, 0xe9, 0x14, 0xd1, 0x98, 0x19, 0x7a, 0x0e, 0x82, 0x9e, 0x81, 0x5a,
-	0x19, 0xde, 0xf1, 0xe2, 0xb9, 0x53, 0x44, 0x33, 0x2e, 0x17, 0xa9, 0x3b,
-	0x29, 0x88, 0xdc, 0xa7, 0x85, 0x9b, 0xf9, 0x0c, 0x2c, 0x33, 0x88, 0x13,
-	0x51, 0x07, 0xdc, 0x32, 0x21, 0x8b, 0xd5, 0x22, 0x66, 0x81, 0x44, 0x08,
-	0x09, 0xa0, 0x94, 0x54, 0x1b, 0xaa, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80,
-	0x06, 0xe4, 0x31, 0x63, 0xe6, 0x24, 0xc0, 0xb0, 0xdb, 0x8c, 0xe6, 0x01,
-	0x83, 0x0c, 0xa8, 0x67, 0xc4, 0x21, 0x46, 0x94, 0x80, 0xe3, 0x5e, 0x8c,
-	0xc0, 0x93, 0xc9, 0x9a, 0x89, 0x09, 0x3c, 0xa2, 0x89, 0x11, 0x0b, 0x86,
-	0x24, 0x81, 0xf0, 0x01, 0x02, 0xe5, 0xca, 0x07, 0x54, 0x34, 0xfe, 0x76,
-	0x2e, 0x5f, 0xa0, 0x76, 0xfe, 0xff, 0xe9, 0xa4, 0x59, 0x84, 0xcb, 0x3d,
-	0x43, 0x40, 0x59, 0x5a, 0x80, 0x03, 0x88, 0x0d, 0x35, 0xb3, 0x74, 0x9c,
-	0x62, 0x38, 0x9a, 0x85, 0xd1, 0x8e, 0x98, 0x35, 0xad, 0xc4, 0xa1, 0xa4,
-	0x92, 0xfe, 0xb1, 0x00, 0xa7, 0x8b, 0x4d, 0x89, 0x7c, 0x5a, 0xa0, 0x28,
-	0x4c, 0xba, 0x06, 0x8b, 0x86, 0x9c, 0x6d, 0x22, 0x35, 0x8d, 0x0c, 0x07,
-	0xf2, 0xae, 0x73, 0x90, 0x05, 0x61, 0x51, 0xc7, 0x7e, 0xcf, 0xea, 0x72,
-	0x5b, 0x65, 0x91, 0xff, 0xb2, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06,
-	0xe0, 0x37, 0x33, 0x27, 0xb0, 0x60, 0x80, 0xd5, 0x85, 0xa7, 0xf4, 0xc4,
-	0xa4, 0x00, 0x81, 0x14, 0x1e, 0x41, 0x10, 0x58, 0x34, 0x7d, 0xe5, 0xd8,
-	0x59, 0x78, 0x2c, 0x08, 0x85, 0xc7, 0x26, 0x9c, 0x16, 0x2d, 0xa4, 0x9c,
-	0xed, 0x14, 0xc8, 0xbf, 0xe9, 0xa4, 0xe0, 0x8a, 0x39, 0x99, 0x63, 0xac,
-	0xad, 0x95, 0x6e, 0x68, 0xc4, 0xe8, 0x79, 0x09, 0xa2, 0x5f, 0xb1, 0xdf,
-	0x76, 0xd0, 0x25, 0x78, 0x35, 0xc6, 0x74, 0x34, 0xd1, 0x81, 0xe0, 0x9d,
-	0xf5, 0xd9, 0xda, 0x59, 0x82, 0x1c, 0xaa, 0x32, 0xb9, 0x2b, 0x08, 0x86,
-	0x9d, 0xd1, 0x45, 0xcd, 0x6a, 0x06, 0x1d, 0x91, 0xb4, 0xa2, 0x2b, 0x52,
-	0x77, 0xa3, 0x66, 0x64, 0x5a, 0xd2, 0x87, 0x5b, 0xfa, 0xeb, 0xa8, 0xf0,
-	0xf7, 0xae, 0x8a, 0xff, 0x63, 0xfb, 0x4d, 0x2a, 0x19, 0xaa, 0x61, 0x90,
-	0x68, 0x0f, 0x03, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x07, 0x34, 0x65,
-	0x35, 0x27, 0x98, 0x47, 0xc0, 0xc4, 0x89, 0xa6, 0xe4, 0xc3, 0x08, 0xb0,
-	0xa2, 0xa0, 0xe9, 0x18, 0xad, 0xdc, 0x9c, 0xeb, 0x92, 0x22, 0x34, 0x2b,
-	0xd4, 0x49, 0x2e, 0x6a, 0xaa, 0xaa, 0x12, 0x37, 0x40, 0x29, 0xd4, 0xa4,
-	0x9d, 0xb6, 0xfd, 0x28, 0x18, 0x08, 0x2d, 0xb7, 0x67, 0xa6, 0x44, 0x05,
-	0xbb, 0xc6, 0xf7, 0x54, 0x42, 0x3e, 0xeb, 0xd7, 0x20, 0x12, 0x8d, 0x28,
-	0x99, 0x36, 0x6a, 0x07, 0x04, 0x86, 0xc5, 0x42, 0x23, 0x40, 0xe0, 0x93,
-	0x02, 0x13, 0x48, 0x82, 0x0f, 0xb9, 0x85, 0xe9, 0x48, 0x2d, 0x9f, 0xb2,
-	0xdc, 0x6d, 0xf4, 0x17, 0x13, 0xaa, 0xe0, 0x71, 0xcc, 0x71, 0xe1, 0xc7,
-	0x1e, 0xeb, 0x2b, 0x7f, 0x76, 0xad, 0x0a, 0x6f, 0x7f, 0xda, 0xed, 0xea,
-	0x32, 0xbe, 0xa9, 0x95, 0x28, 0x1a, 0xc3, 0x41, 0xcd, 0xe2, 0x26, 0x60,
-	0xf1, 0xa0, 0xff, 0xfb, 0x20, 0xc4, 0xe8, 0x00, 0x08, 0x58, 0x65, 0x43,
-	0xa7, 0xa4, 0x65, 0xa0, 0xe1, 0x8d, 0x68, 0x34, 0xc4, 0x8c, 0xe4, 0x43,
-	0xec, 0x10, 0x4c, 0x73, 0x65, 0x22, 0x5a, 0xf1, 0xb2, 0x3a, 0xcb, 0xc0,
-	0x48, 0x92, 0x19, 0x0a, 0x38, 0x44, 0xe0, 0x19, 0x36, 0xaa, 0x5d, 0xd4,
-	0x50, 0x1b, 0x79, 0xdb, 0xbf, 0x8f, 0x7f, 0x4d, 0x14, 0x12, 0x9a, 0xee,
-	0x02, 0xab, 0xaa, 0xd5, 0x50, 0x00, 0x40, 0x3a, 0xf8, 0xf2, 0x3a, 0x55,
-	0xeb, 0xb3, 0xd4, 0x49, 0x63, 0xd3, 0xeb, 0x57, 0x00, 0x85, 0xa8, 0xca,
-	0x95, 0x3b, 0x42, 0x3b, 0xe6, 0xcb, 0xf9, 0xdb, 0xeb, 0x7f, 0xf6, 0xfb,
-	0xb5, 0x16, 0x36, 0x3a, 0xd6, 0x65, 0xc3, 0x4e, 0x88, 0xd8, 0x80, 0x2b,
-	0x35, 0x29, 0xab, 0x1c, 0xcf, 0xaa, 0x00, 0xdb, 0xad, 0xbb, 0x69, 0x6e,
-	0xdb, 0x67, 0xac, 0xb5, 0x00, 0x80, 0x00, 0x02, 0x8b, 0x87, 0x8b, 0x4c,
-	0xff, 0xfb, 0x22, 0xc4, 0xe0, 0x80, 0x07, 0x28, 0x47, 0x33, 0x27, 0x98,
-	0x65, 0x40, 0xe7, 0x08, 0x66, 0x60, 0xf4, 0x98, 0x60, 0xd7, 0x1e, 0x2d,
-	0x82, 0x16, 0xc0, 0xe3, 0xda, 0xf3, 0xc0, 0x42, 0x04, 0x14, 0x27, 0xc8,
-	0x12, 0x08, 0x9d, 0xa3, 0x54, 0xc1, 0xf0, 0x13, 0xcb, 0x8e, 0xbd, 0xbb,
-	0x65, 0xb9, 0x42, 0x04, 0x82, 0xcb, 0x95, 0xde, 0xdb, 0xb7, 0x9a, 0x6f,
-	0x56, 0x13, 0x2b, 0xbe, 0x19, 0x0c, 0x73, 0x79, 0x3f, 0x4b, 0xfb, 0x8d,
-	0x3e, 0xab, 0xff, 0xae, 0xdf, 0x32, 0xf2, 0xc8, 0x63, 0xff, 0xff, 0xff,
-	0xff, 0xff, 0xde, 0xf7, 0x9c, 0xf3, 0x9f, 0xfe, 0x27, 0x7c, 0xca, 0xbb,
-	0x3c, 0x33, 0x3b, 0x3b, 0xbb, 0xc3, 0x3f, 0xff, 0xef, 0xb8, 0xf8, 0x50,
-	0x00, 0x03, 0xc1, 0x76, 0x0f, 0xb4, 0xe5, 0xa6, 0x7e, 0xa8, 0x91, 0xfb,
-	0xf4, 0xeb, 0x42, 0xc4, 0x26, 0x06, 0x37, 0x82, 0xe2, 0x32, 0x8a, 0xff,
-	0xfb, 0x22, 0xc4, 0xde, 0x00, 0x06, 0xb0, 0x69, 0x51, 0x86, 0x18, 0x4a,
-	0xb0, 0xd6, 0x94, 0xa6, 0x61, 0x84, 0x94, 0x38, 0x21, 0xc0, 0x42, 0x81,
-	0xe0, 0x74, 0x58, 0x58, 0xf1, 0x19, 0x8b, 0x30, 0x93, 0x4f, 0xa6, 0x43,
-	0x89, 0x15, 0xa1, 0xce, 0x3c, 0xe1, 0x33, 0x3a, 0xab, 0x47, 0xc6, 0x3f,
-	0x57, 0x82, 0x7f, 0xf6, 0xff, 0x9d, 0x64, 0x65, 0x77, 0xcf, 0x69, 0x57,
-	0xff, 0xff, 0x26, 0xdb, 0xa5, 0x3a, 0xa6, 0x30, 0x7f, 0xf3, 0x0f, 0x25,
-	0x22, 0x15, 0x64, 0x04, 0xa2, 0xb2, 0x01, 0x42, 0xaa, 0x47, 0x8f, 0xd3,
-	0x0d, 0x4c, 0x1d, 0x2d, 0x6c, 0xb5, 0xc5, 0xd5, 0xc5, 0x65, 0x90, 0x09,
-	0x94, 0x31, 0xf1, 0x23, 0xf4, 0x5b, 0x1b, 0xb5, 0x0b, 0x95, 0x36, 0xab,
-	0x3a, 0x4b, 0xa3, 0xae, 0x6f, 0xff, 0x97, 0xd5, 0x8b, 0x15, 0x2c, 0xe1,
-	0x10, 0xd7, 0x5d, 0x8d, 0x77, 0x3d, 0x6d, 0xfb, 0x28, 0x45, 0xff, 0xfb,
-	0x20, 0xc4, 0xdf, 0x00, 0x06, 0x7c, 0x67, 0x37, 0x24, 0x98, 0x69, 0x00,
-	0xcc, 0x87, 0x67, 0x70, 0xb4, 0x98, 0x08, 0x04, 0xa9, 0x9d, 0x0c, 0x1f,
-	0xa6, 0x2a, 0x28, 0x78, 0xaf, 0xb1, 0x15, 0x4e, 0x0b, 0x03, 0x40, 0xbc,
-	0xab, 0x5a, 0x8f, 0x3e, 0xe3, 0x96, 0x04, 0xc3, 0x21, 0x58, 0xce, 0x0d,
-	0x9c, 0xad, 0xf8, 0x51, 0xd2, 0x1d, 0x60, 0x7c, 0x62, 0x5a, 0xdb, 0x5f,
-	0xd2, 0xcb, 0xe6, 0x1a, 0x06, 0x2c, 0xfb, 0xbb, 0xec, 0x0a, 0xff, 0xf3,
-	0x35, 0x35, 0x0a, 0x0a, 0x40, 0x02, 0x92, 0x81, 0x33, 0x38, 0x15, 0x68,
-	0x50, 0xeb, 0x56, 0x96, 0x71, 0x57, 0x0d, 0x97, 0x54, 0x75, 0x1c, 0x69,
-	0xef, 0x70, 0xec, 0x1d, 0x29, 0xa5, 0x05, 0xd8, 0xb5, 0x45, 0x62, 0x2d,
-	0x8c, 0xf8, 0x76, 0x5b, 0xa7, 0x79, 0x92, 0x25, 0x42, 0xa9, 0x0c, 0x5b,
-	0x7d, 0x3a, 0x9d, 0x58, 0x94, 0x08, 0x03, 0x55, 0xff, 0xfb, 0x22, 0xc4,
-	0xe2, 0x00, 0x06, 0x60, 0x43, 0x37, 0x27, 0x98, 0x65, 0x40, 0xd7, 0x0c,
-	0xe6, 0xe6, 0x98, 0x60, 0x00, 0x9b, 0xf6, 0x3b, 0xea, 0xd2, 0x01, 0x1b,
-	0xfb, 0xb0, 0x03, 0x75, 0x12, 0xb8, 0x2f, 0x47, 0xfc, 0x62, 0xf0, 0x7f,
-	0x0f, 0x14, 0x58, 0xd7, 0x71, 0x2c, 0x11, 0xd4, 0x52, 0xaf, 0xaf, 0x85,
-	0xcf, 0x2a, 0x94, 0xb4, 0x2a, 0x10, 0x5d, 0x31, 0xb1, 0x22, 0xa6, 0x4f,
-	0x9b, 0x83, 0x39, 0x4a, 0x35, 0x6c, 0x4c, 0x81, 0xc8, 0x32, 0x9f, 0x35,
-	0x39, 0x9d, 0xb1, 0x45, 0x52, 0x3a, 0x9d, 0x56, 0x35, 0x2a, 0xf7, 0xe5,
-	0xbe, 0x10, 0x92, 0x00, 0x69, 0xca, 0x89, 0x9c, 0x7c, 0x91, 0xf5, 0x8f,
-	0x2c, 0x18, 0x34, 0x6c, 0x5a, 0x0c, 0x10, 0x88, 0x5c, 0xb1, 0xae, 0xfa,
-	0x7d, 0x24, 0x55, 0x79, 0x87, 0x41, 0xf6, 0x16, 0x9b, 0x13, 0x09, 0xa3,
-	0x54, 0x63, 0xc9, 0xe9, 0x6c, 0x49, 0x4e, 0xff, 0xfb, 0x22, 0xc4, 0xe4,
-	0x80, 0x0b, 0x54, 0xf9, 0x47, 0xb8, 0xc5, 0x80, 0x01, 0x61, 0x9b, 0xb0,
-	0x3f, 0x1e, 0x80, 0x02, 0x88, 0x76, 0x1d, 0x04, 0xb4, 0x8d, 0x55, 0xa3,
-	0x23, 0x71, 0xe0, 0x0e, 0x96, 0x8e, 0xa1, 0xb0, 0xd0, 0xb4, 0xeb, 0x49,
-	0x49, 0x9a, 0x22, 0xd2, 0x53, 0x92, 0x22, 0x38, 0x76, 0x35, 0x08, 0x3c,
-	0x54, 0x71, 0x73, 0x23, 0xad, 0xaa, 0xe5, 0x69, 0xda, 0xc3, 0x8d, 0xf7,
-	0xb1, 0x28, 0xbf, 0x96, 0xda, 0xe8, 0x53, 0xef, 0x72, 0x35, 0x37, 0x6c,
-	0xfe, 0x7a, 0xdc, 0x8f, 0xff, 0x3c, 0xf7, 0xff, 0x7b, 0xae, 0xbf, 0x74,
-	0x6c, 0x4d, 0xfe, 0x0c, 0x7b, 0xee, 0xef, 0x59, 0xb6, 0xf6, 0xeb, 0xb5,
-	0xff, 0x5f, 0xb6, 0xdb, 0xe1, 0x60, 0x01, 0x0a, 0x56, 0x64, 0x78, 0x1d,
-	0xb7, 0x1a, 0x20, 0x89, 0xc2, 0x75, 0x1b, 0x40, 0x89, 0x31, 0xa1, 0x81,
-	0x45, 0x24, 0x50, 0xa6, 0x2a, 0xd9, 0xff, 0xfb, 0x20, 0xc4, 0xc2, 0x00,
-	0x07, 0x40, 0xad, 0x4b, 0xbc, 0xc2, 0x80, 0x00, 0xd9, 0x8a, 0xa7, 0x00,
-	0xf6, 0x19, 0x10, 0x03, 0xc0, 0xfa, 0xad, 0x01, 0xc8, 0xa7, 0x74, 0xc5,
-	0x44, 0xf9, 0x22, 0x28, 0x88, 0x37, 0x0f, 0xd0, 0xc0, 0xfc, 0xf6, 0x16,
-	0x91, 0x86, 0x7f, 0x3d, 0xa1, 0x9f, 0x96, 0xab, 0x3c, 0x0e, 0xf6, 0xbf,
-	0x5b, 0xb7, 0xbf, 0xce, 0x67, 0x6f, 0xef, 0x96, 0xfd, 0xb8, 0xff, 0xf9,
-	0xb9, 0x36, 0x43, 0x6b, 0x2d, 0xf4, 0x7c, 0x92, 0x86, 0x66, 0x85, 0x56,
-	0x54, 0x56, 0xe5, 0x71, 0x30, 0x1c, 0x10, 0x8a, 0x2f, 0x12, 0x55, 0x62,
-	0xfb, 0x8c, 0x44, 0xa2, 0xe5, 0xee, 0xe8, 0xaa, 0x8a, 0xe5, 0x20, 0x12,
-	0x93, 0x1c, 0x38, 0x1d, 0xd5, 0x56, 0xc3, 0xe2, 0xad, 0x0a, 0x12, 0xa0,
-	0xe9, 0x85, 0x1b, 0x95, 0x54, 0x8f, 0xc5, 0x01, 0xad, 0xaf, 0x01, 0x7a,
-	0xff, 0x7f, 0xbb, 0x3c, 0xff, 0xfb, 0x22, 0xc4, 0xc0, 0x00, 0x07, 0x7c,
-	0x63, 0x3f, 0x94, 0xf4, 0x00, 0x01, 0x61, 0x93, 0x67, 0x57, 0x1e, 0x90,
-	0x00, 0x85, 0x92, 0x6e, 0x82, 0x00, 0x00, 0x21, 0x00, 0x34, 0xa1, 0x31,
-	0x83, 0x98, 0xf0, 0x65, 0x9d, 0x89, 0x9d, 0xa8, 0x9b, 0x03, 0x84, 0x16,
-	0x2b, 0x4e, 0xa3, 0x8c, 0xac, 0x49, 0x7a, 0x5b, 0xec, 0x63, 0xa7, 0xbf,
-	0x36, 0xb6, 0x72, 0x53, 0x86, 0xe9, 0xea, 0x88, 0x9a, 0x1e, 0x93, 0x26,
-	0x48, 0x5f, 0xb0, 0xb1, 0x43, 0xcb, 0xa0, 0x3a, 0xdf, 0x28, 0x6c, 0x09,
-	0xe1, 0x05, 0xcd, 0x7e, 0xba, 0x88, 0x57, 0x53, 0x58, 0x56, 0x46, 0x54,
-	0x49, 0x00, 0x14, 0x10, 0xa8, 0x26, 0x24, 0x43, 0x22, 0x74, 0xd2, 0x89,
-	0x63, 0x8f, 0x8c, 0x48, 0x1d, 0x2a, 0x47, 0x4b, 0x9d, 0x51, 0x43, 0x35,
-	0x4e, 0x53, 0x7d, 0x1b, 0x01, 0x70, 0x60, 0x4f, 0xa2, 0x87, 0xa0, 0xc3,
-	0xdf, 0xbe, 0xa0, 0xff, 0xfb, 0x20, 0xc4, 0xac, 0x80, 0x0b, 0x29, 0x01,
-	0x44, 0x18, 0xc5, 0x80, 0x01, 0x65, 0x9e, 0x2f, 0xf7, 0x12, 0x82, 0x02,
-	0xf1, 0xa4, 0x5a, 0x33, 0x57, 0x80, 0xf5, 0x75, 0xf9, 0xc4, 0xe5, 0x3a,
-	0x4a, 0x20, 0x40, 0x9a, 0x40, 0xd1, 0x05, 0x05, 0xc8, 0x8e, 0x0f, 0xe0,
-	0x80, 0xd2, 0x44, 0x3f, 0x6c, 0xc4, 0x10, 0xd2, 0xff, 0xad, 0x77, 0x25,
-	0x12, 0x41, 0x56, 0xdf, 0x51, 0x02, 0x6a, 0xc4, 0xa7, 0x16, 0xe6, 0x4d,
-	0xa8, 0xe1, 0xf3, 0x9f, 0xa9, 0xd5, 0x47, 0x19, 0xfd, 0xac, 0x6f, 0xff,
-	0x43, 0x85, 0x2a, 0x82, 0x04, 0x00, 0x04, 0x64, 0x23, 0x96, 0xba, 0x63,
-	0x89, 0x30, 0x8f, 0xaa, 0x4d, 0x1e, 0x93, 0x2c, 0x37, 0x85, 0x92, 0x94,
-	0xec, 0xfa, 0x50, 0x21, 0x3f, 0x50, 0x42, 0xa6, 0x69, 0x77, 0x24, 0x3d,
-	0xdf, 0x81, 0xd2, 0x85, 0x48, 0x59, 0xd6, 0x24, 0x3c, 0xeb, 0xbc, 0x96,
-	0x3c, 0xff, 0xfb, 0x22, 0xc4, 0x89, 0x80, 0x07, 0x54, 0x51, 0x79, 0xfc,
-	0xf1, 0x80, 0x30, 0xf3, 0x8c, 0x69, 0x24, 0x97, 0x98, 0x58, 0xae, 0x9e,
-	0x70, 0x90, 0x00, 0x02, 0x00, 0xb0, 0x17, 0x44, 0x21, 0xe1, 0x1b, 0x99,
-	0x0c, 0xd9, 0xc2, 0x17, 0x66, 0xa2, 0x5a, 0x29, 0x62, 0xd8, 0x0f, 0x82,
-	0xca, 0x61, 0x1a, 0x8a, 0x82, 0x46, 0xd2, 0xb3, 0x4f, 0xd2, 0x68, 0xef,
-	0xe2, 0x21, 0xf4, 0x0d, 0x0f, 0xaf, 0xe4, 0x34, 0xa7, 0xd6, 0x77, 0x5d,
-	0x42, 0x00, 0x01, 0x67, 0x13, 0x70, 0xa0, 0xf7, 0x64, 0xac, 0x32, 0x71,
-	0x54, 0x44, 0xb1, 0x55, 0x35, 0x05, 0xb2, 0x6f, 0x06, 0x25, 0x0d, 0xb9,
-	0x38, 0x33, 0x3c, 0xa1, 0xde, 0x16, 0x60, 0xc8, 0x95, 0x53, 0x2b, 0x0e,
-	0xdd, 0xb1, 0xce, 0x00, 0xe4, 0x1c, 0x0b, 0x67, 0xbf, 0xfc, 0x67, 0xee,
-	0x51, 0x54, 0x8b, 0x24, 0x2b, 0x22, 0x02, 0x82, 0x50, 0x8d, 0x32, 0x42,
-	0xff, 0xfb, 0x22, 0xc4, 0x84, 0x80, 0x07, 0x04, 0x79, 0x5d, 0xe4, 0x84,
-	0x72, 0xe0, 0xd0, 0x88, 0xaa, 0x30, 0x96, 0x0c, 0xe0, 0x12, 0x05, 0x10,
-	0xc5, 0x59, 0xd2, 0xa0, 0x34, 0x39, 0x45, 0xee, 0x14, 0x1d, 0x11, 0xa2,
-	0x18, 0x1c, 0xb8, 0x64, 0x75, 0xef, 0x6b, 0x9c, 0x80, 0x33, 0xff, 0x3d,
-	0x2f, 0x88, 0x99, 0x7a, 0xb6, 0xb7, 0xfa, 0xdf, 0xc7, 0x6e, 0x1a, 0x82,
-	0x00, 0x40, 0x48, 0xdd, 0x12, 0x09, 0xb7, 0x30, 0x3c, 0xf1, 0xe8, 0x44,
-	0x63, 0x51, 0xf8, 0x69, 0xcf, 0xb0, 0xd3, 0x86, 0x86, 0x04, 0x66, 0xa7,
-	0xfe, 0x55, 0xed, 0x25, 0x95, 0x26, 0xfa, 0x08, 0x0e, 0x88, 0x8a, 0xfc,
-	0xc0, 0x9e, 0x71, 0xc3, 0x4e, 0x7f, 0xff, 0xea, 0xaa, 0x7e, 0xed, 0xad,
-	0x96, 0xc9, 0xff, 0x54, 0x16, 0xa7, 0x97, 0x04, 0xd1, 0x1f, 0x4b, 0x85,
-	0x88, 0x44, 0x06, 0x43, 0x13, 0xb3, 0x2d, 0xad, 0x0c, 0x7a, 0xb6, 0xff,
-	0xfb, 0x20, 0xc4, 0x85, 0x00, 0x05, 0xf0, 0x53, 0x53, 0x24, 0x8c, 0x4e,
-	0x80, 0xc0, 0x85, 0x29, 0xa4, 0x94, 0x98, 0x18, 0x3d, 0x03, 0x84, 0x16,
-	0xac, 0x4c, 0x30, 0x2d, 0x6d, 0x3b, 0xbf, 0xd0, 0xf5, 0xd2, 0x9f, 0xa3,
-	0xff, 0xf5, 0x35, 0x0a, 0x99, 0x4a, 0x10, 0xaa, 0xc0, 0x12, 0x94, 0x14,
-	0x8d, 0x4d, 0x1b, 0x26, 0x2b, 0x11, 0xa5, 0x59, 0x82, 0xe9, 0x54, 0x84,
-	0xb9, 0x85, 0x0a, 0x50, 0x7a, 0x37, 0x23, 0x58, 0xa4, 0xd5, 0xbd, 0x54,
-	0x05, 0x0d, 0x42, 0xc6, 0x46, 0x03, 0x56, 0x7d, 0xbb, 0x18, 0x12, 0xb9,
-	0x92, 0xaf, 0x43, 0x40, 0x90, 0x54, 0x02, 0x01, 0x02, 0x00, 0x54, 0x78,
-	0x80, 0x0c, 0x1b, 0x72, 0xc7, 0x8e, 0xf0, 0xc2, 0x43, 0x98, 0x95, 0x44,
-	0x2d, 0x1d, 0x03, 0x66, 0xa1, 0x0f, 0x05, 0x89, 0x16, 0x74, 0x4c, 0x78,
-	0x2a, 0x7b, 0x06, 0x9e, 0x12, 0x03, 0x34, 0xef, 0xa5, 0xff, 0xfb, 0x22,
-	0xc4, 0x8b, 0x80, 0x06, 0x00, 0x61, 0x4a, 0xa3, 0x24, 0x68, 0x80, 0xc4,
-	0x06, 0x29, 0xf0, 0x92, 0x98, 0x00, 0x11, 0xd5, 0x67, 0x4f, 0x7f, 0xff,
-	0xe9, 0x23, 0x97, 0x90, 0x09, 0x70, 0x17, 0x04, 0x44, 0x64, 0xe4, 0xe8,
-	0x0b, 0xa1, 0x1f, 0x81, 0x03, 0x80, 0x6a, 0x22, 0x38, 0xf3, 0xcd, 0xa2,
-	0x65, 0x21, 0x6d, 0x9b, 0x9b, 0x87, 0xec, 0xa9, 0x37, 0x32, 0xa5, 0x34,
-	0x0b, 0xc6, 0x9f, 0xc9, 0x6d, 0x51, 0x2b, 0x6f, 0xfe, 0xd9, 0x7e, 0x66,
-	0x7b, 0xb4, 0xda, 0xdb, 0x24, 0xae, 0x30, 0x02, 0x80, 0x40, 0x24, 0xd0,
-	0x64, 0x4a, 0x70, 0xdb, 0x22, 0x29, 0x30, 0x90, 0x0c, 0xa4, 0xd6, 0x8a,
-	0x47, 0x68, 0xe2, 0x0c, 0x38, 0x1e, 0x08, 0x87, 0x67, 0x92, 0xbb, 0x62,
-	0x14, 0xc5, 0xa5, 0x52, 0x81, 0x36, 0xed, 0xf7, 0x82, 0xfb, 0x53, 0xe8,
-	0xeb, 0x72, 0x6b, 0x6d, 0x91, 0xdf, 0xd9, 0x01, 0xff, 0xfb, 0x20, 0xc4,
-	0x92, 0x00, 0x05, 0xf8, 0x75, 0x4b, 0x04, 0x8c, 0x50, 0xc0, 0xb2, 0x88,
-	0x6e, 0x70, 0xc3, 0x09, 0x1e, 0x71, 0x09, 0x30, 0xe0, 0x59, 0xc9, 0x86,
-	0x89, 0x24, 0x15, 0x44, 0x23, 0xd8, 0xb9, 0x94, 0x49, 0x84, 0x09, 0x2e,
-	0x74, 0x5d, 0xf5, 0xa8, 0x1e, 0x17, 0x62, 0x0f, 0x48, 0xbe, 0x8b, 0x7f,
-	0xad, 0x67, 0x4b, 0xd2, 0x51, 0x3f, 0xff, 0xeb, 0xa4, 0x7f, 0x96, 0x45,
-	0x66, 0x70, 0x5d, 0x8c, 0x64, 0x39, 0x80, 0x60, 0x51, 0x12, 0x04, 0xc4,
-	0xae, 0x0b, 0x08, 0x41, 0xcf, 0x62, 0x08, 0x06, 0xd7, 0x3c, 0xce, 0xbe,
-	0x8a, 0x42, 0x6f, 0x63, 0x0d, 0xb8, 0x17, 0x42, 0x44, 0x1a, 0x6b, 0xb9,
-	0x11, 0xc8, 0x66, 0xe5, 0x7f, 0xfe, 0xca, 0x3e, 0xba, 0x1c, 0xeb, 0x50,
-	0x78, 0xdc, 0x0c, 0x11, 0x41, 0x11, 0x0a, 0x60, 0x5a, 0x1c, 0x59, 0x13,
-	0xc3, 0xc8, 0x6b, 0x24, 0x12, 0xa7, 0xff, 0xfb, 0x22, 0xc4, 0x9a, 0x00,
-	0x05, 0xe8, 0x55, 0x49, 0x26, 0x0c, 0xae, 0xc0, 0xc3, 0x08, 0xe7, 0xa4,
-	0x93, 0x09, 0x50, 0x19, 0x04, 0x5a, 0xc1, 0x85, 0xab, 0x7d, 0x99, 0x91,
-	0x51, 0x33, 0x5a, 0xc6, 0xd4, 0xbe, 0x9d, 0x21, 0x51, 0x58, 0xd3, 0xd6,
-	0x33, 0xfb, 0xf5, 0x27, 0x44, 0xdd, 0xff, 0xfd, 0xbe, 0xfa, 0xdd, 0x65,
-	0x60, 0x01, 0x83, 0x02, 0x50, 0x99, 0x51, 0x54, 0x75, 0x88, 0x2a, 0xd7,
-	0x42, 0xfa, 0x75, 0xcd, 0xd2, 0x5d, 0x45, 0xb2, 0xe6, 0x89, 0x13, 0x45,
-	0xd0, 0xe5, 0xca, 0x82, 0x71, 0x2c, 0xc0, 0xc4, 0x3a, 0x8f, 0x7e, 0xcc,
-	0xa1, 0xa0, 0x95, 0xda, 0xbd, 0x35, 0x27, 0xe3, 0xfd, 0x50, 0x46, 0x24,
-	0x9e, 0x8d, 0x21, 0x96, 0x3a, 0xc4, 0x02, 0x15, 0xa9, 0x32, 0x7b, 0x50,
-	0x81, 0x00, 0x54, 0xe1, 0x70, 0x99, 0xe4, 0x4b, 0x8a, 0x0e, 0x59, 0x30,
-	0x20, 0xd0, 0xf2, 0xd6, 0x07, 0xff, 0xfb, 0x22, 0xc4, 0xa1, 0x00, 0x05,
-	0xd8, 0x45, 0x3f, 0x26, 0x24, 0xc0, 0xc0, 0xc5, 0x05, 0x6c, 0x74, 0x84,
-	0x98, 0x1e, 0xa6, 0xcb, 0x28, 0xa9, 0xaa, 0xf3, 0xf4, 0x7f, 0x2a, 0xa5,
-	0x00, 0xcb, 0x01, 0x22, 0x48, 0x08, 0x68, 0xd8, 0x15, 0xa7, 0x2d, 0x1e,
-	0xa8, 0xc4, 0xc4, 0x82, 0x98, 0x99, 0x3d, 0x6c, 0xa2, 0x28, 0xa8, 0x48,
-	0x74, 0x3c, 0x08, 0x84, 0x80, 0xc6, 0x95, 0x0e, 0xd7, 0x2a, 0x8b, 0xd0,
-	0xd0, 0xaf, 0x58, 0xa6, 0xb6, 0xdc, 0xa7, 0xec, 0x4b, 0x7d, 0xf4, 0x54,
-	0x13, 0x10, 0x80, 0x88, 0x02, 0xe8, 0x54, 0x70, 0x2e, 0x8c, 0x4c, 0xec,
-	0x5f, 0x13, 0x22, 0x3a, 0x89, 0xb0, 0x99, 0x12, 0x48, 0x99, 0x78, 0xd5,
-	0x3a, 0x66, 0xe4, 0x71, 0xe8, 0x5e, 0xf0, 0xc9, 0x10, 0x58, 0xf8, 0xad,
-	0xcb, 0xe9, 0x19, 0x3e, 0x8c, 0xbb, 0xa6, 0x21, 0xeb, 0x14, 0xe4, 0x3f,
-	0xd2, 0x04, 0x12, 0x74, 0xff, 0xfb, 0x20, 0xc4, 0xa8, 0x00, 0x05, 0xd8,
-	0x29, 0x59, 0x84, 0x99, 0x24, 0xb0, 0xbf, 0x08, 0xa7, 0xa4, 0xf3, 0x0c,
-	0x70, 0x7d, 0xa1, 0x46, 0x1c, 0x29, 0x03, 0x10, 0x6a, 0xe4, 0xed, 0x3b,
-	0x4d, 0x7f, 0x26, 0x0d, 0xf0, 0x0c, 0xe4, 0x6c, 0xa9, 0xdb, 0x4c, 0xe2,
-	0xc3, 0xe5, 0x07, 0x08, 0x04, 0xef, 0x43, 0x16, 0xd3, 0x89, 0x73, 0xa4,
-	0x8e, 0x13, 0xeb, 0xfa, 0xba, 0xf5, 0x7a, 0xaa, 0x06, 0xa6, 0x90, 0x04,
-	0x88, 0x07, 0x01, 0x29, 0x60, 0x14, 0x32, 0x38, 0x03, 0x8b, 0x9c, 0x70,
-	0xe5, 0xbe, 0x33, 0x24, 0x02, 0x1c, 0x28, 0x22, 0x09, 0xac, 0xf0, 0x14,
-	0xf2, 0xd4, 0xb6, 0xe0, 0xd8, 0x69, 0x6a, 0x78, 0xb0, 0x0a, 0xa5, 0xbf,
-	0x63, 0xb3, 0x02, 0x2c, 0xf5, 0x3f, 0xff, 0xc8, 0xa4, 0x66, 0x21, 0x03,
-	0x28, 0x0f, 0x0c, 0x45, 0x94, 0x46, 0x80, 0x77, 0xcb, 0xac, 0x30, 0x9d,
-	0x6c, 0x51, 0xff, 0xfb, 0x22, 0xc4, 0xaf, 0x00, 0x05, 0xf4, 0x29, 0x3b,
-	0x27, 0x80, 0xc4, 0x00, 0xbf, 0x0d, 0xac, 0xf4, 0x90, 0x8e, 0x56, 0x00,
-	0x73, 0x09, 0xc6, 0xd3, 0x3a, 0xe4, 0x32, 0x6b, 0x7f, 0x9a, 0xb5, 0xfe,
-	0xc3, 0x21, 0x4a, 0x79, 0x6c, 0x18, 0xec, 0xc9, 0xaa, 0x86, 0xbe, 0x2b,
-	0xff, 0xe9, 0x8b, 0x35, 0x35, 0x96, 0x7d, 0xb6, 0xb6, 0xc9, 0x23, 0x68,
-	0x00, 0x3d, 0x88, 0x6b, 0x87, 0x23, 0x59, 0x32, 0x19, 0x9f, 0x94, 0xc9,
-	0xac, 0x09, 0x0e, 0x32, 0x74, 0x7c, 0x19, 0x08, 0x44, 0x49, 0xd7, 0x35,
-	0x1d, 0x98, 0x0d, 0xa8, 0xbc, 0x15, 0xea, 0x00, 0x15, 0x5d, 0x69, 0x6b,
-	0x2a, 0x20, 0x75, 0x06, 0x17, 0xb7, 0xff, 0x4c, 0x30, 0x3d, 0x73, 0x88,
-	0x40, 0x12, 0xc1, 0xb5, 0x29, 0x0e, 0x90, 0x50, 0x0a, 0xe8, 0xab, 0x3a,
-	0xf2, 0xde, 0x3a, 0x09, 0xab, 0x6e, 0x90, 0xb5, 0x2d, 0x34, 0x77, 0x43,
-	0x50, 0xff, 0xfb, 0x20, 0xc4, 0xb6, 0x00, 0x05, 0xa4, 0x2f, 0x32, 0x07,
-	0xb0, 0xc0, 0x40, 0xbf, 0x05, 0x66, 0xa4, 0xf6, 0x18, 0x08, 0xc6, 0x70,
-	0xc2, 0x81, 0x1a, 0xcf, 0x7d, 0xdf, 0xd0, 0x66, 0x0b, 0x25, 0xaa, 0x6b,
-	0x76, 0x6f, 0x97, 0x1d, 0x00, 0x21, 0x50, 0xe2, 0x58, 0x99, 0x6b, 0x6c,
-	0xb6, 0xfb, 0x0c, 0x19, 0x48, 0x6c, 0x78, 0xc0, 0x6d, 0x2b, 0x82, 0xcb,
-	0x12, 0x1f, 0x40, 0xde, 0x5c, 0x49, 0xad, 0x95, 0xe2, 0x1c, 0x84, 0x84,
-	0xfa, 0x66, 0xef, 0x9c, 0x78, 0x15, 0x95, 0xab, 0x09, 0x2c, 0xd6, 0x17,
-	0x95, 0xcb, 0x7f, 0x92, 0x5f, 0x8f, 0x57, 0x17, 0x1b, 0x4a, 0x2d, 0x69,
-	0xa7, 0xad, 0x1e, 0x8a, 0x7a, 0x07, 0xb2, 0xa2, 0x7f, 0x75, 0x1e, 0x9a,
-	0x80, 0x0a, 0x84, 0xfd, 0x12, 0x6c, 0x93, 0x97, 0x12, 0xe5, 0x83, 0x64,
-	0x42, 0x90, 0xd8, 0xad, 0x19, 0x97, 0x14, 0xe8, 0x35, 0xfa, 0xdb, 0xff,
-	0xfb, 0x22, 0xc4, 0xbe, 0x00, 0x05, 0xbc, 0x45, 0x34, 0xa8, 0x24, 0xc1,
-	0x40, 0xc1, 0x8c, 0xa6, 0x00, 0xf3, 0x08, 0xb8, 0xfe, 0x39, 0x40, 0xb0,
-	0x21, 0x8b, 0x7b, 0x98, 0xef, 0xbc, 0x70, 0x67, 0x10, 0x84, 0x14, 0xa7,
-	0xf4, 0x90, 0x5b, 0x6b, 0x15, 0x6d, 0xc2, 0x81, 0xf6, 0xaa, 0x10, 0xad,
-	0x18, 0x9e, 0x41, 0xe2, 0x98, 0xbc, 0x65, 0xe6, 0x54, 0xa0, 0xe5, 0xcd,
-	0x01, 0x66, 0x02, 0x14, 0x4a, 0x31, 0xaf, 0x3f, 0xf0, 0x73, 0x0c, 0x7f,
-	0x56, 0x2c, 0x9e, 0xa0, 0x42, 0x4c, 0x01, 0x89, 0xd9, 0x44, 0xc8, 0xd8,
-	0x19, 0x72, 0x09, 0x22, 0xc5, 0x63, 0xad, 0xae, 0x09, 0x27, 0x43, 0xe1,
-	0x26, 0xee, 0xd8, 0x73, 0x35, 0x57, 0x26, 0x6a, 0x24, 0x64, 0xf4, 0x5e,
-	0xda, 0xbc, 0x14, 0xff, 0xb3, 0xde, 0x5a, 0xef, 0x1a, 0x2d, 0x12, 0x89,
-	0x4f, 0x42, 0x68, 0xfc, 0xc9, 0xb9, 0x1a, 0x9c, 0x77, 0x39, 0xff, 0xfb,
-	0x22, 0xc4, 0xc5, 0x80, 0x06, 0x18, 0x29, 0x37, 0x26, 0x08, 0xc4, 0x40,
-	0xba, 0x8d, 0x66, 0x94, 0xf3, 0x0c, 0xa8, 0x37, 0xfe, 0x72, 0xe9, 0x9e,
-	0xda, 0x36, 0x0e, 0xba, 0x32, 0xca, 0xa2, 0x34, 0x45, 0xc0, 0x0a, 0xa4,
-	0xb0, 0xa8, 0x25, 0xa7, 0x6a, 0xdd, 0xf1, 0x11, 0x8e, 0x24, 0xc5, 0xf5,
-	0x1e, 0xba, 0x52, 0xb0, 0x1c, 0x08, 0x6a, 0x64, 0x0d, 0xab, 0x84, 0x4d,
-	0xa9, 0x22, 0xeb, 0x5c, 0x44, 0xb9, 0xd4, 0xd3, 0x88, 0xf1, 0xe2, 0x8f,
-	0x48, 0x51, 0x31, 0x07, 0xf9, 0x61, 0xa1, 0x2a, 0x79, 0x92, 0xde, 0xf8,
-	0x8a, 0xb4, 0xa9, 0x07, 0xec, 0x33, 0x32, 0x04, 0x72, 0x1f, 0x2e, 0x98,
-	0x41, 0x07, 0x81, 0x02, 0xc2, 0xf4, 0x2a, 0x15, 0x58, 0x02, 0x04, 0x55,
-	0x00, 0xc8, 0xd4, 0x72, 0x9c, 0xd6, 0x87, 0x72, 0x8d, 0x37, 0x80, 0x24,
-	0x42, 0x72, 0xe4, 0xa6, 0x36, 0x04, 0x63, 0x34, 0xc6, 0xff, 0xfb, 0x20,
-	0xc4, 0xcc, 0x80, 0x06, 0x54, 0x55, 0x5b, 0xa6, 0x18, 0x4b, 0x30, 0xb9,
-	0x91, 0x66, 0x00, 0xf3, 0x08, 0xb8, 0x45, 0xce, 0xf1, 0xaf, 0x6e, 0x14,
-	0xc9, 0x9c, 0xfb, 0xf5, 0x5e, 0xfc, 0xc3, 0xd7, 0xb3, 0x7c, 0x19, 0xe0,
-	0x38, 0xb8, 0xa0, 0xa0, 0x20, 0xf1, 0x74, 0x00, 0x14, 0x6c, 0xb8, 0xf5,
-	0xb1, 0xa9, 0x7c, 0x53, 0x10, 0x71, 0x7e, 0x02, 0xbe, 0xa0, 0x48, 0x12,
-	0xdb, 0x88, 0xa1, 0x22, 0xd6, 0x06, 0x98, 0x75, 0x9f, 0xc5, 0xbc, 0xe1,
-	0x60, 0x57, 0xb0, 0x43, 0x48, 0x32, 0xb6, 0x94, 0xa6, 0x12, 0x5b, 0xde,
-	0x00, 0x44, 0x12, 0x48, 0x89, 0xaf, 0x6b, 0x11, 0x50, 0x3c, 0x0b, 0x2c,
-	0xdb, 0xa8, 0x7b, 0x7a, 0x96, 0xcc, 0x08, 0xf5, 0x5e, 0xf2, 0x9c, 0x3f,
-	0x72, 0xbc, 0x28, 0x3f, 0xb9, 0x68, 0x31, 0x90, 0x20, 0xf1, 0x95, 0x9c,
-	0x3d, 0x34, 0xea, 0x5b, 0x5d, 0x55, 0x21, 0xff, 0xfb, 0x22, 0xc4, 0xd2,
-	0x80, 0x08, 0x10, 0xa7, 0x2e, 0xac, 0x24, 0x65, 0xc1, 0x0e, 0x0f, 0x26,
-	0x64, 0xf4, 0x8c, 0xb0, 0x6c, 0x3c, 0xc7, 0xa2, 0x37, 0xdb, 0x16, 0x44,
-	0x5c, 0x02, 0x58, 0x63, 0x41, 0xfc, 0x13, 0x12, 0x0b, 0x04, 0x08, 0x0f,
-	0x60, 0x4c, 0x58, 0x1e, 0xdf, 0x2a, 0x3d, 0x0b, 0x34, 0x06, 0xca, 0x4f,
-	0xb9, 0x46, 0xa3, 0xf7, 0xb5, 0xc6, 0xa6, 0x07, 0xa9, 0xcc, 0x1c, 0x03,
-	0x00, 0x83, 0x02, 0x87, 0x03, 0x04, 0xdc, 0xe2, 0xef, 0x97, 0x20, 0xa2,
-	0x44, 0x4e, 0x14, 0x65, 0x8a, 0xae, 0xe6, 0x88, 0x3d, 0x0f, 0x9c, 0x35,
-	0x54, 0x55, 0x21, 0xc5, 0x74, 0xb1, 0x2a, 0x41, 0x10, 0x25, 0x02, 0x92,
-	0xa4, 0x0f, 0x88, 0x46, 0x3d, 0x26, 0x63, 0xc8, 0xc0, 0xf0, 0xfc, 0xe5,
-	0x6b, 0xb1, 0x1e, 0xab, 0x42, 0x3c, 0x78, 0x7d, 0x62, 0x48, 0x56, 0x89,
-	0x05, 0x9f, 0xdf, 0xab, 0x6d, 0xdc, 0xff, 0xfb, 0x22, 0xc4, 0xc7, 0x80,
-	0x09, 0xf0, 0x9f, 0x2b, 0x0c, 0x24, 0xc5, 0xc9, 0x26, 0x94, 0xe5, 0xe4,
-	0xf3, 0x0d, 0xa0, 0xca, 0x02, 0x3e, 0x71, 0xc4, 0xf4, 0xad, 0x8f, 0x02,
-	0x86, 0x95, 0x15, 0x71, 0x9d, 0x27, 0x6f, 0x26, 0xf7, 0xae, 0x8b, 0x2b,
-	0x61, 0x53, 0xe6, 0xed, 0x4d, 0x12, 0x55, 0x11, 0x04, 0x57, 0xe3, 0x47,
-	0x25, 0x2c, 0xc0, 0xf2, 0x27, 0xd2, 0xaf, 0x6c, 0x4a, 0x28, 0x6f, 0x51,
-	0xa8, 0x50, 0xd3, 0x28, 0x58, 0xc8, 0x16, 0x44, 0xe2, 0xd7, 0x57, 0x9a,
-	0x49, 0x08, 0xf6, 0x2f, 0x0d, 0x09, 0x8d, 0x15, 0x8a, 0x2b, 0x22, 0xd9,
-	0x13, 0x22, 0xd7, 0xdf, 0x46, 0xd4, 0xdf, 0xff, 0x7d, 0x15, 0x30, 0x2b,
-	0xaa, 0x99, 0x52, 0x30, 0x16, 0x80, 0xa4, 0xe4, 0x23, 0x83, 0xb5, 0xf8,
-	0x34, 0x6a, 0xc9, 0x93, 0x82, 0x0f, 0xae, 0x08, 0x89, 0xe9, 0x04, 0xcf,
-	0x7c, 0x01, 0xa9, 0x21, 0xc4, 0xff, 0xfb, 0x20, 0xc4, 0xb1, 0x80, 0x08,
-	0x58, 0x73, 0x2d, 0x0c, 0x24, 0x67, 0xc1, 0x20, 0x15, 0x66, 0x70, 0xf3,
-	0x0d, 0x90, 0xfe, 0x48, 0xff, 0x69, 0xa0, 0xc2, 0xc0, 0x37, 0x2c, 0x81,
-	0xf5, 0xc5, 0x99, 0xee, 0x07, 0x1a, 0xe0, 0x98, 0xf2, 0xa2, 0xee, 0x1d,
-	0xff, 0x97, 0x34, 0x86, 0xc6, 0x2a, 0x23, 0x7a, 0x13, 0x1c, 0x13, 0x70,
-	0x30, 0x78, 0x4c, 0x0a, 0x1d, 0x80, 0xa2, 0xe8, 0x02, 0x70, 0x60, 0x09,
-	0xb3, 0x9c, 0xa3, 0xb7, 0x11, 0x1a, 0x19, 0x06, 0xcc, 0x09, 0xd4, 0x0d,
-	0x09, 0x8d, 0x1a, 0x02, 0x54, 0xd0, 0x93, 0x15, 0x1d, 0xc3, 0x56, 0x4c,
-	0x56, 0x6e, 0xff, 0x60, 0xad, 0x9f, 0x6a, 0xe8, 0xd4, 0xf3, 0xfc, 0x02,
-	0x0f, 0x02, 0xb1, 0x90, 0x6a, 0x04, 0x83, 0x36, 0xc7, 0x69, 0x62, 0x2b,
-	0x16, 0x35, 0xde, 0xc7, 0x00, 0x70, 0x91, 0xb8, 0x5c, 0xfc, 0x4a, 0xf5,
-	0x10, 0xf8, 0x0d, 0xff, 0xfb, 0x22, 0xc4, 0xa2, 0x80, 0x08, 0x4c, 0x49,
-	0x33, 0x28, 0x30, 0xc1, 0x41, 0x05, 0x0d, 0x27, 0x30, 0xf6, 0x0c, 0x3c,
-	0x52, 0xe8, 0x79, 0x60, 0x28, 0xc1, 0x51, 0xcd, 0x53, 0xdf, 0x58, 0x99,
-	0x57, 0xbd, 0xb1, 0xcd, 0xa1, 0x4f, 0xff, 0xf6, 0xeb, 0x1b, 0x9a, 0x56,
-	0xd5, 0x58, 0x13, 0x08, 0xc7, 0xe3, 0xc8, 0xc2, 0xac, 0x72, 0x2a, 0x8b,
-	0x14, 0x00, 0x22, 0xbc, 0x30, 0x00, 0x44, 0xd9, 0x11, 0xe7, 0x6d, 0x13,
-	0xa0, 0x0b, 0x12, 0x30, 0x06, 0x04, 0x09, 0xe7, 0xd1, 0xd6, 0xd4, 0x25,
-	0x1a, 0x51, 0xa7, 0x4d, 0xff, 0xd3, 0xb1, 0x50, 0xba, 0x9a, 0x99, 0x62,
-	0x68, 0x8f, 0xaf, 0x98, 0x2a, 0x55, 0xb5, 0x4a, 0x1e, 0x5c, 0x04, 0xa3,
-	0x9f, 0x80, 0x40, 0x2c, 0x73, 0x96, 0x74, 0x88, 0x64, 0xcc, 0xaf, 0xfe,
-	0x50, 0xaf, 0x9c, 0x12, 0xec, 0x09, 0xcc, 0xb9, 0x41, 0x67, 0xe4, 0x44,
-	0xa9, 0x07, 0xff, 0xfb, 0x20, 0xc4, 0x97, 0x80, 0x06, 0xb8, 0x63, 0x31,
-	0x0c, 0x24, 0x61, 0xc0, 0xe5, 0x8c, 0xa6, 0xe4, 0xc3, 0x0c, 0xe0, 0x40,
-	0x39, 0x88, 0x79, 0x28, 0x4a, 0x7f, 0x6f, 0xbf, 0x8f, 0xa2, 0x71, 0xeb,
-	0xaf, 0x9a, 0xc8, 0xe2, 0x68, 0x00, 0x07, 0x82, 0xa7, 0xd7, 0x09, 0x75,
-	0x76, 0x31, 0x44, 0x83, 0x8d, 0x0a, 0x63, 0x45, 0x96, 0x41, 0x6f, 0x5b,
-	0x06, 0xa0, 0x54, 0x08, 0x17, 0x7e, 0x58, 0xc4, 0xb3, 0x42, 0xa6, 0x56,
-	0xf1, 0x22, 0xab, 0x55, 0xf7, 0xb6, 0x58, 0xeb, 0x32, 0xcf, 0x5a, 0x9a,
-	0xdf, 0xd6, 0x6c, 0x97, 0x4e, 0xe4, 0xa9, 0xc4, 0x02, 0x01, 0x90, 0x88,
-	0xcc, 0x1b, 0x95, 0x1d, 0x75, 0xa1, 0x27, 0x94, 0x40, 0x82, 0x10, 0x17,
-	0xa4, 0xcf, 0xd8, 0x21, 0x17, 0x75, 0xc2, 0x8c, 0x4e, 0xbc, 0x68, 0x7c,
-	0x50, 0xe0, 0xd3, 0x6b, 0x6b, 0x96, 0x2c, 0xe7, 0xb5, 0x6d, 0xff, 0xff,
-	0xff, 0xfb, 0x22, 0xc4, 0x96, 0x00, 0x06, 0x70, 0x2f, 0x35, 0x08, 0x30,
-	0xc0, 0x40, 0xca, 0x08, 0x26, 0x54, 0xb4, 0x98, 0x60, 0xfe, 0xc5, 0xd5,
-	0x15, 0x7b, 0x51, 0xc0, 0x08, 0x05, 0xdc, 0x39, 0x30, 0x8d, 0x38, 0x98,
-	0x46, 0x5c, 0x18, 0x90, 0x14, 0x12, 0xb0, 0x30, 0xc0, 0x23, 0x10, 0x28,
-	0xd6, 0x9c, 0x68, 0xa8, 0xc3, 0xc3, 0x16, 0x08, 0x00, 0x0b, 0x31, 0x01,
-	0x23, 0x42, 0xf1, 0xdc, 0x96, 0x56, 0x85, 0xbf, 0xff, 0x47, 0xf8, 0x9e,
-	0xb8, 0xe5, 0x24, 0xb6, 0x57, 0x63, 0x8d, 0x94, 0x40, 0x04, 0x02, 0x50,
-	0xc0, 0x61, 0x18, 0x6f, 0x6e, 0x31, 0x5d, 0x94, 0x4a, 0xb4, 0x56, 0x24,
-	0x72, 0x8a, 0x95, 0xf3, 0x97, 0x22, 0x27, 0x86, 0x5e, 0x41, 0x18, 0xcc,
-	0x1c, 0x06, 0x44, 0x46, 0x05, 0xac, 0xe4, 0xff, 0x32, 0x87, 0xef, 0xa4,
-	0x9d, 0x74, 0x72, 0x4f, 0x52, 0x37, 0xfb, 0xea, 0x5a, 0xac, 0x0f, 0xff,
-	0xfb, 0x22, 0xc4, 0x9a, 0x00, 0x06, 0x1c, 0x29, 0x39, 0x26, 0x0c, 0x66,
-	0x40, 0xcb, 0x8d, 0x65, 0xc1, 0x83, 0x0c, 0xa8, 0xe1, 0x9e, 0xf2, 0x21,
-	0x31, 0xa3, 0x44, 0x18, 0xb0, 0xa8, 0x81, 0x02, 0x8c, 0x4d, 0xf7, 0x06,
-	0x1c, 0x4e, 0x83, 0x22, 0x51, 0x44, 0x90, 0xe2, 0x8c, 0x10, 0x31, 0x67,
-	0xdc, 0xf1, 0x0e, 0xad, 0x12, 0x06, 0xec, 0x1c, 0x29, 0xfd, 0x9a, 0xff,
-	0x2a, 0xb7, 0x0b, 0x4d, 0x77, 0xff, 0xdd, 0x6c, 0x91, 0xb0, 0xc0, 0x40,
-	0x58, 0xb8, 0x98, 0xba, 0x06, 0x96, 0xd0, 0x0c, 0x24, 0x0f, 0x22, 0x1e,
-	0xb6, 0x30, 0x1c, 0x91, 0x25, 0x9d, 0x47, 0x0d, 0x3a, 0x69, 0x87, 0x74,
-	0x62, 0x24, 0x8a, 0xb9, 0x6a, 0x1d, 0xd9, 0xaf, 0xb6, 0xea, 0x11, 0xb3,
-	0xff, 0x25, 0x45, 0x05, 0xe7, 0x57, 0x54, 0x6c, 0x1c, 0x85, 0xa4, 0xc0,
-	0xd0, 0xa0, 0x89, 0xd3, 0x0b, 0x28, 0xf1, 0x07, 0xa5, 0x88, 0xff, 0xfb,
-	0x20, 0xc4, 0x9f, 0x00, 0x06, 0x7c, 0x35, 0x45, 0xa4, 0xa8, 0xc2, 0x20,
-	0xc1, 0x08, 0x28, 0x74, 0xc3, 0x08, 0xac, 0x08, 0x10, 0x26, 0x8b, 0xa4,
-	0x10, 0x7c, 0xe0, 0x60, 0x49, 0x86, 0x6f, 0x09, 0x02, 0x82, 0x40, 0xfd,
-	0x62, 0x3e, 0x43, 0x4d, 0xaa, 0x0e, 0x2f, 0xab, 0x62, 0xae, 0x15, 0xeb,
-	0x75, 0x05, 0x2b, 0x38, 0x34, 0x56, 0x98, 0xad, 0x01, 0x90, 0x78, 0x1a,
-	0xb3, 0xa8, 0xf6, 0x08, 0xb3, 0x50, 0x95, 0x1f, 0x07, 0x2a, 0x23, 0x98,
-	0x60, 0x20, 0x08, 0xa5, 0xe0, 0x42, 0xab, 0x06, 0x99, 0x8a, 0x11, 0x14,
-	0x30, 0x08, 0x08, 0x07, 0x30, 0xab, 0x35, 0xee, 0x47, 0x33, 0xeb, 0xff,
-	0xb6, 0x53, 0xe8, 0x3a, 0xf3, 0xab, 0xd8, 0x58, 0x01, 0xf0, 0x48, 0x96,
-	0x3d, 0x16, 0x10, 0x51, 0xa1, 0x66, 0x87, 0x38, 0x92, 0x5d, 0x89, 0x1a,
-	0x48, 0xb5, 0x16, 0xbb, 0xb1, 0x6e, 0x26, 0x1a, 0xff, 0xfb, 0x22, 0xc4,
-	0xa3, 0x00, 0x06, 0x30, 0x2f, 0x35, 0x27, 0x8c, 0x44, 0xc0, 0xcc, 0x8a,
-	0xea, 0x74, 0x90, 0x8d, 0x86, 0x02, 0x82, 0x22, 0xf2, 0xa7, 0xa5, 0x5d,
-	0x84, 0x45, 0x00, 0xd6, 0x0b, 0xb7, 0x47, 0x0e, 0x96, 0xfd, 0xdf, 0xea,
-	0xdc, 0x95, 0xe0, 0x3d, 0x17, 0xb6, 0x26, 0xd7, 0x6d, 0x31, 0x1e, 0x52,
-	0x0f, 0x24, 0x46, 0xd7, 0xa8, 0x13, 0x06, 0x17, 0x50, 0xad, 0x67, 0x32,
-	0x3f, 0x47, 0x6f, 0x22, 0xd6, 0xca, 0x40, 0xec, 0xe2, 0x01, 0xc5, 0x1d,
-	0x02, 0x0b, 0xef, 0x3e, 0xf9, 0xf1, 0x5a, 0xc4, 0x28, 0xa8, 0x85, 0x00,
-	0x53, 0xee, 0xf4, 0xd9, 0x5a, 0x29, 0xae, 0x13, 0x45, 0x00, 0x0a, 0x01,
-	0xf6, 0x85, 0x90, 0xc0, 0x95, 0x9c, 0x5d, 0x44, 0xd7, 0x4d, 0xa6, 0x0a,
-	0x6b, 0x47, 0x0f, 0x85, 0xc3, 0xae, 0x8a, 0x80, 0xc4, 0xea, 0x58, 0x50,
-	0xe2, 0x16, 0x6c, 0x2e, 0x7d, 0x5e, 0xa1, 0xff, 0xfb, 0x20, 0xc4, 0xa7,
-	0x80, 0x06, 0x24, 0x2d, 0x39, 0x27, 0xa4, 0x61, 0x40, 0xbe, 0x05, 0xeb,
-	0xb4, 0xb4, 0x98, 0x2e, 0x17, 0xe5, 0xfd, 0xf5, 0x53, 0xee, 0x5f, 0x48,
-	0x5b, 0xc2, 0xfa, 0x22, 0x70, 0xd8, 0xac, 0xc1, 0x2c, 0xbd, 0x23, 0xc8,
-	0xa2, 0x0d, 0x4f, 0x36, 0x04, 0x26, 0x6e, 0x0c, 0x6e, 0x25, 0xcc, 0x8a,
-	0x55, 0xb3, 0x3e, 0x1e, 0x3a, 0x22, 0x50, 0x5c, 0x58, 0xb3, 0x8f, 0x25,
-	0xea, 0xa9, 0xd9, 0xd3, 0x4b, 0x10, 0x9d, 0x27, 0x33, 0x7a, 0x92, 0xbf,
-	0x46, 0xe7, 0x48, 0x55, 0x3f, 0x20, 0x00, 0x33, 0xc0, 0xf9, 0x11, 0xb5,
-	0xad, 0x1e, 0x17, 0xae, 0x24, 0xf3, 0x02, 0x42, 0xc9, 0x4d, 0x48, 0x3a,
-	0x48, 0x13, 0x4c, 0xe8, 0x21, 0x1f, 0xba, 0x9f, 0xce, 0xb5, 0x7c, 0x11,
-	0x4c, 0x30, 0xb1, 0x54, 0xb4, 0xa3, 0x71, 0xac, 0x81, 0x5e, 0x52, 0x44,
-	0xce, 0x61, 0x0d, 0xa6, 0xdf, 0xff, 0xfb, 0x22, 0xc4, 0xad, 0x80, 0x06,
-	0x98, 0x2f, 0x37, 0x27, 0xa4, 0xc0, 0x00, 0xb9, 0x05, 0x26, 0xa4, 0xf1,
-	0x98, 0x48, 0xdd, 0xbe, 0xb7, 0xb5, 0xda, 0xeb, 0x75, 0xb2, 0x36, 0x00,
-	0x07, 0x85, 0x32, 0x48, 0xd6, 0x0a, 0x01, 0xe2, 0xb6, 0x45, 0x0e, 0x18,
-	0x4e, 0xd0, 0x87, 0x51, 0x33, 0x71, 0x02, 0xf5, 0x60, 0x76, 0x21, 0x79,
-	0x2b, 0x11, 0x64, 0x44, 0x89, 0x6d, 0x33, 0x20, 0x82, 0x96, 0xc8, 0xd2,
-	0x2f, 0x80, 0x3c, 0x21, 0x5a, 0x1a, 0x5b, 0x38, 0x02, 0x95, 0x11, 0x1d,
-	0x78, 0xd6, 0x4b, 0x81, 0x6f, 0x4b, 0x08, 0x9d, 0x74, 0xac, 0xf6, 0x72,
-	0xc7, 0x4c, 0xa3, 0xf5, 0x5d, 0x73, 0x75, 0x3b, 0xc3, 0x58, 0x5f, 0x86,
-	0x66, 0x7f, 0x20, 0xc0, 0xd1, 0xf0, 0xd9, 0x60, 0xb1, 0xe9, 0x59, 0x94,
-	0xac, 0xad, 0xc4, 0x48, 0x8a, 0xde, 0x22, 0x22, 0xd7, 0xb5, 0x75, 0xfd,
-	0x04, 0xa2, 0x03, 0x70, 0xff, 0xfb, 0x22, 0xc4, 0xb3, 0x00, 0x06, 0x30,
-	0x3f, 0x37, 0x26, 0x18, 0x65, 0x40, 0xcc, 0x8d, 0x25, 0xc1, 0x84, 0x88,
-	0xa8, 0x04, 0xc6, 0xe7, 0x15, 0x72, 0x81, 0x50, 0xd6, 0xb4, 0x05, 0x93,
-	0x69, 0xe4, 0x54, 0x0e, 0xb2, 0x05, 0x14, 0xd4, 0xb3, 0x33, 0x27, 0xdd,
-	0x3f, 0x3c, 0xac, 0xe9, 0xa3, 0xb0, 0x81, 0x33, 0xe0, 0x46, 0xe5, 0x15,
-	0x70, 0x7f, 0x17, 0x7e, 0xe5, 0x26, 0x04, 0xf5, 0xf6, 0xfa, 0x08, 0x55,
-	0x11, 0x59, 0x1d, 0x4e, 0x46, 0x5b, 0x4d, 0x00, 0x7f, 0x12, 0x54, 0xad,
-	0x96, 0x9e, 0x8b, 0xe0, 0xb4, 0x0c, 0x4c, 0xb4, 0x10, 0x44, 0xda, 0x3b,
-	0x36, 0x99, 0xb1, 0x56, 0x51, 0xe4, 0x58, 0x1b, 0x8b, 0xce, 0x48, 0x2d,
-	0xab, 0x59, 0x86, 0x62, 0x8b, 0x55, 0xe2, 0xed, 0xff, 0x56, 0xaf, 0xfe,
-	0x96, 0x92, 0x00, 0x14, 0xc0, 0x79, 0x48, 0x7a, 0x27, 0x19, 0xd3, 0xce,
-	0x2e, 0x80, 0x22, 0xff, 0xfb, 0x20, 0xc4, 0xb7, 0x80, 0x45, 0xb4, 0x2b,
-	0x33, 0x27, 0xa4, 0x61, 0x40, 0xce, 0x0a, 0xa6, 0x15, 0x84, 0x8c, 0x38,
-	0x13, 0xc2, 0xd8, 0x18, 0x9a, 0x28, 0xd3, 0xcd, 0x05, 0x4d, 0x93, 0x2a,
-	0xca, 0x0e, 0xb0, 0xd1, 0x10, 0x08, 0x40, 0x3a, 0x49, 0xa3, 0xd8, 0xa6,
-	0x1a, 0x29, 0x2a, 0xba, 0x06, 0x2a, 0xf8, 0xf2, 0x34, 0x7f, 0x57, 0x65,
-	0x2a, 0x2e, 0x49, 0x14, 0x10, 0xc4, 0x10, 0x49, 0x00, 0x5f, 0x13, 0x13,
-	0x90, 0x0d, 0x23, 0x1f, 0x45, 0x82, 0x0c, 0x07, 0x27, 0x85, 0x49, 0x36,
-	0x30, 0x83, 0xee, 0x20, 0x51, 0xc7, 0x16, 0x13, 0x42, 0x32, 0x27, 0x1b,
-	0x68, 0xd1, 0xd5, 0x24, 0x31, 0xdb, 0xa7, 0xa8, 0x5f, 0x88, 0x0e, 0x21,
-	0xfa, 0xff, 0x47, 0x94, 0x07, 0xaa, 0xa5, 0x94, 0x54, 0x20, 0x03, 0xd8,
-	0x32, 0x58, 0x32, 0x3a, 0x0c, 0x7e, 0x98, 0x6e, 0xc8, 0x04, 0x34, 0x36,
-	0x98, 0xff, 0xfb, 0x22, 0xc4, 0xbd, 0x00, 0x06, 0x70, 0x69, 0x30, 0xa7,
-	0x98, 0x45, 0x40, 0xc5, 0x8d, 0x2b, 0x34, 0xc3, 0x0c, 0xae, 0x92, 0x68,
-	0xc9, 0x71, 0x57, 0x99, 0x0b, 0x35, 0xc1, 0xb5, 0x0b, 0xaa, 0x08, 0xa6,
-	0x82, 0xa4, 0xc6, 0x6c, 0x6b, 0x3c, 0xb0, 0x69, 0x68, 0xea, 0x92, 0xd8,
-	0xcf, 0xd1, 0x72, 0x5b, 0xa5, 0x96, 0xff, 0xd3, 0x00, 0x70, 0x2f, 0x0e,
-	0x0e, 0x09, 0x0a, 0x11, 0xc4, 0xea, 0x74, 0x22, 0xd1, 0xa4, 0x17, 0x98,
-	0x7a, 0xc2, 0x69, 0x68, 0xc3, 0x15, 0x50, 0xf6, 0xf5, 0xa2, 0xfc, 0xba,
-	0xe6, 0x0a, 0xc6, 0x1d, 0x58, 0x56, 0xfe, 0x19, 0xc8, 0x76, 0x7a, 0x19,
-	0xab, 0xfe, 0x2a, 0xc6, 0xe8, 0x30, 0xe5, 0xb6, 0xcb, 0x2c, 0x8d, 0x32,
-	0x81, 0x00, 0x5c, 0x16, 0x0f, 0xa2, 0x0c, 0xa4, 0x65, 0x87, 0x16, 0x25,
-	0x35, 0x90, 0x31, 0x1d, 0x29, 0x36, 0x41, 0x46, 0x1a, 0x0f, 0x8b, 0x9b,
-	0xff, 0xfb, 0x20, 0xc4, 0xc1, 0x80, 0x46, 0xcc, 0x63, 0x30, 0xac, 0x30,
-	0x61, 0xc0, 0xc7, 0x0d, 0x26, 0x14, 0xf3, 0x0c, 0xa8, 0x99, 0x1d, 0x51,
-	0xc7, 0xda, 0x68, 0x6c, 0xa3, 0x43, 0x1b, 0x59, 0xa7, 0xad, 0x5f, 0xff,
-	0xf4, 0x2a, 0x09, 0x58, 0x03, 0x92, 0x2d, 0x0a, 0x2a, 0x8e, 0xe4, 0x0c,
-	0xd7, 0x02, 0x83, 0xd8, 0xc0, 0x94, 0x5a, 0x68, 0x14, 0x03, 0x87, 0x1c,
-	0xd9, 0xce, 0x2d, 0x86, 0x9f, 0xf2, 0xc6, 0x97, 0x73, 0x87, 0x44, 0x1f,
-	0x80, 0xae, 0xc5, 0x88, 0x21, 0xda, 0x56, 0x1d, 0x7d, 0x8d, 0x24, 0xef,
-	0x5b, 0xff, 0xf5, 0x89, 0x50, 0x91, 0xbc, 0x1d, 0x85, 0x4b, 0xe5, 0xca,
-	0x77, 0x03, 0x0a, 0xb1, 0x01, 0x3a, 0x9a, 0x0b, 0x7c, 0x2c, 0x0c, 0x0a,
-	0xd1, 0x4a, 0xe6, 0x6d, 0x5a, 0x6e, 0x46, 0xf3, 0xb6, 0xf5, 0x63, 0x1d,
-	0x91, 0xf3, 0xb3, 0x0e, 0xbc, 0x3c, 0xc3, 0x04, 0x14, 0xd8, 0xff, 0xfb,
-	0x22, 0xc4, 0xc3, 0x80, 0x06, 0x10, 0x39, 0x3d, 0xa7, 0x88, 0xc4, 0x00,
-	0xcb, 0x85, 0xe6, 0x14, 0xc3, 0x18, 0x98, 0x2d, 0x5b, 0x21, 0x26, 0xc5,
-	0x91, 0xa7, 0xa2, 0x77, 0x50, 0x03, 0xec, 0x25, 0x63, 0x60, 0xa8, 0x90,
-	0x95, 0x0d, 0x31, 0xb1, 0xe5, 0x89, 0x14, 0xcd, 0xe4, 0x64, 0x6d, 0xeb,
-	0x16, 0xe7, 0x6c, 0x8c, 0xc6, 0x53, 0xa5, 0x9e, 0xe7, 0x0c, 0x91, 0x1d,
-	0xce, 0x21, 0xe7, 0xe9, 0xff, 0xf4, 0x1f, 0xb3, 0xd8, 0xd5, 0x8f, 0xdb,
-	0xb7, 0x8a, 0x5a, 0x19, 0xed, 0x5b, 0x14, 0x20, 0x07, 0xe0, 0x46, 0x1a,
-	0x12, 0x28, 0xf5, 0x97, 0xee, 0x0e, 0xa4, 0x43, 0x11, 0x46, 0x56, 0x70,
-	0xd8, 0x08, 0x9b, 0xd6, 0x08, 0x08, 0x26, 0x07, 0x7b, 0x46, 0x2e, 0x90,
-	0xea, 0x16, 0xa6, 0x12, 0x1e, 0xb9, 0x41, 0xf6, 0x30, 0xf0, 0xc1, 0x0b,
-	0xbe, 0xcb, 0xd2, 0x3b, 0xeb, 0x3f, 0xa6, 0x6a, 0x40, 0xff, 0xfb, 0x22,
-	0xc4, 0xc8, 0x80, 0x06, 0x60, 0x33, 0x39, 0xa6, 0x24, 0xc2, 0x40, 0xc3,
-	0x85, 0xe6, 0xa4, 0xf4, 0x98, 0x08, 0x54, 0x07, 0xa8, 0x2f, 0x53, 0xe5,
-	0x19, 0x96, 0x5c, 0xc7, 0x4d, 0x11, 0x07, 0x51, 0x21, 0xa1, 0xe1, 0xb4,
-	0x30, 0x5a, 0x89, 0x22, 0xc2, 0x35, 0x86, 0x06, 0x44, 0xe6, 0xad, 0x54,
-	0xa8, 0xa9, 0x91, 0x6b, 0xcc, 0xf5, 0x6a, 0x76, 0x22, 0x26, 0x04, 0x53,
-	0x10, 0xfe, 0xe4, 0xdf, 0x14, 0x6f, 0x46, 0xa1, 0x59, 0x24, 0x40, 0x05,
-	0x08, 0x0d, 0x4a, 0x0e, 0x71, 0x33, 0x69, 0xe4, 0xcc, 0x25, 0x20, 0x80,
-	0x84, 0x10, 0xb4, 0xc8, 0x42, 0x32, 0xab, 0x66, 0x14, 0xdb, 0x7c, 0x8b,
-	0x55, 0x39, 0xba, 0x10, 0x41, 0x85, 0xda, 0x53, 0xa8, 0x51, 0xc3, 0xc3,
-	0xee, 0xa2, 0xd2, 0xc7, 0xfe, 0xda, 0xbf, 0x7f, 0x45, 0x7f, 0x20, 0x60,
-	0x80, 0x30, 0x06, 0x81, 0x80, 0x06, 0x28, 0x4c, 0xff, 0xfb, 0x20, 0xc4,
-	0xcd, 0x80, 0x06, 0x7c, 0x6b, 0x53, 0x86, 0x18, 0x4b, 0x30, 0xb9, 0x05,
-	0xea, 0x34, 0x94, 0x98, 0x0e, 0x64, 0x01, 0x23, 0x8b, 0xb4, 0x72, 0x8d,
-	0x24, 0x14, 0x92, 0x43, 0x96, 0x18, 0x71, 0xb6, 0x95, 0x43, 0x50, 0xb0,
-	0xcc, 0x58, 0x1a, 0x14, 0x75, 0x0b, 0xad, 0x67, 0x1a, 0x44, 0x8b, 0x14,
-	0x2c, 0xfd, 0x77, 0xd6, 0xec, 0x89, 0x26, 0xfb, 0x06, 0x3d, 0xbd, 0x9d,
-	0x5a, 0x58, 0x05, 0xe0, 0x62, 0x7a, 0x0d, 0x8a, 0xc7, 0x18, 0x42, 0x8b,
-	0x28, 0xf0, 0x63, 0x47, 0x6c, 0x1c, 0x52, 0x35, 0x29, 0x4b, 0xb6, 0xe7,
-	0x9b, 0x45, 0x65, 0xe8, 0xb5, 0xc8, 0x06, 0x30, 0xa0, 0x10, 0x47, 0x55,
-	0x7f, 0x6e, 0x8e, 0x26, 0x57, 0x5e, 0x1b, 0x58, 0x43, 0xda, 0x2c, 0x95,
-	0x36, 0x01, 0x7e, 0x4c, 0x9a, 0x82, 0xd2, 0x83, 0xd8, 0x0e, 0x18, 0x60,
-	0x84, 0x22, 0x34, 0x20, 0x82, 0x0c, 0xff, 0xfb, 0x22, 0xc4, 0xd2, 0x80,
-	0x06, 0x24, 0x67, 0x2e, 0xac, 0x18, 0x65, 0x40, 0xca, 0x8f, 0x66, 0xa0,
-	0xf3, 0x08, 0xb0, 0xa9, 0xc1, 0x2c, 0xed, 0x32, 0x53, 0x39, 0xff, 0xfa,
-	0x3d, 0x30, 0x6a, 0x3c, 0xf6, 0x8c, 0x38, 0xf5, 0x38, 0x9d, 0xd7, 0x9b,
-	0x32, 0xe8, 0xa1, 0x11, 0x97, 0x22, 0xbf, 0x27, 0x62, 0xbd, 0xa0, 0xa8,
-	0xa1, 0x11, 0x16, 0x19, 0xc9, 0x34, 0x31, 0x50, 0xb4, 0x79, 0xa4, 0xc8,
-	0x1b, 0x58, 0x4c, 0x3c, 0x87, 0xc9, 0x34, 0xc8, 0x59, 0x56, 0x37, 0xd6,
-	0xe6, 0x72, 0x1f, 0x4a, 0x4d, 0x97, 0xc2, 0xd6, 0xe4, 0xa1, 0x6a, 0xad,
-	0x5c, 0x97, 0xd6, 0xff, 0xc3, 0x04, 0xfc, 0x28, 0xd8, 0x85, 0xc8, 0x8f,
-	0x8f, 0x88, 0xad, 0xf5, 0x5d, 0x89, 0x89, 0x0a, 0x34, 0x59, 0x37, 0x30,
-	0x20, 0xfe, 0x0c, 0x01, 0x82, 0xc8, 0x47, 0xaf, 0xc5, 0x64, 0x0d, 0x88,
-	0x05, 0x64, 0xd1, 0xac, 0x36, 0xff, 0xfb, 0x22, 0xc4, 0xd7, 0x80, 0x05,
-	0xfc, 0x89, 0x30, 0xac, 0x24, 0x61, 0xc0, 0xc8, 0x87, 0x26, 0xa4, 0xf3,
-	0x0c, 0x98, 0x40, 0x9a, 0xcc, 0x92, 0x47, 0x4f, 0x57, 0xfd, 0x33, 0xd5,
-	0x14, 0xc1, 0x45, 0x09, 0x99, 0x26, 0xe9, 0x62, 0xce, 0xa9, 0xcd, 0x8a,
-	0x38, 0xee, 0xa2, 0xec, 0x49, 0x9a, 0x58, 0x9e, 0xda, 0x6e, 0xb5, 0x15,
-	0x5c, 0xee, 0xd8, 0xab, 0x01, 0xf8, 0x2d, 0xe2, 0xa3, 0x40, 0xc8, 0xa6,
-	0x4b, 0x59, 0xd3, 0x78, 0x76, 0x2a, 0x88, 0x16, 0x2d, 0x3b, 0x87, 0xa4,
-	0x80, 0x84, 0xca, 0x8c, 0x30, 0x91, 0xea, 0x11, 0x3d, 0x60, 0x73, 0xf9,
-	0xc1, 0x07, 0x5b, 0xb3, 0x75, 0x32, 0xc2, 0x32, 0x9d, 0xae, 0x5d, 0x1a,
-	0x64, 0xcb, 0x57, 0xb5, 0xca, 0x1f, 0x57, 0x46, 0x44, 0x18, 0x01, 0x41,
-	0x90, 0xf7, 0x41, 0xa8, 0xb2, 0x64, 0xb7, 0x89, 0x86, 0x24, 0x15, 0x26,
-	0x1e, 0xa0, 0x09, 0x06, 0xff, 0xfb, 0x20, 0xc4, 0xdd, 0x80, 0x06, 0xb0,
-	0x31, 0x35, 0x27, 0x98, 0xc4, 0xc0, 0xc4, 0x8c, 0xa6, 0x20, 0xf3, 0x08,
-	0xa8, 0x28, 0xce, 0xc3, 0x07, 0x97, 0x62, 0x06, 0x20, 0xea, 0x56, 0x13,
-	0x6a, 0x81, 0xa0, 0x68, 0x8c, 0xe8, 0x70, 0x59, 0x35, 0xdc, 0x35, 0x8d,
-	0x81, 0x87, 0x32, 0xda, 0x22, 0xec, 0xfa, 0x19, 0x6b, 0x5c, 0x35, 0x82,
-	0xa8, 0x40, 0x6a, 0x80, 0x05, 0xd8, 0x1e, 0x25, 0xf2, 0x0a, 0xce, 0xee,
-	0xa4, 0x89, 0x74, 0x89, 0x34, 0xa7, 0x9a, 0x2c, 0x7c, 0x1e, 0x9e, 0x43,
-	0x98, 0xde, 0xb9, 0xfd, 0x15, 0xdb, 0x53, 0x84, 0x12, 0x02, 0xc6, 0x10,
-	0xb3, 0x5c, 0x36, 0x65, 0x64, 0x16, 0xf4, 0xfb, 0x47, 0x35, 0x2e, 0x57,
-	0xd3, 0x39, 0xc1, 0xf6, 0x7a, 0x13, 0x15, 0x32, 0x38, 0x08, 0xf8, 0x14,
-	0x99, 0xa0, 0x35, 0x84, 0x21, 0x2a, 0x0b, 0xe4, 0x0c, 0xcb, 0x65, 0xa4,
-	0xaf, 0x57, 0xff, 0xfb, 0x22, 0xc4, 0xe0, 0x80, 0x06, 0x64, 0x2d, 0x30,
-	0xa4, 0x98, 0xc4, 0x80, 0xc9, 0x8d, 0x67, 0x24, 0xc3, 0x08, 0xb0, 0x1b,
-	0x99, 0x73, 0xc3, 0x42, 0x3b, 0x90, 0x61, 0x80, 0x03, 0x57, 0x48, 0x0a,
-	0x69, 0xcc, 0xce, 0x98, 0x26, 0x63, 0xc3, 0xab, 0x15, 0xd3, 0x56, 0xf8,
-	0x89, 0x6e, 0xa8, 0x86, 0xde, 0xda, 0x88, 0x55, 0x51, 0x87, 0x20, 0xbe,
-	0x39, 0x8d, 0x64, 0xb7, 0x99, 0xfa, 0x2e, 0x76, 0xb2, 0x65, 0x7e, 0xd6,
-	0x18, 0x27, 0x5d, 0xb2, 0xd0, 0xb7, 0x72, 0x14, 0xaa, 0xca, 0x45, 0xb6,
-	0xfb, 0x68, 0x64, 0x28, 0x90, 0xad, 0xbd, 0xca, 0xc9, 0xee, 0x0b, 0x13,
-	0x85, 0x48, 0xc1, 0x57, 0x56, 0x56, 0x09, 0x25, 0xae, 0x7a, 0xac, 0x4a,
-	0xdc, 0x45, 0xe8, 0x16, 0x66, 0x06, 0x1c, 0x28, 0x51, 0x8a, 0xaa, 0xb3,
-	0x2a, 0x02, 0x33, 0x93, 0xe0, 0x82, 0x42, 0xc9, 0x7b, 0x2d, 0x02, 0xd6,
-	0x61, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x80, 0x86, 0x2c, 0x63, 0x2c, 0x07,
-	0x98, 0x63, 0x80, 0xed, 0x91, 0x25, 0xe0, 0xf4, 0x8c, 0xb8, 0x90, 0x18,
-	0x41, 0x22, 0xac, 0x0c, 0x32, 0x27, 0x64, 0x13, 0x34, 0x16, 0x05, 0xed,
-	0x27, 0xa9, 0x2e, 0xdc, 0x98, 0x40, 0xca, 0x06, 0xbc, 0x54, 0x09, 0x01,
-	0xa9, 0xc6, 0x6e, 0xbf, 0x7a, 0xc0, 0x25, 0x40, 0x50, 0x11, 0x42, 0x62,
-	0x6f, 0xc3, 0x3c, 0xd5, 0xaa, 0xd0, 0xc5, 0x99, 0x03, 0xdd, 0x4a, 0x82,
-	0xc1, 0x89, 0x5d, 0xfa, 0xa9, 0x2e, 0xdb, 0x35, 0xbf, 0x38, 0x5d, 0x8d,
-	0xc2, 0x5d, 0xea, 0x4d, 0xcd, 0x32, 0x2c, 0x88, 0x93, 0x07, 0x6e, 0x4a,
-	0xaa, 0x09, 0x4c, 0x4c, 0x12, 0xd6, 0x5b, 0x5a, 0x35, 0xb7, 0x26, 0x9a,
-	0x55, 0x55, 0x50, 0x03, 0x3f, 0x0e, 0x3c, 0xaa, 0x92, 0x25, 0x2f, 0x04,
-	0x5b, 0xa9, 0x66, 0x8d, 0x14, 0x9c, 0xbd, 0x80, 0x84, 0x8d, 0x30, 0xff,
-	0xfb, 0x22, 0xc4, 0xe4, 0x80, 0x06, 0x8c, 0x69, 0x30, 0xa8, 0x24, 0x41,
-	0xc0, 0xd4, 0x06, 0xa6, 0xa4, 0xf4, 0x98, 0x08, 0x3e, 0x7b, 0xcf, 0x47,
-	0x43, 0x71, 0x07, 0x38, 0x5b, 0x1e, 0xbc, 0x65, 0x0a, 0x41, 0x9a, 0x9f,
-	0x39, 0x48, 0xff, 0xc9, 0x4d, 0x3f, 0xb3, 0x9f, 0xb0, 0x63, 0x5c, 0x24,
-	0xb0, 0x91, 0xf5, 0xa7, 0xa7, 0xef, 0xa5, 0x21, 0x39, 0x13, 0x65, 0xad,
-	0x14, 0xa0, 0x19, 0x01, 0x80, 0x41, 0x46, 0xdb, 0x36, 0x91, 0xd2, 0x8a,
-	0x60, 0x8d, 0xb5, 0x99, 0x9d, 0x28, 0x83, 0x11, 0xb4, 0x64, 0x11, 0x18,
-	0x7e, 0x0d, 0x8e, 0xbd, 0x02, 0xf2, 0xe8, 0x69, 0xc5, 0xdf, 0xf9, 0x0f,
-	0xea, 0x17, 0xeb, 0xa9, 0x1a, 0x7f, 0x8d, 0x1a, 0x67, 0x18, 0xc0, 0x04,
-	0x1b, 0xc5, 0xb4, 0x32, 0x80, 0xf3, 0x97, 0x1a, 0xaa, 0x32, 0x4c, 0x8c,
-	0x52, 0x79, 0x05, 0xeb, 0x2a, 0xb5, 0x05, 0x30, 0x6a, 0x33, 0xff, 0xfb,
-	0x22, 0xc4, 0xe6, 0x80, 0x07, 0x74, 0x49, 0x33, 0x26, 0x18, 0x67, 0x00,
-	0xbd, 0x0c, 0x66, 0x14, 0xf3, 0x08, 0xb0, 0x99, 0x6d, 0x09, 0x57, 0x78,
-	0x60, 0xea, 0x9d, 0xe3, 0x19, 0xa3, 0x05, 0x58, 0x77, 0xc9, 0x7f, 0xee,
-	0x09, 0xed, 0x16, 0x7a, 0xa2, 0xcf, 0x22, 0xce, 0xd2, 0x11, 0xe6, 0x69,
-	0xde, 0x5a, 0xe6, 0xd4, 0xa4, 0xe4, 0x6a, 0x24, 0x95, 0x08, 0x88, 0x11,
-	0xb0, 0xe8, 0xb0, 0xe0, 0xe8, 0xbe, 0x17, 0x53, 0xfb, 0xc2, 0x09, 0x20,
-	0xff, 0x3d, 0x93, 0x18, 0x4a, 0xd1, 0x28, 0x28, 0x2a, 0xe6, 0x1f, 0x2a,
-	0xa4, 0x84, 0x11, 0x24, 0x0d, 0x02, 0xa7, 0x94, 0xa2, 0x5c, 0x86, 0x26,
-	0x99, 0x59, 0xd4, 0xee, 0x73, 0x92, 0x1e, 0x2b, 0x4d, 0xd4, 0x68, 0x25,
-	0xab, 0x1e, 0x44, 0x1c, 0x09, 0x98, 0x85, 0x22, 0xd5, 0x05, 0xba, 0x16,
-	0x99, 0xbc, 0x98, 0xf7, 0x29, 0x05, 0x94, 0x9a, 0x6c, 0xff, 0xfb, 0x20,
-	0xc4, 0xe8, 0x00, 0x07, 0x08, 0x8b, 0x2a, 0x07, 0x98, 0x65, 0xc0, 0xe3,
-	0x11, 0x26, 0x21, 0x06, 0x08, 0x38, 0x81, 0x1c, 0x4c, 0x49, 0x83, 0x41,
-	0x06, 0x01, 0x45, 0x2c, 0x6c, 0xe0, 0x7c, 0x84, 0x1c, 0x1a, 0x3b, 0xb5,
-	0x6a, 0x21, 0xc2, 0x02, 0xf6, 0xf9, 0x36, 0xb7, 0xc6, 0x33, 0x1c, 0xcb,
-	0x47, 0x3b, 0x75, 0xb7, 0x4d, 0xa5, 0x71, 0x24, 0x80, 0x5a, 0x10, 0x01,
-	0xc5, 0xc2, 0x40, 0xba, 0xae, 0x55, 0x83, 0xff, 0x88, 0x92, 0xa4, 0x62,
-	0x67, 0x1a, 0x8c, 0xd2, 0xd7, 0x40, 0xc5, 0xa6, 0xd5, 0x1e, 0x51, 0xb5,
-	0x56, 0x6a, 0xe1, 0x1f, 0x3c, 0x34, 0x44, 0xc3, 0xa4, 0x89, 0x4a, 0x2f,
-	0xbf, 0x1f, 0xff, 0x73, 0xab, 0xe7, 0x9b, 0x2c, 0xc5, 0x96, 0xed, 0xf7,
-	0xb7, 0x5b, 0x23, 0x69, 0x00, 0x74, 0x57, 0x48, 0x27, 0x95, 0x64, 0xf2,
-	0xeb, 0x8c, 0x8b, 0x00, 0xf1, 0x98, 0x90, 0xff, 0xfb, 0x22, 0xc4, 0xe6,
-	0x00, 0x06, 0xa8, 0x2d, 0x33, 0x07, 0x98, 0xc4, 0x80, 0xdc, 0x11, 0x65,
-	0xe0, 0xf3, 0x0c, 0xa8, 0x82, 0x68, 0xa1, 0xb3, 0x93, 0x2d, 0x71, 0xbb,
-	0x18, 0x43, 0x8d, 0xb4, 0xc1, 0xa3, 0xde, 0x90, 0x54, 0xee, 0xc9, 0x12,
-	0x08, 0x19, 0xb8, 0x55, 0x9a, 0x0d, 0xb9, 0x61, 0xc5, 0xc5, 0x2c, 0xa1,
-	0x44, 0xad, 0xb5, 0x1e, 0xd7, 0xef, 0xf7, 0x0a, 0xdd, 0x8b, 0x40, 0x30,
-	0x11, 0x01, 0xee, 0x9d, 0x7e, 0x18, 0x63, 0xd1, 0x04, 0xc2, 0x53, 0x28,
-	0x81, 0x8a, 0xab, 0x3c, 0xf4, 0xec, 0xfa, 0x62, 0x95, 0x3c, 0xa4, 0x22,
-	0x3e, 0x14, 0x04, 0x07, 0x7a, 0x83, 0x02, 0x73, 0x76, 0x1f, 0xea, 0x5c,
-	0xc7, 0x2e, 0x6f, 0x64, 0x53, 0x38, 0x8f, 0xac, 0xf2, 0x95, 0x5d, 0x30,
-	0x22, 0x2f, 0x84, 0x21, 0xb4, 0xa7, 0x9e, 0x8a, 0xa3, 0xa9, 0x89, 0x73,
-	0x54, 0x0a, 0x8c, 0x6e, 0x92, 0x25, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80,
-	0x07, 0x2c, 0xa7, 0x2e, 0xac, 0x18, 0x65, 0x80, 0xbe, 0x85, 0xe7, 0x30,
-	0x93, 0x24, 0x00, 0xb2, 0x5a, 0x29, 0x8c, 0xef, 0x4b, 0x9f, 0xe8, 0xef,
-	0xcb, 0xc7, 0x40, 0x60, 0xbd, 0x63, 0x76, 0x85, 0x55, 0x22, 0x8d, 0x94,
-	0x37, 0x7c, 0x69, 0x5f, 0xab, 0x63, 0xbf, 0x78, 0x2d, 0x10, 0x98, 0x01,
-	0x9c, 0x04, 0x15, 0x5a, 0x1e, 0x20, 0x0d, 0x9f, 0x8b, 0x4c, 0x88, 0xc9,
-	0x07, 0x87, 0x1b, 0x65, 0x23, 0x84, 0x02, 0xb6, 0x1e, 0xed, 0x82, 0xe6,
-	0x27, 0xb9, 0xc2, 0x4b, 0xf6, 0x20, 0x1a, 0x77, 0xa1, 0x07, 0x0a, 0x08,
-	0x3a, 0x0e, 0x45, 0xa2, 0xae, 0x52, 0xc0, 0xe3, 0x2b, 0x3c, 0x2c, 0xe1,
-	0x72, 0x35, 0xa0, 0x8b, 0x9c, 0x2a, 0x87, 0xd5, 0x8d, 0x66, 0xee, 0x2a,
-	0x15, 0x72, 0x64, 0x02, 0x3c, 0xa4, 0x8b, 0x86, 0x87, 0xf6, 0xe6, 0xa2,
-	0xc8, 0x08, 0x10, 0x43, 0xff, 0xfb, 0x22, 0xc4, 0xe8, 0x80, 0x47, 0x90,
-	0x89, 0x2f, 0x27, 0xa4, 0x61, 0xc0, 0xda, 0x05, 0xe7, 0x30, 0xf6, 0x18,
-	0x2c, 0x21, 0xa4, 0x04, 0x0c, 0x38, 0x95, 0xae, 0xfb, 0x5c, 0x8b, 0x32,
-	0x2f, 0xcd, 0xde, 0xca, 0xee, 0x48, 0x09, 0x27, 0x0d, 0xcc, 0x5b, 0x75,
-	0xb6, 0x30, 0xe6, 0x51, 0x1d, 0x4c, 0xee, 0xaf, 0xd8, 0xff, 0x5a, 0xb6,
-	0xd9, 0x33, 0x97, 0xee, 0x94, 0x06, 0xb2, 0x60, 0x90, 0x23, 0x0d, 0x65,
-	0xe3, 0xe4, 0x9a, 0x5a, 0x8b, 0xaa, 0xb5, 0xd3, 0x05, 0xc5, 0x53, 0x97,
-	0xe9, 0x2d, 0xd9, 0xa1, 0x59, 0x13, 0x91, 0xaf, 0x99, 0xe1, 0x89, 0xb2,
-	0xd1, 0xac, 0x51, 0x10, 0x51, 0xda, 0xc2, 0xf1, 0xcf, 0xca, 0xdf, 0x70,
-	0x05, 0x72, 0xcf, 0x47, 0xe5, 0x71, 0xf7, 0xdd, 0x1a, 0xeb, 0x02, 0x41,
-	0x94, 0x13, 0x83, 0x84, 0x11, 0x1c, 0x10, 0x05, 0x0c, 0x5c, 0x89, 0xe4,
-	0x42, 0x22, 0x42, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xa4, 0x3b,
-	0x33, 0x27, 0x98, 0x63, 0x80, 0xdd, 0x8b, 0x2a, 0xb4, 0xc3, 0x0d, 0x9e,
-	0x2e, 0xcc, 0x94, 0x44, 0x79, 0xec, 0x8e, 0xd7, 0x62, 0xdb, 0x75, 0x42,
-	0x7d, 0xd8, 0xdd, 0x15, 0x14, 0x8a, 0x4d, 0xe8, 0xbf, 0xc8, 0xf3, 0x52,
-	0x89, 0x7c, 0x80, 0x8e, 0xbe, 0x62, 0x72, 0x12, 0xb3, 0xfe, 0xf2, 0x95,
-	0x79, 0x24, 0x41, 0x80, 0xa0, 0x11, 0x31, 0xa1, 0x49, 0x7e, 0x0a, 0xa8,
-	0x03, 0x29, 0x82, 0x00, 0x8a, 0x51, 0x90, 0x84, 0x07, 0x41, 0xe6, 0x00,
-	0x92, 0x5d, 0xc3, 0x2b, 0x17, 0x1e, 0xf1, 0x38, 0x1c, 0x2e, 0x27, 0x04,
-	0x65, 0xdb, 0x50, 0xa3, 0x37, 0x26, 0x2b, 0x6d, 0xd4, 0xf3, 0xac, 0xec,
-	0xd4, 0xa5, 0x23, 0x40, 0x00, 0xaf, 0xa1, 0x0f, 0xdd, 0x1d, 0x8a, 0xac,
-	0x9b, 0x29, 0x20, 0x63, 0x44, 0xe2, 0x5f, 0x68, 0x4a, 0x82, 0x31, 0x42,
-	0xca, 0xe7, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x07, 0xa4, 0x69, 0x59,
-	0xa6, 0x0c, 0x50, 0xf0, 0xc8, 0x8a, 0xa6, 0xa4, 0xf3, 0x0c, 0x70, 0x29,
-	0x45, 0x72, 0x42, 0x9e, 0x04, 0x4c, 0xf7, 0xc1, 0xb1, 0x09, 0x77, 0xa2,
-	0x9c, 0xa7, 0xce, 0xad, 0xb8, 0x96, 0x5e, 0x71, 0xea, 0xed, 0x5d, 0x31,
-	0xe8, 0x5c, 0x53, 0xbe, 0xb7, 0xee, 0xcf, 0xf7, 0x2d, 0xff, 0xf3, 0x4b,
-	0xbf, 0xd7, 0xdb, 0xac, 0xb5, 0xc0, 0xc0, 0xc0, 0x64, 0x75, 0x60, 0x99,
-	0xb1, 0x42, 0xc6, 0x44, 0x08, 0x1b, 0x4a, 0xdf, 0x92, 0x55, 0x74, 0xa3,
-	0x25, 0x92, 0x6f, 0x19, 0xc6, 0xfe, 0x5f, 0x23, 0x47, 0x21, 0x60, 0x31,
-	0x70, 0xa8, 0x45, 0x99, 0x7f, 0xcb, 0xd8, 0xa7, 0x2c, 0x08, 0x87, 0xff,
-	0xff, 0x42, 0x78, 0x65, 0x77, 0x78, 0x46, 0x6b, 0x9d, 0x51, 0x20, 0x0f,
-	0x31, 0x6b, 0x36, 0x11, 0x4a, 0x85, 0x4e, 0x65, 0x2c, 0x48, 0x3a, 0x20,
-	0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x00, 0x06, 0x14, 0x6b, 0x30, 0xac, 0x18,
-	0x45, 0x41, 0x01, 0x0d, 0xa5, 0xe0, 0xf4, 0x8c, 0x78, 0xc4, 0x08, 0x70,
-	0xc7, 0x97, 0x7c, 0x8c, 0xd5, 0x49, 0x8f, 0xa3, 0x37, 0x61, 0x20, 0xa0,
-	0x1f, 0x30, 0x10, 0x8b, 0xb0, 0x0f, 0x17, 0x17, 0x6e, 0x87, 0x56, 0x72,
-	0xf3, 0x13, 0xf6, 0xb3, 0xaf, 0x5e, 0x86, 0x6a, 0x14, 0x56, 0x6a, 0x00,
-	0x04, 0x00, 0xe0, 0x08, 0x5a, 0xb3, 0x07, 0x55, 0xbd, 0x89, 0xa3, 0x82,
-	0x92, 0x47, 0x2c, 0x80, 0x04, 0x09, 0x20, 0x65, 0xde, 0x15, 0xa8, 0x8b,
-	0x0f, 0x34, 0x0e, 0xe8, 0x5d, 0x41, 0x42, 0xf7, 0xb8, 0x35, 0xca, 0x3d,
-	0xf5, 0xb2, 0x55, 0xcd, 0xa6, 0xcb, 0x35, 0xd1, 0x5f, 0x8c, 0x12, 0x67,
-	0x13, 0x44, 0x28, 0x1a, 0x71, 0x14, 0x40, 0x25, 0xcb, 0x3a, 0xdc, 0x5c,
-	0xe2, 0x56, 0x8f, 0x0c, 0xd5, 0x38, 0xda, 0x75, 0xa6, 0x6c, 0x42, 0xff,
-	0xfb, 0x22, 0xc4, 0xe3, 0x80, 0x06, 0x34, 0x79, 0x30, 0xac, 0x24, 0x61,
-	0xc0, 0xe5, 0x0a, 0xa9, 0xf0, 0xc3, 0x09, 0xde, 0x3f, 0xa1, 0x8e, 0x65,
-	0xdd, 0x06, 0xa5, 0x9f, 0x23, 0xcb, 0xf4, 0xd5, 0x91, 0xf3, 0xa9, 0xa0,
-	0x36, 0x65, 0x06, 0x56, 0x8c, 0x63, 0x56, 0x84, 0x20, 0xfc, 0x07, 0x27,
-	0x6b, 0x65, 0x24, 0x38, 0xfb, 0xa7, 0xd0, 0x2c, 0xde, 0x24, 0x88, 0x90,
-	0x13, 0x03, 0x53, 0xe5, 0x24, 0xa3, 0xe1, 0xd6, 0x90, 0xa0, 0xe7, 0x85,
-	0x85, 0x10, 0x0c, 0x46, 0x56, 0xc8, 0x08, 0xda, 0x1d, 0x1a, 0xf0, 0x31,
-	0xe0, 0xa4, 0x08, 0xc6, 0x4c, 0x00, 0xc2, 0xfa, 0x07, 0xe7, 0x18, 0x99,
-	0x55, 0x75, 0x3e, 0xf9, 0xdf, 0xfb, 0x32, 0x6f, 0x76, 0x8a, 0x06, 0x56,
-	0x42, 0x00, 0x04, 0x13, 0xc1, 0x94, 0x39, 0xba, 0x0a, 0x9d, 0x1d, 0xba,
-	0xfb, 0x4a, 0x4e, 0x5a, 0x1d, 0x9d, 0x59, 0x5a, 0x17, 0x8b, 0xff, 0xfb,
-	0x20, 0xc4, 0xe5, 0x00, 0x06, 0xb0, 0xa5, 0x35, 0x27, 0xa4, 0x41, 0xc0,
-	0xcc, 0x05, 0x26, 0x64, 0xf6, 0x18, 0x08, 0x4e, 0x95, 0x44, 0xfa, 0xbb,
-	0xe4, 0xb1, 0xcc, 0x05, 0xaf, 0xfd, 0x55, 0x2f, 0x30, 0xaa, 0x24, 0xa0,
-	0xa5, 0x9d, 0x0d, 0x75, 0x8d, 0x8e, 0x0f, 0x1e, 0x8a, 0x0e, 0x42, 0x54,
-	0x28, 0x15, 0xae, 0x67, 0x75, 0xbb, 0x54, 0x49, 0xaf, 0x70, 0x92, 0x56,
-	0xea, 0x4e, 0x8a, 0xfc, 0x22, 0x08, 0x07, 0xec, 0x60, 0xb1, 0x14, 0x50,
-	0xbb, 0x20, 0x24, 0x06, 0xb4, 0x49, 0xac, 0x11, 0x49, 0x94, 0x83, 0xf2,
-	0xd8, 0x35, 0x52, 0x8e, 0x64, 0xd9, 0x01, 0x90, 0x1d, 0x42, 0x1b, 0x43,
-	0x5a, 0x73, 0x75, 0x21, 0xf5, 0xdd, 0x48, 0x7a, 0xed, 0x33, 0x55, 0xf7,
-	0x14, 0x2a, 0x66, 0x25, 0x45, 0x98, 0x03, 0xe8, 0xed, 0x0b, 0x9d, 0x26,
-	0x35, 0x1f, 0x44, 0x4a, 0x80, 0xfa, 0x86, 0x29, 0xff, 0xfb, 0x22, 0xc4,
-	0xe7, 0x00, 0x07, 0x84, 0x31, 0x2c, 0xa7, 0x99, 0x24, 0x88, 0xca, 0x0d,
-	0x2c, 0x34, 0x90, 0x8e, 0x1e, 0x65, 0x07, 0x42, 0x44, 0x02, 0x4e, 0x7b,
-	0x16, 0x94, 0x16, 0x66, 0x2a, 0xf6, 0x48, 0xc7, 0xed, 0x56, 0x56, 0x4c,
-	0x42, 0x23, 0x33, 0x63, 0x01, 0x2a, 0x05, 0x3f, 0x4d, 0x42, 0x8a, 0x10,
-	0xee, 0x5f, 0x72, 0x02, 0x00, 0xcc, 0xc9, 0x9e, 0x9b, 0x21, 0x42, 0x34,
-	0x0f, 0x6f, 0x11, 0xa6, 0x3a, 0x1a, 0x57, 0x1d, 0x32, 0x61, 0x4b, 0x8b,
-	0x0e, 0x58, 0x35, 0x17, 0x66, 0x91, 0xc1, 0x1b, 0xae, 0x44, 0xea, 0xab,
-	0x3a, 0x32, 0x01, 0x0f, 0x57, 0xdf, 0xa5, 0x3f, 0xe9, 0x82, 0x33, 0x5d,
-	0xc5, 0x49, 0x0e, 0x24, 0x20, 0x22, 0x0d, 0xae, 0x1c, 0xb3, 0xaf, 0x56,
-	0xc5, 0x63, 0x6a, 0x28, 0x88, 0x77, 0x58, 0x56, 0x7b, 0x1d, 0x6d, 0xb0,
-	0x01, 0x70, 0x40, 0x12, 0x80, 0xf8, 0x9c, 0xff, 0xfb, 0x20, 0xc4, 0xe6,
-	0x80, 0x07, 0x20, 0x53, 0x47, 0xe7, 0x98, 0x45, 0x60, 0xc8, 0x07, 0x26,
-	0x64, 0xc3, 0x18, 0x98, 0x6e, 0xd7, 0x38, 0x2a, 0x4f, 0x27, 0xb5, 0xc2,
-	0x40, 0x02, 0xa2, 0xf5, 0x8c, 0x70, 0xe9, 0x3d, 0x6a, 0xa8, 0xb9, 0x01,
-	0x3a, 0x9a, 0x34, 0xfe, 0xa0, 0x1e, 0xfc, 0xa7, 0x42, 0xbf, 0xf6, 0x7f,
-	0x14, 0x2f, 0xaa, 0x36, 0x84, 0xac, 0x08, 0x40, 0x92, 0xa4, 0x4f, 0xd6,
-	0x19, 0x0e, 0x0d, 0x67, 0xa2, 0xc1, 0xd1, 0x41, 0x49, 0x52, 0x26, 0x85,
-	0x01, 0xf0, 0x74, 0x11, 0xda, 0x34, 0xcd, 0x27, 0x1c, 0x93, 0xc3, 0x79,
-	0x1e, 0x2a, 0xe8, 0xf7, 0x36, 0x5c, 0xe0, 0x6a, 0x6c, 0x73, 0x1c, 0xb5,
-	0x8c, 0xe2, 0xeb, 0xdf, 0x5e, 0xf2, 0xcd, 0x45, 0x32, 0xdb, 0x65, 0x96,
-	0x46, 0xd9, 0x44, 0x80, 0x98, 0xa2, 0x40, 0x1d, 0x04, 0x61, 0x62, 0x31,
-	0x02, 0x12, 0x34, 0x4d, 0x21, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x07,
-	0x7c, 0x79, 0x31, 0x2c, 0x30, 0x61, 0xc0, 0xca, 0x85, 0x66, 0x64, 0xc3,
-	0x18, 0x90, 0x52, 0x6c, 0xb8, 0xe9, 0xd4, 0x0d, 0x26, 0x87, 0x0c, 0x66,
-	0xcb, 0xd3, 0x16, 0x23, 0xef, 0x67, 0x72, 0xd4, 0x13, 0x28, 0xc2, 0x31,
-	0xe6, 0xc9, 0x6a, 0x5f, 0xb6, 0xa1, 0xed, 0xcd, 0x8c, 0xde, 0xfa, 0x7f,
-	0x8d, 0x1a, 0xaa, 0x16, 0x00, 0x08, 0x08, 0xc9, 0x76, 0x03, 0x6a, 0x9d,
-	0x20, 0x29, 0xa8, 0xb8, 0x4c, 0x06, 0x9a, 0x4a, 0xce, 0x4c, 0x9d, 0x10,
-	0x53, 0xf8, 0xc5, 0x33, 0x58, 0xf5, 0xed, 0x74, 0xa0, 0x2e, 0x38, 0xe1,
-	0x72, 0x82, 0xfd, 0x35, 0xf9, 0x35, 0x7a, 0x34, 0x7f, 0xef, 0x0e, 0x0a,
-	0x29, 0x2a, 0x05, 0x56, 0x27, 0x00, 0x04, 0x14, 0xc1, 0x10, 0x64, 0xc0,
-	0x4f, 0x34, 0x9b, 0x4c, 0x04, 0x17, 0xaa, 0x00, 0x8d, 0x31, 0x6c, 0x5e,
-	0x61, 0x68, 0xc6, 0xb3, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x07, 0xd4,
-	0x6d, 0x2f, 0x27, 0xb0, 0x61, 0xc0, 0xcd, 0x86, 0xe7, 0x70, 0xc3, 0x04,
-	0xb0, 0x1d, 0xe5, 0x31, 0x58, 0x19, 0x3d, 0x8b, 0x4d, 0x5e, 0x61, 0x76,
-	0x5d, 0xa1, 0x95, 0x3e, 0xa1, 0xea, 0x9d, 0x4b, 0x41, 0x6d, 0x34, 0x04,
-	0xdc, 0xb4, 0xbd, 0x1a, 0x7e, 0x62, 0x75, 0x14, 0x39, 0x6d, 0xb2, 0x4b,
-	0xa3, 0x4d, 0x24, 0x00, 0x40, 0x05, 0x85, 0x9a, 0x07, 0x49, 0x81, 0x84,
-	0x36, 0x22, 0x24, 0x22, 0x3a, 0x41, 0x38, 0xd7, 0x32, 0x3c, 0xca, 0x8f,
-	0x65, 0x74, 0x0c, 0x22, 0x8b, 0x0e, 0xf0, 0xa4, 0xf7, 0xf6, 0x07, 0xf6,
-	0x76, 0x65, 0x80, 0x9a, 0x7e, 0x70, 0x4e, 0x7b, 0x4f, 0xb9, 0x42, 0xec,
-	0x6a, 0x92, 0xb6, 0x62, 0x3a, 0xc3, 0x28, 0xc7, 0xa6, 0x97, 0x6d, 0x76,
-	0xbb, 0x5b, 0x23, 0x08, 0x00, 0xb0, 0x1a, 0x04, 0xd0, 0x8b, 0x10, 0x98,
-	0x79, 0x01, 0x65, 0xff, 0xfb, 0x20, 0xc4, 0xe5, 0x00, 0x06, 0x60, 0x27,
-	0x35, 0x27, 0xa4, 0xc0, 0x00, 0xf5, 0x11, 0x65, 0xd9, 0x84, 0x8c, 0x38,
-	0xf2, 0x48, 0xad, 0x59, 0xb7, 0x77, 0x69, 0xac, 0x12, 0x10, 0xbc, 0x40,
-	0x0a, 0xb1, 0x11, 0x03, 0x9a, 0x5c, 0x1c, 0x04, 0x01, 0xf7, 0x31, 0x7a,
-	0xd7, 0x9b, 0x91, 0x9f, 0xff, 0x6f, 0xe8, 0x31, 0x00, 0x02, 0x21, 0x91,
-	0x80, 0x38, 0x32, 0x78, 0x31, 0x2c, 0x43, 0xa9, 0x65, 0x93, 0x52, 0xc9,
-	0xeb, 0x96, 0xa1, 0x91, 0x39, 0x57, 0x19, 0x84, 0x18, 0xee, 0xef, 0x2b,
-	0x3b, 0x17, 0xad, 0xa9, 0xca, 0x15, 0x48, 0xf3, 0x6a, 0xf7, 0xfe, 0x0d,
-	0xcc, 0x8d, 0x2c, 0x45, 0x01, 0x01, 0x15, 0x04, 0x09, 0x52, 0x28, 0xff,
-	0x61, 0xde, 0x71, 0x9d, 0x15, 0x76, 0x49, 0x25, 0x72, 0x7f, 0x32, 0x00,
-	0xa0, 0x6c, 0x48, 0x3a, 0x24, 0x57, 0x69, 0xcc, 0x3f, 0x13, 0x08, 0xb1,
-	0xb0, 0xff, 0xfb, 0x22, 0xc4, 0xe3, 0x00, 0x06, 0x20, 0x31, 0x49, 0xe4,
-	0x98, 0x68, 0x60, 0xda, 0x85, 0x26, 0xa4, 0xf3, 0x18, 0x90, 0x40, 0xa2,
-	0xda, 0xc4, 0x19, 0xec, 0x5a, 0x27, 0x74, 0x5f, 0xec, 0x5d, 0xcb, 0xe0,
-	0x58, 0x38, 0x90, 0xae, 0x53, 0xad, 0x7b, 0xf5, 0x2c, 0x82, 0x06, 0x01,
-	0x48, 0x46, 0x38, 0x66, 0xae, 0xd5, 0xaa, 0x18, 0x11, 0xf0, 0x89, 0x15,
-	0x1b, 0x7b, 0x5f, 0x5e, 0xb3, 0xd6, 0x51, 0xb3, 0xf5, 0xf7, 0xfb, 0x40,
-	0xc2, 0xca, 0xc0, 0x48, 0x26, 0x69, 0x20, 0x40, 0x04, 0x00, 0xe1, 0xa2,
-	0xfc, 0xaa, 0xf7, 0x57, 0xdc, 0xed, 0xfc, 0xa7, 0x65, 0x3a, 0x13, 0xb5,
-	0xff, 0x2b, 0xe0, 0x33, 0x68, 0xc1, 0xc7, 0x1b, 0xfe, 0xf7, 0xe9, 0x34,
-	0xd3, 0xb3, 0xf2, 0xa0, 0x34, 0x32, 0x51, 0xf4, 0xe5, 0xf0, 0x4d, 0x0c,
-	0x3b, 0x08, 0xae, 0xd6, 0x35, 0x3f, 0xbd, 0x9e, 0xef, 0xd6, 0x21, 0x6a,
-	0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x07, 0x00, 0x69, 0x51, 0xa6, 0x24,
-	0x65, 0x70, 0xc1, 0x87, 0x66, 0xa4, 0xf4, 0x98, 0x08, 0xf0, 0xba, 0xef,
-	0x1e, 0x0c, 0x27, 0x5f, 0xd9, 0x94, 0x58, 0xf5, 0x26, 0x42, 0x75, 0x2e,
-	0xde, 0xa2, 0x05, 0x34, 0x95, 0x86, 0x09, 0x16, 0x54, 0x95, 0xc9, 0x3c,
-	0x81, 0x90, 0x78, 0xd8, 0xb2, 0xa4, 0x0e, 0x69, 0x60, 0x23, 0x92, 0xd7,
-	0x36, 0x09, 0x24, 0x75, 0x1d, 0x88, 0xe6, 0x7c, 0xae, 0x14, 0xba, 0x5a,
-	0x8b, 0x56, 0x95, 0xf3, 0x06, 0x15, 0xa6, 0x25, 0x18, 0x76, 0x1d, 0xfc,
-	0x45, 0xfc, 0xac, 0x96, 0xde, 0x25, 0x22, 0xf1, 0x74, 0xa1, 0x14, 0x01,
-	0x80, 0x80, 0x05, 0x49, 0xd2, 0x0b, 0x10, 0x20, 0x26, 0x60, 0x85, 0x52,
-	0x13, 0x84, 0xad, 0xbe, 0x15, 0xc2, 0x12, 0x56, 0xd4, 0xa7, 0x06, 0x03,
-	0x41, 0x2b, 0x0c, 0x94, 0x16, 0x1d, 0x28, 0x05, 0x7a, 0x8a, 0xff, 0xfb,
-	0x22, 0xc4, 0xe8, 0x00, 0x07, 0x24, 0x69, 0x2f, 0x27, 0x98, 0xa5, 0x80,
-	0xf2, 0x91, 0x2a, 0x34, 0x90, 0x8a, 0xd6, 0x80, 0x82, 0xbf, 0xca, 0x6d,
-	0xef, 0xb2, 0x9f, 0xc9, 0xdc, 0xf4, 0xd0, 0xc4, 0xa9, 0x75, 0x00, 0x22,
-	0xef, 0x22, 0x99, 0x41, 0xd4, 0x4d, 0x3b, 0x0e, 0x2e, 0x82, 0x04, 0x19,
-	0x04, 0x5b, 0x06, 0xd2, 0x69, 0xac, 0x9a, 0xf5, 0x1f, 0x96, 0x52, 0x6e,
-	0x48, 0x04, 0x1d, 0x16, 0x5c, 0x13, 0x60, 0x65, 0x63, 0x15, 0x9a, 0xda,
-	0x17, 0x7d, 0x11, 0xe8, 0xe7, 0x2c, 0xf5, 0x76, 0xf6, 0xd0, 0x10, 0x09,
-	0x49, 0x24, 0x24, 0x30, 0x29, 0x00, 0xf9, 0x2f, 0x83, 0x82, 0x30, 0x12,
-	0x61, 0x0e, 0x5d, 0x13, 0x94, 0x34, 0x26, 0x34, 0xf0, 0x51, 0xa4, 0x26,
-	0x31, 0x61, 0xa0, 0x45, 0x84, 0x62, 0x79, 0xe6, 0x31, 0xc3, 0x83, 0xa3,
-	0x9f, 0xbf, 0x84, 0xed, 0x25, 0x8b, 0xaf, 0xd2, 0xf9, 0xff, 0xfb, 0x22,
-	0xc4, 0xe4, 0x00, 0x06, 0x20, 0x31, 0x5b, 0xa4, 0xa4, 0xc0, 0x70, 0xe5,
-	0x91, 0x25, 0x95, 0x86, 0x08, 0x38, 0xef, 0xfd, 0xab, 0x5c, 0x9a, 0x09,
-	0xa6, 0x02, 0x40, 0x44, 0x08, 0xd0, 0xe9, 0x4a, 0xbd, 0x4e, 0xb3, 0xd2,
-	0x46, 0x20, 0x16, 0x2a, 0x47, 0xa1, 0xc4, 0x8b, 0x49, 0x93, 0x8d, 0xf3,
-	0x86, 0xe8, 0x95, 0x61, 0xe0, 0x3c, 0xb9, 0x23, 0x53, 0xe0, 0xb0, 0x2c,
-	0xeb, 0x8c, 0xd7, 0x42, 0x6b, 0xba, 0x11, 0x1a, 0xfd, 0x8f, 0xf5, 0x33,
-	0xbf, 0xea, 0x4e, 0xc9, 0x6d, 0x71, 0xfd, 0xaa, 0x82, 0xe1, 0xb8, 0x78,
-	0x07, 0x22, 0x42, 0xba, 0x08, 0x5a, 0x15, 0xc2, 0x85, 0x96, 0x60, 0xab,
-	0x02, 0xde, 0x2a, 0x91, 0x42, 0x8f, 0x48, 0x35, 0x3c, 0xa3, 0x55, 0xee,
-	0x72, 0x63, 0x94, 0xd4, 0x39, 0x8c, 0x73, 0xba, 0x93, 0xff, 0x77, 0x15,
-	0x14, 0xfe, 0x3a, 0x00, 0xc6, 0x92, 0x40, 0xb0, 0xff, 0xfb, 0x20, 0xc4,
-	0xe5, 0x80, 0x06, 0x84, 0x69, 0x51, 0x84, 0x98, 0x67, 0x31, 0x6d, 0xa1,
-	0x27, 0x54, 0xc1, 0x9b, 0xc9, 0xb5, 0x00, 0x6a, 0x39, 0x36, 0x29, 0x0b,
-	0x86, 0xc6, 0xce, 0xc0, 0x95, 0xb2, 0x4b, 0x47, 0x2d, 0xa1, 0x23, 0xa8,
-	0x02, 0xa1, 0x81, 0x41, 0x00, 0x7d, 0xa8, 0x4e, 0xec, 0x4b, 0xb0, 0x3b,
-	0xf2, 0x83, 0x68, 0x7b, 0x2c, 0xac, 0xb1, 0x5a, 0x37, 0x31, 0xdf, 0xaf,
-	0x6d, 0x42, 0x57, 0xe5, 0x68, 0x8d, 0x02, 0x64, 0x62, 0xa3, 0x17, 0x40,
-	0x57, 0x4d, 0xad, 0xe2, 0xc2, 0x88, 0x16, 0x4d, 0xbc, 0xe1, 0xed, 0x97,
-	0x1a, 0x83, 0xbe, 0x69, 0xc3, 0x32, 0x10, 0x63, 0x2d, 0x20, 0x12, 0xc2,
-	0xc2, 0x64, 0xa0, 0x19, 0x24, 0xda, 0x97, 0x41, 0x22, 0x79, 0x7f, 0x57,
-	0x7b, 0x3a, 0xef, 0xd0, 0x2c, 0x18, 0x92, 0x93, 0x04, 0x44, 0x9c, 0x0c,
-	0xe9, 0x35, 0x82, 0x90, 0xbd, 0xa9, 0xff, 0xfb, 0x22, 0xc4, 0xd4, 0x00,
-	0x07, 0x10, 0x79, 0x49, 0x84, 0x98, 0x4c, 0xc0, 0xd1, 0x06, 0xe7, 0x24,
-	0xc4, 0x98, 0x28, 0x93, 0xc6, 0x49, 0x5c, 0x24, 0x3f, 0x74, 0x8e, 0x28,
-	0xd1, 0x6c, 0x55, 0x4d, 0x64, 0xa1, 0xa1, 0xce, 0xef, 0x21, 0x63, 0x57,
-	0x05, 0x51, 0x6b, 0x6b, 0x03, 0x8c, 0xac, 0x9f, 0x92, 0xae, 0x85, 0x2c,
-	0x82, 0xfb, 0xb7, 0xff, 0x42, 0x63, 0xab, 0x5c, 0xa6, 0xdb, 0x6c, 0xaf,
-	0xea, 0x94, 0x1f, 0x12, 0x62, 0x56, 0xc8, 0x3c, 0x7a, 0x28, 0x9f, 0x17,
-	0x1e, 0xd8, 0xbc, 0x3b, 0x18, 0xb8, 0xce, 0x26, 0x7d, 0xd5, 0xaf, 0x6f,
-	0xde, 0x5d, 0xc0, 0x36, 0x49, 0xb5, 0x51, 0x2c, 0x45, 0xdf, 0xc3, 0x6a,
-	0xa1, 0x79, 0xf4, 0x74, 0x63, 0xff, 0xa6, 0xfa, 0x6d, 0x25, 0x19, 0x00,
-	0x24, 0x83, 0xc1, 0x48, 0x7a, 0x00, 0x2f, 0x40, 0x01, 0x1b, 0x63, 0xba,
-	0x01, 0x22, 0xd3, 0x6b, 0x38, 0xff, 0xfb, 0x20, 0xc4, 0xd4, 0x80, 0x06,
-	0x40, 0x43, 0x32, 0xac, 0x24, 0xc0, 0x00, 0xca, 0x86, 0x67, 0x30, 0xf4,
-	0x98, 0x00, 0xc0, 0x83, 0xf4, 0x42, 0x4b, 0x4e, 0x65, 0x1c, 0xbf, 0xb3,
-	0xd3, 0x3e, 0x1c, 0xcc, 0x41, 0x30, 0x86, 0xee, 0xc6, 0x3d, 0x63, 0xf0,
-	0xc6, 0xdd, 0xd6, 0xf4, 0x7a, 0xd0, 0xdd, 0x21, 0x42, 0x00, 0xa4, 0x4e,
-	0xb9, 0x1a, 0xd9, 0x08, 0xc5, 0xd5, 0x50, 0x06, 0xde, 0x89, 0x92, 0x32,
-	0x4e, 0x58, 0xce, 0x3d, 0xd5, 0xf6, 0x96, 0x41, 0xf6, 0x10, 0x62, 0xaa,
-	0x96, 0xb1, 0x92, 0xde, 0xef, 0xb8, 0x03, 0x39, 0x79, 0x76, 0xcf, 0xee,
-	0x60, 0x8a, 0x99, 0xfc, 0x30, 0x75, 0x24, 0x52, 0x71, 0xc7, 0x5e, 0xb2,
-	0xb9, 0x36, 0xf8, 0xb5, 0xd4, 0xd8, 0xe5, 0x9f, 0x6f, 0xb6, 0xfe, 0xdb,
-	0x23, 0x81, 0x80, 0xc6, 0x6b, 0x21, 0xe3, 0xf5, 0x19, 0xdf, 0xac, 0x7a,
-	0x8d, 0xad, 0x74, 0xff, 0xfb, 0x22, 0xc4, 0xd8, 0x80, 0x06, 0x60, 0x3b,
-	0x37, 0x27, 0x84, 0xc4, 0x00, 0xc3, 0x08, 0x6a, 0x30, 0xb4, 0x8c, 0x36,
-	0xf9, 0xda, 0xd2, 0x33, 0x30, 0x3a, 0xd0, 0x94, 0xf4, 0x9e, 0xe7, 0xe0,
-	0x46, 0xd8, 0x51, 0xc9, 0xb2, 0x28, 0x55, 0xae, 0x42, 0x7f, 0xbb, 0x10,
-	0x49, 0x25, 0x6b, 0x23, 0x47, 0xfe, 0xb3, 0x42, 0x75, 0x48, 0x28, 0x05,
-	0x00, 0x66, 0x90, 0x84, 0xc2, 0x8c, 0x2a, 0x6c, 0x9a, 0xf0, 0xb4, 0x43,
-	0x03, 0x62, 0x76, 0xea, 0xd6, 0x6d, 0x23, 0x11, 0x16, 0xfa, 0x4c, 0xa7,
-	0x32, 0x35, 0xe8, 0xad, 0xd0, 0xd7, 0x90, 0xa3, 0x82, 0xe8, 0xcf, 0x27,
-	0xd2, 0x0d, 0xdc, 0x41, 0xc5, 0x70, 0xfd, 0xbf, 0x39, 0xb2, 0xae, 0x72,
-	0x32, 0x8a, 0x15, 0x02, 0x2a, 0x03, 0x00, 0x03, 0x70, 0x98, 0xa4, 0x5b,
-	0xc7, 0x4a, 0xab, 0x02, 0xf9, 0x31, 0x86, 0x8f, 0x2d, 0x46, 0xb1, 0xc4,
-	0x48, 0xc5, 0xff, 0xfb, 0x22, 0xc4, 0xdd, 0x80, 0x06, 0x2c, 0x2d, 0x3b,
-	0x86, 0x30, 0xc0, 0x80, 0xda, 0x89, 0x27, 0x24, 0xf8, 0x18, 0x40, 0x0b,
-	0x52, 0x84, 0x2b, 0xc2, 0x42, 0xa4, 0xd7, 0x61, 0x82, 0xd3, 0xaf, 0x42,
-	0x1d, 0x86, 0x13, 0xd6, 0x89, 0xf2, 0xb8, 0x84, 0x24, 0x1d, 0x3d, 0x6f,
-	0x30, 0x3c, 0xaf, 0xab, 0xf7, 0x53, 0xac, 0x15, 0x65, 0xb6, 0xc4, 0xfe,
-	0xd2, 0x12, 0x27, 0x81, 0xd0, 0x51, 0x84, 0x68, 0xf6, 0x2b, 0xcc, 0x74,
-	0x44, 0x86, 0x19, 0xa1, 0x52, 0x87, 0xc8, 0x7a, 0x60, 0xd4, 0xf6, 0x47,
-	0x96, 0xfc, 0xd5, 0x1d, 0x48, 0xfa, 0x10, 0xc2, 0xa8, 0x60, 0x66, 0x5c,
-	0xcb, 0x75, 0x1e, 0x39, 0x91, 0x93, 0x3a, 0x85, 0xd6, 0xb9, 0x71, 0xbb,
-	0x06, 0x69, 0xda, 0x85, 0xdc, 0x95, 0x1a, 0x22, 0x00, 0x1c, 0xa8, 0xd0,
-	0x0d, 0x80, 0x50, 0x54, 0x91, 0x6c, 0xcd, 0x4d, 0x54, 0x6b, 0xb5, 0x97,
-	0x6b, 0xff, 0xfb, 0x20, 0xc4, 0xe0, 0x80, 0x06, 0x54, 0x43, 0x3b, 0x87,
-	0xa4, 0x65, 0x40, 0xc9, 0x08, 0x6a, 0x70, 0xf6, 0x08, 0x7e, 0xa3, 0x6d,
-	0x20, 0x45, 0x50, 0x09, 0x6d, 0x75, 0x8e, 0x97, 0x28, 0x0b, 0x9f, 0x4c,
-	0xc6, 0xb5, 0x33, 0xd6, 0x24, 0x77, 0x34, 0x4e, 0xbd, 0x74, 0xf4, 0xe4,
-	0xb6, 0x3d, 0x02, 0xfb, 0x0a, 0x50, 0x00, 0x80, 0x9e, 0xc1, 0x80, 0x4a,
-	0x3a, 0x82, 0x63, 0x21, 0xf4, 0xc9, 0x60, 0xd1, 0xac, 0x71, 0x35, 0xdf,
-	0x24, 0x22, 0x29, 0x53, 0x8e, 0xbc, 0x60, 0x58, 0xa3, 0x05, 0xc7, 0x82,
-	0x42, 0xc5, 0x5c, 0xd3, 0xa0, 0xd1, 0x24, 0x99, 0x50, 0xa2, 0x47, 0xaa,
-	0x42, 0x78, 0x52, 0x9b, 0x6c, 0xbf, 0x47, 0x6d, 0xfd, 0x55, 0xf1, 0x8b,
-	0x02, 0xa6, 0x01, 0x00, 0x5e, 0x03, 0x4b, 0x7d, 0x9f, 0x40, 0x61, 0xc1,
-	0x82, 0xa9, 0x27, 0x48, 0x14, 0x10, 0xbc, 0x3a, 0x10, 0x0e, 0x89, 0xff,
-	0xfb, 0x22, 0xc4, 0xe4, 0x80, 0x06, 0x0c, 0x67, 0x32, 0xa7, 0x98, 0x65,
-	0x40, 0xec, 0x93, 0x65, 0xd5, 0x83, 0x0c, 0xb8, 0x56, 0xbc, 0x4f, 0x55,
-	0x48, 0x70, 0xfb, 0xf6, 0x74, 0xfa, 0xcb, 0x8a, 0x12, 0xbc, 0x89, 0x25,
-	0xe6, 0xc5, 0xc7, 0xa8, 0x08, 0x39, 0xca, 0x22, 0x8d, 0xc4, 0x76, 0x2f,
-	0x61, 0xef, 0x75, 0xfb, 0x45, 0x9c, 0x77, 0x2f, 0x99, 0x88, 0x39, 0xaf,
-	0xb8, 0x8c, 0x84, 0x7d, 0xc8, 0x3c, 0x48, 0x00, 0x94, 0x0c, 0x7d, 0x04,
-	0x54, 0x45, 0x50, 0x36, 0x27, 0xf9, 0x9f, 0x74, 0xf2, 0x06, 0xee, 0x80,
-	0x83, 0x0f, 0x13, 0x82, 0x0e, 0x22, 0xa5, 0x87, 0x9c, 0xe9, 0xa3, 0xa2,
-	0x37, 0xb1, 0x10, 0x01, 0x4a, 0xb7, 0xd2, 0x3b, 0x6f, 0x19, 0xb4, 0x8a,
-	0x13, 0x35, 0x66, 0x78, 0x46, 0x5b, 0x5c, 0x48, 0x30, 0x0a, 0x81, 0x01,
-	0xa0, 0xa9, 0x0d, 0x6d, 0x2b, 0xa9, 0x55, 0x5c, 0x8a, 0x3e, 0xff, 0xfb,
-	0x22, 0xc4, 0xe5, 0x80, 0x06, 0x6c, 0x41, 0x61, 0xa7, 0xb0, 0x63, 0xb0,
-	0xdb, 0x91, 0x66, 0xa4, 0xf4, 0x88, 0x70, 0xb9, 0x53, 0x24, 0xad, 0x2e,
-	0xb5, 0x9b, 0x0b, 0x64, 0x6d, 0x8b, 0x44, 0x4f, 0xa0, 0xc1, 0x85, 0x49,
-	0x04, 0xb0, 0x90, 0xeb, 0x4e, 0x31, 0x62, 0x89, 0x7f, 0xf7, 0xff, 0xfd,
-	0xa4, 0x28, 0xc9, 0x88, 0x20, 0x00, 0x87, 0x00, 0xb6, 0xd2, 0x5d, 0x8e,
-	0x09, 0x49, 0xdb, 0x19, 0x27, 0x26, 0x10, 0x7c, 0xd3, 0x0a, 0x23, 0x40,
-	0x71, 0x72, 0xda, 0x52, 0x18, 0x91, 0xe7, 0x7f, 0x99, 0x1d, 0x6d, 0x72,
-	0x18, 0x28, 0x23, 0xb3, 0x51, 0xef, 0xbe, 0xec, 0x9a, 0xa1, 0x9d, 0xb1,
-	0xa6, 0x43, 0xcb, 0x7e, 0x1c, 0x46, 0x6f, 0xf2, 0xde, 0x56, 0x5a, 0x06,
-	0x9a, 0x11, 0x00, 0x18, 0x0c, 0x90, 0x3f, 0x1e, 0xac, 0x48, 0x87, 0x22,
-	0x68, 0x16, 0x0c, 0x64, 0x83, 0x20, 0x48, 0xc8, 0xc2, 0xff, 0xfb, 0x20,
-	0xc4, 0xe7, 0x00, 0x06, 0xd8, 0x8d, 0x31, 0x07, 0x98, 0xa5, 0x40, 0xeb,
-	0x0d, 0x28, 0x30, 0xb4, 0x8c, 0x3c, 0x08, 0x19, 0x09, 0x28, 0xee, 0x17,
-	0x75, 0x08, 0xd4, 0xbe, 0xff, 0x94, 0xcc, 0x89, 0x1e, 0x87, 0xa1, 0xe9,
-	0x26, 0x7e, 0xd3, 0xec, 0x80, 0x3b, 0xce, 0x79, 0x9d, 0x3a, 0xf6, 0x0f,
-	0xb2, 0xa2, 0xba, 0xb2, 0x18, 0x40, 0x40, 0xc0, 0x31, 0x16, 0x17, 0x01,
-	0xc2, 0xa6, 0x01, 0x99, 0x27, 0xa1, 0x24, 0x21, 0x93, 0x2c, 0x76, 0x6d,
-	0x0c, 0x42, 0x65, 0x41, 0xb3, 0xe0, 0xe1, 0xe1, 0xc7, 0x94, 0x02, 0x24,
-	0xc1, 0x82, 0x26, 0x05, 0x52, 0x55, 0x87, 0x51, 0x16, 0x68, 0xaf, 0x89,
-	0x50, 0xa7, 0xaa, 0xe6, 0xc8, 0xff, 0xba, 0xce, 0x9a, 0x21, 0xa6, 0x13,
-	0x4c, 0x00, 0x20, 0x94, 0xfc, 0x45, 0x01, 0x09, 0x1d, 0x24, 0xd7, 0x34,
-	0xc8, 0xb9, 0x84, 0x79, 0x2b, 0x46, 0x81, 0xff, 0xfb, 0x22, 0xc4, 0xe4,
-	0x80, 0x05, 0xec, 0x2d, 0x35, 0x07, 0xa5, 0x20, 0x00, 0xe6, 0x88, 0xa6,
-	0x25, 0x06, 0x14, 0x28, 0x75, 0x01, 0xa2, 0x41, 0xb2, 0xbd, 0xb5, 0x74,
-	0x6c, 0x99, 0x7a, 0xa0, 0x30, 0x4c, 0xbc, 0x44, 0x26, 0x0d, 0xda, 0x3d,
-	0x79, 0xc1, 0x24, 0xa1, 0xf1, 0xcf, 0xa5, 0x91, 0x86, 0x19, 0xbf, 0x71,
-	0x16, 0xd8, 0x64, 0xb6, 0x4c, 0xe4, 0x91, 0x34, 0x88, 0x01, 0x56, 0x96,
-	0x04, 0x06, 0x8d, 0x99, 0x36, 0x4e, 0x40, 0x84, 0x50, 0xc2, 0x88, 0x38,
-	0x9c, 0xdb, 0xc0, 0x02, 0x62, 0xe3, 0x87, 0x20, 0x62, 0x88, 0x0c, 0xc0,
-	0x01, 0x0c, 0xc0, 0xc4, 0x69, 0x03, 0xa5, 0xa7, 0x4e, 0xdf, 0xfc, 0x9f,
-	0xd7, 0x02, 0x16, 0x42, 0x10, 0x18, 0x12, 0x02, 0x68, 0xb8, 0x48, 0x30,
-	0x33, 0xb8, 0x41, 0x6c, 0xa6, 0xba, 0x04, 0x24, 0xb0, 0x21, 0x48, 0x32,
-	0x81, 0xa4, 0x0b, 0x4b, 0x13, 0xb6, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00,
-	0x46, 0xe8, 0x67, 0x33, 0x0c, 0x18, 0x63, 0x80, 0xdd, 0x8d, 0x25, 0xc0,
-	0xf4, 0x8c, 0x90, 0xa1, 0x5d, 0x62, 0x39, 0x77, 0x6b, 0xf7, 0x53, 0x5d,
-	0xa5, 0x88, 0x3a, 0x95, 0xaa, 0xe5, 0x48, 0x99, 0x80, 0x8f, 0xd4, 0xad,
-	0xf0, 0xd4, 0xc3, 0x59, 0x17, 0x63, 0x90, 0xca, 0xc3, 0x8b, 0x05, 0x09,
-	0xdc, 0x5e, 0x19, 0x5f, 0x40, 0x01, 0xfe, 0x11, 0x95, 0x09, 0x94, 0x86,
-	0xaa, 0xc5, 0x5d, 0x14, 0x60, 0x38, 0xa1, 0x84, 0xf2, 0xdc, 0x58, 0xf4,
-	0x09, 0xc4, 0xf4, 0xcb, 0x32, 0xfc, 0x5d, 0x13, 0xf3, 0xef, 0x79, 0xd8,
-	0xe1, 0x05, 0xb2, 0xd6, 0xcb, 0x1d, 0x3b, 0x08, 0xe5, 0xec, 0xc5, 0x48,
-	0x7f, 0xdb, 0xd0, 0x07, 0x99, 0x51, 0x0c, 0x4a, 0x81, 0x65, 0x92, 0x80,
-	0xf8, 0xb1, 0x0c, 0x41, 0x55, 0x09, 0x5c, 0xed, 0x59, 0x81, 0x4a, 0x0d,
-	0xd7, 0x15, 0xfc, 0x54, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xc4,
-	0x43, 0x45, 0xe6, 0x04, 0x70, 0x60, 0xde, 0x93, 0xe6, 0x14, 0xf3, 0x08,
-	0xb8, 0x41, 0x08, 0xa3, 0x06, 0x71, 0xca, 0x3e, 0x67, 0xbf, 0xd3, 0x22,
-	0xfa, 0x77, 0x77, 0x07, 0x52, 0x8e, 0x73, 0xa2, 0xe6, 0xda, 0x5b, 0x47,
-	0x7e, 0xae, 0xc0, 0xcb, 0x71, 0x4c, 0xe6, 0xf0, 0xa8, 0xd3, 0xc8, 0x13,
-	0x02, 0xde, 0x4c, 0xe2, 0x16, 0x2b, 0xa1, 0xf2, 0xd5, 0xf4, 0x5c, 0xd9,
-	0x66, 0x95, 0xb2, 0x62, 0x73, 0xf1, 0x92, 0xd7, 0x16, 0x08, 0x5c, 0x09,
-	0x11, 0x2c, 0x86, 0xfd, 0x0d, 0xce, 0x28, 0x0a, 0x83, 0xa9, 0x86, 0x42,
-	0x99, 0xca, 0xa0, 0xd8, 0xa0, 0x53, 0x0d, 0x92, 0x24, 0xa9, 0x80, 0x4a,
-	0x45, 0xae, 0xbb, 0xb3, 0x5d, 0x15, 0xec, 0x0d, 0xc9, 0x24, 0x6d, 0xf5,
-	0x0a, 0x01, 0x61, 0x20, 0x11, 0x60, 0x10, 0x83, 0xef, 0x0c, 0x13, 0x60,
-	0x86, 0x8f, 0xee, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xb0, 0x6b,
-	0x33, 0x27, 0x98, 0x65, 0x40, 0xdc, 0x05, 0x66, 0xa4, 0xf3, 0x24, 0x90,
-	0x79, 0x02, 0xd7, 0x16, 0x54, 0x35, 0xe5, 0x21, 0xc1, 0xa0, 0xcb, 0x16,
-	0x24, 0x7b, 0xc5, 0x40, 0x82, 0xc4, 0x96, 0xb3, 0x5e, 0x73, 0xe3, 0x57,
-	0xd3, 0xf7, 0x1b, 0xda, 0x95, 0x87, 0x24, 0xb7, 0x28, 0x39, 0x59, 0x43,
-	0x82, 0xb0, 0x6c, 0x59, 0x3a, 0x23, 0x41, 0xcd, 0x9d, 0x42, 0x76, 0xe2,
-	0x64, 0x7a, 0x07, 0x0c, 0x1b, 0x71, 0xec, 0x4e, 0x42, 0xa3, 0xa7, 0x48,
-	0xed, 0x52, 0xed, 0xb9, 0xac, 0x09, 0x1f, 0xd5, 0xbf, 0x98, 0x35, 0xcf,
-	0x49, 0x41, 0x43, 0x72, 0x35, 0x13, 0x30, 0x5c, 0x5c, 0xbf, 0x7e, 0x84,
-	0x5c, 0xe4, 0x0e, 0x9e, 0x75, 0x06, 0xeb, 0xe2, 0x84, 0x68, 0x28, 0x2c,
-	0x42, 0x04, 0x38, 0x88, 0x4b, 0xcf, 0x61, 0x09, 0x80, 0x82, 0xc6, 0xcc,
-	0x2c, 0x0d, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06, 0xfc, 0x65, 0x33,
-	0x06, 0x24, 0x43, 0x80, 0xbc, 0x04, 0xea, 0xb4, 0x93, 0x18, 0x46, 0x03,
-	0xa4, 0xa6, 0x5a, 0x34, 0x79, 0xc5, 0xcf, 0x83, 0x87, 0x9a, 0xb0, 0x81,
-	0x1a, 0x80, 0xcd, 0x72, 0x5e, 0xde, 0xc7, 0xd4, 0x5a, 0xa0, 0x10, 0xa6,
-	0xc4, 0xb6, 0x02, 0x45, 0xdc, 0x78, 0x4b, 0x9b, 0x02, 0x24, 0x4c, 0x0c,
-	0xe8, 0xc3, 0x12, 0xa6, 0x04, 0x03, 0x91, 0x6e, 0x19, 0x62, 0xf0, 0xa4,
-	0x13, 0x27, 0xa8, 0x12, 0x28, 0x87, 0xd3, 0x81, 0x50, 0x58, 0x9b, 0x54,
-	0x15, 0x1f, 0xb0, 0x5a, 0x50, 0x98, 0xda, 0x42, 0x23, 0xb6, 0x5e, 0xc1,
-	0x45, 0x61, 0x6c, 0x31, 0x73, 0xd2, 0xeb, 0x29, 0x7d, 0x68, 0x52, 0xd5,
-	0xcf, 0xa1, 0x01, 0x52, 0x00, 0x00, 0x0b, 0x41, 0xb2, 0x3f, 0x8e, 0x61,
-	0xe2, 0x8d, 0x66, 0x9a, 0xb1, 0xa5, 0x8f, 0xa2, 0x59, 0x04, 0x91, 0x98,
-	0xff, 0xfb, 0x22, 0xc4, 0xe9, 0x80, 0x08, 0x20, 0x67, 0x31, 0x27, 0xa4,
-	0x47, 0xc0, 0xbf, 0x8d, 0x26, 0x54, 0xf3, 0x08, 0xb8, 0x8b, 0x70, 0x43,
-	0x63, 0x0a, 0xd9, 0xd9, 0x8e, 0x85, 0x9f, 0xf6, 0xdc, 0xcf, 0x62, 0xaf,
-	0x54, 0xf7, 0x6c, 0x6c, 0xa0, 0xd7, 0x2c, 0xb8, 0x70, 0x6c, 0xc0, 0xc5,
-	0xa9, 0xb8, 0xb6, 0xed, 0x9e, 0xfd, 0xb4, 0x28, 0xac, 0xb6, 0xca, 0xff,
-	0xe9, 0x02, 0x62, 0x62, 0xe2, 0x62, 0x4d, 0xa9, 0x5a, 0x8b, 0x0a, 0x48,
-	0x04, 0xc2, 0x56, 0x54, 0x4d, 0x73, 0xcd, 0x34, 0xcb, 0x3d, 0xd5, 0x36,
-	0xd1, 0x0f, 0xf5, 0x2e, 0xee, 0x55, 0x10, 0x46, 0xc0, 0xab, 0x6d, 0x1a,
-	0xf7, 0x5f, 0x8b, 0xd2, 0xa5, 0x2b, 0xba, 0xc2, 0xfe, 0x85, 0x16, 0xa7,
-	0x12, 0x0c, 0x3f, 0x40, 0x44, 0x7c, 0x6f, 0x94, 0xb4, 0x83, 0x98, 0x51,
-	0xa4, 0x64, 0x95, 0x5e, 0xcf, 0x0a, 0x25, 0x00, 0x74, 0x41, 0x45, 0xff,
-	0xfb, 0x20, 0xc4, 0xe8, 0x00, 0x07, 0x30, 0x6b, 0x31, 0x0c, 0x30, 0x61,
-	0xc0, 0xe6, 0x0d, 0xa5, 0xc0, 0xf6, 0x0c, 0x70, 0xa7, 0x8f, 0xea, 0xdf,
-	0xae, 0xf3, 0x1f, 0xb7, 0xed, 0x8f, 0xad, 0xf9, 0x7d, 0x07, 0x4c, 0x40,
-	0xb7, 0x87, 0xd8, 0xab, 0x1f, 0x7b, 0x8a, 0x3c, 0x48, 0x65, 0x94, 0x2b,
-	0x2e, 0xf5, 0x5f, 0x40, 0xad, 0x34, 0x21, 0x46, 0x77, 0xae, 0x7f, 0xa6,
-	0xd1, 0x00, 0x0a, 0x34, 0xaa, 0x99, 0xf1, 0x9e, 0xb8, 0x8d, 0xaa, 0xd1,
-	0x4a, 0xa5, 0xb5, 0xaf, 0x74, 0xfc, 0x8c, 0xe7, 0xd4, 0x49, 0x0e, 0x05,
-	0x2d, 0x27, 0x37, 0x50, 0x73, 0x01, 0x3c, 0x04, 0x93, 0xb2, 0x14, 0x10,
-	0x20, 0x18, 0x85, 0xbc, 0x4c, 0xf7, 0xae, 0xba, 0x69, 0x93, 0x46, 0x59,
-	0x80, 0xe7, 0x24, 0xf5, 0x6c, 0x9b, 0x37, 0x29, 0xac, 0xbe, 0x5f, 0x3c,
-	0x3d, 0xff, 0xf7, 0xe3, 0xcc, 0x91, 0x0b, 0xb8, 0xf3, 0xff, 0xfb, 0x22,
-	0xc4, 0xe5, 0x00, 0x06, 0x24, 0x43, 0x4d, 0x83, 0x18, 0x67, 0x30, 0xee,
-	0x11, 0x67, 0xb0, 0xc1, 0x89, 0xa4, 0x98, 0x1a, 0x7f, 0xff, 0xe4, 0xc3,
-	0x49, 0x99, 0x7c, 0xdc, 0xd1, 0x6f, 0xff, 0xff, 0xf9, 0x7c, 0xbe, 0x6e,
-	0xaa, 0xaa, 0x6a, 0x92, 0x88, 0x20, 0x82, 0x08, 0x00, 0x59, 0x73, 0x02,
-	0x44, 0x54, 0x82, 0x6c, 0x28, 0x4c, 0x47, 0xdb, 0x08, 0x2f, 0x02, 0x7b,
-	0x1e, 0x69, 0x04, 0x93, 0xcc, 0x50, 0x7c, 0x10, 0x10, 0x2a, 0x13, 0x1b,
-	0x48, 0x3a, 0xcb, 0x82, 0xc5, 0x98, 0xd4, 0x5b, 0xab, 0x15, 0x1b, 0x72,
-	0x61, 0x72, 0x44, 0x87, 0xa2, 0x17, 0xfd, 0x61, 0xfc, 0xdb, 0x92, 0x1f,
-	0xf1, 0x65, 0xc9, 0x36, 0xb8, 0xfe, 0x52, 0x21, 0x4f, 0x57, 0xe6, 0xe2,
-	0xe3, 0x5a, 0x9f, 0xff, 0x69, 0x7e, 0x5f, 0x63, 0x29, 0xc7, 0x03, 0x2e,
-	0x64, 0x97, 0x81, 0x3e, 0xc7, 0x0b, 0x69, 0x44, 0xff, 0xfb, 0x22, 0xc4,
-	0xe5, 0x80, 0x46, 0xc0, 0x2f, 0x37, 0x24, 0x99, 0x26, 0xc0, 0xd7, 0x05,
-	0xe6, 0xec, 0xf6, 0x18, 0x08, 0x04, 0x3b, 0x20, 0x69, 0xd2, 0xc7, 0x0b,
-	0xae, 0x84, 0xc3, 0xd6, 0x0c, 0x16, 0xdd, 0x32, 0x8d, 0x08, 0x2c, 0x06,
-	0x09, 0x80, 0x58, 0x1c, 0x2a, 0x75, 0xe1, 0xb3, 0x30, 0x98, 0xd9, 0x44,
-	0x2e, 0x0a, 0x87, 0x42, 0x6a, 0xa6, 0x0a, 0x86, 0xf5, 0x3d, 0xa9, 0x14,
-	0x3d, 0x6f, 0xe9, 0xa9, 0x3e, 0x3a, 0x55, 0x28, 0x60, 0xb5, 0x40, 0x2d,
-	0xc6, 0x91, 0xd3, 0x25, 0x16, 0x26, 0x26, 0x21, 0x13, 0x2d, 0x2d, 0x90,
-	0x78, 0xa1, 0x0c, 0xb1, 0x25, 0x4c, 0xf4, 0x9f, 0xb1, 0xd5, 0xd9, 0xfd,
-	0x85, 0x02, 0xbb, 0x19, 0xb2, 0x91, 0x6c, 0x0c, 0x4b, 0xc4, 0x32, 0x7f,
-	0x9d, 0xa7, 0xc4, 0x5d, 0x74, 0x58, 0x8e, 0xb8, 0x32, 0x2c, 0x1e, 0x3b,
-	0x47, 0x51, 0x28, 0xd4, 0xff, 0x59, 0x20, 0xff, 0xfb, 0x20, 0xc4, 0xe6,
-	0x80, 0x07, 0x04, 0x79, 0x2f, 0x07, 0xa4, 0x65, 0x40, 0xc9, 0x8d, 0x2a,
-	0x70, 0x90, 0x8a, 0x56, 0xc2, 0x10, 0x00, 0x90, 0xc1, 0x20, 0x2c, 0x01,
-	0x81, 0xf0, 0x97, 0x60, 0x68, 0xc0, 0xc4, 0x85, 0x8b, 0x59, 0x12, 0x40,
-	0x51, 0x6e, 0x92, 0x27, 0xec, 0x36, 0xb9, 0xb4, 0xa3, 0x61, 0x66, 0x5b,
-	0xea, 0xa2, 0xdd, 0x34, 0x1f, 0x53, 0x48, 0x0a, 0x1e, 0xe9, 0x16, 0x6a,
-	0x44, 0x2f, 0x0d, 0xde, 0x39, 0x37, 0x7d, 0x26, 0x64, 0x14, 0x41, 0x5b,
-	0xaa, 0x50, 0x00, 0x42, 0xe0, 0x07, 0x5a, 0x82, 0x0e, 0x1d, 0xad, 0x2c,
-	0xc6, 0x9d, 0x69, 0xf2, 0xb8, 0x4d, 0x97, 0x11, 0x71, 0x05, 0x61, 0xa8,
-	0xd5, 0x34, 0x7b, 0x73, 0x46, 0x8b, 0xdb, 0xce, 0x23, 0x6d, 0x02, 0x14,
-	0xe6, 0xa6, 0xf6, 0xae, 0x85, 0x8e, 0xd4, 0x60, 0xda, 0x44, 0x25, 0x16,
-	0x30, 0x72, 0xdc, 0x14, 0xda, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x07,
-	0xd8, 0x69, 0x33, 0x14, 0xf3, 0x00, 0x01, 0x64, 0xa5, 0xe8, 0x17, 0x1e,
-	0xd0, 0x00, 0x95, 0xea, 0x46, 0x5a, 0x45, 0xa0, 0x6a, 0x48, 0x31, 0x84,
-	0x38, 0x01, 0x89, 0xc8, 0x77, 0xd0, 0x19, 0xd1, 0x61, 0xcc, 0x68, 0x98,
-	0xf2, 0xa2, 0x0c, 0x33, 0xc7, 0x18, 0x77, 0x8e, 0x10, 0x36, 0x84, 0x16,
-	0x18, 0xac, 0x19, 0x39, 0x8a, 0xaf, 0x56, 0x18, 0xa0, 0x18, 0x94, 0xc8,
-	0xa4, 0xf4, 0xee, 0x6e, 0x3e, 0xe0, 0x7d, 0xa4, 0x5d, 0x55, 0x5d, 0x72,
-	0x5d, 0x5a, 0x2d, 0xe9, 0x0c, 0xc2, 0x88, 0x00, 0x00, 0x10, 0x01, 0xb0,
-	0x2b, 0xe0, 0x98, 0x0e, 0x36, 0x6d, 0xb4, 0xa0, 0x88, 0x81, 0x66, 0xd6,
-	0xbc, 0x53, 0x18, 0x43, 0xd9, 0x32, 0xa1, 0xa9, 0x22, 0xa9, 0x55, 0x5f,
-	0x98, 0x21, 0x77, 0xac, 0x22, 0x70, 0x95, 0xa7, 0x3f, 0x7b, 0xc9, 0x24,
-	0x50, 0x1b, 0x21, 0x24, 0xff, 0xfb, 0x20, 0xc4, 0xd2, 0x80, 0x0b, 0x10,
-	0xef, 0x5f, 0x38, 0x94, 0x00, 0x00, 0xc6, 0x04, 0x6b, 0xb3, 0x92, 0x30,
-	0x00, 0x1c, 0x79, 0x12, 0xee, 0xf2, 0x29, 0x08, 0x69, 0xa7, 0x68, 0x0b,
-	0xc3, 0xa8, 0x4f, 0x03, 0xc6, 0xd7, 0x10, 0xc4, 0x94, 0x9a, 0x48, 0x98,
-	0x1f, 0xa1, 0x2c, 0x54, 0xf6, 0x85, 0xd3, 0xdc, 0xce, 0x4b, 0xa9, 0xbb,
-	0xbb, 0x60, 0xce, 0x94, 0x29, 0x0b, 0x97, 0x09, 0xdc, 0xd7, 0xd3, 0x81,
-	0xee, 0x4a, 0xb0, 0x4f, 0x7e, 0x2b, 0x5a, 0x1d, 0x6b, 0x7d, 0x35, 0x1e,
-	0xc6, 0x00, 0x40, 0x10, 0xa0, 0x30, 0x01, 0x8c, 0x16, 0x9c, 0x53, 0x92,
-	0x2c, 0x6a, 0x82, 0x50, 0x64, 0x93, 0x99, 0x23, 0xcd, 0xea, 0x7a, 0xb8,
-	0x64, 0x9d, 0x62, 0x10, 0x8a, 0x22, 0xc9, 0x53, 0x8a, 0x02, 0x63, 0x0a,
-	0x50, 0x8d, 0x82, 0xea, 0xc8, 0xdf, 0x6c, 0x71, 0x86, 0xc4, 0x5a, 0x21,
-	0x04, 0x60, 0xff, 0xfb, 0x22, 0xc4, 0xc4, 0x00, 0x87, 0xd4, 0xa9, 0x42,
-	0x07, 0xa4, 0x69, 0x80, 0xe6, 0x8a, 0xe8, 0xb0, 0x93, 0x08, 0xf8, 0x05,
-	0xc8, 0xdf, 0x42, 0x2a, 0x8c, 0x70, 0x58, 0x8e, 0xb3, 0xcf, 0xe9, 0x34,
-	0xd8, 0xd9, 0x26, 0x20, 0x8e, 0x03, 0x88, 0x54, 0xc4, 0x56, 0x1a, 0x8d,
-	0x7d, 0xc0, 0x22, 0xd3, 0x23, 0x1c, 0xe1, 0x82, 0x82, 0xcb, 0xce, 0x69,
-	0xe7, 0xfa, 0x93, 0xb7, 0x52, 0x55, 0x52, 0x5b, 0x2d, 0x71, 0xdd, 0xd2,
-	0x81, 0x08, 0x4a, 0x91, 0x0c, 0x37, 0xca, 0x24, 0x08, 0x28, 0xa0, 0x8b,
-	0x48, 0x26, 0xd7, 0xa1, 0x9c, 0x10, 0x34, 0xd3, 0x20, 0xd6, 0xd7, 0x96,
-	0x0e, 0x35, 0x37, 0xda, 0x49, 0xf5, 0x59, 0x3e, 0x51, 0x0f, 0x90, 0xbf,
-	0x3c, 0xeb, 0x3a, 0x3a, 0x6b, 0xac, 0x29, 0x59, 0x00, 0x00, 0x7b, 0x0b,
-	0x82, 0xf1, 0xf2, 0x0e, 0x12, 0xd4, 0x8a, 0x29, 0x68, 0x55, 0x0c, 0x2c,
-	0x36, 0xff, 0xfb, 0x22, 0xc4, 0xbe, 0x80, 0x87, 0x2c, 0x77, 0x3e, 0xa6,
-	0x18, 0x6e, 0xc0, 0xe2, 0x8c, 0x67, 0xe0, 0xf6, 0x0c, 0x30, 0x28, 0x69,
-	0x4e, 0x2c, 0xc4, 0x6f, 0x10, 0x85, 0xd4, 0xb1, 0xa8, 0xa8, 0x7c, 0x15,
-	0x05, 0x4e, 0xb8, 0xc1, 0x53, 0x1c, 0xae, 0x55, 0x4f, 0x47, 0x4d, 0x3f,
-	0xff, 0xeb, 0x00, 0xb6, 0x9c, 0x04, 0xaa, 0x89, 0x01, 0x58, 0x41, 0x25,
-	0x82, 0xe5, 0x37, 0xc9, 0xb1, 0xc7, 0x84, 0x26, 0x02, 0x18, 0x17, 0x04,
-	0x51, 0x51, 0x72, 0xbc, 0xdc, 0x93, 0xb0, 0x84, 0xa8, 0xc1, 0xfb, 0x21,
-	0xf7, 0x83, 0x20, 0x51, 0x72, 0x5f, 0x3f, 0xa5, 0x59, 0x9e, 0xf1, 0xbf,
-	0xff, 0x9f, 0x13, 0x7f, 0x67, 0x75, 0xb8, 0x9a, 0x29, 0x00, 0xe1, 0xf0,
-	0x96, 0x20, 0x4a, 0x27, 0x11, 0x05, 0x45, 0x22, 0x06, 0x37, 0x34, 0x95,
-	0x36, 0x43, 0xac, 0x40, 0x5c, 0xe2, 0x86, 0x29, 0xb5, 0x1a, 0xe2, 0x58,
-	0xff, 0xfb, 0x20, 0xc4, 0xbc, 0x80, 0x06, 0x50, 0x55, 0x41, 0x87, 0xa4,
-	0x61, 0x80, 0xdb, 0x8b, 0x29, 0x34, 0xc4, 0x88, 0x78, 0x16, 0xc6, 0xd7,
-	0x43, 0x51, 0xfe, 0x8e, 0xde, 0x8b, 0x3a, 0x97, 0xa9, 0x02, 0x8a, 0x60,
-	0x00, 0x2a, 0x02, 0x0b, 0x45, 0x26, 0xc7, 0x8a, 0x9b, 0x69, 0x2d, 0xf0,
-	0xfa, 0x13, 0xd8, 0xd8, 0xa0, 0xaf, 0x6f, 0xf2, 0x72, 0x91, 0x0e, 0x07,
-	0x09, 0x3f, 0x0e, 0xde, 0x40, 0xb0, 0x35, 0x95, 0x47, 0x11, 0xe2, 0xba,
-	0x8e, 0xbe, 0x94, 0x9e, 0xdd, 0xfc, 0x5c, 0x3d, 0x22, 0xc6, 0x29, 0x34,
-	0x08, 0x9b, 0xa9, 0x3a, 0xee, 0x01, 0x2c, 0xa5, 0x27, 0x91, 0x84, 0x11,
-	0x59, 0x88, 0xdc, 0xe4, 0xc3, 0x72, 0x96, 0xe9, 0x5b, 0x58, 0x1f, 0xc0,
-	0x81, 0x67, 0x06, 0x47, 0x20, 0xfe, 0x45, 0x85, 0x18, 0x9e, 0x3a, 0xc7,
-	0xa4, 0x39, 0xd5, 0xe9, 0x12, 0x5a, 0x63, 0x18, 0x76, 0x0a, 0xff, 0xfb,
-	0x22, 0xc4, 0xbe, 0x00, 0x05, 0x94, 0x41, 0x3b, 0x08, 0x30, 0xc0, 0x40,
-	0xc2, 0x88, 0x67, 0xb0, 0xf3, 0x0c, 0xe0, 0xf2, 0x01, 0x20, 0x9e, 0x45,
-	0x2b, 0x0e, 0x6b, 0x6a, 0x11, 0x22, 0xd4, 0x70, 0x53, 0x16, 0x95, 0xaa,
-	0x9f, 0xe3, 0xa9, 0x11, 0x73, 0x5b, 0xa1, 0x7d, 0xe1, 0x0c, 0xb2, 0x8a,
-	0xbf, 0x62, 0xfb, 0x5d, 0x46, 0xd4, 0x90, 0x2d, 0xff, 0xa2, 0x90, 0x22,
-	0x21, 0x2b, 0x61, 0x51, 0x68, 0xd4, 0x25, 0x38, 0xd0, 0xab, 0x54, 0xfb,
-	0xd2, 0x28, 0x99, 0x49, 0x73, 0x90, 0x10, 0xf4, 0x79, 0x68, 0xcf, 0xd1,
-	0xdd, 0xb3, 0x3a, 0x30, 0x91, 0x6c, 0x4a, 0xcd, 0x68, 0x38, 0x51, 0xa6,
-	0x9e, 0xdf, 0x78, 0xca, 0x5d, 0xfb, 0x3f, 0x42, 0x09, 0x44, 0xdb, 0x2d,
-	0x53, 0x2d, 0x81, 0x98, 0x28, 0x57, 0x08, 0xf3, 0xf9, 0xd1, 0x12, 0x3c,
-	0xbb, 0x30, 0x21, 0x32, 0x67, 0x2a, 0xb4, 0x86, 0x13, 0xff, 0xfb, 0x22,
-	0xc4, 0xc6, 0x00, 0x05, 0xf8, 0x33, 0x57, 0x84, 0x98, 0x61, 0x70, 0xbd,
-	0x06, 0x67, 0x20, 0xf6, 0x20, 0x40, 0x31, 0x5b, 0xeb, 0x3b, 0x45, 0x5f,
-	0xc8, 0xe9, 0xdb, 0x2b, 0xfd, 0xc4, 0x09, 0x81, 0x39, 0x31, 0xb7, 0xd6,
-	0x51, 0x2b, 0x7e, 0x49, 0xbe, 0x72, 0xb7, 0xb3, 0x45, 0x2a, 0x5d, 0x19,
-	0x67, 0xa5, 0x29, 0xbd, 0x75, 0xce, 0x37, 0x0a, 0x20, 0x20, 0x03, 0xa2,
-	0xb1, 0xf0, 0x4c, 0x58, 0x49, 0xa6, 0x5a, 0x01, 0x48, 0xe8, 0xa4, 0xad,
-	0xce, 0x44, 0xda, 0x8c, 0xe3, 0x29, 0x06, 0x81, 0x18, 0xe0, 0x75, 0xe7,
-	0x45, 0x66, 0x1e, 0x2c, 0x7a, 0xa7, 0xf8, 0x08, 0xdb, 0x85, 0xa9, 0x4f,
-	0xf6, 0xfe, 0x8d, 0x47, 0xb6, 0x47, 0xd5, 0x16, 0xab, 0x64, 0x4c, 0x01,
-	0x29, 0x12, 0x8d, 0xca, 0x8c, 0xc5, 0xeb, 0x08, 0x04, 0x35, 0x29, 0x0f,
-	0x99, 0x65, 0x85, 0xc8, 0x50, 0x34, 0xda, 0xba, 0xff, 0xfb, 0x20, 0xc4,
-	0xcd, 0x80, 0x06, 0x00, 0x43, 0x3b, 0x86, 0x18, 0x65, 0x00, 0xb7, 0x06,
-	0x28, 0xf4, 0x75, 0x18, 0x04, 0xd3, 0x00, 0xc0, 0x78, 0x9b, 0x85, 0x8a,
-	0x4a, 0x31, 0xd1, 0x28, 0x08, 0x56, 0xa0, 0xf3, 0x1c, 0x27, 0x16, 0x2a,
-	0x49, 0xcd, 0x3b, 0x43, 0xff, 0x6b, 0xcd, 0xf7, 0x6f, 0x4d, 0x3d, 0x07,
-	0x70, 0xb4, 0x72, 0xe8, 0x37, 0x0c, 0x82, 0xe3, 0x02, 0x48, 0x00, 0xe7,
-	0xd8, 0x41, 0x8a, 0x39, 0x1b, 0x2d, 0xc1, 0x1b, 0x76, 0xdc, 0x21, 0x42,
-	0x32, 0x67, 0x01, 0x0d, 0x49, 0x57, 0x9b, 0x05, 0x20, 0xc1, 0xb1, 0xaf,
-	0x79, 0x57, 0xb4, 0x48, 0x4d, 0xad, 0x41, 0xc3, 0x95, 0x8e, 0x13, 0x13,
-	0x4c, 0x6c, 0x9d, 0xbd, 0x3a, 0xff, 0xd3, 0x42, 0x82, 0x44, 0x01, 0x18,
-	0x7e, 0x9f, 0x63, 0x3b, 0x07, 0xba, 0x76, 0x09, 0x2f, 0x23, 0x26, 0x81,
-	0xe0, 0x08, 0xd9, 0x43, 0x98, 0xb1, 0xff, 0xfb, 0x22, 0xc4, 0xd5, 0x00,
-	0xc5, 0xb8, 0x3b, 0x37, 0x06, 0x04, 0xcc, 0x00, 0xb5, 0x08, 0x66, 0x54,
-	0xf6, 0x18, 0x08, 0x00, 0xd0, 0x6e, 0x15, 0x4a, 0x45, 0x78, 0x18, 0x65,
-	0x16, 0x69, 0x4b, 0x6d, 0xda, 0x90, 0x50, 0xfb, 0x1f, 0x22, 0x2c, 0xc2,
-	0x86, 0xfb, 0x92, 0x87, 0x5f, 0x92, 0x17, 0x67, 0xf4, 0x74, 0xa0, 0x01,
-	0x30, 0x04, 0xd1, 0xc4, 0x67, 0x09, 0x2a, 0x88, 0xea, 0x21, 0x25, 0xd2,
-	0x67, 0x34, 0x24, 0xb7, 0x25, 0xd1, 0xab, 0x23, 0x0c, 0x06, 0x99, 0x5f,
-	0x8b, 0x40, 0x58, 0xa9, 0x43, 0x62, 0xdf, 0xd7, 0xdd, 0xc4, 0xa1, 0xd9,
-	0xf5, 0xe5, 0x9b, 0x3d, 0x74, 0xdb, 0xbf, 0x19, 0xee, 0xce, 0x9e, 0xff,
-	0xfa, 0x2a, 0xbe, 0x88, 0x91, 0x49, 0x91, 0xc2, 0x29, 0xc8, 0x28, 0x55,
-	0x4b, 0xf3, 0x1a, 0x2c, 0x2b, 0x45, 0xdd, 0xa0, 0x8a, 0x93, 0x28, 0x91,
-	0x2b, 0xcb, 0x6d, 0x24, 0x2c, 0xff, 0xfb, 0x20, 0xc4, 0xde, 0x80, 0x05,
-	0xb0, 0x67, 0x37, 0x07, 0xa4, 0x61, 0x40, 0xb4, 0x8d, 0x26, 0x40, 0xc3,
-	0x08, 0xb0, 0x8e, 0x59, 0x4b, 0x65, 0xb8, 0x8d, 0x01, 0xe1, 0x57, 0xa0,
-	0xb9, 0xb0, 0x85, 0x4d, 0xc7, 0x4d, 0x89, 0xa7, 0xc6, 0x76, 0x63, 0x79,
-	0xbb, 0xff, 0xf7, 0x31, 0x69, 0x36, 0x42, 0x42, 0xda, 0x46, 0x41, 0x0d,
-	0x18, 0x45, 0x42, 0xec, 0xba, 0x39, 0x3d, 0x63, 0x29, 0xcf, 0xd8, 0xe2,
-	0x84, 0x97, 0x69, 0x10, 0x6d, 0x52, 0xa2, 0xba, 0x21, 0x42, 0xa3, 0x04,
-	0xa3, 0x9d, 0x6d, 0x03, 0xca, 0x80, 0x00, 0xc3, 0x5a, 0x81, 0xe7, 0x98,
-	0x11, 0xa5, 0x80, 0xa9, 0x31, 0x67, 0x9f, 0x17, 0x4a, 0xbb, 0x7f, 0xb2,
-	0x01, 0xb6, 0x29, 0xe3, 0xd7, 0x00, 0x97, 0x88, 0xfc, 0x49, 0x09, 0x65,
-	0x71, 0xb2, 0x65, 0x4e, 0x12, 0xc2, 0x1d, 0xa5, 0xce, 0x05, 0x6c, 0x40,
-	0x89, 0x7a, 0x40, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x07, 0x2c, 0x65,
-	0x39, 0x87, 0x98, 0x65, 0x80, 0xcf, 0x07, 0x68, 0x34, 0x93, 0x0c, 0x74,
-	0x34, 0x1f, 0x02, 0x9e, 0xb4, 0xb0, 0xab, 0xc2, 0xab, 0x9f, 0x57, 0x30,
-	0x43, 0xab, 0x18, 0x86, 0x18, 0xd4, 0xeb, 0x4c, 0x1f, 0x30, 0x11, 0x4a,
-	0x9c, 0x66, 0xfd, 0x8e, 0x24, 0xcd, 0xb6, 0xec, 0xf5, 0xa2, 0x5a, 0xf5,
-	0xba, 0x6b, 0x24, 0x8d, 0xa4, 0x02, 0xa2, 0xdd, 0xe3, 0xba, 0x41, 0xa9,
-	0xcd, 0x33, 0x24, 0x44, 0x1c, 0xc4, 0xcf, 0x70, 0x68, 0x85, 0x78, 0xdc,
-	0xc3, 0x6a, 0xaa, 0x75, 0xd2, 0x78, 0xab, 0x0f, 0x36, 0xa3, 0x01, 0x32,
-	0x79, 0x74, 0xfa, 0xa7, 0xd9, 0xc8, 0x5d, 0xfe, 0x57, 0xff, 0x4a, 0x96,
-	0x4f, 0xae, 0xb6, 0x49, 0x23, 0x69, 0x00, 0x0e, 0x28, 0x04, 0x48, 0xe3,
-	0x37, 0x48, 0xc2, 0xd7, 0xe4, 0x0c, 0x5f, 0x2b, 0x94, 0xca, 0xc9, 0xa0,
-	0x48, 0xa5, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x06, 0xec, 0x35, 0x35,
-	0x06, 0x31, 0x21, 0x00, 0xe1, 0x0a, 0xa7, 0x00, 0xf4, 0x98, 0xb8, 0xf2,
-	0x3d, 0x23, 0xa7, 0xdf, 0x66, 0xfd, 0xc9, 0x82, 0x4d, 0x89, 0x41, 0xe1,
-	0x30, 0xa6, 0x06, 0xd4, 0x44, 0xda, 0x23, 0xd0, 0x20, 0x7b, 0xa3, 0x85,
-	0x56, 0x99, 0x92, 0x0e, 0x58, 0xdd, 0xbf, 0xdd, 0xe0, 0x05, 0xb0, 0x02,
-	0x68, 0x41, 0x30, 0x7d, 0x19, 0x6a, 0xa5, 0xc2, 0xb9, 0x2e, 0x12, 0xf3,
-	0x50, 0x31, 0xc9, 0x28, 0x6a, 0x50, 0x08, 0x49, 0x61, 0xc8, 0x12, 0x93,
-	0x94, 0xf1, 0x60, 0x41, 0x84, 0xcd, 0x21, 0x04, 0xce, 0xb6, 0x3c, 0x2a,
-	0x09, 0xdc, 0xcd, 0x39, 0x5a, 0xd7, 0x3e, 0xed, 0x6a, 0x76, 0xba, 0x1a,
-	0x91, 0x4d, 0x1d, 0xf8, 0x84, 0x85, 0x01, 0xd7, 0xb6, 0x1d, 0xe8, 0x11,
-	0x2a, 0xa6, 0xb6, 0xd1, 0x63, 0x37, 0x11, 0xaa, 0x90, 0x9c, 0xa8, 0x4f,
-	0x60, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x46, 0xa4, 0x51, 0x43, 0x07,
-	0xa5, 0x08, 0x80, 0xcc, 0x92, 0xa7, 0xd4, 0xf3, 0x09, 0xa8, 0xfc, 0xaa,
-	0x37, 0x48, 0x6a, 0x74, 0xc3, 0xd1, 0xb2, 0x69, 0x1e, 0x85, 0x8b, 0x24,
-	0x97, 0x3c, 0x62, 0xcf, 0x1a, 0x58, 0x3e, 0x9e, 0x28, 0xe2, 0x8d, 0x17,
-	0x3d, 0xb2, 0x9a, 0xc3, 0x2c, 0xc3, 0xcf, 0x22, 0x31, 0x11, 0x9f, 0x7b,
-	0xad, 0xab, 0x49, 0x71, 0x4a, 0x64, 0x88, 0x70, 0x1c, 0x02, 0x68, 0x91,
-	0x33, 0xa1, 0x2a, 0x1f, 0x12, 0x36, 0x23, 0x05, 0xb6, 0xab, 0x07, 0x86,
-	0x61, 0x39, 0x1d, 0x67, 0x4c, 0xdb, 0xb3, 0xd2, 0x28, 0x09, 0xc8, 0xe2,
-	0x42, 0x29, 0xfb, 0xdc, 0x96, 0x4f, 0x7e, 0xf4, 0xaa, 0x81, 0xa2, 0xa0,
-	0xcf, 0x10, 0x20, 0x02, 0x81, 0x8b, 0x08, 0x4f, 0x1f, 0x71, 0x61, 0x15,
-	0xcc, 0x8e, 0x9c, 0xa0, 0x61, 0x08, 0xf7, 0x34, 0xa1, 0xcd, 0x29, 0xff,
-	0xfb, 0x22, 0xc4, 0xe8, 0x83, 0xc6, 0xc0, 0x49, 0x38, 0x0c, 0x3c, 0xc4,
-	0xc0, 0xef, 0x8a, 0x66, 0x80, 0xf4, 0x8d, 0x88, 0x02, 0x10, 0xf1, 0x3a,
-	0x62, 0xd0, 0x18, 0xe0, 0x0a, 0x75, 0xfa, 0x38, 0x44, 0x7f, 0x2a, 0x39,
-	0x07, 0xf5, 0x9e, 0xf8, 0xf5, 0xc0, 0x0b, 0x24, 0xa2, 0x68, 0x32, 0xbb,
-	0x8c, 0x55, 0x28, 0x11, 0xc8, 0xb7, 0xec, 0x4c, 0x6a, 0x15, 0x97, 0xd6,
-	0x6d, 0x4e, 0x31, 0x9d, 0xe1, 0xea, 0xf5, 0x52, 0x04, 0x4c, 0x71, 0xdc,
-	0x64, 0xa9, 0xac, 0xdd, 0x39, 0x21, 0x53, 0x2e, 0x04, 0xc1, 0x71, 0x3a,
-	0xc4, 0x2e, 0x05, 0x4e, 0xeb, 0x18, 0x14, 0x0a, 0x80, 0x4c, 0x9d, 0x15,
-	0x92, 0xe2, 0x2c, 0x95, 0x66, 0x75, 0x8c, 0xbb, 0x67, 0x5b, 0xe2, 0x80,
-	0x48, 0x88, 0x54, 0xb4, 0x1e, 0x41, 0xc4, 0x70, 0xa8, 0x4d, 0x32, 0x7e,
-	0xa9, 0x14, 0xc4, 0x44, 0x8c, 0xac, 0x7a, 0xa3, 0x20, 0x5c, 0xff, 0xfb,
-	0x20, 0xc4, 0xe6, 0x80, 0x06, 0xf8, 0x53, 0x3b, 0x07, 0xa4, 0x67, 0x00,
-	0xc3, 0x88, 0xac, 0x34, 0x96, 0x18, 0x1e, 0x36, 0xb2, 0x1a, 0xbd, 0x65,
-	0x87, 0xa0, 0x2f, 0x26, 0x08, 0xd2, 0x63, 0xc3, 0xdc, 0x04, 0x90, 0x85,
-	0x94, 0x7e, 0x6a, 0x95, 0x4c, 0x5b, 0x7e, 0xe7, 0x73, 0xff, 0xff, 0x59,
-	0x3a, 0xb7, 0xe2, 0xe4, 0x8b, 0xac, 0x63, 0x50, 0x27, 0x2c, 0x00, 0x2a,
-	0x10, 0x9c, 0xd3, 0xb1, 0x4d, 0x0b, 0xfc, 0x9c, 0xd3, 0xdc, 0xc5, 0xc4,
-	0xdc, 0xfa, 0x6f, 0x2c, 0x51, 0x69, 0x12, 0x17, 0xe8, 0x0c, 0x5a, 0x68,
-	0xa9, 0x1b, 0x21, 0x26, 0x62, 0x8d, 0x00, 0x07, 0x1c, 0x80, 0x50, 0xad,
-	0x41, 0x79, 0x29, 0x08, 0x92, 0x3c, 0x39, 0xb8, 0x0a, 0x00, 0x4e, 0xa2,
-	0xad, 0x5b, 0xf9, 0x41, 0xc9, 0x55, 0xf3, 0xa9, 0xb0, 0x68, 0x44, 0x6c,
-	0xb9, 0x2b, 0xc3, 0xb7, 0x8f, 0x16, 0x79, 0x2e, 0xff, 0xfb, 0x22, 0xc4,
-	0xe8, 0x80, 0x07, 0xd8, 0x45, 0x5d, 0xa6, 0x3c, 0xc6, 0xf0, 0xdb, 0x87,
-	0x27, 0x60, 0xf3, 0x0c, 0xe0, 0xc8, 0x8a, 0x58, 0x04, 0x3c, 0x8b, 0x76,
-	0xdd, 0x6e, 0x76, 0x7a, 0xbf, 0xe4, 0x5b, 0xc4, 0x64, 0x82, 0x83, 0x9a,
-	0x11, 0xea, 0x5b, 0x5f, 0x9e, 0xec, 0xa9, 0xd5, 0x98, 0x37, 0x39, 0x51,
-	0x4d, 0x76, 0x4d, 0x37, 0xcb, 0x66, 0x87, 0xd9, 0xd3, 0xcf, 0x91, 0xa6,
-	0x43, 0x57, 0x6f, 0x25, 0x44, 0xb1, 0xb4, 0xf5, 0x9b, 0xde, 0x27, 0x26,
-	0xbb, 0x74, 0xf5, 0xd4, 0xc8, 0xce, 0xb3, 0xee, 0xa4, 0x23, 0x7c, 0x32,
-	0xbf, 0xa6, 0xcc, 0x5e, 0x14, 0x40, 0x61, 0xec, 0x20, 0x70, 0x16, 0x04,
-	0xac, 0xe4, 0x8a, 0x0c, 0x13, 0x96, 0x58, 0x01, 0x02, 0x67, 0x9a, 0x9a,
-	0x8c, 0xab, 0x4a, 0x1b, 0x72, 0x5f, 0x2f, 0x7a, 0x72, 0xe2, 0xc1, 0x17,
-	0xcf, 0x20, 0xc0, 0x42, 0xbb, 0x78, 0xa1, 0xff, 0xfb, 0x22, 0xc4, 0xe4,
-	0x80, 0x07, 0xc8, 0x45, 0x41, 0x27, 0xb0, 0xc6, 0xc1, 0x59, 0x1c, 0x27,
-	0xc0, 0xf6, 0x0d, 0x71, 0x45, 0x96, 0x49, 0x69, 0x87, 0x7e, 0xc4, 0xfc,
-	0xf1, 0xad, 0x7a, 0x82, 0x94, 0x17, 0x04, 0x24, 0xfc, 0x12, 0x65, 0x25,
-	0x02, 0x96, 0x1c, 0x18, 0x92, 0x30, 0x44, 0x32, 0x47, 0x83, 0x16, 0x69,
-	0xab, 0x15, 0xf0, 0x50, 0x38, 0x0f, 0x04, 0xa5, 0x07, 0x09, 0x54, 0x02,
-	0x22, 0x00, 0x1a, 0x76, 0x60, 0xde, 0x45, 0xeb, 0x0e, 0x20, 0x7c, 0xc3,
-	0x2e, 0xa2, 0x8d, 0x5f, 0xa5, 0x49, 0x45, 0x11, 0x96, 0x01, 0x00, 0x68,
-	0x12, 0x00, 0x38, 0xb0, 0x9c, 0xaa, 0xd4, 0xd0, 0x75, 0xd0, 0x14, 0x78,
-	0x32, 0x96, 0x6f, 0xa3, 0x91, 0x2e, 0x23, 0x1f, 0x6c, 0xa0, 0x30, 0xb1,
-	0xf1, 0x72, 0x6f, 0xbc, 0xaa, 0xcf, 0x0e, 0xc5, 0x48, 0x74, 0xfa, 0x60,
-	0x5f, 0x66, 0xea, 0x5f, 0xf1, 0xe8, 0xff, 0xfb, 0x20, 0xc4, 0xd1, 0x00,
-	0x08, 0x28, 0x53, 0x49, 0x27, 0x99, 0x0e, 0x41, 0x5d, 0xa1, 0xa8, 0x14,
-	0xf4, 0x8d, 0xf8, 0x62, 0x4c, 0x96, 0x49, 0xa5, 0x7f, 0xf4, 0x41, 0x33,
-	0x41, 0xa1, 0xd0, 0xdf, 0x10, 0xa2, 0x4e, 0x08, 0xec, 0x50, 0x71, 0xe6,
-	0x9a, 0x4e, 0x0f, 0x5c, 0x90, 0x8b, 0x30, 0x3d, 0x6e, 0x1b, 0x14, 0xbc,
-	0x80, 0x8c, 0xff, 0x3e, 0x8a, 0xec, 0x27, 0x4f, 0xeb, 0x6e, 0xdf, 0xfd,
-	0xac, 0xc6, 0x4d, 0x2a, 0x72, 0xeb, 0x2d, 0x96, 0x7f, 0xd0, 0x00, 0xa4,
-	0x90, 0x68, 0x9c, 0xe8, 0x7e, 0x30, 0x6c, 0x97, 0x4a, 0xa4, 0x16, 0x5c,
-	0xc1, 0xe0, 0xd3, 0xa3, 0x76, 0xa9, 0xf0, 0xa6, 0x38, 0x24, 0x48, 0x91,
-	0xaa, 0xd2, 0x0e, 0x84, 0x92, 0x54, 0x04, 0x45, 0x92, 0xde, 0xf5, 0x8f,
-	0x76, 0x82, 0x19, 0x20, 0x00, 0x0b, 0x84, 0x14, 0xac, 0x42, 0x00, 0x64,
-	0x00, 0x89, 0xa7, 0x29, 0xff, 0xfb, 0x22, 0xc4, 0xbb, 0x00, 0x07, 0x48,
-	0x43, 0x4f, 0xa4, 0x30, 0xc2, 0x80, 0xe6, 0x17, 0x26, 0x80, 0xf3, 0x0a,
-	0x20, 0xf3, 0xa4, 0xfa, 0x52, 0x49, 0x9d, 0x89, 0xba, 0x62, 0x58, 0x0c,
-	0x90, 0xd3, 0x9c, 0x69, 0xe6, 0x89, 0x18, 0x07, 0x06, 0x90, 0x86, 0x50,
-	0xd5, 0xca, 0x2c, 0xe0, 0xa4, 0x6c, 0x89, 0xcd, 0xf7, 0xca, 0x55, 0x02,
-	0x9a, 0x13, 0x4c, 0x6c, 0x16, 0xb7, 0xc4, 0x89, 0x44, 0xda, 0x19, 0xe6,
-	0xc7, 0xcb, 0x12, 0x28, 0xc3, 0x61, 0x56, 0xa5, 0xaf, 0x54, 0x59, 0x52,
-	0x69, 0x2c, 0x9c, 0x01, 0x50, 0x9d, 0x51, 0x82, 0x1d, 0x76, 0x26, 0xa7,
-	0xd9, 0x73, 0x7f, 0xfe, 0xbd, 0x71, 0xe3, 0xc1, 0x00, 0x5d, 0x86, 0x92,
-	0x4c, 0x77, 0x09, 0x13, 0x34, 0xec, 0x28, 0x86, 0xc8, 0x91, 0xbb, 0x6b,
-	0x45, 0x29, 0x34, 0xad, 0x20, 0x8c, 0x03, 0x03, 0x34, 0xae, 0x54, 0xf1,
-	0xa9, 0x20, 0x68, 0xff, 0xfb, 0x22, 0xc4, 0xb8, 0x00, 0x86, 0x48, 0x47,
-	0x38, 0xa7, 0xa4, 0xc4, 0x40, 0xcd, 0x87, 0x66, 0x80, 0xf3, 0x0c, 0xa8,
-	0x2e, 0xe2, 0xad, 0x3d, 0x53, 0x01, 0xdc, 0x48, 0x31, 0xe3, 0x58, 0xbf,
-	0xda, 0xbf, 0xa7, 0xe9, 0x06, 0x57, 0x06, 0x45, 0x28, 0x13, 0x84, 0x36,
-	0xe0, 0xe2, 0x24, 0x11, 0xc0, 0xad, 0x64, 0x8c, 0x20, 0x7d, 0x9c, 0x11,
-	0x27, 0x93, 0x02, 0x1c, 0x8b, 0xbe, 0x58, 0x74, 0x51, 0x08, 0x79, 0x40,
-	0x18, 0xa0, 0x9d, 0x41, 0x94, 0x5d, 0x15, 0x06, 0x35, 0x10, 0xbf, 0xfa,
-	0xd1, 0x9b, 0xe4, 0xbf, 0xb8, 0x21, 0x5b, 0x95, 0xe5, 0x6c, 0x0a, 0x06,
-	0xc8, 0xc4, 0xc1, 0x43, 0x1d, 0x30, 0x99, 0x16, 0xa3, 0x12, 0x06, 0x4b,
-	0x64, 0x39, 0x69, 0x88, 0x40, 0xd0, 0xe1, 0x71, 0x82, 0xf4, 0x8d, 0x71,
-	0x18, 0x3c, 0xc7, 0xc9, 0xb5, 0x5a, 0xd9, 0xa6, 0xe5, 0xfa, 0x27, 0xb4,
-	0x7a, 0xf5, 0xff, 0xfb, 0x20, 0xc4, 0xbc, 0x00, 0x06, 0x08, 0x39, 0x39,
-	0x27, 0x9c, 0xc4, 0x00, 0xbb, 0x85, 0x6a, 0xf0, 0x95, 0xa4, 0x46, 0x4c,
-	0xaa, 0x24, 0x20, 0x35, 0x34, 0x42, 0x15, 0x40, 0x43, 0x54, 0xca, 0x23,
-	0x28, 0x0d, 0x9e, 0xdf, 0x4c, 0x1b, 0x72, 0x4f, 0x6e, 0xcb, 0x9e, 0xad,
-	0xcb, 0xe5, 0xd8, 0x77, 0xf5, 0x04, 0x21, 0x08, 0x0b, 0x25, 0xa1, 0xdb,
-	0x05, 0x99, 0x50, 0x90, 0x53, 0x3b, 0xd4, 0xcd, 0x89, 0xfd, 0xe5, 0x42,
-	0x2d, 0xa7, 0x02, 0x32, 0x22, 0xc0, 0xe0, 0x1c, 0x1d, 0x0c, 0xc2, 0x0e,
-	0x50, 0xda, 0xeb, 0x16, 0x65, 0x19, 0xd4, 0x69, 0x30, 0xc0, 0x42, 0xdd,
-	0xe3, 0xe7, 0x5c, 0x8c, 0x12, 0x42, 0xca, 0xa1, 0xd8, 0x60, 0x5e, 0xa6,
-	0xa3, 0xfb, 0xb9, 0x0e, 0xab, 0x95, 0x65, 0xdf, 0xfa, 0xc9, 0xd5, 0x5f,
-	0x00, 0x82, 0x60, 0x92, 0xb0, 0x9c, 0xe0, 0x51, 0xea, 0x37, 0x4d, 0x20,
-	0xff, 0xfb, 0x22, 0xc4, 0xc2, 0x80, 0x05, 0xb0, 0x39, 0x57, 0x86, 0x24,
-	0xc4, 0xf0, 0xbe, 0x87, 0x26, 0xa0, 0xf3, 0x08, 0x70, 0x44, 0x2e, 0x89,
-	0x16, 0xea, 0x65, 0x9a, 0x1c, 0xf0, 0xc0, 0x50, 0x22, 0x1b, 0x16, 0x14,
-	0x66, 0x31, 0x87, 0x4d, 0x07, 0xe9, 0x99, 0xd6, 0xb7, 0x3d, 0x43, 0xd6,
-	0xe0, 0xe2, 0x08, 0xd3, 0xe4, 0xff, 0xbc, 0x50, 0xe3, 0x6c, 0xa3, 0x6e,
-	0xd8, 0x04, 0x61, 0x21, 0x40, 0x28, 0x0f, 0xa0, 0x8e, 0x44, 0xb2, 0x49,
-	0x22, 0x48, 0x6d, 0x6f, 0x38, 0x8d, 0x5c, 0x6b, 0x1e, 0x55, 0xc3, 0x50,
-	0x2c, 0x96, 0x6e, 0x9a, 0x0e, 0xb5, 0x07, 0x80, 0x4f, 0x9f, 0x0b, 0xf7,
-	0x3e, 0x6f, 0xe6, 0x6b, 0xb3, 0x66, 0x71, 0x0a, 0x0a, 0x66, 0x13, 0x0c,
-	0x07, 0xc9, 0x38, 0x3b, 0xc7, 0x32, 0xc2, 0x6c, 0x2c, 0x8d, 0xda, 0x68,
-	0x44, 0x68, 0xc5, 0x6f, 0xce, 0x81, 0x03, 0x0c, 0x43, 0x26, 0xb4, 0xff,
-	0xfb, 0x20, 0xc4, 0xca, 0x80, 0x05, 0x6c, 0x39, 0x37, 0x07, 0x98, 0x64,
-	0xc0, 0xc2, 0x86, 0xe6, 0x94, 0xf4, 0x88, 0x70, 0x03, 0xe7, 0x9e, 0x28,
-	0x03, 0x58, 0x90, 0x20, 0x27, 0x73, 0xc1, 0x01, 0xad, 0x59, 0x83, 0x87,
-	0x5a, 0x22, 0x48, 0x61, 0x15, 0x91, 0x54, 0x78, 0x95, 0xbb, 0xf4, 0x77,
-	0xdc, 0x03, 0x74, 0x51, 0x4a, 0x49, 0x25, 0x8e, 0x3e, 0xb5, 0x50, 0x18,
-	0x21, 0x0f, 0x44, 0x61, 0xe9, 0x6b, 0xd5, 0xbb, 0x85, 0xba, 0xf3, 0x04,
-	0xe7, 0xcd, 0x40, 0x48, 0xcb, 0x7a, 0x48, 0x5d, 0x12, 0x60, 0x90, 0x6e,
-	0x8e, 0x1a, 0x30, 0x7f, 0x02, 0x03, 0xcf, 0x8a, 0xb0, 0x5e, 0x9b, 0x96,
-	0x46, 0xad, 0xb9, 0x60, 0x37, 0xf5, 0x62, 0xcb, 0xb4, 0xb5, 0x57, 0x67,
-	0x98, 0x79, 0x78, 0x7d, 0xb6, 0xb6, 0x00, 0x2c, 0x83, 0x62, 0xc2, 0x9e,
-	0xbc, 0xa2, 0x14, 0x28, 0x90, 0x93, 0x86, 0x8b, 0x01, 0xff, 0xfb, 0x22,
-	0xc4, 0xd3, 0x00, 0x06, 0x18, 0x29, 0x37, 0x27, 0xb0, 0xc0, 0x40, 0xb9,
-	0x86, 0x67, 0xf0, 0x93, 0x0c, 0x9c, 0x89, 0x26, 0x09, 0x68, 0x2e, 0x0f,
-	0xd4, 0xed, 0x0b, 0x21, 0xab, 0xfc, 0xd2, 0xcf, 0x2e, 0x50, 0x40, 0xe0,
-	0x86, 0x44, 0x4c, 0xdb, 0x06, 0x6b, 0x08, 0x94, 0x89, 0x7c, 0x7e, 0xeb,
-	0xbe, 0x40, 0xdc, 0x02, 0x84, 0x6c, 0xd8, 0x52, 0xa8, 0x51, 0xaa, 0xa0,
-	0x84, 0x1c, 0xa3, 0x43, 0x93, 0x26, 0x17, 0xae, 0x81, 0x33, 0xc9, 0xa7,
-	0x75, 0x1e, 0x22, 0xba, 0xcf, 0x30, 0x27, 0x4c, 0x32, 0x5e, 0x0f, 0x83,
-	0xe0, 0xf8, 0xf4, 0x86, 0x00, 0x12, 0x74, 0x68, 0x5d, 0x0d, 0x72, 0x63,
-	0x42, 0xe0, 0x6d, 0x3f, 0xf4, 0xdd, 0x5a, 0x55, 0x9a, 0xed, 0xff, 0xba,
-	0xdb, 0x2b, 0x89, 0x00, 0xf0, 0xa5, 0x29, 0x16, 0x0f, 0x11, 0x42, 0xf4,
-	0xa9, 0x42, 0x30, 0x64, 0x4a, 0x1a, 0xd0, 0x93, 0xff, 0xfb, 0x22, 0xc4,
-	0xda, 0x00, 0x05, 0xc8, 0x63, 0x32, 0x07, 0xa4, 0x61, 0xc0, 0xbb, 0x88,
-	0x27, 0x30, 0xc4, 0x8c, 0x68, 0x0d, 0xc7, 0xcc, 0xca, 0xf1, 0x94, 0xeb,
-	0x51, 0x86, 0xba, 0x6c, 0xa3, 0x67, 0x80, 0x82, 0x52, 0x41, 0x22, 0xf8,
-	0x8d, 0x7b, 0x1f, 0x90, 0x3a, 0xab, 0xd8, 0x1d, 0x1e, 0xbf, 0xd5, 0x68,
-	0xeb, 0xcb, 0x68, 0xcc, 0x80, 0x15, 0x04, 0x90, 0x99, 0x8a, 0x0e, 0x17,
-	0x1a, 0xb3, 0x2b, 0x0f, 0x40, 0xf3, 0x11, 0xa1, 0x67, 0x9a, 0xb4, 0x16,
-	0x85, 0x97, 0xf3, 0x7d, 0xd1, 0x08, 0x3f, 0x01, 0xc6, 0x0f, 0xbd, 0xa1,
-	0x63, 0x40, 0x57, 0x94, 0x15, 0x7f, 0x26, 0xd8, 0xb2, 0x9e, 0xa3, 0x5a,
-	0xc8, 0x89, 0xed, 0x26, 0xbf, 0xbe, 0x2c, 0xd7, 0x7a, 0x55, 0x23, 0x02,
-	0x1c, 0x4c, 0x46, 0x0c, 0x5c, 0x77, 0x5d, 0x42, 0x5c, 0xe4, 0xa3, 0x9d,
-	0xc0, 0xcc, 0x40, 0xc8, 0x95, 0x14, 0xaa, 0xff, 0xfb, 0x20, 0xc4, 0xe2,
-	0x00, 0x05, 0xd8, 0x29, 0x32, 0xa7, 0xa1, 0x22, 0x00, 0xc2, 0x86, 0xa7,
-	0xb0, 0x94, 0x98, 0x00, 0xae, 0xa4, 0xba, 0xed, 0xb0, 0x75, 0xb3, 0xd2,
-	0x14, 0x10, 0x20, 0x78, 0x40, 0xc3, 0x32, 0xc0, 0xd8, 0xd1, 0xf3, 0x37,
-	0x7d, 0x84, 0x33, 0xda, 0x13, 0xd8, 0x00, 0x8d, 0xba, 0x92, 0xf8, 0x9f,
-	0x05, 0x38, 0xac, 0x28, 0x01, 0xc0, 0xa2, 0xa1, 0xc0, 0x9b, 0x04, 0x44,
-	0xac, 0x8e, 0x89, 0x60, 0x8f, 0x09, 0x8e, 0x0a, 0xb5, 0xa9, 0xc8, 0xeb,
-	0x51, 0x28, 0x60, 0x79, 0xdc, 0xba, 0x12, 0x66, 0x5b, 0x06, 0x0a, 0x09,
-	0x9f, 0x57, 0x60, 0xa3, 0xe0, 0x91, 0x57, 0xac, 0xf7, 0xa5, 0x92, 0xe4,
-	0xbc, 0xe0, 0xa5, 0xea, 0x7d, 0x54, 0x88, 0x54, 0x0c, 0x24, 0x8c, 0x08,
-	0xd0, 0xad, 0x83, 0x00, 0xfb, 0x58, 0x29, 0x1c, 0xfc, 0x78, 0x1d, 0x26,
-	0x61, 0xab, 0x00, 0x4a, 0x56, 0xff, 0xfb, 0x22, 0xc4, 0xe8, 0x80, 0x07,
-	0x6c, 0x37, 0x31, 0x07, 0x99, 0x24, 0x40, 0xd5, 0x08, 0x69, 0xb0, 0x96,
-	0x0c, 0x2e, 0x48, 0x81, 0x74, 0xa0, 0x70, 0x42, 0x0d, 0x3c, 0xe0, 0x65,
-	0x45, 0x60, 0x60, 0x13, 0x96, 0x54, 0xd0, 0xa4, 0x59, 0x5a, 0x9d, 0xdc,
-	0xb6, 0xa1, 0xe6, 0xa9, 0x56, 0x97, 0x37, 0xe2, 0x81, 0x44, 0x21, 0xfd,
-	0x42, 0x34, 0xc2, 0x24, 0x0f, 0x00, 0xb4, 0x8c, 0x81, 0x20, 0x0c, 0xb8,
-	0x95, 0x10, 0x16, 0x20, 0xc5, 0x29, 0x69, 0x1d, 0x66, 0x15, 0x95, 0x76,
-	0xc9, 0x1e, 0x2c, 0x50, 0x8a, 0x29, 0x40, 0xfa, 0x80, 0x00, 0xd9, 0xfb,
-	0x10, 0x29, 0x7a, 0xd6, 0x3c, 0x55, 0xcc, 0xcd, 0xae, 0x86, 0x22, 0x5f,
-	0xfd, 0x75, 0x52, 0xed, 0xb6, 0xb6, 0x48, 0xda, 0x69, 0x00, 0xd8, 0xb0,
-	0xc8, 0x77, 0x01, 0xe6, 0x83, 0xb5, 0x4e, 0xcb, 0x27, 0x67, 0x0f, 0x09,
-	0x2e, 0x36, 0xc2, 0xf3, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00, 0x06, 0xd8,
-	0x65, 0x6b, 0xe6, 0x18, 0x69, 0x30, 0xd6, 0x08, 0x66, 0x14, 0xf3, 0x18,
-	0x80, 0x22, 0xe9, 0xea, 0xd0, 0x0a, 0x16, 0xda, 0x30, 0x68, 0x44, 0x99,
-	0xd3, 0x66, 0x01, 0x68, 0x3a, 0x13, 0x1b, 0x26, 0x22, 0xed, 0x6d, 0xb5,
-	0x22, 0x1a, 0x20, 0xf1, 0x71, 0x38, 0xa8, 0x6c, 0x90, 0xcd, 0x50, 0x9a,
-	0x1e, 0xf7, 0xd9, 0xc6, 0xd2, 0x2d, 0x76, 0x4e, 0x02, 0x28, 0x32, 0x8a,
-	0xed, 0xd5, 0x74, 0x41, 0x42, 0x60, 0xc8, 0x26, 0x02, 0x08, 0x9a, 0xc2,
-	0x98, 0x02, 0xb2, 0x17, 0x60, 0x83, 0x02, 0x03, 0xe6, 0xc7, 0xb6, 0x34,
-	0x84, 0x06, 0x2a, 0xf1, 0xe5, 0xd6, 0x7b, 0x69, 0x94, 0x12, 0x1c, 0x99,
-	0xaf, 0x79, 0x0a, 0x77, 0x7e, 0x9f, 0xa5, 0x11, 0xeb, 0x65, 0x91, 0xc8,
-	0x91, 0x44, 0x80, 0xdc, 0x53, 0x34, 0xa2, 0x01, 0x29, 0x08, 0xc5, 0x78,
-	0x92, 0x12, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x07, 0x08, 0x41, 0x5d,
-	0xa7, 0xa4, 0xc3, 0x30, 0xe0, 0x08, 0xe6, 0xa4, 0xf6, 0x18, 0x08, 0x78,
-	0x82, 0xde, 0x18, 0xd4, 0x7a, 0x4b, 0x09, 0x53, 0x6d, 0x87, 0x74, 0x93,
-	0x83, 0x41, 0x3a, 0x9a, 0xd1, 0x44, 0xa5, 0x1c, 0x51, 0x53, 0xf6, 0x67,
-	0x2a, 0xb1, 0x3b, 0x11, 0xfe, 0xae, 0x51, 0xc8, 0x01, 0xa6, 0x53, 0x0c,
-	0x2b, 0x84, 0x89, 0x47, 0x82, 0xab, 0xd5, 0x7a, 0xcb, 0xb4, 0x68, 0x98,
-	0x85, 0x0c, 0xea, 0xc6, 0x45, 0x96, 0x44, 0x66, 0x81, 0xd4, 0x72, 0xcd,
-	0x87, 0x51, 0x67, 0x46, 0xac, 0x7a, 0xcc, 0x91, 0x64, 0x28, 0xc6, 0xe6,
-	0xea, 0x73, 0xc3, 0x35, 0x30, 0x59, 0xb7, 0xf0, 0xd5, 0x2e, 0x55, 0xf7,
-	0x24, 0x61, 0x9e, 0xa4, 0x2a, 0x0d, 0x08, 0x01, 0xda, 0x29, 0x30, 0x53,
-	0x87, 0xe4, 0x15, 0x26, 0x7a, 0x27, 0x88, 0x87, 0x49, 0xb0, 0x1d, 0x24,
-	0x24, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x80, 0x05, 0xdc, 0x69, 0x30, 0x07,
-	0xb0, 0x61, 0x00, 0xf8, 0x0c, 0x67, 0x30, 0xf4, 0x8c, 0x38, 0x9a, 0xc3,
-	0x80, 0x22, 0xa8, 0x0c, 0x04, 0x04, 0x20, 0x42, 0xe4, 0x21, 0x80, 0xb0,
-	0x0d, 0x89, 0xf7, 0x1a, 0x6b, 0xd4, 0xdc, 0x9f, 0x79, 0xa6, 0x7f, 0x5f,
-	0xb8, 0x19, 0x94, 0x88, 0x11, 0xe8, 0x12, 0x7c, 0xf2, 0x5e, 0x52, 0xb9,
-	0xa0, 0x4d, 0xc1, 0x21, 0x77, 0x20, 0x44, 0xd6, 0xce, 0x8e, 0xa1, 0x72,
-	0x4e, 0xfd, 0x40, 0x35, 0xc5, 0x01, 0x39, 0x73, 0x32, 0x26, 0x9d, 0x4d,
-	0x0c, 0x35, 0x23, 0xa4, 0x7e, 0xd8, 0xd3, 0xff, 0xed, 0x65, 0xa7, 0x46,
-	0xf1, 0xe1, 0xbe, 0x42, 0x75, 0x6d, 0xd0, 0xc5, 0xeb, 0x8e, 0x40, 0xf4,
-	0x9d, 0x24, 0xd5, 0x36, 0x1f, 0x40, 0x82, 0xe0, 0x14, 0xf8, 0x38, 0x58,
-	0x75, 0xfe, 0x84, 0xe1, 0x4d, 0x4c, 0x97, 0xbb, 0xd6, 0xc5, 0xa6, 0x5e,
-	0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06, 0xec, 0x2d, 0x37, 0x87, 0xb0,
-	0xc0, 0x40, 0xc4, 0x06, 0xa6, 0x61, 0x86, 0x18, 0x08, 0xc8, 0x41, 0x5b,
-	0x21, 0x17, 0x5f, 0x79, 0x9f, 0x8b, 0x2b, 0x75, 0x0c, 0xc0, 0x08, 0xa9,
-	0x46, 0x2f, 0xd3, 0x48, 0x89, 0x41, 0x80, 0x90, 0x88, 0x02, 0xd7, 0x39,
-	0xf7, 0x7f, 0xfa, 0x40, 0x61, 0x80, 0x40, 0x9d, 0x84, 0xc1, 0xd0, 0xe6,
-	0x5a, 0x2d, 0xad, 0xc6, 0x66, 0x4f, 0xd6, 0x00, 0x24, 0xdd, 0x46, 0x5c,
-	0x06, 0xb3, 0x88, 0x64, 0x45, 0x1a, 0xd6, 0x71, 0x34, 0xe9, 0xad, 0xed,
-	0x34, 0x9d, 0x31, 0x00, 0x31, 0xc8, 0x51, 0x91, 0x00, 0xb3, 0x1a, 0x45,
-	0x6b, 0x50, 0x0b, 0x06, 0x17, 0x43, 0xcf, 0xcb, 0x84, 0x4c, 0x17, 0x27,
-	0x4b, 0x36, 0x74, 0xe9, 0x0d, 0x49, 0x25, 0x4c, 0xa9, 0x00, 0x01, 0x50,
-	0x2b, 0x2b, 0x05, 0x63, 0xe3, 0xc9, 0x1e, 0xb0, 0x54, 0x42, 0xff, 0xfb,
-	0x22, 0xc4, 0xe8, 0x00, 0x08, 0x3c, 0x43, 0x55, 0xa6, 0x04, 0x70, 0x70,
-	0xc7, 0x87, 0x66, 0xe4, 0xf3, 0x0c, 0x68, 0x03, 0x83, 0x25, 0x45, 0xc2,
-	0x47, 0x0b, 0x80, 0x81, 0xe0, 0xda, 0x8a, 0x14, 0x72, 0xb0, 0xc7, 0x7b,
-	0x12, 0x74, 0x86, 0xb6, 0x0a, 0x85, 0x16, 0x57, 0x7f, 0xad, 0x00, 0xf5,
-	0x6a, 0x10, 0x0c, 0x84, 0x0e, 0x0e, 0x56, 0xdd, 0xb0, 0x45, 0x00, 0xa5,
-	0x0c, 0x15, 0x46, 0x25, 0x0f, 0x06, 0xcf, 0x52, 0xc7, 0x06, 0x05, 0x6c,
-	0xa5, 0xaa, 0xda, 0x51, 0x1c, 0x22, 0x87, 0xcb, 0xfa, 0xaf, 0x40, 0x94,
-	0x2c, 0x2b, 0x0d, 0x48, 0xe0, 0xd0, 0x54, 0xe6, 0x93, 0x7c, 0xd0, 0x4a,
-	0x22, 0x5d, 0xe5, 0x5a, 0x6d, 0xa3, 0xc3, 0x24, 0x53, 0xa9, 0x4d, 0x0e,
-	0x84, 0x5c, 0x63, 0x94, 0x19, 0x69, 0x26, 0x55, 0x7b, 0x22, 0x01, 0xe8,
-	0xb0, 0xac, 0x23, 0x8d, 0x84, 0x13, 0xf0, 0x91, 0x99, 0xff, 0xfb, 0x20,
-	0xc4, 0xe5, 0x00, 0x06, 0x80, 0x45, 0x41, 0xa7, 0xa4, 0x62, 0xe0, 0xe0,
-	0x88, 0xa6, 0x60, 0xc4, 0x8c, 0xe0, 0x67, 0xad, 0x46, 0xc4, 0x63, 0xa7,
-	0xb7, 0x7d, 0x07, 0x3d, 0x7a, 0x16, 0xc3, 0x90, 0xf9, 0x81, 0xaf, 0x41,
-	0xb0, 0xa7, 0x6a, 0xd2, 0x39, 0xd6, 0xff, 0xa5, 0xef, 0xf6, 0x01, 0x48,
-	0x17, 0x35, 0xaf, 0x4c, 0xa2, 0x28, 0x92, 0x80, 0x2d, 0x15, 0x4b, 0xea,
-	0x41, 0x44, 0xed, 0x9e, 0xb2, 0xc2, 0x56, 0x91, 0x24, 0x92, 0x0c, 0x89,
-	0xd5, 0x47, 0x25, 0xcb, 0x3a, 0xb6, 0x5b, 0x1a, 0xa9, 0x8e, 0xcb, 0x58,
-	0xbf, 0xaa, 0xcc, 0xbf, 0x52, 0xaf, 0xa5, 0xbe, 0xe2, 0x7b, 0x9e, 0x4a,
-	0x8f, 0x67, 0xf3, 0x14, 0x3a, 0xd2, 0xad, 0x33, 0x0d, 0xea, 0xdc, 0x55,
-	0xf3, 0x0a, 0x00, 0xd2, 0x0c, 0x8b, 0x23, 0xa0, 0xea, 0xbc, 0xc1, 0x61,
-	0x64, 0xc1, 0x93, 0x44, 0x7a, 0xaa, 0xf1, 0xff, 0xfb, 0x22, 0xc4, 0xe5,
-	0x00, 0x05, 0xd8, 0x2f, 0x32, 0xa7, 0x84, 0xc4, 0x00, 0xfc, 0x13, 0xa6,
-	0x21, 0x84, 0x8c, 0xa8, 0x21, 0xa9, 0x17, 0x22, 0x08, 0xca, 0xe2, 0xcd,
-	0x02, 0x2c, 0xff, 0x39, 0xa9, 0x97, 0x02, 0x91, 0x09, 0x3c, 0x1b, 0x50,
-	0x7a, 0xa4, 0x06, 0x5a, 0x92, 0xe9, 0xc2, 0x4f, 0xc2, 0x69, 0x75, 0x64,
-	0x36, 0x72, 0x46, 0xff, 0x70, 0x8a, 0x32, 0x1a, 0xe1, 0xb2, 0x18, 0x11,
-	0x55, 0xa8, 0x4b, 0xf3, 0x6e, 0x8d, 0x94, 0x89, 0x85, 0x96, 0xe5, 0x38,
-	0x20, 0x24, 0xd1, 0xe5, 0x90, 0x04, 0x19, 0x80, 0x09, 0xe2, 0xc1, 0x05,
-	0x89, 0xc3, 0xe1, 0x43, 0x83, 0x4d, 0xab, 0x18, 0xcc, 0x70, 0x87, 0xb2,
-	0xb1, 0xc6, 0x7f, 0xbb, 0x8c, 0xef, 0xa1, 0x00, 0xb8, 0xd4, 0x08, 0x72,
-	0x0b, 0x02, 0x80, 0x90, 0xd1, 0x12, 0x81, 0x65, 0x26, 0xc4, 0x62, 0x22,
-	0x76, 0xd6, 0x44, 0x26, 0x46, 0x75, 0xff, 0xfb, 0x22, 0xc4, 0xe5, 0x00,
-	0x86, 0x48, 0x63, 0x32, 0xa6, 0x0c, 0x50, 0x80, 0xf3, 0x0c, 0x65, 0xe0,
-	0xf3, 0x0d, 0x20, 0x02, 0xa8, 0x72, 0xc4, 0xca, 0xfc, 0x3a, 0x42, 0x01,
-	0x60, 0x29, 0xe8, 0x22, 0x31, 0x03, 0x98, 0x60, 0x51, 0xe4, 0x09, 0x6e,
-	0x8c, 0x5d, 0xc9, 0x88, 0x74, 0xd5, 0x70, 0xd6, 0xf7, 0xf9, 0x45, 0x8e,
-	0xbb, 0xac, 0x14, 0xd4, 0x70, 0xa5, 0xca, 0x46, 0x09, 0xe1, 0x2c, 0xc4,
-	0x8b, 0x4c, 0x56, 0xb0, 0xa0, 0x43, 0x80, 0x2b, 0x0d, 0x04, 0xe4, 0xf3,
-	0x9c, 0xc2, 0xf0, 0x7a, 0x1c, 0x0d, 0x0c, 0x5a, 0x66, 0x1e, 0xc5, 0x86,
-	0x4c, 0x89, 0x23, 0xd3, 0xa1, 0xa9, 0xa9, 0xef, 0xa9, 0xcf, 0xad, 0x5f,
-	0xff, 0x5d, 0xa6, 0x54, 0x12, 0xa6, 0x01, 0x1c, 0x06, 0x00, 0xa0, 0x9e,
-	0x57, 0x1c, 0xf1, 0x25, 0xb5, 0x7d, 0x4e, 0xc4, 0xb3, 0xf5, 0xf4, 0xc6,
-	0x05, 0x9e, 0x99, 0x3b, 0xdc, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x80, 0x05,
-	0xac, 0x29, 0x3d, 0x86, 0x18, 0xc4, 0xa1, 0x06, 0x8d, 0xa6, 0x65, 0x84,
-	0x8c, 0x78, 0x9c, 0x24, 0xb9, 0xd1, 0xa1, 0x7f, 0xe7, 0x10, 0xb2, 0x3a,
-	0x81, 0x09, 0x6d, 0xb2, 0xbf, 0x4e, 0x65, 0x6e, 0xf7, 0xae, 0x9d, 0x49,
-	0x13, 0xe7, 0x9b, 0xfd, 0xce, 0x04, 0x25, 0x6a, 0x5c, 0xaf, 0x66, 0xb2,
-	0x8a, 0xab, 0x08, 0x00, 0xc0, 0x9f, 0x0b, 0xd7, 0x8e, 0x4a, 0xd5, 0x51,
-	0xc0, 0x74, 0x93, 0x98, 0x39, 0xc8, 0xd2, 0x27, 0x24, 0x41, 0x72, 0x15,
-	0x05, 0x54, 0x78, 0x47, 0x73, 0x08, 0xaa, 0xc0, 0xa0, 0x19, 0x55, 0x92,
-	0x3a, 0xa5, 0x29, 0x67, 0x9c, 0xeb, 0xd2, 0xff, 0xff, 0xfb, 0xcf, 0x31,
-	0x24, 0x4b, 0xd5, 0x3b, 0xb7, 0x25, 0x00, 0x58, 0x1f, 0x08, 0xdf, 0x43,
-	0x03, 0xa3, 0x46, 0x93, 0xa5, 0x74, 0x6b, 0x2f, 0x17, 0xda, 0x44, 0xa9,
-	0xbb, 0xba, 0x7e, 0xff, 0xfb, 0x22, 0xc4, 0xe3, 0x80, 0x05, 0xe4, 0x3f,
-	0x41, 0x86, 0x18, 0x43, 0xe0, 0xdf, 0x13, 0x27, 0xf4, 0xc3, 0x08, 0xfc,
-	0xe2, 0xf9, 0xa1, 0xad, 0xf0, 0x40, 0x00, 0x5c, 0xe6, 0x2c, 0x7d, 0x27,
-	0x41, 0x60, 0x50, 0x9a, 0x84, 0x88, 0xec, 0x4c, 0xc8, 0x81, 0xab, 0x13,
-	0x2b, 0x43, 0xc3, 0xf4, 0x5d, 0x6a, 0xb6, 0xd4, 0x94, 0x1d, 0xd2, 0x7a,
-	0x84, 0xa8, 0x94, 0x08, 0x06, 0x43, 0x34, 0xe8, 0x8a, 0x39, 0x05, 0xc9,
-	0xeb, 0xb4, 0xf4, 0xc2, 0x11, 0x8d, 0xba, 0x69, 0xd0, 0x08, 0x48, 0xfa,
-	0x59, 0x41, 0x11, 0x00, 0x28, 0x30, 0x28, 0xc1, 0x7b, 0x65, 0x98, 0x72,
-	0x12, 0x13, 0x9e, 0x71, 0x4e, 0x1f, 0x60, 0xb6, 0xaf, 0xd6, 0x04, 0xc7,
-	0x14, 0x48, 0xfa, 0xaf, 0x84, 0x41, 0x52, 0x72, 0x21, 0xa3, 0x68, 0x47,
-	0xc6, 0x54, 0x2e, 0x2a, 0x9c, 0x9e, 0xa9, 0x79, 0x7d, 0x5f, 0x25, 0x2a,
-	0xfb, 0xbb, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x07, 0x74, 0x63, 0x3d,
-	0x86, 0x18, 0x67, 0x20, 0xc8, 0x88, 0x66, 0xa0, 0xf3, 0x0c, 0x98, 0xd9,
-	0x02, 0x9c, 0xcc, 0x51, 0xd9, 0x01, 0x52, 0xee, 0x60, 0xce, 0xfe, 0x15,
-	0x8a, 0x75, 0x2b, 0xd9, 0x4a, 0xcd, 0xf6, 0x74, 0xa5, 0x63, 0x17, 0xeb,
-	0x6f, 0xeb, 0x4c, 0x8b, 0x47, 0x24, 0xff, 0x4b, 0xb0, 0x9c, 0xb9, 0xa2,
-	0xbb, 0xba, 0x06, 0xee, 0x35, 0x08, 0xa8, 0x2b, 0x00, 0xed, 0x83, 0xa5,
-	0x88, 0xc2, 0xc9, 0xa6, 0x4c, 0xf4, 0x89, 0x99, 0x37, 0x27, 0x18, 0x8a,
-	0xe2, 0x93, 0xa0, 0x67, 0xbd, 0xa3, 0x8f, 0x6b, 0x07, 0x03, 0x8f, 0x80,
-	0xc2, 0x22, 0xb0, 0x20, 0x11, 0xb5, 0x13, 0x6a, 0x4b, 0x00, 0xd9, 0x52,
-	0xdf, 0x8c, 0x56, 0x9d, 0x1e, 0x4b, 0xea, 0x0a, 0x16, 0x06, 0x00, 0x2e,
-	0xa1, 0x2a, 0xb9, 0x86, 0x89, 0xa1, 0x46, 0x43, 0xf3, 0x10, 0x34, 0x9a,
-	0x6c, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00, 0x07, 0x38, 0x41, 0x35, 0x87,
-	0xa4, 0x65, 0x40, 0xc8, 0x86, 0x27, 0x70, 0xf2, 0x98, 0x88, 0x99, 0x8d,
-	0xa7, 0x9e, 0xae, 0xe2, 0x05, 0x31, 0x87, 0x04, 0xcb, 0xd9, 0x15, 0x7c,
-	0x95, 0x1c, 0x7b, 0x5a, 0x08, 0x11, 0x6d, 0xce, 0x1d, 0x18, 0xf2, 0x56,
-	0x59, 0x4a, 0xf5, 0x30, 0x0d, 0xdd, 0x86, 0x00, 0x50, 0x16, 0x70, 0x5e,
-	0x2e, 0x89, 0x18, 0x13, 0x60, 0x94, 0xc5, 0x4e, 0x11, 0xad, 0x5a, 0x59,
-	0x5c, 0x59, 0xc4, 0x68, 0x02, 0x46, 0x3f, 0xb9, 0x5c, 0xd3, 0x3a, 0xc3,
-	0x26, 0xb4, 0x0a, 0xa4, 0x12, 0x3d, 0x0d, 0x00, 0x8f, 0x1e, 0x17, 0x41,
-	0x8a, 0x12, 0x78, 0xf4, 0xae, 0x64, 0x3a, 0x97, 0x48, 0x64, 0x69, 0xdb,
-	0x96, 0xe1, 0x2c, 0xa5, 0x55, 0x49, 0xc9, 0x1c, 0x6d, 0x7b, 0x28, 0x82,
-	0x00, 0xa6, 0x81, 0xc5, 0x18, 0x33, 0x64, 0x50, 0x11, 0x34, 0x88, 0xff,
-	0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x07, 0x50, 0xbb, 0x31, 0x06, 0x18, 0x6c,
-	0xc0, 0xca, 0x86, 0x26, 0xa4, 0xf0, 0x18, 0x80, 0x29, 0xec, 0x30, 0x98,
-	0xe0, 0xb2, 0xbf, 0xda, 0x1c, 0x82, 0x86, 0x04, 0xc0, 0x14, 0x0e, 0xb0,
-	0xd6, 0x2a, 0x86, 0xf1, 0x57, 0xa0, 0x17, 0x5d, 0xad, 0xd2, 0xa6, 0xd0,
-	0xdf, 0xfd, 0x30, 0x88, 0x0a, 0xa9, 0x10, 0x62, 0x19, 0x06, 0x2a, 0x1f,
-	0x89, 0x01, 0xa4, 0x95, 0xf4, 0x8d, 0xb0, 0x84, 0x47, 0xe9, 0x2d, 0x22,
-	0x5d, 0xe4, 0x33, 0xe7, 0x99, 0x94, 0xdb, 0x94, 0x90, 0xf1, 0x00, 0x94,
-	0x99, 0x25, 0x8b, 0x03, 0x82, 0x88, 0x52, 0x87, 0x9d, 0x45, 0x16, 0x9c,
-	0x37, 0xf4, 0xf7, 0x2c, 0x1f, 0x46, 0x9a, 0xf4, 0x11, 0xb5, 0x91, 0x8a,
-	0x06, 0x56, 0x41, 0x04, 0x2e, 0x22, 0x00, 0x74, 0x04, 0x15, 0x93, 0xb3,
-	0x2e, 0x36, 0x34, 0x89, 0xe1, 0x55, 0x1b, 0x51, 0x50, 0x15, 0xff, 0xfb,
-	0x20, 0xc4, 0xe7, 0x80, 0x07, 0x5c, 0x3f, 0x33, 0x27, 0xb0, 0x63, 0x80,
-	0xbc, 0x07, 0x26, 0x00, 0xf4, 0x98, 0x08, 0x02, 0x26, 0x88, 0xf0, 0xa4,
-	0x2f, 0x40, 0xe3, 0x4b, 0x5a, 0xf0, 0xb4, 0x93, 0xf2, 0x04, 0x18, 0xa9,
-	0x25, 0x1f, 0x0d, 0x29, 0x11, 0xa5, 0x0f, 0xbc, 0xe9, 0xb8, 0x23, 0x5d,
-	0xf7, 0xf4, 0xf7, 0xb9, 0x63, 0xf1, 0xd9, 0xdd, 0xa5, 0x7d, 0x64, 0xa8,
-	0x0c, 0x00, 0x58, 0x2a, 0xd8, 0xec, 0x1c, 0x65, 0x09, 0x83, 0xd3, 0x28,
-	0x01, 0x9a, 0x86, 0x1e, 0x4c, 0x81, 0x31, 0x28, 0x6c, 0xb0, 0x58, 0xba,
-	0x2f, 0x28, 0x93, 0x89, 0x38, 0x14, 0x6d, 0xa6, 0x7d, 0xfb, 0xce, 0xbe,
-	0x37, 0x94, 0xd5, 0x6c, 0x8e, 0x60, 0xf6, 0xda, 0x1e, 0xeb, 0x66, 0x84,
-	0x58, 0x06, 0x3c, 0x1f, 0x96, 0x81, 0x50, 0xf4, 0x60, 0x6b, 0x96, 0x28,
-	0x1c, 0xf1, 0x85, 0x0e, 0x4d, 0xc1, 0x2f, 0xaa, 0xff, 0xfb, 0x22, 0xc4,
-	0xe9, 0x00, 0x08, 0x5c, 0xe7, 0x37, 0x87, 0xb0, 0x43, 0xc8, 0xd4, 0x88,
-	0x66, 0xe4, 0xc3, 0x0c, 0xa8, 0xb6, 0xe2, 0x1b, 0x37, 0x4e, 0x28, 0xd0,
-	0x08, 0x4e, 0x28, 0x64, 0x2c, 0xb7, 0x04, 0x5b, 0x0b, 0x0e, 0x7d, 0xb6,
-	0x17, 0x34, 0xa5, 0xbe, 0xa6, 0x5c, 0x3f, 0xa9, 0x8d, 0x6e, 0xab, 0xe2,
-	0xb9, 0x0a, 0x00, 0x4a, 0x24, 0xca, 0x1c, 0x83, 0x40, 0x3a, 0x00, 0xa5,
-	0x83, 0x48, 0x7c, 0x4d, 0x7f, 0x24, 0x44, 0x65, 0x22, 0x60, 0xfa, 0x93,
-	0xd3, 0x8c, 0x13, 0x63, 0x31, 0xa3, 0xe6, 0x44, 0xe2, 0x6d, 0x05, 0x4e,
-	0x44, 0x21, 0x63, 0xc3, 0x00, 0xa0, 0xb0, 0x8e, 0x79, 0x1a, 0xd5, 0x6d,
-	0xb8, 0xa7, 0x51, 0x67, 0xf2, 0x4b, 0xf9, 0xca, 0x3b, 0x92, 0xe1, 0x6a,
-	0x06, 0xa7, 0x02, 0x0c, 0x26, 0x41, 0x72, 0x78, 0x09, 0x8e, 0x66, 0xd7,
-	0x68, 0xf4, 0xae, 0x07, 0x40, 0x86, 0x4d, 0xff, 0xfb, 0x22, 0xc4, 0xe4,
-	0x00, 0x05, 0xf8, 0x65, 0x33, 0x07, 0x98, 0x43, 0x80, 0xf2, 0x88, 0xe6,
-	0x64, 0xf6, 0x18, 0x60, 0xf3, 0x50, 0x2d, 0x3d, 0x62, 0xf9, 0x85, 0x09,
-	0x80, 0x94, 0xd6, 0x40, 0x05, 0x98, 0x90, 0x70, 0x26, 0xc6, 0x05, 0x8b,
-	0xab, 0xb9, 0x03, 0x5a, 0x71, 0xb3, 0xfd, 0x5d, 0xef, 0xef, 0xa7, 0x46,
-	0xc7, 0xcb, 0x92, 0x80, 0x34, 0xf0, 0xe3, 0xbc, 0x3f, 0x94, 0x85, 0xd0,
-	0x8b, 0x81, 0xb2, 0xf4, 0xe4, 0xaf, 0x24, 0x90, 0x35, 0xca, 0xb6, 0xe5,
-	0xcf, 0xa1, 0x1c, 0xe1, 0xea, 0x4f, 0x35, 0x65, 0x4b, 0x0a, 0x96, 0x78,
-	0x73, 0x84, 0x1a, 0x1d, 0x99, 0x5b, 0xab, 0xf3, 0x87, 0xaa, 0x31, 0xbd,
-	0x1d, 0xd1, 0xd9, 0x4a, 0x0c, 0xc8, 0xe5, 0x88, 0x4a, 0x80, 0x00, 0xb4,
-	0x0f, 0x10, 0xc9, 0x48, 0x26, 0x06, 0x24, 0x97, 0x16, 0x36, 0xb4, 0x4e,
-	0x2f, 0x9e, 0x38, 0xbd, 0x81, 0xe8, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x80,
-	0x06, 0x34, 0x43, 0x4d, 0x86, 0x18, 0x61, 0x70, 0xdf, 0x08, 0xe6, 0x21,
-	0x85, 0x98, 0x50, 0x4d, 0x50, 0x4e, 0xac, 0x53, 0x64, 0xd2, 0xcc, 0x8c,
-	0x25, 0xbf, 0x4c, 0xb3, 0xf6, 0x0b, 0x1a, 0xd9, 0xe8, 0x19, 0x18, 0xa1,
-	0x82, 0xc4, 0x94, 0x12, 0x37, 0x17, 0x01, 0x0b, 0x55, 0x75, 0x50, 0xf5,
-	0x8f, 0xb9, 0x89, 0x6a, 0x1e, 0xd8, 0xe2, 0xa4, 0xc8, 0xc0, 0x61, 0x02,
-	0xbc, 0x0f, 0x04, 0x01, 0xa3, 0xa6, 0x16, 0x62, 0x47, 0x16, 0xc7, 0x75,
-	0x76, 0xe9, 0x02, 0x06, 0x22, 0x7d, 0x25, 0x1a, 0x7d, 0xac, 0xd6, 0x4d,
-	0x92, 0x62, 0x82, 0x72, 0x71, 0x3e, 0x9c, 0xf0, 0x0c, 0x3e, 0x97, 0x18,
-	0x38, 0xda, 0x1b, 0xdd, 0xdb, 0xd1, 0x27, 0x40, 0x00, 0x5a, 0x41, 0xce,
-	0xce, 0x86, 0xa4, 0x98, 0xee, 0x13, 0x58, 0x41, 0xc1, 0x40, 0x24, 0x92,
-	0xc7, 0xc9, 0xe7, 0x56, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x07, 0x6c,
-	0x65, 0x31, 0x07, 0xa4, 0x61, 0xc0, 0xbc, 0x85, 0x26, 0xe4, 0x92, 0x98,
-	0x40, 0xb2, 0xee, 0x9f, 0x70, 0xc4, 0x28, 0x4f, 0x50, 0xd6, 0xa4, 0x78,
-	0xa8, 0x08, 0x5d, 0xa2, 0x93, 0xb0, 0x11, 0x81, 0x33, 0xa1, 0xc5, 0x2e,
-	0x9d, 0xae, 0x6e, 0xdc, 0xff, 0xa1, 0x34, 0xd6, 0x80, 0x26, 0x50, 0x08,
-	0xc8, 0x86, 0xa5, 0x01, 0xb0, 0xc2, 0xe4, 0x43, 0xb1, 0x42, 0xcd, 0x94,
-	0x88, 0x47, 0x87, 0x22, 0x81, 0xce, 0x05, 0x9b, 0x6b, 0x29, 0x5c, 0xb4,
-	0x36, 0x4d, 0x42, 0x8c, 0x84, 0x28, 0x8f, 0xf7, 0x3b, 0x47, 0x59, 0x6c,
-	0x74, 0x62, 0xc1, 0x2c, 0x72, 0xf2, 0xff, 0x3a, 0x47, 0xcd, 0x26, 0x33,
-	0x0c, 0xab, 0xd8, 0x6b, 0xaa, 0x4d, 0xa6, 0x9e, 0xb7, 0xb6, 0xf5, 0x58,
-	0x0b, 0x0b, 0xaa, 0x01, 0xc6, 0x40, 0xc9, 0x50, 0x19, 0x0b, 0x80, 0x1c,
-	0xd3, 0xc0, 0xc8, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x80, 0x07, 0x28, 0x43,
-	0x35, 0x28, 0x30, 0xc0, 0x40, 0xe5, 0x09, 0x26, 0xf0, 0xc4, 0x8c, 0xa8,
-	0x55, 0x2f, 0xa4, 0x83, 0x07, 0x71, 0x52, 0x5c, 0xb3, 0xde, 0x15, 0x4f,
-	0x0b, 0x34, 0x78, 0x05, 0xb3, 0xc6, 0x09, 0xaa, 0x28, 0x13, 0x6a, 0x48,
-	0x2c, 0x7e, 0xb6, 0xa8, 0x1e, 0x77, 0x5d, 0xd1, 0xa4, 0xb5, 0xab, 0x48,
-	0xb5, 0x5f, 0xa6, 0xf5, 0xb9, 0x14, 0x92, 0xdd, 0x23, 0x71, 0x20, 0x40,
-	0x30, 0x22, 0xa9, 0x1c, 0x00, 0x89, 0xd9, 0x95, 0x56, 0x0e, 0x07, 0x8b,
-	0x92, 0x4c, 0xde, 0x8d, 0x84, 0x90, 0x82, 0x26, 0xe9, 0x24, 0x05, 0x05,
-	0x00, 0x61, 0x10, 0x0d, 0x21, 0xc2, 0x54, 0xd9, 0xa8, 0x3b, 0xcd, 0x6c,
-	0x47, 0x7e, 0xe4, 0xff, 0xff, 0xfa, 0x6a, 0x20, 0x80, 0xad, 0x56, 0x9b,
-	0x45, 0xa6, 0xb1, 0x59, 0xb4, 0x06, 0x84, 0x40, 0x03, 0xe1, 0xac, 0x42,
-	0xd0, 0xff, 0xfb, 0x22, 0xc4, 0xe4, 0x80, 0x86, 0xa4, 0x35, 0x33, 0x07,
-	0xb0, 0xc0, 0xc0, 0xc5, 0x87, 0x66, 0x15, 0x86, 0x18, 0x08, 0xac, 0xf4,
-	0xec, 0xd8, 0x74, 0x31, 0xb0, 0x24, 0x42, 0x68, 0xc5, 0x01, 0x50, 0x98,
-	0x2c, 0xe6, 0x19, 0x12, 0x08, 0x93, 0x52, 0x0e, 0xd3, 0x64, 0xd4, 0x47,
-	0x1e, 0x38, 0x7c, 0x79, 0x56, 0xe7, 0xb0, 0xbd, 0xc6, 0x82, 0xa2, 0xca,
-	0x86, 0x1b, 0xd0, 0xcd, 0xf7, 0x15, 0x84, 0xed, 0x6b, 0xbf, 0x4e, 0x34,
-	0x30, 0xe2, 0x0e, 0x6b, 0x91, 0x47, 0x57, 0xff, 0xf3, 0xeb, 0x62, 0x66,
-	0x67, 0x7d, 0xdf, 0xff, 0xb8, 0xe1, 0x0f, 0xa7, 0x5b, 0x6e, 0xf6, 0x4b,
-	0x1b, 0xb2, 0x00, 0x00, 0x2a, 0x48, 0x64, 0x60, 0x46, 0x80, 0x90, 0xa9,
-	0xe2, 0xe7, 0x03, 0x48, 0x11, 0x16, 0x43, 0x24, 0x82, 0x95, 0x94, 0xad,
-	0x51, 0x05, 0x56, 0x77, 0x56, 0x96, 0xd9, 0x59, 0x6b, 0xea, 0xde, 0x38,
-	0xff, 0xfb, 0x22, 0xc4, 0xe8, 0x00, 0x08, 0x4c, 0x75, 0x39, 0x86, 0x04,
-	0x72, 0x20, 0xba, 0x07, 0xa6, 0xa0, 0xf4, 0x88, 0x38, 0x47, 0x6a, 0xfa,
-	0xa6, 0xe1, 0xa1, 0xf2, 0x04, 0x68, 0x12, 0xb9, 0x4b, 0x01, 0x08, 0x41,
-	0x04, 0x68, 0x12, 0x02, 0x32, 0x72, 0x87, 0x11, 0x4c, 0xb6, 0x66, 0x5f,
-	0x84, 0x92, 0x14, 0xfd, 0x16, 0x16, 0xd6, 0x2b, 0x5a, 0xaa, 0xf4, 0xf1,
-	0xff, 0x3a, 0x33, 0x59, 0xd2, 0x78, 0xc7, 0x21, 0xf6, 0xb6, 0x7e, 0xaf,
-	0x0f, 0x81, 0xaf, 0xfd, 0xca, 0x44, 0x35, 0x6e, 0xdc, 0x34, 0xea, 0x7d,
-	0xdf, 0x45, 0x2a, 0xf8, 0x1c, 0x57, 0x8a, 0x24, 0x29, 0xe9, 0x34, 0x38,
-	0x89, 0x4c, 0x06, 0x08, 0xd9, 0x0d, 0x05, 0x48, 0xd0, 0x8a, 0x11, 0xcd,
-	0x60, 0x3c, 0x91, 0xb2, 0x75, 0x71, 0x4e, 0x51, 0x0b, 0x53, 0x96, 0x34,
-	0x2f, 0xb8, 0xe3, 0x96, 0x04, 0x20, 0xa1, 0x72, 0x1a, 0xd6, 0xe3, 0xff,
-	0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x86, 0xb0, 0x41, 0x30, 0xa7, 0x98, 0xc4,
-	0x81, 0x06, 0x92, 0xe6, 0x61, 0x86, 0x0c, 0xe0, 0x29, 0x70, 0x6c, 0x07,
-	0x12, 0x0b, 0xa7, 0xdb, 0xff, 0x57, 0x4d, 0xb5, 0x91, 0xcb, 0x6d, 0x72,
-	0x36, 0xe2, 0x49, 0x00, 0x59, 0x1c, 0x06, 0x26, 0xa8, 0xdc, 0x81, 0x7b,
-	0xaa, 0x12, 0x13, 0x97, 0x32, 0x4b, 0x31, 0x52, 0x72, 0xd2, 0x24, 0x2c,
-	0x6d, 0xb8, 0x50, 0xd8, 0xaf, 0x67, 0x62, 0x35, 0x38, 0x37, 0x34, 0x6c,
-	0x61, 0x71, 0xed, 0x26, 0x3d, 0xb9, 0xba, 0x18, 0x6f, 0xfa, 0x96, 0x7e,
-	0xff, 0x18, 0x93, 0x08, 0xa4, 0x16, 0x5c, 0x00, 0x10, 0x90, 0x22, 0xc0,
-	0xe4, 0x48, 0x15, 0x09, 0xc4, 0x62, 0x4e, 0x16, 0x22, 0xd0, 0x83, 0x87,
-	0x6a, 0x20, 0x24, 0xd0, 0x72, 0x35, 0xec, 0xc9, 0xc8, 0x59, 0x93, 0x29,
-	0x16, 0x53, 0xc9, 0x9d, 0x24, 0x74, 0x22, 0xe0, 0x34, 0xff, 0xfb, 0x22,
-	0xc4, 0xe1, 0x00, 0x06, 0x84, 0x2f, 0x36, 0xa7, 0xbc, 0xc0, 0xc0, 0xc8,
-	0x86, 0xab, 0x76, 0x98, 0x60, 0x06, 0x71, 0x52, 0x5f, 0x5b, 0xd4, 0x14,
-	0xf5, 0x6c, 0x30, 0xa9, 0x93, 0xcc, 0xba, 0xd5, 0xda, 0x05, 0x35, 0x12,
-	0x20, 0x69, 0x47, 0x00, 0x9e, 0x3f, 0x8e, 0xcd, 0x03, 0xa3, 0xf9, 0xbf,
-	0x28, 0x2b, 0xbc, 0x70, 0x3d, 0xc0, 0x8a, 0xa0, 0x94, 0x0c, 0xd3, 0x39,
-	0x52, 0x3d, 0x67, 0x33, 0x77, 0xa4, 0x8b, 0xf9, 0xaf, 0xd8, 0x46, 0x21,
-	0xaf, 0x8b, 0x39, 0x59, 0xc1, 0x55, 0x87, 0x0a, 0x4b, 0xff, 0x43, 0xd6,
-	0xa4, 0x6b, 0x50, 0x86, 0x5d, 0xec, 0x51, 0x8b, 0xab, 0x1f, 0xa6, 0xc6,
-	0x71, 0x74, 0x25, 0xc5, 0xba, 0xcd, 0x4c, 0x4a, 0xa9, 0x71, 0xd6, 0xa6,
-	0x8e, 0xcc, 0x59, 0x2b, 0x4f, 0x5e, 0x2e, 0xc3, 0xb4, 0xdb, 0xbb, 0xb1,
-	0xfe, 0xc8, 0xcc, 0x4b, 0x9d, 0xac, 0x2c, 0xa1, 0xff, 0xfb, 0x20, 0xc4,
-	0xe4, 0x80, 0x0a, 0xf9, 0x1b, 0x55, 0xb8, 0x93, 0x80, 0x00, 0xd1, 0x0e,
-	0xae, 0x37, 0x92, 0x20, 0x06, 0x09, 0xf3, 0xf6, 0xa8, 0xb0, 0xc6, 0x17,
-	0x7e, 0xd6, 0xd8, 0xe2, 0x88, 0x5a, 0xfa, 0x3a, 0x99, 0x45, 0x26, 0xea,
-	0x01, 0x92, 0x00, 0x00, 0x3b, 0x45, 0x62, 0xca, 0x28, 0xe7, 0x4e, 0x1f,
-	0xb6, 0x04, 0x4a, 0x03, 0x29, 0x64, 0x4c, 0xe5, 0x84, 0xa0, 0x63, 0x16,
-	0xc6, 0x4e, 0x1d, 0x26, 0x9a, 0x7d, 0xc9, 0x9b, 0x3c, 0xa3, 0x02, 0x36,
-	0x69, 0x60, 0x12, 0xcc, 0x55, 0x63, 0x5c, 0x64, 0x1a, 0x23, 0x58, 0x97,
-	0xa8, 0xaf, 0x3b, 0xff, 0x74, 0x9b, 0x6d, 0x74, 0xd1, 0xb7, 0x13, 0x48,
-	0x02, 0x81, 0x73, 0x63, 0x40, 0xc3, 0x00, 0x18, 0x83, 0x01, 0x00, 0xc7,
-	0x18, 0x30, 0x78, 0x41, 0x44, 0xc8, 0x03, 0xc1, 0xa0, 0xc9, 0x15, 0x54,
-	0xed, 0xa4, 0xe0, 0xe5, 0x91, 0x22, 0xff, 0xfb, 0x22, 0xc4, 0xd5, 0x00,
-	0x06, 0xac, 0x73, 0x3b, 0x27, 0xb0, 0x65, 0x40, 0xe0, 0x0b, 0xa7, 0x14,
-	0xf4, 0x8c, 0xa8, 0x86, 0xd8, 0xb6, 0xec, 0xe1, 0xc5, 0x4a, 0xed, 0xb1,
-	0x7d, 0x7b, 0x6d, 0x8b, 0x55, 0x0e, 0x36, 0xdb, 0x2c, 0xc4, 0x98, 0x28,
-	0x00, 0xaf, 0x2d, 0x49, 0x68, 0x81, 0xc7, 0x98, 0x94, 0x18, 0x02, 0x20,
-	0xce, 0x3b, 0x8c, 0x0c, 0x1a, 0x02, 0x0f, 0x3e, 0xc0, 0x3a, 0x82, 0x65,
-	0xe7, 0x46, 0x3b, 0x14, 0x5a, 0x42, 0x6b, 0x7d, 0xa1, 0x7e, 0xf5, 0x55,
-	0xd1, 0xea, 0xff, 0xa4, 0x45, 0x5b, 0x50, 0x93, 0x21, 0x21, 0x30, 0x01,
-	0xa9, 0x60, 0x7d, 0x11, 0x0c, 0xe3, 0x16, 0x17, 0x9c, 0x85, 0xf3, 0x08,
-	0x5d, 0xf9, 0x7f, 0x02, 0x26, 0xcf, 0x0b, 0x47, 0xc2, 0x16, 0x87, 0x24,
-	0xe8, 0x60, 0xa3, 0x94, 0x54, 0xc6, 0x75, 0x3f, 0x98, 0xf6, 0x7e, 0xf7,
-	0x1a, 0xfd, 0xea, 0x3d, 0x20, 0xff, 0xfb, 0x22, 0xc4, 0xd5, 0x00, 0x07,
-	0x18, 0x65, 0x57, 0xa6, 0x0c, 0x4e, 0xf0, 0xdc, 0x87, 0xe6, 0xe5, 0x04,
-	0x98, 0x08, 0x00, 0x7f, 0x0f, 0x94, 0xf2, 0x01, 0x1c, 0xce, 0x34, 0xd4,
-	0x65, 0xc5, 0x10, 0x56, 0xc3, 0xd8, 0x0d, 0x90, 0x3a, 0xc2, 0x48, 0x04,
-	0x03, 0x00, 0xba, 0xe4, 0x9d, 0x58, 0x10, 0x07, 0x53, 0x88, 0x5a, 0xb5,
-	0x2c, 0xa9, 0x23, 0x87, 0x18, 0x5c, 0xd6, 0x4f, 0xae, 0x8f, 0xc5, 0x37,
-	0x04, 0x6a, 0x6a, 0x24, 0x68, 0x58, 0x01, 0x8c, 0x55, 0xc8, 0x60, 0x7c,
-	0xc8, 0x36, 0x21, 0xc3, 0x07, 0xc8, 0xc5, 0x39, 0x24, 0x48, 0xa4, 0x50,
-	0x08, 0x50, 0x4c, 0x20, 0x38, 0xc3, 0xc0, 0xaa, 0x94, 0xe7, 0xbe, 0x30,
-	0xfd, 0x02, 0x1f, 0x8b, 0xb5, 0xc1, 0x40, 0xe7, 0x8b, 0x58, 0xea, 0x25,
-	0x79, 0x79, 0x89, 0x96, 0x7d, 0x65, 0x72, 0x00, 0x04, 0x90, 0x78, 0x88,
-	0x88, 0x85, 0x14, 0xfa, 0xff, 0xfb, 0x20, 0xc4, 0xd4, 0x00, 0x07, 0x34,
-	0x67, 0x39, 0x86, 0x18, 0x6c, 0x40, 0xde, 0x8c, 0xa6, 0xa0, 0xf4, 0x8c,
-	0xb0, 0xc6, 0x14, 0x44, 0x42, 0xb4, 0xe4, 0xc0, 0x50, 0x1b, 0x12, 0xa0,
-	0x3e, 0xbb, 0xb9, 0x21, 0x8e, 0xa3, 0x48, 0xd8, 0x76, 0x74, 0x8a, 0x0b,
-	0x7a, 0x97, 0xfa, 0xdd, 0xea, 0xef, 0xfb, 0xc5, 0xa6, 0x8c, 0xc0, 0x1b,
-	0x85, 0xa5, 0x10, 0x14, 0x02, 0x9d, 0x83, 0xd8, 0x2a, 0x9c, 0x06, 0x05,
-	0x07, 0x9b, 0xb9, 0xb0, 0xc2, 0x6d, 0xba, 0x87, 0x02, 0x2d, 0xe3, 0x80,
-	0xcb, 0xe5, 0x7f, 0x08, 0x4e, 0x7e, 0x4e, 0x62, 0x01, 0x7a, 0xc4, 0x8c,
-	0x3f, 0xd8, 0x84, 0x70, 0xc2, 0xe3, 0x6d, 0x46, 0xce, 0xdf, 0x63, 0x6a,
-	0x07, 0x6b, 0x01, 0x01, 0x58, 0x22, 0x23, 0x4b, 0x87, 0xe1, 0xa7, 0x91,
-	0xfa, 0xa3, 0x65, 0xd2, 0x32, 0x85, 0x26, 0x9a, 0x32, 0x72, 0x49, 0xc9,
-	0x72, 0x70, 0xff, 0xfb, 0x22, 0xc4, 0xd1, 0x80, 0x06, 0x94, 0x65, 0x33,
-	0x07, 0x98, 0x65, 0x40, 0xca, 0x04, 0xeb, 0x34, 0x93, 0x18, 0x96, 0xca,
-	0xa3, 0x02, 0x11, 0x8b, 0x6b, 0x48, 0x91, 0x02, 0x0a, 0xa4, 0x59, 0xa3,
-	0x9f, 0x17, 0x0a, 0x14, 0x1e, 0x39, 0xd0, 0x90, 0xcd, 0x4e, 0x69, 0xdd,
-	0x36, 0x74, 0x76, 0xb6, 0x2a, 0xe7, 0x06, 0xa4, 0xdb, 0x7b, 0xed, 0x92,
-	0x38, 0xda, 0x00, 0x26, 0x15, 0x27, 0x3e, 0x3f, 0x10, 0x1b, 0x7e, 0xc6,
-	0x02, 0x41, 0x64, 0xca, 0x1c, 0x0e, 0x1d, 0x00, 0x10, 0x2d, 0x2d, 0x50,
-	0x64, 0xd0, 0x74, 0x32, 0x08, 0x87, 0x43, 0x83, 0x1a, 0xca, 0x18, 0xe7,
-	0xa4, 0xa8, 0x76, 0xc6, 0x84, 0x04, 0xb4, 0x87, 0x8f, 0xa4, 0x8f, 0x1a,
-	0xdf, 0xfd, 0x75, 0x15, 0xe9, 0xb6, 0x91, 0x44, 0x51, 0x44, 0x80, 0xa8,
-	0x32, 0x02, 0x84, 0x48, 0x0f, 0x14, 0x22, 0x8a, 0x46, 0x89, 0x02, 0x8b,
-	0x18, 0xff, 0xfb, 0x22, 0xc4, 0xd4, 0x80, 0x05, 0xd8, 0x2b, 0x3d, 0xa7,
-	0xb0, 0x60, 0x40, 0xba, 0x8a, 0xa7, 0xb4, 0xc0, 0x8d, 0xd0, 0xd9, 0xa9,
-	0x04, 0x08, 0x18, 0x2a, 0xe2, 0x6a, 0x77, 0x16, 0x60, 0x46, 0xec, 0x27,
-	0x20, 0x27, 0x1d, 0x2e, 0x87, 0x39, 0xf4, 0x54, 0x83, 0x2c, 0x85, 0xd9,
-	0xc4, 0xff, 0xfa, 0xcd, 0xd3, 0xe8, 0x49, 0xc8, 0x95, 0x25, 0x58, 0xbf,
-	0x80, 0x98, 0x06, 0xf8, 0x44, 0x0a, 0xd2, 0x8f, 0xac, 0x9f, 0xa3, 0x19,
-	0x64, 0x92, 0xd4, 0x53, 0x44, 0x8e, 0x51, 0xcd, 0x95, 0x68, 0xa5, 0x00,
-	0x0e, 0x95, 0x54, 0x8b, 0xb6, 0x21, 0x85, 0xd6, 0x47, 0x68, 0x56, 0xc6,
-	0x8b, 0x01, 0x58, 0x31, 0xb6, 0x4b, 0x07, 0x10, 0xf5, 0x33, 0xcb, 0x5f,
-	0x4f, 0x28, 0x06, 0xba, 0x11, 0x40, 0xa8, 0x07, 0xa0, 0xaa, 0x02, 0xa3,
-	0x44, 0xfd, 0xfe, 0x4a, 0xad, 0x69, 0x48, 0xce, 0x0f, 0x87, 0x80, 0xc2,
-	0xff, 0xfb, 0x20, 0xc4, 0xdc, 0x80, 0x06, 0x04, 0x2d, 0x32, 0xa7, 0x88,
-	0xc4, 0x00, 0xb9, 0x85, 0x27, 0x30, 0xf4, 0x98, 0x10, 0x39, 0x45, 0x2b,
-	0x91, 0xb8, 0xc6, 0x42, 0x8d, 0x4a, 0x84, 0xa4, 0x1e, 0x0b, 0x21, 0xf5,
-	0x2c, 0x57, 0xb6, 0x70, 0x9a, 0xf2, 0x45, 0x52, 0x39, 0x6c, 0xd8, 0x54,
-	0xfa, 0xda, 0x77, 0xe5, 0x90, 0x9b, 0xb6, 0x4b, 0x65, 0x92, 0xbb, 0x65,
-	0xb2, 0xd7, 0x63, 0x91, 0x00, 0x80, 0x0a, 0x23, 0x19, 0x34, 0x07, 0x1c,
-	0x54, 0xf1, 0x69, 0x0a, 0xb0, 0x57, 0x14, 0xbe, 0x3d, 0x8b, 0xc7, 0xd9,
-	0xcc, 0x02, 0xe0, 0x2e, 0xcd, 0x79, 0xea, 0x2e, 0x10, 0x07, 0x77, 0x26,
-	0x9b, 0x30, 0x1f, 0xa0, 0x13, 0x0f, 0x01, 0x40, 0xe2, 0x44, 0x13, 0x5c,
-	0x92, 0xd7, 0x53, 0x01, 0x79, 0xe1, 0xf8, 0x2b, 0x11, 0xee, 0x19, 0x6f,
-	0xe5, 0x61, 0x3d, 0x26, 0xe4, 0xbf, 0xae, 0xdb, 0x99, 0xff, 0xff, 0xfb,
-	0x22, 0xc4, 0xe3, 0x80, 0x05, 0xe8, 0x41, 0x4f, 0xe3, 0x24, 0x61, 0xe0,
-	0xd0, 0x0c, 0xe6, 0x60, 0xf4, 0x8c, 0x38, 0xec, 0x50, 0x73, 0xd7, 0xff,
-	0x3f, 0x5d, 0xd7, 0xfe, 0xff, 0xfc, 0x56, 0x29, 0x5f, 0xfe, 0x20, 0x54,
-	0x56, 0x44, 0x87, 0x56, 0x77, 0x65, 0x67, 0x65, 0xd7, 0x6d, 0xad, 0xd6,
-	0x89, 0x40, 0x01, 0xb5, 0xf2, 0xf2, 0x54, 0x0c, 0x3f, 0x5d, 0x7a, 0xc9,
-	0x21, 0xa1, 0x58, 0x26, 0xb6, 0xd8, 0x72, 0x06, 0x84, 0x6f, 0xa9, 0xb9,
-	0x5c, 0xf7, 0x2a, 0xd3, 0x08, 0x56, 0x28, 0xb4, 0x53, 0x1f, 0xd7, 0x24,
-	0x1d, 0xb3, 0xf6, 0xb5, 0x6e, 0x38, 0x19, 0x42, 0xf6, 0x69, 0xb5, 0x61,
-	0x8f, 0xfe, 0xd8, 0x54, 0x16, 0x1a, 0x0a, 0x83, 0xc3, 0x0c, 0x30, 0x13,
-	0x05, 0x0e, 0x25, 0x89, 0x9f, 0x7a, 0xde, 0x27, 0x82, 0xa0, 0x03, 0xd5,
-	0xfe, 0x02, 0x6f, 0x49, 0x64, 0x92, 0xa0, 0x04, 0x0a, 0xff, 0xfb, 0x20,
-	0xc4, 0xe8, 0x80, 0x07, 0x48, 0x43, 0x33, 0x2c, 0x18, 0x45, 0x40, 0xdc,
-	0x85, 0xeb, 0x34, 0xc3, 0x19, 0x86, 0x0d, 0xc1, 0xa2, 0x14, 0x44, 0x67,
-	0x1e, 0xb2, 0xcd, 0x8d, 0x4b, 0x55, 0xdb, 0x14, 0x1a, 0xee, 0x75, 0x13,
-	0x55, 0x61, 0xa0, 0x95, 0x6a, 0xbe, 0x77, 0x3d, 0x8e, 0x88, 0xb3, 0x35,
-	0x96, 0xce, 0xe3, 0x54, 0x5c, 0xff, 0xc9, 0x9f, 0x68, 0xc6, 0x9c, 0xec,
-	0xf5, 0x55, 0xb6, 0x58, 0xe5, 0x91, 0xc6, 0x99, 0x45, 0x01, 0x42, 0x24,
-	0xc7, 0x5c, 0x5d, 0x03, 0x9b, 0x95, 0xbc, 0x86, 0x08, 0xc2, 0x98, 0xa2,
-	0xe9, 0x7b, 0xaa, 0x24, 0xdb, 0xcc, 0x7e, 0xb2, 0x1a, 0x66, 0x5f, 0x71,
-	0x96, 0x85, 0x85, 0xb2, 0xbd, 0x17, 0x9e, 0x56, 0x15, 0xd6, 0x3e, 0xe4,
-	0x3a, 0x2b, 0xd5, 0x6e, 0xb3, 0xad, 0x58, 0x0d, 0x6c, 0x6f, 0x52, 0x93,
-	0xfa, 0x05, 0x92, 0x40, 0xd4, 0x09, 0xeb, 0xff, 0xfb, 0x22, 0xc4, 0xe6,
-	0x00, 0x06, 0xc0, 0x43, 0x41, 0xa4, 0xa4, 0x67, 0x20, 0xdf, 0x88, 0x27,
-	0x30, 0xc3, 0x0c, 0xe0, 0x99, 0xbf, 0x5a, 0x81, 0xd9, 0x84, 0x01, 0x20,
-	0xe0, 0xa0, 0xc8, 0x72, 0x42, 0x0f, 0x26, 0x44, 0x50, 0x2d, 0x1c, 0xb3,
-	0x48, 0x99, 0x98, 0x49, 0x39, 0x84, 0xf2, 0xc8, 0xed, 0x12, 0x75, 0x4b,
-	0x71, 0xe9, 0xe4, 0xda, 0xf7, 0x8e, 0xed, 0xb7, 0xd2, 0xf2, 0x11, 0x93,
-	0x57, 0x7f, 0xff, 0x7a, 0xd0, 0x03, 0xc4, 0x84, 0x1d, 0x9c, 0xfd, 0x0e,
-	0x14, 0xd6, 0xce, 0x63, 0x8a, 0xcf, 0x94, 0xc1, 0x45, 0x05, 0x05, 0xe7,
-	0x46, 0x12, 0x2d, 0x2d, 0x06, 0xa0, 0x46, 0xd7, 0x0f, 0x33, 0xba, 0x10,
-	0x94, 0xfa, 0x5c, 0x3f, 0xc9, 0x58, 0xd5, 0x42, 0x97, 0xf0, 0xa1, 0xea,
-	0x67, 0xac, 0x71, 0x1e, 0xf4, 0xd0, 0xc6, 0x06, 0x22, 0x89, 0xac, 0x71,
-	0x1e, 0x49, 0x0e, 0x90, 0x89, 0x8a, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00,
-	0x06, 0xbc, 0x3f, 0x37, 0x34, 0xc1, 0x00, 0x01, 0x74, 0x9f, 0x6a, 0xb7,
-	0x18, 0x80, 0x02, 0x83, 0x40, 0xdb, 0xde, 0x18, 0x95, 0x31, 0x48, 0xc5,
-	0x2e, 0x8b, 0x12, 0x91, 0x73, 0x99, 0xa4, 0xbc, 0xc7, 0x72, 0xb0, 0x34,
-	0xe6, 0xaf, 0xcd, 0xf4, 0x24, 0xc9, 0xb8, 0x07, 0xb2, 0xa4, 0x7d, 0x34,
-	0x8d, 0xea, 0x01, 0x00, 0x01, 0xca, 0x43, 0x4c, 0x52, 0xdc, 0x44, 0xf4,
-	0x43, 0xe2, 0x61, 0x50, 0xc9, 0x10, 0xc9, 0x73, 0x9a, 0xa4, 0x1a, 0x43,
-	0x0d, 0x8a, 0x29, 0x45, 0x06, 0x56, 0x27, 0x0a, 0x4b, 0x48, 0xc8, 0x50,
-	0x56, 0xa2, 0x50, 0x35, 0x88, 0x6c, 0x1d, 0x55, 0x78, 0xc9, 0x06, 0x2f,
-	0xb5, 0xdb, 0x7f, 0xff, 0xf7, 0xda, 0x0e, 0x00, 0xd5, 0xb3, 0x27, 0x84,
-	0x2a, 0x62, 0xe7, 0xb9, 0x09, 0x90, 0xd1, 0x38, 0x7d, 0x00, 0x9e, 0x12,
-	0x26, 0x22, 0x9b, 0xa4, 0x13, 0xff, 0xfb, 0x20, 0xc4, 0xd3, 0x80, 0x0b,
-	0x30, 0x7d, 0x79, 0xf8, 0xc6, 0x00, 0x10, 0xbe, 0x8e, 0xa9, 0xa3, 0x92,
-	0x50, 0x00, 0x2f, 0x55, 0xb4, 0x49, 0x2a, 0xb6, 0xcd, 0x5b, 0x42, 0xa7,
-	0x3a, 0x2d, 0xb8, 0xf8, 0x5a, 0x18, 0x16, 0xba, 0xa7, 0x38, 0x44, 0x71,
-	0xf8, 0xcf, 0xb3, 0xd1, 0x4d, 0xc9, 0x24, 0x76, 0x55, 0xd0, 0x02, 0x20,
-	0x0c, 0x12, 0x15, 0x80, 0x2f, 0x9a, 0xe0, 0xa2, 0x05, 0x40, 0x92, 0x70,
-	0x39, 0x98, 0xf4, 0x9d, 0x08, 0x2b, 0xa0, 0x13, 0xb9, 0x7d, 0x89, 0x5d,
-	0xda, 0x5a, 0x05, 0xb8, 0xc3, 0x5a, 0xff, 0xfa, 0xfb, 0xb0, 0x07, 0x7a,
-	0xd7, 0x5f, 0x7b, 0x9d, 0xb0, 0x66, 0x51, 0x20, 0xc3, 0xb4, 0x32, 0x4c,
-	0x54, 0x3d, 0x33, 0x88, 0xea, 0x74, 0xc8, 0x2c, 0x10, 0xd4, 0x68, 0xa5,
-	0xf2, 0x2a, 0x3a, 0x3b, 0xd3, 0x27, 0x5a, 0xc1, 0x1e, 0x9f, 0xba, 0x4a,
-	0xa3, 0x90, 0x10, 0xff, 0xfb, 0x22, 0xc4, 0xc5, 0x00, 0x07, 0xfc, 0x79,
-	0x6f, 0xa4, 0xb0, 0x76, 0x30, 0xc3, 0x08, 0x6b, 0xb4, 0x93, 0x08, 0x78,
-	0x89, 0xc1, 0x76, 0xc5, 0x1f, 0xb7, 0x2c, 0xb2, 0x5a, 0x55, 0xfd, 0x3f,
-	0x89, 0x74, 0xaa, 0x7d, 0x40, 0x81, 0xd8, 0x2e, 0x6a, 0x7b, 0x0f, 0x86,
-	0x24, 0xb5, 0xa7, 0x01, 0xc9, 0xba, 0x0a, 0x93, 0x41, 0xd2, 0x30, 0xd3,
-	0x41, 0x1a, 0x5e, 0x58, 0xcd, 0x0c, 0xce, 0xe0, 0xef, 0x39, 0xdc, 0x43,
-	0x49, 0xb9, 0xed, 0x76, 0x3a, 0x87, 0x3d, 0x54, 0x90, 0x7c, 0xd7, 0x1a,
-	0xe5, 0xd2, 0x5b, 0x2c, 0x6d, 0xc4, 0x12, 0x00, 0x73, 0x2b, 0x09, 0x6e,
-	0x8a, 0xd5, 0x80, 0xab, 0x0f, 0x44, 0xa0, 0x85, 0x5a, 0x4e, 0xa7, 0xe2,
-	0x2b, 0x83, 0x8f, 0x15, 0x99, 0x74, 0x90, 0xc2, 0x85, 0x6d, 0x12, 0xda,
-	0x39, 0xa4, 0x6d, 0x55, 0xf7, 0x7f, 0xf7, 0xdf, 0xf5, 0xbe, 0xe7, 0xd5,
-	0x09, 0x08, 0xff, 0xfb, 0x20, 0xc4, 0xc3, 0x81, 0x06, 0x3c, 0x79, 0x44,
-	0xa7, 0x98, 0x6a, 0x80, 0xbc, 0x8d, 0x27, 0x40, 0xf4, 0x98, 0x98, 0x64,
-	0x98, 0x06, 0x80, 0x20, 0xa9, 0xcf, 0x7d, 0x2b, 0x4f, 0xeb, 0xaf, 0x65,
-	0x28, 0xe9, 0x93, 0xd0, 0x95, 0x9d, 0x04, 0xb5, 0x11, 0x2b, 0xf0, 0xa1,
-	0x52, 0x5b, 0x50, 0x28, 0xb4, 0x8d, 0xf2, 0x87, 0xff, 0x36, 0xfd, 0x34,
-	0x17, 0x7b, 0x74, 0x17, 0xfd, 0xd6, 0xd9, 0xfa, 0xd8, 0x55, 0x30, 0x90,
-	0x40, 0x8b, 0x0f, 0x4d, 0x06, 0x81, 0x15, 0x3d, 0xda, 0x6a, 0x51, 0x63,
-	0x83, 0x64, 0x42, 0x38, 0x7d, 0xc4, 0x66, 0xee, 0xfe, 0x66, 0xa5, 0x61,
-	0x5b, 0x85, 0x9a, 0x36, 0x27, 0x28, 0x2c, 0xc6, 0x27, 0x5d, 0xba, 0x40,
-	0x6f, 0x61, 0x07, 0xf7, 0x6c, 0xf7, 0x74, 0xaa, 0x16, 0xfb, 0xa1, 0x95,
-	0x50, 0x09, 0x98, 0x97, 0x77, 0x82, 0xf2, 0xcb, 0xab, 0xb0, 0x34, 0x8e,
-	0xff, 0xfb, 0x22, 0xc4, 0xc9, 0x82, 0xc6, 0x7c, 0x69, 0x38, 0xa7, 0xa4,
-	0x65, 0x40, 0xc4, 0x0d, 0x26, 0xc0, 0xf4, 0x98, 0xa0, 0x27, 0x95, 0xd5,
-	0xf5, 0xc4, 0x48, 0xa6, 0xbf, 0x12, 0xe4, 0xfa, 0x9e, 0x29, 0x6b, 0x0d,
-	0xc7, 0x29, 0x4f, 0x14, 0xb8, 0x5c, 0x96, 0x2c, 0xb9, 0x19, 0x94, 0x45,
-	0x59, 0x63, 0x6f, 0xff, 0xef, 0x28, 0x37, 0x14, 0x91, 0xfb, 0x37, 0x81,
-	0x64, 0x38, 0x58, 0x25, 0x8e, 0x9b, 0xb5, 0x4d, 0x19, 0x29, 0xc7, 0xa1,
-	0x6b, 0xaf, 0x00, 0x78, 0x2e, 0xca, 0x01, 0x4a, 0x4f, 0xd8, 0xf0, 0x5e,
-	0x3d, 0xd1, 0xa1, 0x91, 0x2b, 0x49, 0x05, 0x42, 0x6c, 0x24, 0xac, 0x55,
-	0xbe, 0x37, 0x11, 0x2d, 0x56, 0x27, 0x25, 0xd3, 0x4b, 0x13, 0xf8, 0xea,
-	0x06, 0x56, 0x02, 0x54, 0x39, 0x82, 0x0a, 0xe6, 0x40, 0xd5, 0x33, 0x82,
-	0xbe, 0x81, 0xc9, 0xc2, 0x88, 0x20, 0xfb, 0x40, 0x81, 0x1c, 0xfb, 0xff,
-	0xfb, 0x22, 0xc4, 0xce, 0x00, 0x06, 0x10, 0x31, 0x55, 0x84, 0x9c, 0xc2,
-	0x38, 0xc2, 0x8b, 0x67, 0x20, 0xf3, 0x0c, 0xe0, 0x67, 0xd6, 0x33, 0x6e,
-	0x4b, 0x13, 0xee, 0x4d, 0xdc, 0x84, 0x16, 0x3a, 0x03, 0x17, 0x28, 0x4c,
-	0x20, 0xcb, 0x4e, 0x60, 0xf1, 0x57, 0xbc, 0xd9, 0x83, 0xa7, 0xdc, 0xc7,
-	0x5b, 0xff, 0xf3, 0x40, 0xa9, 0x48, 0x00, 0x8e, 0xe1, 0x14, 0xe9, 0x97,
-	0x8b, 0x4d, 0x75, 0x80, 0x76, 0x48, 0xdd, 0x1a, 0x13, 0x96, 0x92, 0x81,
-	0xe3, 0x81, 0x26, 0xb1, 0x66, 0x3d, 0xaa, 0x8e, 0x79, 0xd9, 0x9d, 0xd1,
-	0xe6, 0x62, 0xb2, 0x50, 0x47, 0x86, 0x97, 0x76, 0x2c, 0xf2, 0xa9, 0x24,
-	0x77, 0xab, 0x9c, 0xb1, 0x5d, 0x1b, 0x04, 0x75, 0xa1, 0x14, 0xd5, 0x0a,
-	0x85, 0x13, 0x14, 0x24, 0x41, 0xf8, 0xc6, 0x7a, 0xa8, 0x80, 0xa4, 0x89,
-	0xcb, 0x63, 0x84, 0xc1, 0xf5, 0xaa, 0x38, 0xf3, 0x2d, 0x2e, 0xff, 0xfb,
-	0x20, 0xc4, 0xd4, 0x00, 0x05, 0x9c, 0x65, 0x36, 0xa7, 0x98, 0x65, 0x40,
-	0xc0, 0x06, 0xab, 0x34, 0xc3, 0x0c, 0xa6, 0x93, 0x7c, 0xcf, 0x60, 0xed,
-	0x10, 0xcf, 0x62, 0x64, 0x67, 0xbe, 0x40, 0x9c, 0x48, 0xa0, 0xb8, 0xf1,
-	0x61, 0xfc, 0xf9, 0x28, 0xab, 0x8f, 0xae, 0xfb, 0x45, 0x10, 0x7b, 0xd9,
-	0xbb, 0xb9, 0x1a, 0xc2, 0x76, 0x35, 0x53, 0x4d, 0x14, 0x9a, 0x80, 0x14,
-	0xc2, 0x93, 0x18, 0x42, 0x47, 0x81, 0x04, 0x48, 0x08, 0x38, 0xc1, 0x10,
-	0xa7, 0xa3, 0x3e, 0x42, 0x11, 0xe9, 0x01, 0x8f, 0x2a, 0x3e, 0xd5, 0x83,
-	0x0e, 0x6c, 0x30, 0x37, 0x5f, 0x51, 0x7b, 0x27, 0x83, 0x33, 0xe7, 0x36,
-	0x16, 0xdf, 0xfe, 0xeb, 0x88, 0xc6, 0x19, 0xb5, 0x05, 0x9a, 0x02, 0x04,
-	0x18, 0x10, 0xda, 0xde, 0xa7, 0x70, 0x4a, 0x42, 0x79, 0xe4, 0x28, 0x4c,
-	0x61, 0xc2, 0x27, 0xae, 0x4e, 0x34, 0x27, 0x2e, 0xff, 0xfb, 0x22, 0xc4,
-	0xdc, 0x00, 0x05, 0xf4, 0x63, 0x32, 0x07, 0xb0, 0x43, 0x88, 0xba, 0x08,
-	0x66, 0xe0, 0xf6, 0x18, 0x08, 0x8a, 0x94, 0xf3, 0x12, 0xd3, 0x55, 0x18,
-	0xf3, 0x87, 0x41, 0xa6, 0x18, 0x22, 0x15, 0x3a, 0xa0, 0xd8, 0x06, 0x6c,
-	0xe3, 0x14, 0x51, 0x00, 0xeb, 0x2d, 0xbe, 0xfe, 0x2e, 0xdf, 0xca, 0xa3,
-	0xe7, 0xce, 0x60, 0x09, 0xf0, 0xde, 0x57, 0xb2, 0x0e, 0x84, 0x2c, 0x4c,
-	0xe4, 0x25, 0xde, 0x99, 0x62, 0xea, 0x25, 0x18, 0x8c, 0x81, 0xd3, 0x40,
-	0xd5, 0xa6, 0xd4, 0x14, 0x17, 0x81, 0x9a, 0xb1, 0x65, 0xf2, 0xb1, 0xf6,
-	0xc7, 0x13, 0xaa, 0x9c, 0x8e, 0x14, 0x8f, 0x19, 0x48, 0x6c, 0x90, 0xbd,
-	0x86, 0x99, 0x4b, 0x1d, 0xde, 0xdf, 0x99, 0x37, 0x40, 0x22, 0xf0, 0x16,
-	0xc4, 0x08, 0xc1, 0xc6, 0x06, 0x68, 0x6e, 0x6d, 0x97, 0x28, 0x59, 0xe5,
-	0x8d, 0xfd, 0x3b, 0x4e, 0xad, 0xf3, 0x8f, 0xff, 0xfb, 0x22, 0xc4, 0xe3,
-	0x80, 0x06, 0x00, 0x45, 0x39, 0x27, 0xa4, 0x65, 0x40, 0xda, 0x08, 0x67,
-	0xb0, 0xc4, 0x8c, 0xe0, 0xe8, 0xb2, 0x0b, 0x27, 0xe7, 0xcd, 0x67, 0x6f,
-	0x5c, 0x5a, 0x98, 0x30, 0x5c, 0x3e, 0x29, 0xc8, 0x24, 0xe8, 0x9d, 0xe7,
-	0x85, 0x81, 0xfd, 0x46, 0x51, 0x7f, 0xbb, 0xfd, 0xbd, 0x60, 0xc8, 0xe4,
-	0x08, 0x03, 0x00, 0x32, 0x83, 0x1c, 0x42, 0x0e, 0xc4, 0xd5, 0x0c, 0x74,
-	0x81, 0x55, 0x12, 0x01, 0x26, 0x9a, 0x8e, 0x9a, 0xd5, 0x1f, 0x3c, 0xa6,
-	0x78, 0x50, 0x99, 0xb1, 0x48, 0x19, 0x84, 0x60, 0xa8, 0x69, 0x4f, 0x2c,
-	0x25, 0x31, 0xc9, 0x50, 0x1a, 0x5d, 0x16, 0xa7, 0xe2, 0x21, 0xf6, 0xa2,
-	0xbe, 0xa0, 0x77, 0x2c, 0x64, 0x6a, 0xd5, 0x09, 0x49, 0x1d, 0x50, 0xff,
-	0x7c, 0x00, 0xf6, 0x2e, 0x3b, 0x33, 0x0d, 0x30, 0x46, 0xa2, 0x24, 0x88,
-	0x09, 0xe9, 0x1a, 0x4d, 0x31, 0xac, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00,
-	0x06, 0xcc, 0x6b, 0x33, 0x07, 0x98, 0x45, 0x80, 0xdb, 0x0d, 0x66, 0x21,
-	0x83, 0x0c, 0xa0, 0x23, 0x61, 0xb1, 0x8f, 0x8c, 0x5e, 0xe1, 0x2d, 0xb0,
-	0xcc, 0x8f, 0x72, 0x65, 0xc8, 0x32, 0x86, 0x12, 0x01, 0x4e, 0x8f, 0x4f,
-	0x1e, 0xc3, 0xc2, 0xc0, 0xf6, 0x5c, 0xcf, 0x2b, 0x99, 0x70, 0x8d, 0x51,
-	0x08, 0x20, 0x40, 0x37, 0x00, 0x88, 0xcd, 0x89, 0x88, 0x8f, 0xa4, 0x50,
-	0xea, 0xb3, 0x15, 0x9b, 0x65, 0x5d, 0x6c, 0xe2, 0x8e, 0x60, 0x00, 0xb9,
-	0x15, 0x9f, 0x0f, 0xee, 0x8b, 0x8b, 0x8d, 0x17, 0x0f, 0x97, 0x97, 0x25,
-	0x43, 0xe9, 0x8a, 0x01, 0xc2, 0xd1, 0x75, 0x7d, 0x2b, 0xf7, 0x7a, 0x68,
-	0x1c, 0xc6, 0x8d, 0xd0, 0x08, 0x9b, 0x23, 0x5c, 0x3c, 0x84, 0x35, 0x54,
-	0x80, 0x32, 0x1d, 0xbd, 0x7a, 0x14, 0xa4, 0x26, 0x04, 0x8d, 0x51, 0xc7,
-	0x83, 0x05, 0x6d, 0x14, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xe8,
-	0x67, 0x33, 0x07, 0xa4, 0x63, 0x80, 0xd2, 0x06, 0xa7, 0xb4, 0xc4, 0x98,
-	0x48, 0x97, 0x9f, 0xae, 0x5c, 0x12, 0x2a, 0xf7, 0x9e, 0x2c, 0xf5, 0x14,
-	0x61, 0x61, 0x75, 0xb9, 0x02, 0xca, 0x08, 0x0e, 0x4c, 0x68, 0xd6, 0x2d,
-	0xaa, 0x66, 0x45, 0x55, 0xcf, 0x50, 0x8e, 0xc7, 0xb9, 0xcd, 0x8b, 0x0b,
-	0xd0, 0x79, 0x58, 0xba, 0x13, 0x93, 0xc7, 0x00, 0xa0, 0x98, 0xb9, 0xc5,
-	0xee, 0x2c, 0x30, 0xee, 0xb5, 0xa1, 0x46, 0xe0, 0x7d, 0x2e, 0x1c, 0x58,
-	0x81, 0x30, 0xaa, 0x16, 0x89, 0x17, 0x28, 0x4a, 0x66, 0x11, 0x01, 0xe8,
-	0xb3, 0x5d, 0x3e, 0xc2, 0x09, 0x32, 0xe5, 0xfa, 0x86, 0xbd, 0x4e, 0xa7,
-	0x5a, 0xb5, 0x44, 0xf4, 0x74, 0x55, 0x60, 0x34, 0x15, 0xae, 0x61, 0x28,
-	0x34, 0xd1, 0xe8, 0x85, 0x44, 0x65, 0x5a, 0x31, 0x17, 0x72, 0xfe, 0xfb,
-	0x0e, 0x49, 0x9b, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x80, 0x47, 0x08, 0x3f,
-	0x31, 0x0c, 0x24, 0xc3, 0x00, 0xd7, 0x0e, 0xa6, 0x14, 0xf4, 0x8c, 0xb0,
-	0x13, 0x7f, 0xa2, 0x73, 0xf8, 0x9e, 0x12, 0x19, 0x0e, 0x07, 0xd4, 0x66,
-	0x15, 0x99, 0x48, 0x24, 0x17, 0xcb, 0x66, 0x6f, 0x38, 0xdc, 0x6e, 0x36,
-	0xbf, 0x73, 0xb2, 0x37, 0x2c, 0xe4, 0x7d, 0x1b, 0x9e, 0xfc, 0xd9, 0xcf,
-	0x70, 0x81, 0x44, 0x38, 0x42, 0xe8, 0x1f, 0x27, 0x0b, 0x74, 0xb1, 0x94,
-	0x0c, 0xce, 0x17, 0xf1, 0xce, 0xe5, 0xc7, 0x28, 0x47, 0xd7, 0x91, 0x4c,
-	0xa1, 0x3a, 0x29, 0x54, 0xbd, 0x14, 0x21, 0xcb, 0x69, 0x24, 0x88, 0xc0,
-	0x34, 0x32, 0xa3, 0xc6, 0x61, 0xe0, 0x66, 0x46, 0x5e, 0x98, 0x79, 0x12,
-	0x60, 0x68, 0xba, 0x1f, 0x71, 0xd9, 0x69, 0x2a, 0xde, 0xf9, 0x06, 0x8a,
-	0x92, 0x28, 0xb8, 0x32, 0x5b, 0x94, 0xf3, 0x84, 0x80, 0x4b, 0x91, 0xa9,
-	0x50, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x06, 0xac, 0x63, 0x30, 0xac,
-	0x30, 0x63, 0x80, 0xe3, 0x86, 0xe6, 0x64, 0xf6, 0x18, 0x08, 0x89, 0xf7,
-	0x0e, 0x0e, 0xb9, 0xdd, 0x8a, 0x3d, 0xeb, 0xa8, 0x1a, 0xfa, 0x2b, 0xd6,
-	0x01, 0xfe, 0xb5, 0x81, 0x31, 0xa1, 0x2a, 0xfc, 0x0d, 0xcc, 0xb5, 0x93,
-	0x31, 0x0d, 0x8c, 0x22, 0x21, 0x21, 0xb8, 0x91, 0x37, 0xa7, 0x04, 0x68,
-	0x6d, 0x36, 0x50, 0xf2, 0xaa, 0xba, 0x2c, 0xd6, 0x4a, 0xbb, 0x6a, 0xad,
-	0x4b, 0x08, 0x2b, 0x90, 0x5f, 0x7a, 0x50, 0xdf, 0x5f, 0xd2, 0x95, 0xf3,
-	0xa3, 0xa7, 0x55, 0x74, 0x16, 0xb1, 0xad, 0xf5, 0x2a, 0x72, 0x90, 0xc4,
-	0x06, 0x1a, 0x47, 0x33, 0x39, 0xba, 0x0f, 0xe4, 0xb0, 0xa6, 0x0a, 0x0c,
-	0x30, 0xe0, 0x2d, 0xc8, 0x9f, 0x50, 0x32, 0xaa, 0x24, 0x2c, 0x6a, 0x69,
-	0x81, 0x42, 0x38, 0x02, 0xa5, 0x48, 0xfb, 0x58, 0x49, 0x9a, 0xb8, 0x88,
-	0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xb4, 0x65, 0x3d, 0x86, 0x24,
-	0x63, 0x80, 0xd9, 0x08, 0x66, 0x64, 0xf4, 0x8c, 0x38, 0x26, 0xbd, 0x0c,
-	0xdb, 0x15, 0x00, 0x96, 0x86, 0x86, 0xa3, 0x55, 0xda, 0xd7, 0x75, 0xfa,
-	0xbd, 0x63, 0x95, 0x08, 0x00, 0x40, 0x6c, 0x9e, 0x26, 0xaa, 0x71, 0x08,
-	0x42, 0x1d, 0xa9, 0x92, 0xc6, 0xe9, 0x15, 0xd8, 0x0e, 0x81, 0x93, 0xc7,
-	0x43, 0xab, 0x87, 0xeb, 0xaa, 0x77, 0xb2, 0x46, 0x43, 0x07, 0x5a, 0x3a,
-	0x93, 0xe5, 0x62, 0x73, 0xe3, 0xde, 0xf9, 0x2c, 0x24, 0x30, 0xc3, 0x51,
-	0xd4, 0xa0, 0x98, 0x4e, 0x97, 0x35, 0xdc, 0x52, 0xfa, 0x43, 0x60, 0x5a,
-	0x1b, 0x77, 0xde, 0xc4, 0x81, 0xd3, 0x10, 0x30, 0x26, 0x0c, 0x13, 0xe0,
-	0xc8, 0x0e, 0xa4, 0xe2, 0x48, 0x4b, 0x28, 0xbc, 0x40, 0xb8, 0xf4, 0x2c,
-	0x17, 0x10, 0x8a, 0xd8, 0x65, 0xb5, 0x9a, 0xe1, 0x28, 0xe4, 0xc1, 0xff,
-	0xfb, 0x20, 0xc4, 0xe7, 0x80, 0x07, 0x44, 0x41, 0x33, 0x07, 0xa4, 0xc3,
-	0x00, 0xd8, 0x0c, 0x66, 0xc1, 0x26, 0x0c, 0x38, 0x06, 0x5c, 0x91, 0x8b,
-	0x24, 0x72, 0x42, 0xc8, 0x0d, 0x80, 0x33, 0x0d, 0x32, 0xf4, 0x2a, 0xeb,
-	0xc3, 0x61, 0xb0, 0x82, 0x2c, 0xcd, 0xf3, 0x2d, 0xbd, 0x56, 0x74, 0xbd,
-	0xed, 0x4a, 0x29, 0xc9, 0x24, 0x4d, 0x57, 0x2a, 0x82, 0x60, 0x68, 0x2e,
-	0x28, 0x0f, 0x8a, 0x40, 0x8e, 0x26, 0x23, 0x07, 0x58, 0x03, 0x68, 0x4c,
-	0xb3, 0xc3, 0x23, 0xc4, 0xc7, 0x7e, 0xca, 0x74, 0x4b, 0xd6, 0x5c, 0xc7,
-	0x99, 0x7a, 0x9b, 0x19, 0xb3, 0x08, 0x67, 0xa9, 0x46, 0xbb, 0x78, 0x10,
-	0xe7, 0xce, 0xb1, 0x94, 0x6c, 0x65, 0x32, 0x4c, 0x9a, 0x23, 0xbd, 0x4b,
-	0x3c, 0x00, 0x63, 0x64, 0x22, 0xa8, 0x08, 0x70, 0x38, 0x09, 0xe2, 0xcb,
-	0x21, 0x58, 0xb2, 0x16, 0x12, 0x59, 0xe9, 0x1c, 0x34, 0xff, 0xfb, 0x22,
-	0xc4, 0xe5, 0x80, 0x8b, 0x25, 0x0f, 0x40, 0x07, 0xb0, 0x6d, 0xc8, 0xe5,
-	0x8a, 0xe9, 0x24, 0x96, 0x18, 0x70, 0x9a, 0xbc, 0x8e, 0x30, 0x48, 0x7b,
-	0xbb, 0xac, 0xd3, 0xa6, 0x75, 0xc1, 0xb8, 0xd8, 0x86, 0xa2, 0x5b, 0x46,
-	0xd8, 0x2f, 0xe2, 0x24, 0x57, 0x75, 0x6e, 0xfc, 0xaa, 0x5f, 0xb2, 0x13,
-	0xb7, 0x31, 0x41, 0x60, 0x05, 0xe0, 0x0e, 0x01, 0x88, 0x43, 0x4b, 0x03,
-	0x68, 0xa8, 0x08, 0xc4, 0xd3, 0x82, 0x01, 0x56, 0x6a, 0x9c, 0x9b, 0x1d,
-	0x60, 0x43, 0xc0, 0x05, 0x3b, 0x81, 0x4f, 0xc7, 0x0d, 0x43, 0x61, 0x67,
-	0x7d, 0x87, 0x9a, 0x2b, 0xda, 0xc3, 0x35, 0x5d, 0x66, 0x8f, 0xfa, 0x80,
-	0x09, 0x23, 0x00, 0x12, 0x02, 0x40, 0xbc, 0x15, 0xc5, 0xf0, 0xec, 0x25,
-	0xd7, 0xab, 0x10, 0x91, 0x90, 0x44, 0xf0, 0x84, 0x44, 0x9d, 0x45, 0xdc,
-	0x76, 0xfb, 0xf6, 0xe1, 0x23, 0xed, 0x20, 0x61, 0xff, 0xfb, 0x20, 0xc4,
-	0xd3, 0x00, 0x06, 0xf0, 0xbd, 0x41, 0x27, 0xa4, 0x45, 0x40, 0xdb, 0x0b,
-	0xe6, 0xd4, 0xf4, 0x8c, 0xb0, 0x49, 0x63, 0x8c, 0xa4, 0xe3, 0xdb, 0xf6,
-	0xb1, 0x00, 0x50, 0x17, 0xea, 0x72, 0xff, 0xfe, 0x99, 0xa5, 0xae, 0x1d,
-	0x00, 0x41, 0x77, 0x03, 0x85, 0x8b, 0xf9, 0x7e, 0x9a, 0x3b, 0xec, 0xad,
-	0xc6, 0xda, 0x18, 0xc2, 0x84, 0xe1, 0xcc, 0xb4, 0xad, 0x5f, 0xfb, 0xce,
-	0x72, 0x9d, 0xbf, 0x94, 0x62, 0x10, 0x87, 0xec, 0xd8, 0x99, 0x6a, 0x47,
-	0xa8, 0x98, 0x68, 0x72, 0x02, 0xa6, 0xad, 0xdd, 0x6b, 0x19, 0xf5, 0x78,
-	0xd0, 0xcc, 0xb2, 0x52, 0x8c, 0x24, 0x90, 0x00, 0x05, 0x41, 0x14, 0xc7,
-	0x8d, 0xa2, 0xd5, 0xd3, 0x3a, 0x76, 0xc9, 0x04, 0x10, 0x07, 0xf5, 0x06,
-	0x63, 0x9e, 0xd2, 0x1f, 0x50, 0xd3, 0x83, 0x85, 0xeb, 0x54, 0xd8, 0x20,
-	0x7e, 0xb5, 0x17, 0xeb, 0x50, 0x14, 0xff, 0xfb, 0x22, 0xc4, 0xd2, 0x00,
-	0x87, 0xa4, 0x65, 0x32, 0xa7, 0xb0, 0xc7, 0x00, 0xf2, 0x0c, 0xa6, 0xa4,
-	0xf4, 0x8c, 0xb0, 0xc4, 0xf2, 0xc9, 0x53, 0xfd, 0x8a, 0x0c, 0xb6, 0x93,
-	0x10, 0x50, 0xad, 0x02, 0x60, 0x8c, 0x64, 0xa4, 0xcd, 0x50, 0x55, 0xaf,
-	0x4f, 0x26, 0x8a, 0xbb, 0x66, 0x57, 0x04, 0x6d, 0x06, 0x0a, 0x11, 0x20,
-	0x74, 0x2c, 0xa5, 0x46, 0xb5, 0x77, 0xe7, 0x53, 0xa8, 0xaa, 0x52, 0x31,
-	0xe2, 0x3f, 0xd9, 0xf8, 0xb7, 0xf4, 0x2e, 0xc4, 0x31, 0x1e, 0xd0, 0x3c,
-	0x59, 0xde, 0xce, 0x64, 0x4d, 0x21, 0x35, 0xef, 0x51, 0x9e, 0xa4, 0xc8,
-	0xd2, 0xd2, 0x27, 0x74, 0x3b, 0x2f, 0xfe, 0x9a, 0xce, 0xca, 0x14, 0x88,
-	0x68, 0xc3, 0x11, 0x70, 0xa2, 0x0f, 0x20, 0xa9, 0xc2, 0x52, 0x0f, 0xd8,
-	0xdd, 0x7d, 0x35, 0x3d, 0x48, 0xc3, 0x58, 0xb0, 0x82, 0x28, 0x42, 0xc8,
-	0x54, 0x56, 0x42, 0xe0, 0x12, 0xff, 0xfb, 0x22, 0xc4, 0xcc, 0x00, 0x07,
-	0x40, 0x6b, 0x4d, 0x84, 0x88, 0x6e, 0x70, 0xc7, 0x0c, 0x26, 0x95, 0x84,
-	0x88, 0x38, 0x15, 0x5b, 0x07, 0xdb, 0x46, 0x3e, 0xec, 0xe3, 0x9a, 0x6b,
-	0xcc, 0xbc, 0xcb, 0x0a, 0x18, 0x83, 0xe2, 0x41, 0xa3, 0xc7, 0x30, 0x7f,
-	0x38, 0x7e, 0x18, 0x16, 0x67, 0x4d, 0x1d, 0x64, 0x15, 0xea, 0x51, 0xc0,
-	0x2a, 0x91, 0x20, 0x48, 0x82, 0xd4, 0x1a, 0x15, 0xc3, 0x75, 0x24, 0x6d,
-	0x31, 0x63, 0x65, 0x96, 0xed, 0x25, 0x1a, 0x8c, 0x9e, 0x70, 0x4a, 0x00,
-	0x00, 0x18, 0x03, 0xdc, 0x92, 0xaa, 0xa0, 0x26, 0xe0, 0x5a, 0x12, 0x4d,
-	0x31, 0x8c, 0x44, 0x28, 0xe9, 0x88, 0xf4, 0xa1, 0x9a, 0x99, 0xff, 0x53,
-	0xd5, 0x12, 0x00, 0x01, 0x3c, 0x26, 0x23, 0xd4, 0xcc, 0x77, 0x59, 0x39,
-	0xfd, 0xb2, 0x22, 0xa4, 0xde, 0xec, 0x84, 0x4c, 0xca, 0x57, 0xc5, 0x10,
-	0xb2, 0x67, 0x4a, 0xd4, 0xff, 0xfb, 0x20, 0xc4, 0xcd, 0x00, 0x06, 0x08,
-	0x31, 0x39, 0x25, 0xa4, 0xc0, 0x80, 0xca, 0x08, 0xe6, 0xf0, 0xf6, 0x18,
-	0x08, 0x88, 0xff, 0x43, 0xcc, 0xb1, 0x45, 0x0c, 0x90, 0xcd, 0xcb, 0x31,
-	0xa7, 0xaa, 0x53, 0x72, 0xe2, 0xf4, 0x30, 0x3a, 0x35, 0x68, 0x15, 0xa5,
-	0xa7, 0xad, 0x20, 0x8d, 0xb9, 0x76, 0x35, 0x4c, 0x4c, 0xa1, 0xc0, 0x2a,
-	0x50, 0x95, 0xa1, 0xe5, 0x79, 0x9c, 0x28, 0x0a, 0x50, 0x31, 0x58, 0xf6,
-	0x4c, 0xf3, 0xcf, 0x36, 0x82, 0x56, 0x64, 0x3a, 0x31, 0xff, 0x9d, 0xc8,
-	0xbf, 0xee, 0x2c, 0xda, 0x49, 0x13, 0xef, 0xed, 0x4b, 0xa6, 0x73, 0x29,
-	0xd0, 0xe7, 0x8d, 0xc4, 0xee, 0x4c, 0x5f, 0xa7, 0x0c, 0xf6, 0xbb, 0xd0,
-	0x05, 0x68, 0x10, 0x44, 0x18, 0x46, 0xf9, 0xcc, 0x59, 0x0d, 0xb5, 0x62,
-	0xe6, 0x01, 0x88, 0x82, 0x0e, 0x0a, 0x3f, 0xfe, 0x48, 0x19, 0x6c, 0xf5,
-	0x14, 0xd3, 0xff, 0xfb, 0x22, 0xc4, 0xd2, 0x00, 0x06, 0x30, 0x7b, 0x32,
-	0xa7, 0x98, 0x65, 0x40, 0xbe, 0x08, 0x27, 0xf4, 0x93, 0x15, 0x54, 0x4d,
-	0x67, 0x34, 0xf7, 0x56, 0xd1, 0xf3, 0x19, 0xd6, 0xe5, 0x3d, 0x48, 0xe6,
-	0xe9, 0x67, 0x6b, 0xf3, 0x0e, 0x23, 0x33, 0x50, 0xa1, 0xad, 0x3b, 0xa9,
-	0xf1, 0x8d, 0x49, 0xa1, 0xa8, 0x15, 0x01, 0xa2, 0x11, 0x50, 0x20, 0x03,
-	0x1c, 0x37, 0x94, 0xe5, 0x02, 0xd3, 0x81, 0x3d, 0x93, 0xe4, 0x59, 0x84,
-	0xeb, 0x39, 0xc4, 0x0f, 0x83, 0xca, 0xd9, 0x84, 0x36, 0x7b, 0x3a, 0x4e,
-	0x67, 0xf3, 0x4b, 0x38, 0x1c, 0x21, 0x88, 0x16, 0x1c, 0xe0, 0xad, 0xda,
-	0x08, 0xd4, 0x50, 0x4b, 0x86, 0x5d, 0xb4, 0xf6, 0x66, 0xfd, 0xf2, 0xda,
-	0x19, 0xa5, 0x15, 0x3f, 0x40, 0x40, 0x19, 0x09, 0x62, 0x34, 0x90, 0x25,
-	0x5c, 0x8e, 0xd2, 0x02, 0x4b, 0xa6, 0x65, 0x43, 0x2c, 0xa1, 0x03, 0x10,
-	0x88, 0xff, 0xfb, 0x20, 0xc4, 0xd8, 0x80, 0x05, 0xa4, 0x35, 0x39, 0x86,
-	0x18, 0x64, 0xc0, 0xb1, 0x0c, 0xa6, 0x40, 0xf4, 0x8c, 0x70, 0xc3, 0x58,
-	0x82, 0xe6, 0x0e, 0xcd, 0x5f, 0x32, 0x32, 0x17, 0x22, 0x15, 0x5a, 0x7e,
-	0xef, 0x75, 0x7d, 0xfd, 0x25, 0xb4, 0x61, 0x64, 0x05, 0xd6, 0x4a, 0x3b,
-	0x51, 0x03, 0x3d, 0xba, 0xd0, 0xae, 0xb0, 0x8d, 0x6a, 0x46, 0xc3, 0xb3,
-	0x50, 0x00, 0x31, 0x64, 0xb8, 0x2c, 0x24, 0x58, 0x62, 0xd3, 0x75, 0x7f,
-	0x4a, 0xc2, 0x13, 0xf2, 0xba, 0xe0, 0xc7, 0xc8, 0x78, 0x48, 0x23, 0x50,
-	0x94, 0x3c, 0xf6, 0xb9, 0x67, 0xc8, 0xcf, 0x0a, 0x0e, 0x78, 0x35, 0x0a,
-	0x15, 0x17, 0x42, 0x31, 0x12, 0x19, 0xf5, 0x98, 0xb1, 0xfe, 0x9b, 0xff,
-	0x92, 0xda, 0x6c, 0xc6, 0x7b, 0x2d, 0x4e, 0x87, 0x55, 0xa2, 0xd1, 0x68,
-	0x43, 0x00, 0x00, 0xc4, 0x49, 0x08, 0x48, 0x46, 0xc5, 0x4a, 0xec, 0xff,
-	0xfb, 0x22, 0xc4, 0xe2, 0x00, 0x05, 0xf0, 0x3f, 0x34, 0xa7, 0xa4, 0xc0,
-	0x40, 0xc3, 0x05, 0xa6, 0x60, 0xf6, 0x18, 0x08, 0x43, 0xea, 0x93, 0xd9,
-	0x93, 0x37, 0xcf, 0xee, 0xcb, 0x1e, 0x80, 0xa6, 0x1a, 0x9b, 0xac, 0xdc,
-	0xf0, 0x73, 0x04, 0xf0, 0xb1, 0x9c, 0xe3, 0x31, 0xbb, 0x9b, 0xa0, 0x25,
-	0x84, 0xa6, 0x6e, 0xf4, 0x1b, 0x18, 0x72, 0xd2, 0x50, 0x79, 0x92, 0x06,
-	0xc9, 0x22, 0xa4, 0x6e, 0xb5, 0x59, 0x04, 0x10, 0x97, 0x19, 0xf4, 0xf6,
-	0xd3, 0xab, 0x37, 0x41, 0x8d, 0x10, 0x42, 0xea, 0xaf, 0xa5, 0xeb, 0x6b,
-	0xad, 0x3e, 0x68, 0x74, 0xde, 0xb5, 0x7f, 0xff, 0xd0, 0x30, 0x34, 0x79,
-	0x66, 0x66, 0x67, 0x65, 0x48, 0xe5, 0x91, 0x80, 0x1e, 0x40, 0x1b, 0xc6,
-	0x4c, 0xee, 0xa2, 0x33, 0x45, 0x99, 0x16, 0xcb, 0x01, 0x8e, 0x0c, 0xaf,
-	0x80, 0x21, 0xd1, 0x60, 0x6c, 0xf4, 0xf0, 0x13, 0xc8, 0xde, 0xff, 0xfb,
-	0x22, 0xc4, 0xe8, 0x80, 0xc7, 0x74, 0x97, 0x2e, 0xa6, 0x24, 0x65, 0x40,
-	0xc9, 0x13, 0xa6, 0x00, 0xf3, 0x0c, 0xa8, 0xdc, 0xf1, 0x63, 0xef, 0x45,
-	0x4b, 0x6b, 0x53, 0xb6, 0xa7, 0x62, 0xd7, 0x2b, 0xb5, 0x2a, 0xb2, 0x05,
-	0x40, 0x08, 0x28, 0x19, 0x8a, 0xd7, 0xe8, 0x87, 0xea, 0x14, 0xc5, 0x20,
-	0x54, 0x49, 0x04, 0x6a, 0x17, 0x25, 0x11, 0xb9, 0xae, 0xa2, 0xaf, 0x05,
-	0x3d, 0x1b, 0x20, 0xe8, 0x95, 0x6a, 0x8e, 0x24, 0xb6, 0x12, 0x0d, 0x26,
-	0x83, 0x61, 0xd5, 0x7a, 0xa8, 0xe5, 0x5d, 0xff, 0xbf, 0xaf, 0x53, 0xd7,
-	0xa8, 0x40, 0x00, 0x0e, 0x81, 0x5e, 0x7a, 0x34, 0xec, 0xae, 0x6e, 0x76,
-	0x72, 0xad, 0x2a, 0x96, 0xd1, 0x32, 0xc1, 0x12, 0xec, 0x4d, 0x34, 0x69,
-	0x46, 0x9a, 0xe3, 0x51, 0xd8, 0x84, 0x56, 0xe5, 0x7c, 0x04, 0x11, 0x1a,
-	0x02, 0x53, 0x4e, 0xbe, 0xc4, 0x5f, 0xcc, 0x98, 0x04, 0xff, 0xfb, 0x20,
-	0xc4, 0xe8, 0x80, 0x07, 0x20, 0x97, 0x31, 0x07, 0x98, 0x45, 0x40, 0xe1,
-	0x8d, 0x66, 0xa4, 0xf3, 0x0c, 0xb0, 0x59, 0xf4, 0x75, 0x7f, 0xe8, 0xe8,
-	0x51, 0x92, 0xe3, 0xb5, 0x1c, 0x0e, 0xc3, 0x29, 0x99, 0x3c, 0x41, 0xb6,
-	0x58, 0xbb, 0x43, 0x0a, 0xaa, 0xe6, 0x13, 0x65, 0x46, 0x60, 0x09, 0x45,
-	0x02, 0x3a, 0x10, 0x19, 0x29, 0x2f, 0x95, 0x63, 0x06, 0x51, 0xab, 0x3e,
-	0x36, 0x25, 0xfd, 0x65, 0x5a, 0x82, 0x25, 0x97, 0x1e, 0xb7, 0x92, 0x8a,
-	0x7d, 0xdf, 0xea, 0x09, 0x01, 0x00, 0x04, 0x64, 0x1e, 0x11, 0xe2, 0x89,
-	0xa7, 0xcd, 0xb8, 0xd9, 0x89, 0x8d, 0x16, 0xb2, 0xe0, 0x9d, 0x74, 0x90,
-	0xf4, 0x56, 0xf4, 0x78, 0x90, 0xca, 0x15, 0x41, 0xa4, 0xbb, 0xa4, 0xd5,
-	0x13, 0x0a, 0xd8, 0x28, 0xf9, 0x73, 0xb5, 0x28, 0x6f, 0x79, 0x0e, 0xbf,
-	0x97, 0x3a, 0x87, 0x69, 0x6a, 0x50, 0xa5, 0xff, 0xfb, 0x22, 0xc4, 0xe6,
-	0x00, 0x06, 0xd0, 0x9b, 0x30, 0xa7, 0x98, 0x45, 0xc0, 0xda, 0x05, 0x67,
-	0x32, 0x98, 0x60, 0x00, 0xbb, 0xd4, 0xba, 0x12, 0x47, 0x14, 0x44, 0xca,
-	0x87, 0xa1, 0x37, 0x81, 0x0b, 0x0a, 0x08, 0x26, 0xb3, 0x40, 0xeb, 0x03,
-	0x68, 0x90, 0x1d, 0xd7, 0xc5, 0x79, 0x19, 0x03, 0x83, 0x8a, 0x32, 0x69,
-	0xd0, 0x08, 0x08, 0x38, 0x4a, 0x41, 0x0e, 0x72, 0x92, 0xef, 0xb0, 0xfa,
-	0x77, 0xf5, 0x72, 0x6a, 0xd8, 0x22, 0xf8, 0x18, 0x9a, 0xb5, 0x0c, 0x80,
-	0x00, 0xb1, 0xf1, 0x02, 0x01, 0xed, 0x51, 0xeb, 0x41, 0x68, 0x84, 0x8e,
-	0x49, 0xc2, 0x49, 0x86, 0x74, 0xa2, 0x16, 0x6d, 0x32, 0x60, 0x49, 0xae,
-	0x6d, 0xfc, 0x65, 0xb8, 0x33, 0xa5, 0xcf, 0x06, 0x07, 0xda, 0xba, 0xd6,
-	0xa6, 0x28, 0x54, 0x63, 0x94, 0x87, 0x36, 0x95, 0xa2, 0xa6, 0xff, 0xe3,
-	0x75, 0xae, 0x09, 0x48, 0x94, 0x4c, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80,
-	0x0c, 0x21, 0x19, 0x67, 0xb8, 0xc6, 0x80, 0x10, 0xc5, 0x84, 0x6f, 0xbf,
-	0x9e, 0x20, 0x06, 0xe5, 0x36, 0x00, 0x60, 0xc1, 0x50, 0xa1, 0x40, 0x6e,
-	0x23, 0x72, 0x64, 0xd6, 0x09, 0x54, 0x7a, 0x84, 0xf4, 0xb1, 0xf4, 0x28,
-	0x47, 0xb6, 0xa2, 0x41, 0x87, 0x08, 0xbd, 0xa2, 0xf5, 0x0e, 0x28, 0x78,
-	0xc2, 0x97, 0x55, 0x6c, 0xda, 0xc0, 0xf3, 0xa1, 0xb3, 0xbf, 0x96, 0xb3,
-	0xf8, 0x84, 0xf0, 0x00, 0x00, 0xfa, 0x30, 0xcf, 0x85, 0x44, 0xe7, 0x4c,
-	0xeb, 0x58, 0x0e, 0x1a, 0x2d, 0xfa, 0x4f, 0x5c, 0x00, 0x22, 0xd3, 0x96,
-	0xd8, 0xf8, 0x9e, 0xd1, 0xa5, 0x45, 0x1e, 0x4c, 0x00, 0x4e, 0x90, 0xc0,
-	0x99, 0x77, 0x5a, 0xe7, 0xdc, 0xc8, 0x30, 0x4f, 0x4e, 0x82, 0x8d, 0xbd,
-	0x5f, 0xf5, 0xf4, 0x55, 0x1d, 0x10, 0x00, 0x0f, 0x65, 0x7c, 0xa4, 0xf9,
-	0x3a, 0xca, 0x44, 0x92, 0x65, 0xff, 0xfb, 0x20, 0xc4, 0xd4, 0x00, 0x06,
-	0x58, 0x3b, 0x49, 0x27, 0xa4, 0xc4, 0xc0, 0xc9, 0x0a, 0x27, 0x54, 0xf3,
-	0x0d, 0x98, 0x02, 0xfe, 0x0a, 0x8a, 0x38, 0xe5, 0x69, 0x50, 0x58, 0xb0,
-	0x34, 0xb0, 0x50, 0x19, 0x40, 0x59, 0x47, 0x9e, 0x35, 0x61, 0xa0, 0x75,
-	0x03, 0x88, 0x27, 0x50, 0xfb, 0x56, 0x60, 0xdd, 0xfd, 0xe4, 0xbb, 0x5f,
-	0x42, 0x40, 0xa9, 0xd4, 0xc6, 0x07, 0x00, 0x4a, 0x38, 0x54, 0x4c, 0x8a,
-	0xfb, 0x16, 0x60, 0xe0, 0x52, 0x09, 0x0e, 0x36, 0xc9, 0x11, 0x64, 0xa6,
-	0x4b, 0x06, 0xc0, 0x2f, 0x04, 0x9c, 0xf9, 0xe2, 0x43, 0xa2, 0xa1, 0x27,
-	0xa1, 0x77, 0xd0, 0xcd, 0x09, 0x30, 0xe8, 0xce, 0xae, 0xab, 0xd5, 0x45,
-	0x2a, 0x19, 0x10, 0x00, 0x25, 0x48, 0xf2, 0xe7, 0xc5, 0x16, 0xee, 0x4f,
-	0x5e, 0x28, 0x72, 0x66, 0x90, 0x12, 0x5c, 0xd6, 0xe2, 0x06, 0x19, 0xd8,
-	0x86, 0x95, 0x92, 0xff, 0xfb, 0x22, 0xc4, 0xd8, 0x00, 0x06, 0x60, 0x57,
-	0x36, 0x07, 0xa4, 0x68, 0xc0, 0xda, 0x0a, 0xa7, 0x25, 0x86, 0x08, 0x38,
-	0x0b, 0x60, 0x67, 0x1b, 0xf6, 0x67, 0x39, 0xe0, 0xdf, 0x45, 0xcb, 0x97,
-	0x49, 0xff, 0xf3, 0xf8, 0xf9, 0xc0, 0x41, 0xb9, 0x90, 0xe6, 0x40, 0x0d,
-	0x84, 0x02, 0xc0, 0xff, 0x97, 0x57, 0xeb, 0x1c, 0x38, 0x51, 0x73, 0xbb,
-	0xae, 0xeb, 0x79, 0x3f, 0xb2, 0x59, 0xc9, 0x2a, 0x14, 0xac, 0xf4, 0x44,
-	0x16, 0x49, 0x36, 0x08, 0xa3, 0x07, 0x58, 0x11, 0x04, 0xad, 0x3b, 0x26,
-	0xdf, 0xde, 0x2d, 0x91, 0xd4, 0xd8, 0x15, 0x70, 0x45, 0x10, 0x58, 0x02,
-	0xb9, 0x81, 0x93, 0x0d, 0x63, 0x49, 0x92, 0xd5, 0xa6, 0xa5, 0x66, 0xad,
-	0x5a, 0xea, 0x02, 0x56, 0x20, 0x40, 0x84, 0x00, 0xf1, 0x14, 0x7e, 0x87,
-	0x2a, 0x87, 0xda, 0xe8, 0x80, 0xca, 0x0e, 0x30, 0x71, 0xea, 0x3c, 0x58,
-	0x8b, 0x23, 0xff, 0xfb, 0x20, 0xc4, 0xda, 0x00, 0x46, 0x64, 0x2b, 0x3f,
-	0x67, 0x95, 0x20, 0x20, 0xce, 0x8b, 0x26, 0x94, 0xc3, 0x0c, 0xe0, 0x49,
-	0x68, 0xc1, 0x82, 0xf5, 0x0b, 0x86, 0xd6, 0x3c, 0xb2, 0x90, 0x58, 0xeb,
-	0x0c, 0x80, 0x4f, 0x58, 0x33, 0x9b, 0x6c, 0x54, 0x1d, 0xe2, 0x9d, 0xe5,
-	0x7d, 0xbb, 0x9d, 0xb6, 0x94, 0xdd, 0xb6, 0xe7, 0x64, 0x6d, 0xa4, 0x90,
-	0x01, 0xf1, 0x2d, 0x07, 0xc2, 0x22, 0xf6, 0xd3, 0x5d, 0x90, 0x06, 0x0c,
-	0x64, 0xc6, 0x17, 0x5f, 0x75, 0x93, 0x87, 0xc2, 0xa7, 0x07, 0x05, 0xc0,
-	0xac, 0x61, 0x31, 0x4c, 0x0f, 0x97, 0x51, 0x8b, 0xe2, 0xcc, 0x49, 0xac,
-	0x9b, 0x2d, 0x7b, 0x9f, 0xad, 0xfc, 0x9a, 0x74, 0x1a, 0x6b, 0xd8, 0xba,
-	0xc9, 0xd5, 0x5e, 0x12, 0x20, 0x70, 0x0a, 0xd3, 0x69, 0x9d, 0x0a, 0x43,
-	0x63, 0x74, 0xc4, 0x82, 0x49, 0x14, 0x08, 0xe4, 0xe9, 0xb1, 0x86, 0xcf,
-	0xff, 0xfb, 0x22, 0xc4, 0xdd, 0x00, 0x06, 0x58, 0x3d, 0x3d, 0x84, 0xa4,
-	0x41, 0xc0, 0xc5, 0x88, 0x26, 0x54, 0xf6, 0x18, 0x28, 0xe6, 0xbd, 0x7d,
-	0x70, 0xdb, 0x5e, 0xb0, 0xef, 0x67, 0x94, 0x46, 0x0c, 0x64, 0xb3, 0xbb,
-	0x43, 0x39, 0xff, 0xe4, 0x6d, 0xa5, 0xc4, 0x80, 0xcd, 0x55, 0x7c, 0x5f,
-	0xbb, 0xab, 0xfe, 0xa4, 0xda, 0x0d, 0xfe, 0xe2, 0xb2, 0xf0, 0x04, 0xc7,
-	0x11, 0x90, 0x8a, 0xab, 0xe9, 0x97, 0x21, 0x78, 0x02, 0x22, 0x3a, 0xe3,
-	0xa2, 0x1f, 0x29, 0x89, 0x3b, 0x25, 0x55, 0x35, 0xbf, 0xf7, 0xba, 0xa4,
-	0x67, 0x75, 0x62, 0x86, 0xb4, 0x9d, 0x41, 0x87, 0xc0, 0x47, 0xcd, 0x97,
-	0x56, 0xc3, 0x25, 0x72, 0x82, 0x66, 0xdd, 0xc8, 0x25, 0x0d, 0x7e, 0xb5,
-	0x01, 0xa5, 0x90, 0x04, 0x1e, 0xe3, 0x36, 0xa3, 0xe9, 0x30, 0xed, 0x4c,
-	0x69, 0x4c, 0x60, 0x00, 0x82, 0x1e, 0xc9, 0x9c, 0xd8, 0x5e, 0xe9, 0xff,
-	0xfb, 0x22, 0xc4, 0xe1, 0x80, 0x06, 0x08, 0x29, 0x32, 0xa7, 0x98, 0xc4,
-	0x80, 0xbc, 0x86, 0x66, 0xe0, 0xf6, 0x18, 0x08, 0xd3, 0x25, 0x6b, 0x59,
-	0x58, 0x8b, 0x14, 0xd0, 0x40, 0xd0, 0x20, 0x34, 0x5d, 0xe3, 0xd0, 0x70,
-	0x3b, 0x0a, 0x07, 0x27, 0x07, 0x14, 0x90, 0x37, 0x5c, 0xc8, 0x7e, 0x81,
-	0x4f, 0xdf, 0xd6, 0x13, 0x54, 0x02, 0x18, 0x9c, 0x01, 0x5d, 0xb9, 0x3c,
-	0x58, 0x62, 0x2f, 0x64, 0x50, 0x4a, 0x44, 0x92, 0x46, 0x34, 0xb0, 0x62,
-	0x4b, 0xa3, 0x90, 0xd2, 0x55, 0x84, 0x56, 0xdd, 0xfc, 0x88, 0xcb, 0xf7,
-	0xb0, 0xcd, 0xfe, 0x95, 0x2f, 0xbf, 0x29, 0x19, 0x7e, 0x54, 0x4e, 0x67,
-	0xf4, 0xe9, 0x09, 0xf2, 0x56, 0x6f, 0x9b, 0x72, 0x15, 0x15, 0x50, 0x40,
-	0x8f, 0x86, 0x71, 0x52, 0xc2, 0x11, 0x24, 0x7a, 0x90, 0x46, 0x44, 0xb9,
-	0xc4, 0xd1, 0x62, 0x54, 0x70, 0x85, 0xa3, 0xa2, 0xac, 0x48, 0xff, 0xfb,
-	0x20, 0xc4, 0xe8, 0x80, 0x47, 0x3c, 0x99, 0x2e, 0xac, 0x24, 0x65, 0x40,
-	0xd5, 0x8e, 0xa5, 0xc1, 0x83, 0x0c, 0xa8, 0x2c, 0x8c, 0x50, 0x5e, 0xf6,
-	0xfe, 0x70, 0xc8, 0xe6, 0xa2, 0xd5, 0xac, 0x7e, 0x84, 0xbd, 0x51, 0x62,
-	0x4d, 0x87, 0x48, 0xac, 0x8b, 0xf2, 0x97, 0x41, 0xc6, 0xb6, 0x43, 0xee,
-	0xf4, 0x80, 0xb3, 0x08, 0x06, 0x2b, 0xc1, 0xec, 0x34, 0x17, 0xd5, 0xbd,
-	0xa3, 0x20, 0xf2, 0x06, 0x13, 0x18, 0x04, 0x31, 0x03, 0x96, 0x40, 0xc4,
-	0x23, 0x78, 0xa9, 0xe7, 0x93, 0xab, 0x9e, 0x99, 0x71, 0x0b, 0x3c, 0xdf,
-	0x50, 0x50, 0xba, 0x18, 0x18, 0x50, 0xd0, 0x99, 0x72, 0x7e, 0xf1, 0x83,
-	0x2a, 0x59, 0x99, 0x77, 0xb2, 0xbf, 0x64, 0x53, 0xac, 0x4c, 0x02, 0x16,
-	0x00, 0x4c, 0x21, 0x12, 0x81, 0xc2, 0xa5, 0xaf, 0xe4, 0xd4, 0xb7, 0xb9,
-	0xea, 0x7e, 0xb5, 0x34, 0xf7, 0x30, 0xa6, 0xae, 0xff, 0xfb, 0x22, 0xc4,
-	0xe7, 0x00, 0x06, 0xb0, 0x33, 0x33, 0x07, 0xb0, 0xc2, 0x40, 0xe2, 0x85,
-	0xea, 0x74, 0x93, 0x24, 0x5e, 0xe0, 0x20, 0xa9, 0x81, 0x11, 0xd2, 0xa5,
-	0x84, 0xea, 0x32, 0x35, 0x6e, 0x8b, 0x84, 0xc1, 0x53, 0xc9, 0x3a, 0x11,
-	0x72, 0x18, 0xc6, 0xa9, 0x60, 0x13, 0x97, 0x78, 0x8b, 0x51, 0xe4, 0x5f,
-	0xd5, 0x42, 0x86, 0xfa, 0xae, 0x34, 0xfb, 0xcf, 0x7c, 0x30, 0x00, 0x17,
-	0x3a, 0x4d, 0x7c, 0x8c, 0x1f, 0xfe, 0xa3, 0x5e, 0x75, 0x39, 0x2c, 0x54,
-	0x77, 0x30, 0x31, 0x04, 0xb1, 0xc0, 0x18, 0x3a, 0xf3, 0x99, 0x08, 0x13,
-	0x05, 0xe0, 0x16, 0xc6, 0x99, 0x30, 0xe2, 0x25, 0xc5, 0xc8, 0x03, 0xc7,
-	0xb5, 0xce, 0x35, 0x0f, 0x40, 0x9c, 0x98, 0xd0, 0x0b, 0x94, 0xd1, 0x92,
-	0xc7, 0x2c, 0xab, 0x16, 0x20, 0x3e, 0x78, 0x3c, 0x14, 0xf4, 0xfd, 0xe8,
-	0xa2, 0xf7, 0x11, 0x04, 0x81, 0x78, 0xe3, 0xff, 0xfb, 0x20, 0xc4, 0xe6,
-	0x80, 0x06, 0xbc, 0x97, 0x30, 0xa7, 0x98, 0x67, 0xc0, 0xda, 0x8e, 0xa7,
-	0x24, 0xc3, 0x08, 0xa8, 0x7f, 0xe9, 0xa3, 0x5e, 0xa7, 0x93, 0x2c, 0x9a,
-	0xbf, 0xff, 0xff, 0xe6, 0x09, 0xc1, 0xdd, 0x46, 0x34, 0xd4, 0x4c, 0xb3,
-	0x23, 0x06, 0x19, 0x22, 0x2e, 0xd5, 0xc3, 0x02, 0x54, 0xfa, 0x6a, 0x02,
-	0xbd, 0x8a, 0xda, 0x8a, 0xcd, 0x0e, 0x21, 0x62, 0x18, 0xc0, 0x9c, 0xc3,
-	0x3b, 0x38, 0xce, 0xbc, 0xd9, 0xbc, 0x94, 0x69, 0x60, 0x14, 0x70, 0xd6,
-	0xf4, 0x80, 0xae, 0x22, 0x44, 0xab, 0x84, 0xb7, 0x85, 0x40, 0x50, 0xd0,
-	0xf3, 0x26, 0xcb, 0x74, 0x64, 0xbd, 0x1f, 0xf8, 0x97, 0xb8, 0x25, 0x81,
-	0x5a, 0xb2, 0xe9, 0xf4, 0x1d, 0x2c, 0xab, 0x2e, 0x6c, 0xcd, 0x49, 0xd7,
-	0x21, 0xa1, 0x4a, 0x4a, 0x27, 0x5b, 0xa2, 0x49, 0xb4, 0x19, 0x73, 0xdd,
-	0xe6, 0x29, 0xfb, 0x03, 0x37, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06,
-	0xbc, 0x43, 0x33, 0x07, 0xbc, 0xc0, 0x40, 0xd5, 0x93, 0x26, 0x60, 0xf3,
-	0x0c, 0xa8, 0xc9, 0xc4, 0x8e, 0x96, 0x07, 0x81, 0xa4, 0x7f, 0x65, 0x11,
-	0xdb, 0x83, 0xb0, 0x6d, 0xca, 0x60, 0x3a, 0x8f, 0xe1, 0xfe, 0x1f, 0x88,
-	0xe2, 0xc5, 0x30, 0x51, 0x13, 0xd7, 0x21, 0x6d, 0x11, 0xb4, 0xae, 0x68,
-	0xe0, 0xba, 0x36, 0xad, 0x47, 0x09, 0xb3, 0x7d, 0xfa, 0x1f, 0xd7, 0xaf,
-	0x50, 0x8b, 0x7d, 0x5b, 0x0e, 0x02, 0x63, 0x5b, 0x7f, 0x5d, 0x09, 0x2e,
-	0x95, 0x87, 0x5c, 0xa2, 0x6b, 0x53, 0xbf, 0xff, 0xf2, 0x42, 0x08, 0x8a,
-	0xa1, 0x99, 0x31, 0x42, 0xb4, 0xb8, 0x15, 0x8d, 0x48, 0x54, 0xb1, 0x7e,
-	0x21, 0x83, 0xda, 0xf6, 0xdf, 0x75, 0x7b, 0x50, 0xf9, 0xe9, 0x25, 0x43,
-	0x9c, 0x35, 0xba, 0x42, 0xb5, 0x50, 0x46, 0x7c, 0x24, 0x02, 0x35, 0x04,
-	0xf7, 0x10, 0x8f, 0xee, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x06, 0xe4,
-	0x73, 0x30, 0xa7, 0xa4, 0x63, 0x80, 0xe3, 0x0d, 0x66, 0x21, 0x83, 0x0c,
-	0xa8, 0x7a, 0x65, 0x71, 0x47, 0x3b, 0xb3, 0xff, 0xee, 0x01, 0x81, 0x00,
-	0x00, 0x18, 0x05, 0x34, 0xb5, 0x2f, 0xe5, 0xf4, 0xf6, 0x63, 0x1a, 0x24,
-	0x4a, 0x20, 0xa2, 0x54, 0x28, 0x18, 0x94, 0x75, 0x24, 0xf6, 0x9a, 0x6c,
-	0xeb, 0x01, 0x4b, 0x76, 0x38, 0x3b, 0xcc, 0xd6, 0xc9, 0x10, 0x48, 0xe1,
-	0xd2, 0x03, 0x0d, 0x64, 0xaa, 0x2d, 0x24, 0x76, 0x86, 0x9d, 0x4e, 0x8f,
-	0xff, 0x53, 0x1b, 0xb5, 0x8e, 0x50, 0x0a, 0x14, 0x58, 0x21, 0x00, 0x68,
-	0x1e, 0x0f, 0xf5, 0x11, 0xd2, 0xa2, 0x69, 0x20, 0x02, 0x1b, 0x88, 0x12,
-	0x05, 0x59, 0xe4, 0x68, 0xd6, 0x2e, 0xcc, 0x23, 0x53, 0xd9, 0xf2, 0xca,
-	0x03, 0x2f, 0x3b, 0x45, 0xad, 0x88, 0x5a, 0x01, 0xc3, 0xe8, 0x1c, 0xde,
-	0x2d, 0x71, 0xb0, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06, 0xe8, 0x29,
-	0x33, 0x15, 0x81, 0x80, 0x01, 0x6d, 0xa5, 0xe8, 0xa7, 0x18, 0x70, 0x00,
-	0x79, 0xad, 0xb8, 0x59, 0x91, 0x3b, 0xad, 0xaf, 0xa6, 0xbb, 0x18, 0xc7,
-	0xf4, 0x55, 0x02, 0x66, 0x50, 0x04, 0x98, 0x0e, 0xf0, 0x34, 0x82, 0x84,
-	0x23, 0x2d, 0xf2, 0xb0, 0xe2, 0x86, 0x70, 0xc9, 0xb5, 0x7c, 0x15, 0x29,
-	0x38, 0x57, 0xda, 0xed, 0x8e, 0x44, 0x90, 0x50, 0xc3, 0x19, 0x70, 0x5e,
-	0xa2, 0x0e, 0x69, 0x71, 0xf7, 0x58, 0xab, 0xd0, 0xe9, 0xc8, 0x74, 0x1b,
-	0x0d, 0xa1, 0x40, 0xa5, 0x0d, 0xef, 0xfe, 0x43, 0x79, 0x51, 0xc3, 0xa0,
-	0x00, 0x58, 0x82, 0x59, 0x18, 0x12, 0x88, 0x81, 0x94, 0x4a, 0xee, 0xb0,
-	0xf9, 0x91, 0x15, 0x85, 0x77, 0x77, 0x10, 0x8a, 0xa8, 0xb8, 0x37, 0xc1,
-	0x04, 0xc0, 0xd5, 0xe8, 0xac, 0xdf, 0xcc, 0x24, 0x6a, 0x02, 0x51, 0x01,
-	0xe3, 0xff, 0xfb, 0x22, 0xc4, 0xd3, 0x80, 0x47, 0xfc, 0x5b, 0x55, 0x9c,
-	0xf4, 0x80, 0x00, 0xb2, 0x0b, 0xa8, 0x40, 0xc7, 0x98, 0x58, 0x08, 0x43,
-	0x6e, 0x4f, 0xef, 0x79, 0x6f, 0xf8, 0x30, 0x03, 0x08, 0x80, 0x80, 0xcf,
-	0xe1, 0xaa, 0x43, 0x7a, 0xbe, 0xeb, 0xde, 0x01, 0x42, 0x00, 0x00, 0x12,
-	0x61, 0x37, 0x31, 0xcf, 0xe6, 0x55, 0xda, 0x31, 0x06, 0x18, 0x2d, 0x3d,
-	0x29, 0x0b, 0x81, 0x04, 0x24, 0xf4, 0xb3, 0x26, 0x8d, 0x4f, 0x34, 0xe9,
-	0x5f, 0xe2, 0xd8, 0x86, 0x0e, 0xe0, 0xdd, 0x68, 0xb2, 0x1a, 0x72, 0x6f,
-	0x34, 0x70, 0x58, 0x3e, 0x40, 0xba, 0x48, 0x50, 0x9a, 0xa2, 0x9d, 0x8a,
-	0x01, 0x95, 0x80, 0x98, 0x81, 0x2c, 0x69, 0xad, 0xa3, 0x15, 0x83, 0x1b,
-	0x0a, 0x54, 0x0e, 0x02, 0xa2, 0x50, 0xc4, 0xa8, 0xe2, 0x15, 0x22, 0x60,
-	0x11, 0x12, 0x29, 0x5a, 0x83, 0xed, 0x0b, 0x87, 0x59, 0x22, 0xfd, 0xd9,
-	0xff, 0xfb, 0x20, 0xc4, 0xd4, 0x01, 0x06, 0x8c, 0x5d, 0x38, 0x07, 0xa4,
-	0xc7, 0x80, 0xca, 0x8e, 0x27, 0x14, 0xf4, 0x8c, 0xb8, 0x26, 0x25, 0x01,
-	0xb8, 0x6a, 0xee, 0xa6, 0xe9, 0xff, 0xd7, 0x96, 0xfd, 0xb7, 0xd6, 0xd9,
-	0x23, 0x6d, 0x80, 0x50, 0x18, 0x32, 0x2b, 0x25, 0x70, 0x9c, 0x51, 0x57,
-	0x24, 0x42, 0x92, 0x8d, 0xa9, 0x93, 0x46, 0x38, 0x89, 0xb4, 0xa4, 0x51,
-	0xba, 0x22, 0xe1, 0x05, 0xdd, 0x71, 0xa7, 0x92, 0xad, 0xc4, 0xbf, 0x16,
-	0xff, 0xaf, 0xa2, 0xec, 0x57, 0x7f, 0x72, 0xc1, 0xa2, 0x84, 0x02, 0x09,
-	0x58, 0xb3, 0x9b, 0x01, 0x6e, 0x88, 0xb1, 0xa9, 0xdc, 0xc7, 0xe9, 0x16,
-	0x3e, 0x0b, 0xbe, 0x98, 0x2b, 0x50, 0x13, 0x3c, 0x71, 0xd0, 0xd9, 0x29,
-	0x44, 0x54, 0x08, 0x1f, 0x04, 0xcd, 0x0e, 0x73, 0xf7, 0x14, 0x2e, 0x1e,
-	0x73, 0xff, 0xbb, 0x07, 0xe8, 0x63, 0x59, 0xeb, 0x02, 0x91, 0xff, 0xfb,
-	0x22, 0xc4, 0xd7, 0x00, 0x07, 0x14, 0x5d, 0x37, 0x27, 0x98, 0x65, 0xc0,
-	0xea, 0x0a, 0x26, 0xf0, 0xf3, 0x08, 0xb8, 0x23, 0x18, 0x18, 0x20, 0x46,
-	0x0a, 0x82, 0x27, 0x1e, 0xe2, 0x44, 0x07, 0x11, 0xcd, 0x94, 0x2c, 0x2d,
-	0x60, 0xa2, 0x48, 0xe1, 0x33, 0x56, 0xbe, 0x24, 0xb0, 0x34, 0x98, 0x1e,
-	0xc4, 0x9e, 0x1a, 0xcb, 0x91, 0x2e, 0xe1, 0x5c, 0x93, 0xdd, 0x1c, 0xcb,
-	0x33, 0xdd, 0x7b, 0x75, 0xb1, 0x4e, 0x83, 0x11, 0x1c, 0x87, 0x5d, 0x3b,
-	0x75, 0x74, 0x91, 0x48, 0x31, 0x33, 0x13, 0xc6, 0xd0, 0x50, 0xaf, 0x35,
-	0xde, 0x17, 0x08, 0x3c, 0xcd, 0x6e, 0x99, 0x84, 0xe5, 0xa7, 0x50, 0xd5,
-	0x08, 0xd4, 0xe0, 0x8d, 0x1d, 0xa8, 0x66, 0xc7, 0xf1, 0x6c, 0x48, 0x05,
-	0x96, 0x00, 0x04, 0x34, 0xc4, 0x24, 0x66, 0x94, 0x94, 0x91, 0x75, 0x25,
-	0x82, 0xd8, 0x88, 0x32, 0x17, 0x84, 0xcf, 0xbb, 0x5c, 0xff, 0xfb, 0x22,
-	0xc4, 0xd4, 0x00, 0x07, 0x0c, 0x3b, 0x37, 0x27, 0xb0, 0xc1, 0x40, 0xee,
-	0x12, 0x66, 0x15, 0x86, 0x0c, 0x38, 0x3d, 0xfa, 0x72, 0xe5, 0x34, 0x8a,
-	0x3c, 0x82, 0x46, 0x85, 0xc7, 0x06, 0x04, 0xea, 0x1c, 0x18, 0xbc, 0x93,
-	0xd9, 0x90, 0xbe, 0x67, 0xac, 0x41, 0xab, 0xec, 0xbf, 0xd8, 0xa7, 0x38,
-	0xed, 0x41, 0xa4, 0x8f, 0x78, 0xe8, 0x47, 0x19, 0x03, 0x51, 0x57, 0x20,
-	0x73, 0x83, 0x48, 0x84, 0xe6, 0xea, 0x44, 0xb6, 0x6f, 0x6d, 0xaa, 0xa4,
-	0xc7, 0x78, 0x34, 0x31, 0x74, 0xbd, 0x61, 0xe7, 0x0f, 0x01, 0xa8, 0x6b,
-	0xb1, 0x2b, 0x16, 0x5c, 0x88, 0xb4, 0x43, 0xd8, 0xce, 0x4b, 0xd1, 0xec,
-	0xa0, 0x79, 0x37, 0x2a, 0x06, 0x92, 0x11, 0x00, 0x0b, 0x58, 0x36, 0x30,
-	0x24, 0xea, 0xf5, 0x92, 0x50, 0x3c, 0xd1, 0x21, 0x96, 0x18, 0x3f, 0x56,
-	0x04, 0x00, 0xd0, 0x59, 0x15, 0xd9, 0xa6, 0x71, 0xff, 0xfb, 0x20, 0xc4,
-	0xd1, 0x00, 0xc6, 0xa0, 0x69, 0x33, 0x07, 0x98, 0x65, 0xc0, 0xb7, 0x85,
-	0xe6, 0xa0, 0xf1, 0x8c, 0x98, 0x48, 0x9d, 0xb7, 0xdb, 0x3d, 0xb6, 0x2f,
-	0x47, 0x50, 0x43, 0xd6, 0xce, 0xf2, 0xfd, 0x9f, 0x0f, 0x9d, 0x0c, 0x41,
-	0x95, 0x5a, 0xa4, 0xc1, 0xd4, 0x9d, 0x84, 0x47, 0xe5, 0x3d, 0xdd, 0x69,
-	0x1f, 0xa0, 0x14, 0x8f, 0x92, 0xee, 0xb6, 0xed, 0x70, 0x79, 0x44, 0x90,
-	0x20, 0x20, 0x86, 0x73, 0xc4, 0x02, 0x62, 0x95, 0x5a, 0x6d, 0xeb, 0x93,
-	0xd6, 0x38, 0x1c, 0x3a, 0x46, 0x07, 0x22, 0x0f, 0x82, 0x0e, 0x0d, 0x4e,
-	0xbd, 0xe1, 0xd2, 0xe4, 0x94, 0x68, 0x40, 0xf2, 0x01, 0x70, 0x03, 0xad,
-	0x88, 0x27, 0xff, 0xb6, 0x47, 0x43, 0x26, 0xea, 0x03, 0x00, 0x01, 0x0b,
-	0x09, 0xb4, 0x30, 0x44, 0x22, 0x38, 0x1c, 0x55, 0x75, 0x15, 0x38, 0x47,
-	0xd1, 0x64, 0x96, 0xe7, 0x3d, 0x5e, 0xff, 0xfb, 0x22, 0xc4, 0xd6, 0x00,
-	0x06, 0x08, 0x47, 0x61, 0xa4, 0x84, 0x70, 0x30, 0xc3, 0x08, 0x66, 0xa0,
-	0xf4, 0x8c, 0x38, 0xc4, 0x4c, 0xa4, 0x10, 0x78, 0x6a, 0x05, 0x93, 0x48,
-	0x04, 0xea, 0x8f, 0x08, 0xa7, 0x1f, 0x03, 0x0b, 0x38, 0x70, 0x09, 0x2f,
-	0x01, 0x22, 0x4e, 0xc1, 0xb8, 0x77, 0xe9, 0xa6, 0xa7, 0xf7, 0x01, 0x31,
-	0x8a, 0xa0, 0x30, 0x04, 0xa4, 0x6f, 0x37, 0xac, 0x23, 0x96, 0x10, 0x25,
-	0xa9, 0x9a, 0x24, 0xe2, 0x2b, 0x22, 0x83, 0x1c, 0x18, 0x3c, 0xf1, 0x1b,
-	0x82, 0x84, 0x17, 0x15, 0x6b, 0x42, 0x42, 0xe5, 0x0c, 0x81, 0x08, 0x5e,
-	0xbf, 0xd8, 0x71, 0xce, 0xa1, 0xee, 0x40, 0x27, 0x86, 0xc2, 0x27, 0x84,
-	0x36, 0x2f, 0xeb, 0x00, 0x42, 0x8b, 0x48, 0xd0, 0x04, 0x82, 0x78, 0x5e,
-	0x08, 0x02, 0x83, 0x6a, 0x84, 0x49, 0x64, 0xb1, 0x1a, 0x80, 0x83, 0x06,
-	0x19, 0x81, 0x0d, 0xa9, 0x5f, 0xff, 0xfb, 0x22, 0xc4, 0xdc, 0x80, 0x05,
-	0xf8, 0x41, 0x35, 0x07, 0xa4, 0x61, 0x40, 0xa8, 0x8c, 0xa6, 0x41, 0x83,
-	0x08, 0xf8, 0x64, 0x30, 0xa0, 0xbb, 0xf6, 0xa4, 0x84, 0x06, 0x0f, 0x13,
-	0x83, 0xd2, 0x66, 0xc2, 0xe7, 0xc0, 0xed, 0x7f, 0x10, 0x04, 0x2e, 0xd0,
-	0x6e, 0xb8, 0xab, 0x71, 0x75, 0xb9, 0xea, 0x66, 0x1c, 0xb7, 0xac, 0xa5,
-	0x61, 0x31, 0x90, 0x54, 0x0d, 0x82, 0x62, 0x21, 0x82, 0x06, 0x84, 0x80,
-	0x83, 0x95, 0x6e, 0x9b, 0x6f, 0x1c, 0xb3, 0x2a, 0x88, 0x60, 0xea, 0xf3,
-	0xaa, 0xe8, 0x4e, 0xc2, 0x0d, 0xb5, 0xc4, 0x0f, 0x98, 0x6d, 0xc2, 0xe2,
-	0x70, 0xc0, 0x58, 0x6e, 0x03, 0x1c, 0x4d, 0xef, 0x45, 0xdc, 0x80, 0xdf,
-	0xaf, 0xff, 0xe5, 0x13, 0x58, 0x5a, 0xa0, 0xf0, 0x3e, 0x35, 0x11, 0x6c,
-	0x98, 0x53, 0x1f, 0xcc, 0xf3, 0x8c, 0xe3, 0xa5, 0xc9, 0x65, 0xca, 0xa6,
-	0x26, 0x3a, 0xf2, 0x85, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x46, 0x78,
-	0x41, 0x33, 0x07, 0xb0, 0xc0, 0x40, 0xd0, 0x07, 0xe6, 0x15, 0x86, 0x18,
-	0x08, 0x87, 0xf0, 0x26, 0x3d, 0x5e, 0x27, 0x25, 0x38, 0xee, 0x3b, 0x4c,
-	0x59, 0x06, 0x67, 0x95, 0x5c, 0xec, 0x39, 0x86, 0x02, 0x20, 0xe0, 0xf4,
-	0x78, 0x87, 0xe8, 0x0f, 0x30, 0x66, 0xdf, 0xa7, 0xcb, 0x4c, 0x68, 0x71,
-	0xf8, 0xc9, 0xc3, 0xdb, 0x58, 0xb8, 0xa7, 0xa1, 0x0a, 0x55, 0x76, 0x2b,
-	0xc2, 0x72, 0x95, 0x29, 0xa7, 0x27, 0x91, 0xe5, 0xd2, 0x65, 0x67, 0x27,
-	0x84, 0x53, 0x28, 0x62, 0x1c, 0x3c, 0x5d, 0x41, 0x30, 0x79, 0xe6, 0x5a,
-	0x06, 0x61, 0x2c, 0xc2, 0xc0, 0x30, 0xaf, 0x86, 0x8a, 0x29, 0x00, 0x5c,
-	0xdd, 0x93, 0x40, 0x24, 0xa8, 0x16, 0x5b, 0x96, 0x8b, 0xe7, 0x64, 0xa9,
-	0x23, 0x51, 0xad, 0xbe, 0x81, 0x83, 0x19, 0xca, 0xa3, 0x3d, 0x1f, 0xfd,
-	0x5a, 0x14, 0xff, 0xfb, 0x22, 0xc4, 0xe9, 0x00, 0x47, 0x60, 0x95, 0x31,
-	0x07, 0x98, 0x65, 0x80, 0xdd, 0x07, 0xe5, 0xc0, 0xf3, 0x18, 0x98, 0xd4,
-	0x7f, 0x12, 0xaa, 0x01, 0x82, 0x00, 0x06, 0x40, 0x18, 0xcb, 0x35, 0xd1,
-	0x82, 0x6c, 0x2a, 0x8c, 0x0f, 0x09, 0x9c, 0x4e, 0x95, 0xaa, 0x85, 0x19,
-	0x2a, 0xc8, 0x61, 0x3b, 0x30, 0x6b, 0x30, 0x96, 0x5d, 0x61, 0xc8, 0x63,
-	0xa8, 0x31, 0x9f, 0xf7, 0x47, 0xf0, 0xa7, 0x7e, 0x38, 0x38, 0x16, 0xb5,
-	0xd7, 0x6a, 0x2a, 0xa0, 0x70, 0x34, 0x3d, 0x09, 0xa6, 0xd8, 0x47, 0x34,
-	0x67, 0xcd, 0x88, 0x97, 0x95, 0x01, 0x28, 0x13, 0x48, 0xfe, 0x69, 0x6f,
-	0x47, 0xe3, 0x41, 0x69, 0xeb, 0xec, 0x72, 0x6a, 0xad, 0xbc, 0x1f, 0x3c,
-	0xf7, 0x30, 0x44, 0x74, 0x20, 0x38, 0xb7, 0xd0, 0x26, 0x56, 0x11, 0x63,
-	0xa5, 0x53, 0xff, 0x55, 0x01, 0x16, 0x10, 0x08, 0x80, 0xc3, 0x88, 0x13,
-	0x18, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06, 0xa4, 0x3f, 0x30, 0xa7,
-	0xb0, 0xc0, 0x40, 0xd3, 0x85, 0x26, 0xa4, 0xf3, 0x18, 0x90, 0x14, 0x08,
-	0xda, 0x3b, 0x23, 0x48, 0x44, 0x4b, 0x49, 0x40, 0xd7, 0x29, 0x32, 0x0d,
-	0x0c, 0x99, 0xc9, 0x06, 0xb3, 0xe2, 0x62, 0xa5, 0x81, 0x14, 0x12, 0x0e,
-	0x86, 0x81, 0x80, 0x5e, 0x25, 0x76, 0x2d, 0xd6, 0x79, 0x05, 0xac, 0xa5,
-	0x17, 0xeb, 0xe9, 0xd5, 0xbc, 0x09, 0x94, 0x00, 0x16, 0xc0, 0xa5, 0x5d,
-	0xa1, 0x0a, 0xb3, 0xa9, 0x0d, 0x04, 0x02, 0x51, 0xa8, 0x6b, 0x22, 0x6b,
-	0x50, 0x72, 0x29, 0x96, 0xa2, 0xb1, 0x3a, 0x8c, 0x55, 0xdb, 0x95, 0x9d,
-	0x0e, 0xac, 0x33, 0xcd, 0x07, 0x05, 0xc8, 0x18, 0x5d, 0x5b, 0xd8, 0x3b,
-	0x45, 0xc4, 0x2c, 0x67, 0xf4, 0x2a, 0x13, 0x00, 0x61, 0x27, 0x37, 0x8b,
-	0xc3, 0x8a, 0x49, 0xf3, 0x0a, 0xf0, 0x25, 0x58, 0x82, 0x24, 0xd6, 0xff,
-	0xfb, 0x22, 0xc4, 0xe8, 0x00, 0x07, 0x58, 0x43, 0x33, 0x87, 0xa4, 0xc0,
-	0x80, 0xd4, 0x88, 0xa7, 0xec, 0x94, 0x8c, 0xe0, 0x0a, 0x16, 0x61, 0x04,
-	0x53, 0xe1, 0x25, 0xbb, 0xc9, 0x28, 0xeb, 0xd0, 0x9a, 0x28, 0xc7, 0x2b,
-	0x6c, 0xb3, 0xdd, 0x83, 0xbc, 0x2e, 0x49, 0x09, 0x7a, 0x55, 0x65, 0xe1,
-	0xbb, 0x5b, 0xd8, 0xec, 0x30, 0x92, 0x42, 0x3f, 0x46, 0x73, 0xda, 0x11,
-	0xd0, 0x82, 0x14, 0xcc, 0x86, 0xba, 0x7d, 0x38, 0x06, 0x22, 0x96, 0x27,
-	0x48, 0x1e, 0xbb, 0x30, 0x04, 0xbe, 0x79, 0x16, 0x29, 0x9c, 0x89, 0xc3,
-	0x86, 0xa1, 0x87, 0x46, 0xbd, 0x0f, 0xef, 0xb3, 0x31, 0x8e, 0x5a, 0x41,
-	0x83, 0xa5, 0x87, 0xb2, 0x55, 0x44, 0x48, 0xcc, 0xa5, 0x74, 0xca, 0x5c,
-	0x3a, 0x06, 0xbb, 0x6d, 0x8b, 0xeb, 0xdc, 0xf7, 0xd5, 0x0a, 0x56, 0xdc,
-	0x31, 0x52, 0x80, 0x00, 0xa8, 0x75, 0x0f, 0x8f, 0x03, 0x96, 0xff, 0xfb,
-	0x22, 0xc4, 0xe7, 0x00, 0x4b, 0x19, 0x0d, 0x46, 0x06, 0x18, 0x78, 0x88,
-	0xbd, 0x92, 0x69, 0x54, 0xc3, 0x09, 0x38, 0x40, 0x8e, 0x98, 0x82, 0x86,
-	0x12, 0xbe, 0x69, 0x69, 0x11, 0xc8, 0x83, 0xce, 0x0f, 0x28, 0x12, 0x02,
-	0x96, 0x40, 0xc0, 0x08, 0x04, 0x59, 0xc4, 0x8a, 0x1e, 0x70, 0x55, 0x8e,
-	0x1b, 0xd1, 0x7b, 0xa8, 0xb3, 0x57, 0x24, 0xbf, 0x57, 0xaa, 0xe5, 0x6f,
-	0x04, 0x57, 0x87, 0x56, 0x43, 0x4e, 0xb6, 0x60, 0x1b, 0x02, 0xc2, 0xc4,
-	0xe2, 0x23, 0xe2, 0x94, 0x42, 0xcc, 0x28, 0x68, 0xba, 0x36, 0x88, 0x51,
-	0x9c, 0xc2, 0x09, 0x77, 0xd7, 0x60, 0xe1, 0x86, 0x20, 0x1f, 0x9e, 0x5a,
-	0x0c, 0x28, 0x88, 0x20, 0xdc, 0xcc, 0x9c, 0x72, 0x53, 0xbe, 0x87, 0x77,
-	0xff, 0xf7, 0xf5, 0xa9, 0x03, 0xfb, 0x06, 0x41, 0x18, 0x0f, 0x01, 0x6e,
-	0x05, 0xca, 0x0b, 0xa1, 0x25, 0x02, 0x49, 0x84, 0x28, 0xff, 0xfb, 0x20,
-	0xc4, 0xd9, 0x80, 0x06, 0x10, 0x71, 0x41, 0x27, 0xa4, 0x45, 0x40, 0xc0,
-	0x8c, 0xe7, 0x94, 0xf3, 0x0d, 0x28, 0x99, 0x68, 0xd4, 0x9c, 0x89, 0xb3,
-	0x62, 0x80, 0xb8, 0x3c, 0x90, 0x64, 0x22, 0xe2, 0xcf, 0x2a, 0x4a, 0xf3,
-	0x35, 0x9e, 0xfa, 0xa4, 0x4e, 0xb2, 0xff, 0xf6, 0x21, 0x7d, 0xf3, 0xd7,
-	0x22, 0xb5, 0x03, 0x2d, 0x2a, 0x26, 0x00, 0xa0, 0x84, 0x58, 0x0e, 0x03,
-	0x35, 0x0f, 0x69, 0x3d, 0x37, 0x42, 0x52, 0x96, 0x88, 0x94, 0xb9, 0xd0,
-	0xa6, 0xdb, 0x15, 0x26, 0xa2, 0x9f, 0x72, 0x36, 0x99, 0x91, 0x17, 0x5e,
-	0x6a, 0x5e, 0x4d, 0xd5, 0x87, 0x36, 0xce, 0xcb, 0xc3, 0x49, 0x79, 0xf0,
-	0x73, 0x49, 0xbf, 0xa4, 0x7b, 0x9c, 0x32, 0xca, 0xd9, 0x96, 0x53, 0xa6,
-	0x72, 0x2a, 0x2e, 0xe7, 0x66, 0x56, 0x38, 0xa0, 0x44, 0x00, 0x02, 0x23,
-	0x88, 0x20, 0x15, 0x3e, 0x09, 0x35, 0xc8, 0xff, 0xfb, 0x22, 0xc4, 0xdf,
-	0x80, 0x86, 0x78, 0x3d, 0x39, 0x0c, 0x24, 0xc1, 0x00, 0xc1, 0x8b, 0x66,
-	0xe0, 0xf3, 0x08, 0xb8, 0x22, 0x4e, 0xe8, 0x82, 0xe9, 0x3b, 0xd8, 0xcd,
-	0x73, 0x0a, 0x05, 0xcc, 0x94, 0x42, 0x50, 0x18, 0x14, 0x96, 0x42, 0x48,
-	0x5f, 0x34, 0xcd, 0xf3, 0x7d, 0x6f, 0x39, 0x8b, 0xd9, 0xff, 0x2e, 0x02,
-	0xcc, 0x82, 0x88, 0x0c, 0x21, 0x22, 0x5f, 0x3d, 0x0f, 0x87, 0x2c, 0x83,
-	0xca, 0x4e, 0x10, 0x45, 0x44, 0x6c, 0x18, 0xd5, 0x49, 0x65, 0xcd, 0x16,
-	0x29, 0xcf, 0x0a, 0x11, 0x16, 0x52, 0x14, 0x3c, 0x5c, 0xc9, 0x27, 0x0a,
-	0xc4, 0xe2, 0x67, 0x9f, 0x09, 0x2e, 0x65, 0x6f, 0x70, 0xc7, 0xd3, 0xd7,
-	0x3b, 0xfd, 0x8c, 0x92, 0x3d, 0x75, 0x15, 0x2e, 0x5b, 0xb5, 0x96, 0x7f,
-	0xd2, 0x02, 0xed, 0xa1, 0x7a, 0x0a, 0x96, 0x35, 0xfc, 0x18, 0x4a, 0xc9,
-	0xc9, 0x89, 0xf8, 0xaf, 0xc6, 0xb7, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x00,
-	0x86, 0xfc, 0x67, 0x34, 0xa7, 0x98, 0x67, 0x80, 0xe5, 0x0d, 0xe6, 0x00,
-	0xf3, 0x0c, 0xb8, 0x15, 0xdd, 0x60, 0x33, 0x0e, 0x13, 0x98, 0x16, 0x4f,
-	0xd0, 0x9a, 0x98, 0x27, 0x0d, 0x03, 0x23, 0x45, 0xa7, 0x34, 0x31, 0xcc,
-	0x3c, 0x75, 0xa8, 0x6f, 0x84, 0xb6, 0xab, 0x58, 0x2d, 0x96, 0xe2, 0x62,
-	0x05, 0x18, 0x06, 0x60, 0xef, 0x45, 0xb5, 0xaa, 0x58, 0x49, 0x01, 0x7b,
-	0x00, 0xa6, 0x1e, 0x12, 0x49, 0x32, 0x63, 0xdc, 0x0c, 0x5b, 0x92, 0xea,
-	0x7c, 0x71, 0x28, 0xc4, 0x5f, 0x22, 0x69, 0x3e, 0xc5, 0x9d, 0x96, 0xf5,
-	0xe9, 0xad, 0x95, 0x4e, 0x3b, 0xce, 0xbd, 0xe8, 0xf1, 0x7d, 0x6c, 0xc7,
-	0x57, 0x1e, 0xe7, 0x5b, 0x56, 0x71, 0xaa, 0x01, 0x52, 0x10, 0x08, 0x10,
-	0x88, 0xa3, 0x72, 0x17, 0x1c, 0x24, 0xe3, 0x33, 0x36, 0x5f, 0x53, 0x42,
-	0x85, 0x97, 0x1c, 0xc4, 0xff, 0xfb, 0x22, 0xc4, 0xe1, 0x80, 0x06, 0xc0,
-	0x33, 0x3f, 0x86, 0x24, 0xc0, 0x20, 0xcf, 0x07, 0x28, 0xb8, 0x94, 0x8c,
-	0x34, 0x44, 0xdb, 0x80, 0xca, 0x11, 0x36, 0xcf, 0xa6, 0xb7, 0x2c, 0xbb,
-	0x73, 0x5c, 0x8a, 0xe3, 0x8b, 0xce, 0x9c, 0xbe, 0xb9, 0x24, 0xa8, 0xd4,
-	0xf0, 0xce, 0x9d, 0x4f, 0xc8, 0xad, 0xe3, 0xe9, 0x4f, 0xa8, 0x43, 0x24,
-	0x88, 0xa1, 0x2c, 0x00, 0x05, 0x08, 0x56, 0x27, 0x13, 0xca, 0xab, 0x80,
-	0xde, 0x41, 0x09, 0x82, 0x05, 0x84, 0x13, 0x82, 0xb9, 0x46, 0xd5, 0xa3,
-	0xad, 0x2a, 0x49, 0x20, 0xe7, 0xab, 0x3e, 0xeb, 0x91, 0xb6, 0xa1, 0x50,
-	0x3d, 0x58, 0xea, 0x59, 0x5a, 0x9e, 0xe4, 0x83, 0x0e, 0xd1, 0x62, 0x77,
-	0x99, 0xd1, 0xd7, 0xcd, 0x21, 0xb5, 0x06, 0x7f, 0x11, 0x44, 0x08, 0x0e,
-	0x60, 0x0c, 0x57, 0x28, 0x83, 0x5d, 0x98, 0x4c, 0xb6, 0xa4, 0x6a, 0xd0,
-	0x0c, 0x20, 0x72, 0xff, 0xfb, 0x22, 0xc4, 0xe3, 0x80, 0x06, 0x24, 0x29,
-	0x37, 0x27, 0xa4, 0xc0, 0x40, 0xed, 0x12, 0xa6, 0x60, 0xc4, 0x8c, 0xb8,
-	0xcb, 0xa8, 0xa4, 0x14, 0x38, 0xb0, 0xd8, 0x58, 0x3c, 0x83, 0x68, 0x08,
-	0xa4, 0xa8, 0xb1, 0x74, 0xa5, 0x89, 0x14, 0x46, 0xaa, 0xc0, 0x07, 0xf6,
-	0x19, 0x03, 0xbf, 0xda, 0xbf, 0xf4, 0xf5, 0xd6, 0xb5, 0x1b, 0x43, 0xc3,
-	0xbc, 0x3c, 0x36, 0xb6, 0xcb, 0x20, 0x08, 0x76, 0xf1, 0x41, 0x60, 0xb9,
-	0x9e, 0x14, 0x16, 0x1b, 0x91, 0x22, 0x37, 0x09, 0x17, 0x42, 0x55, 0xb0,
-	0x4e, 0xbc, 0x8d, 0xb8, 0x80, 0x68, 0x1c, 0xc2, 0x86, 0xe2, 0x28, 0x05,
-	0xab, 0x73, 0xfb, 0x28, 0x42, 0xdf, 0x32, 0x86, 0x4b, 0x03, 0x5b, 0x95,
-	0x67, 0xf6, 0xd2, 0x94, 0x2a, 0x0a, 0xfb, 0x11, 0x14, 0x64, 0x02, 0x84,
-	0xd7, 0x1c, 0x09, 0x04, 0xc3, 0x4b, 0x45, 0x56, 0xdd, 0x3e, 0x75, 0xfd,
-	0x83, 0x8c, 0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x00, 0x05, 0xfc, 0x35, 0x43,
-	0xa4, 0xa4, 0xc0, 0x60, 0xde, 0x07, 0xa6, 0x20, 0xf3, 0x08, 0xa8, 0x02,
-	0x84, 0x41, 0x72, 0x6e, 0x01, 0x98, 0x9c, 0xda, 0xd4, 0x01, 0x05, 0x44,
-	0x27, 0x88, 0x3d, 0x9d, 0x14, 0x2f, 0xb7, 0xb5, 0x78, 0x67, 0xe8, 0x7d,
-	0xa8, 0xe8, 0x35, 0xad, 0x25, 0x4f, 0x66, 0x40, 0x71, 0x1e, 0x15, 0x63,
-	0xe5, 0x49, 0x2b, 0x7d, 0x67, 0x9e, 0xa9, 0x88, 0xf4, 0x62, 0xc3, 0xb9,
-	0x18, 0x59, 0x66, 0x0d, 0xc4, 0xb3, 0x3b, 0x94, 0x00, 0x6d, 0x0f, 0x86,
-	0x68, 0x5b, 0x53, 0x3d, 0x86, 0xe8, 0x2c, 0xc7, 0x75, 0x8c, 0x8f, 0x95,
-	0xa6, 0x28, 0xca, 0xca, 0x14, 0x7b, 0x2b, 0x29, 0x96, 0xa4, 0x57, 0x61,
-	0x73, 0x07, 0xd3, 0xf6, 0xb4, 0x75, 0xbd, 0x5f, 0xad, 0xe3, 0x59, 0x4c,
-	0xfe, 0xbc, 0x0b, 0x1c, 0xbc, 0xfb, 0x34, 0x61, 0x64, 0x4d, 0xb9, 0x13,
-	0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0x74, 0x63, 0x55, 0x87, 0x84,
-	0x70, 0xf0, 0xeb, 0x12, 0x66, 0xb0, 0xf3, 0x08, 0xa0, 0x9f, 0x33, 0x4d,
-	0xd7, 0xe9, 0x7d, 0x9e, 0xed, 0xdd, 0xa4, 0xbd, 0x9d, 0x1c, 0x67, 0x8b,
-	0x06, 0xfe, 0x7f, 0xc0, 0x95, 0xe3, 0xcf, 0x39, 0x93, 0x45, 0x64, 0xd2,
-	0x08, 0x00, 0x9c, 0x31, 0xb5, 0xd2, 0xea, 0x26, 0x48, 0x68, 0xce, 0x53,
-	0x07, 0x87, 0x90, 0x2d, 0x00, 0x98, 0x18, 0x18, 0x95, 0x51, 0xf3, 0x73,
-	0x8b, 0x1d, 0x37, 0x21, 0xc8, 0x23, 0xf5, 0x6c, 0x3e, 0x5a, 0x22, 0x1b,
-	0x9f, 0x78, 0x0f, 0x4d, 0xff, 0x63, 0x24, 0xd0, 0xd4, 0xb4, 0xdd, 0x53,
-	0x6b, 0xa6, 0xb1, 0xff, 0xf3, 0xdd, 0xa1, 0x31, 0x0f, 0x61, 0xf9, 0xeb,
-	0xef, 0xec, 0xe5, 0x32, 0x1b, 0xa0, 0x06, 0x99, 0xe5, 0x0c, 0xa6, 0x58,
-	0x83, 0x1f, 0x53, 0xc4, 0xfe, 0x08, 0x9c, 0xe5, 0x40, 0x31, 0x0e, 0xff,
-	0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xb8, 0x69, 0x31, 0x0c, 0x24, 0x63,
-	0x80, 0xde, 0x92, 0x67, 0x70, 0xf3, 0x08, 0xb4, 0xee, 0xcf, 0x0a, 0xcb,
-	0x65, 0xd2, 0x00, 0x06, 0x4b, 0xe2, 0x50, 0x29, 0xca, 0xe6, 0x96, 0x37,
-	0x15, 0x46, 0x9f, 0x35, 0x29, 0xa9, 0x5f, 0x67, 0x80, 0xc5, 0xa4, 0xe5,
-	0x20, 0x7b, 0xda, 0x19, 0xb5, 0x2c, 0x73, 0xda, 0xb4, 0xde, 0xa8, 0xa7,
-	0x72, 0x18, 0xfb, 0x86, 0x50, 0x03, 0x03, 0xa6, 0x32, 0x53, 0x2a, 0x81,
-	0xd2, 0xa0, 0xf2, 0x20, 0x92, 0xe1, 0x91, 0x29, 0x09, 0xe6, 0x70, 0x4a,
-	0x80, 0xc4, 0xa2, 0x55, 0x38, 0x36, 0x41, 0xea, 0x89, 0x03, 0xc1, 0x60,
-	0xc8, 0x8b, 0x69, 0x18, 0xc7, 0x7e, 0x15, 0x19, 0xb1, 0x7c, 0x4d, 0xfd,
-	0xce, 0xff, 0xea, 0xa3, 0xd7, 0x94, 0x85, 0x23, 0x80, 0x07, 0x06, 0x02,
-	0x52, 0x43, 0x2b, 0xb6, 0x24, 0x18, 0x48, 0x05, 0x20, 0x13, 0xff, 0xfb,
-	0x20, 0xc4, 0xe6, 0x00, 0x06, 0xc4, 0x2d, 0x35, 0x27, 0xa5, 0x24, 0x80,
-	0xdc, 0x08, 0xec, 0xfc, 0xc3, 0x0c, 0xe6, 0x70, 0x18, 0xdb, 0x75, 0x96,
-	0x7c, 0xd0, 0x7c, 0x90, 0xf2, 0xc2, 0x59, 0x01, 0x62, 0x53, 0xc6, 0x91,
-	0xac, 0x16, 0xbb, 0x1c, 0x21, 0x22, 0x7d, 0x95, 0xa5, 0xfd, 0x1d, 0x69,
-	0x40, 0xce, 0x85, 0x55, 0x09, 0x00, 0x41, 0xcc, 0xdc, 0x62, 0xd0, 0x20,
-	0x1b, 0x75, 0xa3, 0x46, 0x60, 0x0a, 0x00, 0x01, 0x41, 0x38, 0x5d, 0x2e,
-	0x41, 0x4a, 0x9c, 0x2d, 0x1d, 0x46, 0xaa, 0x28, 0x8d, 0x37, 0x98, 0x9c,
-	0x65, 0x9c, 0x90, 0xe9, 0xa1, 0x3b, 0x41, 0x70, 0x0d, 0xad, 0xeb, 0x43,
-	0xd2, 0xda, 0xcd, 0x36, 0xb4, 0x8c, 0xaa, 0xd4, 0x1c, 0xdb, 0x43, 0x3c,
-	0x54, 0x8a, 0x58, 0x00, 0x16, 0x90, 0x0d, 0x40, 0x09, 0x51, 0x1c, 0x3f,
-	0x22, 0x23, 0x54, 0xfa, 0x8a, 0x3d, 0x62, 0x13, 0xff, 0xfb, 0x22, 0xc4,
-	0xe5, 0x80, 0x06, 0x00, 0x2b, 0x39, 0x34, 0xc1, 0x80, 0x01, 0x95, 0x9e,
-	0xa5, 0x03, 0x30, 0xc0, 0x00, 0x52, 0x68, 0x92, 0x49, 0x36, 0xb0, 0x13,
-	0xea, 0x10, 0xa6, 0x68, 0xb1, 0xa4, 0x06, 0x46, 0x49, 0x99, 0xe6, 0x63,
-	0x9b, 0xed, 0x09, 0x98, 0xe9, 0x22, 0x41, 0x20, 0x65, 0x42, 0xae, 0xe2,
-	0xea, 0xb1, 0x74, 0x1f, 0xaa, 0x2d, 0xfb, 0xab, 0x02, 0x99, 0x00, 0x44,
-	0x98, 0x86, 0x8e, 0xbc, 0x83, 0x17, 0xdc, 0x3a, 0x30, 0xc3, 0xc3, 0xb3,
-	0x15, 0x4e, 0xb3, 0x93, 0x48, 0x0d, 0x08, 0xad, 0xcf, 0xd3, 0x46, 0xb9,
-	0xd8, 0x9e, 0x33, 0xcd, 0x6c, 0x2c, 0x59, 0xeb, 0x58, 0xe5, 0xce, 0x06,
-	0xdf, 0xdf, 0x24, 0xe2, 0x11, 0xa1, 0xaf, 0xff, 0xfe, 0x80, 0x95, 0xb6,
-	0x79, 0x12, 0x2a, 0xa6, 0x88, 0x0c, 0x09, 0x07, 0x87, 0x86, 0xe1, 0xb8,
-	0x28, 0x91, 0x6c, 0x10, 0x2e, 0xe4, 0xe4, 0xff, 0xfb, 0x20, 0xc4, 0xd1,
-	0x80, 0x0b, 0x0c, 0xbb, 0x51, 0x38, 0x95, 0x80, 0x00, 0xba, 0x08, 0x30,
-	0x7f, 0x9e, 0x20, 0x06, 0x0c, 0x08, 0xee, 0x1a, 0x87, 0x55, 0x4e, 0x55,
-	0x65, 0xda, 0x53, 0x6d, 0xa5, 0x7a, 0x19, 0xde, 0xee, 0xc3, 0xb2, 0xaa,
-	0x90, 0x9b, 0x94, 0x03, 0x46, 0xc3, 0xfb, 0xd1, 0xe8, 0xb7, 0x5f, 0xad,
-	0x5b, 0x08, 0x23, 0xfe, 0x34, 0x43, 0xf5, 0xe2, 0xa5, 0xaa, 0x51, 0x2e,
-	0x65, 0x33, 0xb7, 0x6b, 0x19, 0xa7, 0xd1, 0x7b, 0xee, 0xcb, 0x69, 0xd1,
-	0x6b, 0x00, 0x84, 0xad, 0x1e, 0x05, 0x71, 0x28, 0xc5, 0xb4, 0x5f, 0x6e,
-	0xc0, 0xe3, 0x0c, 0x97, 0x62, 0x58, 0xee, 0xde, 0xdb, 0x3f, 0xed, 0x5c,
-	0x81, 0x14, 0xb7, 0xa8, 0x89, 0x6c, 0x74, 0x37, 0xc8, 0xd1, 0x60, 0x84,
-	0x8d, 0xde, 0x4d, 0x31, 0x85, 0x45, 0x56, 0x27, 0xc0, 0x8e, 0x39, 0x56,
-	0x0a, 0x7b, 0x64, 0xb6, 0x76, 0xff, 0xfb, 0x22, 0xc4, 0xc4, 0x80, 0x05,
-	0xc0, 0x2f, 0x48, 0xa6, 0x24, 0xc4, 0xc0, 0xcc, 0x85, 0x69, 0x28, 0xc4,
-	0x98, 0x80, 0xe6, 0x4c, 0x0d, 0x41, 0x93, 0xa7, 0x8d, 0xea, 0x12, 0x8b,
-	0x97, 0x38, 0x89, 0x34, 0xb7, 0x59, 0x6c, 0x57, 0xfe, 0xeb, 0xf4, 0x2a,
-	0x2d, 0xeb, 0x5d, 0x91, 0xff, 0xd2, 0x04, 0x0d, 0x85, 0x84, 0x43, 0xcf,
-	0x04, 0x45, 0x30, 0xc1, 0x4c, 0x6b, 0xd6, 0x39, 0x2b, 0x26, 0xa5, 0x5d,
-	0x39, 0xa4, 0x00, 0x40, 0x50, 0x65, 0x13, 0x64, 0xf8, 0x26, 0x20, 0x44,
-	0xe6, 0xa4, 0x34, 0x00, 0x19, 0x67, 0x03, 0x5d, 0xfa, 0x01, 0x90, 0x00,
-	0x14, 0x00, 0xfc, 0x52, 0x9b, 0x81, 0x16, 0xaf, 0x5a, 0xc2, 0x52, 0x5a,
-	0x48, 0xce, 0x2c, 0x68, 0x94, 0x44, 0xd0, 0x90, 0x24, 0x05, 0x73, 0xd0,
-	0x6c, 0xab, 0xc0, 0xef, 0x24, 0x5c, 0x58, 0x29, 0x6a, 0xb7, 0x56, 0x0e,
-	0x84, 0x9f, 0x17, 0x4f, 0xff, 0xfb, 0x22, 0xc4, 0xca, 0x80, 0x07, 0x18,
-	0x55, 0x38, 0xa7, 0xa4, 0xc4, 0xc0, 0xe9, 0x0c, 0xe7, 0x24, 0xc3, 0x0d,
-	0x88, 0x41, 0x6c, 0xc6, 0xd9, 0x6d, 0x35, 0x29, 0xaf, 0x52, 0x44, 0x68,
-	0x12, 0xe1, 0x05, 0x5c, 0x48, 0xa8, 0xe6, 0x7a, 0x2a, 0x7d, 0xe3, 0x88,
-	0x99, 0xd4, 0x9e, 0x42, 0xb7, 0x8c, 0xce, 0xb1, 0x96, 0xf1, 0x42, 0x12,
-	0xd2, 0x2c, 0x6c, 0x51, 0xaa, 0xac, 0x36, 0x9e, 0xab, 0x3c, 0xaf, 0xa8,
-	0x2d, 0x8a, 0xfb, 0xd9, 0xd1, 0x41, 0x62, 0x29, 0xa0, 0x04, 0x95, 0x41,
-	0x3a, 0x22, 0x6f, 0x9e, 0xac, 0x70, 0x89, 0x99, 0x9a, 0x3d, 0x35, 0xe7,
-	0x40, 0xc0, 0xf6, 0x4e, 0x11, 0x1c, 0x28, 0x1b, 0x28, 0xc4, 0x80, 0xc7,
-	0xae, 0x27, 0x28, 0xd6, 0x88, 0x5c, 0x18, 0xbd, 0x2c, 0x8b, 0x9c, 0x7b,
-	0xa2, 0x0b, 0x55, 0x56, 0x43, 0xff, 0xc8, 0xaa, 0x07, 0x6f, 0x01, 0x94,
-	0x54, 0x0a, 0x02, 0xff, 0xfb, 0x20, 0xc4, 0xc8, 0x00, 0x06, 0x30, 0x55,
-	0x39, 0x07, 0xb0, 0xc3, 0x00, 0xd5, 0x0f, 0xa8, 0xf4, 0xb3, 0x08, 0x74,
-	0x54, 0x32, 0x32, 0x14, 0x26, 0x01, 0xfd, 0x30, 0x9c, 0xd9, 0xa6, 0x43,
-	0xa1, 0xce, 0x1a, 0xe4, 0xb8, 0x3e, 0x10, 0x1e, 0x36, 0x60, 0x48, 0x80,
-	0x0a, 0x92, 0x0d, 0x15, 0x51, 0x16, 0x53, 0x1a, 0xab, 0x1f, 0xdc, 0x46,
-	0xde, 0xa7, 0xf5, 0x75, 0xfe, 0xd2, 0x76, 0x11, 0x22, 0xc2, 0x28, 0x3a,
-	0xd9, 0xa1, 0xa0, 0x18, 0x89, 0x8f, 0x99, 0xc8, 0x13, 0x44, 0xa2, 0x42,
-	0xc0, 0x39, 0xd2, 0x03, 0x42, 0x62, 0xb2, 0x47, 0xa1, 0xb1, 0xe1, 0x96,
-	0x1f, 0xf1, 0xe2, 0x34, 0x87, 0x1e, 0xb7, 0xaa, 0xf5, 0xa8, 0xc9, 0xdd,
-	0xc9, 0xa7, 0xd5, 0x1d, 0x00, 0x81, 0x24, 0x15, 0x45, 0xae, 0x9e, 0xba,
-	0xf7, 0x56, 0x18, 0x5f, 0xd8, 0xf3, 0x97, 0x9c, 0x31, 0xdb, 0xbf, 0xd9,
-	0x35, 0xff, 0xfb, 0x22, 0xc4, 0xcb, 0x00, 0x05, 0xe0, 0x3b, 0x34, 0xac,
-	0x30, 0x61, 0xc0, 0xcc, 0x8d, 0x66, 0x40, 0xf3, 0x0c, 0xa8, 0x96, 0x59,
-	0x3d, 0xb8, 0x2c, 0x88, 0xa9, 0x91, 0xd9, 0x10, 0x22, 0x9a, 0xff, 0x5b,
-	0x2a, 0x29, 0x62, 0xe2, 0xdd, 0x87, 0xc4, 0xaa, 0x08, 0x2c, 0x4f, 0xdb,
-	0xd0, 0xaf, 0x58, 0xba, 0x54, 0xb6, 0xdb, 0x65, 0x91, 0xb8, 0x92, 0x40,
-	0x2e, 0x12, 0x12, 0x83, 0x44, 0xa0, 0x48, 0xda, 0xb0, 0x32, 0xcb, 0x50,
-	0x2a, 0x1c, 0x91, 0x64, 0x92, 0xd6, 0x7a, 0x40, 0x8e, 0xb4, 0x52, 0x14,
-	0x2e, 0x1c, 0xa0, 0xc5, 0x84, 0x50, 0x0a, 0x40, 0xc3, 0xcc, 0x28, 0x9d,
-	0x9b, 0x27, 0x50, 0xc7, 0x73, 0x1a, 0x8a, 0xef, 0xc7, 0xc5, 0x1d, 0xa7,
-	0x7a, 0x3b, 0x44, 0x71, 0x06, 0xcc, 0x68, 0x4a, 0xdd, 0xa5, 0x07, 0x20,
-	0x46, 0xa2, 0x79, 0x58, 0x44, 0x2d, 0xa9, 0x82, 0x8c, 0x9a, 0x50, 0xd0,
-	0xff, 0xfb, 0x20, 0xc4, 0xd0, 0x80, 0x05, 0xa8, 0x37, 0x55, 0x84, 0x98,
-	0x07, 0x70, 0xc0, 0x84, 0xe6, 0x54, 0xf5, 0x98, 0x40, 0x17, 0x9a, 0x17,
-	0xe6, 0x24, 0xc8, 0xdb, 0xb2, 0x28, 0x67, 0x08, 0xa4, 0xe4, 0x75, 0x02,
-	0x14, 0x96, 0x22, 0x81, 0x12, 0xc2, 0x41, 0xeb, 0xd4, 0x0e, 0x70, 0x0f,
-	0xe5, 0xde, 0x9b, 0x35, 0x9f, 0x82, 0x08, 0xa0, 0x74, 0xa2, 0x57, 0xc0,
-	0xf3, 0x48, 0xb1, 0x5a, 0x7b, 0x91, 0x5b, 0x4b, 0x10, 0x40, 0x24, 0x88,
-	0x55, 0x99, 0x4c, 0x42, 0x9f, 0x39, 0x4e, 0x5f, 0xd0, 0xb8, 0x89, 0x3a,
-	0x1d, 0xdc, 0x4c, 0xd6, 0xed, 0x6c, 0x8f, 0x53, 0x0e, 0x0a, 0x0b, 0x5a,
-	0xfa, 0x0e, 0x3b, 0xec, 0xd4, 0xe3, 0x28, 0x1c, 0x9a, 0x2a, 0x02, 0x55,
-	0x41, 0x44, 0x18, 0x06, 0x50, 0x1e, 0xce, 0x01, 0xf0, 0x62, 0xf0, 0xb5,
-	0x6a, 0x68, 0x02, 0xa2, 0x0a, 0x1b, 0xd4, 0x96, 0x01, 0x44, 0xff, 0xfb,
-	0x22, 0xc4, 0xd8, 0x00, 0x05, 0xf0, 0x45, 0x39, 0x27, 0xa4, 0x61, 0xc0,
-	0xc2, 0x88, 0x66, 0xe4, 0xf3, 0x0c, 0x98, 0xb7, 0x05, 0x0b, 0x86, 0x41,
-	0x90, 0xf0, 0x74, 0x0f, 0x45, 0xa9, 0x83, 0x47, 0xac, 0x3c, 0x49, 0x65,
-	0x96, 0x61, 0x38, 0x0e, 0xc7, 0x23, 0xbb, 0x6b, 0xb5, 0xb7, 0x55, 0xcd,
-	0x48, 0xfc, 0xb2, 0x40, 0x69, 0x80, 0x43, 0x0d, 0xf1, 0x08, 0x7e, 0x5f,
-	0x44, 0x02, 0x0d, 0x6e, 0x6a, 0xcf, 0x1e, 0x40, 0x9e, 0x14, 0x44, 0x0c,
-	0x15, 0x81, 0x4a, 0x53, 0xf3, 0x55, 0xe5, 0x3d, 0x0d, 0x0a, 0xfb, 0xfe,
-	0x77, 0x0e, 0x2b, 0x20, 0x9f, 0x79, 0xb6, 0x71, 0x41, 0x9c, 0x43, 0x7a,
-	0xfb, 0xba, 0x08, 0x7e, 0x69, 0xef, 0x09, 0x69, 0x03, 0x8c, 0x7f, 0x01,
-	0xcd, 0x5a, 0x0a, 0x9b, 0x8f, 0xaa, 0xe2, 0xca, 0x30, 0xb0, 0xc2, 0x02,
-	0xd5, 0x83, 0x03, 0x0e, 0x3b, 0x98, 0xb3, 0xcd, 0x54, 0xff, 0xfb, 0x22,
-	0xc4, 0xde, 0x80, 0x06, 0x10, 0x29, 0x37, 0x27, 0xa4, 0xc0, 0x40, 0xb5,
-	0x85, 0xa6, 0x40, 0xf5, 0x98, 0x00, 0x68, 0x9e, 0x64, 0x99, 0xec, 0xc9,
-	0x16, 0xd6, 0x55, 0x10, 0x80, 0x98, 0xd7, 0xb3, 0x63, 0x0c, 0x21, 0x09,
-	0x6b, 0x13, 0xd8, 0x3e, 0xb5, 0xd6, 0xc1, 0xe1, 0xf9, 0x21, 0x7c, 0x47,
-	0xb8, 0xc0, 0x2b, 0xf4, 0x1a, 0x41, 0xdc, 0x07, 0xb3, 0x99, 0x5e, 0x68,
-	0x56, 0xce, 0xca, 0x91, 0xc8, 0x64, 0x84, 0xcc, 0x13, 0xa0, 0xa9, 0x13,
-	0x50, 0x9d, 0x12, 0xc1, 0xa0, 0x70, 0x10, 0x82, 0xcb, 0xc6, 0xc9, 0x0d,
-	0x17, 0x32, 0x05, 0x15, 0x09, 0xba, 0x96, 0x20, 0x75, 0x8f, 0x87, 0x55,
-	0x45, 0x59, 0x17, 0xd3, 0xec, 0x14, 0x00, 0xd1, 0xbd, 0x55, 0x0a, 0x6a,
-	0x03, 0x08, 0x08, 0x59, 0xa4, 0x87, 0xaa, 0x98, 0x96, 0xd5, 0xbf, 0x58,
-	0x1c, 0x04, 0x62, 0x79, 0x67, 0x9a, 0x4e, 0x2e, 0xff, 0xfb, 0x20, 0xc4,
-	0xe6, 0x80, 0x06, 0x88, 0xa9, 0x30, 0xa6, 0x04, 0x55, 0x00, 0xe1, 0x88,
-	0x6a, 0xb4, 0x93, 0x0c, 0xae, 0x29, 0x1a, 0x33, 0xc2, 0xcb, 0x27, 0x43,
-	0xf2, 0xb0, 0xaf, 0xcb, 0xd0, 0x8a, 0xc2, 0x8a, 0x42, 0xe8, 0xa2, 0x66,
-	0xd5, 0x93, 0x5b, 0xb0, 0x1e, 0x41, 0xf9, 0x3e, 0x39, 0x39, 0x64, 0x96,
-	0x49, 0xfe, 0xca, 0x05, 0x51, 0x68, 0xf8, 0xa8, 0x8a, 0x68, 0x41, 0x56,
-	0xe4, 0xd0, 0xb6, 0x38, 0x91, 0x15, 0xb3, 0x13, 0x49, 0x39, 0x42, 0x99,
-	0x57, 0x06, 0x31, 0x65, 0x4c, 0xfc, 0xae, 0xa9, 0x09, 0xcc, 0xcc, 0x9c,
-	0x3c, 0x50, 0xb3, 0xfa, 0xe4, 0xd5, 0x21, 0x43, 0x85, 0xd1, 0x55, 0x9e,
-	0xa5, 0xb5, 0xc3, 0xab, 0x27, 0x43, 0x6d, 0x26, 0xd7, 0x10, 0x84, 0x48,
-	0x07, 0x20, 0x73, 0x9c, 0x8d, 0x63, 0xea, 0x92, 0xd3, 0x89, 0x9b, 0x60,
-	0x20, 0xee, 0x8f, 0x34, 0xc2, 0x97, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80,
-	0x86, 0xc4, 0x6b, 0x30, 0x07, 0xa4, 0x65, 0x40, 0xd4, 0x8d, 0xa6, 0x14,
-	0xf4, 0x8c, 0x60, 0x76, 0x88, 0x00, 0x60, 0xc7, 0x83, 0xef, 0x62, 0x82,
-	0x64, 0x47, 0xd4, 0xf1, 0xc1, 0x51, 0xa3, 0x43, 0x48, 0xc9, 0xa4, 0x64,
-	0xb3, 0xe1, 0xa6, 0x81, 0x33, 0x7b, 0xb5, 0x59, 0xf4, 0x3d, 0xe9, 0x60,
-	0x64, 0xfb, 0x0a, 0x24, 0xc0, 0xa2, 0x05, 0x72, 0x4d, 0x72, 0x94, 0x83,
-	0x80, 0x8f, 0xc0, 0x06, 0x8f, 0x73, 0xe4, 0x11, 0x15, 0xc6, 0x78, 0x6c,
-	0xcb, 0x8e, 0x60, 0x50, 0xa1, 0xe9, 0x01, 0xb5, 0x38, 0x06, 0x40, 0x04,
-	0x9f, 0x3c, 0xd1, 0xeb, 0xaa, 0x22, 0x32, 0x63, 0x52, 0x5c, 0xf7, 0xec,
-	0xd2, 0xfc, 0x81, 0xb3, 0x75, 0x39, 0x2a, 0x12, 0x79, 0x74, 0x6d, 0xd8,
-	0x99, 0x45, 0x00, 0x2b, 0x16, 0x1c, 0x01, 0xd1, 0x2b, 0xc7, 0x36, 0x9d,
-	0x42, 0x2e, 0x99, 0xf1, 0x21, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x80, 0x07,
-	0x08, 0x2d, 0x33, 0x27, 0xb0, 0xc0, 0x40, 0xcb, 0x0d, 0x26, 0xa0, 0xf3,
-	0x0c, 0x68, 0xef, 0xd7, 0xd8, 0x6b, 0x5f, 0x6d, 0x81, 0x87, 0xca, 0xf0,
-	0xe3, 0x16, 0xcd, 0x40, 0xaf, 0x1b, 0x50, 0x82, 0x28, 0x28, 0x3b, 0xa8,
-	0x51, 0x62, 0x29, 0x27, 0x7c, 0xa1, 0xba, 0xad, 0x5b, 0x2e, 0xb9, 0x9a,
-	0x97, 0x0b, 0x8f, 0x7a, 0xc0, 0x41, 0x90, 0x40, 0x07, 0x40, 0xe3, 0x44,
-	0x05, 0x18, 0xbf, 0x25, 0x87, 0x28, 0x20, 0xd0, 0x86, 0xf3, 0xad, 0x08,
-	0x27, 0x47, 0x7b, 0x61, 0x19, 0xa2, 0x80, 0xc6, 0x63, 0x52, 0x46, 0x1f,
-	0x7f, 0x59, 0xe7, 0x75, 0xf5, 0x8f, 0x20, 0x0f, 0xdb, 0x73, 0x4b, 0x8a,
-	0x38, 0x94, 0x44, 0x85, 0xec, 0xb4, 0x17, 0x39, 0x4a, 0xd4, 0xfe, 0x5f,
-	0x51, 0x2d, 0x89, 0xe3, 0xd7, 0xae, 0x2e, 0x66, 0x58, 0x64, 0x42, 0x79,
-	0x52, 0x74, 0xb4, 0xff, 0xfb, 0x22, 0xc4, 0xe8, 0x80, 0x07, 0x54, 0x6b,
-	0x31, 0x0c, 0x30, 0x61, 0x40, 0xdf, 0x07, 0x66, 0x60, 0xf4, 0x8c, 0x70,
-	0x36, 0x87, 0x05, 0x16, 0x1d, 0x85, 0x61, 0xd3, 0x11, 0x3f, 0x09, 0x5a,
-	0x0f, 0x81, 0x86, 0x7f, 0x13, 0x32, 0x17, 0xa8, 0xc0, 0x67, 0x69, 0x95,
-	0xb6, 0xe8, 0x65, 0xe7, 0xe6, 0x9d, 0xbd, 0x16, 0xba, 0x61, 0xb1, 0x70,
-	0xe5, 0x87, 0x8f, 0x3d, 0xfb, 0x3d, 0x9a, 0xd9, 0x16, 0x5a, 0x7e, 0x8b,
-	0x9c, 0x46, 0x47, 0x4c, 0x27, 0xe4, 0x1b, 0x64, 0x88, 0xd0, 0x3a, 0x4b,
-	0xe9, 0xb6, 0xa8, 0x7e, 0xc7, 0x6b, 0xbc, 0xd4, 0xcc, 0x6e, 0xe1, 0xbf,
-	0x7e, 0x6e, 0x23, 0x29, 0xb7, 0x93, 0x47, 0x67, 0x52, 0x32, 0xab, 0xed,
-	0x62, 0x12, 0x03, 0x4b, 0x93, 0x5e, 0x5f, 0xb7, 0x28, 0x82, 0x16, 0x4d,
-	0xcc, 0x3e, 0x00, 0x62, 0x31, 0x0b, 0xed, 0x1d, 0x31, 0x41, 0x0c, 0xe0,
-	0x8c, 0x87, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0x38, 0x6b, 0x35,
-	0x07, 0x98, 0x65, 0x40, 0xe9, 0x0d, 0x29, 0xb0, 0xc4, 0x8c, 0xe6, 0x14,
-	0x9e, 0xc5, 0xc8, 0x67, 0x47, 0x7b, 0xad, 0xd4, 0x62, 0xec, 0x38, 0xf5,
-	0xbb, 0x7d, 0xd0, 0xb8, 0xc5, 0x1e, 0x9b, 0x64, 0xdd, 0x08, 0x99, 0x69,
-	0x31, 0x00, 0x7e, 0xc2, 0x00, 0x02, 0x21, 0xe1, 0xca, 0x9f, 0x14, 0x2c,
-	0x7a, 0xac, 0x34, 0x48, 0x5d, 0x06, 0xe7, 0x0d, 0x1f, 0x1a, 0x45, 0x25,
-	0x40, 0xe5, 0x89, 0x8c, 0xf5, 0x2a, 0xd0, 0x66, 0x94, 0xc9, 0x40, 0xf9,
-	0x6c, 0xa9, 0x78, 0x20, 0x32, 0x61, 0xac, 0x27, 0xba, 0x2a, 0x6c, 0x4c,
-	0x4a, 0x7c, 0xa2, 0xad, 0xae, 0xbc, 0xfb, 0x49, 0x87, 0x07, 0xa4, 0xc3,
-	0x39, 0xaa, 0x89, 0xeb, 0x14, 0x8b, 0xae, 0x06, 0xbb, 0x68, 0x5d, 0x90,
-	0xaa, 0xde, 0x77, 0xeb, 0xff, 0x9f, 0xf6, 0xa6, 0x10, 0x49, 0x00, 0x20,
-	0x00, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00, 0x06, 0xf4, 0x2f, 0x35, 0x27,
-	0xb0, 0xc0, 0x80, 0xdb, 0x08, 0x26, 0xa4, 0xf0, 0x18, 0x80, 0x00, 0x52,
-	0x80, 0x7d, 0x8e, 0xb6, 0x70, 0xa0, 0x8b, 0x12, 0xb1, 0x5a, 0xfc, 0xb8,
-	0xe0, 0x91, 0x18, 0xcd, 0xad, 0xe9, 0x10, 0x9d, 0x25, 0xc9, 0xd1, 0x59,
-	0x64, 0x63, 0x6b, 0x15, 0x81, 0x1c, 0xea, 0x94, 0x6b, 0x0e, 0xeb, 0x4d,
-	0x40, 0x5e, 0x58, 0x1e, 0x0a, 0x3e, 0x76, 0x41, 0xac, 0x79, 0xd7, 0x99,
-	0xaf, 0x0a, 0x99, 0xbc, 0xc6, 0xd3, 0x3f, 0x7f, 0x2a, 0x60, 0xb5, 0x4b,
-	0xd4, 0xae, 0x6e, 0xea, 0x94, 0x88, 0xb0, 0x20, 0xb9, 0x4a, 0xa2, 0xd7,
-	0x86, 0x67, 0x4a, 0x4c, 0x51, 0xf4, 0xb2, 0xc3, 0x83, 0x90, 0x59, 0x5a,
-	0x7f, 0x2e, 0x4c, 0xb7, 0x55, 0xd6, 0x53, 0x7c, 0xdb, 0xe7, 0xee, 0xc7,
-	0xfa, 0x36, 0x6b, 0xf1, 0x19, 0x90, 0x6b, 0x2c, 0xc3, 0x9a, 0x03, 0xff,
-	0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x07, 0x88, 0x55, 0x41, 0xa6, 0x04, 0x50,
-	0x20, 0xfe, 0x0d, 0x26, 0xa0, 0xf3, 0x09, 0xa8, 0x39, 0x6f, 0x3a, 0x89,
-	0xe7, 0xba, 0xeb, 0x6d, 0xb6, 0xb8, 0xc0, 0x09, 0x87, 0x40, 0xf0, 0x25,
-	0x0d, 0xe5, 0xb0, 0x18, 0xa9, 0xa3, 0xed, 0xb0, 0x89, 0x08, 0xe3, 0xa4,
-	0xc2, 0x94, 0x9c, 0x98, 0xfd, 0x1b, 0x01, 0x51, 0x34, 0x45, 0x68, 0x34,
-	0xf1, 0x10, 0x3a, 0x20, 0x12, 0x81, 0x45, 0x9e, 0x77, 0xed, 0x7d, 0xf6,
-	0x02, 0x9a, 0x45, 0x9a, 0xd2, 0x48, 0xfd, 0x6a, 0x4d, 0xd9, 0x2d, 0x96,
-	0x56, 0x51, 0x02, 0x61, 0x72, 0x24, 0x23, 0xb1, 0x52, 0xe0, 0x81, 0x33,
-	0x41, 0xcf, 0xe7, 0xaf, 0x53, 0x2e, 0x93, 0x0f, 0x84, 0x01, 0xa5, 0x24,
-	0x5b, 0xda, 0x3c, 0x40, 0xa2, 0xae, 0x77, 0xd6, 0xf7, 0x26, 0x4d, 0x17,
-	0xe5, 0xe6, 0xe4, 0xff, 0xf4, 0x6b, 0x52, 0x5c, 0xf6, 0x24, 0xff, 0xfb,
-	0x22, 0xc4, 0xdf, 0x03, 0xc6, 0xfc, 0x75, 0x34, 0x0c, 0x30, 0x67, 0x01,
-	0x63, 0x9b, 0x27, 0x80, 0xf3, 0x22, 0xd0, 0xb4, 0xbb, 0xbc, 0xb3, 0x25,
-	0xd6, 0xcb, 0x20, 0x11, 0x09, 0x83, 0x01, 0xf0, 0x58, 0x96, 0x83, 0xc8,
-	0x30, 0x00, 0x0d, 0x20, 0x22, 0x99, 0x67, 0x30, 0xa4, 0xbb, 0xce, 0x29,
-	0x15, 0xd4, 0x28, 0x33, 0x4b, 0x48, 0x9b, 0x7d, 0x66, 0x4f, 0x3b, 0x57,
-	0x5b, 0x9e, 0x3f, 0x6f, 0xee, 0x1e, 0x8d, 0xd3, 0x3f, 0x66, 0x2d, 0x11,
-	0x96, 0x10, 0x04, 0x5e, 0x41, 0xc9, 0x8c, 0x3b, 0x4c, 0x8b, 0x32, 0x92,
-	0x48, 0x52, 0x93, 0x21, 0x92, 0x24, 0x26, 0x21, 0x00, 0x96, 0x66, 0xcb,
-	0x62, 0x43, 0x4d, 0x9d, 0x03, 0x95, 0xc4, 0xa6, 0x6b, 0x28, 0x0a, 0x03,
-	0x33, 0x2b, 0x73, 0x63, 0x32, 0x65, 0xc2, 0xb2, 0xa6, 0xfd, 0xff, 0xd1,
-	0xfa, 0x00, 0xf5, 0x94, 0x60, 0x24, 0x02, 0x85, 0x04, 0xff, 0xfb, 0x20,
-	0xc4, 0xcd, 0x80, 0x09, 0xf0, 0x9d, 0x42, 0xa7, 0xb1, 0x05, 0x88, 0xfc,
-	0x8c, 0xe7, 0xa4, 0xf3, 0x0d, 0x90, 0xae, 0x43, 0x8c, 0xd7, 0xaa, 0x38,
-	0x18, 0xf9, 0x1c, 0x1f, 0x49, 0xc2, 0xe4, 0xc2, 0x1e, 0x08, 0xd6, 0x4e,
-	0x74, 0x60, 0x3d, 0xec, 0x24, 0x1f, 0x38, 0x83, 0x84, 0xed, 0x29, 0xd6,
-	0xa4, 0x09, 0x09, 0xf5, 0x00, 0x10, 0x89, 0x84, 0xa8, 0x52, 0xcb, 0x7e,
-	0xe5, 0x2d, 0xdb, 0x66, 0x6d, 0x46, 0x58, 0x05, 0x00, 0x06, 0x31, 0xe1,
-	0x61, 0xae, 0x36, 0xe6, 0x95, 0x44, 0x5d, 0xca, 0xa0, 0x34, 0xd1, 0x59,
-	0x1d, 0x08, 0x03, 0xc2, 0xcb, 0x2a, 0x91, 0x41, 0xce, 0xaa, 0xd5, 0xa1,
-	0x0d, 0x52, 0xce, 0x97, 0x45, 0xb2, 0xea, 0x6b, 0x2b, 0x77, 0xf6, 0xeb,
-	0x6e, 0xfb, 0xd5, 0xb2, 0xa2, 0x5a, 0x91, 0x01, 0x80, 0x93, 0x8f, 0x42,
-	0x05, 0x26, 0x70, 0x5c, 0x7e, 0x8a, 0x2a, 0xff, 0xfb, 0x22, 0xc4, 0xbc,
-	0x80, 0x06, 0x70, 0x69, 0x36, 0x0c, 0x30, 0xc4, 0xc0, 0xdf, 0x88, 0xec,
-	0xb4, 0xc4, 0x8c, 0xa6, 0x40, 0x81, 0x40, 0xa5, 0x3d, 0xe9, 0x04, 0x6e,
-	0x57, 0x2c, 0xf0, 0x50, 0xf0, 0xe3, 0x8c, 0xa0, 0x54, 0xbb, 0x12, 0x24,
-	0x3e, 0xf5, 0xbf, 0x76, 0x92, 0x43, 0xcb, 0x54, 0x79, 0x3c, 0x6b, 0x14,
-	0xd7, 0xd7, 0xfa, 0x3a, 0xd5, 0x4d, 0xcb, 0x65, 0xb2, 0x46, 0x91, 0x40,
-	0x80, 0x2c, 0x23, 0x3a, 0x19, 0x1f, 0xda, 0xd2, 0xc2, 0x21, 0xf2, 0xaf,
-	0xb7, 0xa4, 0xa2, 0x84, 0x24, 0x70, 0x95, 0x88, 0x69, 0x08, 0x6a, 0x07,
-	0x99, 0x46, 0xc3, 0xe6, 0x09, 0xbe, 0xf3, 0x1a, 0x3e, 0x6d, 0xe9, 0xbb,
-	0xb7, 0x38, 0xef, 0xff, 0xfa, 0x1d, 0xdb, 0xed, 0xf6, 0xd6, 0x38, 0xdb,
-	0x00, 0x1a, 0x13, 0x11, 0x18, 0x07, 0xcb, 0x33, 0xab, 0xaa, 0x63, 0x0c,
-	0xb2, 0xe6, 0x51, 0xd0, 0x84, 0x95, 0xff, 0xfb, 0x20, 0xc4, 0xbd, 0x80,
-	0x06, 0x24, 0x2d, 0x57, 0x84, 0xa4, 0xc0, 0x70, 0xd3, 0x08, 0x29, 0xfc,
-	0xf3, 0x0c, 0xac, 0xc8, 0x74, 0x18, 0xcb, 0x67, 0xd2, 0x06, 0x50, 0x15,
-	0x39, 0x42, 0xdd, 0x72, 0x71, 0x5f, 0x53, 0xfa, 0x6a, 0x7d, 0x35, 0x70,
-	0xa2, 0xee, 0xf4, 0x9b, 0x12, 0xa5, 0x01, 0x48, 0x16, 0xd0, 0x25, 0x14,
-	0x8a, 0xc5, 0x14, 0x41, 0x14, 0x91, 0x3a, 0x0c, 0x16, 0x42, 0x6e, 0xe4,
-	0xf4, 0xb2, 0x95, 0x15, 0x4e, 0x9c, 0x91, 0xdb, 0xfb, 0xce, 0x58, 0xff,
-	0xab, 0x62, 0x0d, 0x4f, 0xdf, 0x8c, 0x33, 0x05, 0xac, 0x89, 0x5f, 0xd5,
-	0xaa, 0xe5, 0x6d, 0x40, 0xde, 0xd8, 0x0c, 0x08, 0x20, 0x0f, 0xa1, 0x39,
-	0x61, 0x49, 0x36, 0xc8, 0x89, 0x11, 0x14, 0xd2, 0x30, 0x43, 0x25, 0x66,
-	0x90, 0x3c, 0xfe, 0xc1, 0x70, 0x30, 0x48, 0x11, 0x44, 0x70, 0xb3, 0x08,
-	0x13, 0x97, 0x13, 0x85, 0xff, 0xfb, 0x22, 0xc4, 0xc1, 0x00, 0x06, 0x48,
-	0x35, 0x35, 0x0c, 0x24, 0xc4, 0xc0, 0xc9, 0x08, 0x26, 0xe4, 0xf3, 0x0c,
-	0xa8, 0xd1, 0x72, 0x71, 0x65, 0xa0, 0x3d, 0x42, 0xb7, 0x7f, 0xff, 0xf7,
-	0x45, 0x55, 0x32, 0xdb, 0x6d, 0x8e, 0x36, 0xe2, 0x04, 0x00, 0x99, 0xa1,
-	0x13, 0x40, 0xc0, 0x30, 0xc4, 0x96, 0x62, 0x04, 0x48, 0x91, 0x41, 0x8d,
-	0xa5, 0x1d, 0x4c, 0xfa, 0x91, 0x1a, 0x25, 0xcb, 0xe9, 0xd5, 0x8a, 0xba,
-	0x6a, 0xdd, 0x50, 0x78, 0x67, 0xb4, 0x68, 0x3f, 0xa0, 0x5b, 0xfd, 0x1f,
-	0xa4, 0x2f, 0x0e, 0xc5, 0x7a, 0x1e, 0x9f, 0x73, 0xe6, 0x27, 0x47, 0x26,
-	0x39, 0x0b, 0xef, 0x68, 0x03, 0xb4, 0xb6, 0xcf, 0x2b, 0x83, 0x72, 0x85,
-	0x1d, 0x59, 0x43, 0xf0, 0x18, 0x2e, 0x11, 0x68, 0x30, 0x63, 0xde, 0x6b,
-	0x6c, 0x50, 0xcb, 0xb9, 0xcc, 0xd7, 0xfa, 0x7d, 0x4a, 0x05, 0x6a, 0x01,
-	0x04, 0x0d, 0x20, 0xff, 0xfb, 0x22, 0xc4, 0xc5, 0x80, 0x06, 0x70, 0x29,
-	0x41, 0xa4, 0x19, 0x20, 0x20, 0xcb, 0x06, 0x66, 0xa0, 0xf3, 0x18, 0x98,
-	0x74, 0x19, 0x2c, 0xe7, 0x54, 0x04, 0xd0, 0x44, 0xb0, 0x43, 0x02, 0x08,
-	0x0f, 0xa2, 0x25, 0x9c, 0x56, 0x76, 0x23, 0xab, 0x62, 0xd1, 0x2f, 0x36,
-	0x6e, 0x78, 0x4a, 0x72, 0xe2, 0x81, 0x81, 0xe2, 0xf6, 0xe5, 0x10, 0x40,
-	0x4e, 0x4d, 0xdf, 0xdb, 0xd3, 0xaf, 0xf4, 0x29, 0x35, 0xd6, 0xeb, 0x24,
-	0x71, 0xb4, 0x00, 0x2a, 0x27, 0xe7, 0x81, 0xb6, 0x57, 0x3d, 0xf1, 0xb8,
-	0x2e, 0xae, 0x5d, 0xf0, 0x18, 0x9f, 0x0a, 0x85, 0x43, 0xb6, 0x61, 0xb3,
-	0x59, 0x27, 0x5e, 0x99, 0x13, 0x2e, 0x4d, 0x2a, 0x30, 0x18, 0x25, 0xcb,
-	0x1b, 0x7e, 0xd0, 0x16, 0xde, 0xba, 0x06, 0x96, 0x03, 0x10, 0x27, 0x82,
-	0xdc, 0xf4, 0xe8, 0x01, 0xd2, 0x29, 0xc1, 0x08, 0x4c, 0x09, 0x12, 0xe8,
-	0xf6, 0x31, 0xff, 0xfb, 0x20, 0xc4, 0xc9, 0x00, 0x06, 0x08, 0x49, 0x51,
-	0xa4, 0x8d, 0x10, 0x70, 0xc7, 0x08, 0x2b, 0xf4, 0x94, 0xa0, 0xe6, 0x56,
-	0x41, 0x86, 0x82, 0x6d, 0x38, 0xe5, 0x93, 0x2a, 0x90, 0x4f, 0x2c, 0x03,
-	0x22, 0xa7, 0x57, 0x42, 0x9e, 0x4c, 0x6b, 0xd4, 0x2e, 0x4d, 0x77, 0x29,
-	0x3f, 0xfd, 0x02, 0x2a, 0xca, 0x00, 0x80, 0x92, 0x8d, 0xb6, 0x50, 0xaa,
-	0x0c, 0xea, 0x16, 0xde, 0xb1, 0x47, 0x74, 0x58, 0xa3, 0x49, 0xa0, 0x6c,
-	0x01, 0x8c, 0xf4, 0x21, 0x84, 0x98, 0x01, 0x20, 0x0c, 0x91, 0x7e, 0x49,
-	0x32, 0x24, 0xf2, 0xc9, 0xde, 0xf6, 0xbe, 0x79, 0x17, 0x7c, 0x1a, 0x62,
-	0x53, 0x62, 0xab, 0x9b, 0xa6, 0x2a, 0x74, 0xef, 0xdc, 0xa7, 0x6c, 0x61,
-	0x6e, 0xea, 0x0f, 0x9f, 0xe1, 0x95, 0x68, 0x08, 0x60, 0xfb, 0x38, 0x0e,
-	0x1b, 0x0b, 0x27, 0x2d, 0x46, 0x92, 0xc1, 0x22, 0xe7, 0xa1, 0xd7, 0x36,
-	0xff, 0xfb, 0x22, 0xc4, 0xce, 0x80, 0x05, 0xf4, 0x69, 0x35, 0x07, 0x98,
-	0x65, 0x40, 0xc2, 0x85, 0x66, 0xa4, 0xf4, 0x98, 0x48, 0x19, 0x54, 0xe3,
-	0x98, 0xee, 0xc8, 0xa7, 0x74, 0x3d, 0xcb, 0xb6, 0x8b, 0x6f, 0x94, 0x48,
-	0x34, 0x81, 0x6a, 0x57, 0x59, 0xe8, 0xbc, 0xcd, 0x6e, 0x3d, 0xd9, 0x91,
-	0xff, 0xb3, 0xc9, 0x0d, 0x6d, 0xb2, 0xb8, 0xbd, 0x50, 0x40, 0x0f, 0x01,
-	0xa2, 0x70, 0x3c, 0xa5, 0x6a, 0xc4, 0x8a, 0xa1, 0x2a, 0xb4, 0x00, 0xc2,
-	0x75, 0x84, 0x93, 0x33, 0x0f, 0xb5, 0x74, 0x0c, 0x87, 0x92, 0x30, 0xa0,
-	0x6c, 0x36, 0x16, 0x23, 0x59, 0x70, 0x22, 0x14, 0xe7, 0x21, 0xd4, 0xa2,
-	0xcd, 0x48, 0xf5, 0xf4, 0xe7, 0xd3, 0x7e, 0xb9, 0x94, 0xd5, 0x2f, 0xba,
-	0x22, 0x95, 0x84, 0x00, 0xaa, 0x05, 0x06, 0x04, 0xba, 0x05, 0x85, 0x1b,
-	0x4a, 0x48, 0xee, 0x1b, 0x3a, 0xea, 0x73, 0xd8, 0x48, 0x0f, 0xb4, 0xff,
-	0xfb, 0x20, 0xc4, 0xd5, 0x00, 0x05, 0xd8, 0x77, 0x55, 0xa4, 0x98, 0x43,
-	0xb0, 0xae, 0x87, 0xa6, 0x40, 0xf3, 0x0c, 0xa8, 0xc5, 0x9d, 0x94, 0x98,
-	0xdb, 0x6c, 0xba, 0x99, 0x27, 0x0a, 0x1c, 0x32, 0x46, 0x44, 0x99, 0x76,
-	0xf6, 0x05, 0x17, 0x97, 0xb8, 0xb3, 0x2e, 0x0a, 0xc9, 0xb5, 0xc2, 0x8e,
-	0xfe, 0xbf, 0x55, 0xc8, 0x76, 0xdd, 0x65, 0x92, 0x48, 0xe2, 0x49, 0x00,
-	0x54, 0x3f, 0x49, 0xa5, 0xcc, 0x24, 0x49, 0xb7, 0xa0, 0x01, 0x0c, 0x21,
-	0x45, 0x37, 0x69, 0x85, 0x04, 0x6e, 0x51, 0x65, 0x29, 0x50, 0x6b, 0x94,
-	0x68, 0x48, 0x78, 0x36, 0xb7, 0x08, 0x84, 0xa5, 0x04, 0x83, 0x1f, 0x14,
-	0x60, 0xd5, 0x20, 0x8b, 0x2a, 0xfb, 0xf3, 0x0d, 0x61, 0x14, 0x5b, 0xd8,
-	0xdf, 0xad, 0x11, 0x86, 0x00, 0x50, 0x2d, 0xe2, 0x8c, 0x4c, 0x20, 0x03,
-	0x6f, 0x0f, 0x66, 0x35, 0x74, 0x0b, 0xbd, 0xad, 0x3c, 0xff, 0xfb, 0x22,
-	0xc4, 0xde, 0x00, 0x06, 0x24, 0x41, 0x31, 0x07, 0x98, 0x65, 0x40, 0xb9,
-	0x88, 0x2b, 0x74, 0x90, 0x8a, 0x0e, 0x9e, 0x86, 0x1e, 0x64, 0x0e, 0x48,
-	0x2a, 0x83, 0x3a, 0xb7, 0x14, 0x01, 0xbd, 0x0d, 0x26, 0x6e, 0xc6, 0xdc,
-	0x71, 0x58, 0x7c, 0x10, 0xeb, 0x6f, 0xfe, 0xa0, 0x66, 0x96, 0x30, 0x40,
-	0x86, 0x80, 0x88, 0xda, 0x76, 0x39, 0xa5, 0x81, 0x09, 0x91, 0x3d, 0x13,
-	0xc3, 0x92, 0x25, 0x95, 0x01, 0xea, 0x53, 0xe8, 0xa7, 0xa7, 0x28, 0x55,
-	0x5a, 0x0f, 0xbc, 0x32, 0xc2, 0xf0, 0xca, 0x9b, 0xcc, 0x08, 0x7c, 0x1a,
-	0x7f, 0x15, 0x28, 0xe3, 0x81, 0xd6, 0x42, 0x76, 0x6d, 0x06, 0xa6, 0x9b,
-	0x19, 0x5d, 0x4b, 0x53, 0xc3, 0x22, 0x46, 0x0d, 0x5e, 0x95, 0x05, 0xba,
-	0x96, 0x94, 0x64, 0x01, 0xc4, 0x0c, 0x58, 0x00, 0x80, 0x50, 0x53, 0x2e,
-	0x66, 0x24, 0x0b, 0x8a, 0x07, 0x8c, 0xe2, 0xcb, 0xff, 0xfb, 0x22, 0xc4,
-	0xe5, 0x00, 0x05, 0xec, 0x2b, 0x35, 0x07, 0x98, 0xc2, 0x00, 0xec, 0x91,
-	0x25, 0xe1, 0x84, 0x8c, 0xa0, 0x12, 0x04, 0xd0, 0xa8, 0x2a, 0xda, 0x6a,
-	0x08, 0x58, 0x9a, 0x24, 0x74, 0x70, 0xe5, 0xe6, 0xa2, 0x8c, 0x4e, 0x6a,
-	0x6c, 0x1c, 0x04, 0x6e, 0x70, 0x52, 0xaa, 0x9a, 0x2c, 0x74, 0x76, 0x12,
-	0x39, 0xd7, 0x79, 0x73, 0x6e, 0x35, 0x6a, 0x92, 0x03, 0x77, 0xd6, 0x0d,
-	0x2c, 0x02, 0x08, 0x2c, 0xe0, 0xae, 0x01, 0x99, 0x04, 0x58, 0x44, 0x8f,
-	0xc1, 0x22, 0x45, 0x48, 0xd1, 0x86, 0x94, 0x22, 0x57, 0x32, 0xd8, 0xcc,
-	0xdc, 0xe0, 0xe7, 0x5f, 0x90, 0xf2, 0x3a, 0x45, 0xe9, 0x05, 0x98, 0x60,
-	0x70, 0x7d, 0x1d, 0x54, 0x20, 0x53, 0x61, 0xc6, 0xa6, 0xa7, 0x37, 0xff,
-	0x67, 0xb0, 0x9a, 0x11, 0x66, 0x00, 0x58, 0x3c, 0x02, 0x40, 0x27, 0x13,
-	0x8e, 0x1b, 0xb2, 0x78, 0x48, 0x20, 0x90, 0xff, 0xfb, 0x20, 0xc4, 0xe6,
-	0x80, 0x06, 0x84, 0x69, 0x37, 0x27, 0xa4, 0x41, 0xc0, 0xdb, 0x06, 0xe7,
-	0xb0, 0xc3, 0x01, 0x5c, 0x52, 0x41, 0xe9, 0xa0, 0x18, 0x92, 0xf1, 0xea,
-	0x1e, 0xa3, 0x11, 0xc3, 0xcd, 0x04, 0xe5, 0x8b, 0x3c, 0xf2, 0x54, 0x05,
-	0x3a, 0x5c, 0x59, 0xaf, 0x43, 0x54, 0x44, 0x06, 0x46, 0xf8, 0xaf, 0x73,
-	0x5f, 0x93, 0xa3, 0x6a, 0x74, 0x3b, 0xa4, 0x37, 0x1c, 0xb1, 0x22, 0xd6,
-	0x20, 0x00, 0x98, 0x42, 0x52, 0x23, 0x3b, 0x19, 0x21, 0xab, 0xc2, 0xc3,
-	0xe5, 0x02, 0xd1, 0x17, 0xd5, 0x0a, 0x46, 0xb5, 0xb3, 0x9b, 0x3b, 0x08,
-	0x36, 0xdb, 0xd8, 0xcf, 0x6b, 0x11, 0xea, 0x19, 0x6b, 0x0c, 0x15, 0xa6,
-	0x80, 0xf1, 0x5d, 0x97, 0xc5, 0x26, 0xb4, 0xba, 0xca, 0xe6, 0x51, 0x39,
-	0x26, 0xa7, 0x53, 0x14, 0x5e, 0xa2, 0xc7, 0x73, 0x86, 0x19, 0x36, 0x69,
-	0x64, 0x42, 0xc9, 0x93, 0x26, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80, 0x07,
-	0x20, 0x8b, 0x33, 0x27, 0x8c, 0x4d, 0x80, 0xe7, 0x08, 0x2a, 0xb4, 0xf4,
-	0x8c, 0x9e, 0x78, 0x27, 0x40, 0xc4, 0x14, 0x63, 0xfc, 0x2d, 0x8f, 0xb7,
-	0x9e, 0x51, 0x47, 0x9a, 0xa4, 0xfe, 0x82, 0xee, 0x0f, 0xbe, 0x5d, 0x0b,
-	0x6a, 0x88, 0x58, 0xfa, 0x69, 0xd9, 0x5f, 0xfa, 0x2f, 0xba, 0x26, 0x61,
-	0x71, 0x9a, 0xb5, 0x12, 0xc1, 0xc5, 0x8c, 0x4d, 0x21, 0x0a, 0xc5, 0xb2,
-	0xec, 0x88, 0x4d, 0x29, 0x51, 0x6b, 0x5a, 0xa5, 0x45, 0x24, 0xc1, 0xf3,
-	0x6e, 0x00, 0x8b, 0xa1, 0x22, 0xc5, 0x40, 0x41, 0x4a, 0xdc, 0x22, 0x1c,
-	0x70, 0x14, 0xb0, 0xc5, 0x6f, 0xa9, 0x8f, 0x48, 0x59, 0xf6, 0xd0, 0x75,
-	0xe9, 0x66, 0xca, 0x34, 0x2a, 0x04, 0xb9, 0x2c, 0x48, 0x34, 0xcf, 0x81,
-	0x29, 0x2b, 0x14, 0x08, 0x85, 0x07, 0x7d, 0x63, 0x09, 0x92, 0xa4, 0x09,
-	0x4a, 0xc5, 0x9a, 0xb4, 0xff, 0xfb, 0x20, 0xc4, 0xe5, 0x00, 0x05, 0x90,
-	0x2b, 0x35, 0x07, 0xa4, 0xc0, 0x40, 0xf8, 0x0d, 0x25, 0xe0, 0xf3, 0x0c,
-	0xb0, 0xc9, 0xf9, 0xc3, 0xf4, 0x35, 0x48, 0x4d, 0x3e, 0x2c, 0x3c, 0xcb,
-	0xfa, 0x59, 0x7c, 0x5c, 0x50, 0x90, 0xc9, 0x28, 0xd6, 0x16, 0x62, 0xc5,
-	0x40, 0x62, 0x84, 0x85, 0xe9, 0x6f, 0xab, 0x65, 0xea, 0xb1, 0xc3, 0x10,
-	0xfb, 0xac, 0xa9, 0x28, 0x4a, 0x4b, 0x24, 0x6d, 0xf5, 0x08, 0x00, 0x9c,
-	0x73, 0xa4, 0x80, 0x29, 0x88, 0x28, 0x36, 0x20, 0x5c, 0x78, 0x3b, 0x85,
-	0xce, 0x61, 0xe5, 0x9b, 0x3e, 0x60, 0x51, 0xe0, 0xb3, 0xc0, 0x2c, 0x64,
-	0x4e, 0xf6, 0x92, 0x51, 0xe6, 0x86, 0x5e, 0xec, 0x53, 0x65, 0x34, 0x3b,
-	0xad, 0xb4, 0x5b, 0xf5, 0x55, 0x49, 0x36, 0xe4, 0x2c, 0xf0, 0x95, 0x82,
-	0xb0, 0x64, 0x88, 0x50, 0x3c, 0x59, 0x85, 0xe9, 0xc2, 0xd0, 0x91, 0xa1,
-	0x25, 0x40, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x07, 0xfc, 0x67, 0x33,
-	0x27, 0xa4, 0x61, 0xc0, 0xcf, 0x0d, 0x26, 0x60, 0xf4, 0x8c, 0x28, 0x19,
-	0xa2, 0x63, 0xe6, 0x66, 0x57, 0xcc, 0x94, 0x2d, 0x56, 0xe5, 0xec, 0x4a,
-	0xa2, 0xce, 0x8b, 0x82, 0xad, 0x58, 0x6f, 0xf1, 0xca, 0xb6, 0x1a, 0x37,
-	0x47, 0xce, 0x96, 0xe6, 0x19, 0x75, 0x53, 0xb5, 0x2d, 0x72, 0xcb, 0xad,
-	0xb2, 0xc9, 0x24, 0x4c, 0x00, 0x32, 0x49, 0x0b, 0xe2, 0x1e, 0x8d, 0xd5,
-	0xee, 0xa6, 0x48, 0x3d, 0x26, 0x08, 0x6e, 0x93, 0xf2, 0x9c, 0x56, 0x1c,
-	0x79, 0x44, 0xec, 0x74, 0x93, 0x97, 0xe9, 0x5e, 0x35, 0xb2, 0xca, 0xa0,
-	0x82, 0x82, 0x0c, 0x83, 0x42, 0x3d, 0x22, 0xc7, 0xc7, 0x6c, 0x90, 0x2f,
-	0xce, 0xb9, 0x2a, 0x26, 0xae, 0x53, 0x84, 0x94, 0x03, 0x60, 0x9e, 0xa1,
-	0x24, 0x1c, 0x10, 0xc4, 0xaf, 0xbd, 0x45, 0x14, 0xa2, 0x63, 0x47, 0x34,
-	0x41, 0xff, 0xfb, 0x22, 0xc4, 0xe3, 0x00, 0x06, 0xd8, 0x41, 0x31, 0x07,
-	0xa4, 0xc0, 0x40, 0xd4, 0x8e, 0xa7, 0xb0, 0xc3, 0x09, 0x8c, 0x92, 0x4a,
-	0x96, 0xee, 0x04, 0x22, 0x4a, 0xbe, 0xe7, 0x72, 0x15, 0xe0, 0x13, 0x68,
-	0x22, 0x7a, 0x2f, 0x46, 0x6a, 0xf8, 0xf6, 0x54, 0x5a, 0xc2, 0xb6, 0xfa,
-	0xe9, 0xd2, 0xdd, 0x04, 0xc8, 0x00, 0x64, 0xc3, 0x5b, 0xd0, 0x7d, 0x6a,
-	0x99, 0xaa, 0x88, 0x19, 0xd3, 0x46, 0x58, 0x72, 0xe0, 0xa8, 0x64, 0xc6,
-	0xae, 0xe2, 0x6b, 0x29, 0x4b, 0x5b, 0xd8, 0xd2, 0xe5, 0x9b, 0x36, 0x3b,
-	0x08, 0x06, 0x61, 0x66, 0xad, 0x8c, 0x38, 0x35, 0xe7, 0x4c, 0x2c, 0x3a,
-	0x5a, 0xa9, 0x67, 0xd7, 0x4e, 0x4b, 0x5a, 0x18, 0x41, 0xb1, 0x9b, 0x6a,
-	0x4e, 0x49, 0x65, 0x91, 0xb8, 0xd9, 0x20, 0x80, 0x72, 0x5e, 0x2b, 0x95,
-	0x41, 0x73, 0x77, 0xbe, 0x3f, 0x58, 0x24, 0xf8, 0x2c, 0x75, 0xd9, 0x88,
-	0xff, 0xfb, 0x20, 0xc4, 0xe4, 0x00, 0x46, 0x70, 0x45, 0x33, 0x0c, 0x24,
-	0xc0, 0x40, 0xce, 0x85, 0x26, 0x61, 0x86, 0x24, 0x08, 0xda, 0xb4, 0x72,
-	0xef, 0xb0, 0x01, 0xe5, 0x94, 0x98, 0x40, 0x33, 0xcf, 0x47, 0x96, 0x03,
-	0xc9, 0x66, 0x3c, 0x3c, 0x7d, 0xf6, 0x1a, 0x32, 0xf3, 0xb6, 0xb7, 0xff,
-	0xfe, 0xc3, 0xad, 0x6a, 0x92, 0x12, 0x71, 0xb8, 0x99, 0x65, 0x6b, 0x02,
-	0x10, 0x05, 0x13, 0xce, 0x07, 0x05, 0xe9, 0x42, 0x00, 0x12, 0x91, 0x04,
-	0xc4, 0xce, 0x9a, 0x92, 0x8e, 0xc2, 0xd2, 0x1c, 0x04, 0x65, 0xcf, 0xa1,
-	0xc9, 0x70, 0x68, 0xc1, 0x81, 0x97, 0x21, 0x2e, 0xdc, 0x2a, 0xd4, 0x94,
-	0x47, 0x81, 0x55, 0x66, 0xdd, 0x69, 0x6b, 0xb5, 0x3c, 0x89, 0x2a, 0x6a,
-	0x05, 0x96, 0xdc, 0x88, 0x79, 0x31, 0x04, 0x71, 0x13, 0x57, 0x97, 0x47,
-	0xe8, 0xcc, 0xa9, 0xe5, 0x20, 0xb2, 0x57, 0x2a, 0xc6, 0x85, 0xff, 0xfb,
-	0x22, 0xc4, 0xe6, 0x80, 0x07, 0xc0, 0x6b, 0x39, 0x87, 0xb0, 0x65, 0x40,
-	0xc0, 0x85, 0x29, 0x70, 0xc4, 0x98, 0x96, 0x84, 0x2e, 0x54, 0x11, 0x2e,
-	0x46, 0x1d, 0x55, 0x87, 0x80, 0xa0, 0xa9, 0x71, 0x19, 0xc6, 0xa5, 0x41,
-	0x34, 0x20, 0x89, 0x7a, 0x2b, 0x27, 0x04, 0xef, 0x36, 0x83, 0xa7, 0x1f,
-	0xa2, 0xef, 0xfd, 0x17, 0x21, 0x88, 0x1f, 0x90, 0x00, 0x15, 0x06, 0x43,
-	0xf8, 0x78, 0x45, 0xf2, 0x2b, 0x0d, 0x08, 0x0b, 0x1e, 0xe5, 0x9a, 0x61,
-	0x80, 0x0a, 0x40, 0x3f, 0x4a, 0x18, 0xf1, 0x45, 0xad, 0x2f, 0xfd, 0xd0,
-	0x88, 0x88, 0x5c, 0x21, 0x14, 0x0e, 0x00, 0xc3, 0x86, 0xee, 0x99, 0x36,
-	0x10, 0x08, 0x29, 0x0c, 0x24, 0x6c, 0x6d, 0x8c, 0x19, 0x9f, 0xa2, 0x4d,
-	0x49, 0x1c, 0x64, 0x30, 0x5f, 0x80, 0xa0, 0x79, 0x1f, 0x0b, 0xe6, 0x0d,
-	0x1f, 0x7a, 0x24, 0x44, 0x73, 0x1c, 0x8f, 0x7e, 0xeb, 0xff, 0xfb, 0x22,
-	0xc4, 0xe6, 0x00, 0x06, 0xec, 0x4b, 0x37, 0x86, 0x3c, 0xc2, 0x00, 0xd4,
-	0x0d, 0xea, 0xb4, 0xf3, 0x0d, 0x26, 0x2a, 0xef, 0x88, 0x57, 0xb9, 0x90,
-	0x52, 0x69, 0xcd, 0x86, 0x10, 0x28, 0xf2, 0x61, 0xc9, 0x2f, 0x50, 0x74,
-	0x68, 0x01, 0xcd, 0x69, 0x45, 0xb5, 0x35, 0x3a, 0x3a, 0xef, 0xf6, 0x6c,
-	0x6d, 0x60, 0x35, 0x28, 0x42, 0x85, 0xd8, 0x5f, 0xa1, 0xc6, 0x78, 0x52,
-	0x35, 0x89, 0x90, 0xe1, 0x01, 0xb4, 0x9d, 0xb7, 0x13, 0xa4, 0x9d, 0x63,
-	0x7e, 0xda, 0x9c, 0x47, 0x84, 0x2b, 0x4f, 0xd3, 0xa8, 0x4c, 0x0c, 0x63,
-	0xc4, 0x06, 0x0e, 0xe4, 0x08, 0x5f, 0x7a, 0x83, 0xe7, 0x08, 0x33, 0x3c,
-	0xa4, 0x52, 0x06, 0x08, 0x2e, 0xa1, 0xf7, 0xf5, 0xb5, 0xe5, 0x85, 0x9d,
-	0x55, 0x55, 0x15, 0xaa, 0x40, 0x04, 0x20, 0x0a, 0x33, 0x59, 0x7d, 0x46,
-	0x0b, 0x08, 0x14, 0x88, 0x92, 0xd1, 0x21, 0xcd, 0xff, 0xfb, 0x20, 0xc4,
-	0xe6, 0x80, 0x06, 0x6c, 0x5d, 0x33, 0x27, 0xa4, 0x63, 0x00, 0xdf, 0x8c,
-	0xe5, 0x95, 0x86, 0x0c, 0x28, 0xce, 0xe4, 0xed, 0x8b, 0x39, 0x12, 0xa4,
-	0x8e, 0x47, 0x74, 0xff, 0x66, 0x66, 0x42, 0x17, 0x3c, 0x20, 0x3e, 0x43,
-	0x5e, 0x34, 0xd9, 0x5a, 0x08, 0xf5, 0xc9, 0xf7, 0x2b, 0x17, 0x76, 0xa6,
-	0x20, 0x51, 0x61, 0x1d, 0x99, 0xcc, 0xe4, 0x0a, 0x49, 0x40, 0x5a, 0x3a,
-	0x26, 0x1d, 0x82, 0x9b, 0x07, 0xa8, 0x5b, 0x00, 0xd1, 0x08, 0x97, 0x3c,
-	0xdb, 0x51, 0xe8, 0x09, 0x2f, 0xaf, 0x55, 0x0c, 0xb0, 0x74, 0x90, 0xd2,
-	0x04, 0x47, 0x08, 0xba, 0xda, 0xb3, 0xbe, 0x1f, 0x38, 0x20, 0x60, 0x81,
-	0x16, 0x29, 0x6f, 0xeb, 0x6f, 0xaf, 0xa3, 0xd9, 0x2e, 0x08, 0xb7, 0x1b,
-	0x6c, 0x28, 0x15, 0x01, 0x18, 0x28, 0xce, 0xd5, 0xd2, 0x19, 0x84, 0xb5,
-	0x52, 0xc1, 0x64, 0x42, 0x93, 0x8e, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x00,
-	0x06, 0xfc, 0x77, 0x4d, 0xa6, 0x18, 0x6a, 0xb0, 0xdc, 0x86, 0x26, 0xf0,
-	0xc3, 0x0c, 0xa0, 0x61, 0xc3, 0x57, 0x27, 0x80, 0x32, 0xfe, 0x55, 0x5f,
-	0x23, 0xbf, 0x7e, 0xb5, 0x08, 0x86, 0xad, 0x90, 0xa0, 0xa1, 0x81, 0x19,
-	0x0f, 0xb9, 0x58, 0xba, 0x47, 0x6b, 0x59, 0x69, 0xdd, 0xb2, 0x36, 0xb7,
-	0x70, 0xdb, 0xfa, 0x5f, 0x24, 0xe5, 0xb6, 0xeb, 0x64, 0x8d, 0x22, 0x88,
-	0x02, 0x39, 0x36, 0x64, 0x9a, 0x0c, 0x50, 0x17, 0x7f, 0x69, 0x65, 0x07,
-	0x1b, 0x4f, 0x67, 0xdc, 0xbf, 0x48, 0x22, 0x28, 0x70, 0xb8, 0x2e, 0x48,
-	0xa9, 0xfc, 0x51, 0xca, 0x38, 0x85, 0xa0, 0x41, 0xfb, 0x3d, 0x73, 0x2c,
-	0x49, 0x7b, 0x95, 0x6b, 0xd6, 0x8a, 0x0f, 0xbf, 0x46, 0x04, 0x18, 0x19,
-	0x44, 0xa2, 0xa8, 0xed, 0x08, 0x29, 0xd6, 0xa9, 0xe5, 0x09, 0x40, 0x72,
-	0xc9, 0x05, 0x2f, 0x5e, 0xab, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x07,
-	0x20, 0x49, 0x37, 0x87, 0xa4, 0x65, 0x40, 0xd3, 0x0d, 0xe6, 0x14, 0xc3,
-	0x0c, 0x98, 0x2f, 0x84, 0x86, 0xec, 0x1c, 0x41, 0x22, 0x52, 0x3f, 0xf3,
-	0x91, 0x94, 0x4a, 0x8c, 0x46, 0x28, 0x30, 0x60, 0xd1, 0x5c, 0xa2, 0xd4,
-	0x55, 0xc2, 0xa8, 0x47, 0x00, 0x7f, 0x1d, 0x42, 0x7e, 0x51, 0x0f, 0x5a,
-	0xc9, 0x4d, 0xb5, 0x0b, 0x3c, 0x43, 0x00, 0x09, 0x93, 0x54, 0x85, 0xa3,
-	0xa2, 0xe2, 0xca, 0x5f, 0x0b, 0xba, 0x4e, 0x57, 0x05, 0x4b, 0x82, 0x16,
-	0xb6, 0x1c, 0x4b, 0x02, 0x42, 0x2e, 0xcf, 0xf9, 0x42, 0x15, 0x43, 0xf5,
-	0x61, 0x2a, 0x38, 0x50, 0xa9, 0xe4, 0x33, 0xdb, 0x45, 0x7e, 0xd5, 0xca,
-	0xa1, 0xbe, 0x90, 0x95, 0x72, 0xdb, 0x6d, 0xb1, 0xc6, 0x51, 0x44, 0x80,
-	0x84, 0x8d, 0x73, 0xf8, 0xb3, 0x3f, 0x30, 0xcd, 0x23, 0xa9, 0x1a, 0xaa,
-	0x23, 0xa1, 0x91, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xac, 0x41,
-	0x39, 0x86, 0x24, 0x67, 0x00, 0xf0, 0x0e, 0xa6, 0x20, 0xf4, 0x8c, 0x70,
-	0x40, 0x00, 0x08, 0x5d, 0x8b, 0x3b, 0x0c, 0x85, 0xd9, 0x6f, 0x59, 0xc9,
-	0x05, 0x05, 0xa6, 0xe3, 0xc7, 0x14, 0x77, 0xb5, 0x83, 0x8b, 0x17, 0xc5,
-	0x5b, 0x6c, 0xea, 0x8c, 0x85, 0xa3, 0x50, 0xda, 0x13, 0xad, 0x86, 0xe4,
-	0x9f, 0xfd, 0xb5, 0xd6, 0x38, 0xd8, 0x00, 0x11, 0x14, 0xe2, 0xb4, 0x78,
-	0xd1, 0x3a, 0x22, 0x40, 0x24, 0xd0, 0xf4, 0xae, 0x8f, 0xe5, 0x66, 0xab,
-	0x27, 0x49, 0x2a, 0x8c, 0xe3, 0x80, 0xb8, 0xc3, 0xc9, 0x03, 0x34, 0x35,
-	0x05, 0x43, 0x65, 0x9f, 0xed, 0x07, 0x62, 0x8b, 0xa2, 0xf3, 0xaa, 0x32,
-	0x5b, 0xb3, 0x6a, 0x48, 0x80, 0x82, 0x91, 0x14, 0xb2, 0x51, 0x17, 0x3e,
-	0x81, 0xe8, 0x07, 0x6d, 0x16, 0xc8, 0x87, 0xf1, 0x4f, 0x63, 0x8c, 0xc6,
-	0x8c, 0x87, 0xff, 0xfb, 0x22, 0xc4, 0xe4, 0x00, 0x06, 0x38, 0x6d, 0x35,
-	0x27, 0x98, 0x43, 0x80, 0xe0, 0x88, 0x68, 0x3c, 0xc4, 0x8c, 0xe0, 0x43,
-	0x8c, 0x1c, 0xad, 0xb9, 0x91, 0x67, 0x94, 0x74, 0x8a, 0x18, 0x2f, 0xc1,
-	0x87, 0x7c, 0x3a, 0x16, 0x67, 0xff, 0xed, 0x5d, 0x02, 0x42, 0x04, 0x85,
-	0x1a, 0xa4, 0xf8, 0xa2, 0x80, 0x8b, 0x42, 0x55, 0xb0, 0x8d, 0x2e, 0x9d,
-	0xa0, 0x63, 0x05, 0x7e, 0x69, 0xc7, 0xfc, 0x61, 0x06, 0x10, 0x01, 0x3b,
-	0x41, 0x4c, 0x55, 0x07, 0xfd, 0x81, 0x18, 0x96, 0xba, 0x3d, 0x44, 0x43,
-	0x8f, 0x04, 0x40, 0x88, 0x37, 0x8b, 0x02, 0x00, 0x42, 0x02, 0x81, 0xb8,
-	0xcb, 0xc9, 0xcd, 0x28, 0x48, 0x3e, 0x27, 0x62, 0x7b, 0x36, 0x4e, 0x79,
-	0x83, 0xf4, 0x22, 0x16, 0x85, 0x92, 0x25, 0xfc, 0x91, 0xcf, 0xb1, 0xe8,
-	0x6a, 0x13, 0xdf, 0xfe, 0x40, 0x58, 0x9d, 0xe6, 0x9a, 0x63, 0x19, 0x5f,
-	0xf9, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x07, 0x5c, 0x77, 0x35, 0x87,
-	0x98, 0x67, 0x00, 0xc2, 0x85, 0xaa, 0x74, 0xf6, 0x24, 0x0e, 0x28, 0xfd,
-	0xc7, 0xee, 0x61, 0x76, 0x3d, 0x4c, 0x73, 0x67, 0x1a, 0x61, 0xdf, 0xfc,
-	0xf2, 0x74, 0xff, 0x53, 0x49, 0x6a, 0x8d, 0x26, 0x62, 0x20, 0x0a, 0xd2,
-	0x02, 0x70, 0x89, 0x04, 0xb4, 0x1e, 0xa1, 0x38, 0x4a, 0x30, 0x34, 0x7c,
-	0x67, 0xad, 0x13, 0x7b, 0x16, 0x82, 0x84, 0xe6, 0x55, 0x27, 0xd9, 0x57,
-	0xff, 0x85, 0x85, 0x56, 0x03, 0x36, 0x0d, 0x36, 0xb3, 0xac, 0xd3, 0xea,
-	0x0b, 0xa8, 0xf3, 0xe7, 0xad, 0x3b, 0x15, 0xd1, 0xc0, 0xca, 0xff, 0x96,
-	0x90, 0x8a, 0x40, 0x30, 0x5a, 0x10, 0x1e, 0x90, 0xc8, 0x4e, 0x88, 0x1e,
-	0x4c, 0xb0, 0xc9, 0xc1, 0x02, 0x61, 0xc4, 0x71, 0xc1, 0xb8, 0x37, 0xa1,
-	0x04, 0x29, 0xca, 0xa5, 0xbe, 0x7f, 0xa0, 0x00, 0x01, 0x29, 0x49, 0xff,
-	0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x07, 0x28, 0x6d, 0x33, 0x27, 0x98, 0x67,
-	0x00, 0xcd, 0x8e, 0x67, 0x30, 0xc3, 0x0c, 0xa0, 0xc1, 0x00, 0xc7, 0xa0,
-	0xb9, 0xfc, 0xb9, 0xf5, 0x9f, 0xc7, 0x20, 0x10, 0xba, 0x9a, 0x54, 0x80,
-	0x21, 0x60, 0x02, 0x16, 0x01, 0x50, 0x9f, 0x58, 0x78, 0x87, 0x27, 0xe4,
-	0x4f, 0x2d, 0xc8, 0xd6, 0x5c, 0x59, 0x27, 0x40, 0x23, 0xa3, 0x81, 0xa6,
-	0xa5, 0x6d, 0x69, 0x1d, 0x58, 0xef, 0x3b, 0x88, 0xff, 0xe8, 0xe0, 0xa9,
-	0xca, 0xd7, 0x85, 0xa2, 0x2a, 0x7c, 0x5d, 0x47, 0xbd, 0xa5, 0x9f, 0xe0,
-	0xd3, 0xeb, 0x4e, 0x8c, 0xdd, 0xc8, 0xe9, 0x18, 0x62, 0x36, 0x4e, 0xce,
-	0xe0, 0x3a, 0xa7, 0x8b, 0x47, 0x02, 0x13, 0x23, 0x80, 0x52, 0xa4, 0x96,
-	0xd3, 0x2c, 0x82, 0x25, 0x0a, 0x25, 0x49, 0x17, 0x6d, 0x16, 0x6e, 0x6a,
-	0x64, 0x99, 0x73, 0xf4, 0xd7, 0xd7, 0x6d, 0xe5, 0x52, 0x67, 0xff, 0xfb,
-	0x20, 0xc4, 0xe7, 0x00, 0x07, 0x48, 0x4b, 0x4f, 0xa7, 0x8d, 0x2b, 0x30,
-	0xbc, 0x87, 0xeb, 0x74, 0x93, 0x0d, 0x56, 0x1c, 0x2a, 0x1a, 0x0a, 0x4e,
-	0xfd, 0x8b, 0x34, 0x47, 0x0b, 0x67, 0x2b, 0xae, 0x24, 0xfa, 0x3f, 0x52,
-	0x17, 0x51, 0xd7, 0x2d, 0x6d, 0xf5, 0xd2, 0x83, 0x82, 0x07, 0x82, 0xa5,
-	0x45, 0xce, 0x01, 0xb4, 0x76, 0x50, 0xc9, 0xb4, 0x61, 0x62, 0x07, 0xb4,
-	0x81, 0xe5, 0xc0, 0x2c, 0x15, 0x16, 0x0c, 0x86, 0x22, 0x31, 0x74, 0x14,
-	0x41, 0x3a, 0x0f, 0x8e, 0x77, 0xb0, 0x33, 0x36, 0xae, 0xbe, 0xcf, 0xae,
-	0xdf, 0xfe, 0xb0, 0x43, 0x60, 0x98, 0x80, 0xb8, 0x3e, 0x97, 0x28, 0x43,
-	0xf7, 0x88, 0xf6, 0x53, 0xa6, 0x47, 0x0a, 0x12, 0x50, 0x11, 0x21, 0xf3,
-	0x30, 0x4a, 0x4a, 0x8a, 0xcd, 0x2d, 0xdb, 0xc1, 0xad, 0xe7, 0x94, 0xd9,
-	0x40, 0xc0, 0xb8, 0xa0, 0xa1, 0x34, 0x71, 0x63, 0xff, 0xfb, 0x22, 0xc4,
-	0xe8, 0x80, 0x08, 0x34, 0x95, 0x3b, 0x94, 0xc1, 0x80, 0x21, 0x6a, 0xa5,
-	0xe9, 0xe7, 0x12, 0xa0, 0x00, 0x92, 0x7b, 0xe8, 0x27, 0xab, 0x6e, 0xce,
-	0xbe, 0x95, 0x04, 0x34, 0x44, 0x24, 0x00, 0x8c, 0x80, 0x83, 0x8a, 0xd4,
-	0x1b, 0x32, 0x99, 0x92, 0xcf, 0x1e, 0x8a, 0xc9, 0x84, 0x95, 0x74, 0x80,
-	0x38, 0xfd, 0xbb, 0x65, 0x1a, 0x83, 0xed, 0x41, 0xe0, 0xa2, 0x8f, 0x3c,
-	0xb0, 0x88, 0x0a, 0x50, 0x3a, 0x1b, 0x05, 0x58, 0xe5, 0xeb, 0xfa, 0x23,
-	0xf8, 0x41, 0xe9, 0xdc, 0x8f, 0x47, 0x1e, 0xf3, 0xda, 0xcf, 0xa4, 0x8d,
-	0xc6, 0xd3, 0x00, 0x90, 0x30, 0x13, 0x54, 0x4b, 0x13, 0x0b, 0x0e, 0x7c,
-	0x87, 0x1f, 0xf0, 0x41, 0x11, 0x25, 0x18, 0x48, 0x48, 0x22, 0x8a, 0x87,
-	0x41, 0x43, 0xcf, 0xe7, 0x10, 0x7d, 0x61, 0x60, 0x78, 0x23, 0xb2, 0xb6,
-	0x0f, 0x2d, 0x34, 0x5b, 0xf6, 0xb3, 0xff, 0xff, 0xfb, 0x22, 0xc4, 0xd1,
-	0x00, 0x06, 0xc0, 0x45, 0x4d, 0x9c, 0xc3, 0x00, 0x00, 0xc2, 0x0a, 0x28,
-	0xe0, 0xc4, 0x8c, 0x98, 0xb1, 0x3d, 0x8a, 0x0f, 0x9b, 0xc1, 0x40, 0x80,
-	0x0b, 0x70, 0x34, 0x52, 0xa9, 0x91, 0x09, 0x2b, 0x22, 0x33, 0x4b, 0xf6,
-	0x10, 0x77, 0xe3, 0x2a, 0x30, 0xb5, 0x9e, 0x26, 0x70, 0x3a, 0xc2, 0x48,
-	0x5d, 0x0b, 0x79, 0x42, 0x29, 0x0a, 0x84, 0xd4, 0xff, 0x90, 0xa2, 0xea,
-	0x10, 0x2b, 0x89, 0x16, 0x1f, 0xfd, 0xc2, 0x03, 0x30, 0x18, 0x81, 0xf5,
-	0x01, 0x50, 0x48, 0x75, 0x04, 0x2c, 0xb4, 0xac, 0x4e, 0x2f, 0x31, 0x81,
-	0xc2, 0x62, 0x40, 0xeb, 0xa1, 0xb0, 0xcd, 0x7c, 0xb2, 0x43, 0x4f, 0x0d,
-	0x05, 0x07, 0xbb, 0xf5, 0xa5, 0xc9, 0x53, 0xed, 0xad, 0xaa, 0xff, 0xd5,
-	0x4a, 0x24, 0x2a, 0x04, 0x24, 0xd4, 0x48, 0x20, 0x8b, 0x02, 0x40, 0x10,
-	0xd0, 0x54, 0x7f, 0xc5, 0x39, 0x2c, 0xff, 0xfb, 0x20, 0xc4, 0xd4, 0x80,
-	0x07, 0x20, 0x5f, 0x47, 0x87, 0xa4, 0xca, 0x80, 0xe3, 0x8c, 0x66, 0xc0,
-	0xf6, 0x18, 0x98, 0x89, 0x83, 0xf0, 0xb4, 0x05, 0x52, 0x1e, 0x47, 0xd5,
-	0xde, 0xf6, 0xd4, 0xbe, 0xdf, 0xc8, 0xe6, 0x23, 0x1e, 0x80, 0x8c, 0x39,
-	0xe8, 0xec, 0x55, 0x8e, 0xc8, 0xdf, 0xb5, 0xea, 0x47, 0xfe, 0xbe, 0xc0,
-	0x29, 0x19, 0x20, 0x42, 0x0e, 0x04, 0x57, 0x86, 0x99, 0xe5, 0xb3, 0x97,
-	0x51, 0xb6, 0x33, 0x2f, 0x3a, 0x91, 0xe9, 0x49, 0x35, 0x18, 0xe3, 0xb8,
-	0x53, 0x22, 0x62, 0x8b, 0x7f, 0xd5, 0xa9, 0x67, 0x14, 0x2c, 0x65, 0xa1,
-	0x82, 0xbd, 0x88, 0x1b, 0x3e, 0xf3, 0xa8, 0xa3, 0x9b, 0xf2, 0x89, 0x5f,
-	0xfb, 0x98, 0xfb, 0x2a, 0x57, 0x87, 0x88, 0x89, 0x77, 0x6d, 0xae, 0x90,
-	0x00, 0x1e, 0x92, 0x74, 0x38, 0x97, 0x0e, 0x26, 0x1c, 0x8d, 0x2a, 0xb1,
-	0xc4, 0x63, 0xab, 0x0d, 0xff, 0xfb, 0x22, 0xc4, 0xd2, 0x00, 0x06, 0x30,
-	0x27, 0x57, 0x84, 0xa5, 0x24, 0xb0, 0xc8, 0x08, 0xa7, 0x2c, 0xf3, 0x0c,
-	0xe0, 0x85, 0x12, 0x01, 0x9c, 0x07, 0x5e, 0xa7, 0xac, 0xc9, 0x0e, 0x70,
-	0xf9, 0x29, 0x0a, 0x84, 0x25, 0x9b, 0x0d, 0x46, 0x56, 0x1c, 0x4c, 0x72,
-	0xee, 0x42, 0x4b, 0xd7, 0xd5, 0xf4, 0x87, 0x55, 0xc2, 0x80, 0x2e, 0x07,
-	0x60, 0x0c, 0x4c, 0x26, 0xf1, 0xae, 0xf9, 0x58, 0xe4, 0x0d, 0x05, 0xc2,
-	0x08, 0xdf, 0x22, 0x0e, 0x4f, 0x5f, 0x6b, 0x21, 0xf5, 0xee, 0xc1, 0xd3,
-	0x9f, 0xf2, 0x3b, 0xa0, 0x46, 0x83, 0x0e, 0x2c, 0x8a, 0xa3, 0xd1, 0x64,
-	0x4c, 0x89, 0x14, 0xa6, 0x2c, 0x47, 0x96, 0xad, 0x76, 0xf4, 0xa9, 0x74,
-	0xc7, 0x9e, 0xc8, 0x1b, 0x4a, 0x5b, 0x75, 0xb2, 0x7d, 0xd2, 0x02, 0x70,
-	0x81, 0xd8, 0x0c, 0x6c, 0xba, 0x09, 0x62, 0xaa, 0x82, 0x10, 0x2f, 0x47,
-	0xdd, 0x18, 0x4b, 0xff, 0xfb, 0x22, 0xc4, 0xd7, 0x00, 0x06, 0x9c, 0x33,
-	0x39, 0x87, 0x98, 0xc4, 0xc0, 0xca, 0x05, 0x2b, 0xb4, 0x96, 0x18, 0x06,
-	0x1c, 0x5a, 0xa3, 0x09, 0xc6, 0x81, 0x9f, 0x50, 0x1c, 0xc0, 0xd2, 0xae,
-	0x1c, 0x51, 0xe5, 0x13, 0x14, 0x2e, 0xa5, 0xa8, 0xda, 0x40, 0xa3, 0x88,
-	0x5a, 0xbd, 0xe6, 0xe7, 0x19, 0x37, 0xec, 0x05, 0x1a, 0x13, 0x00, 0x0b,
-	0x41, 0xa6, 0x16, 0xc2, 0xb4, 0x93, 0xe5, 0x20, 0x52, 0x72, 0xf7, 0x55,
-	0x0b, 0xd7, 0x6c, 0x6a, 0x8c, 0x5c, 0xdd, 0xb7, 0x7c, 0xdd, 0xef, 0x15,
-	0x68, 0x92, 0xa3, 0x4c, 0x5e, 0x72, 0xca, 0x4d, 0x39, 0x2a, 0x4a, 0xb7,
-	0x52, 0xd8, 0xd1, 0xa0, 0x99, 0xd6, 0x39, 0x3f, 0xbb, 0xd8, 0xcf, 0xd5,
-	0x24, 0x97, 0x77, 0x87, 0x77, 0x3a, 0xcb, 0x72, 0x30, 0x1b, 0x09, 0xb4,
-	0x32, 0x32, 0x3d, 0x46, 0x05, 0x58, 0x18, 0xc1, 0x94, 0x37, 0xf2, 0xc6,
-	0x2c, 0xd2, 0xff, 0xfb, 0x20, 0xc4, 0xda, 0x00, 0x05, 0x9c, 0x2b, 0x39,
-	0x27, 0xa5, 0x22, 0x00, 0xb9, 0x84, 0xe7, 0x64, 0xc4, 0x98, 0x08, 0x50,
-	0x81, 0xc8, 0x31, 0x67, 0x85, 0x43, 0xee, 0xe1, 0x09, 0xb4, 0x0a, 0x1c,
-	0x07, 0xdf, 0xea, 0x5c, 0xbc, 0x39, 0x61, 0x9b, 0x24, 0x70, 0x79, 0x2a,
-	0x5e, 0x92, 0x0d, 0x1a, 0xec, 0xa0, 0x75, 0x7a, 0x92, 0xe2, 0x80, 0x70,
-	0x3e, 0x24, 0x25, 0xee, 0x2d, 0xee, 0x01, 0xa9, 0x19, 0x24, 0x07, 0xec,
-	0xfa, 0xda, 0x35, 0x19, 0x97, 0x54, 0xa7, 0xf2, 0xdf, 0xff, 0xc8, 0x8d,
-	0xd4, 0xbb, 0x55, 0xd3, 0x0a, 0x03, 0x9d, 0xa4, 0x5d, 0x22, 0xb5, 0x66,
-	0xdf, 0xed, 0x72, 0x90, 0xed, 0x9a, 0xee, 0xbc, 0x93, 0x5a, 0xb5, 0x93,
-	0x5b, 0x6e, 0xb2, 0x46, 0xa2, 0x45, 0x00, 0x16, 0x04, 0xe0, 0x32, 0x05,
-	0x8e, 0x8b, 0xce, 0x66, 0x6c, 0x1a, 0xe0, 0xfa, 0x8a, 0x9a, 0x3a, 0x96,
-	0xff, 0xfb, 0x22, 0xc4, 0xe2, 0x80, 0x05, 0xf0, 0x6b, 0x39, 0x84, 0x8c,
-	0x4e, 0x80, 0xcf, 0x0e, 0x66, 0x60, 0xf3, 0x0c, 0xa8, 0x85, 0x75, 0x30,
-	0xea, 0x76, 0x25, 0xfa, 0x79, 0x31, 0x93, 0x17, 0xca, 0x91, 0x42, 0x0b,
-	0x41, 0xd4, 0xab, 0x73, 0x4a, 0x91, 0x7b, 0x6d, 0xd5, 0xea, 0xfd, 0x58,
-	0x6d, 0xc9, 0x10, 0xa1, 0xae, 0x7f, 0x49, 0xf0, 0xa1, 0x2d, 0xc8, 0xa2,
-	0x74, 0x75, 0x32, 0x0a, 0x33, 0x08, 0x92, 0x24, 0x1b, 0x7b, 0x21, 0x06,
-	0x20, 0xf2, 0x0d, 0xf7, 0xef, 0x63, 0xd0, 0xf4, 0xbf, 0xfe, 0x11, 0x1d,
-	0x77, 0x3a, 0x1c, 0x1f, 0x00, 0x10, 0x0a, 0xbb, 0x52, 0xd2, 0x55, 0xc2,
-	0x36, 0x01, 0x6e, 0x45, 0x44, 0xfa, 0x6d, 0x17, 0x3b, 0xb1, 0xfd, 0x2a,
-	0x42, 0x26, 0x47, 0x35, 0x71, 0x70, 0xb7, 0x82, 0x70, 0x60, 0xf0, 0x84,
-	0x11, 0xad, 0x45, 0x0b, 0xb2, 0x0b, 0x0b, 0xa4, 0x97, 0x96, 0x47, 0xff,
-	0xfb, 0x20, 0xc4, 0xe7, 0x80, 0x06, 0xa4, 0x77, 0x67, 0xe7, 0xa4, 0x65,
-	0x30, 0xe7, 0x8e, 0xe6, 0xa4, 0xf3, 0x08, 0xb8, 0x18, 0xc8, 0x84, 0x21,
-	0x76, 0xb3, 0x40, 0x01, 0xc4, 0xb5, 0x3c, 0x73, 0xd4, 0x22, 0x0d, 0x02,
-	0xbe, 0xa6, 0x33, 0xba, 0x75, 0x9c, 0x66, 0x3d, 0xb7, 0xf5, 0xed, 0x7e,
-	0xba, 0xc1, 0x48, 0xb8, 0xd1, 0x08, 0x0b, 0x20, 0xe8, 0xa4, 0x9a, 0x46,
-	0x3c, 0xe5, 0x37, 0x73, 0x49, 0x81, 0x07, 0x20, 0x7b, 0xc9, 0xf9, 0x47,
-	0xc3, 0x84, 0x68, 0x68, 0xa4, 0x85, 0x37, 0xff, 0xb1, 0x61, 0x90, 0x71,
-	0x06, 0x41, 0xc3, 0x05, 0x53, 0x21, 0x7b, 0x78, 0x84, 0x32, 0x86, 0x81,
-	0x9c, 0x8e, 0xcb, 0x1c, 0x56, 0x0b, 0x2d, 0x54, 0xe1, 0x8f, 0x4d, 0x15,
-	0x25, 0x16, 0x92, 0x04, 0x53, 0x0a, 0x20, 0xf8, 0xae, 0x39, 0x23, 0x1e,
-	0x9d, 0x44, 0x53, 0xdc, 0xa0, 0xb0, 0x61, 0x91, 0x04, 0xff, 0xfb, 0x22,
-	0xc4, 0xe6, 0x80, 0x06, 0xc0, 0x39, 0x51, 0x86, 0x24, 0x65, 0x30, 0xd3,
-	0x8e, 0xa6, 0x60, 0xf2, 0x98, 0x00, 0x12, 0xd5, 0x23, 0x35, 0x10, 0xb9,
-	0xd4, 0x9d, 0x28, 0x49, 0x51, 0x04, 0x72, 0x48, 0x08, 0x50, 0xe7, 0xa8,
-	0x92, 0xc3, 0x20, 0x54, 0x90, 0xae, 0x37, 0x7a, 0xbf, 0xfb, 0x14, 0xb5,
-	0xdd, 0x76, 0xb6, 0xd9, 0x23, 0x4c, 0xa2, 0x40, 0x61, 0x21, 0x40, 0xc3,
-	0x11, 0x90, 0xfd, 0xb0, 0x90, 0x08, 0x18, 0x54, 0xb6, 0xb9, 0xe5, 0x6f,
-	0x42, 0xc6, 0x25, 0x0f, 0x5d, 0xf6, 0x39, 0xa4, 0x10, 0x80, 0x83, 0x09,
-	0x9f, 0x93, 0x2c, 0xf7, 0x82, 0xaf, 0x02, 0x90, 0xa7, 0xdd, 0x45, 0x2f,
-	0xea, 0x08, 0x7c, 0x1f, 0x03, 0xba, 0x50, 0x85, 0x88, 0x25, 0xe7, 0x2d,
-	0x4c, 0xe8, 0xb4, 0x83, 0x01, 0x5a, 0xd0, 0x3b, 0x13, 0x55, 0x93, 0x18,
-	0xb8, 0xc1, 0x5a, 0xe4, 0x4d, 0x86, 0x32, 0xf5, 0xff, 0xfb, 0x22, 0xc4,
-	0xe8, 0x00, 0x07, 0x14, 0x37, 0x47, 0xe4, 0xb0, 0xc2, 0x20, 0xd3, 0x8e,
-	0x66, 0x60, 0xf3, 0x0c, 0xa8, 0xfb, 0x01, 0x45, 0xa0, 0x49, 0xe8, 0x25,
-	0x15, 0x32, 0x04, 0x3b, 0xbc, 0x6e, 0x02, 0x0c, 0xe2, 0xd4, 0x8b, 0x4e,
-	0x31, 0x2b, 0x78, 0xe2, 0x6f, 0x13, 0x5d, 0xd6, 0xb3, 0x9f, 0x23, 0xa5,
-	0xb5, 0x5d, 0x51, 0x4e, 0x3b, 0xe5, 0x92, 0x35, 0x2b, 0x53, 0x00, 0xa2,
-	0x60, 0x00, 0x01, 0xcf, 0x7c, 0x92, 0x42, 0xb2, 0x27, 0xc5, 0xe3, 0x41,
-	0xf5, 0x39, 0x03, 0xc4, 0x8c, 0x1a, 0x27, 0x3c, 0x18, 0x54, 0x70, 0x20,
-	0x5d, 0xf4, 0x90, 0x10, 0x38, 0x10, 0x0c, 0x2d, 0xe7, 0xd8, 0x51, 0xdf,
-	0x2e, 0x1f, 0x21, 0xab, 0x8d, 0x37, 0x13, 0xaa, 0x3d, 0x16, 0xa3, 0x17,
-	0xc3, 0x55, 0x34, 0x7f, 0x97, 0xd2, 0x28, 0xdf, 0x3a, 0x0b, 0x53, 0x04,
-	0xc5, 0xe1, 0xf1, 0xc2, 0x58, 0x17, 0x02, 0xff, 0xfb, 0x20, 0xc4, 0xe8,
-	0x00, 0x06, 0xf8, 0x75, 0x55, 0xa4, 0x98, 0x67, 0x30, 0xe3, 0x8d, 0x26,
-	0xa0, 0xf3, 0x0c, 0xa8, 0x85, 0xa3, 0xc5, 0x71, 0x94, 0x08, 0xc3, 0xa3,
-	0x84, 0xe2, 0xde, 0x36, 0x3a, 0xa9, 0x6a, 0x36, 0x1f, 0x4a, 0x4c, 0x17,
-	0x18, 0xa0, 0xf2, 0x19, 0x67, 0xda, 0xb4, 0xab, 0x12, 0x7d, 0x2d, 0xb6,
-	0x93, 0x6c, 0xe4, 0x65, 0xe5, 0x2f, 0x16, 0x6c, 0xe2, 0x17, 0x24, 0x1a,
-	0x7f, 0xbc, 0xd9, 0x46, 0x48, 0x63, 0x57, 0x97, 0x71, 0xc9, 0x36, 0xcf,
-	0x12, 0x80, 0x80, 0xdc, 0x8b, 0x74, 0x07, 0x60, 0xd0, 0x14, 0x34, 0xe6,
-	0x73, 0x24, 0xe8, 0x2a, 0x85, 0xc9, 0x1e, 0x24, 0x44, 0x4b, 0x30, 0x04,
-	0x32, 0x84, 0xbb, 0x07, 0x11, 0x19, 0x10, 0x99, 0x5a, 0x79, 0xc8, 0x8e,
-	0x90, 0xcc, 0xcc, 0xb4, 0x1c, 0xe0, 0xac, 0x33, 0x35, 0xb1, 0x98, 0xaa,
-	0xdb, 0x06, 0x80, 0x20, 0xa5, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06,
-	0x68, 0x39, 0x3b, 0x86, 0x30, 0xc0, 0x40, 0xe8, 0x8e, 0xe6, 0xb0, 0xc3,
-	0x0c, 0x70, 0xcd, 0x6a, 0x10, 0x4d, 0x20, 0xd2, 0xb6, 0xfd, 0x1e, 0xef,
-	0xa3, 0xd3, 0x9c, 0x40, 0x41, 0xeb, 0x03, 0x72, 0xf8, 0x74, 0xb6, 0xbd,
-	0x91, 0x0b, 0x56, 0xa2, 0x79, 0xe0, 0x14, 0x51, 0x45, 0xd4, 0x84, 0x96,
-	0x82, 0xd0, 0x14, 0x07, 0xc2, 0x26, 0xd4, 0x82, 0xa3, 0x0d, 0x20, 0x13,
-	0x6b, 0x0d, 0x2c, 0xea, 0x76, 0xae, 0xc2, 0x28, 0x57, 0xc6, 0xd5, 0xd9,
-	0xfd, 0x4a, 0x16, 0x5b, 0x6c, 0x92, 0x03, 0x2d, 0x40, 0x17, 0x84, 0x66,
-	0xc3, 0xa0, 0xd3, 0x85, 0x24, 0x67, 0x8c, 0x23, 0x23, 0x12, 0x13, 0x1a,
-	0x12, 0xa3, 0xa8, 0xa6, 0xb3, 0x47, 0x5c, 0x66, 0x09, 0xcd, 0xb9, 0x36,
-	0xb5, 0xec, 0x3b, 0x12, 0x8d, 0x50, 0xf6, 0xed, 0xc6, 0x29, 0x0c, 0x4b,
-	0x1d, 0xd6, 0xa9, 0xbf, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06, 0x64,
-	0x6f, 0x33, 0x07, 0xb0, 0x60, 0x40, 0xe3, 0x88, 0xaa, 0xb4, 0xf6, 0x0c,
-	0x66, 0xab, 0xd0, 0xb7, 0xbc, 0x8a, 0x72, 0x6b, 0x75, 0x91, 0xfd, 0xd3,
-	0x03, 0x26, 0x00, 0x81, 0x18, 0x19, 0xd0, 0xa8, 0xa1, 0xe0, 0x5a, 0x14,
-	0xd1, 0x15, 0x36, 0x4c, 0xa2, 0x4e, 0xde, 0xbb, 0x40, 0x0b, 0x70, 0x48,
-	0x2c, 0x62, 0x36, 0x1f, 0x48, 0x62, 0x70, 0xf8, 0xe7, 0x12, 0x5e, 0xc2,
-	0xa4, 0x5a, 0xf3, 0x7d, 0xda, 0x9f, 0x45, 0xbf, 0xf8, 0xa8, 0xbb, 0xd5,
-	0x67, 0xd0, 0x51, 0x16, 0x02, 0xec, 0x49, 0x4e, 0x53, 0xa4, 0x36, 0xb9,
-	0x98, 0xa2, 0x91, 0x66, 0x87, 0xd4, 0x44, 0x7e, 0x4d, 0xc5, 0x02, 0xdb,
-	0x0c, 0x2b, 0xc8, 0x4c, 0xc1, 0x95, 0x37, 0x8c, 0x54, 0xbc, 0x8b, 0xe9,
-	0xe4, 0xe0, 0x91, 0x8c, 0x1b, 0x5b, 0xc5, 0x12, 0x2d, 0x1f, 0x5d, 0x17,
-	0xdc, 0xf5, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x07, 0x88, 0x49, 0x3f,
-	0x87, 0xe0, 0x63, 0x40, 0xc3, 0x84, 0xa9, 0x74, 0x97, 0x98, 0x10, 0x8b,
-	0x8a, 0x49, 0x7f, 0xe3, 0x85, 0xd9, 0x02, 0x96, 0x01, 0x44, 0x24, 0x21,
-	0x81, 0xa3, 0xb9, 0x54, 0x0e, 0xd7, 0x18, 0xb0, 0x43, 0x8e, 0x34, 0x33,
-	0x44, 0xac, 0xc7, 0x5d, 0x5a, 0x1a, 0x6f, 0x21, 0xba, 0x13, 0xed, 0xf1,
-	0x8b, 0x67, 0x35, 0x20, 0x23, 0xa8, 0x04, 0x0c, 0xc9, 0x45, 0x39, 0xa2,
-	0xaa, 0x4a, 0xd6, 0x04, 0x5b, 0xdc, 0xdf, 0xdb, 0x48, 0x2c, 0xbc, 0xf3,
-	0x69, 0xbd, 0xd5, 0xa8, 0xc8, 0xdc, 0x51, 0x01, 0x00, 0x38, 0x08, 0x78,
-	0xf4, 0x23, 0x0e, 0x22, 0x66, 0xc8, 0x48, 0x5c, 0x9c, 0x6d, 0x2f, 0x61,
-	0x49, 0x59, 0xfb, 0x1b, 0x91, 0xde, 0xd2, 0x80, 0x46, 0x05, 0xdb, 0x1c,
-	0xb9, 0x33, 0x80, 0xf8, 0x10, 0x3e, 0x43, 0xd7, 0x16, 0x7a, 0x4e, 0x57,
-	0x3c, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x83, 0xcb, 0x50, 0xc1, 0x3c, 0x07,
-	0xb1, 0x2b, 0x80, 0xd5, 0x8d, 0xe7, 0x40, 0xf4, 0x8c, 0xb0, 0x87, 0xa9,
-	0xec, 0x28, 0xd3, 0x7d, 0x02, 0xe7, 0x09, 0x91, 0x05, 0x6a, 0x00, 0x04,
-	0x56, 0x89, 0x8b, 0xd3, 0xf8, 0x04, 0x2c, 0xe2, 0x57, 0x88, 0xa6, 0x28,
-	0xd1, 0x6d, 0xaa, 0xb9, 0xa5, 0x3f, 0x11, 0xba, 0x08, 0x71, 0x3d, 0xff,
-	0xfc, 0xee, 0xa6, 0xea, 0x21, 0x4d, 0x02, 0x9d, 0x15, 0x3f, 0xe4, 0xd8,
-	0x52, 0x68, 0x8a, 0x51, 0x6e, 0x8a, 0xba, 0x3e, 0xbd, 0x29, 0x18, 0x0a,
-	0x8b, 0xff, 0x51, 0xc5, 0x54, 0x0c, 0xe5, 0x74, 0x24, 0x39, 0x19, 0xc6,
-	0xa7, 0x6b, 0x0b, 0x24, 0x45, 0xfd, 0xf6, 0x12, 0x96, 0xc1, 0x13, 0x2f,
-	0x9e, 0xa6, 0x3d, 0x22, 0xff, 0x3d, 0x59, 0xcc, 0x81, 0x3a, 0xa3, 0xa8,
-	0x68, 0x61, 0x45, 0x1a, 0xad, 0x90, 0x21, 0xe2, 0x62, 0x65, 0x45, 0x5b,
-	0xff, 0xfb, 0x20, 0xc4, 0xd5, 0x80, 0x05, 0xec, 0x2f, 0x38, 0xa6, 0x3c,
-	0xc2, 0x80, 0xdd, 0x06, 0xe7, 0xf4, 0xc4, 0x88, 0x38, 0x94, 0x56, 0x45,
-	0x8c, 0x7e, 0xef, 0xe6, 0xd5, 0xb7, 0x6f, 0xff, 0xd6, 0x58, 0xe3, 0x68,
-	0x00, 0x02, 0x57, 0x1e, 0x04, 0x91, 0x94, 0x98, 0x29, 0x68, 0x02, 0xa6,
-	0x68, 0xd0, 0x82, 0x27, 0xb8, 0x7a, 0x46, 0x6f, 0xf7, 0xae, 0x28, 0x68,
-	0x03, 0x7d, 0x61, 0xf8, 0x9d, 0xe0, 0x01, 0x55, 0x02, 0x3f, 0x2a, 0xf6,
-	0x30, 0x31, 0xaf, 0x5f, 0xcc, 0xbd, 0xb6, 0xdf, 0x6b, 0x72, 0x07, 0x87,
-	0x06, 0x44, 0x40, 0x15, 0x1b, 0x49, 0x99, 0x91, 0x3b, 0x20, 0x8c, 0x51,
-	0xc6, 0x80, 0x8e, 0xb1, 0xea, 0x5e, 0x4e, 0xcb, 0x83, 0xde, 0x97, 0x8d,
-	0x2a, 0x94, 0x47, 0x05, 0x41, 0x64, 0x7a, 0x90, 0xa4, 0x21, 0x4b, 0xab,
-	0x4a, 0x3f, 0xff, 0x5a, 0x09, 0x45, 0x2c, 0x6d, 0x53, 0x33, 0xff, 0xfb,
-	0x22, 0xc4, 0xd8, 0x80, 0x06, 0xa8, 0x2f, 0x57, 0x84, 0x99, 0x24, 0x70,
-	0xe6, 0x8e, 0x66, 0xe4, 0xf4, 0x8c, 0x70, 0x82, 0x90, 0x27, 0x1a, 0x40,
-	0x94, 0xc0, 0x12, 0xec, 0x59, 0x24, 0xd7, 0x75, 0x45, 0x15, 0xdf, 0x0a,
-	0x48, 0xe3, 0xcb, 0x22, 0x14, 0xf9, 0x65, 0xf2, 0xfd, 0x8e, 0x64, 0xcb,
-	0xd4, 0x61, 0x2a, 0xd4, 0x47, 0xe4, 0xa7, 0xcd, 0xb2, 0xbc, 0xee, 0xde,
-	0x9f, 0xf6, 0xe5, 0x81, 0xaa, 0x90, 0x80, 0x00, 0x03, 0x08, 0x39, 0x8e,
-	0x43, 0x82, 0x66, 0x9c, 0xba, 0xba, 0xab, 0xd6, 0x00, 0x72, 0x5c, 0x44,
-	0xc7, 0xc4, 0x42, 0x23, 0xdd, 0xdf, 0x28, 0xb9, 0xff, 0x69, 0x9e, 0x4a,
-	0xf7, 0x70, 0x63, 0x96, 0x7d, 0x6a, 0xc9, 0xd4, 0xf9, 0x3d, 0xfb, 0xd1,
-	0x90, 0x41, 0x0a, 0x2b, 0xac, 0xa2, 0x0c, 0x17, 0xe1, 0x50, 0x5a, 0x28,
-	0x45, 0x1a, 0xb7, 0x3a, 0x16, 0x25, 0x4d, 0xaf, 0xf5, 0xff, 0xfb, 0x20,
-	0xc4, 0xd8, 0x00, 0x07, 0x38, 0x75, 0x35, 0x2c, 0x18, 0x65, 0x00, 0xdd,
-	0x08, 0x27, 0x30, 0xf3, 0x0c, 0xa8, 0xb8, 0x24, 0x4d, 0x65, 0xb9, 0x19,
-	0x89, 0x3c, 0xd3, 0x4f, 0xfb, 0x56, 0x33, 0x0f, 0x98, 0x05, 0x4d, 0x88,
-	0xb6, 0xf5, 0x96, 0xa1, 0xcf, 0x67, 0xd3, 0x1c, 0x6f, 0xd3, 0xea, 0xd4,
-	0x1c, 0xb2, 0xcb, 0x1b, 0x89, 0x24, 0x93, 0x01, 0xb8, 0xff, 0x6c, 0x47,
-	0x0b, 0x0b, 0xb7, 0x4d, 0xa0, 0x3a, 0x20, 0x27, 0x8e, 0xb9, 0x0a, 0x1a,
-	0xda, 0xb0, 0x39, 0xae, 0x48, 0x2c, 0x1b, 0xa3, 0x1f, 0xdf, 0xea, 0x3d,
-	0x0c, 0xe8, 0x64, 0x2c, 0x87, 0x16, 0x4c, 0x37, 0xb2, 0xc8, 0x58, 0x44,
-	0xb7, 0x6a, 0x7b, 0xad, 0xa1, 0x1a, 0xf4, 0xf7, 0x6b, 0x9a, 0x11, 0xcd,
-	0xae, 0xf5, 0xf8, 0xd1, 0x01, 0x50, 0x91, 0x08, 0xf8, 0xe5, 0x10, 0x8c,
-	0x40, 0x78, 0x40, 0x43, 0xbc, 0x74, 0x2d, 0xff, 0xfb, 0x22, 0xc4, 0xd6,
-	0x00, 0x06, 0x84, 0x6b, 0x33, 0x07, 0x98, 0x63, 0x80, 0xdc, 0x8e, 0x67,
-	0x24, 0xf3, 0x0c, 0xa8, 0x48, 0x61, 0x3d, 0x72, 0xe6, 0x18, 0x28, 0x21,
-	0x0e, 0x8f, 0x40, 0x3e, 0xc9, 0x04, 0x82, 0x03, 0x45, 0xdf, 0xea, 0x43,
-	0x4a, 0x3d, 0x3b, 0x37, 0x8b, 0x6d, 0xd3, 0xfc, 0xfc, 0x08, 0xea, 0x87,
-	0xf7, 0xe9, 0x80, 0x01, 0x0a, 0x50, 0x84, 0x1e, 0x92, 0xd8, 0x39, 0x1a,
-	0x56, 0x9e, 0xe7, 0x34, 0x7e, 0xba, 0xa6, 0x11, 0x84, 0xa9, 0x3b, 0x04,
-	0x8c, 0x86, 0x07, 0xb9, 0xe6, 0x45, 0x7d, 0x4b, 0xd5, 0x5b, 0x63, 0x3c,
-	0x71, 0x18, 0x24, 0x32, 0xd5, 0x47, 0xbd, 0xd1, 0x52, 0x60, 0x63, 0x6b,
-	0x17, 0xfb, 0x67, 0xaa, 0xec, 0xf5, 0xce, 0x55, 0x36, 0x47, 0x5d, 0x95,
-	0xb2, 0x11, 0x72, 0x00, 0x66, 0x17, 0x13, 0xd4, 0xa3, 0x3d, 0x59, 0x92,
-	0x9a, 0x65, 0x89, 0x2b, 0x30, 0x77, 0xff, 0xfb, 0x22, 0xc4, 0xd7, 0x00,
-	0x86, 0x04, 0x45, 0x5d, 0xa6, 0x18, 0x61, 0xb0, 0xba, 0x08, 0xeb, 0xb0,
-	0x90, 0x8d, 0x86, 0xb4, 0x94, 0x2b, 0x03, 0xed, 0x67, 0x43, 0xa5, 0xdf,
-	0x9f, 0xdb, 0xdc, 0xe9, 0xfa, 0x3a, 0x42, 0x04, 0xeb, 0x3a, 0x1b, 0x5e,
-	0x90, 0xc9, 0xed, 0x7a, 0x48, 0x12, 0x43, 0x6f, 0x69, 0x7d, 0xdf, 0xa0,
-	0x39, 0x25, 0xb1, 0xb5, 0xe4, 0x7e, 0x08, 0xc2, 0x23, 0xf1, 0xd4, 0xd1,
-	0x19, 0xda, 0xb3, 0x81, 0x53, 0x52, 0x20, 0xbd, 0x08, 0x26, 0x0f, 0x9a,
-	0x0c, 0x3c, 0x61, 0x31, 0x23, 0x9a, 0x74, 0x82, 0x82, 0x2a, 0x0c, 0x38,
-	0x1f, 0x3e, 0x5c, 0x28, 0x72, 0xcf, 0xd1, 0x16, 0x1c, 0x31, 0xf9, 0xc6,
-	0xbd, 0xae, 0xb9, 0xab, 0xff, 0x65, 0x0a, 0x0a, 0x97, 0x53, 0x00, 0x90,
-	0x04, 0x84, 0xba, 0x4a, 0x68, 0x1c, 0xd4, 0x21, 0x60, 0xe1, 0x1a, 0x50,
-	0xe6, 0xb5, 0x9a, 0xee, 0xbd, 0xff, 0xfb, 0x20, 0xc4, 0xde, 0x80, 0x06,
-	0x48, 0x77, 0x3b, 0x86, 0x18, 0x63, 0xc0, 0xbd, 0x0d, 0x66, 0xa4, 0xf6,
-	0x0c, 0x20, 0x2d, 0x49, 0xf3, 0x33, 0x1c, 0xdc, 0xbc, 0xe7, 0xfa, 0x55,
-	0x56, 0x55, 0x12, 0x36, 0x36, 0x08, 0x18, 0x04, 0x23, 0x46, 0xc3, 0xda,
-	0xcf, 0x92, 0x70, 0x66, 0xd2, 0xf5, 0x21, 0xa0, 0x06, 0x74, 0x14, 0x94,
-	0x6d, 0xb4, 0xe8, 0x09, 0x16, 0x00, 0x3b, 0x07, 0x08, 0x12, 0x02, 0x04,
-	0xa9, 0x74, 0x71, 0x02, 0x96, 0x81, 0x7d, 0xb6, 0x91, 0x4f, 0x0e, 0x7a,
-	0x6b, 0xdf, 0xd4, 0xf3, 0x60, 0xe2, 0x47, 0x68, 0x3e, 0x04, 0x3e, 0x90,
-	0x4c, 0xb8, 0x26, 0x28, 0xfe, 0xe4, 0x16, 0x72, 0x5e, 0x42, 0x8f, 0xa1,
-	0x41, 0xf3, 0xa7, 0x5d, 0x72, 0x95, 0x52, 0xd9, 0x6e, 0xb6, 0x7d, 0xd2,
-	0x03, 0x81, 0x32, 0xb0, 0x5c, 0x3a, 0xbe, 0x3f, 0x38, 0x86, 0x22, 0x69,
-	0x37, 0xbb, 0x80, 0xff, 0xfb, 0x22, 0xc4, 0xe4, 0x00, 0x05, 0xfc, 0x65,
-	0x35, 0x08, 0x30, 0x61, 0x40, 0xe8, 0x8e, 0xe7, 0xb4, 0xf3, 0x0c, 0xa8,
-	0x1d, 0x37, 0x42, 0x2c, 0xe8, 0x3d, 0xa2, 0x20, 0x01, 0xda, 0x23, 0x86,
-	0xcb, 0xbc, 0x00, 0x28, 0x22, 0x0e, 0xa5, 0xdb, 0x4e, 0xad, 0x4a, 0x7a,
-	0x3a, 0xa7, 0xae, 0x62, 0x92, 0x9d, 0x29, 0x0f, 0x80, 0x20, 0x63, 0x8d,
-	0xc3, 0x90, 0x9e, 0x17, 0x05, 0x41, 0x30, 0x16, 0x04, 0x21, 0x70, 0xac,
-	0x34, 0x1b, 0xd2, 0xf6, 0xfa, 0xc8, 0x59, 0xdc, 0xa7, 0x5f, 0xc8, 0xb7,
-	0x86, 0x3f, 0x61, 0x58, 0xdd, 0xfd, 0xfe, 0xf2, 0xf8, 0x47, 0xde, 0x87,
-	0x62, 0x34, 0xee, 0xad, 0xed, 0xbf, 0xbd, 0xf7, 0x8f, 0xfa, 0x66, 0xd4,
-	0x54, 0x33, 0xeb, 0xec, 0x47, 0xdd, 0xe3, 0x87, 0x4b, 0xd8, 0x04, 0xb2,
-	0x5c, 0x6d, 0xb9, 0x14, 0x6a, 0x27, 0x09, 0x8d, 0x44, 0x9a, 0x40, 0x08,
-	0xb4, 0xd1, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0x88, 0x3f, 0x43,
-	0x84, 0x98, 0x65, 0x60, 0xdf, 0x8d, 0x26, 0x65, 0x86, 0x0c, 0x28, 0x21,
-	0x86, 0xc1, 0x54, 0x6f, 0x36, 0xc8, 0x81, 0x0e, 0x8f, 0x89, 0xc0, 0x81,
-	0x5c, 0xec, 0x10, 0x24, 0x06, 0xc9, 0x16, 0x75, 0xb9, 0x70, 0xb9, 0xa3,
-	0xce, 0x57, 0x61, 0xaf, 0x87, 0x99, 0xa4, 0x85, 0x95, 0xf9, 0xe5, 0xe1,
-	0x08, 0x4f, 0x57, 0x28, 0x36, 0x92, 0x0f, 0xea, 0x50, 0xaf, 0xff, 0x86,
-	0x6f, 0xb9, 0xaa, 0xcc, 0x42, 0xa2, 0x1c, 0x80, 0xe0, 0x44, 0xc2, 0xc7,
-	0xb1, 0x0a, 0x97, 0x0f, 0xf2, 0x42, 0x19, 0x65, 0xfc, 0xff, 0xa8, 0x1a,
-	0xd3, 0x03, 0x81, 0xf9, 0x3c, 0xe8, 0xb4, 0x2c, 0x27, 0xa7, 0x4e, 0x6a,
-	0xdb, 0xc6, 0x65, 0x98, 0x57, 0x1f, 0xa2, 0x48, 0x45, 0x19, 0x53, 0x24,
-	0x99, 0xa3, 0x54, 0xf0, 0xdd, 0xaa, 0xdb, 0xd3, 0x1d, 0x49, 0x02, 0xa0,
-	0x15, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06, 0xd8, 0x73, 0x3d, 0xa7,
-	0x98, 0x64, 0xc0, 0xda, 0x84, 0xe7, 0x70, 0xc3, 0x18, 0x90, 0xa9, 0xb2,
-	0xbf, 0xa5, 0xce, 0x69, 0xdf, 0xda, 0xb7, 0x22, 0x8d, 0xca, 0xe5, 0x8d,
-	0xf5, 0xd0, 0x00, 0xdd, 0x37, 0x8c, 0x4b, 0xa5, 0x12, 0x50, 0x7c, 0x6a,
-	0x15, 0x92, 0x4d, 0x1f, 0x70, 0xec, 0xac, 0x3d, 0x97, 0x95, 0xba, 0x85,
-	0xd4, 0xbc, 0x78, 0x25, 0x5a, 0xc9, 0x3a, 0x01, 0x71, 0x86, 0xbc, 0xa9,
-	0x61, 0x11, 0xaf, 0x56, 0xe3, 0xec, 0x98, 0x4b, 0x7d, 0x00, 0x60, 0x22,
-	0x00, 0x32, 0x00, 0x94, 0x30, 0x2d, 0x1d, 0x06, 0x2a, 0x26, 0xa8, 0x90,
-	0x3e, 0xd9, 0x35, 0x1c, 0x22, 0x7c, 0x12, 0x35, 0x4a, 0x84, 0xd6, 0x2f,
-	0x32, 0xdb, 0xd6, 0x60, 0xe1, 0x35, 0x72, 0xa6, 0xdd, 0x68, 0x31, 0x02,
-	0x7f, 0x71, 0xd7, 0x17, 0x44, 0x54, 0xe8, 0x8a, 0xe4, 0x57, 0x7a, 0xff,
-	0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xc4, 0x6f, 0x33, 0x27, 0x98, 0x65,
-	0x40, 0xdf, 0x08, 0xa7, 0x74, 0xf4, 0x98, 0x00, 0xb5, 0x55, 0x15, 0x5e,
-	0xc1, 0x41, 0xa4, 0x09, 0x8b, 0x3a, 0x3d, 0xb4, 0xd3, 0x63, 0xc1, 0x51,
-	0xa5, 0x49, 0x97, 0x25, 0x28, 0x1e, 0x02, 0x95, 0x88, 0xad, 0x40, 0x64,
-	0x2a, 0x90, 0x91, 0xcd, 0x3d, 0x24, 0x32, 0x63, 0x9f, 0xb8, 0x54, 0x48,
-	0x48, 0x0a, 0xa1, 0xb5, 0x6d, 0xad, 0xe8, 0xea, 0x63, 0x22, 0xdf, 0xd0,
-	0x57, 0xb9, 0x21, 0x9d, 0xe3, 0xd1, 0x94, 0x42, 0x4d, 0xc0, 0x05, 0xc6,
-	0xe2, 0x51, 0xb4, 0x63, 0x84, 0x8a, 0x05, 0xc2, 0xe7, 0xd0, 0x8a, 0x7a,
-	0xe4, 0x08, 0x9b, 0xd8, 0xb0, 0xc8, 0x6e, 0xea, 0x8e, 0x54, 0x3f, 0x7a,
-	0x18, 0x74, 0x05, 0x2c, 0x48, 0x98, 0xaf, 0xa2, 0xf0, 0xaa, 0x11, 0x23,
-	0x5a, 0xff, 0x7b, 0x7f, 0xa1, 0x1b, 0x9c, 0x05, 0x81, 0x80, 0xff, 0xfb,
-	0x20, 0xc4, 0xe6, 0x00, 0x06, 0x80, 0x37, 0x51, 0x84, 0x30, 0xc0, 0xb0,
-	0xfb, 0x92, 0x66, 0x56, 0x9e, 0x60, 0x00, 0x08, 0x30, 0x47, 0x04, 0x52,
-	0x06, 0x20, 0x82, 0x4c, 0xb0, 0x9a, 0xbc, 0xfd, 0xb0, 0x79, 0x8a, 0x0b,
-	0xa3, 0xb2, 0x37, 0xd2, 0x13, 0xee, 0xde, 0x79, 0x53, 0x72, 0xb4, 0x94,
-	0x38, 0xf3, 0x50, 0xe2, 0xe1, 0x87, 0x95, 0xfb, 0x8f, 0xd0, 0xc5, 0xff,
-	0xb1, 0xd5, 0x26, 0x6d, 0xd6, 0x75, 0x27, 0x25, 0x92, 0xc8, 0xfa, 0x95,
-	0x40, 0x5d, 0x0e, 0x16, 0xc1, 0xd0, 0x99, 0xe8, 0xa4, 0x42, 0x44, 0x54,
-	0x52, 0x65, 0x96, 0x0a, 0x1d, 0xbc, 0x7a, 0x31, 0x51, 0x4b, 0xe6, 0x6f,
-	0x1e, 0xe6, 0xbd, 0x99, 0x94, 0x5c, 0xdb, 0xcc, 0x51, 0x40, 0xe8, 0x95,
-	0x5e, 0xc8, 0xbd, 0x1b, 0xff, 0x5b, 0x5b, 0xba, 0xac, 0x54, 0xf8, 0x1f,
-	0x45, 0x36, 0x5b, 0x2d, 0x92, 0x44, 0x91, 0x44, 0xff, 0xfb, 0x22, 0xc4,
-	0xe3, 0x00, 0x0b, 0x20, 0x9f, 0x57, 0xb8, 0x94, 0x80, 0x10, 0xbb, 0x0a,
-	0xa8, 0xd7, 0x98, 0x60, 0x00, 0x80, 0xb8, 0xdd, 0xb6, 0xc5, 0x2a, 0xc8,
-	0xd4, 0x34, 0x8e, 0x47, 0xc6, 0xcc, 0xc9, 0x11, 0xa8, 0x23, 0x1a, 0xd2,
-	0x78, 0xdb, 0x32, 0x13, 0xf1, 0xcf, 0xd3, 0xb0, 0xf5, 0x86, 0x25, 0x21,
-	0x20, 0xf8, 0xc3, 0xfe, 0x8b, 0x28, 0xae, 0x53, 0x67, 0xb5, 0xbe, 0xac,
-	0xf2, 0x74, 0x8d, 0x48, 0x40, 0x31, 0x42, 0xa0, 0xcd, 0x8a, 0x42, 0xac,
-	0x2e, 0x27, 0x01, 0x16, 0x93, 0x58, 0x20, 0x38, 0x71, 0x91, 0xcd, 0x8e,
-	0x12, 0x4e, 0xf1, 0x7f, 0xf3, 0xeb, 0x8c, 0x23, 0x0f, 0xc0, 0x26, 0x00,
-	0x0e, 0x97, 0x55, 0x63, 0x4a, 0x9d, 0xd3, 0x12, 0x0a, 0xee, 0x2c, 0x74,
-	0x7d, 0x69, 0x45, 0x48, 0xfa, 0x15, 0x25, 0x77, 0x87, 0x67, 0x66, 0x5b,
-	0x5c, 0x6d, 0x00, 0x28, 0xc9, 0xd0, 0x42, 0xff, 0xfb, 0x22, 0xc4, 0xd6,
-	0x00, 0x06, 0x2c, 0x39, 0x59, 0x87, 0xb0, 0x61, 0xb0, 0xcb, 0x0d, 0xa7,
-	0x64, 0xc4, 0x8c, 0xa0, 0x20, 0x48, 0xa1, 0xa1, 0x20, 0xc3, 0x61, 0xa1,
-	0x99, 0x33, 0x46, 0x9d, 0x4f, 0xb6, 0x8a, 0x3a, 0xd1, 0x4f, 0x71, 0xd9,
-	0xe9, 0x40, 0xc2, 0xd1, 0x47, 0x89, 0x5b, 0x17, 0xfb, 0x5e, 0xd7, 0x3e,
-	0x8f, 0xf5, 0x1d, 0x6a, 0xda, 0xd4, 0xe3, 0x2c, 0xaf, 0x0f, 0xf2, 0x88,
-	0x70, 0x1d, 0x2f, 0x45, 0x15, 0xed, 0xc5, 0x11, 0x99, 0x0d, 0x37, 0xb1,
-	0x39, 0x36, 0x52, 0xd5, 0x0f, 0x33, 0x33, 0x01, 0x68, 0x7a, 0x7f, 0xa2,
-	0x32, 0xec, 0xf3, 0xd9, 0x64, 0xa4, 0x2b, 0x7a, 0xfd, 0x50, 0x8d, 0x5f,
-	0xe8, 0x42, 0x7a, 0x6b, 0xb6, 0xd6, 0xc8, 0x92, 0x69, 0x80, 0x30, 0x00,
-	0x9f, 0x15, 0x93, 0x3c, 0xdd, 0x8d, 0x43, 0xbd, 0x8a, 0x4c, 0x18, 0x53,
-	0xa0, 0x40, 0x23, 0x2d, 0x8c, 0x84, 0xff, 0xfb, 0x20, 0xc4, 0xda, 0x80,
-	0x06, 0x8c, 0x63, 0x39, 0x27, 0xa4, 0x65, 0x00, 0xd2, 0x08, 0x27, 0xf4,
-	0xb4, 0x8c, 0xa8, 0x41, 0xdb, 0xb6, 0xf3, 0x9e, 0x45, 0x4f, 0x2e, 0x7d,
-	0x4e, 0x42, 0xd4, 0x43, 0xd5, 0x34, 0x6a, 0x4d, 0xaa, 0x8f, 0xd4, 0xf6,
-	0xde, 0x2f, 0x08, 0x6f, 0x22, 0xe6, 0x38, 0xd2, 0x6a, 0x79, 0xb3, 0x01,
-	0xc9, 0x65, 0xd5, 0x5a, 0x84, 0x6e, 0x00, 0x07, 0x30, 0x85, 0x20, 0xe6,
-	0x50, 0x89, 0x1e, 0x63, 0xf6, 0x64, 0xb3, 0x4d, 0x18, 0x8a, 0x67, 0xaf,
-	0x7d, 0xcb, 0xf3, 0x46, 0xbd, 0x94, 0xb6, 0x2c, 0xb7, 0xfe, 0x7e, 0x47,
-	0xfb, 0x33, 0x6a, 0x6f, 0x0a, 0x19, 0x97, 0x7e, 0x78, 0x29, 0x08, 0x3d,
-	0xb3, 0x6d, 0xaf, 0xc6, 0x1c, 0xb6, 0xba, 0x0b, 0x6b, 0xb7, 0x93, 0x44,
-	0x59, 0x68, 0x00, 0x78, 0x1b, 0x48, 0x2e, 0x37, 0x04, 0x63, 0xb9, 0x89,
-	0x87, 0xbb, 0xba, 0x46, 0xff, 0xfb, 0x22, 0xc4, 0xdc, 0x80, 0x06, 0x44,
-	0x75, 0x35, 0x07, 0xa4, 0x63, 0x40, 0xda, 0x0d, 0x29, 0xf0, 0xf4, 0x8c,
-	0x36, 0xa7, 0x6d, 0x1a, 0xdb, 0x28, 0x89, 0x90, 0x92, 0x19, 0xe6, 0x7f,
-	0x97, 0xb2, 0x91, 0xab, 0x7d, 0x8b, 0x4c, 0x18, 0x73, 0x49, 0x76, 0x9e,
-	0x99, 0xd2, 0xf5, 0xbb, 0x08, 0x3e, 0x44, 0x56, 0x9a, 0x75, 0x84, 0xed,
-	0x96, 0x48, 0x1a, 0x08, 0xb7, 0x00, 0x15, 0x06, 0x88, 0xc1, 0x31, 0x35,
-	0x12, 0xbd, 0x99, 0x22, 0xb0, 0x11, 0x86, 0x34, 0x67, 0xf1, 0x0c, 0x26,
-	0xa4, 0xe1, 0xf3, 0x03, 0xd5, 0x58, 0x1e, 0xa9, 0xe1, 0x41, 0x80, 0x86,
-	0xca, 0x54, 0xf6, 0x6b, 0xa0, 0xd2, 0xac, 0xa1, 0x45, 0xa5, 0x3c, 0xcc,
-	0x6d, 0x8e, 0x43, 0x5c, 0x42, 0x02, 0x4a, 0xa0, 0x10, 0x06, 0x98, 0x23,
-	0x13, 0x3e, 0x1d, 0xa6, 0x96, 0x75, 0x46, 0x22, 0x18, 0xdb, 0x39, 0xa0,
-	0xb3, 0x35, 0xba, 0xff, 0xfb, 0x20, 0xc4, 0xdf, 0x00, 0x06, 0x84, 0x63,
-	0x51, 0xa6, 0x24, 0x65, 0x30, 0xcc, 0x8d, 0xe6, 0x54, 0xf1, 0x0c, 0x90,
-	0x4b, 0xbb, 0xb1, 0xd2, 0x7e, 0xff, 0xf3, 0x33, 0x19, 0xe6, 0xf6, 0x54,
-	0x45, 0x1c, 0xd1, 0x26, 0x84, 0xd0, 0x19, 0xe3, 0x36, 0x0d, 0x6c, 0xb0,
-	0x89, 0xee, 0x70, 0xce, 0xcc, 0x5c, 0x4b, 0xea, 0x05, 0x24, 0x5c, 0x44,
-	0x20, 0x8b, 0x00, 0x6b, 0x10, 0x15, 0x3a, 0x51, 0x6d, 0xe9, 0x27, 0x2a,
-	0x63, 0x41, 0xa4, 0xa8, 0x2c, 0x8d, 0xd5, 0x20, 0xf7, 0x99, 0xb1, 0x90,
-	0x8e, 0xbf, 0xff, 0xf5, 0x89, 0x28, 0x4b, 0xd6, 0x51, 0x4e, 0x80, 0xc4,
-	0x3b, 0x8b, 0x41, 0xbe, 0xf5, 0x39, 0x1a, 0x1d, 0xdf, 0x92, 0xb1, 0x9a,
-	0x46, 0xa6, 0x9a, 0x57, 0x6d, 0xae, 0xf6, 0xd8, 0xe3, 0x69, 0x80, 0x5c,
-	0x78, 0x2a, 0x3a, 0x0d, 0x45, 0x86, 0x62, 0xca, 0x16, 0x8f, 0x7a, 0x96,
-	0xe8, 0xff, 0xfb, 0x22, 0xc4, 0xe1, 0x80, 0x45, 0xe4, 0x45, 0x5f, 0xe4,
-	0x98, 0x6a, 0xf0, 0xbe, 0x0e, 0xe7, 0xf4, 0xf4, 0x8c, 0xa8, 0xfa, 0x39,
-	0x97, 0x6e, 0x24, 0xce, 0x51, 0x21, 0x10, 0x67, 0x69, 0xf7, 0x8f, 0x7a,
-	0xc8, 0x03, 0xeb, 0xdb, 0x72, 0x56, 0x21, 0x35, 0xb2, 0x4e, 0xf5, 0xea,
-	0xee, 0xdb, 0xde, 0xd1, 0x59, 0x6a, 0x89, 0x07, 0x2c, 0x9b, 0x67, 0x34,
-	0x85, 0x00, 0x24, 0x2c, 0x1d, 0x16, 0x49, 0x46, 0x5e, 0xb1, 0x25, 0x87,
-	0x4a, 0xf2, 0x8a, 0x14, 0x8c, 0xc4, 0x64, 0x15, 0xc8, 0x3d, 0x98, 0x87,
-	0x6d, 0xb5, 0xb3, 0x17, 0x99, 0x1e, 0x64, 0x15, 0x73, 0x12, 0xb1, 0x7b,
-	0x1c, 0x8b, 0xde, 0xad, 0x3c, 0xf1, 0xd9, 0x2d, 0xc8, 0x6a, 0x91, 0x05,
-	0xa6, 0xe4, 0xac, 0xe8, 0xb5, 0x00, 0xbc, 0x0c, 0xe9, 0x4c, 0xc9, 0x12,
-	0xd8, 0xa3, 0xf6, 0xc1, 0x0b, 0xab, 0xe4, 0x88, 0x2c, 0xc0, 0xe8, 0x5c,
-	0xff, 0xfb, 0x22, 0xc4, 0xe9, 0x00, 0x07, 0x8c, 0x45, 0x57, 0xa4, 0xb0,
-	0xc1, 0x70, 0xdc, 0x92, 0x67, 0xf4, 0xc3, 0x0d, 0x98, 0x56, 0x7b, 0x41,
-	0x23, 0x79, 0xce, 0x7c, 0xb0, 0x8a, 0xc1, 0xb2, 0xa6, 0x22, 0x11, 0x8d,
-	0xee, 0xb4, 0x59, 0xf8, 0xd2, 0x6a, 0x1c, 0xa6, 0x57, 0x69, 0xa3, 0xe9,
-	0x4f, 0x7d, 0x2a, 0x25, 0xa6, 0xb0, 0x0e, 0xe4, 0x21, 0x43, 0x90, 0x5a,
-	0xce, 0x63, 0x9d, 0x0f, 0xce, 0x3b, 0x6b, 0xf8, 0x9b, 0x7b, 0x68, 0xb9,
-	0xb3, 0xf6, 0x28, 0x31, 0x15, 0x2d, 0x20, 0x9f, 0x11, 0x5e, 0x8b, 0x5a,
-	0x68, 0x1d, 0x13, 0x16, 0x33, 0x09, 0x80, 0xe4, 0xe8, 0x0b, 0xdc, 0x7c,
-	0xeb, 0x45, 0xd8, 0x52, 0x2e, 0xb7, 0xc5, 0xcd, 0x1d, 0xff, 0x86, 0x55,
-	0x5b, 0x9a, 0x69, 0xe8, 0x90, 0x1a, 0x59, 0x50, 0x00, 0x01, 0x11, 0xa4,
-	0x08, 0x56, 0xee, 0x9e, 0x58, 0xb3, 0xdd, 0x18, 0x72, 0x59, 0x95, 0xff,
-	0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06, 0xc4, 0x73, 0x43, 0xa4, 0x98, 0x65,
-	0xe0, 0xda, 0x85, 0xe7, 0xb4, 0x94, 0x8c, 0x98, 0xfb, 0xee, 0x36, 0x70,
-	0x7d, 0x2f, 0x76, 0x4c, 0x89, 0xe4, 0x6b, 0xc8, 0x28, 0x8c, 0x83, 0x51,
-	0x9b, 0x5d, 0x19, 0x17, 0x95, 0xa0, 0x30, 0xc3, 0x4b, 0x79, 0x4e, 0xd8,
-	0x1e, 0x3c, 0x3a, 0xdc, 0x11, 0x2d, 0x1a, 0x6b, 0x5a, 0x94, 0x2f, 0x52,
-	0x9c, 0xa7, 0xe0, 0xdd, 0x2a, 0x52, 0x0c, 0x39, 0xf6, 0x8e, 0x6c, 0x5e,
-	0xd7, 0x8d, 0xfa, 0xf5, 0x4b, 0x74, 0x64, 0x41, 0xe2, 0xe1, 0x27, 0x0b,
-	0xbc, 0x27, 0x2e, 0x80, 0x4c, 0x85, 0xc6, 0x59, 0xff, 0xba, 0x0c, 0x38,
-	0x83, 0x0c, 0x20, 0x83, 0x08, 0x10, 0x00, 0x32, 0x8a, 0x44, 0x88, 0x13,
-	0xea, 0x91, 0xae, 0x20, 0x33, 0x28, 0x62, 0x31, 0x52, 0x1b, 0xbe, 0x04,
-	0x80, 0x3a, 0x60, 0xe4, 0x87, 0xe1, 0xba, 0x50, 0x3a, 0xff, 0xfb, 0x22,
-	0xc4, 0xe6, 0x00, 0x06, 0xc0, 0x6f, 0x31, 0x08, 0x24, 0xc1, 0x40, 0xda,
-	0x0e, 0xa6, 0xb0, 0xf3, 0x0c, 0xa8, 0x16, 0xc1, 0x18, 0xe3, 0x91, 0x1b,
-	0x19, 0x9a, 0xfa, 0x4d, 0x3a, 0xdc, 0xcc, 0xc9, 0x23, 0xe6, 0xc8, 0x4d,
-	0xbe, 0xd6, 0xcb, 0x3e, 0x6b, 0xf6, 0x8d, 0x08, 0x60, 0x71, 0xf1, 0x18,
-	0xfd, 0xb6, 0xbf, 0x78, 0xcf, 0x9f, 0xc7, 0xf7, 0xb1, 0x52, 0x9b, 0xd3,
-	0xfe, 0xd9, 0xeb, 0xf6, 0xac, 0xff, 0xb4, 0x10, 0x43, 0xf5, 0x80, 0xbc,
-	0x32, 0x96, 0xc9, 0x2e, 0x89, 0xa3, 0x58, 0x81, 0xcb, 0x46, 0x20, 0x13,
-	0x92, 0x3c, 0x54, 0x21, 0x7a, 0xc6, 0x8f, 0xa4, 0x4c, 0x55, 0xac, 0x06,
-	0xac, 0x9f, 0x28, 0x8b, 0xb4, 0x15, 0x24, 0x76, 0xb3, 0xbe, 0x22, 0x96,
-	0x0e, 0x8f, 0x77, 0xcb, 0x28, 0xf6, 0x58, 0xf2, 0xaa, 0xff, 0xff, 0xe9,
-	0x08, 0x94, 0x14, 0x40, 0xb0, 0xb0, 0x03, 0xc2, 0xff, 0xfb, 0x20, 0xc4,
-	0xe6, 0x80, 0x06, 0xe4, 0x41, 0x5b, 0xa4, 0x84, 0x70, 0x30, 0xcf, 0x0e,
-	0xa7, 0xf0, 0xc3, 0x08, 0x64, 0x42, 0x24, 0x81, 0x97, 0x8d, 0x48, 0xa2,
-	0x24, 0x07, 0x1e, 0x34, 0xa4, 0x2d, 0x24, 0x15, 0xc8, 0x08, 0x87, 0x83,
-	0xa3, 0x5c, 0x1c, 0x1e, 0x30, 0x3b, 0x6d, 0x87, 0x0f, 0x34, 0x26, 0x47,
-	0xda, 0x84, 0x46, 0xa9, 0x26, 0x99, 0x7b, 0x5e, 0x9a, 0x12, 0x31, 0x08,
-	0x09, 0x50, 0x0d, 0x91, 0xaa, 0xa9, 0x61, 0x39, 0x9a, 0x45, 0x2b, 0x83,
-	0xaf, 0x5b, 0xb0, 0x91, 0x45, 0x35, 0x5e, 0x85, 0x16, 0x47, 0x91, 0x9e,
-	0x84, 0xca, 0xa9, 0xe0, 0x94, 0x10, 0xf3, 0x10, 0x08, 0x10, 0x4a, 0x16,
-	0x07, 0x84, 0x62, 0x14, 0xb4, 0x03, 0xa9, 0x8e, 0x69, 0x05, 0x05, 0xca,
-	0x69, 0xff, 0x7e, 0xcf, 0xea, 0x05, 0x20, 0x00, 0x6c, 0x15, 0xc1, 0xf2,
-	0x79, 0x3f, 0x6d, 0xb8, 0x94, 0x0d, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80,
-	0x07, 0x30, 0x77, 0x39, 0x86, 0x18, 0x65, 0x80, 0xd7, 0x08, 0xa6, 0x62,
-	0x9e, 0x30, 0x00, 0x07, 0xe0, 0xf7, 0xa2, 0x2c, 0x8e, 0x95, 0x68, 0xcc,
-	0x97, 0xa1, 0x48, 0x89, 0x9d, 0x5c, 0x89, 0x61, 0xb2, 0x6b, 0x47, 0xc6,
-	0x2c, 0x18, 0x17, 0x68, 0x18, 0xda, 0x7b, 0x14, 0x44, 0x1f, 0x95, 0x95,
-	0x49, 0x9f, 0xf7, 0xa9, 0xbc, 0xca, 0xf9, 0x5a, 0x0a, 0x7b, 0x41, 0x7c,
-	0x60, 0xc3, 0x46, 0x76, 0x75, 0x95, 0xce, 0xc0, 0x5d, 0x00, 0xa9, 0x18,
-	0x39, 0x01, 0x63, 0xd1, 0x51, 0x71, 0xd2, 0xdd, 0x3a, 0x95, 0xb3, 0x9f,
-	0x7d, 0x67, 0xc9, 0xa4, 0x63, 0x39, 0x65, 0x4e, 0xee, 0x7a, 0x7f, 0x51,
-	0xa5, 0xc0, 0xb8, 0x2d, 0xab, 0x32, 0x0f, 0x01, 0xdd, 0x63, 0x5b, 0xea,
-	0xbb, 0xd3, 0x55, 0x9e, 0xb5, 0x85, 0xd3, 0xa0, 0xa2, 0x16, 0x03, 0x04,
-	0x6a, 0x1d, 0x0c, 0xe1, 0x32, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x0c,
-	0x18, 0xbd, 0x33, 0x39, 0x84, 0x80, 0x01, 0x68, 0xa0, 0xa9, 0xe7, 0x12,
-	0x60, 0x00, 0x53, 0xa8, 0x8b, 0xf4, 0x87, 0x67, 0x4c, 0x17, 0x0d, 0x85,
-	0x83, 0x60, 0xc8, 0xc7, 0x03, 0x41, 0xa0, 0x55, 0x26, 0x9a, 0xd3, 0x03,
-	0x05, 0x62, 0x00, 0x90, 0x04, 0x1e, 0x30, 0x89, 0x14, 0x4b, 0x0f, 0x63,
-	0xed, 0xfe, 0xcb, 0x53, 0x62, 0x97, 0x22, 0x5b, 0xb1, 0xd9, 0xea, 0x17,
-	0x00, 0xa1, 0x64, 0x71, 0x80, 0xb6, 0x87, 0xfc, 0xa9, 0x78, 0x8d, 0x57,
-	0x12, 0x33, 0xa1, 0x13, 0x08, 0x22, 0xa1, 0x20, 0xcf, 0x42, 0x2c, 0x12,
-	0x0f, 0x77, 0x7f, 0xbe, 0x7e, 0xc4, 0x4c, 0x2e, 0x20, 0x38, 0x19, 0x44,
-	0x41, 0xd2, 0x7d, 0xac, 0x38, 0xb9, 0x79, 0x02, 0xeb, 0xb1, 0x8b, 0x8c,
-	0x57, 0xff, 0x54, 0xbf, 0xff, 0x7e, 0xd6, 0x59, 0x23, 0x6c, 0x09, 0x0b,
-	0xb6, 0x35, 0x14, 0x48, 0xff, 0xfb, 0x20, 0xc4, 0xc0, 0x00, 0x05, 0xe0,
-	0x33, 0x5b, 0x9c, 0x93, 0x00, 0x20, 0xbe, 0x05, 0x68, 0xf0, 0xb4, 0x98,
-	0x14, 0xc5, 0x44, 0xca, 0x93, 0x2a, 0xea, 0xb4, 0xd3, 0xb9, 0x29, 0x8a,
-	0xc8, 0x76, 0x51, 0xa3, 0x33, 0xfb, 0x69, 0x98, 0x2e, 0x5b, 0xd0, 0xe2,
-	0x41, 0x64, 0x7c, 0x48, 0x0f, 0x6c, 0x5b, 0xab, 0xfc, 0xea, 0xbe, 0xd7,
-	0x55, 0x1b, 0xff, 0xe1, 0x00, 0x5c, 0x0a, 0x13, 0x91, 0xf2, 0x48, 0x20,
-	0x1c, 0xe7, 0x42, 0x4a, 0x2d, 0xf0, 0x19, 0x51, 0xcc, 0x3b, 0xe4, 0x58,
-	0x4a, 0x56, 0x06, 0x8a, 0x88, 0x31, 0xd7, 0xb7, 0x6d, 0x08, 0x32, 0x45,
-	0xc7, 0x2d, 0xff, 0xb0, 0x1f, 0xe9, 0xa3, 0x46, 0x9f, 0xfc, 0x00, 0x68,
-	0xc5, 0x04, 0xbd, 0xe8, 0x00, 0x8b, 0x00, 0x90, 0x04, 0xa4, 0x32, 0x48,
-	0x8b, 0x1d, 0x84, 0x6a, 0x60, 0xa8, 0x09, 0x45, 0x26, 0x13, 0xdd, 0x83,
-	0x03, 0x4c, 0xff, 0xfb, 0x22, 0xc4, 0xc7, 0x00, 0x07, 0x00, 0x51, 0x3d,
-	0x27, 0xa4, 0x65, 0x00, 0xd6, 0x0b, 0xa7, 0x20, 0xf4, 0x8c, 0x68, 0x30,
-	0xd4, 0x51, 0x1c, 0x59, 0x07, 0xd2, 0x2a, 0x0b, 0x0a, 0x1c, 0x37, 0xb6,
-	0x5d, 0x01, 0xe7, 0xf5, 0x77, 0xd5, 0x24, 0xdf, 0xfe, 0x8a, 0x95, 0x4d,
-	0xd9, 0x25, 0x91, 0xf5, 0x32, 0x00, 0x4e, 0x3b, 0x92, 0x8f, 0x57, 0xcb,
-	0xa6, 0x2f, 0x42, 0x0e, 0x2f, 0x49, 0x39, 0xf8, 0xb4, 0x36, 0xa8, 0xd3,
-	0xe6, 0x82, 0x90, 0x8e, 0x65, 0xff, 0xca, 0x9d, 0x21, 0x5f, 0x50, 0x77,
-	0x01, 0x37, 0xf1, 0x1a, 0x9f, 0xfb, 0x7d, 0x24, 0x6d, 0xe8, 0x3a, 0x9e,
-	0xa3, 0x45, 0x18, 0x84, 0xb9, 0x4a, 0xa5, 0x1c, 0x39, 0x3c, 0x63, 0x4b,
-	0x73, 0xbc, 0xec, 0x64, 0xc5, 0x49, 0xe5, 0x63, 0x1f, 0x25, 0xaf, 0x08,
-	0xe5, 0xf3, 0xbf, 0x33, 0xd0, 0xb4, 0x82, 0x09, 0x83, 0xcf, 0xeb, 0x11,
-	0x30, 0xff, 0xfb, 0x22, 0xc4, 0xc7, 0x00, 0x07, 0x24, 0x75, 0x39, 0x0c,
-	0x3c, 0xc0, 0x40, 0xe1, 0x84, 0x67, 0x24, 0xf0, 0xa4, 0x40, 0xcf, 0x37,
-	0x26, 0xe4, 0xec, 0x00, 0x74, 0x25, 0x0b, 0x00, 0x78, 0x4a, 0xe6, 0x9c,
-	0x75, 0x31, 0x22, 0x69, 0x17, 0x08, 0xb3, 0x73, 0x5b, 0x26, 0x09, 0x07,
-	0xff, 0xfe, 0x96, 0x51, 0xaa, 0x80, 0x89, 0x18, 0xb9, 0x30, 0x48, 0x95,
-	0xfe, 0x3c, 0x3a, 0x7d, 0x07, 0x05, 0x90, 0x62, 0x4b, 0x5e, 0x13, 0xd1,
-	0x6e, 0xb3, 0xbb, 0x40, 0x2d, 0xb4, 0xe1, 0x3a, 0x28, 0xc0, 0x46, 0x49,
-	0x5b, 0xe4, 0x53, 0x4d, 0x48, 0x98, 0x69, 0x45, 0x90, 0x1f, 0x3b, 0x55,
-	0x61, 0x7e, 0xcb, 0x21, 0xbb, 0x4f, 0x3f, 0x54, 0xfe, 0x88, 0xa0, 0x9a,
-	0x0e, 0x09, 0x0e, 0x08, 0xeb, 0x17, 0xde, 0x2a, 0xb1, 0xde, 0xcf, 0xfb,
-	0xbf, 0x57, 0xb9, 0xca, 0x05, 0xd8, 0xeb, 0x4d, 0x36, 0x11, 0x46, 0x00,
-	0xff, 0xfb, 0x20, 0xc4, 0xc5, 0x00, 0x06, 0x74, 0x6f, 0x34, 0xa7, 0xb0,
-	0x61, 0x00, 0xc5, 0x0d, 0xac, 0x74, 0x90, 0x8a, 0x1e, 0x60, 0x15, 0x0e,
-	0x29, 0x21, 0xc0, 0xe2, 0xac, 0x76, 0x07, 0x14, 0x89, 0x74, 0x3e, 0x20,
-	0x09, 0x47, 0x83, 0x02, 0x23, 0x6d, 0xae, 0x30, 0xb8, 0x3e, 0xd0, 0xb9,
-	0xf6, 0x11, 0x26, 0xdf, 0x43, 0xe9, 0xad, 0x27, 0x3a, 0xff, 0xfa, 0x75,
-	0x6b, 0x56, 0xdb, 0x65, 0xb2, 0x7d, 0x53, 0x03, 0xc2, 0xc3, 0xa0, 0x77,
-	0x13, 0x4b, 0xbe, 0x2c, 0x82, 0x5b, 0xf0, 0x68, 0x24, 0x42, 0x2e, 0x6c,
-	0xea, 0x88, 0x09, 0x5d, 0xd2, 0x0d, 0x64, 0x8e, 0x05, 0x46, 0x9d, 0xfb,
-	0x0b, 0xb4, 0x57, 0x4a, 0xfb, 0x91, 0x63, 0x3f, 0xea, 0x43, 0x13, 0x1a,
-	0x8a, 0x15, 0x5a, 0x01, 0x00, 0x18, 0x82, 0xab, 0x8b, 0x03, 0x24, 0x86,
-	0xd5, 0xc1, 0xe4, 0x8d, 0x49, 0x6b, 0xa9, 0x92, 0x55, 0x76, 0xff, 0xfb,
-	0x22, 0xc4, 0xc9, 0x00, 0x06, 0x0c, 0x63, 0x39, 0x27, 0x98, 0x43, 0xc0,
-	0xbf, 0x86, 0x66, 0xe4, 0xf4, 0x8c, 0x18, 0xea, 0x9a, 0xe8, 0xfc, 0xed,
-	0xfd, 0x9c, 0x24, 0x12, 0xc3, 0x52, 0x0e, 0x08, 0x1d, 0x1c, 0x87, 0x5b,
-	0xf8, 0xc3, 0x81, 0x02, 0xc0, 0xab, 0x94, 0xf4, 0xe9, 0xee, 0xbe, 0xb3,
-	0x64, 0x92, 0xdb, 0x24, 0x65, 0x14, 0x48, 0x03, 0x41, 0xd1, 0x78, 0x15,
-	0x2e, 0xf1, 0xb1, 0x4a, 0xc4, 0x02, 0x2a, 0xf5, 0x65, 0x9f, 0x44, 0x07,
-	0x6e, 0x7a, 0x68, 0x72, 0x18, 0xb0, 0x1a, 0x67, 0x07, 0x44, 0xa6, 0x8b,
-	0xb0, 0x5e, 0xa5, 0x08, 0x08, 0x23, 0xef, 0x6b, 0x9b, 0xb0, 0x19, 0x4a,
-	0x54, 0xf9, 0x71, 0x51, 0x6d, 0xd5, 0x27, 0x47, 0xbd, 0x15, 0x2a, 0xbf,
-	0xd6, 0x09, 0x6c, 0x09, 0x98, 0x34, 0x00, 0x8f, 0x0a, 0x75, 0xf6, 0x7c,
-	0x20, 0xbb, 0xe7, 0x47, 0x25, 0xa7, 0x23, 0xc4, 0x6a, 0xff, 0xfb, 0x20,
-	0xc4, 0xcf, 0x80, 0x45, 0xe0, 0x6f, 0x51, 0x86, 0x18, 0x67, 0x30, 0xb0,
-	0x0d, 0xa7, 0x24, 0xf3, 0x0c, 0x78, 0x67, 0xe0, 0xc8, 0xca, 0x7f, 0x7c,
-	0xe4, 0xcd, 0x98, 0xf7, 0x50, 0xa0, 0xd8, 0x17, 0x3f, 0x34, 0x20, 0x70,
-	0x6c, 0x9c, 0x3b, 0x73, 0xdf, 0x45, 0x8f, 0x70, 0xfa, 0xf8, 0xae, 0x77,
-	0xdc, 0x03, 0x55, 0x4c, 0x78, 0xa9, 0x13, 0x13, 0x95, 0x89, 0x55, 0x9f,
-	0x6a, 0xba, 0x2c, 0x55, 0xd3, 0x66, 0x99, 0x75, 0x61, 0x03, 0xe0, 0xe0,
-	0x06, 0xe8, 0x77, 0xa7, 0xb4, 0x92, 0x07, 0x42, 0xc2, 0x14, 0x08, 0xe8,
-	0x57, 0xa3, 0xf4, 0xd0, 0xf3, 0x93, 0x04, 0x05, 0x14, 0x66, 0xe8, 0x6b,
-	0x41, 0x66, 0x18, 0xb1, 0x8e, 0xfc, 0xfb, 0x15, 0x05, 0x56, 0x40, 0x00,
-	0x08, 0x0c, 0xa0, 0x57, 0xa2, 0x12, 0x40, 0x3c, 0x8d, 0x31, 0xd0, 0x9b,
-	0x09, 0xda, 0x24, 0x24, 0x29, 0x61, 0x4e, 0xff, 0xfb, 0x22, 0xc4, 0xd8,
-	0x80, 0x06, 0x08, 0x65, 0x30, 0x07, 0xb0, 0x60, 0x80, 0xc0, 0x8c, 0x27,
-	0x30, 0xf3, 0x08, 0xa8, 0x08, 0x6a, 0x0a, 0x77, 0xff, 0xde, 0x19, 0x20,
-	0xd9, 0x3b, 0xa8, 0x30, 0x50, 0xc0, 0x6f, 0x60, 0xe0, 0x20, 0xb8, 0x78,
-	0xe0, 0x7b, 0x41, 0xfb, 0xdf, 0x49, 0x0b, 0x3f, 0xdc, 0xf7, 0x32, 0x80,
-	0x8b, 0x4d, 0x88, 0xd2, 0x82, 0xd0, 0x01, 0xd0, 0x59, 0x40, 0xec, 0x58,
-	0x6a, 0x34, 0x8e, 0x34, 0xf1, 0xd2, 0x3a, 0x68, 0xb5, 0x94, 0x2e, 0xf3,
-	0x22, 0xd6, 0xb3, 0xdd, 0xbf, 0xee, 0xcd, 0x9b, 0x65, 0xa3, 0x0a, 0x80,
-	0x63, 0xe9, 0xcd, 0x4a, 0x81, 0xc9, 0x05, 0x10, 0xaf, 0x5f, 0x59, 0x28,
-	0x9e, 0xec, 0xf0, 0xb3, 0x6b, 0xa5, 0x4a, 0x32, 0xdb, 0x6d, 0xb2, 0xf3,
-	0xd3, 0x01, 0x61, 0xd2, 0x51, 0x50, 0xa0, 0x95, 0xa6, 0x9c, 0x81, 0x3a,
-	0x40, 0x9a, 0xd6, 0x95, 0x2c, 0x79, 0xff, 0xfb, 0x22, 0xc4, 0xdf, 0x00,
-	0x06, 0x00, 0x27, 0x3d, 0xa6, 0x0d, 0x04, 0x80, 0xbe, 0x04, 0xea, 0x70,
-	0xc7, 0x8c, 0x0e, 0x1b, 0x1f, 0x21, 0xa8, 0xee, 0x64, 0x4c, 0xd6, 0xbf,
-	0xcb, 0xbd, 0x92, 0x90, 0x34, 0x8e, 0xf7, 0xa1, 0x8f, 0x7d, 0xe8, 0xd1,
-	0xdc, 0xdd, 0x5d, 0x88, 0x1c, 0x1b, 0x59, 0xe3, 0x2e, 0x42, 0x92, 0x4b,
-	0x6d, 0x6b, 0xed, 0x54, 0x10, 0xc2, 0xb7, 0x12, 0x07, 0xb3, 0xad, 0x5a,
-	0x05, 0x45, 0x53, 0x38, 0xfe, 0xab, 0xbd, 0xcb, 0x36, 0xf0, 0xd8, 0xbd,
-	0x21, 0x86, 0x54, 0xd0, 0xb8, 0x1c, 0xc8, 0x42, 0x04, 0x49, 0x75, 0x86,
-	0x1e, 0xb5, 0xb4, 0x5e, 0xb7, 0x1c, 0xdf, 0xa5, 0x3c, 0xf9, 0xe7, 0xb9,
-	0x6e, 0x3c, 0xce, 0x5d, 0x29, 0x9b, 0x6d, 0xfe, 0xda, 0xd8, 0xe3, 0x6c,
-	0x00, 0xbc, 0x19, 0x0e, 0x22, 0xc1, 0x05, 0x7b, 0xbd, 0x4a, 0x96, 0x09,
-	0x23, 0x92, 0xac, 0x9b, 0x49, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06,
-	0x30, 0x75, 0x33, 0x06, 0x18, 0x63, 0x00, 0xe7, 0x88, 0xa9, 0xf4, 0x96,
-	0x20, 0x0e, 0xaa, 0xcc, 0xba, 0x64, 0x59, 0xf7, 0x10, 0xd0, 0xe3, 0x88,
-	0x71, 0x11, 0x12, 0x51, 0xe3, 0x46, 0x3d, 0x3c, 0x8a, 0xe9, 0x2c, 0x86,
-	0x68, 0xdf, 0xa9, 0xe7, 0x82, 0x2f, 0x15, 0x96, 0x01, 0x98, 0x8e, 0x99,
-	0xd9, 0x80, 0x18, 0x46, 0xef, 0xef, 0x16, 0x47, 0xd3, 0x34, 0xde, 0xf5,
-	0x47, 0xf7, 0xaa, 0x03, 0xf6, 0x3d, 0x09, 0x8a, 0x01, 0xb2, 0x58, 0x11,
-	0xd5, 0xbe, 0x39, 0x76, 0x27, 0x25, 0xd9, 0xa3, 0x9b, 0x07, 0xd6, 0x64,
-	0xd3, 0x0e, 0x15, 0x10, 0xe3, 0xc8, 0xbc, 0x11, 0xee, 0x2e, 0xa9, 0xdf,
-	0x2f, 0xab, 0x2f, 0x4d, 0xeb, 0x93, 0x07, 0x67, 0x4f, 0xeb, 0xb9, 0x7c,
-	0x4d, 0xf2, 0x4c, 0x27, 0x02, 0x00, 0xf8, 0x6e, 0xc3, 0x9f, 0xcc, 0xf7,
-	0xdd, 0x7f, 0x1d, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xbc, 0x6d,
-	0x37, 0x27, 0x98, 0x61, 0xc0, 0xd9, 0x92, 0xe6, 0xa0, 0xf3, 0x08, 0xa8,
-	0x78, 0x21, 0x82, 0x39, 0x3c, 0xfb, 0xde, 0x3b, 0x09, 0x8c, 0x8f, 0xff,
-	0xff, 0xff, 0xff, 0xfd, 0x41, 0xd0, 0x4c, 0xdb, 0xbf, 0xef, 0xeb, 0x1c,
-	0x71, 0x82, 0x04, 0x00, 0x15, 0xcd, 0x63, 0xc7, 0x83, 0x2a, 0x69, 0xdc,
-	0x2a, 0x29, 0x75, 0xa7, 0x01, 0xb1, 0x49, 0x21, 0x0a, 0xb0, 0x2c, 0x80,
-	0x1b, 0x40, 0x72, 0x0d, 0x21, 0x2b, 0xe9, 0xeb, 0x93, 0x21, 0x7d, 0x92,
-	0x46, 0x96, 0x46, 0xfb, 0x50, 0xf5, 0xac, 0xe9, 0x5e, 0x43, 0x75, 0x37,
-	0xf9, 0xd6, 0xeb, 0xdd, 0xf3, 0xfd, 0xf9, 0x57, 0x5e, 0x32, 0xaf, 0x1a,
-	0xdc, 0x8d, 0xff, 0x1d, 0xab, 0xa9, 0x7a, 0xcf, 0x97, 0x39, 0x7a, 0xf0,
-	0xda, 0xe8, 0x0f, 0xfe, 0xd8, 0x81, 0x42, 0x5a, 0x81, 0xa0, 0x37, 0xa3,
-	0xd0, 0x29, 0xff, 0xfb, 0x20, 0xc4, 0xe7, 0x00, 0x06, 0xd0, 0x6f, 0x33,
-	0x27, 0x98, 0x62, 0xc0, 0xdb, 0x8d, 0xe6, 0xf0, 0xc0, 0x0d, 0x80, 0x04,
-	0x05, 0xe1, 0x59, 0xe0, 0x4c, 0x80, 0xa4, 0xe2, 0x31, 0xc2, 0xa0, 0xe0,
-	0xcb, 0xd3, 0xae, 0x27, 0x4d, 0xf5, 0x34, 0x1d, 0x96, 0x90, 0xdf, 0xd1,
-	0xce, 0xc4, 0x92, 0x2b, 0x6b, 0x5c, 0xa4, 0xaa, 0x8a, 0xa9, 0xfd, 0xa7,
-	0x3d, 0xca, 0x4c, 0x07, 0x56, 0x9f, 0x57, 0x5b, 0x09, 0x77, 0xfe, 0x79,
-	0x85, 0x9f, 0xce, 0xd5, 0x02, 0xc1, 0x06, 0x0a, 0x94, 0x15, 0x20, 0x7c,
-	0x57, 0x8c, 0xb4, 0x31, 0xa5, 0x74, 0xd4, 0x32, 0x6c, 0x87, 0x90, 0xa1,
-	0xa6, 0x46, 0xa1, 0x09, 0x6b, 0xad, 0xd3, 0xa2, 0x41, 0x0f, 0x63, 0xee,
-	0x60, 0x87, 0x3e, 0x60, 0xb4, 0x86, 0x08, 0x9d, 0x26, 0x76, 0x02, 0x75,
-	0x38, 0x8b, 0x77, 0x84, 0xce, 0xb8, 0x3f, 0x81, 0xc9, 0x20, 0x24, 0xe2,
-	0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0xb4, 0x75, 0x53, 0x84, 0x84,
-	0x74, 0xb0, 0xdd, 0x88, 0x29, 0xb0, 0xc0, 0x8a, 0x0e, 0xaf, 0x21, 0xd0,
-	0xa1, 0x51, 0xc8, 0x1c, 0xde, 0xda, 0x45, 0x09, 0x34, 0x48, 0x03, 0x60,
-	0x50, 0x85, 0xd4, 0xb9, 0x06, 0x0a, 0x18, 0xa2, 0x49, 0xa7, 0x53, 0x0c,
-	0x6a, 0x1a, 0x88, 0x83, 0x05, 0x8f, 0x7d, 0x35, 0x14, 0xa8, 0xa3, 0xdc,
-	0x1f, 0x60, 0x5f, 0x54, 0xc9, 0xb0, 0xe2, 0x18, 0xa3, 0x7a, 0xa6, 0xc4,
-	0x15, 0x60, 0x89, 0xf3, 0x24, 0x94, 0xc5, 0x13, 0x22, 0x18, 0x5b, 0x8f,
-	0x1b, 0xd1, 0x72, 0x68, 0x8b, 0xa4, 0x20, 0x01, 0x07, 0x14, 0x60, 0xab,
-	0x29, 0x2d, 0xb6, 0x45, 0x0d, 0x46, 0xda, 0x65, 0x21, 0x71, 0x03, 0xf6,
-	0x44, 0x65, 0x38, 0x77, 0x96, 0x7e, 0xa0, 0x21, 0x15, 0xcb, 0x67, 0x2a,
-	0xf1, 0x61, 0x30, 0xf8, 0x5c, 0xd2, 0x45, 0x3b, 0x7c, 0xb2, 0x1d, 0xff,
-	0xfb, 0x22, 0xc4, 0xe7, 0x00, 0x06, 0xe4, 0x43, 0x5d, 0xb4, 0xc3, 0x00,
-	0x31, 0x83, 0xa5, 0xe6, 0x83, 0x1e, 0xb0, 0x00, 0x7b, 0x9c, 0x66, 0xb8,
-	0x62, 0x48, 0x28, 0xcc, 0x18, 0xc8, 0xdf, 0xba, 0x36, 0x9a, 0xb4, 0x9b,
-	0x7c, 0x8f, 0x35, 0x69, 0xd3, 0xa8, 0x58, 0xc1, 0x21, 0x43, 0xb2, 0xcb,
-	0x06, 0xce, 0x43, 0xd7, 0xe7, 0x08, 0xa5, 0x15, 0x1d, 0xb9, 0x46, 0x5d,
-	0x26, 0x11, 0xb5, 0xd6, 0x92, 0xac, 0x1c, 0x51, 0x22, 0x36, 0xb1, 0x51,
-	0xf5, 0x1a, 0x00, 0xc0, 0xb6, 0x0d, 0x4a, 0x08, 0x63, 0xb8, 0xe4, 0x3e,
-	0x39, 0x00, 0x80, 0x54, 0x31, 0x24, 0x64, 0xd2, 0x68, 0x40, 0x27, 0x8d,
-	0x08, 0xf6, 0xdc, 0x68, 0xd3, 0xc6, 0x69, 0x95, 0x0e, 0xf4, 0xbe, 0xee,
-	0x98, 0xab, 0xe9, 0xb0, 0x48, 0xd4, 0x1a, 0xfd, 0x55, 0xf6, 0x61, 0x8f,
-	0xfa, 0xa9, 0xbb, 0xd9, 0xab, 0xc5, 0x6b, 0xff, 0xd6, 0xcd, 0xff, 0xfb,
-	0x20, 0xc4, 0xd2, 0x00, 0x0b, 0x3c, 0xe7, 0x57, 0x38, 0x94, 0x80, 0x00,
-	0xd5, 0x0d, 0xe9, 0x17, 0x98, 0x60, 0x00, 0xa5, 0x01, 0xa4, 0x00, 0x04,
-	0x17, 0xe2, 0xde, 0x2e, 0x21, 0x94, 0x8f, 0x9b, 0x4e, 0x8d, 0xc4, 0xd0,
-	0x5d, 0xd2, 0xca, 0x57, 0xef, 0xf0, 0xd9, 0xd8, 0xc1, 0x0d, 0x84, 0xa4,
-	0xe7, 0xd3, 0xbc, 0x5c, 0x33, 0xb3, 0x1d, 0x12, 0x25, 0x60, 0xec, 0x8a,
-	0x20, 0x50, 0xa2, 0x0c, 0xa1, 0x29, 0x02, 0x39, 0x46, 0x3b, 0x4b, 0x4d,
-	0x74, 0x9e, 0xc4, 0x67, 0x48, 0x88, 0x88, 0xb8, 0x9a, 0x5c, 0x47, 0xa4,
-	0x69, 0xba, 0x08, 0xd0, 0x20, 0x24, 0xac, 0x58, 0x78, 0xd9, 0xd9, 0x99,
-	0xd4, 0x3c, 0xb8, 0xe1, 0x2b, 0x28, 0x8b, 0xa6, 0x4e, 0x8c, 0xa2, 0xa6,
-	0x16, 0x8d, 0x52, 0xe0, 0xce, 0x83, 0x58, 0xdd, 0x33, 0x19, 0x78, 0x2d,
-	0x43, 0x05, 0x8e, 0x10, 0x50, 0x0a, 0x8e, 0x0c, 0xff, 0xfb, 0x22, 0xc4,
-	0xc0, 0x80, 0x08, 0x28, 0x6f, 0x41, 0x27, 0xb0, 0x67, 0x01, 0x16, 0x0d,
-	0x67, 0x6c, 0xf3, 0x0d, 0x20, 0x30, 0x94, 0xe9, 0x50, 0xb3, 0x40, 0xe5,
-	0x4a, 0xc5, 0x03, 0xaf, 0x61, 0xd4, 0x20, 0xee, 0xc6, 0x1d, 0xf5, 0x04,
-	0x40, 0x04, 0x15, 0x06, 0xc9, 0x25, 0x64, 0xc9, 0xcd, 0x80, 0xd0, 0x6a,
-	0x00, 0xe8, 0x11, 0x15, 0x1c, 0x60, 0xe9, 0x45, 0x92, 0x30, 0x42, 0x08,
-	0xc1, 0x37, 0x10, 0x74, 0x48, 0x22, 0x04, 0x91, 0x78, 0x79, 0xa9, 0xa8,
-	0x78, 0x3f, 0x03, 0x8a, 0x08, 0x1e, 0x97, 0x35, 0x1a, 0xba, 0xad, 0xf5,
-	0xd7, 0x99, 0x73, 0x18, 0xff, 0x5b, 0x93, 0x6b, 0x74, 0xb3, 0xea, 0x18,
-	0x13, 0x87, 0x83, 0x62, 0xe0, 0xc6, 0x01, 0x81, 0x09, 0x18, 0x5d, 0xb7,
-	0x2a, 0xe4, 0xc0, 0x54, 0x4f, 0x67, 0x63, 0x8b, 0x64, 0x18, 0xa8, 0xe6,
-	0xc5, 0x12, 0x44, 0xf0, 0xc4, 0xd0, 0x34, 0xff, 0xfb, 0x22, 0xc4, 0xb4,
-	0x00, 0x88, 0xfc, 0x99, 0x3b, 0x8c, 0x30, 0x65, 0xc1, 0x16, 0x87, 0x27,
-	0x71, 0x86, 0x18, 0x61, 0x16, 0x53, 0x3e, 0x2c, 0x61, 0x13, 0xdf, 0xff,
-	0xa9, 0x3d, 0x6d, 0x47, 0x7a, 0x95, 0x09, 0x37, 0x0c, 0x40, 0x40, 0xca,
-	0x02, 0x60, 0x9a, 0x22, 0xa6, 0x5c, 0x9b, 0x72, 0x51, 0x54, 0x08, 0xfc,
-	0xe3, 0x6f, 0xba, 0x4e, 0x22, 0xa8, 0xba, 0x6a, 0x1f, 0x5b, 0x4c, 0xf3,
-	0x1b, 0x23, 0x41, 0xdc, 0xa8, 0xca, 0x46, 0xa7, 0x05, 0x08, 0xbb, 0xdd,
-	0x2c, 0x8e, 0xd7, 0x52, 0x1d, 0xb1, 0xcd, 0x1a, 0xa2, 0xec, 0x04, 0x31,
-	0xc8, 0x39, 0x60, 0x0c, 0xb4, 0x82, 0xbe, 0x97, 0xfa, 0x35, 0x12, 0xc7,
-	0x9f, 0xb3, 0x7f, 0x6b, 0x52, 0x4c, 0x47, 0x8b, 0x7f, 0x9c, 0x81, 0xfa,
-	0x24, 0x63, 0x37, 0x29, 0x7e, 0xce, 0x74, 0x66, 0x9a, 0xfd, 0xaf, 0xf5,
-	0x5f, 0xa5, 0x01, 0xc8, 0xe4, 0xa8, 0xff, 0xfb, 0x20, 0xc4, 0xa4, 0x00,
-	0x07, 0xf8, 0x73, 0x35, 0x07, 0xb0, 0x61, 0xc1, 0x06, 0x0e, 0x66, 0xa0,
-	0xf6, 0x0c, 0x30, 0xd0, 0xc2, 0x01, 0xa8, 0x5a, 0x85, 0xd1, 0x61, 0xf9,
-	0x02, 0xcb, 0x3e, 0x70, 0x26, 0x06, 0x99, 0x18, 0x41, 0x2b, 0x2c, 0xb8,
-	0x94, 0xc9, 0xf0, 0x20, 0x1d, 0xf6, 0x5c, 0xd0, 0x33, 0xcb, 0x24, 0x50,
-	0x52, 0xce, 0x91, 0x65, 0x18, 0x7d, 0xce, 0xff, 0x57, 0xc8, 0x8c, 0xd3,
-	0x20, 0x24, 0x00, 0x02, 0x70, 0x7e, 0x5c, 0x2c, 0xb0, 0xb0, 0x68, 0x3d,
-	0x06, 0x20, 0x7c, 0x58, 0x58, 0xc3, 0x68, 0xcb, 0x5e, 0x37, 0x2e, 0x4f,
-	0xba, 0x74, 0xbb, 0xa0, 0x70, 0xdb, 0x0e, 0x21, 0x0a, 0x08, 0x4a, 0x92,
-	0xe1, 0x4d, 0x4b, 0x6b, 0x13, 0xd5, 0x47, 0x3d, 0xd2, 0x77, 0x5e, 0x95,
-	0x40, 0x18, 0x0c, 0xc7, 0x21, 0x34, 0xf6, 0x6d, 0x10, 0x2e, 0xd9, 0x81,
-	0x12, 0x42, 0x0f, 0x59, 0xff, 0xfb, 0x22, 0xc4, 0x99, 0x80, 0x06, 0x54,
-	0x2b, 0x3f, 0x84, 0xb0, 0xc0, 0x40, 0xca, 0x86, 0xea, 0xb0, 0xc4, 0xa4,
-	0x06, 0x8c, 0x9d, 0xc9, 0x54, 0xdc, 0x1a, 0xab, 0xce, 0x7b, 0xfc, 0x84,
-	0x9a, 0x20, 0x88, 0xf3, 0xeb, 0x36, 0xef, 0x61, 0x33, 0x2a, 0xfd, 0xcd,
-	0xea, 0xd5, 0xfb, 0x6e, 0xd9, 0x6f, 0xff, 0x6f, 0xad, 0xd1, 0xc6, 0xc0,
-	0x01, 0x52, 0x4d, 0x14, 0x9b, 0x09, 0x96, 0x57, 0xcd, 0x30, 0x5e, 0x42,
-	0x92, 0x91, 0x81, 0x56, 0x0d, 0x14, 0x51, 0x11, 0xad, 0x05, 0x80, 0x42,
-	0xdd, 0x4d, 0x4c, 0xab, 0x49, 0x06, 0x99, 0xf1, 0xea, 0x75, 0xcc, 0x7f,
-	0x37, 0x17, 0xaf, 0x97, 0x00, 0x4b, 0x0b, 0x8b, 0x1a, 0x0d, 0x41, 0x84,
-	0x01, 0xda, 0xe8, 0xb0, 0x11, 0xa9, 0x19, 0x94, 0x56, 0x31, 0xb0, 0x98,
-	0x63, 0x56, 0xcd, 0x0a, 0x77, 0xf7, 0x25, 0x97, 0x76, 0x21, 0x73, 0x1d,
-	0x03, 0xa8, 0xb0, 0xff, 0xfb, 0x20, 0xc4, 0x9d, 0x80, 0x05, 0xbc, 0x75,
-	0x3b, 0x84, 0x84, 0x70, 0xc0, 0xb7, 0x92, 0xe7, 0xf0, 0xc0, 0x8e, 0x28,
-	0x4f, 0xd7, 0x86, 0x0d, 0x35, 0x0b, 0xbd, 0x95, 0x7d, 0xfa, 0xdd, 0xdf,
-	0xef, 0xf6, 0xd6, 0xca, 0xe0, 0x00, 0x2a, 0x6d, 0x08, 0x8c, 0x02, 0x80,
-	0x68, 0x2c, 0x06, 0x6a, 0x41, 0x9d, 0x17, 0x81, 0x09, 0x22, 0x44, 0xba,
-	0x32, 0x9a, 0x8b, 0x29, 0x4b, 0x9c, 0x50, 0xc9, 0xcb, 0x01, 0x01, 0x40,
-	0x69, 0x45, 0x19, 0xd1, 0x20, 0x3e, 0x91, 0x42, 0x8e, 0x42, 0x16, 0x00,
-	0x37, 0x22, 0x84, 0xa0, 0xad, 0x83, 0x80, 0x23, 0x4a, 0x66, 0x36, 0xbd,
-	0x1f, 0xc6, 0xac, 0x5a, 0xa7, 0x5e, 0xe2, 0x42, 0x83, 0x4a, 0x52, 0xa6,
-	0x5d, 0xb5, 0x7d, 0x7e, 0x93, 0x54, 0x4e, 0x67, 0x0a, 0x15, 0x25, 0xb1,
-	0xfe, 0x86, 0x9d, 0x74, 0x9e, 0x9e, 0xaf, 0xdf, 0x2b, 0xdc, 0x17, 0xba,
-	0xfd, 0xff, 0xfb, 0x22, 0xc4, 0xa6, 0x00, 0x05, 0xe4, 0x2d, 0x3b, 0x85,
-	0xb0, 0xc0, 0x40, 0xbb, 0x0e, 0xa6, 0xe4, 0xc1, 0x88, 0xb8, 0xec, 0x8c,
-	0x34, 0x90, 0x02, 0x01, 0x6d, 0x4e, 0x4c, 0x9b, 0x05, 0x26, 0x74, 0x39,
-	0x96, 0x94, 0xb3, 0x87, 0x39, 0xe3, 0x4a, 0xe3, 0x64, 0xaf, 0x5a, 0x58,
-	0x49, 0x30, 0x8c, 0x6b, 0x08, 0x1f, 0x35, 0x56, 0x2a, 0x2c, 0xb3, 0xac,
-	0xa2, 0x7a, 0xf7, 0xd0, 0x5f, 0x45, 0xd5, 0xd5, 0x05, 0x26, 0x9c, 0x44,
-	0xd8, 0x0d, 0x81, 0x2b, 0x29, 0xd5, 0xc8, 0xd1, 0x33, 0xf2, 0xf1, 0xbd,
-	0x6a, 0x9b, 0x88, 0x85, 0xd7, 0x33, 0xf9, 0x23, 0xe5, 0x0c, 0xa1, 0xf3,
-	0x63, 0xb1, 0x94, 0xf3, 0x1f, 0x8b, 0x92, 0x14, 0x1d, 0xeb, 0xa6, 0x4a,
-	0x52, 0xea, 0x3c, 0x23, 0xff, 0xfc, 0xd8, 0x96, 0xdf, 0xb6, 0xca, 0x32,
-	0x89, 0x00, 0x00, 0x54, 0xb3, 0x62, 0x00, 0x6e, 0x39, 0x6e, 0xe0, 0xa9,
-	0xff, 0xfb, 0x22, 0xc4, 0xae, 0x00, 0x05, 0xdc, 0x63, 0x37, 0x26, 0x18,
-	0x63, 0x00, 0xb0, 0x04, 0xab, 0xf4, 0xf0, 0x99, 0x46, 0x07, 0x3a, 0x7c,
-	0x18, 0x6d, 0x4c, 0x33, 0x55, 0x62, 0x9e, 0x0b, 0x12, 0x39, 0x91, 0xc0,
-	0xd9, 0xa0, 0x93, 0xc2, 0x41, 0x43, 0x67, 0x5d, 0xe4, 0x80, 0x61, 0x6d,
-	0x5f, 0x77, 0xff, 0xfa, 0x15, 0x77, 0x6d, 0xb6, 0xb6, 0xc8, 0x9a, 0x49,
-	0x00, 0xa0, 0x44, 0x02, 0x34, 0x11, 0x6c, 0x3b, 0x29, 0x39, 0x0c, 0x47,
-	0x1b, 0x6a, 0x82, 0x26, 0x41, 0x31, 0x54, 0x87, 0xc1, 0x30, 0x92, 0xef,
-	0x32, 0x92, 0x2f, 0xba, 0x2a, 0x40, 0x9f, 0xaf, 0xb5, 0xbb, 0xfa, 0x79,
-	0xe1, 0x9a, 0xbf, 0x5e, 0x89, 0x66, 0xd6, 0xdd, 0x6c, 0xc0, 0x16, 0x08,
-	0x62, 0x30, 0xfe, 0x79, 0x43, 0x62, 0xfb, 0x87, 0xad, 0x22, 0x07, 0xe5,
-	0xb2, 0x02, 0x10, 0x24, 0xf7, 0x62, 0x5f, 0x41, 0x02, 0x35, 0x56, 0xff,
-	0xfb, 0x20, 0xc4, 0xb7, 0x80, 0x06, 0x08, 0x75, 0x35, 0x07, 0x98, 0x65,
-	0x40, 0xc2, 0x88, 0x2c, 0x34, 0x93, 0x0c, 0x66, 0xb2, 0xb6, 0xda, 0x79,
-	0x4e, 0xfe, 0x92, 0xb9, 0xfe, 0xef, 0xa3, 0xfc, 0xe7, 0xd0, 0x29, 0xcb,
-	0x7e, 0xd5, 0xfb, 0xa0, 0x81, 0xf0, 0xb1, 0x50, 0xb8, 0x96, 0x0c, 0xf7,
-	0xb7, 0x4c, 0xa0, 0x7c, 0xe3, 0xb9, 0x0a, 0x96, 0xac, 0x26, 0x6d, 0x73,
-	0x7d, 0x2f, 0x9c, 0xe7, 0x29, 0xac, 0x3c, 0xa5, 0x13, 0x60, 0x93, 0x4e,
-	0xc4, 0x5e, 0xbd, 0xbe, 0xed, 0x4d, 0xff, 0x9e, 0xd0, 0xd7, 0x57, 0x86,
-	0x14, 0x70, 0x01, 0x24, 0xae, 0x05, 0xfa, 0x04, 0x22, 0xba, 0x46, 0x8c,
-	0x56, 0x46, 0x8d, 0xbb, 0x82, 0x82, 0xcc, 0x86, 0x77, 0xcb, 0x34, 0x2a,
-	0x81, 0x14, 0x5b, 0xec, 0xb5, 0x61, 0x67, 0x2c, 0xd0, 0x5f, 0xb7, 0x6d,
-	0x6a, 0x62, 0xff, 0xca, 0xdc, 0x8e, 0xbf, 0xee, 0xaa, 0xff, 0xfb, 0x22,
-	0xc4, 0xbd, 0x80, 0x05, 0xdc, 0x6d, 0x39, 0x86, 0x0c, 0x4d, 0x00, 0xc1,
-	0x06, 0x68, 0xb4, 0xc1, 0x18, 0x84, 0x2f, 0xe7, 0x9a, 0x98, 0x5e, 0xc0,
-	0x21, 0x69, 0xe6, 0xf5, 0x0a, 0x50, 0xd9, 0x1c, 0xd0, 0xec, 0xee, 0x46,
-	0x88, 0xf5, 0x27, 0xc0, 0x02, 0x81, 0xd4, 0xbb, 0xd4, 0x9d, 0x48, 0xdd,
-	0xd5, 0xa0, 0x78, 0xa0, 0x98, 0xc0, 0x07, 0x69, 0xe6, 0x70, 0xf1, 0x28,
-	0x1a, 0x19, 0x22, 0x82, 0x30, 0x35, 0x11, 0xff, 0xfe, 0x93, 0x40, 0x50,
-	0x00, 0x4a, 0x96, 0x63, 0x43, 0xcf, 0xff, 0xd4, 0x6b, 0x24, 0x68, 0x20,
-	0xa0, 0xfa, 0x99, 0x7f, 0xff, 0xfc, 0x81, 0x44, 0xb9, 0xbf, 0xef, 0x46,
-	0xd6, 0xac, 0xbf, 0xcb, 0xf9, 0xf6, 0x43, 0x38, 0x42, 0xc1, 0xed, 0x72,
-	0xee, 0x32, 0x5a, 0x57, 0x2a, 0xa9, 0x86, 0xe7, 0x49, 0x52, 0x85, 0x25,
-	0x67, 0x12, 0xb3, 0x4f, 0x00, 0xd3, 0x3f, 0x99, 0xff, 0xfb, 0x20, 0xc4,
-	0xc4, 0x80, 0x05, 0xd4, 0x65, 0x39, 0x87, 0xa4, 0x62, 0xc0, 0xc2, 0x88,
-	0x68, 0x74, 0x93, 0x0c, 0xe4, 0x6d, 0xce, 0xdb, 0x49, 0x76, 0x6a, 0x66,
-	0xaf, 0x47, 0x24, 0x45, 0xe6, 0x7f, 0x52, 0x89, 0x15, 0xc8, 0xf4, 0xe5,
-	0x6a, 0x08, 0x83, 0x42, 0x7c, 0x80, 0x0b, 0x09, 0x2a, 0x4f, 0x29, 0xd4,
-	0x32, 0xa9, 0x58, 0xce, 0xe6, 0x5c, 0xaf, 0xb0, 0xa4, 0x30, 0x28, 0x85,
-	0x24, 0x6f, 0x38, 0xe9, 0x49, 0xb9, 0x66, 0xb4, 0x19, 0x65, 0x64, 0x04,
-	0x56, 0xb9, 0xa5, 0x51, 0x76, 0x44, 0x22, 0xab, 0xe9, 0x6f, 0xdd, 0x7c,
-	0x39, 0x85, 0x0c, 0x25, 0x69, 0x44, 0xaf, 0x3e, 0xb1, 0x1d, 0x28, 0x80,
-	0x00, 0x0c, 0x50, 0xad, 0x59, 0x59, 0x15, 0xc6, 0x73, 0xc7, 0xc0, 0x65,
-	0x59, 0xba, 0x20, 0x34, 0x4f, 0x8a, 0x8b, 0x48, 0xfb, 0x82, 0xa4, 0xc4,
-	0xa3, 0x09, 0xcd, 0x05, 0x1f, 0xf8, 0xff, 0xfb, 0x22, 0xc4, 0xcb, 0x00,
-	0x85, 0xf0, 0x21, 0x5b, 0xa4, 0xa5, 0x22, 0xb0, 0xb1, 0x88, 0x6a, 0xf0,
-	0xc2, 0x8d, 0x4e, 0xa4, 0x35, 0xa4, 0x83, 0xb7, 0xf4, 0x2b, 0x91, 0x07,
-	0x57, 0x19, 0x6a, 0x50, 0xb5, 0x0d, 0x12, 0x49, 0x87, 0xcf, 0x8a, 0x3b,
-	0xa0, 0x63, 0x08, 0x7e, 0xaa, 0x30, 0x09, 0x62, 0x04, 0x74, 0x1b, 0x81,
-	0x14, 0x92, 0xa1, 0xc1, 0x77, 0xe3, 0x06, 0xc5, 0x24, 0x20, 0xb1, 0x12,
-	0xe2, 0x51, 0x44, 0xa8, 0x25, 0x22, 0xcd, 0x93, 0xcf, 0xf8, 0xca, 0x5b,
-	0xbc, 0x2d, 0x04, 0x73, 0xff, 0xa7, 0xa9, 0xb3, 0x97, 0xfa, 0x61, 0xbf,
-	0xa2, 0xd0, 0x6b, 0xc4, 0x8a, 0x8c, 0x3a, 0xb6, 0xa1, 0x83, 0x09, 0x31,
-	0xf0, 0x5c, 0xa0, 0x61, 0x74, 0x66, 0x84, 0xc6, 0x54, 0x0d, 0x36, 0x7e,
-	0x2b, 0xf3, 0x61, 0xbd, 0x1c, 0xd2, 0x89, 0x1a, 0x60, 0x5e, 0x1f, 0x8a,
-	0x83, 0xbc, 0x05, 0x90, 0x60, 0xff, 0xfb, 0x22, 0xc4, 0xd4, 0x00, 0x05,
-	0xdc, 0x73, 0x43, 0x84, 0x8c, 0x4d, 0xa0, 0xbf, 0x88, 0xe7, 0xe6, 0x92,
-	0x30, 0x00, 0x6d, 0x71, 0x28, 0xf2, 0x12, 0x7e, 0x2a, 0x42, 0x3e, 0x51,
-	0x0f, 0x68, 0x91, 0x82, 0xf3, 0x29, 0xc0, 0x4a, 0x1c, 0xe3, 0xae, 0x17,
-	0x3e, 0xe6, 0xac, 0x4e, 0x28, 0x42, 0xee, 0x28, 0xd0, 0x20, 0x99, 0x82,
-	0x37, 0x88, 0x85, 0x89, 0xa5, 0x1a, 0xce, 0x0a, 0xb0, 0x65, 0x2d, 0xb7,
-	0x45, 0xe5, 0xe8, 0x21, 0x00, 0x28, 0x5a, 0x40, 0x67, 0x84, 0x2c, 0x60,
-	0x9e, 0xa7, 0x5b, 0x43, 0xce, 0x68, 0x88, 0x20, 0x6d, 0xe4, 0x0c, 0x0e,
-	0x1d, 0x7c, 0x13, 0x6d, 0x97, 0xd0, 0xc7, 0xc0, 0xd4, 0x6e, 0x0c, 0xd7,
-	0xb0, 0xc0, 0x58, 0xfa, 0xad, 0xb0, 0xa7, 0x36, 0x81, 0x01, 0x85, 0xb7,
-	0xf8, 0x53, 0xfc, 0xb8, 0xe2, 0xc0, 0x69, 0xc1, 0x08, 0x0a, 0xab, 0x6e,
-	0xf2, 0xeb, 0x2b, 0x37, 0xff, 0xfb, 0x20, 0xc4, 0xdb, 0x80, 0x0a, 0x70,
-	0xfd, 0x42, 0x18, 0xf4, 0x00, 0x00, 0xb7, 0x0d, 0x28, 0x83, 0x98, 0x60,
-	0x00, 0xad, 0x4a, 0x7e, 0x7a, 0x6c, 0x0b, 0x2d, 0x01, 0x50, 0xc9, 0x07,
-	0x5a, 0xe0, 0xb4, 0x46, 0x60, 0xcd, 0x0c, 0xc5, 0x72, 0x23, 0xc2, 0xea,
-	0x97, 0xdb, 0x1f, 0xb1, 0x49, 0x54, 0x72, 0xdd, 0xdb, 0xab, 0x55, 0xe1,
-	0x97, 0x73, 0x96, 0x5a, 0xc1, 0xc3, 0x68, 0x0c, 0x30, 0x30, 0x6c, 0x0c,
-	0x38, 0x87, 0xf4, 0x02, 0x63, 0x06, 0x29, 0x95, 0x1a, 0xb4, 0x7f, 0x27,
-	0xff, 0x54, 0x62, 0x74, 0xaa, 0x29, 0xe9, 0x6e, 0x91, 0x36, 0x1b, 0x12,
-	0x00, 0x27, 0x28, 0x1b, 0x0c, 0x01, 0xba, 0x44, 0x15, 0x99, 0xc0, 0xe1,
-	0x48, 0x35, 0x18, 0x4d, 0x33, 0xc9, 0xaf, 0x78, 0xb5, 0xeb, 0x97, 0xb6,
-	0x83, 0xa5, 0xc8, 0x18, 0x41, 0x6a, 0x21, 0x63, 0x0a, 0x22, 0x87, 0x11,
-	0x2e, 0x90, 0xff, 0xfb, 0x22, 0xc4, 0xd1, 0x00, 0x07, 0x2c, 0x99, 0x38,
-	0xa7, 0x98, 0x4c, 0xc0, 0xe4, 0x8e, 0xa6, 0x94, 0xf4, 0x8c, 0xa8, 0x44,
-	0xab, 0xdc, 0x9f, 0xfc, 0xd5, 0xe7, 0x1b, 0xae, 0xad, 0x9a, 0x81, 0x24,
-	0x90, 0x83, 0x06, 0x28, 0x88, 0x3d, 0x24, 0x06, 0x95, 0x50, 0x7a, 0x30,
-	0xa0, 0x08, 0xd4, 0x4a, 0xb3, 0xb0, 0xa3, 0xae, 0x7a, 0x1f, 0x8e, 0x12,
-	0xd2, 0x47, 0x32, 0xec, 0x2f, 0xd5, 0x62, 0x1d, 0x28, 0x15, 0x40, 0x58,
-	0xc3, 0x36, 0xe5, 0x28, 0x50, 0x71, 0x50, 0x7d, 0x1a, 0x5f, 0x42, 0x37,
-	0x05, 0x04, 0xe2, 0xc9, 0xde, 0xda, 0xaa, 0x96, 0xed, 0xb6, 0xb6, 0x46,
-	0xdb, 0x08, 0x00, 0x32, 0x97, 0x6a, 0xe4, 0xc0, 0x93, 0x11, 0x95, 0xa5,
-	0xd1, 0xac, 0x3f, 0x34, 0xf2, 0x08, 0xa0, 0xb8, 0xc2, 0x85, 0xd8, 0x2e,
-	0xb2, 0x46, 0xdf, 0xda, 0x1c, 0x34, 0xa1, 0x30, 0x10, 0x49, 0xba, 0xab,
-	0x49, 0xff, 0xfb, 0x20, 0xc4, 0xce, 0x80, 0x08, 0xac, 0x75, 0x35, 0x2c,
-	0x24, 0xc5, 0x01, 0x02, 0x08, 0xa7, 0xf0, 0xf4, 0x8c, 0x74, 0x04, 0x9a,
-	0xbf, 0xfb, 0x9c, 0xc6, 0x17, 0xcd, 0xe9, 0x00, 0x02, 0x01, 0xc6, 0x2c,
-	0x49, 0x66, 0xe5, 0x74, 0x55, 0x1c, 0x31, 0xbe, 0xa8, 0x12, 0x4a, 0x38,
-	0xe2, 0x7a, 0xd0, 0x6d, 0x79, 0x69, 0x99, 0x9a, 0x02, 0xc9, 0xef, 0xf9,
-	0x69, 0x62, 0x37, 0x70, 0xe6, 0x2e, 0x2e, 0x4b, 0xde, 0xa4, 0x58, 0x9f,
-	0xbd, 0x9d, 0x7f, 0xb3, 0x5d, 0x72, 0xdd, 0x75, 0xd6, 0xc6, 0x9b, 0x68,
-	0x00, 0x02, 0x81, 0x14, 0x05, 0x85, 0x55, 0x84, 0x1c, 0x39, 0x6d, 0x95,
-	0x65, 0x4e, 0x51, 0xf4, 0x0c, 0xc6, 0x29, 0x86, 0x05, 0xc5, 0x4d, 0x0f,
-	0x67, 0x3a, 0xb7, 0x28, 0x44, 0x58, 0x8b, 0x7a, 0xe9, 0x97, 0x6b, 0xc9,
-	0x73, 0x08, 0x45, 0xf7, 0xe8, 0xae, 0x6f, 0xf7, 0xff, 0xeb, 0x63, 0xff,
-	0xfb, 0x22, 0xc4, 0xc2, 0x00, 0x08, 0x18, 0x9f, 0x33, 0x67, 0xa4, 0x63,
-	0x80, 0xe9, 0x8e, 0x66, 0x60, 0xf6, 0x0c, 0x30, 0xac, 0x30, 0x02, 0x41,
-	0x85, 0x26, 0x48, 0xd5, 0xf0, 0x90, 0xdd, 0xb7, 0xa2, 0x60, 0x24, 0x6b,
-	0x11, 0x28, 0xec, 0xd3, 0xeb, 0x2f, 0x1a, 0x45, 0x42, 0x5d, 0x95, 0xbf,
-	0x9f, 0x22, 0xea, 0x8d, 0x29, 0x86, 0x92, 0x0b, 0xcb, 0x13, 0xd6, 0xbf,
-	0xfd, 0x28, 0xec, 0x97, 0x17, 0xcb, 0xb5, 0x91, 0x56, 0x51, 0x20, 0x00,
-	0xce, 0x6d, 0xa1, 0x2a, 0x51, 0x7e, 0xb0, 0xdc, 0x3b, 0x04, 0x98, 0x36,
-	0x19, 0x31, 0xaa, 0x7b, 0xb6, 0x65, 0xbb, 0x0e, 0x22, 0x26, 0xdc, 0x13,
-	0x89, 0xde, 0x70, 0x72, 0xde, 0x86, 0xd9, 0x9b, 0x70, 0x1f, 0x5a, 0xfb,
-	0xe9, 0xfe, 0xb0, 0x67, 0xbc, 0x20, 0x01, 0x8a, 0x02, 0x25, 0xd5, 0x0a,
-	0xb8, 0xa0, 0x23, 0xdd, 0x91, 0x5a, 0x77, 0x3b, 0x54, 0x06, 0xff, 0xfb,
-	0x22, 0xc4, 0xbb, 0x00, 0x07, 0x08, 0x43, 0x3f, 0xa4, 0x84, 0xc6, 0x00,
-	0xe3, 0x0e, 0xa6, 0x20, 0xf3, 0x0c, 0xa8, 0x8f, 0x7a, 0xb3, 0x5e, 0x74,
-	0x77, 0xb5, 0xbf, 0x92, 0x7a, 0xe2, 0x40, 0x77, 0x80, 0xc2, 0x89, 0x24,
-	0x31, 0x1a, 0xaf, 0x17, 0x55, 0xb2, 0x09, 0xd0, 0xdb, 0x77, 0x7e, 0xc5,
-	0x0b, 0xeb, 0x76, 0xd2, 0x60, 0x13, 0x70, 0x00, 0x1d, 0x0e, 0xab, 0x90,
-	0x06, 0xc3, 0x68, 0x15, 0x74, 0x95, 0x8b, 0x0b, 0xca, 0x29, 0x26, 0x8e,
-	0x4a, 0xac, 0xad, 0x22, 0xf5, 0xc3, 0x82, 0x0a, 0x9b, 0xfb, 0x5c, 0x51,
-	0x29, 0x66, 0xfb, 0x9d, 0x12, 0xd3, 0x63, 0x3f, 0xbb, 0x14, 0x05, 0xa6,
-	0xf5, 0x71, 0x49, 0x00, 0x82, 0x44, 0xa7, 0x18, 0x40, 0x09, 0x41, 0x48,
-	0xac, 0xa2, 0x03, 0x04, 0x43, 0x2b, 0x4b, 0x31, 0x2e, 0x9f, 0x0d, 0x80,
-	0xd0, 0xfd, 0xa0, 0x08, 0x5e, 0x27, 0x20, 0x28, 0x58, 0xff, 0xfb, 0x20,
-	0xc4, 0xb9, 0x80, 0x06, 0x04, 0x29, 0x5b, 0xa7, 0xa5, 0x22, 0x30, 0xc2,
-	0x0d, 0x66, 0xa4, 0xf3, 0x0c, 0xe0, 0xfc, 0xd1, 0x77, 0x4f, 0x94, 0x9b,
-	0x43, 0xbf, 0xda, 0x42, 0xeb, 0x7d, 0x4a, 0x2a, 0xaa, 0x91, 0x41, 0x90,
-	0x09, 0x81, 0x7c, 0x5a, 0x53, 0x23, 0xe2, 0xdd, 0x41, 0xf6, 0x50, 0xe5,
-	0xcf, 0x98, 0x93, 0x60, 0x4c, 0xd7, 0x3d, 0x89, 0x2c, 0x7f, 0xfe, 0xfe,
-	0x61, 0x75, 0x82, 0xa3, 0xa0, 0x61, 0xd8, 0xa9, 0xcf, 0x68, 0x6d, 0x48,
-	0x22, 0x6a, 0x2a, 0xb6, 0xfe, 0x8f, 0xba, 0x50, 0x1b, 0x24, 0x92, 0xc1,
-	0x00, 0x29, 0x78, 0x31, 0x35, 0x3f, 0x33, 0x3f, 0x6a, 0xd0, 0x3b, 0x0c,
-	0x0a, 0x77, 0x22, 0xd5, 0x30, 0x4e, 0xf5, 0x2f, 0xf5, 0x84, 0xaa, 0x9d,
-	0x4f, 0xef, 0x57, 0x4b, 0x9e, 0x22, 0xe3, 0xfd, 0xc9, 0x40, 0xc4, 0xa3,
-	0xb9, 0xef, 0xf6, 0x26, 0xaa, 0x28, 0xd9, 0xff, 0xfb, 0x22, 0xc4, 0xbf,
-	0x80, 0x06, 0x18, 0x35, 0x59, 0xa4, 0xa4, 0x64, 0xf0, 0xc5, 0x0e, 0xec,
-	0x34, 0xf3, 0x08, 0xee, 0x2c, 0x8c, 0x14, 0x02, 0x42, 0x01, 0x60, 0x07,
-	0x25, 0x1d, 0x19, 0x59, 0x43, 0x36, 0xc0, 0xe6, 0x80, 0xd6, 0x76, 0x4c,
-	0xae, 0xa2, 0x0b, 0x33, 0x6a, 0xb1, 0xb9, 0x64, 0x8a, 0x5e, 0x60, 0x08,
-	0x27, 0x8a, 0x7a, 0x9c, 0x2c, 0x14, 0x86, 0x7f, 0x4e, 0xff, 0xfd, 0x22,
-	0x1e, 0x95, 0x02, 0x22, 0xb3, 0xbc, 0x3a, 0xae, 0x6a, 0x24, 0x40, 0x18,
-	0x26, 0x07, 0xc4, 0x47, 0xfd, 0xe7, 0x83, 0x22, 0x55, 0x9a, 0xc6, 0x11,
-	0xc0, 0x13, 0x38, 0x75, 0xa6, 0xed, 0x62, 0xb9, 0xd6, 0xde, 0x7e, 0xe5,
-	0xcd, 0x69, 0xca, 0x46, 0x33, 0x89, 0x7b, 0x7a, 0xcc, 0xb3, 0x5d, 0xff,
-	0xff, 0xaa, 0x01, 0x44, 0x9b, 0x65, 0x60, 0x42, 0x00, 0xd4, 0x18, 0xa9,
-	0x2e, 0x12, 0xdd, 0xf5, 0x99, 0x6f, 0xff, 0xfb, 0x22, 0xc4, 0xc5, 0x80,
-	0x45, 0xd0, 0x43, 0x43, 0xa7, 0x98, 0x44, 0xe0, 0xc0, 0x0d, 0xa6, 0xa4,
-	0xf3, 0x0c, 0xa8, 0x61, 0x7c, 0x36, 0xed, 0xc0, 0x25, 0x48, 0xa7, 0x6b,
-	0xad, 0x62, 0x02, 0xe8, 0xb2, 0x6b, 0xb3, 0x9e, 0xc7, 0x1f, 0x62, 0x28,
-	0x99, 0x06, 0xbf, 0xb0, 0x3c, 0x6e, 0x7c, 0xa2, 0xc0, 0x1f, 0xfb, 0x15,
-	0x23, 0x92, 0x38, 0xc4, 0x51, 0xc9, 0x14, 0x6a, 0x34, 0x12, 0x88, 0x86,
-	0x40, 0x06, 0x66, 0xc2, 0x41, 0xc0, 0x72, 0x55, 0x7a, 0x93, 0xc5, 0xb0,
-	0x61, 0xf3, 0x7f, 0x34, 0x3c, 0xc8, 0x18, 0x7e, 0x0b, 0x6e, 0xae, 0xe3,
-	0xc1, 0x10, 0x2d, 0x83, 0xc0, 0x4e, 0x7f, 0x1a, 0x29, 0x19, 0x39, 0x62,
-	0xa2, 0x2c, 0xa3, 0x1c, 0x73, 0x1d, 0x32, 0x3c, 0x24, 0x1f, 0x12, 0x10,
-	0x94, 0x18, 0xf9, 0xd9, 0x3a, 0x19, 0x43, 0x88, 0xa7, 0xb1, 0xdf, 0xd8,
-	0xf3, 0xdf, 0x93, 0x98, 0xc5, 0xff, 0xfb, 0x20, 0xc4, 0xcd, 0x00, 0x05,
-	0xc0, 0x41, 0x43, 0xa6, 0x24, 0x61, 0xc0, 0xbd, 0x88, 0x27, 0xb0, 0xf4,
-	0x8c, 0x0c, 0xcc, 0x5a, 0xda, 0xbb, 0x5b, 0x33, 0x31, 0xac, 0x69, 0xea,
-	0xca, 0xb6, 0xff, 0xea, 0xe6, 0x7f, 0x9a, 0x44, 0xf5, 0x9a, 0x69, 0xb6,
-	0xad, 0xd7, 0xd8, 0x06, 0x1d, 0xa2, 0xd5, 0x0b, 0x79, 0x63, 0x24, 0x4d,
-	0x99, 0x34, 0xcf, 0x16, 0x34, 0xf2, 0xfa, 0x81, 0x6d, 0x98, 0x80, 0x32,
-	0x16, 0x74, 0xbe, 0x18, 0x71, 0x50, 0x57, 0xa5, 0x47, 0x82, 0xec, 0x69,
-	0xcf, 0xf2, 0xf0, 0x00, 0x76, 0x22, 0xcd, 0xa6, 0x84, 0x74, 0x20, 0x00,
-	0x4f, 0x03, 0x88, 0x8e, 0x09, 0x00, 0xa4, 0x41, 0x53, 0x05, 0x4c, 0x00,
-	0x56, 0x20, 0x0c, 0x9c, 0x08, 0x29, 0x2e, 0xdb, 0x05, 0x54, 0x28, 0x59,
-	0xf3, 0xa5, 0x43, 0x42, 0x47, 0x85, 0x2d, 0x06, 0xb2, 0x20, 0xd7, 0xd6,
-	0x79, 0x47, 0xb5, 0xff, 0xfb, 0x22, 0xc4, 0xd4, 0x80, 0x46, 0x18, 0x6f,
-	0x37, 0x27, 0x98, 0x64, 0xc0, 0xb3, 0x0d, 0xe7, 0xb4, 0xc1, 0x89, 0xa0,
-	0x80, 0x74, 0xaa, 0x3f, 0x09, 0x0b, 0x92, 0xa0, 0xd7, 0x54, 0xb0, 0xb3,
-	0xaa, 0x4c, 0x1a, 0x44, 0x35, 0x0c, 0x2b, 0x6d, 0x2e, 0xee, 0x99, 0x12,
-	0x39, 0x69, 0x56, 0xb3, 0xbf, 0x33, 0x3f, 0x7c, 0x29, 0xad, 0x3a, 0x7d,
-	0xed, 0xbf, 0x06, 0xc8, 0x2d, 0x4f, 0xb1, 0xaa, 0xb1, 0x1f, 0xfb, 0x3f,
-	0xfd, 0x4a, 0x22, 0x34, 0x40, 0x18, 0x55, 0x8f, 0x22, 0x01, 0x1c, 0xc5,
-	0x2c, 0x03, 0x09, 0x15, 0x55, 0xa5, 0xce, 0xbd, 0xcd, 0x5b, 0x4d, 0xcb,
-	0x53, 0x72, 0x20, 0xe5, 0xc3, 0xaa, 0x85, 0xf2, 0x13, 0xc3, 0xd6, 0x0b,
-	0x4d, 0xc5, 0x50, 0xc1, 0xa8, 0x40, 0xe2, 0xd2, 0xc7, 0x58, 0xe3, 0xce,
-	0xcf, 0xba, 0x2f, 0x33, 0x43, 0x00, 0x9c, 0x1f, 0x0b, 0xd8, 0xc4, 0xac,
-	0x82, 0xc3, 0xff, 0xfb, 0x20, 0xc4, 0xdc, 0x80, 0x06, 0x04, 0x41, 0x3b,
-	0xa6, 0x18, 0x47, 0x00, 0xbe, 0x8e, 0xa8, 0xfc, 0x91, 0x89, 0xdc, 0xe7,
-	0xf6, 0x46, 0xa0, 0xa8, 0xbf, 0xaa, 0x6a, 0xd2, 0xba, 0x60, 0x0a, 0x64,
-	0x2f, 0x0a, 0x09, 0x42, 0x22, 0x67, 0x82, 0x0e, 0x72, 0xd0, 0x20, 0x65,
-	0xd2, 0xea, 0x32, 0x23, 0x1a, 0xb7, 0xb4, 0x77, 0x47, 0xec, 0xff, 0xb0,
-	0x07, 0x12, 0x4c, 0x80, 0xa4, 0x3e, 0x08, 0x40, 0xf2, 0x60, 0x19, 0x82,
-	0xad, 0x06, 0xc8, 0xb0, 0x57, 0x00, 0xc3, 0x2f, 0x4c, 0xaa, 0x30, 0x65,
-	0xc6, 0xca, 0x1c, 0x3e, 0x26, 0x30, 0x79, 0xa7, 0x83, 0xcb, 0x9e, 0x8e,
-	0x0a, 0x82, 0xa7, 0x45, 0xac, 0xb5, 0x37, 0xf9, 0x4e, 0xee, 0x22, 0x20,
-	0x55, 0x37, 0xcd, 0xd5, 0x55, 0x2a, 0x2f, 0xf5, 0x51, 0x08, 0x64, 0x18,
-	0x85, 0x69, 0xb8, 0x72, 0x1e, 0x91, 0x49, 0xa0, 0x59, 0xd0, 0x48, 0x2d,
-	0xff, 0xfb, 0x22, 0xc4, 0xe3, 0x00, 0x06, 0x1c, 0x6f, 0x39, 0x94, 0xc2,
-	0x80, 0x01, 0x7e, 0x25, 0xeb, 0x37, 0x18, 0xa0, 0x02, 0xae, 0x68, 0xb1,
-	0x2f, 0x74, 0x83, 0x4b, 0x7b, 0x08, 0xd0, 0xff, 0xf3, 0x96, 0x5d, 0x95,
-	0xbe, 0xb2, 0x93, 0x8c, 0x28, 0x89, 0xd4, 0xb9, 0xa6, 0xfb, 0x6b, 0x75,
-	0x34, 0xb2, 0xf2, 0xdb, 0x38, 0x6f, 0xe8, 0xbd, 0x41, 0x5a, 0xb0, 0x44,
-	0x6c, 0x97, 0xe5, 0xf6, 0xa5, 0x22, 0xc3, 0x02, 0x40, 0xf2, 0x49, 0x0a,
-	0x15, 0xcc, 0x8a, 0x1e, 0x8e, 0xef, 0x4b, 0x62, 0xb8, 0x7e, 0x66, 0xf3,
-	0x3b, 0xe4, 0xfd, 0x24, 0x24, 0xcb, 0xb2, 0x40, 0x46, 0x3c, 0x42, 0x03,
-	0x87, 0x9e, 0x44, 0xb1, 0x05, 0xa1, 0xd6, 0x10, 0xff, 0xfc, 0x3f, 0x43,
-	0x6a, 0x12, 0x26, 0x80, 0x44, 0x07, 0xc0, 0x68, 0xa6, 0x9b, 0x0b, 0x8e,
-	0xde, 0xae, 0xf1, 0x96, 0xf7, 0xa0, 0x15, 0x6e, 0xce, 0x73, 0x83, 0xff,
-	0xfb, 0x22, 0xc4, 0xd1, 0x80, 0x05, 0xd8, 0x29, 0x6d, 0x9c, 0xf3, 0x00,
-	0x30, 0xb5, 0x87, 0x29, 0x20, 0xc4, 0x98, 0x20, 0xe3, 0x91, 0x54, 0xdf,
-	0x2d, 0xa3, 0x16, 0xb8, 0xd3, 0xe3, 0xf9, 0x95, 0x6c, 0x7c, 0xce, 0x44,
-	0x49, 0x15, 0x88, 0x85, 0xc7, 0x19, 0x27, 0x60, 0x41, 0x67, 0xc0, 0xae,
-	0xa4, 0x5e, 0xcb, 0x9d, 0x6f, 0xdc, 0x9f, 0x40, 0x93, 0x16, 0x30, 0x04,
-	0x9c, 0x59, 0x6d, 0xda, 0x88, 0xe3, 0xda, 0x76, 0x45, 0x52, 0x86, 0xbe,
-	0x19, 0x74, 0x84, 0x06, 0xd2, 0x2d, 0xda, 0x8f, 0x5b, 0xe3, 0x69, 0xaf,
-	0xf3, 0x2d, 0xb7, 0xfe, 0xec, 0xef, 0xb1, 0xb9, 0x67, 0x1a, 0x3a, 0xf0,
-	0xf2, 0x25, 0x47, 0xe4, 0x96, 0x1e, 0x7a, 0xd4, 0xb2, 0xdb, 0xaf, 0x1b,
-	0x0f, 0x4d, 0x63, 0x91, 0xe9, 0x0a, 0x01, 0x00, 0x70, 0x3a, 0x34, 0x24,
-	0x15, 0x2f, 0x15, 0x45, 0x07, 0xd0, 0x87, 0x99, 0xa4, 0xe8, 0xff, 0xfb,
-	0x20, 0xc4, 0xda, 0x00, 0x45, 0xe0, 0x6b, 0x3a, 0x07, 0xa4, 0xc7, 0x00,
-	0xc3, 0x8e, 0xa7, 0x64, 0xf4, 0x8c, 0x38, 0x46, 0x20, 0x53, 0x6e, 0x2a,
-	0x0e, 0xe2, 0x98, 0x71, 0x5b, 0x5e, 0x87, 0x8f, 0x20, 0x95, 0x9c, 0x19,
-	0x1e, 0xbb, 0xce, 0xda, 0xe5, 0xd8, 0x2b, 0x2c, 0xb6, 0x4f, 0xee, 0x73,
-	0x7d, 0x9e, 0xe2, 0xdc, 0x92, 0xd8, 0xd4, 0x24, 0x92, 0x00, 0x0d, 0xe5,
-	0x28, 0xd0, 0x68, 0xaa, 0x11, 0x25, 0x3e, 0x66, 0x47, 0x81, 0xd3, 0x0c,
-	0x26, 0x34, 0xc8, 0x12, 0xb0, 0x66, 0x04, 0xce, 0x5f, 0x28, 0x3a, 0x3a,
-	0x96, 0xd6, 0x60, 0xa8, 0x68, 0x58, 0x44, 0x14, 0x2c, 0xff, 0x26, 0x1a,
-	0x0f, 0x03, 0xf3, 0x7e, 0x99, 0x82, 0xfd, 0xba, 0x9a, 0xbf, 0x42, 0x07,
-	0xee, 0x9b, 0x00, 0x5c, 0x0a, 0x85, 0xc9, 0x85, 0x46, 0x12, 0x5f, 0x13,
-	0xa2, 0x89, 0x85, 0x11, 0x2b, 0xcb, 0x92, 0x55, 0xff, 0xfb, 0x22, 0xc4,
-	0xe0, 0x80, 0x05, 0xf8, 0x39, 0x36, 0x07, 0xb1, 0x20, 0x40, 0xd6, 0x88,
-	0xe7, 0x70, 0x94, 0x8c, 0x30, 0x9a, 0xed, 0x4d, 0x02, 0xa3, 0xcf, 0x42,
-	0xfd, 0xd8, 0xf7, 0x21, 0x6c, 0x0c, 0xc2, 0x11, 0x2e, 0x2b, 0xc8, 0xa8,
-	0xbb, 0x3a, 0x3c, 0xf8, 0xc5, 0x7c, 0x55, 0x4b, 0x7d, 0x0b, 0x29, 0x22,
-	0x05, 0x8a, 0xaa, 0x24, 0x44, 0x4c, 0x33, 0x9e, 0xac, 0xc4, 0xd8, 0x02,
-	0xb0, 0x6c, 0x49, 0x48, 0x33, 0x9d, 0x16, 0x92, 0xa0, 0x20, 0xc0, 0x65,
-	0x6e, 0x79, 0xba, 0xad, 0xc2, 0xfb, 0x98, 0x11, 0x34, 0x47, 0x59, 0x9e,
-	0x21, 0xeb, 0x3e, 0xa0, 0xdb, 0x9b, 0xea, 0x84, 0x5c, 0x64, 0x1f, 0x73,
-	0x3d, 0x3d, 0x96, 0x40, 0x68, 0xa7, 0xdb, 0xa6, 0x10, 0x6a, 0x52, 0x04,
-	0x50, 0x8b, 0xc6, 0x03, 0x40, 0x61, 0x3d, 0x8e, 0x1c, 0x38, 0xb3, 0x16,
-	0x10, 0x78, 0x02, 0xb0, 0x1e, 0x34, 0xca, 0xff, 0xfb, 0x20, 0xc4, 0xe4,
-	0x80, 0x46, 0xac, 0x75, 0x39, 0x27, 0x98, 0x65, 0x00, 0xcf, 0x8e, 0x66,
-	0xe0, 0xf3, 0x0c, 0xd0, 0xc5, 0xd4, 0x9e, 0x17, 0xff, 0x92, 0x89, 0xa2,
-	0x57, 0x86, 0x0c, 0x04, 0x42, 0xaa, 0x0a, 0x4a, 0x14, 0x86, 0x0b, 0x1e,
-	0x3b, 0x0f, 0xfb, 0x1e, 0x77, 0xbd, 0x7f, 0xf4, 0x33, 0xbc, 0x3c, 0x44,
-	0x3c, 0x36, 0xb2, 0xd8, 0x20, 0x01, 0xa0, 0x5e, 0x55, 0x06, 0x20, 0x45,
-	0x72, 0x83, 0xca, 0x30, 0x5c, 0x33, 0x21, 0x6a, 0xb8, 0xdc, 0x75, 0x9f,
-	0xbc, 0x04, 0xc1, 0xd1, 0x0a, 0x74, 0x72, 0x3b, 0xdf, 0xdd, 0x18, 0xf5,
-	0xb6, 0x49, 0xee, 0x18, 0x6d, 0x31, 0xa0, 0x36, 0x35, 0x2e, 0x0a, 0x7c,
-	0x43, 0x7b, 0x7f, 0xf8, 0xfd, 0xb7, 0x55, 0x56, 0xfd, 0xbf, 0xd6, 0xd8,
-	0xe3, 0x69, 0x81, 0xe8, 0x20, 0xd0, 0x39, 0x45, 0x22, 0x5b, 0xbb, 0x9a,
-	0xad, 0x96, 0x8a, 0x51, 0x69, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x47,
-	0x34, 0x6f, 0x33, 0x07, 0xa0, 0xcb, 0x80, 0xd1, 0x0e, 0x66, 0xa5, 0x84,
-	0x98, 0x70, 0xe1, 0xfe, 0xbb, 0xc5, 0x32, 0x09, 0x00, 0xcd, 0x20, 0x18,
-	0xbd, 0x98, 0x16, 0xeb, 0x32, 0xb5, 0x0e, 0x2c, 0xae, 0x27, 0x48, 0x55,
-	0xc5, 0xa0, 0x7b, 0x58, 0x89, 0xf3, 0x9a, 0x6a, 0xff, 0x78, 0xb3, 0xdc,
-	0x90, 0x09, 0x40, 0x2e, 0xa3, 0x00, 0x80, 0x0d, 0xaa, 0xa3, 0x4b, 0x59,
-	0x43, 0xb5, 0x19, 0x55, 0x40, 0xa4, 0x68, 0x16, 0x69, 0x56, 0x1a, 0x56,
-	0xef, 0xfc, 0xd5, 0x75, 0x66, 0xf4, 0x0c, 0xed, 0x85, 0x11, 0xaf, 0xa5,
-	0x85, 0x0c, 0xa8, 0x29, 0xaf, 0x9b, 0xd5, 0x7e, 0xc2, 0x00, 0x57, 0xad,
-	0x3d, 0x2a, 0x39, 0xd6, 0x12, 0x01, 0x04, 0x14, 0x50, 0x6b, 0x2c, 0xd5,
-	0xfb, 0x7c, 0x68, 0x63, 0x49, 0x91, 0xcc, 0x18, 0xfa, 0x5b, 0x1b, 0x2b,
-	0xd9, 0x74, 0x79, 0x22, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x00, 0x06, 0xb0,
-	0x41, 0x3f, 0x84, 0x24, 0x61, 0x60, 0xe0, 0x88, 0xe9, 0x34, 0xf4, 0x8c,
-	0x36, 0x15, 0xb4, 0xee, 0x45, 0x3f, 0x84, 0xe4, 0xa2, 0xc1, 0x16, 0x06,
-	0xe0, 0x0e, 0x80, 0x07, 0xc3, 0x8a, 0xb8, 0x54, 0x12, 0x72, 0x4f, 0x49,
-	0x22, 0xf4, 0x5c, 0x85, 0x2f, 0x4f, 0x46, 0x9e, 0x90, 0xe9, 0x78, 0xa0,
-	0x54, 0x2c, 0x34, 0xf0, 0x8a, 0x20, 0x38, 0x32, 0x30, 0x21, 0x24, 0xcf,
-	0xb8, 0x45, 0xf1, 0x24, 0xb3, 0x29, 0xb4, 0x69, 0x0a, 0x43, 0x33, 0x4b,
-	0xff, 0x4b, 0x38, 0x78, 0x82, 0x34, 0x0a, 0xf5, 0xc3, 0x63, 0x96, 0xd4,
-	0x64, 0x2d, 0xc6, 0x58, 0xd9, 0x36, 0x21, 0xbf, 0xfe, 0x52, 0x01, 0x24,
-	0x53, 0x88, 0x0a, 0xe0, 0x8f, 0x3d, 0x3b, 0x89, 0x14, 0x3f, 0x5a, 0xf5,
-	0xdd, 0x71, 0xa4, 0x78, 0xe4, 0x34, 0x05, 0x87, 0xfa, 0x97, 0x62, 0xb3,
-	0xed, 0xba, 0xb3, 0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x00, 0x06, 0xc4, 0x6f,
-	0x37, 0x24, 0x98, 0x47, 0x00, 0xd6, 0x8b, 0x29, 0x7c, 0xc3, 0x08, 0x7c,
-	0x1d, 0xde, 0xff, 0xa9, 0x90, 0xaa, 0x86, 0x71, 0x88, 0x72, 0x86, 0x64,
-	0x0e, 0xd6, 0xaa, 0x7a, 0x95, 0x59, 0x92, 0x6b, 0x2f, 0xbf, 0xf6, 0x14,
-	0x4a, 0xff, 0xd1, 0xfd, 0x61, 0x5f, 0xea, 0x40, 0x03, 0x01, 0x6c, 0x18,
-	0x91, 0x4e, 0x09, 0x2d, 0xcc, 0x38, 0x50, 0x38, 0x41, 0x12, 0x64, 0x8b,
-	0xba, 0x42, 0x1e, 0x10, 0x4e, 0x6c, 0xef, 0x99, 0x0e, 0x95, 0xa7, 0xc9,
-	0xc2, 0x7c, 0x9d, 0xf2, 0x08, 0x09, 0x84, 0x43, 0x71, 0xb4, 0xd0, 0xf2,
-	0xa4, 0x0f, 0x5e, 0xf6, 0xb1, 0x05, 0x2c, 0xb3, 0x7f, 0x43, 0x6f, 0x89,
-	0xab, 0x16, 0x72, 0xdd, 0xb6, 0xb2, 0x48, 0x92, 0x49, 0x00, 0x3c, 0x2b,
-	0x54, 0x62, 0x2d, 0xf7, 0x28, 0xa0, 0x92, 0x08, 0x28, 0x7a, 0xca, 0x31,
-	0x11, 0xff, 0xfb, 0x22, 0xc4, 0xe6, 0x80, 0x06, 0x64, 0x75, 0x33, 0x07,
-	0xac, 0x62, 0x00, 0xe8, 0x0e, 0xac, 0xbc, 0xc1, 0x8a, 0x0e, 0xd0, 0x72,
-	0xe1, 0x8b, 0xb4, 0xa9, 0xf6, 0x90, 0xc4, 0x0f, 0xa9, 0x40, 0xd3, 0xdf,
-	0x48, 0x50, 0xb3, 0x3e, 0xf5, 0x76, 0xd4, 0xba, 0x50, 0x97, 0xb0, 0xe8,
-	0xde, 0xd0, 0x88, 0x7f, 0x52, 0xac, 0x4d, 0x09, 0xb9, 0x25, 0x91, 0xce,
-	0xb5, 0x00, 0x02, 0xc3, 0x4d, 0x10, 0x85, 0x30, 0xae, 0x5e, 0x37, 0x34,
-	0x8b, 0x23, 0xcf, 0xc2, 0x95, 0x4d, 0xb7, 0x0f, 0x17, 0xcc, 0xc7, 0x6b,
-	0xc9, 0xdf, 0xe1, 0xb5, 0xb6, 0x5e, 0xb5, 0x16, 0x79, 0x48, 0xd9, 0x50,
-	0xe1, 0xaf, 0x30, 0x79, 0x0a, 0x37, 0x0e, 0xbf, 0xbb, 0x52, 0x6a, 0x03,
-	0x09, 0x31, 0x43, 0x8d, 0x28, 0xaa, 0xa0, 0x00, 0x14, 0x85, 0x95, 0x73,
-	0xa2, 0x50, 0x9f, 0x5a, 0x60, 0x3a, 0x19, 0x07, 0x79, 0xdf, 0xb8, 0x4e,
-	0xff, 0xfb, 0x20, 0xc4, 0xe6, 0x80, 0x06, 0xb4, 0x73, 0x5b, 0xa6, 0x04,
-	0x71, 0x30, 0xcf, 0x0e, 0x66, 0xa4, 0xf3, 0x0c, 0x28, 0x0d, 0xa4, 0xe6,
-	0x3a, 0x1b, 0x13, 0x82, 0x80, 0x52, 0x28, 0x8a, 0xda, 0x70, 0xa1, 0x12,
-	0x32, 0x39, 0x98, 0x4d, 0xb9, 0x84, 0x57, 0x5d, 0xb8, 0x53, 0x93, 0xd5,
-	0x19, 0x5d, 0x85, 0xf5, 0x13, 0x69, 0x3a, 0x66, 0xd1, 0xeb, 0x17, 0xf2,
-	0xed, 0x5d, 0x86, 0x43, 0xc7, 0x2b, 0x63, 0xbb, 0x1d, 0x9c, 0x36, 0x77,
-	0xde, 0xfb, 0xcc, 0x4a, 0xbd, 0x6c, 0x21, 0x93, 0xfb, 0xff, 0xdf, 0x76,
-	0xb6, 0xb4, 0xe2, 0xe3, 0x1e, 0xf7, 0xb0, 0xff, 0xdf, 0xe9, 0x13, 0x09,
-	0x31, 0xd8, 0x87, 0xcc, 0x8b, 0x80, 0xc5, 0x69, 0xd0, 0xec, 0x23, 0x8f,
-	0x06, 0x82, 0x69, 0x49, 0x5d, 0x97, 0xac, 0xd1, 0x58, 0xbd, 0x80, 0x11,
-	0xc9, 0x11, 0x68, 0xfb, 0x13, 0x1c, 0x40, 0x0b, 0x08, 0xde, 0xff, 0xfb,
-	0x22, 0xc4, 0xe8, 0x00, 0x47, 0x30, 0x73, 0x33, 0x2c, 0x18, 0x65, 0x40,
-	0xc5, 0x0e, 0xa6, 0xa4, 0xf3, 0x0c, 0x70, 0xe7, 0xb8, 0x8e, 0x81, 0x00,
-	0x72, 0x56, 0xe3, 0xc5, 0x10, 0x71, 0xf9, 0x90, 0x2c, 0x44, 0x40, 0xb4,
-	0xc3, 0x7f, 0x8b, 0x9f, 0x55, 0x03, 0x07, 0x8f, 0xb5, 0x98, 0x68, 0xbb,
-	0xff, 0xde, 0x11, 0x19, 0xb9, 0xa9, 0xad, 0x65, 0x12, 0x6b, 0xd2, 0x5e,
-	0x1d, 0x79, 0x24, 0x34, 0xf3, 0xc4, 0x8e, 0xd6, 0x7f, 0xa4, 0x45, 0xe1,
-	0x9a, 0x65, 0xb4, 0xe5, 0x48, 0xb0, 0xa4, 0x9e, 0x00, 0xd8, 0x95, 0xe2,
-	0x70, 0xc8, 0x9a, 0x57, 0x31, 0x50, 0x91, 0x2d, 0x8f, 0x4e, 0x4f, 0xf1,
-	0x71, 0xe2, 0xba, 0x0f, 0x50, 0x80, 0x60, 0x26, 0x75, 0xb5, 0xdb, 0xe6,
-	0x37, 0x2d, 0x66, 0x31, 0xaf, 0x50, 0xd3, 0x1b, 0xf2, 0x91, 0x41, 0x50,
-	0xdf, 0x84, 0x9f, 0xa9, 0xe1, 0x11, 0x11, 0x13, 0x4b, 0xff, 0xfb, 0x22,
-	0xc4, 0xe9, 0x80, 0x07, 0x2c, 0xb9, 0x32, 0x87, 0xb0, 0x43, 0xc0, 0xe6,
-	0x8d, 0x26, 0xa4, 0xc3, 0x0c, 0xb0, 0x63, 0xbf, 0x7d, 0x40, 0x19, 0xa0,
-	0xc5, 0x1c, 0x00, 0x09, 0x04, 0xf6, 0x03, 0xa5, 0x41, 0xd0, 0x54, 0x94,
-	0xb2, 0xd2, 0xe2, 0x49, 0x38, 0x32, 0x46, 0x91, 0x47, 0x9c, 0x48, 0x91,
-	0x1c, 0xaf, 0x33, 0x2d, 0x5f, 0xd6, 0xca, 0x25, 0x82, 0x8f, 0x2c, 0x56,
-	0x54, 0x35, 0xfa, 0x81, 0x57, 0x09, 0x52, 0xdd, 0x72, 0x35, 0x00, 0xf5,
-	0x7f, 0x80, 0x18, 0x28, 0x27, 0x0c, 0x82, 0xc2, 0xe2, 0xa2, 0xa2, 0xab,
-	0x16, 0xbc, 0x54, 0x50, 0x59, 0x0f, 0xf1, 0x61, 0x76, 0x7e, 0x2a, 0x28,
-	0xde, 0xb9, 0x91, 0x61, 0x71, 0x5f, 0xfe, 0xa1, 0x59, 0x91, 0x61, 0x75,
-	0x4c, 0x41, 0x4d, 0x45, 0x33, 0x2e, 0x31, 0x30, 0x30, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0xff, 0xfb, 0x20, 0xc4,
-	0xe7, 0x00, 0x07, 0x0c, 0x49, 0x55, 0xa6, 0x18, 0x68, 0xf0, 0xcb, 0x8e,
-	0xa9, 0xb2, 0x92, 0x60, 0x06, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0xff, 0xfb, 0x22, 0xc4, 0xe7, 0x80,
-	0x0c, 0x40, 0xe3, 0x39, 0x38, 0xf4, 0x80, 0x01, 0x66, 0x1c, 0xa9, 0x17,
-	0x18, 0x80, 0x00, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0xff, 0xfb, 0x22, 0xc4, 0xc0, 0x80, 0x07,
-	0x54, 0x73, 0x4d, 0xbc, 0xc1, 0x00, 0x00, 0xc3, 0x0a, 0xa6, 0x04, 0xf6,
-	0x18, 0x28, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0xff, 0xfb, 0x20, 0xc4, 0xc1, 0x83, 0xc4, 0xb0,
-	0x08, 0xe4, 0xc1, 0x0c, 0x60, 0x20, 0x00, 0x00, 0x34, 0x80, 0x00, 0x00,
-	0x04, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55, 0x55,
-	0x55, 0x55,
-}
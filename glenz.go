@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"sort"
+)
+
+const (
+	glenzCentreLift = 1.45 // How far the face centres are pushed out
+	glenzEdgeLift   = 1.15 // How far the edge midpoints are pushed out
+)
+
+var (
+	// The classic 48-face glenz object, a cube with every face split into eight triangles
+	glenzVertices, glenzFaces = buildGlenzObject()
+	glenzColors               = [][]uint8{
+		{40, 90, 255, 150},   // Blue
+		{255, 255, 255, 110}, // White
+	}
+	glenzAdditiveColors = [][]uint8{
+		{20, 50, 160, 255},
+		{90, 60, 120, 255},
+	}
+)
+
+func buildGlenzObject() ([]Point3D, [][]int) {
+	vertices := append([]Point3D(nil), cubeVertices...)
+	addVertex := func(p Point3D) int {
+		vertices = append(vertices, p)
+		return len(vertices) - 1
+	}
+
+	// Edge midpoints are shared between neighbouring faces
+	midpoints := map[[2]int]int{}
+	midpoint := func(a, b int) int {
+		if a > b {
+			a, b = b, a
+		}
+		if index, ok := midpoints[[2]int{a, b}]; ok {
+			return index
+		}
+		m := lerpPoint(cubeVertices[a], cubeVertices[b], 0.5)
+		index := addVertex(Point3D{m.x * glenzEdgeLift, m.y * glenzEdgeLift, m.z * glenzEdgeLift})
+		midpoints[[2]int{a, b}] = index
+		return index
+	}
+
+	var faces [][]int
+	for _, face := range cubeFaces {
+		var centre Point3D
+		for _, index := range face {
+			centre = Point3D{centre.x + cubeVertices[index].x/4, centre.y + cubeVertices[index].y/4, centre.z + cubeVertices[index].z/4}
+		}
+		c := addVertex(Point3D{centre.x * glenzCentreLift, centre.y * glenzCentreLift, centre.z * glenzCentreLift})
+		for i := range face {
+			a, b := face[i], face[(i+1)%len(face)]
+			m := midpoint(a, b)
+			faces = append(faces, []int{c, a, m}, []int{c, m, b})
+		}
+	}
+	return vertices, faces
+}
+
+func drawGlenz(angle float64) {
+	drawGlenzObject(angle, sdl.BLENDMODE_BLEND, glenzColors)
+}
+
+func drawGlenzAdditive(angle float64) {
+	drawGlenzObject(angle, sdl.BLENDMODE_ADD, glenzAdditiveColors)
+}
+
+func drawGlenzObject(angle float64, blendMode sdl.BlendMode, colors [][]uint8) {
+	projectedPoints := make([]sdl.FPoint, len(glenzVertices))
+	depths := make([]float64, len(glenzVertices))
+	for i, vertex := range glenzVertices {
+		rotated := transformPoint(objectOrientation, rotatePoint(vertex, angle))
+		projected := projectPoint(rotated)
+		projectedPoints[i] = sdl.FPoint{X: float32(projected.x), Y: float32(projected.y)}
+		depths[i] = projected.z
+	}
+
+	// Back to front so the inner faces show through the outer ones
+	order := make([]int, len(glenzFaces))
+	faceDepths := make([]float64, len(glenzFaces))
+	for i, face := range glenzFaces {
+		order[i] = i
+		for _, index := range face {
+			faceDepths[i] += depths[index]
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return faceDepths[order[i]] > faceDepths[order[j]] })
+
+	var previous sdl.BlendMode
+	err := renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	defer renderer.SetDrawBlendMode(previous)
+	err = renderer.SetDrawBlendMode(blendMode)
+	if err != nil {
+		return
+	}
+
+	for _, i := range order {
+		color := colors[i%len(colors)]
+		err := renderer.SetDrawColor(color[0], color[1], color[2], color[3])
+		if err != nil {
+			return
+		}
+		fillPolygon(renderer, projectedPoints, glenzFaces[i])
+	}
+	flushBatch()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+)
+
+const (
+	trackballSpeed  = 0.01    // Radians per pixel of mouse drag
+	stickDeadZone   = 8000    // Ignore stick values smaller than this
+	stickSpeed      = 3.0     // Radians per second at full stick deflection
+	triggerZoomStep = 0.6     // Zoom change per second at full trigger pull
+	axisRange       = 32767.0 // Maximum controller axis value
+)
+
+var (
+	// Mouse trackball variables
+	dragging bool
+
+	// Gamepad variables
+	controllers  = map[sdl.JoystickID]*sdl.GameController{}
+	stickX       float64
+	stickY       float64
+	stickTwist   float64
+	triggerLeft  float64
+	triggerRight float64
+)
+
+func trackballRotate(dx, dy float64) {
+	// Spin around the screen axis perpendicular to the drag direction
+	axis := Point3D{dy, -dx, 0}
+	angle := math.Sqrt(dx*dx+dy*dy) * trackballSpeed
+	objectOrientation = multiplyMatrix(axisAngleMatrix(axis, angle), objectOrientation)
+}
+
+func handleControllerDevice(e *sdl.ControllerDeviceEvent) {
+	switch e.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		// Which is the device index for added controllers
+		controller := sdl.GameControllerOpen(int(e.Which))
+		if controller != nil {
+			controllers[controller.Joystick().InstanceID()] = controller
+		}
+	case sdl.CONTROLLERDEVICEREMOVED:
+		if controller, ok := controllers[e.Which]; ok {
+			controller.Close()
+			delete(controllers, e.Which)
+		}
+		// The axes are shared, so they only let go with the last pad
+		if len(controllers) == 0 {
+			stickX, stickY, stickTwist = 0, 0, 0
+			triggerLeft, triggerRight = 0, 0
+		}
+	}
+}
+
+func handleControllerAxis(e *sdl.ControllerAxisEvent) {
+	value := float64(e.Value) / axisRange
+	if math.Abs(float64(e.Value)) < stickDeadZone {
+		value = 0
+	}
+	switch e.Axis {
+	case sdl.CONTROLLER_AXIS_LEFTX:
+		stickX = value
+	case sdl.CONTROLLER_AXIS_LEFTY:
+		stickY = value
+	case sdl.CONTROLLER_AXIS_RIGHTX:
+		stickTwist = value
+	case sdl.CONTROLLER_AXIS_TRIGGERLEFT:
+		triggerLeft = value
+	case sdl.CONTROLLER_AXIS_TRIGGERRIGHT:
+		triggerRight = value
+	}
+}
+
+func handleControllerButton(e *sdl.ControllerButtonEvent) {
+	if e.State != sdl.PRESSED {
+		return
+	}
+	switch e.Button {
+	case sdl.CONTROLLER_BUTTON_A, sdl.CONTROLLER_BUTTON_RIGHTSHOULDER, sdl.CONTROLLER_BUTTON_DPAD_RIGHT:
+		cycleObjectEffect(1)
+	case sdl.CONTROLLER_BUTTON_B, sdl.CONTROLLER_BUTTON_LEFTSHOULDER, sdl.CONTROLLER_BUTTON_DPAD_LEFT:
+		cycleObjectEffect(-1)
+	case sdl.CONTROLLER_BUTTON_X:
+		cycleStarfieldMode()
+	case sdl.CONTROLLER_BUTTON_DPAD_UP:
+		hyperspaceJump()
+	case sdl.CONTROLLER_BUTTON_Y:
+		objectOrientation = identityMatrix()
+	}
+}
+
+func updateControllerInput() {
+	// Sticks spin the object, same as dragging with the mouse
+	step := stickSpeed * deltaTime
+	if stickX != 0 || stickY != 0 {
+		trackballRotate(stickX*step/trackballSpeed, stickY*step/trackballSpeed)
+	}
+	if stickTwist != 0 {
+		objectOrientation = multiplyMatrix(axisAngleMatrix(Point3D{0, 0, 1}, stickTwist*step), objectOrientation)
+	}
+
+	// Triggers zoom in and out
+	if triggerLeft != 0 || triggerRight != 0 {
+		targetZoom = math.Max(math.Min(targetZoom+(triggerRight-triggerLeft)*triggerZoomStep*deltaTime, 0.6), 0.1)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const itMaxChannels = 64
+
+// Tone portamento speeds of the volume column
+var itPortaSpeeds = []int{0, 1, 4, 8, 16, 32, 64, 96, 128, 255}
+
+// Loads an Impulse Tracker module
+func loadIT(data []byte) (*modSong, error) {
+	song := newTrackerSong(formatIT, modString(data, 4, 26))
+	numOrders, numInstruments := modUint16(data, 32), modUint16(data, 34)
+	numSamples, numPatterns := modUint16(data, 36), modUint16(data, 38)
+	compatible, flags := modUint16(data, 42), modUint16(data, 44)
+	song.linear = flags&8 != 0
+	song.linkedPorta = flags&0x20 == 0
+	song.globalVolume = int(data[48]) / 2
+	song.speed, song.tempo = int(data[50]), int(data[51])
+	for i := 0; i < itMaxChannels; i++ {
+		// 100 is surround, which plays in the middle here
+		pan := float64(data[64+i]&0x7f) / modMaxVolume
+		if pan > 1 {
+			pan = 0.5
+		}
+		song.pans = append(song.pans, pan)
+	}
+
+	for _, order := range modBytes(data, 192, numOrders) {
+		if order == 255 {
+			break
+		}
+		if order != 254 {
+			song.orders = append(song.orders, int(order))
+		}
+	}
+	instrumentOffsets := 192 + numOrders
+	sampleOffsets := instrumentOffsets + numInstruments*4
+	patternOffsets := sampleOffsets + numSamples*4
+
+	for i := 0; i < numSamples; i++ {
+		sample, err := loadITSample(data, modUint32(data, sampleOffsets+i*4))
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %v", i+1, err)
+		}
+		song.samples = append(song.samples, sample)
+	}
+	// Without instruments the patterns play samples directly
+	if flags&4 != 0 {
+		for i := 0; i < numInstruments; i++ {
+			song.instruments = append(song.instruments, loadITInstrument(data, modUint32(data, instrumentOffsets+i*4), compatible >= 0x200))
+		}
+	}
+
+	var patterns [][]modNote
+	for i := 0; i < numPatterns; i++ {
+		notes, channels := loadITPattern(data, modUint32(data, patternOffsets+i*4))
+		patterns = append(patterns, notes)
+		song.channels = int(math.Max(float64(song.channels), float64(channels)))
+	}
+	// Patterns are read with every channel, then cut down to the ones used
+	song.channels = int(math.Max(1, float64(song.channels)))
+	song.pans = song.pans[:song.channels]
+	for _, notes := range patterns {
+		rows := len(notes) / itMaxChannels
+		pattern := make([]modNote, rows*song.channels)
+		for row := 0; row < rows; row++ {
+			copy(pattern[row*song.channels:(row+1)*song.channels], notes[row*itMaxChannels:])
+		}
+		song.patterns = append(song.patterns, pattern)
+	}
+
+	if err := finishTrackerSong(song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+func loadITSample(data []byte, offset int) (modSample, error) {
+	header := modBytes(data, offset, 80)
+	if len(header) < 80 || string(header[:4]) != "IMPS" {
+		return modSample{}, fmt.Errorf("bad header")
+	}
+	flags, convert := header[18], header[46]
+	sample := modSample{
+		name:    modString(header, 20, 26),
+		volume:  int(math.Min(float64(header[19]), modMaxVolume)),
+		gain:    math.Min(float64(header[17]), modMaxVolume) / modMaxVolume,
+		c5speed: float64(modUint32(header, 60)),
+		pan:     -1,
+	}
+	if sample.c5speed == 0 {
+		sample.c5speed = 8363
+	}
+	if header[47]&0x80 != 0 {
+		sample.pan = math.Min(float64(header[47]&0x7f), modMaxVolume) / modMaxVolume
+	}
+	if flags&1 == 0 {
+		return sample, nil
+	}
+
+	length, pointer := modUint32(header, 48), modUint32(header, 72)
+	bits16 := flags&2 != 0
+	if flags&8 != 0 {
+		sample.data = decompressITSample(modBytes(data, pointer, len(data)), length, bits16, convert&4 != 0)
+	} else {
+		sample.data = decodeSampleData(data, pointer, length, bits16, convert&1 != 0)
+	}
+	// The sustain loop is used when there is no normal one
+	switch {
+	case flags&0x10 != 0:
+		setSampleLoop(&sample, modUint32(header, 52), modUint32(header, 56), flags&0x40 != 0)
+	case flags&0x20 != 0:
+		setSampleLoop(&sample, modUint32(header, 64), modUint32(header, 68), flags&0x80 != 0)
+	}
+	return sample, nil
+}
+
+// Reads the note to sample table, the volume envelope and the fadeout of an instrument
+func loadITInstrument(data []byte, offset int, newFormat bool) modInstrument {
+	instrument := modInstrument{name: modString(data, offset+32, 26)}
+	for note := 0; note < 120; note++ {
+		instrument.samples[note] = modByte(data, offset+65+note*2)
+	}
+
+	envelope := &modEnvelope{sustain: -1, loopStart: -1, loopEnd: -1}
+	var envelopeFlags, loopStart, loopEnd, sustain int
+	if newFormat {
+		instrument.fadeout = float64(modUint16(data, offset+20)) / 1024
+		envelopeFlags = modByte(data, offset+304)
+		numPoints := int(math.Min(float64(modByte(data, offset+305)), 25))
+		loopStart, loopEnd, sustain = modByte(data, offset+306), modByte(data, offset+307), modByte(data, offset+308)
+		for i := 0; i < numPoints; i++ {
+			point := offset + 310 + i*3
+			envelope.points = append(envelope.points, [2]int{modUint16(data, point+1), modByte(data, point)})
+		}
+	} else {
+		// Impulse Tracker 1 instruments list their points as tick and volume pairs ending in $ff
+		instrument.fadeout = float64(modUint16(data, offset+24)) / 512
+		envelopeFlags = modByte(data, offset+17)
+		loopStart, loopEnd, sustain = modByte(data, offset+18), modByte(data, offset+19), modByte(data, offset+20)
+		for i := 0; i < 25 && modByte(data, offset+504+i*2) != 0xff; i++ {
+			point := offset + 504 + i*2
+			envelope.points = append(envelope.points, [2]int{modByte(data, point), modByte(data, point+1)})
+		}
+	}
+	if envelopeFlags&1 == 0 || len(envelope.points) == 0 {
+		return instrument
+	}
+	if envelopeFlags&2 != 0 && loopStart <= loopEnd && loopEnd < len(envelope.points) {
+		envelope.loopStart, envelope.loopEnd = loopStart, loopEnd
+	}
+	if envelopeFlags&4 != 0 && sustain < len(envelope.points) {
+		envelope.sustain = sustain
+	}
+	instrument.envelope = envelope
+	return instrument
+}
+
+// Unpacks a pattern into rows of every channel, also giving the number of channels it uses
+func loadITPattern(data []byte, offset int) ([]modNote, int) {
+	if offset == 0 {
+		return make([]modNote, modRows*itMaxChannels), 0
+	}
+	rows := modUint16(data, offset+2)
+	if rows == 0 {
+		rows = modRows
+	}
+	notes := make([]modNote, rows*itMaxChannels)
+	channels := 0
+
+	// A channel can repeat its last mask and the last value of each field
+	var lastMask [itMaxChannels]int
+	var last [itMaxChannels][5]int
+	end := offset + 8 + modUint16(data, offset)
+	for pos, row := offset+8, 0; row < rows && pos < end; {
+		variable := modByte(data, pos)
+		pos++
+		if variable == 0 {
+			row++
+			continue
+		}
+		channel := (variable - 1) & 63
+		if variable&0x80 != 0 {
+			lastMask[channel] = modByte(data, pos)
+			pos++
+		}
+		mask := lastMask[channel]
+		values := &last[channel]
+		if mask&1 != 0 {
+			values[0] = modByte(data, pos)
+			pos++
+		}
+		if mask&2 != 0 {
+			values[1] = modByte(data, pos)
+			pos++
+		}
+		if mask&4 != 0 {
+			values[2] = modByte(data, pos)
+			pos++
+		}
+		if mask&8 != 0 {
+			values[3], values[4] = modByte(data, pos), modByte(data, pos+1)
+			pos += 2
+		}
+
+		var note modNote
+		if mask&0x11 != 0 {
+			note.note = itNote(values[0])
+		}
+		if mask&0x22 != 0 {
+			note.instrument = values[1]
+		}
+		if mask&0x44 != 0 {
+			note.volume, note.volumeParam = itVolume(values[2])
+		}
+		if mask&0x88 != 0 {
+			note.effect, note.param = itEffect(values[3], values[4])
+		}
+		notes[row*itMaxChannels+channel] = note
+		channels = int(math.Max(float64(channels), float64(channel+1)))
+	}
+	return notes, channels
+}
+
+func itNote(value int) int {
+	switch {
+	case value < 120:
+		return value + 1
+	case value == 254:
+		return noteCut
+	}
+	// Note off and note fade both let go of the key
+	return noteKeyOff
+}
+
+func itVolume(value int) (int, int) {
+	switch {
+	case value <= 64:
+		return volSet, value
+	case value <= 74:
+		return volFineUp, value - 65
+	case value <= 84:
+		return volFineDown, value - 75
+	case value <= 94:
+		return volSlideUp, value - 85
+	case value <= 104:
+		return volSlideDown, value - 95
+	case value <= 114:
+		// Pitch slides in units of four, like Exx and Fxx
+		return volPortaDown, (value - 105) * 4
+	case value <= 124:
+		return volPortaUp, (value - 115) * 4
+	case value >= 128 && value <= 192:
+		return volPan, value - 128
+	case value >= 193 && value <= 202:
+		return volTonePorta, itPortaSpeeds[value-193]
+	case value >= 203 && value <= 212:
+		return volVibrato, value - 203
+	}
+	return volNone, 0
+}
+
+// Impulse Tracker shares Scream Tracker's commands, with a few ranges changed
+func itEffect(command, param int) (int, int) {
+	switch command {
+	case 'C' - '@':
+		// Given in hex rather than decimal
+		return fxBreak, param/10<<4 | param%10
+	case 'V' - '@':
+		return fxGlobalVolume, param / 2
+	case 'X' - '@':
+		return fxPan, param
+	}
+	return s3mEffect(command, param)
+}
+
+// IT 2.14 compressed samples are delta packed in blocks, with the bit width changing as it goes
+func decompressITSample(data []byte, length int, bits16, it215 bool) []int16 {
+	blockSize, maxWidth := 0x8000, 9
+	if bits16 {
+		blockSize, maxWidth = 0x4000, 17
+	}
+	samples := make([]int16, 0, length)
+	for pos := 0; len(samples) < length && pos+2 <= len(data); {
+		packed := modUint16(data, pos)
+		bits := itBitReader{data: modBytes(data, pos+2, packed)}
+		pos += 2 + packed
+
+		count := int(math.Min(float64(blockSize), float64(length-len(samples))))
+		width := maxWidth
+		var delta, delta2 int
+		for n := 0; n < count && bits.pos < len(bits.data); {
+			value := bits.read(width)
+			switch {
+			case width < 7:
+				// A lone top bit is followed by the new width
+				if value == 1<<(width-1) {
+					widthBits := 3
+					if bits16 {
+						widthBits = 4
+					}
+					width = nextITWidth(bits.read(widthBits)+1, width)
+					continue
+				}
+			case width < maxWidth:
+				// Values just over the border give the new width
+				border, span := (0xff>>(9-width))-4, 8
+				if bits16 {
+					border, span = (0xffff>>(17-width))-8, 16
+				}
+				if value > border && value <= border+span {
+					width = nextITWidth(value-border, width)
+					continue
+				}
+			case width == maxWidth:
+				if value&(1<<(maxWidth-1)) != 0 {
+					width = (value + 1) & 0xff
+					continue
+				}
+			default:
+				return samples
+			}
+			if width == 0 || width > maxWidth {
+				return samples
+			}
+
+			// Sign extend from the bits read
+			signBits := int(math.Min(float64(width), float64(maxWidth-1)))
+			if value&(1<<(signBits-1)) != 0 {
+				value -= 1 << signBits
+			}
+			delta += value
+			delta2 += delta
+			out := delta
+			if it215 {
+				out = delta2
+			}
+			if bits16 {
+				samples = append(samples, int16(out))
+			} else {
+				samples = append(samples, int16(int8(out))*256)
+			}
+			n++
+		}
+	}
+	return samples
+}
+
+func nextITWidth(value, width int) int {
+	if value < width {
+		return value
+	}
+	return value + 1
+}
+
+// Reads little endian bit fields, lowest bit first
+type itBitReader struct {
+	data []byte
+	pos  int
+	bit  uint
+}
+
+func (reader *itBitReader) read(width int) int {
+	value := 0
+	for i := 0; i < width && reader.pos < len(reader.data); i++ {
+		value |= int(reader.data[reader.pos]>>reader.bit&1) << i
+		reader.bit++
+		if reader.bit == 8 {
+			reader.bit, reader.pos = 0, reader.pos+1
+		}
+	}
+	return value
+}
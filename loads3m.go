@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Loads a Scream Tracker 3 module
+func loadS3M(data []byte) (*modSong, error) {
+	song := newTrackerSong(formatS3M, modString(data, 0, 28))
+	numOrders, numSamples, numPatterns := modUint16(data, 32), modUint16(data, 34), modUint16(data, 36)
+	signed := modUint16(data, 42) == 1
+	song.globalVolume = int(math.Min(float64(data[48]), modMaxVolume))
+	song.speed, song.tempo = int(data[49]), int(data[50])
+	stereo := data[51]&0x80 != 0
+
+	// Only the PCM channels that are switched on get a pattern column
+	var columns [32]int
+	for i := range columns {
+		setting := int(data[64+i])
+		if setting >= 16 {
+			columns[i] = -1
+			continue
+		}
+		columns[i] = song.channels
+		song.channels++
+		pan := 0.5
+		if stereo && setting < 8 {
+			pan = 0.2
+		} else if stereo {
+			pan = 0.8
+		}
+		song.pans = append(song.pans, pan)
+	}
+
+	offset := 96
+	for _, order := range modBytes(data, offset, numOrders) {
+		if order == 255 {
+			break
+		}
+		// 254 is a marker the player skips
+		if order != 254 {
+			song.orders = append(song.orders, int(order))
+		}
+	}
+	sampleOffsets := offset + numOrders
+	patternOffsets := sampleOffsets + numSamples*2
+	if data[53] == 0xfc {
+		for i, pan := range modBytes(data, patternOffsets+numPatterns*2, 32) {
+			if columns[i] >= 0 && pan&0x20 != 0 {
+				song.pans[columns[i]] = float64(pan&0xf) / 15
+			}
+		}
+	}
+
+	for i := 0; i < numSamples; i++ {
+		header := modBytes(data, modUint16(data, sampleOffsets+i*2)*16, 80)
+		if len(header) < 80 {
+			return nil, fmt.Errorf("sample %d is cut short", i+1)
+		}
+		sample := modSample{name: modString(header, 48, 28), c5speed: 8363, gain: 1, pan: -1}
+		if header[0] == 1 {
+			pointer := (int(header[13])<<16 | modUint16(header, 14)) * 16
+			length := modUint32(header, 16)
+			flags := header[31]
+			sample.volume = int(math.Min(float64(header[28]), modMaxVolume))
+			if c5speed := modUint32(header, 32); c5speed != 0 {
+				sample.c5speed = float64(c5speed)
+			}
+			// Stereo samples keep the left channel
+			sample.data = decodeSampleData(data, pointer, length, flags&4 != 0, signed)
+			if flags&1 != 0 {
+				setSampleLoop(&sample, modUint32(header, 20), modUint32(header, 24), false)
+			}
+		}
+		song.samples = append(song.samples, sample)
+	}
+
+	for i := 0; i < numPatterns; i++ {
+		notes := make([]modNote, modRows*song.channels)
+		offset := modUint16(data, patternOffsets+i*2) * 16
+		if offset == 0 {
+			song.patterns = append(song.patterns, notes)
+			continue
+		}
+		end := offset + 2 + modUint16(data, offset)
+		for pos, row := offset+2, 0; row < modRows && pos < end; {
+			what := modByte(data, pos)
+			pos++
+			if what == 0 {
+				row++
+				continue
+			}
+			var note modNote
+			if what&0x20 != 0 {
+				note.note, note.instrument = s3mNote(modByte(data, pos)), modByte(data, pos+1)
+				pos += 2
+			}
+			if what&0x40 != 0 {
+				if volume := modByte(data, pos); volume <= modMaxVolume {
+					note.volume, note.volumeParam = volSet, volume
+				}
+				pos++
+			}
+			if what&0x80 != 0 {
+				note.effect, note.param = s3mEffect(modByte(data, pos), modByte(data, pos+1))
+				pos += 2
+			}
+			if column := columns[what&31]; column >= 0 {
+				notes[row*song.channels+column] = note
+			}
+		}
+		song.patterns = append(song.patterns, notes)
+	}
+
+	if err := finishTrackerSong(song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+// The high nibble is the octave and the low one the semitone
+func s3mNote(value int) int {
+	switch value {
+	case 255:
+		return 0
+	case 254:
+		return noteCut
+	}
+	return (value>>4)*12 + value&0xf + 1
+}
+
+// Maps the lettered S3M and IT commands, 1 for A, onto the replayer's effects
+func s3mEffect(command, param int) (int, int) {
+	x, y := param>>4, param&0xf
+	switch command {
+	case 'A' - '@':
+		return fxSpeed, param
+	case 'B' - '@':
+		return fxJump, param
+	case 'C' - '@':
+		return fxBreak, param
+	case 'D' - '@':
+		return fxVolSlide, param
+	case 'E' - '@':
+		return fxPortaDown, param
+	case 'F' - '@':
+		return fxPortaUp, param
+	case 'G' - '@':
+		return fxTonePorta, param
+	case 'H' - '@':
+		return fxVibrato, param
+	case 'I' - '@':
+		return fxTremor, param
+	case 'J' - '@':
+		return fxArpeggio, param
+	case 'K' - '@':
+		return fxVibratoVolSlide, param
+	case 'L' - '@':
+		return fxTonePortaVolSlide, param
+	case 'O' - '@':
+		return fxOffset, param
+	case 'P' - '@':
+		return fxPanSlide, param
+	case 'Q' - '@':
+		return fxRetrig, param
+	case 'R' - '@':
+		return fxTremolo, param
+	case 'S' - '@':
+		// The S commands are ProTracker's E commands in a different order
+		extended := map[int]int{0x1: 0x3, 0x2: 0x5, 0x3: 0x4, 0x4: 0x7, 0x8: 0x8, 0xb: 0x6, 0xc: 0xc, 0xd: 0xd, 0xe: 0xe}
+		if command, ok := extended[x]; ok {
+			return fxExtended, command<<4 | y
+		}
+	case 'T' - '@':
+		return fxTempo, param
+	case 'U' - '@':
+		return fxFineVibrato, param
+	case 'V' - '@':
+		return fxGlobalVolume, param
+	case 'W' - '@':
+		return fxGlobalVolSlide, param
+	case 'X' - '@':
+		return fxPan, int(math.Min(float64(param*2), 255))
+	}
+	return fxArpeggio, 0
+}
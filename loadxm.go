@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Loads a FastTracker 2 extended module
+func loadXM(data []byte) (*modSong, error) {
+	song := newTrackerSong(formatXM, modString(data, 17, 20))
+	length, numPatterns, numInstruments := modUint16(data, 64), modUint16(data, 70), modUint16(data, 72)
+	song.restart = modUint16(data, 66)
+	song.channels = modUint16(data, 68)
+	song.linear = modUint16(data, 74)&1 != 0
+	song.speed, song.tempo = modUint16(data, 76), modUint16(data, 78)
+	if song.channels > 64 {
+		return nil, fmt.Errorf("too many channels")
+	}
+	for _, order := range modBytes(data, 80, int(math.Min(float64(length), 256))) {
+		song.orders = append(song.orders, int(order))
+	}
+
+	offset := 60 + modUint32(data, 60)
+	for i := 0; i < numPatterns; i++ {
+		rows, packedSize := modUint16(data, offset+5), modUint16(data, offset+7)
+		if rows == 0 {
+			rows = modRows
+		}
+		offset += modUint32(data, offset)
+		notes := make([]modNote, rows*song.channels)
+		for pos, n := offset, 0; pos < offset+packedSize && n < len(notes); n++ {
+			// A set top bit says which of the five fields follow, otherwise all of them do
+			var fields [5]int
+			mask := modByte(data, pos)
+			if mask&0x80 != 0 {
+				pos++
+			} else {
+				mask = 0x1f
+			}
+			for field := range fields {
+				if mask&(1<<field) != 0 {
+					fields[field] = modByte(data, pos)
+					pos++
+				}
+			}
+			notes[n] = xmNote(fields)
+		}
+		offset += packedSize
+		song.patterns = append(song.patterns, notes)
+	}
+
+	for i := 0; i < numInstruments; i++ {
+		if offset >= len(data) {
+			return nil, fmt.Errorf("instrument %d is missing", i+1)
+		}
+		instrument := modInstrument{name: modString(data, offset+4, 22)}
+		numSamples := modUint16(data, offset+27)
+		if numSamples == 0 {
+			offset += modUint32(data, offset)
+			song.instruments = append(song.instruments, instrument)
+			continue
+		}
+		first := len(song.samples)
+		for note := 0; note < 96; note++ {
+			if s := modByte(data, offset+33+note); s < numSamples {
+				instrument.samples[note] = first + s + 1
+			}
+		}
+		if modByte(data, offset+233)&1 != 0 {
+			instrument.envelope = xmEnvelope(data, offset)
+		}
+		instrument.fadeout = float64(modUint16(data, offset+239)) / 32768
+		headerSize := modUint32(data, offset+29)
+		offset += modUint32(data, offset)
+
+		// All the sample headers come first, then all the sample data
+		headers := offset
+		offset += numSamples * headerSize
+		for s := 0; s < numSamples; s++ {
+			header := headers + s*headerSize
+			length := modUint32(data, header)
+			loopStart, loopLength := modUint32(data, header+4), modUint32(data, header+8)
+			finetune, flags, relative := int(int8(modByte(data, header+13))), modByte(data, header+14), int(int8(modByte(data, header+16)))
+			sample := modSample{
+				name:    modString(data, header+18, 22),
+				volume:  int(math.Min(float64(modByte(data, header+12)), modMaxVolume)),
+				gain:    1,
+				pan:     float64(modByte(data, header+15)) / 255,
+				c5speed: 8363 * math.Pow(2, float64(relative*128+finetune)/1536),
+			}
+			bits16 := flags&0x10 != 0
+			sample.data = xmDeltaSamples(modBytes(data, offset, length), bits16)
+			offset += length
+			if bits16 {
+				loopStart, loopLength = loopStart/2, loopLength/2
+			}
+			if flags&3 != 0 {
+				setSampleLoop(&sample, loopStart, loopStart+loopLength, flags&3 == 2)
+			}
+			song.samples = append(song.samples, sample)
+		}
+		song.instruments = append(song.instruments, instrument)
+	}
+
+	if err := finishTrackerSong(song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+// Note, instrument, volume column, effect and parameter
+func xmNote(fields [5]int) modNote {
+	note := modNote{note: fields[0], instrument: fields[1], effect: fields[3], param: fields[4]}
+	switch {
+	case note.note == 97:
+		note.note = noteKeyOff
+	case note.note > 96:
+		note.note = 0
+	}
+
+	volume := fields[2]
+	switch volume >> 4 {
+	case 0x1, 0x2, 0x3, 0x4, 0x5:
+		if volume <= 0x50 {
+			note.volume, note.volumeParam = volSet, volume-0x10
+		}
+	case 0x6:
+		note.volume, note.volumeParam = volSlideDown, volume&0xf
+	case 0x7:
+		note.volume, note.volumeParam = volSlideUp, volume&0xf
+	case 0x8:
+		note.volume, note.volumeParam = volFineDown, volume&0xf
+	case 0x9:
+		note.volume, note.volumeParam = volFineUp, volume&0xf
+	case 0xa:
+		note.volume, note.volumeParam = volVibratoSpeed, volume&0xf
+	case 0xb:
+		note.volume, note.volumeParam = volVibrato, volume&0xf
+	case 0xc:
+		note.volume, note.volumeParam = volPan, (volume&0xf)*modMaxVolume/15
+	case 0xd:
+		note.volume, note.volumeParam = volPanSlideLeft, volume&0xf
+	case 0xe:
+		note.volume, note.volumeParam = volPanSlideRight, volume&0xf
+	case 0xf:
+		note.volume, note.volumeParam = volTonePorta, (volume&0xf)*16
+	}
+
+	// 0 to F are ProTracker's, the letters after them are FastTracker's own
+	switch note.effect {
+	case 'G' - 'A' + 10:
+		note.effect = fxGlobalVolume
+	case 'H' - 'A' + 10:
+		note.effect = fxGlobalVolSlide
+	case 'K' - 'A' + 10:
+		note.effect = fxKeyOff
+	case 'P' - 'A' + 10:
+		note.effect = fxPanSlide
+	case 'R' - 'A' + 10:
+		note.effect = fxRetrig
+	case 'T' - 'A' + 10:
+		note.effect = fxTremor
+	case 'X' - 'A' + 10:
+		note.effect = fxExtraFinePorta
+	default:
+		if note.effect > 0xf {
+			note.effect, note.param = fxArpeggio, 0
+		}
+	}
+	return note
+}
+
+func xmEnvelope(data []byte, offset int) *modEnvelope {
+	envelope := &modEnvelope{sustain: -1, loopStart: -1, loopEnd: -1}
+	numPoints := int(math.Min(float64(modByte(data, offset+225)), 12))
+	for i := 0; i < numPoints; i++ {
+		point := offset + 129 + i*4
+		envelope.points = append(envelope.points, [2]int{modUint16(data, point), modUint16(data, point+2)})
+	}
+	if len(envelope.points) == 0 {
+		return nil
+	}
+	flags := modByte(data, offset+233)
+	if sustain := modByte(data, offset+227); flags&2 != 0 && sustain < numPoints {
+		envelope.sustain = sustain
+	}
+	loopStart, loopEnd := modByte(data, offset+228), modByte(data, offset+229)
+	if flags&4 != 0 && loopStart <= loopEnd && loopEnd < numPoints {
+		envelope.loopStart, envelope.loopEnd = loopStart, loopEnd
+	}
+	return envelope
+}
+
+// XM sample data is stored as differences between neighbouring samples
+func xmDeltaSamples(raw []byte, bits16 bool) []int16 {
+	if bits16 {
+		samples := make([]int16, len(raw)/2)
+		var value int16
+		for i := range samples {
+			value += int16(modUint16(raw, i*2))
+			samples[i] = value
+		}
+		return samples
+	}
+	samples := make([]int16, len(raw))
+	var value int8
+	for i, b := range raw {
+		value += int8(b)
+		samples[i] = int16(value) * 256
+	}
+	return samples
+}
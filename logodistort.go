@@ -0,0 +1,169 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// The logo is drawn one texture row at a time so every line can be moved on its own
+var (
+	logoWobbleAmplitude = 24.0 // Pixels
+	logoWobbleWaves     = 3.0  // Sine waves down the height of the logo
+	logoWobbleSpeed     = 6.0  // Radians per second
+	logoWobbleTime      = 3.0  // Seconds until a wobble dies down
+
+	logoStretchAmount = 0.35 // Largest change in height, the width changes the other way
+	logoStretchSpeed  = 14.0
+	logoStretchTime   = 1.5
+
+	logoMeltGravity = 900.0 // Pixels per second squared
+	logoMeltFade    = 0.8   // Seconds for a dripping line to fade out
+
+	logoRevealTime = 1.2 // Seconds for the interlaced reveal when the logo enters
+
+	logoShineWidth = 80.0 // Pixels
+	logoShineSlant = 0.5  // Pixels across per line down
+	logoShineTime  = 1.0
+	logoShineEvery = 7.0 // Seconds between automatic shines, 0 for none
+
+	// When each effect was triggered, zero if it hasn't been
+	logoWobbleStart, logoStretchStart, logoMeltStart, logoRevealStart, logoShineStart time.Time
+
+	logoMeltDelays []float64
+)
+
+func logoWobble() {
+	logoWobbleStart = time.Now()
+}
+
+func logoStretch() {
+	logoStretchStart = time.Now()
+}
+
+// Drips the lines off the bottom of the logo, starting with the lowest
+func logoMelt() {
+	logoMeltStart = time.Now()
+	logoMeltDelays = make([]float64, imageHeight)
+	for i := range logoMeltDelays {
+		logoMeltDelays[i] = (1-float64(i)/float64(imageHeight))*0.5 + rand.Float64()*0.4
+	}
+}
+
+func logoReveal() {
+	logoRevealStart = time.Now()
+	logoMeltStart = time.Time{}
+}
+
+func logoShine() {
+	logoShineStart = time.Now()
+}
+
+// Seconds since an effect was triggered and how much of it is left, from 1 down to 0
+func logoEffect(start time.Time, duration float64) (float64, float64) {
+	if start.IsZero() {
+		return 0, 0
+	}
+	elapsed := time.Since(start).Seconds()
+	return elapsed, math.Max(0, 1-elapsed/duration)
+}
+
+func drawBouncingLogo() {
+	if logoY >= float64(windowHeight) || logoY <= -float64(imageHeight) {
+		return
+	}
+	t := time.Since(startTime).Seconds()
+	if logoShineEvery > 0 && (logoShineStart.IsZero() || time.Since(logoShineStart).Seconds() > logoShineEvery) {
+		logoShine()
+	}
+
+	_, wobble := logoEffect(logoWobbleStart, logoWobbleTime)
+	stretchElapsed, stretch := logoEffect(logoStretchStart, logoStretchTime)
+	meltElapsed, _ := logoEffect(logoMeltStart, logoMeltFade)
+	revealElapsed, _ := logoEffect(logoRevealStart, logoRevealTime)
+	shineElapsed, shine := logoEffect(logoShineStart, logoShineTime)
+
+	// Squash and stretch around the centre of the logo, keeping its area
+	scaleY := 1 + logoStretchAmount*stretch*math.Sin(stretchElapsed*logoStretchSpeed)
+	scaleX := 1 / scaleY
+	width, height := float64(imageWidth), float64(imageHeight)
+	centreX, centreY := logoX+width/2, logoY+height/2
+	left := centreX - width*scaleX/2
+
+	type shineLine struct {
+		x, y, alpha float64
+		row         int
+	}
+	var shineLines []shineLine
+	for row := 0; row < int(imageHeight); row++ {
+		line := float64(row)
+		if !logoRevealStart.IsZero() && revealElapsed < logoRevealTime {
+			// Even lines come in from the top and odd lines from the bottom
+			p := revealElapsed / logoRevealTime
+			if (row%2 == 0 && line > p*height) || (row%2 == 1 && line < (1-p)*height) {
+				continue
+			}
+		}
+
+		x := left + logoWobbleAmplitude*wobble*math.Sin(line/height*logoWobbleWaves*2*math.Pi+t*logoWobbleSpeed)
+		y := centreY + (line-height/2)*scaleY
+		alpha := 1.0
+		if !logoMeltStart.IsZero() {
+			drop := math.Max(0, meltElapsed-logoMeltDelays[row])
+			y += 0.5 * logoMeltGravity * drop * drop
+			alpha = math.Max(0, 1-drop/logoMeltFade)
+			if alpha == 0 {
+				continue
+			}
+		}
+
+		v0, v1 := float32(line/height), float32((line+1)/height)
+		c := sdl.Color{R: 255, G: 255, B: 255, A: uint8(255 * alpha)}
+		batchTextureRect(texture, float32(x), float32(y), float32(width*scaleX), float32(math.Max(scaleY, 1)), 0, v0, 1, v1, c, c)
+		if shine > 0 {
+			shineLines = append(shineLines, shineLine{x, y, alpha, row})
+		}
+	}
+	flushBatch()
+
+	if len(shineLines) == 0 {
+		return
+	}
+	// Adding the logo to itself under a band that sweeps across it
+	err := texture.SetBlendMode(sdl.BLENDMODE_ADD)
+	if err != nil {
+		return
+	}
+	defer texture.SetBlendMode(sdl.BLENDMODE_BLEND)
+	sweep := -logoShineWidth + (width+2*logoShineWidth+height*logoShineSlant)*shineElapsed/logoShineTime
+	for _, line := range shineLines {
+		band := sweep - float64(line.row)*logoShineSlant
+		from, to := math.Max(0, band-logoShineWidth/2), math.Min(width, band+logoShineWidth/2)
+		if to > from {
+			batchShineLine(line.x, line.y, line.alpha, line.row, from, band, to, scaleX, scaleY)
+		}
+	}
+	flushBatch()
+}
+
+// One line of the shine band, brightest in the middle and fading out to both sides
+func batchShineLine(x, y, alpha float64, row int, from, middle, to, scaleX, scaleY float64) {
+	width, height := float64(imageWidth), float64(imageHeight)
+	bright := sdl.Color{R: 255, G: 255, B: 255, A: uint8(255 * alpha)}
+	dark := sdl.Color{A: bright.A}
+	v0, v1 := float32(float64(row)/height), float32(float64(row+1)/height)
+	h := float32(math.Max(scaleY, 1))
+	middle = math.Max(from, math.Min(middle, to))
+	edgeColor := func(column float64) sdl.Color {
+		return lerpColor(bright, dark, math.Abs(column-middle)/(logoShineWidth/2))
+	}
+	if middle > from {
+		batchTextureRect(texture, float32(x+from*scaleX), float32(y), float32((middle-from)*scaleX), h,
+			float32(from/width), v0, float32(middle/width), v1, edgeColor(from), bright)
+	}
+	if to > middle {
+		batchTextureRect(texture, float32(x+middle*scaleX), float32(y), float32((to-middle)*scaleX), h,
+			float32(middle/width), v0, float32(to/width), v1, bright, edgeColor(to))
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+	"math"
+)
+
+const (
+	logoOutline      = 4 // Pixels
+	logoShadowOffset = 8
+	logoShadowBlur   = 4
+	logoBevelBlur    = 3
+	logoBevelDepth   = 6.0 // Strength of the bevel lighting
+)
+
+var (
+	logoFontFile string
+	logoText     = "INTUITION"
+
+	// Chrome is a sky fading down to a bright horizon, then dark ground getting lighter
+	logoChromeStops = []struct {
+		position float64
+		color    sdl.Color
+	}{
+		{0, sdl.Color{R: 30, G: 50, B: 120, A: 255}},
+		{0.48, sdl.Color{R: 235, G: 245, B: 255, A: 255}},
+		{0.52, sdl.Color{R: 70, G: 50, B: 30, A: 255}},
+		{0.8, sdl.Color{R: 210, G: 160, B: 90, A: 255}},
+		{1, sdl.Color{R: 255, G: 245, B: 210, A: 255}},
+	}
+	logoOutlineColor = sdl.Color{R: 10, G: 10, B: 40, A: 255}
+	logoShadowAlpha  = 0.6
+)
+
+// Renders text in a TTF or OTF font as a chrome logo with a bevel, outline and drop shadow
+func generateLogoTexture(text, fontFile string) (*sdl.Texture, error) {
+	if err := ttf.Init(); err != nil {
+		return nil, err
+	}
+	defer ttf.Quit()
+	font, err := ttf.OpenFont(fontFile, int(windowHeight)/6)
+	if err != nil {
+		return nil, err
+	}
+	defer font.Close()
+	surface, err := font.RenderUTF8Blended(text, sdl.Color{R: 255, G: 255, B: 255, A: 255})
+	if err != nil {
+		return nil, err
+	}
+	defer surface.Free()
+
+	// Leave room around the text for the outline and shadow
+	pad := logoOutline + logoShadowOffset + logoShadowBlur
+	textWidth, textHeight := int(surface.W), int(surface.H)
+	width, height := textWidth+2*pad, textHeight+2*pad
+	mask := make([]float64, width*height)
+	for y := 0; y < textHeight; y++ {
+		for x := 0; x < textWidth; x++ {
+			_, _, _, a := surface.At(x, y).RGBA()
+			mask[(y+pad)*width+x+pad] = float64(a) / 0xffff
+		}
+	}
+
+	outline := dilateMask(mask, width, height, logoOutline)
+	shadow := blurMask(outline, width, height, logoShadowBlur)
+	bevel := blurMask(mask, width, height, logoBevelBlur)
+
+	pixels := make([]uint32, width*height)
+	for y := 0; y < height; y++ {
+		chrome := logoChromeColor(float64(y-pad) / float64(textHeight))
+		for x := 0; x < width; x++ {
+			i := y*width + x
+
+			var r, g, b, a float64
+			if sx, sy := x-logoShadowOffset, y-logoShadowOffset; sx >= 0 && sy >= 0 {
+				a = shadow[sy*width+sx] * logoShadowAlpha
+			}
+			r, g, b, a = blendOver(r, g, b, a, logoOutlineColor, outline[i])
+
+			// Light from the top left on the slopes of the blurred text
+			shade := 1.0
+			if x > 0 && y > 0 && x < width-1 && y < height-1 {
+				slope := bevel[(y-1)*width+x-1] - bevel[(y+1)*width+x+1]
+				shade = math.Max(0.3, math.Min(1.6, 1+slope*logoBevelDepth))
+			}
+			r, g, b, a = blendOver(r, g, b, a, fadeColor(chrome, math.Min(shade, 1)), mask[i])
+			if shade > 1 {
+				// Highlights go towards white
+				highlight := (shade - 1) * mask[i]
+				r, g, b = r+(255-r)*highlight, g+(255-g)*highlight, b+(255-b)*highlight
+			}
+			pixels[i] = uint32(a*255)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+		}
+	}
+	return createTextureFromPixels(pixels, int32(width), int32(height))
+}
+
+func logoChromeColor(position float64) sdl.Color {
+	stops := logoChromeStops
+	position = math.Max(0, math.Min(position, 1))
+	for i := 1; i < len(stops); i++ {
+		if position <= stops[i].position {
+			p := (position - stops[i-1].position) / (stops[i].position - stops[i-1].position)
+			return lerpColor(stops[i-1].color, stops[i].color, p)
+		}
+	}
+	return stops[len(stops)-1].color
+}
+
+// Porter-Duff over with straight alpha, colours are 0 to 255 and alpha 0 to 1
+func blendOver(r, g, b, a float64, c sdl.Color, alpha float64) (float64, float64, float64, float64) {
+	outAlpha := alpha + a*(1-alpha)
+	if outAlpha == 0 {
+		return 0, 0, 0, 0
+	}
+	composite := func(under float64, over uint8) float64 {
+		return (float64(over)*alpha + under*a*(1-alpha)) / outAlpha
+	}
+	return composite(r, c.R), composite(g, c.G), composite(b, c.B), outAlpha
+}
+
+// Largest value within radius pixels
+func dilateMask(mask []float64, width, height, radius int) []float64 {
+	out := make([]float64, len(mask))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			largest := 0.0
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					sx, sy := x+dx, y+dy
+					if dx*dx+dy*dy > radius*radius || sx < 0 || sy < 0 || sx >= width || sy >= height {
+						continue
+					}
+					largest = math.Max(largest, mask[sy*width+sx])
+				}
+			}
+			out[y*width+x] = largest
+		}
+	}
+	return out
+}
+
+// Box blur, horizontally then vertically
+func blurMask(mask []float64, width, height, radius int) []float64 {
+	blur := func(in []float64, step, count, lines, lineStep int) []float64 {
+		out := make([]float64, len(in))
+		for line := 0; line < lines; line++ {
+			for i := 0; i < count; i++ {
+				sum := 0.0
+				for j := i - radius; j <= i+radius; j++ {
+					if j >= 0 && j < count {
+						sum += in[line*lineStep+j*step]
+					}
+				}
+				out[line*lineStep+i*step] = sum / float64(2*radius+1)
+			}
+		}
+		return out
+	}
+	return blur(blur(mask, 1, width, height, width), width, height, width, 1)
+}
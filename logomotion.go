@@ -0,0 +1,230 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	logoGravity    = 2400.0 // Pixels per second squared
+	logoElasticity = 0.55   // Fraction of the speed kept after each bounce
+	logoRestSpeed  = 60.0   // Bounces slower than this come to rest
+	logoStiffness  = 60.0
+	logoDamping    = 0.3 // Fraction of critical damping, lower overshoots more
+	logoTweenTime  = 1.5 // Seconds taken by an eased entry or exit
+	logoSegment    = 2.0 // Seconds per Bezier segment
+)
+
+type logoMotion struct {
+	name   string
+	offset func(t float64) (float64, float64) // From the home position, in pixels
+}
+
+var (
+	// Motions around the home position, cycled with the L key or picked with "-logo name"
+	logoMotions = []logoMotion{
+		{"jitter", jitterLogo},
+		{"still", stillLogo},
+		{"sine", sineLogo},
+		{"lissajous", lissajousLogo},
+		{"bezier", bezierLogo},
+	}
+	currentLogoMotion int
+
+	// How the logo gets to its motion when entering and leaves when exiting, picked with "-logoenter name"
+	logoSettle = "bounce"
+	easings    = map[string]func(float64) float64{
+		"linear":     func(p float64) float64 { return p },
+		"inquad":     func(p float64) float64 { return p * p },
+		"outquad":    func(p float64) float64 { return 1 - (1-p)*(1-p) },
+		"inoutcubic": easeInOutCubic,
+		"outback":    easeOutBack,
+		"outelastic": easeOutElastic,
+		"outbounce":  easeOutBounce,
+	}
+
+	logoX, logoY           float64 // Top left corner of the logo
+	logoVX, logoVY         float64
+	logoHomeY              float64
+	logoShown              = true
+	logoTime               float64 // Seconds of logo motion, moved on a frame at a time
+	logoTweenStart         float64
+	logoTweenX, logoTweenY float64 // Where the current tween started
+	logoLanded             bool    // The thud has played for this entry
+
+	// A closed loop of cubic Bezier segments, in fractions of the free space around the home position
+	logoBezier = [][4]Point3D{
+		{{0, 0, 0}, {0.5, -0.9, 0}, {0.9, -0.2, 0}, {0.7, 0.3, 0}},
+		{{0.7, 0.3, 0}, {0.5, 0.8, 0}, {-0.3, -0.9, 0}, {-0.7, -0.3, 0}},
+		{{-0.7, -0.3, 0}, {-1.1, 0.3, 0}, {-0.5, 0.9, 0}, {0, 0, 0}},
+	}
+)
+
+func setLogoMotion(name string) bool {
+	for i, motion := range logoMotions {
+		if motion.name == name {
+			currentLogoMotion = i
+			return true
+		}
+	}
+	return false
+}
+
+func cycleLogoMotion() {
+	currentLogoMotion = (currentLogoMotion + 1) % len(logoMotions)
+}
+
+func setLogoSettle(name string) bool {
+	if _, ok := easings[name]; ok || name == "bounce" || name == "spring" {
+		logoSettle = name
+		return true
+	}
+	return false
+}
+
+// Brings the logo in from above the screen
+func logoEnter() {
+	logoShown = true
+	logoX = (float64(windowWidth) - float64(imageWidth)) / 2
+	logoY = -float64(imageHeight)
+	logoVX, logoVY = 0, 0
+	startLogoTween()
+	logoReveal()
+}
+
+// Sends the logo off the screen, up or through the floor for a bounce
+func logoExit() {
+	logoShown = false
+	startLogoTween()
+}
+
+func toggleLogo() {
+	if logoShown {
+		logoExit()
+	} else {
+		logoEnter()
+	}
+}
+
+func startLogoTween() {
+	logoTweenStart = logoTime
+	logoTweenX, logoTweenY = logoX, logoY
+	logoLanded = false
+}
+
+// How far the logo can move from home and stay on the screen
+func logoFreeSpace() (float64, float64) {
+	return math.Max(0, float64(windowWidth-imageWidth)/2), math.Max(0, logoHomeY*0.8)
+}
+
+func stillLogo(t float64) (float64, float64) {
+	return 0, 0
+}
+
+func jitterLogo(t float64) (float64, float64) {
+	return 0, 4 * math.Sin(t*20)
+}
+
+func sineLogo(t float64) (float64, float64) {
+	_, h := logoFreeSpace()
+	return 0, h * math.Sin(t*1.5)
+}
+
+func lissajousLogo(t float64) (float64, float64) {
+	w, h := logoFreeSpace()
+	return w * 0.8 * math.Sin(t*0.9), h * math.Sin(t*1.7)
+}
+
+func bezierLogo(t float64) (float64, float64) {
+	w, h := logoFreeSpace()
+	segment := logoBezier[int(t/logoSegment)%len(logoBezier)]
+	p := bezierPoint(segment, easeInOutCubic(math.Mod(t, logoSegment)/logoSegment))
+	return w * p.x, h * p.y
+}
+
+func bezierPoint(c [4]Point3D, t float64) Point3D {
+	u := 1 - t
+	a, b, d, e := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+	return Point3D{
+		a*c[0].x + b*c[1].x + d*c[2].x + e*c[3].x,
+		a*c[0].y + b*c[1].y + d*c[2].y + e*c[3].y,
+		a*c[0].z + b*c[1].z + d*c[2].z + e*c[3].z,
+	}
+}
+
+func easeInOutCubic(p float64) float64 {
+	if p < 0.5 {
+		return 4 * p * p * p
+	}
+	return 1 - math.Pow(-2*p+2, 3)/2
+}
+
+func easeOutBack(p float64) float64 {
+	const overshoot = 1.70158
+	return 1 + (overshoot+1)*math.Pow(p-1, 3) + overshoot*math.Pow(p-1, 2)
+}
+
+func easeOutElastic(p float64) float64 {
+	if p == 0 || p == 1 {
+		return p
+	}
+	return math.Pow(2, -10*p)*math.Sin((p*10-0.75)*2*math.Pi/3) + 1
+}
+
+func easeOutBounce(p float64) float64 {
+	const n, d = 7.5625, 2.75
+	switch {
+	case p < 1/d:
+		return n * p * p
+	case p < 2/d:
+		p -= 1.5 / d
+		return n*p*p + 0.75
+	case p < 2.5/d:
+		p -= 2.25 / d
+		return n*p*p + 0.9375
+	default:
+		p -= 2.625 / d
+		return n*p*p + 0.984375
+	}
+}
+
+func updateBouncingLogoPosition() {
+	logoTime += deltaTime
+	offsetX, offsetY := logoMotions[currentLogoMotion].offset(logoTime)
+	targetX := (float64(windowWidth)-float64(imageWidth))/2 + offsetX
+	targetY := logoHomeY + offsetY
+	if !logoShown {
+		targetY = -2 * float64(imageHeight)
+	}
+
+	switch logoSettle {
+	case "bounce":
+		// Falls under gravity onto the target and bounces until it comes to rest
+		logoX = targetX
+		logoVY += logoGravity * deltaTime
+		logoY += logoVY * deltaTime
+		if logoShown && logoY >= targetY {
+			logoY = targetY
+			if logoVY < logoRestSpeed {
+				logoVY = 0
+			} else {
+				// Each bounce thuds a little quieter
+				playSound("thud", logoVY/1500)
+				logoVY = -logoVY * logoElasticity
+			}
+		}
+	case "spring":
+		damping := 2 * math.Sqrt(logoStiffness) * logoDamping
+		logoVX += (logoStiffness*(targetX-logoX) - damping*logoVX) * deltaTime
+		logoVY += (logoStiffness*(targetY-logoY) - damping*logoVY) * deltaTime
+		logoX += logoVX * deltaTime
+		logoY += logoVY * deltaTime
+	default:
+		p := easings[logoSettle](math.Min((logoTime-logoTweenStart)/logoTweenTime, 1))
+		logoX = logoTweenX + (targetX-logoTweenX)*p
+		logoY = logoTweenY + (targetY-logoTweenY)*p
+		if logoShown && p >= 1 && !logoLanded {
+			playSound("thud", 0.8)
+			logoLanded = true
+		}
+	}
+}
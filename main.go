@@ -7,35 +7,31 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 	"log"
 	"math"
-	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	FPS           = 60
 	numStars      = 1000
-	maxTrailLen   = 5
 	scrollSpeed   = 10
 	fontWidth     = 32
 	fontHeight    = 32
 	displayWidth  = 64
 	displayHeight = 64
-	numBars       = 5
-	barHeight     = 60
+	sheetWidth    = 320 // Size of the font image
+	sheetHeight   = 200
 )
 
 type Point3D struct {
 	x, y, z float64
 }
-type Star struct {
-	x, y, z, speed float64
-	trail          []Point3D
-}
 type Edge struct {
 	start, end int
 }
+type Matrix3 [3][3]float64
 
 var (
 	renderer     *sdl.Renderer
@@ -75,12 +71,14 @@ var (
 		{0, 0, 255, 255},   // Left (blue)
 		{255, 255, 0, 255}, // Right (yellow)
 	}
+	objectOrientation = identityMatrix()
 
-	// Starfield variables
-	stars []Star
+	// Centrepiece effects, cycled with the gamepad buttons
+	objectEffects = []func(angle float64){drawCube, drawWireframeCube, drawVectorBalls, drawDotObject, drawGlenz, drawGlenzAdditive}
+	objectEffect  int
 
 	// Scrolltext variables
-	scrollText  = "..:INTUITION PRESENTS:..    \"I FEEL 16 AGAIN!\"    ..:PRESS THE UP AND DOWN KEYS TO ZOOM THE CUBE IN AND OUT:..    ..:\"-WIN\" ARGUMENT ON COMMANDLINE TO RUN IN WINDOWED MODE:..    ..:\"-WIN WIDTH HEIGHT\" TO SET WINDOW SIZE:..  ..:\"-DEBUG\" TO SHOW FPS:..  ..:PRESS Q OR ESC TO QUIT:..    ..:ORIGINAL COMIC BAKERY MUSIC FOR C64 BY MARTIN GALWAY IN 1984...     ..:SID TO PROTRACKER CONVERSION FOR AMIGA BY H0FFMAN (DREAMFISH OF TRSI) IN 1994:..    ..:GOLANG CODE BY INTUITION IN 2024:..    ..:FONT GRAPHICS BY UNKNOWN:..    ..:GREETS TO KARLOS AND GADGETMASTER!!!:..          "
+	scrollText  = "..:INTUITION PRESENTS:..    \"I FEEL 16 AGAIN!\"    ..:PRESS THE UP AND DOWN KEYS TO ZOOM THE CUBE IN AND OUT:..    ..:DRAG THE MOUSE TO SPIN THE CUBE AND USE THE WHEEL TO ZOOM:..    ..:PLUG IN A JOYPAD: STICKS SPIN, TRIGGERS ZOOM, BUTTONS CHANGE EFFECT:..    ..:PRESS S TO CHANGE THE STARFIELD AND J FOR A HYPERSPACE JUMP:..    ..:C CHANGES THE STAR COLOURS AND T TOGGLES TWINKLE:..    ..:V CHANGES THE CAMERA PATH:..    ..:B TOGGLES THE COPPER BACKGROUND AND I CHANGES HOW THE BARS OVERLAP:..    ..:K FOR KEFRENS BARS AND W FOR THE TWISTER:..    ..:L CHANGES THE LOGO MOTION AND E MAKES IT EXIT OR ENTER:..    ..:D WOBBLES, G SQUASHES, M MELTS AND H SHINES THE LOGO:..    ..:A SHOWS THE SPECTRUM ANALYSER, VU METERS AND SCOPE AND P THE QUADRASCOPE:..    ..:[ AND ] CHANGE THE TUNE AND , AND . THE SID SUB-TUNE:..    ..:X NARROWS THE STEREO, O PICKS AN A500 OR A1200, F FLICKS THE LED FILTER AND R PLAYS SAMPLES LIKE PAULA:..    ..:\"-WIN\" ARGUMENT ON COMMANDLINE TO RUN IN WINDOWED MODE:..    ..:\"-WIN WIDTH HEIGHT\" TO SET WINDOW SIZE:..  ..:\"-DEBUG\" TO SHOW FPS:..  ..:PRESS Q OR ESC TO QUIT:..    ..:ORIGINAL COMIC BAKERY MUSIC FOR C64 BY MARTIN GALWAY IN 1984...     ..:SID TO PROTRACKER CONVERSION FOR AMIGA BY H0FFMAN (DREAMFISH OF TRSI) IN 1994:..    ..:GOLANG CODE BY INTUITION IN 2024:..    ..:FONT GRAPHICS BY UNKNOWN:..    ..:GREETS TO KARLOS AND GADGETMASTER!!!:..          "
 	scrollPosX  = float64(windowWidth)
 	fontTexture *sdl.Texture
 	charMap     = map[rune][2]int{
@@ -95,21 +93,24 @@ var (
 	// Bouncing logo variables
 	texture                 *sdl.Texture
 	imageWidth, imageHeight int32
-	posY, targetY           int
-
-	// Copper bar variables
-	barOffsets  = make([]int, numBars)
-	barTextures []*sdl.Texture
 
 	// Loop control
 	running   = true
 	startTime = time.Now()
+	lastFrame = time.Now()
+	deltaTime = 1.0 / FPS // Seconds since the previous frame
 
 	debug bool
 )
 
 func main() {
 	parseCommandLineArgs()
+	if exportAudioFile != "" {
+		if err := exportAudio(exportAudioFile); err != nil {
+			log.Fatalf("Failed to export audio: %s", err)
+		}
+		return
+	}
 	err := initSDL()
 	if err != nil {
 		return
@@ -121,7 +122,21 @@ func main() {
 	fmt.Println("Cubetro by Intuition (2024)\n")
 	fmt.Println("\"-win\" argument on commandline to run in windowed mode")
 	fmt.Println("\"-win width height\" to set window size (default 1024x768)")
-	fmt.Println("\"-debug\" to show FPS\n")
+	fmt.Println("\"-debug\" to show FPS")
+	fmt.Println("\"-obj file.obj\" to add an OBJ mesh to the vector ball morphs")
+	fmt.Println("\"-starcolors white|temperature|depth|RRGGBB,...\" to colour the stars")
+	fmt.Println("\"-trail seconds\" and \"-trailcurve exponent\" to set star trail length and fade")
+	fmt.Println("\"-camera static|orbit|swoop|bank\" to pick the camera path")
+	fmt.Println("\"-copper file\" to run a copper list from a text file as the background")
+	fmt.Println("\"-bars file\" to load copper bar designs from a text file")
+	fmt.Println("\"-logo jitter|still|sine|lissajous|bezier\" to pick the logo motion")
+	fmt.Println("\"-logoenter bounce|spring|linear|inquad|outquad|inoutcubic|outback|outelastic|outbounce\" for how it enters and exits")
+	fmt.Println("\"-logofont file.ttf\" and \"-logotext name\" to generate a chrome logo from a font")
+	fmt.Println("\"-sync file\" to load rules that drive the visuals from the music")
+	fmt.Println("\"-playlist file\" to play MOD, S3M, XM and IT modules and SID tunes in turn, \"-shuffle\" to mix up the order")
+	fmt.Println("\"-separation percent\" to narrow the stereo, \"-amiga off|a500|a1200\" for the Amiga's output filters")
+	fmt.Println("\"-ledfilter\" to start with the LED filter on and \"-paula\" to play samples the way Paula does")
+	fmt.Println("\"export-audio out.wav\" to render the soundtrack to a WAV file instead of running the intro\n")
 
 	setupDisplay()
 	defer func(window *sdl.Window) {
@@ -143,12 +158,6 @@ func main() {
 		return
 	}
 
-	displayKick13Image(2 * time.Second)
-	playFloppySound()
-	drawDecrunchEffect(2 * time.Second)
-	initStars()
-	playMusic()
-
 	if err := setupFont(); err != nil {
 		_, err := fmt.Fprintf(os.Stderr, "Failed to setup font: %s\n", err)
 		if err != nil {
@@ -163,6 +172,30 @@ func main() {
 		}
 	}(fontTexture)
 
+	if err := setupPlaylist(); err != nil {
+		log.Fatalf("Failed to load playlist: %s", err)
+	}
+	buildSoundEffects()
+	buildFloppySound()
+	if err := setupSoundEffects(); err != nil {
+		log.Fatalf("Failed to setup sound effects: %s", err)
+	}
+
+	// The drive clicks at the insert disk screen, then loads the intro during the decrunch
+	playFloppySound()
+	displayKick13Image(time.Duration(floppyIdleTime * float64(time.Second)))
+	drawDecrunchEffect(time.Duration((floppyLength - floppyIdleTime) * float64(time.Second)))
+	if err := initStars(); err != nil {
+		log.Fatalf("Failed to setup starfield: %s", err)
+	}
+	defer func(starTexture *sdl.Texture) {
+		err := starTexture.Destroy()
+		if err != nil {
+
+		}
+	}(starTexture)
+	playMusic()
+
 	if err := setupBouncingLogo(); err != nil {
 		log.Fatalf("Failed to setup bouncing logo: %s", err)
 	}
@@ -173,8 +206,39 @@ func main() {
 		}
 	}(texture)
 
-	// Pre-render the copper bars into textures
-	createBarTextures()
+	if err := setupVectorBalls(); err != nil {
+		log.Fatalf("Failed to setup vector balls: %s", err)
+	}
+	defer func(ballTexture *sdl.Texture) {
+		err := ballTexture.Destroy()
+		if err != nil {
+
+		}
+	}(ballTexture)
+
+	if err := setupCopper(); err != nil {
+		log.Fatalf("Failed to load copper list: %s", err)
+	}
+
+	if err := setupCopperBars(); err != nil {
+		log.Fatalf("Failed to load copper bars: %s", err)
+	}
+
+	setupAnalyser()
+
+	if err := setupSync(); err != nil {
+		log.Fatalf("Failed to load sync rules: %s", err)
+	}
+
+	if err := setupRasterEffects(); err != nil {
+		log.Fatalf("Failed to setup raster effects: %s", err)
+	}
+	defer func(rasterTexture *sdl.Texture) {
+		err := rasterTexture.Destroy()
+		if err != nil {
+
+		}
+	}(rasterTexture)
 
 	var frameCount int
 	var fps float64
@@ -183,9 +247,17 @@ func main() {
 	// Main loop
 	startTime = time.Now()
 	lastTime = startTime
+	lastFrame = startTime
 	for running {
 		frameStart := time.Now()
+		updateDeltaTime()
 		handleEvents()
+		updatePlaylist()
+		updateControllerInput()
+		updateAnalyser()
+		updateSync()
+		updateCamera()
+		updateStarfield()
 		updateZoomLevel() // Zoom in/out
 
 		err := renderer.SetDrawColor(0, 0, 0, 255)
@@ -196,12 +268,16 @@ func main() {
 		if err != nil {
 			return
 		}
+		beginSyncShake()
 
+		drawCopper()
 		drawRainbowLine(50, 200, false)
 		drawStarfield()
 
-		drawCopperBars(time.Since(startTime).Seconds())
-		drawCube(rotationAngle)
+		drawCopperBars(time.Since(startTime).Seconds(), false)
+		drawRasterEffects(time.Since(startTime).Seconds())
+		drawObject(rotationAngle)
+		drawStarfieldFront()
 		rotateCube()
 
 		drawScrollText(scrollText, scrollPosX)
@@ -209,8 +285,13 @@ func main() {
 
 		updateBouncingLogoPosition()
 		drawBouncingLogo()
+		drawCopperBars(time.Since(startTime).Seconds(), true)
+		drawAnalyser()
+		drawQuadrascope()
+		drawNowPlaying()
 
 		drawRainbowLine(windowHeight-50, 200, true)
+		endSync()
 
 		renderer.Present()
 
@@ -222,7 +303,7 @@ func main() {
 			frameCount = 0
 			lastTime = time.Now()
 			if debug {
-				fmt.Printf("FPS: %.2f\n", fps)
+				fmt.Printf("FPS: %.2f  %s\n", fps, musicState())
 				// Move cursor back up one line
 				fmt.Print("\033[A")
 			}
@@ -293,46 +374,6 @@ func displayKick13Image(duration time.Duration) {
 	renderer.Present()
 }
 
-func loadMp3FromBytes(data []byte) (*mix.Music, error) {
-	rwops, err := sdl.RWFromMem(data)
-	if err != nil {
-		return nil, fmt.Errorf("could not create RWops from bytes: %v", err)
-	}
-
-	music, err := mix.LoadMUSRW(rwops, 0)
-	if err != nil {
-		return nil, fmt.Errorf("could not load MP3 from RWops: %v", err)
-	}
-
-	return music, nil
-}
-
-func playMp3(music *mix.Music) error {
-	if err := music.Play(1); err != nil {
-		return fmt.Errorf("failed to play music: %v", err)
-	}
-
-	// Wait for the audio to finish playing
-	for mix.PlayingMusic() != false {
-		sdl.Delay(100)
-	}
-
-	return nil
-}
-
-func playFloppySound() {
-	music, err := loadMp3FromBytes(floppySound)
-	if err != nil {
-		log.Fatalf("Failed to load floppysound MP3: %s", err)
-	}
-
-	err = playMp3(music)
-	if err != nil {
-		log.Fatalf("Failed to play floppysound MP3: %s", err)
-	}
-	music.Free()
-}
-
 func drawDecrunchEffect(duration time.Duration) {
 	startTime := time.Now()
 	speed := int32(20)
@@ -371,17 +412,11 @@ func drawDecrunchEffect(duration time.Duration) {
 			colorIndex := (y + t) % int32(len(colors))
 			color := colors[colorIndex]
 
-			err := renderer.SetDrawColor(color[0], color[1], color[2], 255)
-			if err != nil {
-				return
-			}
-			for i := int32(0); i < barThickness; i++ {
-				err := renderer.DrawLine(0, y+i, windowWidth, y+i)
-				if err != nil {
-					return
-				}
-			}
+			c := sdl.Color{R: color[0], G: color[1], B: color[2], A: 255}
+			batchRect(0, float32(y), float32(windowWidth), float32(barThickness), c, c)
 		}
+		drawLoadingTrack()
+		flushBatch()
 		renderer.Present()
 		sdl.Delay(16) // Limit frame rate to about 60 FPS
 	}
@@ -403,29 +438,33 @@ func drawRainbowLine(y int32, speed int32, reverse bool) {
 		t = -t
 	}
 
-	for i := int32(0); i < windowWidth; i++ {
-		// Calculate the fractional position within the current color segment
-		pos := float32(i%lineWidth) / float32(lineWidth)
+	// A copper list that sets COLOR02 to COLOR13 takes over the colours, which then cycle like a palette
+	if palette, ok := copperRainbow(float32(y)); ok {
+		colors = palette
+	}
 
+	// Each colour segment is a single gradient quad from its colour to the next
+	for x := int32(0); x < windowWidth; x += lineWidth {
 		// Get the current and next color index, adjusted to cycle in the correct direction
-		colorIndex := (i/lineWidth + t) % numColors
+		colorIndex := (x/lineWidth + t) % numColors
 		if colorIndex < 0 {
 			colorIndex += numColors
 		}
 		nextColorIndex := (colorIndex + 1) % numColors
 
-		// Interpolate between the current and next color
-		color := interpolateColor(colors[colorIndex], colors[nextColorIndex], pos)
-
-		err := renderer.SetDrawColor(color[0], color[1], color[2], 255)
-		if err != nil {
-			return
-		}
-		err = renderer.DrawLine(i, y, i, y+5)
-		if err != nil {
-			return
+		// The last segment may be cut short by the edge of the screen
+		width := lineWidth
+		if x+width > windowWidth {
+			width = windowWidth - x
 		}
+		left := colors[colorIndex]
+		right := interpolateColor(colors[colorIndex], colors[nextColorIndex], float32(width)/float32(lineWidth))
+
+		batchRect(float32(x), float32(y), float32(width), 6,
+			sdl.Color{R: left[0], G: left[1], B: left[2], A: 255},
+			sdl.Color{R: right[0], G: right[1], B: right[2], A: 255})
 	}
+	flushBatch()
 }
 
 func interpolateColor(c1, c2 [3]uint8, t float32) [3]uint8 {
@@ -458,64 +497,65 @@ func rotatePoint(point Point3D, angle float64) Point3D {
 	return point
 }
 func projectPoint(point Point3D) Point3D {
-	distance := 3.0
-	factor := distance / (distance + point.z) * zoomFactor
-	x := point.x * factor * float64(windowWidth) / 2
-	y := point.y * factor * float64(windowHeight) / 2
-	return Point3D{x, y, point.z}
+	// Zoom scales the object, the shared camera does the perspective
+	return projectWorld(Point3D{point.x * zoomFactor, point.y * zoomFactor, point.z * zoomFactor})
 }
-func fillPolygon(renderer *sdl.Renderer, points []sdl.Point, indices []int) {
-	var sdlPoints []sdl.Point
-	for _, index := range indices {
-		sdlPoints = append(sdlPoints, points[index])
-	}
-
-	// Find the bounds of the polygon
-	minY, maxY := sdlPoints[0].Y, sdlPoints[0].Y
-	for _, p := range sdlPoints {
-		if p.Y < minY {
-			minY = p.Y
-		}
-		if p.Y > maxY {
-			maxY = p.Y
+func identityMatrix() Matrix3 {
+	return Matrix3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+func multiplyMatrix(a, b Matrix3) Matrix3 {
+	var m Matrix3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[i][j] = a[i][0]*b[0][j] + a[i][1]*b[1][j] + a[i][2]*b[2][j]
 		}
 	}
-
-	// Scanline algorithm to fill the polygon
-	for y := minY; y <= maxY; y++ {
-		var intersections []int32
-		for i := 0; i < len(sdlPoints); i++ {
-			j := (i + 1) % len(sdlPoints)
-			if (sdlPoints[i].Y <= y && sdlPoints[j].Y > y) || (sdlPoints[j].Y <= y && sdlPoints[i].Y > y) {
-				x := sdlPoints[i].X + (y-sdlPoints[i].Y)*(sdlPoints[j].X-sdlPoints[i].X)/(sdlPoints[j].Y-sdlPoints[i].Y)
-				intersections = append(intersections, x)
-			}
-		}
-		if len(intersections) > 1 {
-			for i := 0; i < len(intersections)-1; i += 2 {
-				if intersections[i] > intersections[i+1] {
-					intersections[i], intersections[i+1] = intersections[i+1], intersections[i]
-				}
-				err := renderer.DrawLine(intersections[i], y, intersections[i+1], y)
-				if err != nil {
-					return
-				}
-			}
-		}
+	return m
+}
+func axisAngleMatrix(axis Point3D, angle float64) Matrix3 {
+	length := math.Sqrt(axis.x*axis.x + axis.y*axis.y + axis.z*axis.z)
+	if length == 0 {
+		return identityMatrix()
+	}
+	x, y, z := axis.x/length, axis.y/length, axis.z/length
+	c, s := math.Cos(angle), math.Sin(angle)
+	t := 1 - c
+	return Matrix3{
+		{t*x*x + c, t*x*y - s*z, t*x*z + s*y},
+		{t*x*y + s*z, t*y*y + c, t*y*z - s*x},
+		{t*x*z - s*y, t*y*z + s*x, t*z*z + c},
 	}
 }
-func drawCube(angle float64) {
-	projectedPoints := make([]sdl.Point, len(cubeVertices))
+func transformPoint(m Matrix3, point Point3D) Point3D {
+	return Point3D{
+		m[0][0]*point.x + m[0][1]*point.y + m[0][2]*point.z,
+		m[1][0]*point.x + m[1][1]*point.y + m[1][2]*point.z,
+		m[2][0]*point.x + m[2][1]*point.y + m[2][2]*point.z,
+	}
+}
+func projectCube(angle float64) []sdl.FPoint {
+	projectedPoints := make([]sdl.FPoint, len(cubeVertices))
 
 	for i, vertex := range cubeVertices {
-		rotated := rotatePoint(vertex, angle)
+		rotated := transformPoint(objectOrientation, rotatePoint(vertex, angle))
 		projected := projectPoint(rotated)
-		projectedPoints[i] = sdl.Point{
-			X: int32(projected.x + float64(windowWidth)/2),
-			Y: int32(projected.y + float64(windowHeight)/2),
-		}
+		projectedPoints[i] = sdl.FPoint{X: float32(projected.x), Y: float32(projected.y)}
 	}
+	return projectedPoints
+}
+func drawCube(angle float64) {
+	projectedPoints := projectCube(angle)
 
+	// Blend so that faces with partial alpha are translucent
+	var previous sdl.BlendMode
+	err := renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return
+	}
 	for i, face := range cubeFaces {
 		if faceColors[i][3] > 0 { // Only draw non-transparent faces
 			err := renderer.SetDrawColor(faceColors[i][0], faceColors[i][1], faceColors[i][2], faceColors[i][3])
@@ -525,7 +565,18 @@ func drawCube(angle float64) {
 			fillPolygon(renderer, projectedPoints, face)
 		}
 	}
+	flushBatch()
+	err = renderer.SetDrawBlendMode(previous)
+	if err != nil {
+		return
+	}
 
+	drawCubeEdges(projectedPoints)
+}
+func drawWireframeCube(angle float64) {
+	drawCubeEdges(projectCube(angle))
+}
+func drawCubeEdges(projectedPoints []sdl.FPoint) {
 	err := renderer.SetDrawColor(255, 255, 255, 255)
 	if err != nil {
 		return
@@ -533,15 +584,27 @@ func drawCube(angle float64) {
 	for _, edge := range cubeEdges {
 		start := projectedPoints[edge.start]
 		end := projectedPoints[edge.end]
-		err := renderer.DrawLine(start.X, start.Y, end.X, end.Y)
+		err := renderer.DrawLineF(start.X, start.Y, end.X, end.Y)
 		if err != nil {
 			return
 		}
 	}
 }
+func drawObject(angle float64) {
+	objectEffects[objectEffect](angle)
+}
+func cycleObjectEffect(step int) {
+	objectEffect = (objectEffect + step + len(objectEffects)) % len(objectEffects)
+}
+func updateDeltaTime() {
+	now := time.Now()
+	// Clamp so a stall doesn't make everything jump
+	deltaTime = math.Min(now.Sub(lastFrame).Seconds(), 0.1)
+	lastFrame = now
+}
 func rotateCube() {
 	// Rotate the cube
-	rotationAngle += 0.01
+	rotationAngle += 0.01 * (1 + syncSpin)
 }
 func updateZoomLevel() {
 	// Smoothly adjust the zoom factor
@@ -563,135 +626,6 @@ func updateZoomLevel() {
 		}
 	}
 }
-func initStars() {
-	// Initialize stars
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for i := 0; i < numStars; i++ {
-		stars = append(stars, Star{
-			x:     rng.Float64()*2 - 1,
-			y:     rng.Float64()*2 - 1,
-			z:     rng.Float64()*2 - 1,
-			speed: rng.Float64()*0.05 + 0.01,
-			trail: make([]Point3D, 0, maxTrailLen),
-		})
-	}
-}
-
-func drawStarfield() {
-	for i := range stars {
-		stars[i].z -= stars[i].speed
-		if stars[i].z <= 0 {
-			stars[i] = Star{
-				x:     rand.Float64()*2 - 1,
-				y:     rand.Float64()*2 - 1,
-				z:     1,
-				speed: rand.Float64()*0.05 + 0.01,
-				trail: make([]Point3D, 0, maxTrailLen),
-			}
-		}
-
-		factor := 3.0 / stars[i].z
-		x := stars[i].x * factor * float64(windowWidth) / 2
-		y := stars[i].y * factor * float64(windowHeight) / 2
-
-		if len(stars[i].trail) >= maxTrailLen {
-			stars[i].trail = stars[i].trail[1:]
-		}
-		stars[i].trail = append(stars[i].trail, Point3D{x, y, stars[i].z})
-
-		for j := len(stars[i].trail) - 1; j > 0; j-- {
-			alpha := uint8(255 * float64(j) / float64(len(stars[i].trail)))
-			err := renderer.SetDrawColor(alpha, alpha, alpha, alpha)
-			if err != nil {
-				return
-			}
-			err = renderer.DrawLine(
-				int32(stars[i].trail[j-1].x)+windowWidth/2, int32(stars[i].trail[j-1].y)+windowHeight/2,
-				int32(stars[i].trail[j].x)+windowWidth/2, int32(stars[i].trail[j].y)+windowHeight/2,
-			)
-			if err != nil {
-				return
-			}
-		}
-
-		err := renderer.SetDrawColor(255, 255, 255, 255)
-		if err != nil {
-			return
-		}
-		err = renderer.DrawPoint(int32(x)+windowWidth/2, int32(y)+windowHeight/2)
-		if err != nil {
-			return
-		}
-	}
-}
-
-func createBarTextures() {
-	for i := 0; i < numBars; i++ {
-		texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_RGBA8888, sdl.TEXTUREACCESS_TARGET, windowWidth, barHeight)
-		if err != nil {
-			log.Fatalf("Failed to create texture: %s", err)
-		}
-
-		err = renderer.SetRenderTarget(texture)
-		if err != nil {
-			return
-		}
-		for y := 0; y < barHeight; y++ {
-			ratio := math.Abs(float64(y-barHeight/2) / float64(barHeight/2))
-			var r, g, b uint8
-			switch i % 3 {
-			case 0:
-				r = uint8(255 * (1 - ratio))
-				g = 0
-				b = 0
-			case 1:
-				r = 0
-				g = uint8(255 * (1 - ratio))
-				b = 0
-			case 2:
-				r = 0
-				g = 0
-				b = uint8(255 * (1 - ratio))
-			}
-
-			err := renderer.SetDrawColor(r, g, b, 255)
-			if err != nil {
-				return
-			}
-			err = renderer.DrawLine(0, int32(y), windowWidth, int32(y))
-			if err != nil {
-				return
-			}
-		}
-		err = renderer.SetRenderTarget(nil)
-		if err != nil {
-			return
-		}
-		barTextures = append(barTextures, texture)
-	}
-
-	for i := 0; i < numBars; i++ {
-		barOffsets[i] = i * (int(windowHeight) / numBars)
-	}
-}
-func drawCopperBars(elapsedTime float64) {
-	for i := 0; i < numBars; i++ {
-		// Calculate the new y position based on the sine function
-		amplitude := float64(barHeight)
-		frequency := 2.0
-		baseY := (windowHeight / 2) + int32(i*barHeight/2)
-		offsetY := amplitude * math.Sin(frequency*elapsedTime+float64(i)*0.4)
-
-		dstRect := sdl.Rect{X: 0, Y: baseY + int32(offsetY), W: windowWidth, H: barHeight}
-
-		// Render the bar
-		err := renderer.Copy(barTextures[i], nil, &dstRect)
-		if err != nil {
-			return
-		}
-	}
-}
-
 func setupFont() error {
 	fontTexture, err = loadTextureFromBytes(fontPng, renderer)
 	if err != nil {
@@ -701,6 +635,8 @@ func setupFont() error {
 }
 
 func drawScrollText(text string, posX float64) {
+	// A copper list that sets COLOR01 colours the scroller line by line
+	_, copperTint := copperPalette(1, 0)
 	textLength := len(text)
 	totalTextWidth := textLength * displayWidth
 
@@ -718,6 +654,12 @@ func drawScrollText(text string, posX float64) {
 
 			srcRect := sdl.Rect{X: int32(charPos[0] * fontWidth), Y: int32(charPos[1] * fontHeight), W: fontWidth, H: fontHeight}
 			offsetY := int32(20 * math.Sin(float64(x)/100))
+			mirroredOffsetY := int32(-20 * math.Sin(float64(x)/100))
+			if copperTint {
+				drawCopperChar(srcRect, x, windowHeight/2+offsetY, false)
+				drawCopperChar(srcRect, x, windowHeight/2+displayHeight+mirroredOffsetY, true)
+				continue
+			}
 
 			dstRect := sdl.Rect{X: x, Y: windowHeight/2 + offsetY, W: displayWidth, H: displayHeight}
 			err := renderer.Copy(fontTexture, &srcRect, &dstRect)
@@ -725,7 +667,6 @@ func drawScrollText(text string, posX float64) {
 				return
 			}
 
-			mirroredOffsetY := int32(-20 * math.Sin(float64(x)/100))
 			mirroredDstRect := sdl.Rect{X: x, Y: windowHeight/2 + displayHeight + mirroredOffsetY, W: displayWidth, H: displayHeight}
 			err = renderer.CopyEx(fontTexture, &srcRect, &mirroredDstRect, 0, nil, sdl.FLIP_VERTICAL)
 			if err != nil {
@@ -733,6 +674,9 @@ func drawScrollText(text string, posX float64) {
 			}
 		}
 	}
+	if copperTint {
+		flushBatch()
+	}
 }
 
 func updateScrollTextPosition() {
@@ -742,6 +686,19 @@ func updateScrollTextPosition() {
 	}
 }
 
+// Small text in the scroller font, unknown characters are left as gaps
+func drawText(text string, x, y, size float32) {
+	white := sdl.Color{R: 255, G: 255, B: 255, A: 255}
+	for i, c := range []rune(strings.ToUpper(text)) {
+		charPos, ok := charMap[c]
+		if !ok {
+			continue
+		}
+		u, v := float32(charPos[0]*fontWidth)/sheetWidth, float32(charPos[1]*fontHeight)/sheetHeight
+		batchTextureRect(fontTexture, x+float32(i)*size, y, size, size, u, v, u+float32(fontWidth)/sheetWidth, v+float32(fontHeight)/sheetHeight, white, white)
+	}
+}
+
 func handleEvents() {
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 		switch e := event.(type) {
@@ -750,15 +707,90 @@ func handleEvents() {
 			//running = false
 		case *sdl.KeyboardEvent:
 			if e.State == sdl.PRESSED {
+				if e.Repeat == 0 {
+					playSound("blip", 0.4)
+				}
 				switch e.Keysym.Sym {
 				case sdl.K_UP:
 					targetZoom = math.Min(targetZoom+0.1, 0.6)
 				case sdl.K_DOWN:
 					targetZoom = math.Max(targetZoom-0.1, 0.1)
+				case sdl.K_SPACE:
+					cycleObjectEffect(1)
+				case sdl.K_s:
+					cycleStarfieldMode()
+				case sdl.K_j:
+					hyperspaceJump()
+				case sdl.K_c:
+					cycleStarColorMode()
+				case sdl.K_t:
+					starTwinkle = !starTwinkle
+				case sdl.K_v:
+					cycleCameraPath()
+				case sdl.K_b:
+					copperEnabled = !copperEnabled
+				case sdl.K_i:
+					cycleBarPriority()
+				case sdl.K_k:
+					kefrensEnabled = !kefrensEnabled
+				case sdl.K_w:
+					twisterEnabled = !twisterEnabled
+				case sdl.K_l:
+					cycleLogoMotion()
+				case sdl.K_e:
+					toggleLogo()
+				case sdl.K_d:
+					logoWobble()
+				case sdl.K_g:
+					logoStretch()
+				case sdl.K_m:
+					logoMelt()
+				case sdl.K_h:
+					logoShine()
+				case sdl.K_a:
+					analyserEnabled = !analyserEnabled
+				case sdl.K_p:
+					scopesEnabled = !scopesEnabled
+				case sdl.K_RIGHTBRACKET:
+					nextTune()
+				case sdl.K_LEFTBRACKET:
+					previousTune()
+				case sdl.K_PERIOD:
+					changeSubtune(1)
+				case sdl.K_COMMA:
+					changeSubtune(-1)
+				case sdl.K_x:
+					nextStereoSeparation()
+				case sdl.K_o:
+					nextAmigaModel()
+				case sdl.K_f:
+					toggleLEDFilter()
+				case sdl.K_r:
+					togglePaulaResampling()
 				case sdl.K_q, sdl.K_ESCAPE:
 					introQuit()
 				}
 			}
+		case *sdl.MouseButtonEvent:
+			if e.Button == sdl.BUTTON_LEFT {
+				dragging = e.State == sdl.PRESSED
+			}
+		case *sdl.MouseMotionEvent:
+			if dragging {
+				trackballRotate(float64(e.XRel), float64(e.YRel))
+			}
+		case *sdl.MouseWheelEvent:
+			wheel := float64(e.Y)
+			if e.Direction == sdl.MOUSEWHEEL_FLIPPED {
+				wheel = -wheel
+			}
+			targetZoom = math.Max(math.Min(targetZoom+wheel*0.05, 0.6), 0.1)
+		case *sdl.ControllerDeviceEvent:
+			handleControllerDevice(e)
+		case *sdl.ControllerAxisEvent:
+			handleControllerAxis(e)
+		case *sdl.ControllerButtonEvent:
+			handleControllerButton(e)
 		}
 	}
 }
@@ -783,6 +815,80 @@ func parseCommandLineArgs() {
 			}
 		} else if arg == "-debug" {
 			debug = true
+		} else if arg == "-starcolors" && i+1 < len(os.Args) {
+			if err := parseStarColors(os.Args[i+1]); err != nil {
+				fmt.Fprintf(os.Stderr, "Ignoring -starcolors: %s\n", err)
+			}
+			i++
+		} else if arg == "-trail" && i+1 < len(os.Args) {
+			if t, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil && t >= 0 && !math.IsInf(t, 0) {
+				trailTime = t
+			} else {
+				fmt.Fprintf(os.Stderr, "Ignoring -trail: bad length %q\n", os.Args[i+1])
+			}
+			i++
+		} else if arg == "-trailcurve" && i+1 < len(os.Args) {
+			if c, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil && c > 0 {
+				trailCurve = c
+			} else {
+				fmt.Fprintf(os.Stderr, "Ignoring -trailcurve: bad exponent %q\n", os.Args[i+1])
+			}
+			i++
+		} else if arg == "-camera" && i+1 < len(os.Args) {
+			if !setCameraPath(os.Args[i+1]) {
+				fmt.Fprintf(os.Stderr, "Ignoring unknown camera path %q\n", os.Args[i+1])
+			}
+			i++
+		} else if arg == "-copper" && i+1 < len(os.Args) {
+			copperFile = os.Args[i+1]
+			i++
+		} else if arg == "-bars" && i+1 < len(os.Args) {
+			barsFile = os.Args[i+1]
+			i++
+		} else if arg == "-logo" && i+1 < len(os.Args) {
+			if !setLogoMotion(os.Args[i+1]) {
+				fmt.Fprintf(os.Stderr, "Ignoring unknown logo motion %q\n", os.Args[i+1])
+			}
+			i++
+		} else if arg == "-logoenter" && i+1 < len(os.Args) {
+			if !setLogoSettle(os.Args[i+1]) {
+				fmt.Fprintf(os.Stderr, "Ignoring unknown logo entry %q\n", os.Args[i+1])
+			}
+			i++
+		} else if arg == "-logofont" && i+1 < len(os.Args) {
+			logoFontFile = os.Args[i+1]
+			i++
+		} else if arg == "-logotext" && i+1 < len(os.Args) {
+			logoText = os.Args[i+1]
+			i++
+		} else if arg == "-sync" && i+1 < len(os.Args) {
+			syncFile = os.Args[i+1]
+			i++
+		} else if arg == "-playlist" && i+1 < len(os.Args) {
+			playlistFile = os.Args[i+1]
+			i++
+		} else if arg == "-shuffle" {
+			playlistShuffle = true
+		} else if arg == "-separation" && i+1 < len(os.Args) {
+			if p, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil && p >= 0 && p <= 100 {
+				stereoSeparation = p / 100
+			}
+			i++
+		} else if arg == "-amiga" && i+1 < len(os.Args) {
+			if err := setAmigaModel(os.Args[i+1]); err != nil {
+				fmt.Fprintf(os.Stderr, "Ignoring -amiga: %s\n", err)
+			}
+			i++
+		} else if arg == "-ledfilter" {
+			ledFilter = true
+		} else if arg == "-paula" {
+			paulaResampling = true
+		} else if arg == "export-audio" && i+1 < len(os.Args) {
+			exportAudioFile = os.Args[i+1]
+			i++
+		} else if arg == "-obj" && i+1 < len(os.Args) {
+			objFile = os.Args[i+1]
+			i++
 		}
 	}
 }
@@ -797,10 +903,8 @@ func initSDL() error {
 	if err := sdl.Init(sdl.INIT_AUDIO); err != nil {
 		return err
 	}
-	if err := mix.OpenAudio(44100, mix.DEFAULT_FORMAT, 2, 4096); err != nil {
-		return err
-	}
-	if err := mix.Init(mix.INIT_MOD); err != nil {
+	// A small buffer keeps the music state close to what is being heard
+	if err := mix.OpenAudio(44100, mix.DEFAULT_FORMAT, 2, 1024); err != nil {
 		return err
 	}
 	return nil
@@ -830,30 +934,8 @@ func setupDisplay() {
 	}
 }
 
-func loadModFromBytes(data []byte) (*mix.Music, error) {
-	rwops, err := sdl.RWFromMem(data)
-	if err != nil {
-		return nil, fmt.Errorf("could not create RWops from bytes: %v", err)
-	}
-
-	music, err := mix.LoadMUSRW(rwops, 0)
-	if err != nil {
-		return nil, fmt.Errorf("could not load MOD from RWops: %v", err)
-	}
-
-	return music, nil
-}
 func playMusic() {
-	music, err := loadModFromBytes(comicbakeryMod)
-	if err != nil {
-		_, err := fmt.Fprintf(os.Stderr, "Failed to load music: %s\n", err)
-		if err != nil {
-			return
-		}
-		os.Exit(1)
-	}
-
-	if err := music.Play(-1); err != nil {
+	if err := startPlaylist(); err != nil {
 		_, err := fmt.Fprintf(os.Stderr, "Failed to play music: %s\n", err)
 		if err != nil {
 			return
@@ -885,9 +967,26 @@ func loadTextureFromBytes(data []byte, renderer *sdl.Renderer) (*sdl.Texture, er
 
 	return texture, nil
 }
+func createTextureFromPixels(pixels []uint32, width, height int32) (*sdl.Texture, error) {
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STATIC, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("could not create texture: %v", err)
+	}
+	if err := texture.UpdateRGBA(nil, pixels, int(width)); err != nil {
+		return nil, fmt.Errorf("could not update texture: %v", err)
+	}
+	if err := texture.SetBlendMode(sdl.BLENDMODE_BLEND); err != nil {
+		return nil, fmt.Errorf("could not set blend mode: %v", err)
+	}
+	return texture, nil
+}
 func setupBouncingLogo() error {
 	var err error
-	texture, err = loadTextureFromBytes(intuitiontextlogoPng, renderer)
+	if logoFontFile != "" {
+		texture, err = generateLogoTexture(logoText, logoFontFile)
+	} else {
+		texture, err = loadTextureFromBytes(intuitiontextlogoPng, renderer)
+	}
 	if err != nil {
 		return err
 	}
@@ -898,39 +997,12 @@ func setupBouncingLogo() error {
 		return err
 	}
 
-	// Initial position and target position
-	posY = -int(imageHeight)
-	targetY = (int(windowHeight) - int(imageHeight)) / 7
+	// Home position, the logo enters from above the screen
+	logoHomeY = float64(windowHeight-imageHeight) / 7
+	logoEnter()
 
 	return nil
 }
-func updateBouncingLogoPosition() {
-	// Calculate the elapsed time
-	elapsed := time.Since(startTime).Seconds()
-
-	// Animate the position of the image
-	if posY < targetY {
-		posY += int(float64(imageHeight) * elapsed * 0.05) // Adjust logo sliding speed
-		if posY > targetY {
-			posY = targetY
-		}
-	} else {
-		posY = targetY + int(4*math.Sin(elapsed*20)) // Adjust bounce here
-	}
-}
-func drawBouncingLogo() {
-	// Draw the image
-	dstRect := sdl.Rect{
-		X: (windowWidth - imageWidth) / 2,
-		Y: int32(posY),
-		W: imageWidth,
-		H: imageHeight,
-	}
-	err := renderer.Copy(texture, nil, &dstRect)
-	if err != nil {
-		return
-	}
-}
 
 func introQuit() {
 	// Enable blending mode
@@ -940,13 +1012,15 @@ func introQuit() {
 	}
 
 	// Fade out the music and quit
+	playSound("whoosh", 1)
 	for i := 0; i <= 255; i++ {
 		// Reduce the volume of the music
-		mix.VolumeMusic(255 - i)
+		setMusicVolume(float64(255-i) / 255)
 
 		// Update animations
 		rotateCube()
 		updateScrollTextPosition()
+		updateStarfield()
 
 		// Draw the current screen content
 		err := renderer.SetDrawColor(0, 0, 0, 255)
@@ -960,7 +1034,8 @@ func introQuit() {
 
 		// Draw the existing scene
 		drawStarfield()
-		drawCube(rotationAngle)
+		drawObject(rotationAngle)
+		drawStarfieldFront()
 		drawScrollText(scrollText, scrollPosX)
 
 		// Draw a full screen semi-transparent rectangle
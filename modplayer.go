@@ -0,0 +1,1394 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+const (
+	paulaClock   = 3546895 // PAL colour clock, the sample rate of a channel is this over the period
+	modRows      = 64
+	minPeriod    = 113
+	maxPeriod    = 856
+	modMaxVolume = 64
+	scopeFrames  = 512 // Output frames kept per channel for the scopes
+)
+
+// Module formats, they all play through the same replayer
+const (
+	formatMOD = iota
+	formatS3M
+	formatXM
+	formatIT
+)
+
+// Notes are numbered from 1 for C-0, these two are special
+const (
+	noteKeyOff = 254
+	noteCut    = 255
+)
+
+// Effects 0 to 15 are ProTracker's, the others come from later trackers
+const (
+	fxArpeggio = iota
+	fxPortaUp
+	fxPortaDown
+	fxTonePorta
+	fxVibrato
+	fxTonePortaVolSlide
+	fxVibratoVolSlide
+	fxTremolo
+	fxPan
+	fxOffset
+	fxVolSlide
+	fxJump
+	fxVolume
+	fxBreak
+	fxExtended
+	fxSpeedTempo
+	fxSpeed
+	fxTempo
+	fxGlobalVolume
+	fxGlobalVolSlide
+	fxPanSlide
+	fxRetrig
+	fxTremor
+	fxFineVibrato
+	fxExtraFinePorta
+	fxKeyOff
+	fxCount
+)
+
+// Volume column commands of S3M, XM and IT patterns
+const (
+	volNone = iota
+	volSet
+	volSlideUp
+	volSlideDown
+	volFineUp
+	volFineDown
+	volPan
+	volTonePorta
+	volVibratoSpeed
+	volVibrato
+	volPanSlideLeft
+	volPanSlideRight
+	volPortaDown
+	volPortaUp
+)
+
+// ProTracker periods for finetune 0, C-1 to B-3
+var modPeriods = []int{
+	856, 808, 762, 720, 678, 640, 604, 570, 538, 508, 480, 453,
+	428, 404, 381, 360, 339, 320, 302, 285, 269, 254, 240, 226,
+	214, 202, 190, 180, 170, 160, 151, 143, 135, 127, 120, 113,
+}
+
+var (
+	// Periods for every finetune from -8 to 7, indexed by finetune & 15
+	finetunePeriods = buildFinetunePeriods()
+	modNoteNames    = []string{"C-", "C#", "D-", "D#", "E-", "F-", "F#", "G-", "G#", "A-", "A#", "B-"}
+
+	// The vibrato and tremolo sine table, half a wave
+	modSine = []int{
+		0, 24, 49, 74, 97, 120, 141, 161, 180, 197, 212, 224, 235, 244, 250, 253,
+		255, 253, 250, 244, 235, 224, 212, 197, 180, 161, 141, 120, 97, 74, 49, 24,
+	}
+	modFunkTable = []int{0, 5, 6, 7, 8, 10, 11, 13, 16, 19, 22, 26, 32, 43, 64, 128}
+
+	// Volume changes of the retrigger command
+	retrigVolume = []func(volume int) int{
+		func(v int) int { return v }, func(v int) int { return v - 1 }, func(v int) int { return v - 2 },
+		func(v int) int { return v - 4 }, func(v int) int { return v - 8 }, func(v int) int { return v - 16 },
+		func(v int) int { return v * 2 / 3 }, func(v int) int { return v / 2 }, func(v int) int { return v },
+		func(v int) int { return v + 1 }, func(v int) int { return v + 2 }, func(v int) int { return v + 4 },
+		func(v int) int { return v + 8 }, func(v int) int { return v + 16 }, func(v int) int { return v * 3 / 2 },
+		func(v int) int { return v * 2 },
+	}
+
+	// Later trackers reuse the last parameter when an effect is given as zero
+	rememberedEffects = map[int]bool{
+		fxPortaUp: true, fxPortaDown: true, fxVolSlide: true, fxTonePortaVolSlide: true, fxVibratoVolSlide: true,
+		fxRetrig: true, fxTremor: true, fxGlobalVolSlide: true, fxPanSlide: true, fxExtraFinePorta: true,
+	}
+)
+
+type modSample struct {
+	name       string
+	data       []int16 // 8-bit samples are scaled up to 16 bits
+	finetune   int     // ProTracker finetune from -8 to 7
+	c5speed    float64 // Playback rate of middle C, 8363 for ProTracker samples
+	volume     int
+	gain       float64 // Sample global volume from 0 to 1
+	pan        float64 // 0 left to 1 right, or -1 to leave the channel alone
+	loopStart  int
+	loopLength int
+	pingPong   bool
+}
+
+type modEnvelope struct {
+	points             [][2]int // Tick and volume from 0 to 64
+	sustain            int      // Point held while the key is down, or -1
+	loopStart, loopEnd int      // Points, or -1 for no loop
+}
+
+// XM and IT instruments pick a sample for every note
+type modInstrument struct {
+	name     string
+	samples  [120]int // 1 based, 0 for none
+	envelope *modEnvelope
+	fadeout  float64 // Volume lost per tick after the key is released
+}
+
+type modNote struct {
+	note, instrument    int
+	volume, volumeParam int // Volume column command and value
+	effect, param       int
+}
+
+type modSong struct {
+	title        string
+	format       int
+	samples      []modSample
+	instruments  []modInstrument // Empty when patterns play samples directly
+	orders       []int
+	restart      int
+	channels     int
+	patterns     [][]modNote // Rows times channels
+	speed, tempo int
+	globalVolume int       // 0 to 64
+	pans         []float64 // Initial panning of every channel
+	linear       bool      // Slides move in fractions of a semitone instead of periods
+	linkedPorta  bool      // IT without compatible Gxx, where E, F and G share their memory
+	gain         float64
+}
+
+// What a channel is doing, as seen by the rest of the intro
+type modChannelState struct {
+	note          string // e.g. "C-2", empty when no note has played
+	period        int
+	instrument    int // 1 based, 0 for none
+	volume        int // 0 to 64, after tremolo
+	effect, param int
+	notes         int // Counts the notes started, so a new one can be spotted
+}
+
+type modState struct {
+	order, pattern, row int
+	speed, tempo        int
+	channels            []modChannelState
+}
+
+type modChannel struct {
+	sample                     *modSample
+	instrument                 int
+	name                       string  // Of the instrument, for the scopes
+	position                   float64 // In sample frames
+	backwards                  bool    // Heading back through a ping-pong loop
+	period, outPeriod          float64
+	note                       int // 1 is C-0, 0 if unknown
+	triggered                  bool
+	volume, outVolume          int
+	mixVolume                  float64 // After envelope, fadeout and global volume
+	finetune                   int
+	pan                        float64 // 0 left to 1 right
+	effect, param              int
+	volumeCommand, volumeParam int
+	memory                     [fxCount]int
+	portaTarget                float64
+	portaSpeed                 int
+	glissando                  bool
+	vibratoPos                 int
+	vibratoSpeed               int
+	vibratoDepth               int
+	vibratoWave                int
+	tremoloPos                 int
+	tremoloSpeed               int
+	tremoloDepth               int
+	tremoloWave                int
+	tremorCount                int
+	offset                     int
+	loopRow, loopCount         int
+	delayedNote                modNote
+	funkSpeed                  int
+	funkDelay                  int
+	funkOffset                 int
+	envelope                   *modEnvelope
+	envelopeTick               int
+	keyOn                      bool
+	fadeout                    float64
+	fade                       float64 // 1 until the key is released
+	notes                      int
+}
+
+type modPlayer struct {
+	song         *modSong
+	sampleRate   int
+	speed        int
+	tempo        int
+	tick         int
+	order, row   int
+	globalVolume int
+
+	// Set by B, D and E6 commands, acted on at the end of the row
+	jumpOrder, breakRow int
+	jump, patternBreak  bool
+	patternDelay        int
+	delayCount          int
+	looped              bool // The song has come back round to an earlier position
+
+	tickFrames int // Output frames left in this tick
+	channels   []modChannel
+	waves      [][scopeFrames]float64
+	scopeIndex int
+}
+
+// Anything the playlist can play, modules or SID tunes
+type tunePlayer interface {
+	render(out [][2]float64, gain float64)
+	state() modState
+	scopes() ([][]float64, []string)
+	ended() bool
+}
+
+var (
+	// Guards the players, which run on SDL's audio thread
+	musicMutex  sync.Mutex
+	musicPlayer tunePlayer
+)
+
+func buildFinetunePeriods() [16][]int {
+	var periods [16][]int
+	for finetune := -8; finetune < 8; finetune++ {
+		for _, period := range modPeriods {
+			periods[finetune&15] = append(periods[finetune&15], int(math.Round(float64(period)*math.Pow(2, -float64(finetune)/96))))
+		}
+	}
+	return periods
+}
+
+func modNoteIndex(period int) int {
+	for i, p := range modPeriods {
+		if period >= p {
+			return i
+		}
+	}
+	return len(modPeriods) - 1
+}
+
+// Loads a MOD, S3M, XM or IT module, going by its signature
+func loadModule(data []byte) (*modSong, error) {
+	switch {
+	case len(data) >= 80 && string(data[:17]) == "Extended Module: ":
+		return loadXM(data)
+	case len(data) >= 96 && string(data[44:48]) == "SCRM":
+		return loadS3M(data)
+	case len(data) >= 192 && string(data[:4]) == "IMPM":
+		return loadIT(data)
+	}
+	return loadMod(data)
+}
+
+// Loads a ProTracker module, either the 31 sample kind with a signature at 1080 or the older 15 sample kind
+func loadMod(data []byte) (*modSong, error) {
+	song := &modSong{title: modString(data, 0, 20), format: formatMOD, channels: 4, speed: 6, tempo: 125, globalVolume: 64}
+	numSamples := 15
+	if len(data) >= 1084 {
+		signature := string(data[1080:1084])
+		switch {
+		case signature == "M.K." || signature == "M!K!" || signature == "FLT4" || signature == "4CHN":
+			numSamples = 31
+		case signature == "6CHN" || signature == "8CHN" || signature == "FLT8" || signature == "CD81" || signature == "OKTA":
+			numSamples, song.channels = 31, int(signature[0]-'0')
+			if signature[0] < '0' || signature[0] > '9' {
+				song.channels = 8
+			}
+		case strings.HasSuffix(signature, "CH") && signature[0] >= '1' && signature[0] <= '3':
+			numSamples, song.channels = 31, int(signature[0]-'0')*10+int(signature[1]-'0')
+		}
+	}
+	for i := 0; i < song.channels; i++ {
+		// Amiga channels go left, right, right, left
+		if i%4 == 0 || i%4 == 3 {
+			song.pans = append(song.pans, 0)
+		} else {
+			song.pans = append(song.pans, 1)
+		}
+	}
+	// Full volume on every channel of one side only just fits in 16 bits
+	song.gain = 8.0 / float64(song.channels)
+
+	headerSize := 20 + numSamples*30 + 130
+	if numSamples == 31 {
+		headerSize += 4
+	}
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("module is too short")
+	}
+	for i := 0; i < numSamples; i++ {
+		header := data[20+i*30:]
+		song.samples = append(song.samples, modSample{
+			name:       modString(header, 0, 22),
+			data:       make([]int16, int(binary.BigEndian.Uint16(header[22:]))*2),
+			finetune:   int(int8(header[24]<<4) >> 4),
+			c5speed:    8363,
+			volume:     int(math.Min(float64(header[25]), modMaxVolume)),
+			gain:       1,
+			pan:        -1,
+			loopStart:  int(binary.BigEndian.Uint16(header[26:])) * 2,
+			loopLength: int(binary.BigEndian.Uint16(header[28:])) * 2,
+		})
+	}
+
+	orderOffset := 20 + numSamples*30
+	length := int(data[orderOffset])
+	if length == 0 || length > 128 {
+		return nil, fmt.Errorf("bad song length %d", length)
+	}
+	song.restart = int(data[orderOffset+1])
+	if song.restart >= length {
+		song.restart = 0
+	}
+	numPatterns := 0
+	for i := 0; i < 128; i++ {
+		order := int(data[orderOffset+2+i])
+		if i < length {
+			song.orders = append(song.orders, order)
+		}
+		numPatterns = int(math.Max(float64(numPatterns), float64(order+1)))
+	}
+
+	offset := headerSize
+	patternSize := modRows * song.channels * 4
+	for p := 0; p < numPatterns; p++ {
+		if offset+patternSize > len(data) {
+			return nil, fmt.Errorf("pattern %d is cut short", p)
+		}
+		notes := make([]modNote, modRows*song.channels)
+		for i := range notes {
+			b := data[offset+i*4:]
+			notes[i] = modNote{
+				instrument: int(b[0]&0xf0) | int(b[2]>>4),
+				effect:     int(b[2] & 0x0f),
+				param:      int(b[3]),
+			}
+			// ProTracker's C-1 is C-3 counting from C-0
+			if period := int(b[0]&0x0f)<<8 | int(b[1]); period != 0 {
+				notes[i].note = modNoteIndex(period) + 37
+			}
+		}
+		song.patterns = append(song.patterns, notes)
+		offset += patternSize
+	}
+
+	for i := range song.samples {
+		sample := &song.samples[i]
+		// Some modules are cut short, keep what is there
+		end := int(math.Min(float64(offset+len(sample.data)), float64(len(data))))
+		if end > offset {
+			for j, b := range data[offset:end] {
+				sample.data[j] = int16(int8(b)) * 256
+			}
+		}
+		sample.data = sample.data[:int(math.Max(0, float64(end-offset)))]
+		offset += len(sample.data)
+
+		if sample.loopStart+sample.loopLength > len(sample.data) {
+			sample.loopLength = len(sample.data) - sample.loopStart
+		}
+		if sample.loopLength <= 2 || sample.loopStart >= len(sample.data) {
+			sample.loopStart, sample.loopLength = 0, 0
+		}
+	}
+	return song, nil
+}
+
+// A song with the defaults shared by the S3M, XM and IT loaders
+func newTrackerSong(format int, title string) *modSong {
+	return &modSong{title: title, format: format, speed: 6, tempo: 125, globalVolume: 64}
+}
+
+// Fills in what the loaders leave out and drops orders of missing patterns
+func finishTrackerSong(song *modSong) error {
+	if song.channels == 0 {
+		return fmt.Errorf("no channels")
+	}
+	var orders []int
+	for _, order := range song.orders {
+		if order < len(song.patterns) {
+			orders = append(orders, order)
+		}
+	}
+	if len(orders) == 0 {
+		return fmt.Errorf("no patterns to play")
+	}
+	song.orders = orders
+	if song.restart >= len(orders) {
+		song.restart = 0
+	}
+	for len(song.pans) < song.channels {
+		song.pans = append(song.pans, 0.5)
+	}
+	if song.speed == 0 {
+		song.speed = 6
+	}
+	if song.tempo < 32 {
+		song.tempo = 125
+	}
+	// Channels add up, so keep a busy song from clipping without making a quiet one inaudible
+	song.gain = 4 / math.Sqrt(float64(song.channels))
+	return nil
+}
+
+// Loops are given in sample frames, anything outside the sample is trimmed
+func setSampleLoop(sample *modSample, start, end int, pingPong bool) {
+	end = int(math.Min(float64(end), float64(len(sample.data))))
+	if start < 0 || end-start <= 2 {
+		return
+	}
+	sample.loopStart, sample.loopLength, sample.pingPong = start, end-start, pingPong
+}
+
+// Raw PCM sample data as 16-bit values
+func decodeSampleData(data []byte, offset, length int, bits16, signed bool) []int16 {
+	if bits16 {
+		raw := modBytes(data, offset, length*2)
+		samples := make([]int16, len(raw)/2)
+		for i := range samples {
+			value := binary.LittleEndian.Uint16(raw[i*2:])
+			if !signed {
+				value ^= 0x8000
+			}
+			samples[i] = int16(value)
+		}
+		return samples
+	}
+	raw := modBytes(data, offset, length)
+	samples := make([]int16, len(raw))
+	for i, b := range raw {
+		if !signed {
+			b ^= 0x80
+		}
+		samples[i] = int16(int8(b)) * 256
+	}
+	return samples
+}
+
+// As much as there is of data[offset:offset+length]
+func modBytes(data []byte, offset, length int) []byte {
+	if offset < 0 || offset >= len(data) || length <= 0 {
+		return nil
+	}
+	return data[offset:int(math.Min(float64(offset+length), float64(len(data))))]
+}
+
+func modByte(data []byte, offset int) int {
+	if offset < 0 || offset >= len(data) {
+		return 0
+	}
+	return int(data[offset])
+}
+
+func modUint16(data []byte, offset int) int {
+	return modByte(data, offset) | modByte(data, offset+1)<<8
+}
+
+func modUint32(data []byte, offset int) int {
+	return modUint16(data, offset) | modUint16(data, offset+2)<<16
+}
+
+func modString(data []byte, offset, length int) string {
+	s := string(modBytes(data, offset, length))
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+func newModPlayer(song *modSong, sampleRate int) *modPlayer {
+	player := &modPlayer{song: song, sampleRate: sampleRate}
+	player.channels = make([]modChannel, song.channels)
+	player.waves = make([][scopeFrames]float64, song.channels)
+	player.restart()
+	return player
+}
+
+func (player *modPlayer) restart() {
+	player.speed, player.tempo = player.song.speed, player.song.tempo
+	player.globalVolume = player.song.globalVolume
+	player.order, player.row, player.tick = 0, 0, 0
+	player.jump, player.patternBreak = false, false
+	player.patternDelay, player.delayCount = 0, 0
+	player.tickFrames = 0
+	for i := range player.channels {
+		player.channels[i] = modChannel{pan: player.song.pans[i], fade: 1}
+	}
+}
+
+func setMusicVolume(volume float64) {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	musicVolume = volume
+}
+
+// A copy of the playback state, safe to call from the main loop
+func musicState() modState {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	if musicPlayer == nil {
+		return modState{}
+	}
+	return musicPlayer.state()
+}
+
+// The latest output of every channel from -1 to 1, oldest first, and the name of its instrument
+func musicScopes() ([][]float64, []string) {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	if musicPlayer == nil {
+		return nil, nil
+	}
+	return musicPlayer.scopes()
+}
+
+func (player *modPlayer) state() modState {
+	state := modState{
+		order:   player.order,
+		pattern: player.song.orders[player.order],
+		row:     player.row,
+		speed:   player.speed,
+		tempo:   player.tempo,
+	}
+	for _, channel := range player.channels {
+		state.channels = append(state.channels, modChannelState{
+			note:       player.noteName(channel.note),
+			period:     int(math.Round(channel.outPeriod)),
+			instrument: channel.instrument,
+			volume:     channel.outVolume,
+			effect:     channel.effect,
+			param:      channel.param,
+			notes:      channel.notes,
+		})
+	}
+	return state
+}
+
+func (player *modPlayer) scopes() ([][]float64, []string) {
+	waves := make([][]float64, len(player.channels))
+	names := make([]string, len(player.channels))
+	for i, channel := range player.channels {
+		waves[i] = make([]float64, scopeFrames)
+		for j := range waves[i] {
+			waves[i][j] = player.waves[i][(player.scopeIndex+j)%scopeFrames]
+		}
+		names[i] = channel.name
+	}
+	return waves, names
+}
+
+func (player *modPlayer) ended() bool {
+	return player.looped
+}
+
+func (player *modPlayer) noteName(note int) string {
+	if note <= 0 || note > 120 {
+		return ""
+	}
+	octave := (note - 1) / 12
+	if player.song.format == formatMOD {
+		// ProTracker counts octaves from its lowest note
+		octave -= 2
+	}
+	return fmt.Sprintf("%s%d", modNoteNames[(note-1)%12], octave)
+}
+
+// A tracker style line for the debug output, e.g. "03 05 12 | G-2 02 40 A08 | ..."
+func (state modState) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%02d %02d %02d", state.order, state.pattern, state.row)
+	for _, channel := range state.channels {
+		note := channel.note
+		if note == "" {
+			note = "---"
+		}
+		fmt.Fprintf(&b, " | %s %02d %02d %X%02X", note, channel.instrument, channel.volume, channel.effect, channel.param)
+	}
+	return b.String()
+}
+
+// Adds the next frames of the song to out, scaled by gain
+func (player *modPlayer) render(out [][2]float64, gain float64) {
+	for done := 0; done < len(out); {
+		if player.tickFrames == 0 {
+			player.processTick()
+			// A tick lasts 2.5 / tempo seconds
+			player.tickFrames = player.sampleRate * 5 / (player.tempo * 2)
+		}
+		count := int(math.Min(float64(player.tickFrames), float64(len(out)-done)))
+		player.mix(out[done:done+count], gain)
+		player.tickFrames -= count
+		done += count
+	}
+}
+
+func (player *modPlayer) mix(out [][2]float64, gain float64) {
+	gain *= player.song.gain
+	for frame := range out {
+		var left, right float64
+		for i := range player.channels {
+			value := player.channels[i].nextSample(player.sampleRate)
+			player.waves[i][player.scopeIndex] = value / (128 * modMaxVolume)
+			left += value * (1 - player.channels[i].pan)
+			right += value * player.channels[i].pan
+		}
+		player.scopeIndex = (player.scopeIndex + 1) % scopeFrames
+		out[frame][0] += left * gain
+		out[frame][1] += right * gain
+	}
+}
+
+func clampSample(value float64) int16 {
+	return int16(math.Max(-32768, math.Min(32767, value)))
+}
+
+// The channel output for one frame, before gain
+func (channel *modChannel) nextSample(sampleRate int) float64 {
+	sample := channel.sample
+	if sample == nil || channel.outPeriod <= 0 || channel.position < 0 || int(channel.position) >= len(sample.data) {
+		return 0
+	}
+	step := paulaClock / channel.outPeriod / float64(sampleRate)
+	if !paulaResampling {
+		value := float64(sample.data[int(channel.position)]) / 256 * channel.mixVolume
+		channel.advance(step)
+		return value
+	}
+
+	// Paula holds each 8-bit sample until the next, so average what it held over the frame
+	var total float64
+	for left := step; left > 0 && channel.position >= 0 && int(channel.position) < len(sample.data); {
+		run := math.Floor(channel.position) + 1 - channel.position
+		if channel.backwards {
+			run = channel.position - math.Floor(channel.position)
+		}
+		if run <= 0 {
+			run = 1
+		}
+		run = math.Min(run, left)
+		total += float64(sample.data[int(channel.position)]>>8) * run
+		channel.advance(run)
+		left -= run
+	}
+	// With the volume in Paula's 64 steps
+	return total / step * math.Round(channel.mixVolume*modMaxVolume) / modMaxVolume
+}
+
+// Moves through the sample, going round its loop
+func (channel *modChannel) advance(distance float64) {
+	sample := channel.sample
+	if channel.backwards {
+		distance = -distance
+	}
+	channel.position += distance
+	if sample.loopLength == 0 {
+		return
+	}
+	loopStart, loopEnd := float64(sample.loopStart), float64(sample.loopStart+sample.loopLength)
+	switch {
+	case sample.pingPong && channel.position >= loopEnd:
+		channel.position = math.Max(loopStart, 2*loopEnd-channel.position-1)
+		channel.backwards = true
+	case sample.pingPong && channel.backwards && channel.position < loopStart:
+		channel.position = math.Min(loopEnd-1, 2*loopStart-channel.position)
+		channel.backwards = false
+	case channel.position >= loopEnd:
+		channel.position = loopStart + math.Mod(channel.position-loopStart, float64(sample.loopLength))
+	}
+}
+
+func (player *modPlayer) processTick() {
+	if player.tick == 0 && player.delayCount == 0 {
+		player.processRow()
+	} else {
+		for i := range player.channels {
+			player.tickEffects(&player.channels[i])
+		}
+	}
+	for i := range player.channels {
+		player.updateMixVolume(&player.channels[i])
+	}
+
+	player.tick++
+	if player.tick < player.speed {
+		return
+	}
+	player.tick = 0
+
+	// EEx repeats the row without retriggering notes
+	if player.patternDelay > 0 {
+		player.delayCount = player.patternDelay + 1
+		player.patternDelay = 0
+	}
+	if player.delayCount > 0 {
+		player.delayCount--
+		if player.delayCount > 0 {
+			return
+		}
+	}
+	player.nextRow()
+}
+
+func (player *modPlayer) nextRow() {
+	switch {
+	case player.jump || player.patternBreak:
+		order := player.order + 1
+		if player.jump {
+			order = player.jumpOrder
+		}
+		row := 0
+		if player.patternBreak {
+			row = player.breakRow
+		}
+		player.jump, player.patternBreak = false, false
+		player.setPosition(order, row)
+	case player.row+1 >= player.patternRows(player.order):
+		player.setPosition(player.order+1, 0)
+	default:
+		player.row++
+	}
+}
+
+func (player *modPlayer) patternRows(order int) int {
+	return len(player.song.patterns[player.song.orders[order]]) / len(player.channels)
+}
+
+func (player *modPlayer) setPosition(order, row int) {
+	if order >= len(player.song.orders) {
+		order = player.song.restart
+		player.looped = true
+	}
+	// A break past the end of the pattern goes to its first row, as ProTracker does
+	if row >= player.patternRows(order) {
+		row = 0
+	}
+	player.order, player.row = order, row
+}
+
+func (player *modPlayer) processRow() {
+	pattern := player.song.patterns[player.song.orders[player.order]]
+	for i := range player.channels {
+		channel := &player.channels[i]
+		note := pattern[player.row*len(player.channels)+i]
+		channel.effect, channel.param = note.effect, note.param
+		if slot, ok := player.memorySlot(note.effect); ok {
+			if note.param == 0 {
+				channel.param = channel.memory[slot]
+			}
+			channel.memory[slot] = channel.param
+		}
+		channel.volumeCommand, channel.volumeParam = note.volume, note.volumeParam
+		channel.outPeriod, channel.outVolume = channel.period, channel.volume
+		channel.triggered = false
+
+		if note.effect == fxExtended && note.param>>4 == 0xd && note.param&0xf != 0 {
+			// EDx holds the whole note back
+			channel.delayedNote = note
+		} else {
+			player.startNote(channel, note)
+		}
+		player.volumeColumn(channel, true)
+		player.rowEffects(channel)
+	}
+}
+
+// Where an effect keeps its last parameter, which the trackers share between effects in their own ways
+func (player *modPlayer) memorySlot(effect int) (int, bool) {
+	song := player.song
+	switch {
+	case song.format == formatMOD:
+		return 0, false
+	case song.format == formatIT && (effect == fxPortaUp || effect == fxPortaDown):
+		// Impulse Tracker always shares E and F, the compatible Gxx flag keeps G out of it
+		return fxPortaUp, true
+	case song.linkedPorta && effect == fxTonePorta:
+		return fxPortaUp, true
+	case !rememberedEffects[effect]:
+		return 0, false
+	case song.format == formatS3M:
+		// Scream Tracker keeps one last parameter for all of them
+		return fxVolSlide, true
+	case effect == fxTonePortaVolSlide || effect == fxVibratoVolSlide:
+		// 5xy and 6xy slide with Axy's memory, as K and L do with D's
+		return fxVolSlide, true
+	}
+	return effect, true
+}
+
+// The sample an instrument plays for a note, and the instrument itself if the song has them
+func (player *modPlayer) lookupInstrument(number, note int) (*modSample, *modInstrument) {
+	song := player.song
+	if len(song.instruments) == 0 {
+		if number > 0 && number <= len(song.samples) {
+			return &song.samples[number-1], nil
+		}
+		return nil, nil
+	}
+	if number <= 0 || number > len(song.instruments) {
+		return nil, nil
+	}
+	instrument := &song.instruments[number-1]
+	if note < 1 || note > 120 {
+		return nil, instrument
+	}
+	if s := instrument.samples[note-1]; s > 0 && s <= len(song.samples) {
+		return &song.samples[s-1], instrument
+	}
+	return nil, instrument
+}
+
+func (player *modPlayer) startNote(channel *modChannel, note modNote) {
+	if note.instrument > 0 {
+		key := note.note
+		if key < 1 || key > 120 {
+			key = channel.note
+		}
+		if sample, instrument := player.lookupInstrument(note.instrument, key); sample != nil {
+			channel.sample = sample
+			channel.instrument = note.instrument
+			channel.volume, channel.outVolume = sample.volume, sample.volume
+			channel.finetune = sample.finetune
+			if sample.pan >= 0 {
+				channel.pan = sample.pan
+			}
+			channel.name, channel.envelope, channel.fadeout = sample.name, nil, 0
+			if instrument != nil {
+				channel.name, channel.envelope, channel.fadeout = instrument.name, instrument.envelope, instrument.fadeout
+			}
+			channel.keyOn, channel.fade, channel.envelopeTick = true, 1, 0
+		}
+	}
+	switch note.note {
+	case 0:
+		return
+	case noteKeyOff:
+		player.keyOff(channel)
+		return
+	case noteCut:
+		channel.volume, channel.outVolume = 0, 0
+		return
+	}
+	sample, _ := player.lookupInstrument(channel.instrument, note.note)
+	if sample == nil {
+		return
+	}
+	if note.effect == fxExtended && note.param>>4 == 0x5 {
+		channel.finetune = int(int8(note.param<<4) >> 4)
+	}
+
+	period := player.notePeriod(sample, channel.finetune, note.note)
+	tonePorta := note.effect == fxTonePorta || note.effect == fxTonePortaVolSlide || note.volume == volTonePorta
+	if tonePorta && channel.period != 0 {
+		// Tone portamento slides to the note instead of playing it
+		channel.portaTarget = period
+		return
+	}
+
+	channel.sample = sample
+	channel.note = note.note
+	channel.period, channel.outPeriod = period, period
+	channel.position, channel.backwards = 0, false
+	channel.triggered = true
+	channel.funkOffset = 0
+	channel.keyOn, channel.fade, channel.envelopeTick = true, 1, 0
+	channel.notes++
+	if channel.vibratoWave&4 == 0 {
+		channel.vibratoPos = 0
+	}
+	if channel.tremoloWave&4 == 0 {
+		channel.tremoloPos = 0
+	}
+}
+
+func (player *modPlayer) keyOff(channel *modChannel) {
+	channel.keyOn = false
+	if channel.envelope == nil && player.song.format == formatXM {
+		// FastTracker cuts notes that have no envelope to fade them out
+		channel.volume, channel.outVolume = 0, 0
+	}
+}
+
+// ProTracker notes come from its period tables, the rest are worked out from the sample's middle C
+func (player *modPlayer) notePeriod(sample *modSample, finetune, note int) float64 {
+	if player.song.format == formatMOD {
+		index := int(math.Max(0, math.Min(float64(note-37), float64(len(modPeriods)-1))))
+		return float64(finetunePeriods[finetune&15][index])
+	}
+	return paulaClock / (sample.c5speed * math.Pow(2, float64(note-player.middleNote())/12))
+}
+
+// The note that plays at a sample's middle C rate, C-4 in S3M and XM but C-5 in IT
+func (player *modPlayer) middleNote() int {
+	if player.song.format == formatIT {
+		return 61
+	}
+	return 49
+}
+
+// The nearest note to a period, for arpeggios and glissando
+func (player *modPlayer) periodNote(sample *modSample, period float64) int {
+	if player.song.format == formatMOD {
+		return modNoteIndex(int(period)) + 37
+	}
+	return player.middleNote() + int(math.Round(12*math.Log2(paulaClock/(sample.c5speed*period))))
+}
+
+// Moves a period by slide units, periods for Amiga slides and 1/16 semitones for linear ones
+func (player *modPlayer) offsetPeriod(period, units float64) float64 {
+	if player.song.linear {
+		return period * math.Pow(2, units/192)
+	}
+	return period + units
+}
+
+func (player *modPlayer) slidePeriod(channel *modChannel, units float64) {
+	low, high := 1.0, 65535.0
+	if player.song.format == formatMOD {
+		low, high = minPeriod, maxPeriod
+	}
+	channel.period = math.Max(low, math.Min(player.offsetPeriod(channel.period, units), high))
+	channel.outPeriod = channel.period
+}
+
+// S3M and IT hide fine slides in the top nibble of the slide commands
+func (player *modPlayer) fineSlides() bool {
+	return player.song.format == formatS3M || player.song.format == formatIT
+}
+
+// The volume column acts before the effect on every tick
+func (player *modPlayer) volumeColumn(channel *modChannel, firstTick bool) {
+	value := channel.volumeParam
+	switch channel.volumeCommand {
+	case volSet:
+		if firstTick {
+			channel.volume = int(math.Min(float64(value), modMaxVolume))
+			channel.outVolume = channel.volume
+		}
+	case volFineUp, volFineDown:
+		if firstTick {
+			if channel.volumeCommand == volFineDown {
+				value = -value
+			}
+			channel.volume = int(math.Max(0, math.Min(float64(channel.volume+value), modMaxVolume)))
+			channel.outVolume = channel.volume
+		}
+	case volSlideUp:
+		if !firstTick {
+			volumeSlide(channel, value, 0)
+		}
+	case volSlideDown:
+		if !firstTick {
+			volumeSlide(channel, 0, value)
+		}
+	case volPan:
+		if firstTick {
+			channel.pan = float64(value) / 64
+		}
+	case volTonePorta:
+		if firstTick && value != 0 {
+			channel.portaSpeed = value
+		} else if !firstTick && channel.effect != fxTonePorta && channel.effect != fxTonePortaVolSlide {
+			player.tonePortamento(channel)
+		}
+	case volVibratoSpeed:
+		if firstTick && value != 0 {
+			channel.vibratoSpeed = value
+		}
+	case volVibrato:
+		if firstTick && value != 0 {
+			channel.vibratoDepth = value
+		} else if !firstTick && channel.effect != fxVibrato && channel.effect != fxVibratoVolSlide {
+			player.vibrato(channel, 1)
+		}
+	case volPanSlideLeft, volPanSlideRight:
+		if !firstTick {
+			// In FastTracker's 0 to 255 panning steps
+			if channel.volumeCommand == volPanSlideLeft {
+				value = -value
+			}
+			channel.pan = math.Max(0, math.Min(channel.pan+float64(value)/255, 1))
+		}
+	case volPortaDown, volPortaUp:
+		// Impulse Tracker's pitch slides share their memory with E and F
+		if firstTick {
+			if value != 0 {
+				channel.memory[fxPortaUp] = value
+			}
+			break
+		}
+		amount := float64(channel.memory[fxPortaUp])
+		if channel.volumeCommand == volPortaUp {
+			amount = -amount
+		}
+		player.slidePeriod(channel, amount)
+	}
+}
+
+// Effects that act once at the start of the row
+func (player *modPlayer) rowEffects(channel *modChannel) {
+	x, y := channel.param>>4, channel.param&0xf
+	switch channel.effect {
+	case fxPortaUp, fxPortaDown:
+		if !player.fineSlides() || x < 0xe {
+			break
+		}
+		// EFx and FFx are fine slides, EEx and FEx extra fine ones
+		amount := float64(y)
+		if x == 0xe {
+			amount /= 4
+		}
+		if channel.effect == fxPortaUp {
+			amount = -amount
+		}
+		player.slidePeriod(channel, amount)
+	case fxTonePorta:
+		if channel.param != 0 {
+			channel.portaSpeed = channel.param
+		}
+	case fxVibrato, fxFineVibrato:
+		if x != 0 {
+			channel.vibratoSpeed = x
+		}
+		if y != 0 {
+			channel.vibratoDepth = y
+		}
+	case fxTremolo:
+		if x != 0 {
+			channel.tremoloSpeed = x
+		}
+		if y != 0 {
+			channel.tremoloDepth = y
+		}
+	case fxPan:
+		channel.pan = float64(channel.param) / 255
+	case fxOffset:
+		if channel.param != 0 {
+			channel.offset = channel.param * 256
+		}
+		// Only a note starting takes the offset
+		if channel.sample != nil && channel.triggered {
+			channel.position = float64(channel.offset)
+		}
+	case fxVolSlide:
+		if !player.fineSlides() {
+			break
+		}
+		// DxF and DFx are fine slides that only act here
+		switch {
+		case y == 0xf && x != 0:
+			channel.volume = int(math.Min(float64(channel.volume+x), modMaxVolume))
+		case x == 0xf && y != 0:
+			channel.volume = int(math.Max(float64(channel.volume-y), 0))
+		}
+		channel.outVolume = channel.volume
+	case fxJump:
+		player.jump, player.jumpOrder = true, channel.param
+		if channel.param <= player.order {
+			player.looped = true
+		}
+	case fxVolume:
+		channel.volume = int(math.Min(float64(channel.param), modMaxVolume))
+		channel.outVolume = channel.volume
+	case fxBreak:
+		// The row is given in decimal
+		player.patternBreak, player.breakRow = true, x*10+y
+	case fxExtended:
+		player.extendedEffect(channel, x, y)
+	case fxSpeedTempo:
+		if channel.param == 0 {
+			// F00 stops the song, it is played as its end
+			player.looped = true
+			break
+		}
+		if channel.param < 0x20 {
+			player.speed = channel.param
+		} else {
+			player.tempo = channel.param
+		}
+	case fxSpeed:
+		if channel.param != 0 {
+			player.speed = channel.param
+		}
+	case fxTempo:
+		if channel.param >= 0x20 {
+			player.tempo = channel.param
+		}
+	case fxGlobalVolume:
+		player.globalVolume = int(math.Min(float64(channel.param), modMaxVolume))
+	case fxExtraFinePorta:
+		switch x {
+		case 1:
+			player.slidePeriod(channel, -float64(y)/4)
+		case 2:
+			player.slidePeriod(channel, float64(y)/4)
+		}
+	case fxKeyOff:
+		if channel.param == 0 {
+			player.keyOff(channel)
+		}
+	}
+}
+
+func (player *modPlayer) extendedEffect(channel *modChannel, command, value int) {
+	switch command {
+	case 0x0:
+		if player.song.format == formatMOD {
+			ledFilter = value == 0
+		}
+	case 0x1:
+		player.slidePeriod(channel, -float64(value))
+	case 0x2:
+		player.slidePeriod(channel, float64(value))
+	case 0x3:
+		channel.glissando = value != 0
+	case 0x4:
+		channel.vibratoWave = value
+	case 0x6:
+		if value == 0 {
+			channel.loopRow = player.row
+		} else if channel.loopCount == 0 {
+			channel.loopCount = value
+			player.patternBreak, player.breakRow = true, channel.loopRow
+			player.jumpOrder, player.jump = player.order, true
+		} else if channel.loopCount--; channel.loopCount > 0 {
+			player.patternBreak, player.breakRow = true, channel.loopRow
+			player.jumpOrder, player.jump = player.order, true
+		}
+	case 0x7:
+		channel.tremoloWave = value
+	case 0x8:
+		channel.pan = float64(value) / 15
+	case 0xa:
+		channel.volume = int(math.Min(float64(channel.volume+value), modMaxVolume))
+		channel.outVolume = channel.volume
+	case 0xb:
+		channel.volume = int(math.Max(float64(channel.volume-value), 0))
+		channel.outVolume = channel.volume
+	case 0xc:
+		if value == 0 {
+			channel.volume, channel.outVolume = 0, 0
+		}
+	case 0xe:
+		if player.delayCount == 0 {
+			player.patternDelay = value
+		}
+	case 0xf:
+		channel.funkSpeed = value
+	}
+}
+
+// Effects that keep working on the ticks after the first
+func (player *modPlayer) tickEffects(channel *modChannel) {
+	x, y := channel.param>>4, channel.param&0xf
+	channel.outPeriod, channel.outVolume = channel.period, channel.volume
+	player.funkRepeat(channel)
+	player.volumeColumn(channel, false)
+
+	switch channel.effect {
+	case fxArpeggio:
+		if channel.param != 0 && channel.note > 0 && channel.sample != nil {
+			// Arpeggio cycles through the note and two semitone offsets
+			semitones := []int{0, x, y}[player.tick%3]
+			channel.outPeriod = player.notePeriod(channel.sample, channel.finetune, channel.note+semitones)
+		}
+	case fxPortaUp:
+		if !player.fineSlides() || x < 0xe {
+			player.slidePeriod(channel, -float64(channel.param))
+		}
+	case fxPortaDown:
+		if !player.fineSlides() || x < 0xe {
+			player.slidePeriod(channel, float64(channel.param))
+		}
+	case fxTonePorta:
+		player.tonePortamento(channel)
+	case fxVibrato:
+		player.vibrato(channel, 1)
+	case fxFineVibrato:
+		player.vibrato(channel, 0.25)
+	case fxTonePortaVolSlide:
+		player.tonePortamento(channel)
+		volumeSlide(channel, x, y)
+	case fxVibratoVolSlide:
+		player.vibrato(channel, 1)
+		volumeSlide(channel, x, y)
+	case fxTremolo:
+		delta := modWave(channel.tremoloWave, channel.tremoloPos) * channel.tremoloDepth / 64
+		channel.outVolume = int(math.Max(0, math.Min(float64(channel.volume+delta), modMaxVolume)))
+		channel.tremoloPos = (channel.tremoloPos + channel.tremoloSpeed) & 63
+	case fxVolSlide:
+		if !player.fineSlides() || (x != 0xf && y != 0xf) || channel.param == 0xf0 || channel.param == 0x0f {
+			volumeSlide(channel, x, y)
+		}
+	case fxExtended:
+		switch x {
+		case 0x9:
+			if y != 0 && player.tick%y == 0 {
+				channel.position, channel.backwards = 0, false
+				channel.notes++
+			}
+		case 0xc:
+			if player.tick == y {
+				channel.volume, channel.outVolume = 0, 0
+			}
+		case 0xd:
+			if player.tick == y {
+				player.startNote(channel, channel.delayedNote)
+				channel.outVolume = channel.volume
+			}
+		}
+	case fxGlobalVolSlide:
+		if x != 0 {
+			player.globalVolume = int(math.Min(float64(player.globalVolume+x), modMaxVolume))
+		} else {
+			player.globalVolume = int(math.Max(float64(player.globalVolume-y), 0))
+		}
+	case fxPanSlide:
+		channel.pan = math.Max(0, math.Min(channel.pan+float64(x-y)/64, 1))
+	case fxRetrig:
+		if y != 0 && player.tick%y == 0 {
+			channel.volume = int(math.Max(0, math.Min(float64(retrigVolume[x](channel.volume)), modMaxVolume)))
+			channel.outVolume = channel.volume
+			channel.position, channel.backwards = 0, false
+			channel.notes++
+		}
+	case fxTremor:
+		// On for x+1 ticks and off for y+1
+		if channel.tremorCount%(x+y+2) > x {
+			channel.outVolume = 0
+		}
+		channel.tremorCount++
+	case fxKeyOff:
+		if player.tick == channel.param {
+			player.keyOff(channel)
+		}
+	}
+}
+
+func volumeSlide(channel *modChannel, up, down int) {
+	if up != 0 {
+		channel.volume = int(math.Min(float64(channel.volume+up), modMaxVolume))
+	} else {
+		channel.volume = int(math.Max(float64(channel.volume-down), 0))
+	}
+	channel.outVolume = channel.volume
+}
+
+func (player *modPlayer) tonePortamento(channel *modChannel) {
+	if channel.portaTarget == 0 {
+		return
+	}
+	if channel.period < channel.portaTarget {
+		channel.period = math.Min(player.offsetPeriod(channel.period, float64(channel.portaSpeed)), channel.portaTarget)
+	} else {
+		channel.period = math.Max(player.offsetPeriod(channel.period, -float64(channel.portaSpeed)), channel.portaTarget)
+	}
+	channel.outPeriod = channel.period
+	if channel.sample == nil {
+		return
+	}
+	channel.note = player.periodNote(channel.sample, channel.period)
+	if channel.glissando {
+		// Glissando slides in semitone steps
+		channel.outPeriod = player.notePeriod(channel.sample, channel.finetune, channel.note)
+	}
+}
+
+func (player *modPlayer) vibrato(channel *modChannel, scale float64) {
+	delta := float64(modWave(channel.vibratoWave, channel.vibratoPos)*channel.vibratoDepth) / 128 * scale
+	if player.song.format == formatMOD {
+		// ProTracker only has whole periods
+		delta = math.Trunc(delta)
+	}
+	channel.outPeriod = player.offsetPeriod(channel.period, delta)
+	channel.vibratoPos = (channel.vibratoPos + channel.vibratoSpeed) & 63
+}
+
+// Vibrato and tremolo waveforms from -255 to 255 over 64 steps
+func modWave(wave, position int) int {
+	var value int
+	switch wave & 3 {
+	case 0:
+		value = modSine[position&31]
+	case 1:
+		value = 255 - (position&31)*8
+		if position >= 32 {
+			value = -value
+		}
+		return value
+	case 2:
+		value = 255
+	case 3:
+		return rand.Intn(511) - 255
+	}
+	if position >= 32 {
+		value = -value
+	}
+	return value
+}
+
+// EFx inverts the sample loop a byte at a time
+func (player *modPlayer) funkRepeat(channel *modChannel) {
+	sample := channel.sample
+	if channel.funkSpeed == 0 || sample == nil || sample.loopLength == 0 {
+		return
+	}
+	channel.funkDelay += modFunkTable[channel.funkSpeed]
+	if channel.funkDelay < 128 {
+		return
+	}
+	channel.funkDelay = 0
+	channel.funkOffset = (channel.funkOffset + 1) % sample.loopLength
+	i := sample.loopStart + channel.funkOffset
+	sample.data[i] = -256 - sample.data[i]
+}
+
+// Works out the volume heard, moving the envelope and fadeout on a tick
+func (player *modPlayer) updateMixVolume(channel *modChannel) {
+	volume := float64(channel.outVolume) * float64(player.globalVolume) / modMaxVolume
+	if channel.sample != nil {
+		volume *= channel.sample.gain
+	}
+	if envelope := channel.envelope; envelope != nil && len(envelope.points) > 0 {
+		volume *= envelope.value(channel.envelopeTick) / modMaxVolume
+		points := envelope.points
+		held := channel.keyOn && envelope.sustain >= 0 && channel.envelopeTick == points[envelope.sustain][0]
+		if !held {
+			channel.envelopeTick++
+			if envelope.loopEnd >= 0 && channel.envelopeTick > points[envelope.loopEnd][0] {
+				channel.envelopeTick = points[envelope.loopStart][0]
+			}
+		}
+		if !channel.keyOn {
+			channel.fade = math.Max(0, channel.fade-channel.fadeout)
+		}
+	}
+	channel.mixVolume = volume * channel.fade
+}
+
+// The envelope volume at a tick, straight lines between the points
+func (envelope *modEnvelope) value(tick int) float64 {
+	points := envelope.points
+	for i := 1; i < len(points); i++ {
+		if tick < points[i][0] {
+			a, b := points[i-1], points[i]
+			if tick <= a[0] || b[0] == a[0] {
+				return float64(a[1])
+			}
+			return float64(a[1]) + float64((b[1]-a[1])*(tick-a[0]))/float64(b[0]-a[0])
+		}
+	}
+	return float64(points[len(points)-1][1])
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Amiga models for the output filters
+const (
+	amigaOff = iota
+	amigaA500
+	amigaA1200
+)
+
+const (
+	a500LowPass   = 4420.97 // Hz, the fixed RC filter after Paula
+	a1200LowPass  = 34419.0
+	amigaHighPass = 5.2    // The output coupling capacitor
+	ledLowPass    = 3090.5 // The two pole "LED" filter
+	ledQ          = 0.660
+)
+
+var (
+	amigaModels      = []string{"off", "a500", "a1200"}
+	amigaModel       = amigaOff
+	stereoSeparation = 1.0 // 0 for mono, 1 for hard panned channels
+	ledFilter        bool  // Switched by the E0x command and the F key
+	paulaResampling  bool  // Play samples as Paula does, holding 8-bit values at the channel rate
+	amigaFilters     [2]amigaFilter
+)
+
+// Filter state for one side of the stereo output
+type amigaFilter struct {
+	low, high  float64
+	led        [4]float64 // Previous two inputs and outputs
+	ledCoeffs  [5]float64
+	lowPassHz  float64
+	lowPassA   float64
+	highPassA  float64
+	filterRate int
+}
+
+func setAmigaModel(name string) error {
+	for i, model := range amigaModels {
+		if model == name {
+			amigaModel = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown Amiga model %q", name)
+}
+
+// Cycles through off, A500 and A1200 output filters
+func nextAmigaModel() {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	amigaModel = (amigaModel + 1) % len(amigaModels)
+}
+
+// Steps the stereo separation down by a quarter, going back to full after mono
+func nextStereoSeparation() {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	stereoSeparation -= 0.25
+	if stereoSeparation < 0 {
+		stereoSeparation = 1
+	}
+}
+
+func toggleLEDFilter() {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	ledFilter = !ledFilter
+}
+
+func togglePaulaResampling() {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+	paulaResampling = !paulaResampling
+}
+
+// Narrows the stereo then runs the Amiga's output filters, called with the music locked
+func amigaOutput(out [][2]float64, sampleRate int) {
+	if stereoSeparation < 1 {
+		for i, frame := range out {
+			mid, side := (frame[0]+frame[1])/2, (frame[0]-frame[1])/2*stereoSeparation
+			out[i] = [2]float64{mid + side, mid - side}
+		}
+	}
+	// With no model picked only the LED filter runs
+	lowPass := 0.0
+	switch amigaModel {
+	case amigaA500:
+		lowPass = a500LowPass
+	case amigaA1200:
+		lowPass = a1200LowPass
+	}
+	for side := range amigaFilters {
+		filter := &amigaFilters[side]
+		filter.setup(lowPass, sampleRate)
+		for i := range out {
+			out[i][side] = filter.process(out[i][side])
+		}
+	}
+}
+
+func (filter *amigaFilter) setup(lowPass float64, sampleRate int) {
+	if filter.lowPassHz == lowPass && filter.filterRate == sampleRate {
+		return
+	}
+	filter.lowPassHz, filter.filterRate = lowPass, sampleRate
+	filter.lowPassA = 1 - math.Exp(-2*math.Pi*lowPass/float64(sampleRate))
+	filter.highPassA = 1 - math.Exp(-2*math.Pi*amigaHighPass/float64(sampleRate))
+
+	// A standard biquad low-pass for the LED filter
+	w := 2 * math.Pi * ledLowPass / float64(sampleRate)
+	alpha := math.Sin(w) / (2 * ledQ)
+	a0 := 1 + alpha
+	filter.ledCoeffs = [5]float64{
+		(1 - math.Cos(w)) / 2 / a0, (1 - math.Cos(w)) / a0, (1 - math.Cos(w)) / 2 / a0,
+		-2 * math.Cos(w) / a0, (1 - alpha) / a0,
+	}
+}
+
+func (filter *amigaFilter) process(value float64) float64 {
+	if filter.lowPassHz > 0 {
+		filter.low += filter.lowPassA * (value - filter.low)
+		value = filter.low
+	}
+
+	// The LED filter always runs so switching it doesn't click
+	c, h := filter.ledCoeffs, &filter.led
+	led := c[0]*value + c[1]*h[0] + c[2]*h[1] - c[3]*h[2] - c[4]*h[3]
+	h[1], h[0] = h[0], value
+	h[3], h[2] = h[2], led
+	if ledFilter {
+		value = led
+	}
+	if filter.lowPassHz == 0 {
+		return value
+	}
+	filter.high += filter.highPassA * (value - filter.high)
+	return value - filter.high
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/veandco/go-sdl2/mix"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	crossfadeTime = 3.0 // Seconds to fade from one tune to the next
+	captionTime   = 6.0 // Seconds the now playing caption stays up
+)
+
+type playlistEntry struct {
+	path     string // "-" for the embedded tune
+	composer string
+	subtune  int // Of a SID tune, 0 for its own choice
+	size     int // Bytes, for the trackloader
+	song     *modSong
+	sid      *sidTune
+}
+
+var (
+	// The embedded tune loops on its own unless "-playlist file" is given
+	playlist        = []playlistEntry{{path: "-", composer: "Martin Galway"}}
+	playlistFile    string
+	playlistShuffle bool
+	playlistOrder   []int // Indexes into the playlist in playing order
+	playlistPos     int
+
+	musicVolume  = 1.0
+	musicRate    int
+	musicFrames  [][2]float64
+	fadingPlayer tunePlayer // The previous tune during a crossfade
+	crossfade    float64    // 0 to 1 through a crossfade
+
+	nowPlaying     string
+	nowPlayingTime time.Time
+)
+
+// Loads every tune up front, so a bad one is reported before the intro starts
+func setupPlaylist() error {
+	if playlistFile != "" {
+		entries, err := loadPlaylist(playlistFile)
+		if err != nil {
+			return err
+		}
+		playlist = entries
+	}
+	for i := range playlist {
+		entry := &playlist[i]
+		data := comicbakeryMod
+		if entry.path != "-" {
+			var err error
+			if data, err = os.ReadFile(entry.path); err != nil {
+				return err
+			}
+		}
+		entry.size = len(data)
+		var err error
+		if isSIDTune(data) {
+			entry.sid, err = loadSID(data)
+		} else {
+			entry.song, err = loadModule(data)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.path, err)
+		}
+	}
+	shufflePlaylist()
+	return nil
+}
+
+// One module or SID tune per line, optionally followed by "|" and the composer, with "-" for the embedded tune.
+// A SID tune can be given a sub-tune with "#", e.g. "Commando.sid#2"
+func loadPlaylist(path string) ([]playlistEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []playlistEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		module, composer, _ := strings.Cut(line, "|")
+		module = strings.TrimSpace(module)
+		if module == "" {
+			continue
+		}
+		subtune := 0
+		if i := strings.LastIndexByte(module, '#'); i >= 0 {
+			if n, err := strconv.Atoi(module[i+1:]); err == nil {
+				module, subtune = strings.TrimSpace(module[:i]), n
+			}
+		}
+		// Modules are found relative to the playlist
+		if module != "-" && !filepath.IsAbs(module) {
+			module = filepath.Join(filepath.Dir(path), module)
+		}
+		entries = append(entries, playlistEntry{path: module, composer: strings.TrimSpace(composer), subtune: subtune})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no tunes", path)
+	}
+	return entries, nil
+}
+
+func shufflePlaylist() {
+	playlistOrder = make([]int, len(playlist))
+	for i := range playlistOrder {
+		playlistOrder[i] = i
+	}
+	if playlistShuffle {
+		rand.Shuffle(len(playlistOrder), func(i, j int) {
+			playlistOrder[i], playlistOrder[j] = playlistOrder[j], playlistOrder[i]
+		})
+	}
+}
+
+// Plays the playlist through SDL_mixer's music hook
+func startPlaylist() error {
+	frequency, format, channels, _, err := mix.QuerySpec()
+	if err != nil {
+		return err
+	}
+	if format != mix.DEFAULT_FORMAT || channels != 2 {
+		return fmt.Errorf("need 16-bit stereo audio")
+	}
+	musicRate = frequency
+	playTune(0)
+	mix.HookMusic(fillMusic)
+	return nil
+}
+
+// Switches to a tune in the playing order, crossfading from the one before
+func playTune(position int) {
+	if position >= len(playlist) && playlistShuffle {
+		// A new order every time round
+		shufflePlaylist()
+	}
+	playlistPos = (position%len(playlist) + len(playlist)) % len(playlist)
+	entry := playlist[playlistOrder[playlistPos]]
+	var player tunePlayer
+	title, composer := "", entry.composer
+	if entry.sid != nil {
+		sid := newSIDPlayer(entry.sid, entry.subtune, musicRate)
+		player, title = sid, entry.sid.title(sid.subtune)
+		if composer == "" {
+			composer = entry.sid.author
+		}
+	} else {
+		player, title = newModPlayer(entry.song, musicRate), entry.song.title
+	}
+
+	musicMutex.Lock()
+	if musicPlayer != nil {
+		fadingPlayer, crossfade = musicPlayer, 0
+	}
+	musicPlayer = player
+	musicMutex.Unlock()
+
+	nowPlaying = title
+	if nowPlaying == "" {
+		nowPlaying = strings.TrimSuffix(filepath.Base(entry.path), filepath.Ext(entry.path))
+	}
+	if composer != "" {
+		nowPlaying += " BY " + composer
+	}
+	nowPlayingTime = time.Now()
+}
+
+func nextTune() {
+	playTune(playlistPos + 1)
+}
+
+func previousTune() {
+	playTune(playlistPos - 1)
+}
+
+// Steps through the sub-tunes of a SID tune, wrapping round at either end
+func changeSubtune(step int) {
+	entry := &playlist[playlistOrder[playlistPos]]
+	if entry.sid == nil || entry.sid.songs < 2 {
+		return
+	}
+	subtune := entry.subtune
+	if subtune < 1 || subtune > entry.sid.songs {
+		subtune = entry.sid.startSong
+	}
+	entry.subtune = (subtune-1+step+entry.sid.songs)%entry.sid.songs + 1
+	playTune(playlistPos)
+}
+
+// Moves on once a tune has played through, a lone tune just loops
+func updatePlaylist() {
+	musicMutex.Lock()
+	ended := musicPlayer != nil && musicPlayer.ended()
+	musicMutex.Unlock()
+	if ended && len(playlist) > 1 {
+		nextTune()
+	}
+}
+
+// Mixes the tune, and the one before it during a crossfade, into signed 16-bit stereo frames
+func fillMusic(buffer []byte) {
+	musicMutex.Lock()
+	defer musicMutex.Unlock()
+
+	frames := len(buffer) / 4
+	if len(musicFrames) < frames {
+		musicFrames = make([][2]float64, frames)
+	}
+	out := musicFrames[:frames]
+	for i := range out {
+		out[i] = [2]float64{}
+	}
+	mixMusic(out)
+	for i, frame := range out {
+		binary.LittleEndian.PutUint16(buffer[i*4:], uint16(clampSample(frame[0])))
+		binary.LittleEndian.PutUint16(buffer[i*4+2:], uint16(clampSample(frame[1])))
+	}
+}
+
+// Adds the music to out, through the Amiga output stage and at the music volume, called with the music locked
+func mixMusic(out [][2]float64) {
+	frames := len(out)
+	switch {
+	case fadingPlayer != nil:
+		// Equal power, so the level holds up halfway through
+		fadingPlayer.render(out, math.Cos(crossfade*math.Pi/2))
+		musicPlayer.render(out, math.Sin(crossfade*math.Pi/2))
+		crossfade += float64(frames) / (crossfadeTime * float64(musicRate))
+		if crossfade >= 1 {
+			fadingPlayer = nil
+		}
+	case musicPlayer != nil:
+		musicPlayer.render(out, 1)
+	}
+	amigaOutput(out, musicRate)
+	for i := range out {
+		out[i][0] *= musicVolume
+		out[i][1] *= musicVolume
+	}
+}
+
+// The title and composer slide in along the bottom when a tune starts, then slide away
+func drawNowPlaying() {
+	shown := time.Since(nowPlayingTime).Seconds()
+	if nowPlaying == "" || shown > captionTime {
+		return
+	}
+	text := "NOW PLAYING: " + nowPlaying
+	size := float32(windowHeight) / 40
+	width := float32(len(text)) * size
+	slide := math.Min(math.Min(shown, captionTime-shown)/0.5, 1)
+	x := 20 - (width+20)*float32(1-slide)
+	drawText(text, x, float32(windowHeight)-60-size, size)
+	flushBatch()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	scopeHeight   = 64
+	scopeNameSize = 10
+)
+
+var scopesEnabled bool
+
+// ProTracker style scopes, one box per channel with the instrument name
+func drawQuadrascope() {
+	if !scopesEnabled {
+		return
+	}
+	waves, names := musicScopes()
+	if len(waves) == 0 {
+		return
+	}
+
+	// Along the top, leaving room for the VU meters on the left
+	left, top := float32(240), float32(14)
+	gap := float32(8)
+	width := (float32(windowWidth) - left - 20 - gap*float32(len(waves)-1)) / float32(len(waves))
+	background := sdl.Color{R: 0, G: 0, B: 30, A: 200}
+	border := sdl.Color{R: 90, G: 90, B: 160, A: 255}
+	trace := sdl.Color{R: 255, G: 255, B: 120, A: 255}
+
+	var previous sdl.BlendMode
+	err := renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	defer renderer.SetDrawBlendMode(previous)
+	err = renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return
+	}
+
+	for i, wave := range waves {
+		x := left + float32(i)*(width+gap)
+		batchRect(x, top, width, scopeHeight, background, background)
+		batchLine(x, top, x+width, top, border, border)
+		batchLine(x, top+scopeHeight, x+width, top+scopeHeight, border, border)
+		batchLine(x, top, x, top+scopeHeight, border, border)
+		batchLine(x+width, top, x+width, top+scopeHeight, border, border)
+
+		centre := top + scopeHeight/2
+		step := width / float32(len(wave)-1)
+		for j := 1; j < len(wave); j++ {
+			batchLine(x+float32(j-1)*step, centre-float32(wave[j-1])*scopeHeight/2,
+				x+float32(j)*step, centre-float32(wave[j])*scopeHeight/2, trace, trace)
+		}
+		drawText(names[i], x+4, top+scopeHeight+4, scopeNameSize)
+	}
+	flushBatch()
+}
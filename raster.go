@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+)
+
+type polygonEdge struct {
+	x0, y0, x1, y1 float64
+	winding        int
+}
+type edgeCrossing struct {
+	x       float64
+	winding int
+}
+
+var (
+	// Reused between calls so filling a polygon doesn't allocate
+	polygonEdges []polygonEdge
+	crossings    []edgeCrossing
+	spanRects    []sdl.Rect
+)
+
+// Sub-pixel scanline fill with a top-left rule and non-zero winding, so shared
+// edges never overlap and concave polygons work. Spans are clipped to the
+// viewport and added to the draw batch in the current draw colour, so callers
+// must flushBatch once they are done.
+func fillPolygon(renderer *sdl.Renderer, points []sdl.FPoint, indices []int) {
+	if len(indices) < 3 {
+		return
+	}
+	viewport := renderer.GetViewport()
+
+	// Collect the non-horizontal edges, pointing downwards
+	polygonEdges = polygonEdges[:0]
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for i := range indices {
+		a := points[indices[i]]
+		b := points[indices[(i+1)%len(indices)]]
+		minY = math.Min(minY, float64(a.Y))
+		maxY = math.Max(maxY, float64(a.Y))
+		if a.Y == b.Y {
+			continue
+		}
+		if a.Y < b.Y {
+			polygonEdges = append(polygonEdges, polygonEdge{float64(a.X), float64(a.Y), float64(b.X), float64(b.Y), 1})
+		} else {
+			polygonEdges = append(polygonEdges, polygonEdge{float64(b.X), float64(b.Y), float64(a.X), float64(a.Y), -1})
+		}
+	}
+
+	// Scanlines whose pixel centres lie inside the polygon, clipped to the viewport
+	firstY := int32(math.Max(math.Ceil(minY-0.5), 0))
+	lastY := int32(math.Min(math.Ceil(maxY-0.5), float64(viewport.H))) - 1
+
+	spanRects = spanRects[:0]
+	for y := firstY; y <= lastY; y++ {
+		sampleY := float64(y) + 0.5
+
+		// An edge covers y0 <= sampleY < y1, so a shared vertex is only counted once
+		crossings = crossings[:0]
+		for _, e := range polygonEdges {
+			if sampleY < e.y0 || sampleY >= e.y1 {
+				continue
+			}
+			x := e.x0 + (sampleY-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+			crossings = append(crossings, edgeCrossing{x, e.winding})
+		}
+
+		// Insertion sort, there are only ever a handful of crossings
+		for i := 1; i < len(crossings); i++ {
+			for j := i; j > 0 && crossings[j].x < crossings[j-1].x; j-- {
+				crossings[j], crossings[j-1] = crossings[j-1], crossings[j]
+			}
+		}
+
+		winding := 0
+		for i := 0; i+1 < len(crossings); i++ {
+			winding += crossings[i].winding
+			if winding == 0 {
+				continue
+			}
+			// Pixels whose centres lie in [left, right), clipped to the viewport
+			left := int32(math.Max(math.Ceil(crossings[i].x-0.5), 0))
+			right := int32(math.Min(math.Ceil(crossings[i+1].x-0.5), float64(viewport.W)))
+			if right <= left {
+				continue
+			}
+			// Extend the previous span instead of starting a new one where they touch
+			if n := len(spanRects); n > 0 && spanRects[n-1].Y == y && spanRects[n-1].X+spanRects[n-1].W == left {
+				spanRects[n-1].W = right - spanRects[n-1].X
+				continue
+			}
+			spanRects = append(spanRects, sdl.Rect{X: left, Y: y, W: right - left, H: 1})
+		}
+	}
+
+	r, g, b, a, err := renderer.GetDrawColor()
+	if err != nil {
+		return
+	}
+	color := sdl.Color{R: r, G: g, B: b, A: a}
+	for _, span := range spanRects {
+		batchRect(float32(span.X), float32(span.Y), float32(span.W), float32(span.H), color, color)
+	}
+}
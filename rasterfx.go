@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+)
+
+// The raster effects are drawn a line at a time at Amiga resolution, then scaled up
+const (
+	rasterWidth     = 320
+	rasterHeight    = 256
+	kefrensBarWidth = 16
+	twisterRadius   = 36
+)
+
+var (
+	rasterTexture  *sdl.Texture
+	rasterPixels   = make([]uint32, rasterWidth*rasterHeight)
+	kefrensLine    = make([]uint32, rasterWidth)
+	kefrensEnabled bool
+	twisterEnabled bool
+
+	// The four faces of the twister, each with a light and dark stripe colour
+	twisterColors = [][2]sdl.Color{
+		{{R: 255, G: 80, B: 40, A: 255}, {R: 120, G: 20, B: 10, A: 255}},
+		{{R: 255, G: 220, B: 60, A: 255}, {R: 130, G: 90, B: 10, A: 255}},
+		{{R: 60, G: 200, B: 255, A: 255}, {R: 10, G: 70, B: 130, A: 255}},
+		{{R: 220, G: 100, B: 255, A: 255}, {R: 90, G: 30, B: 120, A: 255}},
+	}
+)
+
+func setupRasterEffects() error {
+	var err error
+	rasterTexture, err = renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, rasterWidth, rasterHeight)
+	if err != nil {
+		return err
+	}
+	return rasterTexture.SetBlendMode(sdl.BLENDMODE_BLEND)
+}
+
+func drawRasterEffects(t float64) {
+	if !kefrensEnabled && !twisterEnabled {
+		return
+	}
+	for i := range rasterPixels {
+		rasterPixels[i] = 0
+	}
+	if kefrensEnabled {
+		drawKefrens(t)
+	}
+	if twisterEnabled {
+		drawTwister(t)
+	}
+
+	err := rasterTexture.UpdateRGBA(nil, rasterPixels, rasterWidth)
+	if err != nil {
+		return
+	}
+	err = renderer.Copy(rasterTexture, nil, nil)
+	if err != nil {
+		return
+	}
+}
+
+func packColor(c sdl.Color) uint32 {
+	return uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+func drawKefrens(t float64) {
+	// The line buffer is cleared once a frame but not between lines, so every line shows the bars of all the lines above it
+	for i := range kefrensLine {
+		kefrensLine[i] = 0
+	}
+	for y := 0; y < rasterHeight; y++ {
+		fy := float64(y)
+		x := rasterWidth/2 + 120*math.Sin(fy*0.025+t*1.7)*math.Cos(fy*0.009-t*0.8)
+		hue := fy*0.04 + t*2
+		color := sdl.Color{
+			R: uint8(127 + 127*math.Sin(hue)),
+			G: uint8(127 + 127*math.Sin(hue+2.1)),
+			B: uint8(127 + 127*math.Sin(hue+4.2)),
+			A: 255,
+		}
+
+		left := int(x) - kefrensBarWidth/2
+		for i := 0; i < kefrensBarWidth; i++ {
+			if left+i < 0 || left+i >= rasterWidth {
+				continue
+			}
+			// Rounded like a tube, brightest in the middle
+			shade := math.Cos((float64(i)+0.5)/kefrensBarWidth*math.Pi - math.Pi/2)
+			kefrensLine[left+i] = packColor(fadeColor(color, 0.2+0.8*shade))
+		}
+		copy(rasterPixels[y*rasterWidth:(y+1)*rasterWidth], kefrensLine)
+	}
+}
+
+func drawTwister(t float64) {
+	for y := 0; y < rasterHeight; y++ {
+		fy := float64(y)
+		// The twist along the bar winds and unwinds over time
+		angle := t*1.3 + fy*0.02*math.Sin(t*0.45)
+		centre := rasterWidth/2 + 40*math.Sin(fy*0.012+t*1.1)
+
+		var corners [5]float64
+		for i := range corners {
+			corners[i] = centre + twisterRadius*math.Sin(angle+float64(i)*math.Pi/2)
+		}
+
+		row := rasterPixels[y*rasterWidth : (y+1)*rasterWidth]
+		for face := 0; face < 4; face++ {
+			left, right := corners[face], corners[face+1]
+			if right <= left {
+				// Facing away
+				continue
+			}
+			// Faces turned towards the viewer are wider and brighter
+			shade := 0.25 + 0.75*(right-left)/(twisterRadius*math.Sqrt2)
+			stripe := int(fy+t*40) / 8 % 2
+			for x := int(math.Ceil(left)); x < int(math.Ceil(right)); x++ {
+				if x < 0 || x >= rasterWidth {
+					continue
+				}
+				// Darken towards the edges of each face
+				u := (float64(x) - left) / (right - left)
+				edge := 0.7 + 0.3*math.Sin(u*math.Pi)
+				row[x] = packColor(fadeColor(twisterColors[face][stripe], shade*edge))
+			}
+		}
+	}
+}
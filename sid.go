@@ -0,0 +1,341 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	sidClock       = 985248 // PAL C64 clock, the SID runs one step per cycle
+	sidModel6581   = 6581
+	sidModel8580   = 8580
+	sidOutputScale = 3.0 // From the SID's 12-bit voices to the mixer's 16-bit range
+)
+
+// Envelope states
+const (
+	envelopeAttack = iota
+	envelopeDecaySustain
+	envelopeRelease
+)
+
+// Control register bits
+const (
+	sidGate     = 0x01
+	sidSync     = 0x02
+	sidRing     = 0x04
+	sidTest     = 0x08
+	sidTriangle = 0x10
+	sidSawtooth = 0x20
+	sidPulse    = 0x40
+	sidNoise    = 0x80
+)
+
+// Cycles between envelope steps for each attack, decay and release setting
+var sidRatePeriods = [16]float64{9, 32, 63, 95, 149, 220, 267, 313, 392, 977, 1954, 3126, 3907, 11720, 19532, 31251}
+
+type sidVoice struct {
+	frequency  int // 16-bit, added to the oscillator every cycle
+	pulseWidth int // 12-bit
+	control    byte
+	attack     int
+	decay      int
+	sustain    int
+	release    int
+
+	phase       float64 // 24-bit oscillator
+	msbRose     bool    // The oscillator's top bit came on this sample, for hard sync
+	noise       uint32  // 23-bit shift register
+	state       int
+	level       int // Envelope from 0 to 255
+	rateCounter float64
+	out         float64 // Last output from -1 to 1, for the scopes
+	gates       int     // Counts the notes started
+}
+
+type sidChip struct {
+	model      int
+	voices     [3]sidVoice
+	cutoff     int  // 11-bit
+	resonance  int  // 0 to 15
+	routing    byte // Voices sent through the filter
+	mode       byte // Filter mode in the top bits, volume in the bottom four
+	sampleRate int
+	cycles     float64 // Per output sample
+
+	// Filter and output stage state
+	low, band   float64
+	dcIn, dcOut float64
+}
+
+func newSIDChip(model, sampleRate int) *sidChip {
+	sid := &sidChip{model: model, sampleRate: sampleRate, cycles: float64(sidClock) / float64(sampleRate)}
+	for i := range sid.voices {
+		sid.voices[i].noise = 0x7ffff8
+		sid.voices[i].state = envelopeRelease
+	}
+	return sid
+}
+
+// Takes a write to one of the 29 registers at $D400
+func (sid *sidChip) write(register int, value byte) {
+	if register < 21 {
+		voice := &sid.voices[register/7]
+		switch register % 7 {
+		case 0:
+			voice.frequency = voice.frequency&0xff00 | int(value)
+		case 1:
+			voice.frequency = voice.frequency&0xff | int(value)<<8
+		case 2:
+			voice.pulseWidth = voice.pulseWidth&0xf00 | int(value)
+		case 3:
+			voice.pulseWidth = voice.pulseWidth&0xff | int(value&0xf)<<8
+		case 4:
+			voice.setControl(value)
+		case 5:
+			voice.attack, voice.decay = int(value>>4), int(value&0xf)
+		case 6:
+			voice.sustain, voice.release = int(value>>4), int(value&0xf)
+		}
+		return
+	}
+	switch register {
+	case 0x15:
+		sid.cutoff = sid.cutoff&0x7f8 | int(value&7)
+	case 0x16:
+		sid.cutoff = sid.cutoff&7 | int(value)<<3
+	case 0x17:
+		sid.resonance, sid.routing = int(value>>4), value&7
+	case 0x18:
+		sid.mode = value
+	}
+}
+
+// Only the third voice's oscillator and envelope can be read back, tunes use them for random numbers
+func (sid *sidChip) read(register int) byte {
+	voice := &sid.voices[2]
+	switch register {
+	case 0x1b:
+		return byte(voice.waveform(&sid.voices[1]) >> 4)
+	case 0x1c:
+		return byte(voice.level)
+	}
+	return 0
+}
+
+func (voice *sidVoice) setControl(value byte) {
+	switch {
+	case value&sidGate != 0 && voice.control&sidGate == 0:
+		voice.state = envelopeAttack
+		voice.gates++
+	case value&sidGate == 0 && voice.control&sidGate != 0:
+		voice.state = envelopeRelease
+	}
+	if value&sidTest != 0 {
+		// The test bit holds the oscillator at zero and clears the noise
+		voice.phase = 0
+		voice.noise = 0x7ffff8
+	}
+	voice.control = value
+}
+
+// Moves the oscillator on by a number of cycles, clocking the noise as its bit 19 comes on
+func (voice *sidVoice) clockOscillator(cycles float64) {
+	voice.msbRose = false
+	if voice.control&sidTest != 0 {
+		return
+	}
+	step := float64(voice.frequency) * cycles
+	next := voice.phase + step
+	for i := phaseCrossings(voice.phase, next, 1<<19, 1<<20); i > 0; i-- {
+		bit := (voice.noise>>22 ^ voice.noise>>17) & 1
+		voice.noise = (voice.noise<<1 | bit) & 0x7fffff
+	}
+	voice.msbRose = phaseCrossings(voice.phase, next, 1<<23, 1<<24) > 0
+	voice.phase = math.Mod(next, 1<<24)
+}
+
+// How many times a value passes offset plus a multiple of period going from start to end
+func phaseCrossings(start, end, offset, period float64) int {
+	return int(math.Floor((end+period-offset)/period) - math.Floor((start+period-offset)/period))
+}
+
+func (voice *sidVoice) clockEnvelope(cycles float64) {
+	voice.rateCounter += cycles
+	for {
+		var period float64
+		switch voice.state {
+		case envelopeAttack:
+			period = sidRatePeriods[voice.attack]
+		case envelopeDecaySustain:
+			period = sidRatePeriods[voice.decay] * exponentialPeriod(voice.level)
+		default:
+			period = sidRatePeriods[voice.release] * exponentialPeriod(voice.level)
+		}
+		if voice.rateCounter < period {
+			return
+		}
+		voice.rateCounter -= period
+		switch voice.state {
+		case envelopeAttack:
+			voice.level++
+			if voice.level >= 255 {
+				voice.level = 255
+				voice.state = envelopeDecaySustain
+			}
+		case envelopeDecaySustain:
+			if voice.level <= voice.sustain*17 {
+				voice.rateCounter = 0
+				return
+			}
+			voice.level--
+		default:
+			if voice.level == 0 {
+				voice.rateCounter = 0
+				return
+			}
+			voice.level--
+		}
+	}
+}
+
+// Decay and release slow down as the level falls, which makes them roughly exponential
+func exponentialPeriod(level int) float64 {
+	switch {
+	case level >= 93:
+		return 1
+	case level >= 54:
+		return 2
+	case level >= 26:
+		return 4
+	case level >= 14:
+		return 8
+	case level >= 6:
+		return 16
+	}
+	return 30
+}
+
+// The 12-bit waveform output, combined waveforms are approximated by ANDing them together
+func (voice *sidVoice) waveform(source *sidVoice) int {
+	if voice.control&0xf0 == 0 {
+		return 0x800
+	}
+	phase := uint32(voice.phase)
+	value := 0xfff
+	if voice.control&sidTriangle != 0 {
+		triangle := phase
+		msb := phase & 0x800000
+		if voice.control&sidRing != 0 {
+			msb ^= uint32(source.phase) & 0x800000
+		}
+		if msb != 0 {
+			triangle ^= 0xffffff
+		}
+		value &= int(triangle>>11) & 0xfff
+	}
+	if voice.control&sidSawtooth != 0 {
+		value &= int(phase >> 12)
+	}
+	if voice.control&sidPulse != 0 && int(phase>>12) < voice.pulseWidth && voice.control&sidTest == 0 {
+		value = 0
+	}
+	if voice.control&sidNoise != 0 {
+		r := voice.noise
+		value &= int(r>>22&1<<11 | r>>20&1<<10 | r>>16&1<<9 | r>>13&1<<8 | r>>11&1<<7 | r>>7&1<<6 | r>>4&1<<5 | r>>2&1<<4)
+	}
+	return value
+}
+
+// Runs the chip for one output sample
+func (sid *sidChip) clock() float64 {
+	for i := range sid.voices {
+		sid.voices[i].clockOscillator(sid.cycles)
+		sid.voices[i].clockEnvelope(sid.cycles)
+	}
+	// Voice 1 is synced and ring modulated by voice 3, voice 2 by voice 1 and voice 3 by voice 2
+	for i := range sid.voices {
+		voice, source := &sid.voices[i], &sid.voices[(i+2)%3]
+		if voice.control&sidSync != 0 && source.msbRose {
+			voice.phase = 0
+		}
+	}
+
+	var direct, filtered float64
+	for i := range sid.voices {
+		voice := &sid.voices[i]
+		value := float64(voice.waveform(&sid.voices[(i+2)%3])-0x800) * float64(voice.level) / 255
+		voice.out = value / 0x800
+		switch {
+		case sid.routing&(1<<i) != 0:
+			filtered += value
+		case i == 2 && sid.mode&0x80 != 0:
+			// Voice 3 can be switched off when it is only used for modulation
+		default:
+			direct += value
+		}
+	}
+	direct += sid.filter(filtered)
+
+	// The 6581 mixer has a DC offset, so changing the volume makes a click, which is how it plays samples
+	dc := 0.0
+	if sid.model == sidModel6581 {
+		dc = 0x600
+	}
+	value := (direct + dc) * float64(sid.mode&0xf) / 15
+
+	// The output capacitor takes the DC away again
+	sid.dcOut = value - sid.dcIn + 0.9995*sid.dcOut
+	sid.dcIn = value
+	return sid.dcOut * sidOutputScale
+}
+
+// A two pole state variable filter, run twice a sample so it stays stable at high cutoffs
+func (sid *sidChip) filter(input float64) float64 {
+	var frequency, q float64
+	position := float64(sid.cutoff) / 2047
+	if sid.model == sidModel6581 {
+		// A rough fit to a typical 6581, the filters vary a lot from chip to chip
+		frequency = 220 + 17800*position*position
+		q = 0.707 + float64(sid.resonance)*0.09
+	} else {
+		frequency = 30 + 12000*position
+		q = 0.707 + float64(sid.resonance)*0.14
+	}
+	damping := 1 / q
+	// The loop only stays stable while f² + 2·f·damping < 4, so high cutoffs are held just under that
+	f := 2 * math.Sin(math.Pi*math.Min(frequency, float64(sid.sampleRate))/float64(sid.sampleRate*2))
+	f = math.Min(f, 0.95*(math.Sqrt(damping*damping+4)-damping))
+
+	var high float64
+	for i := 0; i < 2; i++ {
+		high = input - sid.low - damping*sid.band
+		sid.band += f * high
+		sid.low += f * sid.band
+	}
+	if math.IsNaN(sid.low+sid.band) || math.IsInf(sid.low+sid.band, 0) {
+		sid.low, sid.band, high = 0, 0, 0
+	}
+	var out float64
+	if sid.mode&0x10 != 0 {
+		out += sid.low
+	}
+	if sid.mode&0x20 != 0 {
+		out += sid.band
+	}
+	if sid.mode&0x40 != 0 {
+		out += high
+	}
+	return out
+}
+
+// Names the waveforms a voice is playing, for the scopes
+func (voice *sidVoice) waveformName() string {
+	var names []string
+	for i, name := range []string{"TRIANGLE", "SAW", "PULSE", "NOISE"} {
+		if voice.control&(sidTriangle<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	sidTuneLength = 180.0   // Seconds before a SID tune moves the playlist on, they never end by themselves
+	sidMaxCycles  = 1000000 // A call running longer than this is given up on
+	sidFrameRate  = float64(sidClock) / 19656
+	sidNoteC0     = 16.352 // Hz
+)
+
+// A PSID or RSID file, as found in the High Voltage SID Collection
+type sidTune struct {
+	name, author, released string
+	rsid                   bool // Needs the real C64 environment rather than just init and play calls
+	data                   []byte
+	loadAddress            int
+	initAddress            int
+	playAddress            int // 0 when the tune installs its own interrupt
+	songs, startSong       int
+	speed                  uint32 // A bit per sub-tune, set for CIA timing instead of the vertical blank
+	model                  int
+}
+
+type sidPlayer struct {
+	tune       *sidTune
+	subtune    int // 1 based
+	sampleRate int
+	memory     [0x10000]byte
+	io         [0x1000]byte // What was written to $D000-$DFFF, apart from the SID
+	cpu        cpu6502
+	sid        *sidChip
+	playRate   float64 // Play calls a second
+	untilPlay  float64 // Output frames until the next play call
+	calls      int
+	frames     int
+	waves      [3][scopeFrames]float64
+	scopeIndex int
+}
+
+func isSIDTune(data []byte) bool {
+	return len(data) >= 4 && (string(data[:4]) == "PSID" || string(data[:4]) == "RSID")
+}
+
+func loadSID(data []byte) (*sidTune, error) {
+	if len(data) < 0x76 || !isSIDTune(data) {
+		return nil, fmt.Errorf("not a SID tune")
+	}
+	tune := &sidTune{
+		rsid:        string(data[:4]) == "RSID",
+		name:        modString(data, 0x16, 32),
+		author:      modString(data, 0x36, 32),
+		released:    modString(data, 0x56, 32),
+		loadAddress: int(binary.BigEndian.Uint16(data[8:])),
+		initAddress: int(binary.BigEndian.Uint16(data[0xa:])),
+		playAddress: int(binary.BigEndian.Uint16(data[0xc:])),
+		songs:       int(binary.BigEndian.Uint16(data[0xe:])),
+		startSong:   int(binary.BigEndian.Uint16(data[0x10:])),
+		speed:       binary.BigEndian.Uint32(data[0x12:]),
+		model:       sidModel6581,
+	}
+	version, offset := binary.BigEndian.Uint16(data[4:]), int(binary.BigEndian.Uint16(data[6:]))
+	if version >= 2 && len(data) >= 0x78 && binary.BigEndian.Uint16(data[0x76:])>>4&3 == 2 {
+		tune.model = sidModel8580
+	}
+	if offset > len(data) {
+		return nil, fmt.Errorf("data is missing")
+	}
+	tune.data = data[offset:]
+
+	// A load address of 0 means the data starts with one, the C64 way
+	if tune.loadAddress == 0 {
+		if len(tune.data) < 2 {
+			return nil, fmt.Errorf("data is missing")
+		}
+		tune.loadAddress = int(binary.LittleEndian.Uint16(tune.data))
+		tune.data = tune.data[2:]
+	}
+	if tune.loadAddress+len(tune.data) > 0x10000 {
+		return nil, fmt.Errorf("data runs past the end of memory")
+	}
+	if tune.initAddress == 0 {
+		tune.initAddress = tune.loadAddress
+	}
+	tune.songs = int(math.Max(1, float64(tune.songs)))
+	if tune.startSong < 1 || tune.startSong > tune.songs {
+		tune.startSong = 1
+	}
+	return tune, nil
+}
+
+// Sets up a C64 with the tune loaded and runs its init routine for a sub-tune, 0 for the tune's own choice
+func newSIDPlayer(tune *sidTune, subtune, sampleRate int) *sidPlayer {
+	if subtune < 1 || subtune > tune.songs {
+		subtune = tune.startSong
+	}
+	player := &sidPlayer{tune: tune, subtune: subtune, sampleRate: sampleRate, sid: newSIDChip(tune.model, sampleRate)}
+	player.cpu.read = player.read
+	player.cpu.write = player.write
+
+	// Just enough of the KERNAL's interrupt handler for tunes that hand back to it
+	copy(player.memory[0xea31:], []byte{0x4c, 0x81, 0xea})
+	copy(player.memory[0xea81:], []byte{0x68, 0xa8, 0x68, 0xaa, 0x68, 0x40})
+	player.memory[0x314], player.memory[0x315] = 0x31, 0xea
+	player.memory[1] = 0x37
+	copy(player.memory[tune.loadAddress:], tune.data)
+
+	player.cpu.reset()
+	player.call(uint16(tune.initAddress), byte(subtune-1))
+
+	// The speed bit picks the CIA timer, which the tune may have set, or the 50Hz vertical blank
+	timer := float64(player.io[0xc04]) + float64(player.io[0xc05])*256
+	bit := uint(math.Min(float64(subtune-1), 31))
+	switch {
+	case tune.rsid && player.io[0xc0e]&1 != 0 && timer > 0:
+		player.playRate = sidClock / (timer + 1)
+	case !tune.rsid && tune.speed>>bit&1 != 0:
+		if timer == 0 {
+			timer = 0x4025
+		}
+		player.playRate = sidClock / (timer + 1)
+	default:
+		player.playRate = sidFrameRate
+	}
+	return player
+}
+
+// I/O is seen at $D000 unless the tune banks it out for RAM
+func (player *sidPlayer) ioVisible(address uint16) bool {
+	bank := player.memory[1]
+	return address >= 0xd000 && address < 0xe000 && bank&4 != 0 && bank&3 != 0
+}
+
+func (player *sidPlayer) read(address uint16) byte {
+	if !player.ioVisible(address) {
+		return player.memory[address]
+	}
+	switch {
+	case address >= 0xd400 && address < 0xd800:
+		return player.sid.read(int(address & 0x1f))
+	case address == 0xd012:
+		// The raster line, so loops waiting for it get out
+		return byte(player.cpu.cycles / 63 % 312)
+	case address == 0xd011:
+		return player.io[0x011]&0x7f | byte(player.cpu.cycles/63%312>>8)<<7
+	}
+	return player.io[address-0xd000]
+}
+
+func (player *sidPlayer) write(address uint16, value byte) {
+	if !player.ioVisible(address) {
+		player.memory[address] = value
+		return
+	}
+	if address >= 0xd400 && address < 0xd800 {
+		player.sid.write(int(address&0x1f), value)
+		return
+	}
+	player.io[address-0xd000] = value
+}
+
+// Calls a routine, which RTSes back to $0000 where the run stops
+func (player *sidPlayer) call(address uint16, a byte) {
+	cpu := &player.cpu
+	cpu.a, cpu.x, cpu.y, cpu.sp = a, 0, 0, 0xff
+	cpu.push16(0xffff)
+	if !player.tune.rsid {
+		player.memory[1] = psidBank(address)
+	}
+	cpu.pc = address
+	player.run()
+}
+
+// PSID tunes are called with the ROMs banked out of the way of the routine
+func psidBank(address uint16) byte {
+	switch {
+	case address < 0xa000:
+		return 0x37
+	case address < 0xd000:
+		return 0x36
+	case address < 0xe000:
+		return 0x34
+	}
+	return 0x35
+}
+
+// Takes an interrupt the way the C64 does, through the KERNAL's vector at $0314 when it is banked in
+func (player *sidPlayer) interrupt() {
+	cpu := &player.cpu
+	cpu.sp = 0xff
+	cpu.push16(0)
+	cpu.push(cpu.p &^ flagBreak)
+	cpu.p |= flagInterrupt
+	if player.memory[1]&2 != 0 {
+		cpu.push(cpu.a)
+		cpu.push(cpu.x)
+		cpu.push(cpu.y)
+		cpu.pc = cpu.read16(0x314)
+	} else {
+		cpu.pc = cpu.read16(0xfffe)
+	}
+	player.run()
+}
+
+func (player *sidPlayer) run() {
+	cpu := &player.cpu
+	start := cpu.cycles
+	for cpu.pc != 0 && cpu.cycles-start < sidMaxCycles {
+		if !cpu.step() {
+			return
+		}
+	}
+}
+
+func (player *sidPlayer) play() {
+	if player.tune.playAddress == 0 {
+		player.interrupt()
+	} else {
+		player.call(uint16(player.tune.playAddress), 0)
+	}
+	player.calls++
+}
+
+// Adds the next frames of the tune to out, scaled by gain, in the middle of the stereo
+func (player *sidPlayer) render(out [][2]float64, gain float64) {
+	for i := range out {
+		if player.untilPlay <= 0 {
+			player.play()
+			player.untilPlay += float64(player.sampleRate) / player.playRate
+		}
+		player.untilPlay--
+		value := player.sid.clock() * gain
+		out[i][0] += value
+		out[i][1] += value
+		for v := range player.waves {
+			player.waves[v][player.scopeIndex] = player.sid.voices[v].out
+		}
+		player.scopeIndex = (player.scopeIndex + 1) % scopeFrames
+		player.frames++
+	}
+}
+
+func (player *sidPlayer) ended() bool {
+	return float64(player.frames) >= sidTuneLength*float64(player.sampleRate)
+}
+
+// Play calls stand in for ticks, with a row every six of them like a tracker at its default speed
+func (player *sidPlayer) state() modState {
+	state := modState{
+		order: player.calls / (6 * modRows),
+		row:   player.calls / 6 % modRows,
+		speed: 6,
+		tempo: int(math.Round(player.playRate * 2.5)),
+	}
+	state.pattern = state.order
+	for _, voice := range player.sid.voices {
+		channel := modChannelState{
+			period:     voice.frequency,
+			instrument: int(voice.control >> 4),
+			volume:     voice.level * modMaxVolume / 255,
+			notes:      voice.gates,
+		}
+		if voice.level > 0 && voice.frequency > 0 {
+			hz := float64(voice.frequency) * sidClock / (1 << 24)
+			if note := int(math.Round(12*math.Log2(hz/sidNoteC0))) + 1; note >= 1 && note <= 120 {
+				channel.note = fmt.Sprintf("%s%d", modNoteNames[(note-1)%12], (note-1)/12)
+			}
+		}
+		state.channels = append(state.channels, channel)
+	}
+	return state
+}
+
+func (player *sidPlayer) scopes() ([][]float64, []string) {
+	waves := make([][]float64, len(player.waves))
+	names := make([]string, len(player.waves))
+	for i := range player.waves {
+		waves[i] = make([]float64, scopeFrames)
+		for j := range waves[i] {
+			waves[i][j] = player.waves[i][(player.scopeIndex+j)%scopeFrames]
+		}
+		names[i] = player.sid.voices[i].waveformName()
+	}
+	return waves, names
+}
+
+// e.g. "COMIC BAKERY (2 OF 5)"
+func (tune *sidTune) title(subtune int) string {
+	title := tune.name
+	if tune.songs > 1 {
+		title += fmt.Sprintf(" (%d OF %d)", subtune, tune.songs)
+	}
+	return title
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/veandco/go-sdl2/mix"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/rand"
+	"os"
+)
+
+const (
+	soundChannels = 16 // Mixer channels for effects, so they play over the music and each other
+	soundRate     = 44100
+)
+
+var (
+	// Effects by name as mono samples from -1 to 1, played with playSound and from the sync rules
+	soundSamples = map[string][]float64{}
+	soundEffects = map[string]*mix.Chunk{}
+)
+
+// Synthesises the built in effects, the drive sound comes from the floppy drive
+func buildSoundEffects() {
+	soundSamples["thud"] = synthThud()
+	soundSamples["blip"] = synthBlip()
+	soundSamples["whoosh"] = synthWhoosh()
+}
+
+// Loads every effect into the mixer, call once the audio is open
+func setupSoundEffects() error {
+	mix.AllocateChannels(soundChannels)
+	for name, samples := range soundSamples {
+		chunk, err := chunkFromSamples(samples)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		registerSound(name, chunk)
+	}
+	return nil
+}
+
+func registerSound(name string, chunk *mix.Chunk) {
+	if old := soundEffects[name]; old != nil {
+		old.Free()
+	}
+	soundEffects[name] = chunk
+}
+
+// Plays an effect on a free channel at a volume from 0 to 1, unknown names are ignored
+func playSound(name string, volume float64) {
+	if exporting {
+		exportSound(name, volume)
+		return
+	}
+	chunk := soundEffects[name]
+	if chunk == nil {
+		return
+	}
+	// Takes over the oldest effect when every channel is busy
+	channel := mix.GroupAvailable(-1)
+	if channel < 0 {
+		channel = mix.GroupOldest(-1)
+	}
+	mix.Volume(channel, int(math.Max(0, math.Min(volume, 1))*float64(mix.MAX_VOLUME)))
+	if _, err := chunk.Play(channel, 0); err != nil && debug {
+		fmt.Fprintf(os.Stderr, "Sound %q: %s\n", name, err)
+	}
+}
+
+// Wraps mono samples from -1 to 1 in a WAV file for the mixer to load
+func chunkFromSamples(samples []float64) (*mix.Chunk, error) {
+	data := append(wavHeader(1, len(samples)*2), make([]byte, len(samples)*2)...)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[44+i*2:], uint16(clampSample(sample*32767)))
+	}
+	rwops, err := sdl.RWFromMem(data)
+	if err != nil {
+		return nil, err
+	}
+	return mix.LoadWAVRW(rwops, true)
+}
+
+// The 44 byte header of a 16-bit PCM WAV file at the sound rate
+func wavHeader(channels, dataSize int) []byte {
+	header := make([]byte, 44)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], soundRate)
+	binary.LittleEndian.PutUint32(header[28:], uint32(soundRate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+	return header
+}
+
+// A low thump that drops in pitch, with a click at the start for the impact
+func synthThud() []float64 {
+	samples := make([]float64, soundRate*35/100)
+	phase, click := 0.0, 0.0
+	for i := range samples {
+		t := float64(i) / soundRate
+		phase += 2 * math.Pi * (45 + 50*math.Exp(-t*20)) / soundRate
+		click += 0.3 * (rand.Float64()*2 - 1 - click)
+		samples[i] = 0.8*math.Sin(phase)*math.Exp(-t*12) + 0.2*click*math.Exp(-t*300)
+	}
+	return samples
+}
+
+// A short square wave beep for key presses
+func synthBlip() []float64 {
+	samples := make([]float64, soundRate*6/100)
+	for i := range samples {
+		t := float64(i) / soundRate
+		square := 1.0
+		if math.Mod(t*1200, 1) >= 0.5 {
+			square = -1
+		}
+		samples[i] = 0.3 * square * math.Exp(-t*60)
+	}
+	return samples
+}
+
+// Noise through a low-pass that opens and closes again, for the quit fade
+func synthWhoosh() []float64 {
+	const length = 1.6
+	samples := make([]float64, int(soundRate*length))
+	low := 0.0
+	for i := range samples {
+		t := float64(i) / soundRate
+		swell := math.Sin(math.Pi * t / length)
+		cutoff := 200 + 3800*swell*swell
+		low += (1 - math.Exp(-2*math.Pi*cutoff/soundRate)) * (rand.Float64()*2 - 1 - low)
+		samples[i] = 1.5 * low * swell
+	}
+	return samples
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	starfieldWarp = iota
+	starfieldParallax
+	starfieldSpiral
+	starfieldTunnel
+	starfieldHyperspace
+
+	parallaxLayers     = 3
+	spiralArms         = 2
+	spiralTilt         = 1.1 // Radians the galaxy plane is tipped towards the viewer
+	hyperspaceDuration = 2 * time.Second
+	hyperspaceFlash    = 500 * time.Millisecond
+	starSpriteSize     = 16
+	trailSegments      = 6 // Segments per trail when the fade is curved
+
+	// Sizes in world units, where the object is two units across
+	starDepth      = 12.0 // How far ahead of the camera warp stars reach
+	starBehind     = -3.0 // How far behind the camera they wrap around
+	tunnelDepth    = 24.0
+	galaxyDistance = 6.0
+	galaxyRadius   = 3.0
+)
+
+const (
+	starColorWhite = iota
+	starColorTemperature
+	starColorDepth
+	starColorPalette
+)
+
+// Warp stars live in world space. The spiral and tunnel modes reuse x and y
+// as radius and angle, and parallax stars are in screen space.
+type Star struct {
+	x, y, z, speed float64 // Speed is in units per 60 Hz frame
+	color          sdl.Color
+	twinkle        float64 // Phase of the twinkle so stars don't pulse in step
+}
+
+var (
+	stars                []Star
+	starfieldMode        = starfieldWarp
+	starfieldModeStart   time.Time
+	hyperspaceReturnMode = starfieldWarp
+	hyperspaceFlashStart time.Time
+
+	// Trails show where each star was this many seconds ago, faded by the curve exponent
+	trailTime  = 5.0 / FPS
+	trailCurve = 1.0
+
+	// Star colour variables
+	starColorMode = starColorTemperature
+	starPalette   []sdl.Color
+	starTwinkle   = true
+	starTexture   *sdl.Texture
+	starFar       = sdl.Color{R: 40, G: 60, B: 190, A: 255} // Depth colouring fades from here to white
+	starClasses   = []struct {
+		color  sdl.Color
+		weight float64
+	}{
+		{sdl.Color{R: 155, G: 176, B: 255, A: 255}, 0.03}, // O
+		{sdl.Color{R: 170, G: 191, B: 255, A: 255}, 0.10}, // B
+		{sdl.Color{R: 202, G: 215, B: 255, A: 255}, 0.15}, // A
+		{sdl.Color{R: 248, G: 247, B: 255, A: 255}, 0.20}, // F
+		{sdl.Color{R: 255, G: 244, B: 234, A: 255}, 0.20}, // G
+		{sdl.Color{R: 255, G: 210, B: 161, A: 255}, 0.17}, // K
+		{sdl.Color{R: 255, G: 204, B: 111, A: 255}, 0.15}, // M
+	}
+)
+
+func initStars() error {
+	// A soft white disc, tinted per star when drawn
+	pixels := make([]uint32, starSpriteSize*starSpriteSize)
+	radius := float64(starSpriteSize) / 2
+	for y := 0; y < starSpriteSize; y++ {
+		for x := 0; x < starSpriteSize; x++ {
+			d := math.Hypot(float64(x)+0.5-radius, float64(y)+0.5-radius) / radius
+			alpha := math.Max(0, 1-d*d)
+			pixels[y*starSpriteSize+x] = uint32(255*alpha)<<24 | 0xffffff
+		}
+	}
+	var err error
+	starTexture, err = createTextureFromPixels(pixels, starSpriteSize, starSpriteSize)
+	if err != nil {
+		return err
+	}
+	if err := starTexture.SetBlendMode(sdl.BLENDMODE_ADD); err != nil {
+		return err
+	}
+
+	setStarfieldMode(starfieldMode)
+	return nil
+}
+
+// Accepts white, temperature, depth or a comma separated list of RRGGBB colours
+func parseStarColors(arg string) error {
+	switch arg {
+	case "white":
+		starColorMode = starColorWhite
+	case "temperature":
+		starColorMode = starColorTemperature
+	case "depth":
+		starColorMode = starColorDepth
+	default:
+		var palette []sdl.Color
+		for _, hex := range strings.Split(arg, ",") {
+			rgb, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(hex), "#"), 16, 24)
+			if err != nil {
+				return fmt.Errorf("bad star colour %q: %v", hex, err)
+			}
+			palette = append(palette, sdl.Color{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255})
+		}
+		starPalette = palette
+		starColorMode = starColorPalette
+	}
+	return nil
+}
+
+func cycleStarColorMode() {
+	starColorMode = (starColorMode + 1) % (starColorPalette + 1)
+	if starColorMode == starColorPalette && len(starPalette) == 0 {
+		starColorMode = starColorWhite
+	}
+	for i := range stars {
+		stars[i].color = newStarColor()
+	}
+}
+
+func newStarColor() sdl.Color {
+	switch starColorMode {
+	case starColorTemperature:
+		pick := rand.Float64()
+		for _, class := range starClasses {
+			if pick < class.weight {
+				return class.color
+			}
+			pick -= class.weight
+		}
+		return starClasses[len(starClasses)-1].color
+	case starColorPalette:
+		return starPalette[rand.Intn(len(starPalette))]
+	}
+	return sdl.Color{R: 255, G: 255, B: 255, A: 255}
+}
+
+// Nearness runs from 0 for the furthest stars to 1 for the closest
+func starColor(star *Star, nearness float64) sdl.Color {
+	nearness = math.Max(0, math.Min(1, nearness))
+	color := star.color
+	if starColorMode == starColorDepth {
+		color = lerpColor(starFar, sdl.Color{R: 255, G: 255, B: 255, A: 255}, nearness)
+	}
+	brightness := 0.2 + 0.8*nearness
+	if starTwinkle {
+		// Distant stars twinkle more, like they do through the atmosphere
+		brightness *= 1 - 0.4*(1-nearness)*(0.5+0.5*math.Sin(time.Since(startTime).Seconds()*7+star.twinkle))
+	}
+	return fadeColor(color, brightness)
+}
+
+func lerpColor(a, b sdl.Color, t float64) sdl.Color {
+	return sdl.Color{
+		R: uint8(float64(a.R) + (float64(b.R)-float64(a.R))*t),
+		G: uint8(float64(a.G) + (float64(b.G)-float64(a.G))*t),
+		B: uint8(float64(a.B) + (float64(b.B)-float64(a.B))*t),
+		A: uint8(float64(a.A) + (float64(b.A)-float64(a.A))*t),
+	}
+}
+
+func fadeColor(c sdl.Color, brightness float64) sdl.Color {
+	return sdl.Color{R: uint8(float64(c.R) * brightness), G: uint8(float64(c.G) * brightness), B: uint8(float64(c.B) * brightness), A: c.A}
+}
+
+// Close stars grow into small discs, the rest stay single pixels
+func drawStar(x, y float32, nearness float64, color sdl.Color) {
+	nearness = math.Max(0, math.Min(1, nearness))
+	size := float32(nearness * nearness * float64(windowHeight) / 240)
+	if size < 1.5 {
+		batchPoint(x, y, color)
+		return
+	}
+	batchSprite(starTexture, x, y, size*1.5, color)
+}
+
+func setStarfieldMode(mode int) {
+	starfieldMode = mode
+	starfieldModeStart = time.Now()
+	if mode == starfieldHyperspace {
+		// Jump from the stars already on screen
+		return
+	}
+	stars = stars[:0]
+	for i := 0; i < numStars; i++ {
+		stars = append(stars, newStar(mode, true))
+	}
+}
+
+func cycleStarfieldMode() {
+	if starfieldMode == starfieldHyperspace {
+		return
+	}
+	// Hyperspace is a transition rather than a mode of its own
+	setStarfieldMode((starfieldMode + 1) % starfieldHyperspace)
+}
+
+func hyperspaceJump() {
+	if starfieldMode == starfieldHyperspace {
+		return
+	}
+	// The jump always streaks out of a warp field, then drops back into the current mode
+	hyperspaceReturnMode = starfieldMode
+	if starfieldMode != starfieldWarp {
+		setStarfieldMode(starfieldWarp)
+	}
+	setStarfieldMode(starfieldHyperspace)
+}
+
+func newStar(mode int, scatter bool) Star {
+	star := Star{color: newStarColor(), twinkle: rand.Float64() * 2 * math.Pi}
+	switch mode {
+	case starfieldParallax:
+		// Speed picks the layer, x and y are in screen space
+		layer := rand.Intn(parallaxLayers) + 1
+		star.x = rand.Float64() * float64(windowWidth)
+		if !scatter {
+			star.x = float64(windowWidth)
+		}
+		star.y = rand.Float64() * float64(windowHeight)
+		star.z = float64(layer)
+		star.speed = float64(layer*layer) + rand.Float64()
+	case starfieldSpiral:
+		// Scatter the stars around logarithmic spiral arms
+		radius := math.Pow(rand.Float64(), 1.5)
+		arm := float64(rand.Intn(spiralArms)) * 2 * math.Pi / spiralArms
+		star.x = radius
+		star.y = arm + 2.5*math.Log(radius+0.05) + rand.NormFloat64()*0.3
+		star.z = rand.NormFloat64() * 0.04 * (1 - radius)
+		star.speed = 0.004 / (radius + 0.15)
+	case starfieldTunnel:
+		// Camera space, the tunnel follows the camera wherever it goes
+		star.x = rand.Float64() * 2 * math.Pi
+		star.z = tunnelDepth * (0.25 + rand.Float64()*0.75)
+		if scatter {
+			star.z = cameraNear + rand.Float64()*(tunnelDepth-cameraNear)
+		}
+		star.speed = 0.18 + rand.Float64()*0.12
+	default:
+		// World space, anywhere in the box around the camera
+		aspect := float64(windowWidth) / float64(windowHeight)
+		star.x = camera.position.x + (rand.Float64()*2-1)*starDepth*aspect
+		star.y = camera.position.y + (rand.Float64()*2-1)*starDepth
+		star.z = camera.position.z + starBehind + rand.Float64()*(starDepth-starBehind)
+		star.speed = (rand.Float64()*0.05 + 0.01) * starDepth
+	}
+	return star
+}
+
+// How far a star moves along its path in the trail time
+func trailDistance(star *Star) float64 {
+	return star.speed * FPS * trailTime
+}
+
+// Draws from the transparent tail to the head, split up when the fade is curved
+func drawStarTrail(tailX, tailY, headX, headY float32, color sdl.Color) {
+	segments := trailSegments
+	if trailCurve == 1 {
+		segments = 1
+	}
+	for i := 0; i < segments; i++ {
+		t0 := float32(i) / float32(segments)
+		t1 := float32(i+1) / float32(segments)
+		c0, c1 := color, color
+		c0.A = uint8(float64(color.A) * math.Pow(float64(t0), trailCurve))
+		c1.A = uint8(float64(color.A) * math.Pow(float64(t1), trailCurve))
+		batchLine(
+			tailX+(headX-tailX)*t0, tailY+(headY-tailY)*t0,
+			tailX+(headX-tailX)*t1, tailY+(headY-tailY)*t1,
+			c0, c1,
+		)
+	}
+}
+
+func updateStarfield() {
+	steps := deltaTime * FPS * (1 + syncStarBoost)
+	switch starfieldMode {
+	case starfieldParallax:
+		for i := range stars {
+			stars[i].x -= stars[i].speed * steps
+			if stars[i].x < 0 {
+				stars[i] = newStar(starfieldParallax, false)
+			}
+		}
+	case starfieldSpiral:
+		// Inner stars orbit faster, which keeps winding the arms
+		for i := range stars {
+			stars[i].y += stars[i].speed * steps
+		}
+	case starfieldTunnel:
+		for i := range stars {
+			stars[i].z -= stars[i].speed * steps
+			if stars[i].z <= tunnelDepth*0.0125 {
+				stars[i] = newStar(starfieldTunnel, false)
+			}
+		}
+	case starfieldHyperspace:
+		progress := hyperspaceProgress()
+		updateWarpStars(steps * (1 + 20*progress*progress))
+		if progress >= 1 {
+			// Arrive in the next part of the show
+			hyperspaceFlashStart = time.Now()
+			cycleObjectEffect(1)
+			setStarfieldMode(hyperspaceReturnMode)
+		}
+	default:
+		updateWarpStars(steps)
+	}
+}
+
+func updateWarpStars(steps float64) {
+	// Stars fly towards -z and wrap around inside a box that moves with the camera
+	aspect := float64(windowWidth) / float64(windowHeight)
+	for i := range stars {
+		stars[i].z -= stars[i].speed * steps
+		stars[i].x, _ = wrapStar(stars[i].x, camera.position.x-starDepth*aspect, 2*starDepth*aspect)
+		stars[i].y, _ = wrapStar(stars[i].y, camera.position.y-starDepth, 2*starDepth)
+		z, wrapped := wrapStar(stars[i].z, camera.position.z+starBehind, starDepth-starBehind)
+		if wrapped {
+			// Re-roll so the same pattern doesn't keep coming back
+			stars[i] = newStar(starfieldWarp, true)
+			stars[i].z = z
+		}
+	}
+}
+
+func wrapStar(v, min, span float64) (float64, bool) {
+	wrapped := false
+	for v < min {
+		v += span
+		wrapped = true
+	}
+	for v >= min+span {
+		v -= span
+		wrapped = true
+	}
+	return v, wrapped
+}
+
+func hyperspaceProgress() float64 {
+	return math.Min(1, float64(time.Since(starfieldModeStart))/float64(hyperspaceDuration))
+}
+
+// Stars nearer the camera than the object centre go in front of it
+func drawStarfield() {
+	drawStars(false)
+}
+
+func drawStarfieldFront() {
+	drawStars(true)
+	drawHyperspaceFlash()
+}
+
+func drawStars(front bool) {
+	// Trails fade with real alpha
+	var previous sdl.BlendMode
+	err := renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return
+	}
+	defer renderer.SetDrawBlendMode(previous)
+
+	threshold := objectDepth()
+	switch starfieldMode {
+	case starfieldParallax:
+		if !front {
+			drawParallaxStars()
+		}
+	case starfieldSpiral:
+		drawSpiralStars(front, threshold)
+	case starfieldTunnel:
+		drawTunnelStars(front, threshold)
+	case starfieldHyperspace:
+		progress := hyperspaceProgress()
+		drawWarpStars(front, threshold, 0.02+2*progress*progress)
+	default:
+		drawWarpStars(front, threshold, 0)
+	}
+	flushBatch()
+}
+
+// A streak of zero means normal trails
+func drawWarpStars(front bool, threshold, streak float64) {
+	farZ := camera.position.z + starDepth
+	for i := range stars {
+		head := projectWorld(Point3D{stars[i].x, stars[i].y, stars[i].z})
+		if head.z <= cameraNear || (head.z < threshold) != front {
+			continue
+		}
+
+		// The tail never reaches back past the far wall, where stars come in
+		tailZ := math.Min(stars[i].z+trailDistance(&stars[i]), farZ)
+		if streak > 0 {
+			tailZ = stars[i].z + streak*starDepth
+		}
+		tail := projectWorld(Point3D{stars[i].x, stars[i].y, tailZ})
+
+		nearness := 1 - head.z/starDepth
+		color := starColor(&stars[i], nearness)
+		if streak > 0 {
+			color = stars[i].color
+		}
+		if tail.z > cameraNear {
+			drawStarTrail(float32(tail.x), float32(tail.y), float32(head.x), float32(head.y), color)
+		}
+		drawStar(float32(head.x), float32(head.y), nearness, color)
+	}
+}
+
+func drawParallaxStars() {
+	for i := range stars {
+		// Nearer layers are brighter and leave longer streaks
+		nearness := (stars[i].z - 1) / (parallaxLayers - 1)
+		color := starColor(&stars[i], nearness)
+		x, y := float32(stars[i].x), float32(stars[i].y)
+		if stars[i].z > 1 {
+			drawStarTrail(x+float32(trailDistance(&stars[i])), y, x, y, color)
+		}
+		drawStar(x, y, nearness*0.7, color)
+	}
+}
+
+func drawSpiralStars(front bool, threshold float64) {
+	// The galaxy sits in the world far behind the object
+	cosT, sinT := math.Cos(spiralTilt), math.Sin(spiralTilt)
+	project := func(radius, angle, height float64) Point3D {
+		x := radius * math.Cos(angle)
+		y := radius*math.Sin(angle)*cosT - height*sinT
+		z := radius*math.Sin(angle)*sinT + height*cosT
+		return projectWorld(Point3D{x * galaxyRadius, y * galaxyRadius, galaxyDistance + z*galaxyRadius})
+	}
+
+	for i := range stars {
+		// The core is brighter than the outer arms
+		radius, angle := stars[i].x, stars[i].y
+		head := project(radius, angle, stars[i].z)
+		if head.z <= cameraNear || (head.z < threshold) != front {
+			continue
+		}
+		color := starColor(&stars[i], 1-radius*0.8)
+		tail := project(radius, angle-trailDistance(&stars[i]), stars[i].z)
+		drawStarTrail(float32(tail.x), float32(tail.y), float32(head.x), float32(head.y), color)
+	}
+}
+
+func drawTunnelStars(front bool, threshold float64) {
+	// The tunnel bends away from the camera, further stars swing out more
+	elapsed := time.Since(startTime).Seconds()
+	project := func(angle, z float64) Point3D {
+		bendX := 0.015 * z * z * math.Sin(elapsed*0.7+z*0.13)
+		bendY := 0.01 * z * z * math.Cos(elapsed*0.5+z*0.1)
+		return projectCameraSpace(Point3D{math.Cos(angle) + bendX, math.Sin(angle) + bendY, z})
+	}
+
+	for i := range stars {
+		if (stars[i].z < threshold) != front {
+			continue
+		}
+		nearness := 1 - stars[i].z/tunnelDepth
+		color := starColor(&stars[i], nearness)
+		head := project(stars[i].x, stars[i].z)
+		tail := project(stars[i].x, math.Min(stars[i].z+trailDistance(&stars[i]), tunnelDepth))
+		drawStarTrail(float32(tail.x), float32(tail.y), float32(head.x), float32(head.y), color)
+		drawStar(float32(head.x), float32(head.y), nearness, color)
+	}
+}
+
+func drawHyperspaceFlash() {
+	since := time.Since(hyperspaceFlashStart)
+	if since >= hyperspaceFlash {
+		return
+	}
+	var previous sdl.BlendMode
+	err := renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawColor(255, 255, 255, uint8(255*(1-float64(since)/float64(hyperspaceFlash))))
+	if err != nil {
+		return
+	}
+	err = renderer.FillRect(&sdl.Rect{X: 0, Y: 0, W: windowWidth, H: windowHeight})
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawBlendMode(previous)
+	if err != nil {
+		return
+	}
+}
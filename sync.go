@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	syncNote    = iota // A new note starts
+	syncRow            // A row is reached, for effect command triggers
+	syncPattern        // The song moves to a new pattern
+	syncVolume         // Follows the channel volume every frame
+	syncLevel          // Follows the peak level of the mixed output every frame
+)
+
+const syncDecay = 6.0 // How fast kicks die away, per second
+
+// Matches music events to visual actions, a zero channel or instrument and a negative effect match anything
+type syncRule struct {
+	trigger    int
+	channel    int // 1 based
+	instrument int
+	effect     int
+	action     string
+	amount     float64
+}
+
+var (
+	// Rules for the Comic Bakery tune, replaced with "-sync file"
+	syncRules = []syncRule{
+		{syncNote, 1, 9, -1, "flash", 0.5},
+		{syncNote, 1, 5, -1, "shake", 6},
+		{syncNote, 3, 3, -1, "stars", 3},
+		{syncVolume, 2, 0, -1, "bars", 0.6},
+		{syncPattern, 0, 0, -1, "spin", 4},
+	}
+	syncTriggers = map[string]int{"note": syncNote, "row": syncRow, "pattern": syncPattern, "volume": syncVolume, "level": syncLevel}
+	syncActions  = map[string]bool{"flash": true, "shake": true, "stars": true, "bars": true, "spin": true}
+	// One-off events on the timeline, the amount is ignored
+	syncEvents = map[string]func(){
+		"logoenter": func() {
+			if !logoShown {
+				logoEnter()
+			}
+		},
+		"logoexit": func() {
+			if logoShown {
+				logoExit()
+			}
+		},
+		"wobble":  logoWobble,
+		"stretch": logoStretch,
+		"melt":    logoMelt,
+		"shine":   logoShine,
+	}
+	syncFile     string
+	syncPrevious modState
+
+	// Effect parameters driven by the rules
+	syncFlash     float64 // Alpha of a white flash, 0 to 1
+	syncShake     float64 // Pixels
+	syncStarBoost float64 // Extra starfield speed, 1 doubles it
+	syncSpin      float64 // Extra cube spin, 1 doubles it
+)
+
+func setupSync() error {
+	if syncFile == "" {
+		return nil
+	}
+	rules, err := loadSyncRules(syncFile)
+	if err != nil {
+		return err
+	}
+	syncRules = rules
+	return nil
+}
+
+// One rule per line: trigger channel instrument effect action amount, with * for any
+// e.g. "note 2 6 * flash 0.5" or "row * * d spin 2"
+func loadSyncRules(path string) ([]syncRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []syncRule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule, err := parseSyncRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseSyncRule(fields []string) (syncRule, error) {
+	var rule syncRule
+	if len(fields) != 6 {
+		return rule, fmt.Errorf("want trigger channel instrument effect action amount")
+	}
+	trigger, ok := syncTriggers[fields[0]]
+	if !ok {
+		return rule, fmt.Errorf("unknown trigger %q", fields[0])
+	}
+	rule.trigger = trigger
+
+	parseField := func(field string, base int, none int) (int, error) {
+		if field == "*" {
+			return none, nil
+		}
+		n, err := strconv.ParseInt(field, base, 32)
+		if err != nil {
+			return 0, fmt.Errorf("bad number %q", field)
+		}
+		return int(n), nil
+	}
+	var err error
+	if rule.channel, err = parseField(fields[1], 10, 0); err != nil {
+		return rule, err
+	}
+	if rule.instrument, err = parseField(fields[2], 10, 0); err != nil {
+		return rule, err
+	}
+	// Effect commands are hex digits, as in a tracker
+	if rule.effect, err = parseField(fields[3], 16, -1); err != nil {
+		return rule, err
+	}
+	// Any sound effect can be an action too, played at the amount as its volume
+	_, sound := soundSamples[fields[4]]
+	_, event := syncEvents[fields[4]]
+	if !syncActions[fields[4]] && !sound && !event {
+		return rule, fmt.Errorf("unknown action %q", fields[4])
+	}
+	if (sound || event) && (rule.trigger == syncVolume || rule.trigger == syncLevel) {
+		return rule, fmt.Errorf("%s needs a note, row or pattern trigger", fields[4])
+	}
+	rule.action = fields[4]
+	if rule.amount, err = strconv.ParseFloat(fields[5], 64); err != nil {
+		return rule, fmt.Errorf("bad amount %q", fields[5])
+	}
+	return rule, nil
+}
+
+// Checks the rules against what the music did since the last frame
+func updateSync() {
+	decay := math.Exp(-syncDecay * deltaTime)
+	syncFlash *= decay
+	syncShake *= decay
+	syncStarBoost *= decay
+	syncSpin *= decay
+	barBrightness = 1
+
+	state := musicState()
+	newRow := state.order != syncPrevious.order || state.row != syncPrevious.row
+	newPattern := state.order != syncPrevious.order
+	for _, rule := range syncRules {
+		if rule.trigger == syncPattern {
+			if newPattern {
+				applySync(rule, 1)
+			}
+			continue
+		}
+		if rule.trigger == syncLevel {
+			applySync(rule, math.Max(analysis.peak[0], analysis.peak[1]))
+			continue
+		}
+		for i, channel := range state.channels {
+			if rule.channel != 0 && rule.channel != i+1 {
+				continue
+			}
+			if rule.instrument != 0 && rule.instrument != channel.instrument {
+				continue
+			}
+			if rule.effect >= 0 && rule.effect != channel.effect {
+				continue
+			}
+			switch rule.trigger {
+			case syncNote:
+				if i < len(syncPrevious.channels) && channel.notes != syncPrevious.channels[i].notes {
+					applySync(rule, 1)
+				}
+			case syncRow:
+				if newRow {
+					applySync(rule, 1)
+				}
+			case syncVolume:
+				applySync(rule, float64(channel.volume)/modMaxVolume)
+			}
+		}
+	}
+	syncPrevious = state
+}
+
+func applySync(rule syncRule, level float64) {
+	switch rule.action {
+	case "flash":
+		syncFlash = math.Max(syncFlash, math.Min(rule.amount*level, 1))
+	case "shake":
+		syncShake = math.Max(syncShake, rule.amount*level)
+	case "stars":
+		syncStarBoost = math.Max(syncStarBoost, rule.amount*level)
+	case "spin":
+		syncSpin = math.Max(syncSpin, rule.amount*level)
+	case "bars":
+		// Dims the bars when the channel is quiet
+		barBrightness = math.Min(barBrightness, 1-rule.amount+rule.amount*level)
+	default:
+		if event, ok := syncEvents[rule.action]; ok {
+			event()
+			return
+		}
+		playSound(rule.action, rule.amount*level)
+	}
+}
+
+// Moves the whole picture for a screen shake, call before drawing the frame
+func beginSyncShake() {
+	if syncShake < 0.5 {
+		return
+	}
+	dx := int32((rand.Float64()*2 - 1) * syncShake)
+	dy := int32((rand.Float64()*2 - 1) * syncShake)
+	err := renderer.SetViewport(&sdl.Rect{X: dx, Y: dy, W: windowWidth, H: windowHeight})
+	if err != nil {
+		return
+	}
+}
+
+// Draws the flash and puts the viewport back, call before presenting
+func endSync() {
+	err := renderer.SetViewport(nil)
+	if err != nil {
+		return
+	}
+	if syncFlash < 1.0/255 {
+		return
+	}
+	var previous sdl.BlendMode
+	err = renderer.GetDrawBlendMode(&previous)
+	if err != nil {
+		return
+	}
+	defer renderer.SetDrawBlendMode(previous)
+	err = renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	if err != nil {
+		return
+	}
+	err = renderer.SetDrawColor(255, 255, 255, uint8(255*syncFlash))
+	if err != nil {
+		return
+	}
+	err = renderer.FillRect(nil)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"image/png"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	numBallPoints = 240
+	ballSize      = 32  // Size of the pre-rendered ball sprite
+	morphHold     = 3.0 // Seconds each shape is held
+	morphTime     = 2.0 // Seconds spent morphing to the next shape
+)
+
+type projectedBall struct {
+	x, y, z float64
+}
+
+var (
+	ballTexture *sdl.Texture
+	ballShapes  [][]Point3D
+	ballText    = "INTUITION"
+	objFile     string
+)
+
+func setupVectorBalls() error {
+	var err error
+	ballTexture, err = createBallTexture()
+	if err != nil {
+		return err
+	}
+
+	ballShapes = [][]Point3D{
+		normalizeShape(cubeShape()),
+		normalizeShape(sphereShape()),
+		normalizeShape(torusShape()),
+	}
+	text, err := textShape(ballText)
+	if err != nil {
+		return err
+	}
+	ballShapes = append(ballShapes, normalizeShape(text))
+
+	if objFile != "" {
+		mesh, err := loadObjShape(objFile)
+		if err != nil {
+			// A broken mesh shouldn't stop the intro, just leave it out
+			fmt.Fprintf(os.Stderr, "Failed to load OBJ mesh: %s\n", err)
+		} else {
+			ballShapes = append(ballShapes, normalizeShape(mesh))
+		}
+	}
+	return nil
+}
+
+func createBallTexture() (*sdl.Texture, error) {
+	pixels := make([]uint32, ballSize*ballSize)
+	radius := float64(ballSize) / 2
+	for y := 0; y < ballSize; y++ {
+		for x := 0; x < ballSize; x++ {
+			dx := (float64(x) + 0.5 - radius) / radius
+			dy := (float64(y) + 0.5 - radius) / radius
+			d := math.Sqrt(dx*dx + dy*dy)
+			if d > 1 {
+				continue
+			}
+			// Diffuse shading with a specular highlight towards the top left
+			nz := math.Sqrt(1 - d*d)
+			diffuse := math.Max(0, -0.4*dx-0.4*dy+0.8*nz)
+			specular := math.Pow(diffuse, 20)
+			r := math.Min(255, 40+180*diffuse+255*specular)
+			g := math.Min(255, 60+150*diffuse+255*specular)
+			b := math.Min(255, 120+135*diffuse+255*specular)
+			alpha := math.Min(1, (1-d)*radius) * 255 // Anti-alias the rim
+			pixels[y*ballSize+x] = uint32(alpha)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+		}
+	}
+	return createTextureFromPixels(pixels, ballSize, ballSize)
+}
+
+func cubeShape() []Point3D {
+	// Points spread along the twelve edges of the cube
+	var points []Point3D
+	perEdge := numBallPoints / len(cubeEdges)
+	for _, edge := range cubeEdges {
+		a, b := cubeVertices[edge.start], cubeVertices[edge.end]
+		for i := 0; i < perEdge; i++ {
+			t := (float64(i) + 0.5) / float64(perEdge)
+			points = append(points, lerpPoint(a, b, t))
+		}
+	}
+	return points
+}
+
+func sphereShape() []Point3D {
+	// Fibonacci sphere for an even spread of points
+	points := make([]Point3D, numBallPoints)
+	golden := math.Pi * (3 - math.Sqrt(5))
+	for i := range points {
+		y := 1 - 2*(float64(i)+0.5)/numBallPoints
+		r := math.Sqrt(1 - y*y)
+		a := golden * float64(i)
+		points[i] = Point3D{r * math.Cos(a), y, r * math.Sin(a)}
+	}
+	return points
+}
+
+func torusShape() []Point3D {
+	const rings, segments = 24, numBallPoints / 24
+	var points []Point3D
+	for i := 0; i < rings; i++ {
+		u := 2 * math.Pi * float64(i) / rings
+		for j := 0; j < segments; j++ {
+			v := 2 * math.Pi * float64(j) / segments
+			r := 1 + 0.4*math.Cos(v)
+			points = append(points, Point3D{r * math.Cos(u), 0.4 * math.Sin(v), r * math.Sin(u)})
+		}
+	}
+	return points
+}
+
+func textShape(text string) ([]Point3D, error) {
+	// Sample the lit pixels of the scroller font on a coarse grid
+	font, err := png.Decode(bytes.NewReader(fontPng))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode font: %v", err)
+	}
+	const step = 4
+	var points []Point3D
+	for n, c := range text {
+		charPos, ok := charMap[c]
+		if !ok {
+			continue
+		}
+		for y := 0; y < fontHeight; y += step {
+			for x := 0; x < fontWidth; x += step {
+				r, g, b, _ := font.At(charPos[0]*fontWidth+x, charPos[1]*fontHeight+y).RGBA()
+				if r+g+b == 0 {
+					continue
+				}
+				points = append(points, Point3D{float64(n*fontWidth + x), float64(y), 0})
+			}
+		}
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no printable characters in %q", text)
+	}
+	return points, nil
+}
+
+func loadObjShape(path string) ([]Point3D, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var vertices []Point3D
+	var triangles [][3]int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("bad vertex %q", scanner.Text())
+			}
+			var v [3]float64
+			for i := range v {
+				v[i], err = strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad vertex %q: %v", scanner.Text(), err)
+				}
+			}
+			// OBJ is Y-up, the screen is Y-down
+			vertices = append(vertices, Point3D{v[0], -v[1], v[2]})
+		case "f":
+			var face []int
+			for _, field := range fields[1:] {
+				// Faces look like "f 1 2 3" or "f 1/1/1 2/2/2 3/3/3"
+				index, err := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+				if err != nil {
+					return nil, fmt.Errorf("bad face %q: %v", scanner.Text(), err)
+				}
+				if index < 0 {
+					index += len(vertices) + 1
+				}
+				face = append(face, index-1)
+			}
+			for i := 1; i+1 < len(face); i++ {
+				triangles = append(triangles, [3]int{face[0], face[i], face[i+1]})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(vertices) == 0 {
+		return nil, fmt.Errorf("%s has no vertices", path)
+	}
+	for _, tri := range triangles {
+		for _, index := range tri {
+			if index < 0 || index >= len(vertices) {
+				return nil, fmt.Errorf("face index %d out of range", index+1)
+			}
+		}
+	}
+	if len(triangles) == 0 {
+		return vertices, nil
+	}
+	return sampleTriangles(vertices, triangles), nil
+}
+
+func sampleTriangles(vertices []Point3D, triangles [][3]int) []Point3D {
+	// Spread points over the surface in proportion to triangle area
+	areas := make([]float64, len(triangles))
+	total := 0.0
+	for i, tri := range triangles {
+		a, b, c := vertices[tri[0]], vertices[tri[1]], vertices[tri[2]]
+		u := Point3D{b.x - a.x, b.y - a.y, b.z - a.z}
+		v := Point3D{c.x - a.x, c.y - a.y, c.z - a.z}
+		cross := Point3D{u.y*v.z - u.z*v.y, u.z*v.x - u.x*v.z, u.x*v.y - u.y*v.x}
+		total += math.Sqrt(cross.x*cross.x+cross.y*cross.y+cross.z*cross.z) / 2
+		areas[i] = total
+	}
+
+	points := make([]Point3D, numBallPoints)
+	for i := range points {
+		// Stratified rather than random so the shape doesn't shimmer between runs
+		target := (float64(i) + 0.5) / numBallPoints * total
+		t := sort.SearchFloat64s(areas, target)
+		if t >= len(triangles) {
+			t = len(triangles) - 1
+		}
+		tri := triangles[t]
+		a, b, c := vertices[tri[0]], vertices[tri[1]], vertices[tri[2]]
+		s1 := math.Mod(float64(i)*0.618034, 1)
+		s2 := math.Mod(float64(i)*0.754878, 1)
+		if s1+s2 > 1 {
+			s1, s2 = 1-s1, 1-s2
+		}
+		points[i] = Point3D{
+			a.x + s1*(b.x-a.x) + s2*(c.x-a.x),
+			a.y + s1*(b.y-a.y) + s2*(c.y-a.y),
+			a.z + s1*(b.z-a.z) + s2*(c.z-a.z),
+		}
+	}
+	return points
+}
+
+func normalizeShape(points []Point3D) []Point3D {
+	// Centre the cloud and scale it to fit the unit cube
+	minP, maxP := points[0], points[0]
+	for _, p := range points {
+		minP = Point3D{math.Min(minP.x, p.x), math.Min(minP.y, p.y), math.Min(minP.z, p.z)}
+		maxP = Point3D{math.Max(maxP.x, p.x), math.Max(maxP.y, p.y), math.Max(maxP.z, p.z)}
+	}
+	centre := lerpPoint(minP, maxP, 0.5)
+	extent := math.Max(maxP.x-minP.x, math.Max(maxP.y-minP.y, maxP.z-minP.z)) / 2
+	if extent == 0 {
+		extent = 1
+	}
+
+	// Sorting top to bottom makes the morphs flow instead of scatter
+	sorted := append([]Point3D(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].y < sorted[j].y })
+
+	shape := make([]Point3D, numBallPoints)
+	for i := range shape {
+		p := sorted[i*len(sorted)/numBallPoints]
+		shape[i] = Point3D{(p.x - centre.x) / extent, (p.y - centre.y) / extent, (p.z - centre.z) / extent}
+	}
+	return shape
+}
+
+func lerpPoint(a, b Point3D, t float64) Point3D {
+	return Point3D{a.x + (b.x-a.x)*t, a.y + (b.y-a.y)*t, a.z + (b.z-a.z)*t}
+}
+
+func morphedBalls(angle float64) []projectedBall {
+	// Hold each shape, then ease into the next one
+	elapsed := time.Since(startTime).Seconds()
+	cycle := int(elapsed / (morphHold + morphTime))
+	from := ballShapes[cycle%len(ballShapes)]
+	to := ballShapes[(cycle+1)%len(ballShapes)]
+	t := math.Max(0, math.Mod(elapsed, morphHold+morphTime)-morphHold) / morphTime
+	t = t * t * (3 - 2*t)
+
+	balls := make([]projectedBall, numBallPoints)
+	for i := range balls {
+		rotated := transformPoint(objectOrientation, rotatePoint(lerpPoint(from[i], to[i], t), angle))
+		projected := projectPoint(rotated)
+		balls[i] = projectedBall{projected.x, projected.y, projected.z}
+	}
+
+	// Painter's algorithm, furthest balls first
+	sort.Slice(balls, func(i, j int) bool { return balls[i].z > balls[j].z })
+	return balls
+}
+
+// Shade by depth relative to the object centre, in object units
+func ballShade(depth float64) float64 {
+	z := (depth - objectDepth()) / zoomFactor
+	return math.Max(0.25, math.Min(1, 0.65-0.35*z))
+}
+
+func drawVectorBalls(angle float64) {
+	for _, ball := range morphedBalls(angle) {
+		size := float64(windowHeight) * 0.07 * zoomFactor * cameraDistance / ball.z
+		shade := uint8(255 * ballShade(ball.z))
+		err := ballTexture.SetColorMod(shade, shade, shade)
+		if err != nil {
+			return
+		}
+		dstRect := sdl.FRect{X: float32(ball.x - size/2), Y: float32(ball.y - size/2), W: float32(size), H: float32(size)}
+		err = renderer.CopyF(ballTexture, nil, &dstRect)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func drawDotObject(angle float64) {
+	for _, ball := range morphedBalls(angle) {
+		shade := uint8(255 * ballShade(ball.z))
+		err := renderer.SetDrawColor(shade, shade, shade, 255)
+		if err != nil {
+			return
+		}
+		size := float32(math.Max(1, float64(windowHeight)/192*zoomFactor*cameraDistance/ball.z))
+		err = renderer.FillRectF(&sdl.FRect{X: float32(ball.x) - size/2, Y: float32(ball.y) - size/2, W: size, H: size})
+		if err != nil {
+			return
+		}
+	}
+}